@@ -0,0 +1,103 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kelemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// ExportCommand is the first argument that runs Export instead of the server.
+const ExportCommand = "export"
+
+// Export prints the timeline of a trace from the /extensions/api/v1/export endpoint of a frontend.
+func Export(args []string, output io.Writer) error {
+	fs := pflag.NewFlagSet("kelemetry export", pflag.ContinueOnError)
+
+	server := fs.String("server", "http://localhost:8080", "URL of the frontend with --trace-server-enable")
+	token := fs.String("token", os.Getenv("KELEMETRY_TOKEN"), "bearer token if the frontend has --http-auth-enable")
+	timeout := fs.Duration("timeout", time.Minute, "timeout of the request")
+
+	params := map[string]*string{}
+	for _, param := range []struct{ name, usage string }{
+		{"cluster", "cluster of the object"},
+		{"resource", "plural resource name of the object"},
+		{"namespace", "namespace of the object, empty for cluster-scoped objects"},
+		{"name", "name of the object"},
+		{"start", "start of the time range in RFC 3339"},
+		{"end", "end of the time range in RFC 3339"},
+		{"traceId", "trace ID displayed in the Jaeger UI, instead of the object and the time range"},
+		{"displayMode", "display mode of the trace, which must display events as spans"},
+		{"format", "output format: text, json or yaml"},
+	} {
+		params[param.name] = fs.String(param.name, "", param.usage)
+	}
+	*params["format"] = "text"
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, pflag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	query := url.Values{}
+	for name, value := range params {
+		if *value != "" {
+			query.Set(name, *value)
+		}
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), *timeout)
+	defer cancelFunc()
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet,
+		strings.TrimSuffix(*server, "/")+"/extensions/api/v1/export?"+query.Encode(),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("invalid --server: %w", err)
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot request timeline: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("frontend responded %s: %s", resp.Status, string(body))
+	}
+
+	if _, err := io.Copy(output, resp.Body); err != nil {
+		return fmt.Errorf("cannot read timeline: %w", err)
+	}
+
+	return nil
+}
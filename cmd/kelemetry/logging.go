@@ -15,6 +15,7 @@
 package kelemetry
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,6 +25,8 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/util/logfields"
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
 )
 
 type loggingOptions struct {
@@ -31,33 +34,63 @@ type loggingOptions struct {
 	formatter string
 	file      string
 	dot       string
+	graph     string
 	usage     string
 }
 
 func (options *loggingOptions) setup(fs *pflag.FlagSet) {
-	fs.StringVar(&options.level, "log-level", "debug", "logrus log level")
-	fs.StringVar(&options.formatter, "log-format", "text", "logrus log format")
+	setupLogLevel(&options.level, fs)
+	fs.StringVar(
+		&options.formatter,
+		"log-format",
+		"text",
+		"logrus log format, either \"text\" or \"json\"; json entries include the component, cluster, object and traceId correlation fields",
+	)
 	fs.StringVar(&options.file, "log-file", "", "logrus log output file (leave empty for stdout)")
 
 	fs.StringVar(&options.dot, "dot", "", "write dependencies as graphviz output")
+	fs.StringVar(
+		&options.graph,
+		"graph",
+		"",
+		"write dependencies between the enabled components to file and exit, in JSON if the file name ends with .json or graphviz otherwise",
+	)
 	fs.StringVar(&options.usage, "usage", "", "write command usage to file")
 }
 
-func (options *loggingOptions) execute(logger *logrus.Logger, fs *pflag.FlagSet) error {
-	logLevel, err := logrus.ParseLevel(options.level)
+func setupLogLevel(level *string, fs *pflag.FlagSet) {
+	fs.StringVar(
+		level,
+		"log-level",
+		"debug",
+		"logrus log level, optionally followed by comma-separated per-module levels such as \"info,diff-cache=debug,audit-consumer=warn\"",
+	)
+}
+
+func configureLogLevel(levels *loglevel.Levels, spec string) error {
+	defaultLevel, overrides, err := loglevel.Parse(spec, logrus.DebugLevel)
 	if err != nil {
-		return fmt.Errorf("invalid log level %q: %w", options.level, err)
+		return fmt.Errorf("invalid --log-level: %w", err)
+	}
+
+	levels.Configure(defaultLevel, overrides)
+	return nil
+}
+
+func (options *loggingOptions) execute(logger *logrus.Logger, levels *loglevel.Levels, fs *pflag.FlagSet) error {
+	if err := configureLogLevel(levels, options.level); err != nil {
+		return err
 	}
-	logger.SetLevel(logLevel)
 
 	switch options.formatter {
 	case "text":
 		logger.SetFormatter(&logrus.TextFormatter{})
 	case "json":
-		logger.SetFormatter(&logrus.JSONFormatter{})
+		logger.SetFormatter(&logfields.Formatter{Inner: &logrus.JSONFormatter{}})
 	default:
 		return fmt.Errorf("invalid log formatter %q", options.formatter)
 	}
+	levels.Install()
 
 	if options.file != "" {
 		writer, err := os.OpenFile(options.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
@@ -125,3 +158,45 @@ func (options *loggingOptions) execute(logger *logrus.Logger, fs *pflag.FlagSet)
 
 	return nil
 }
+
+// writeGraph writes the dependency graph of enabled components if --graph is specified.
+// Must be called after disabled components are trimmed.
+func (options *loggingOptions) writeGraph(logger logrus.FieldLogger, m *manager.Manager) (written bool, err error) {
+	if options.graph == "" {
+		return false, nil
+	}
+
+	var content []byte
+	if strings.HasSuffix(options.graph, ".json") {
+		content, err = json.MarshalIndent(m.Graph(), "", "  ")
+		if err != nil {
+			return false, err
+		}
+	} else {
+		content = []byte(m.Dot())
+	}
+
+	if err := os.WriteFile(options.graph, content, 0o644); err != nil {
+		return false, err
+	}
+
+	logger.Infof("dependency graph written to %s", options.graph)
+	return true, nil
+}
+
+// logLevelReloader reloads --log-level from the --config file.
+type logLevelReloader struct {
+	levels *loglevel.Levels
+}
+
+type logLevelOptions struct {
+	level string
+}
+
+func (options *logLevelOptions) Setup(fs *pflag.FlagSet) { setupLogLevel(&options.level, fs) }
+
+func (reloader logLevelReloader) ReloadOptions() manager.ReloadOptions { return &logLevelOptions{} }
+
+func (reloader logLevelReloader) Reload(options manager.ReloadOptions) error {
+	return configureLogLevel(reloader.levels, options.(*logLevelOptions).level)
+}
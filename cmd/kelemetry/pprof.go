@@ -16,13 +16,18 @@ package kelemetry
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/util/diagnostics"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -31,13 +36,20 @@ func init() {
 }
 
 type pprofOptions struct {
-	enable bool
-	addr   string
+	enable             bool
+	addr               string
+	maxProfileDuration time.Duration
 }
 
 func (options *pprofOptions) Setup(fs *pflag.FlagSet) {
-	fs.BoolVar(&options.enable, "pprof-enable", false, "enable pprof")
+	fs.BoolVar(&options.enable, "pprof-enable", false, "enable pprof and the diagnostics bundle endpoint")
 	fs.StringVar(&options.addr, "pprof-addr", ":6060", "pprof server bind address")
+	fs.DurationVar(
+		&options.maxProfileDuration,
+		"pprof-max-profile-duration",
+		time.Minute*5,
+		"maximum CPU profile duration that can be requested from /debug/bundle",
+	)
 }
 
 func (options *pprofOptions) EnableFlag() *bool { return &options.enable }
@@ -45,14 +57,34 @@ func (options *pprofOptions) EnableFlag() *bool { return &options.enable }
 type pprofServer struct {
 	options pprofOptions
 	Logger  logrus.FieldLogger
+
+	server *http.Server
 }
 
 func (server *pprofServer) Options() manager.Options { return &server.options }
 
 func (server *pprofServer) Init() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/bundle", server.handleBundle)
+
+	server.server = &http.Server{
+		Addr:              server.options.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	// started during Init so that slow initialization of other components can be profiled
 	go func() {
 		defer shutdown.RecoverPanic(server.Logger)
-		server.Logger.Error(http.ListenAndServe(server.options.addr, nil))
+
+		if err := server.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			server.Logger.WithError(err).Error("pprof server failed")
+		}
 	}()
 
 	return nil
@@ -60,4 +92,63 @@ func (server *pprofServer) Init() error {
 
 func (server *pprofServer) Start(ctx context.Context) error { return nil }
 
-func (server *pprofServer) Close(ctx context.Context) error { return nil }
+func (server *pprofServer) Close(ctx context.Context) error {
+	return server.server.Shutdown(ctx)
+}
+
+// handleBundle captures a CPU profile for `?seconds=` (default 30, 0 to skip),
+// then responds with a zip archive of the CPU profile, heap profiles, goroutine dump and runtime information.
+func (server *pprofServer) handleBundle(w http.ResponseWriter, r *http.Request) {
+	defer shutdown.RecoverPanic(server.Logger)
+
+	duration := time.Second * 30
+	if secondsString := r.URL.Query().Get("seconds"); secondsString != "" {
+		seconds, err := strconv.ParseUint(secondsString, 10, 32)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid seconds: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	if duration > server.options.maxProfileDuration {
+		http.Error(
+			w,
+			fmt.Sprintf("seconds must not exceed --pprof-max-profile-duration (%s)", server.options.maxProfileDuration),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	server.Logger.WithField("duration", duration).Info("Capturing diagnostics bundle")
+
+	resp := &bundleResponse{
+		ResponseWriter: w,
+		filename:       fmt.Sprintf("kelemetry-diagnostics-%s.zip", time.Now().UTC().Format("20060102T150405Z")),
+	}
+	if err := diagnostics.Capture(r.Context(), resp, duration); err != nil {
+		server.Logger.WithError(err).Warn("Cannot capture diagnostics bundle")
+		if !resp.started {
+			// e.g. another CPU profile is in progress
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	}
+}
+
+// bundleResponse sets the download headers on the first write,
+// so that an error status can still be sent if the capture fails before writing.
+type bundleResponse struct {
+	http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (resp *bundleResponse) Write(buf []byte) (int, error) {
+	if !resp.started {
+		resp.started = true
+		resp.Header().Set("Content-Type", "application/zip")
+		resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", resp.filename))
+	}
+
+	return resp.ResponseWriter.Write(buf)
+}
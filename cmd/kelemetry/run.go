@@ -19,18 +19,29 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
 func Main() {
 	rootLogger := logrus.New()
 
+	if len(os.Args) > 1 && os.Args[1] == ExportCommand {
+		if err := Export(os.Args[2:], os.Stdout); err != nil {
+			rootLogger.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := Run(rootLogger); err != nil {
 		rootLogger.Error(err.Error())
 		os.Exit(1)
@@ -40,7 +51,8 @@ func Main() {
 func Run(rootLogger *logrus.Logger) error {
 	manager := manager.Global
 	ctx, shutdownTrigger := shutdown.ContextWithTrigger(context.Background())
-	provideUtils(manager, rootLogger, shutdownTrigger)
+	logLevels := loglevel.New(rootLogger)
+	provideUtils(manager, rootLogger, logLevels, shutdownTrigger)
 
 	err := manager.Build()
 	if err != nil {
@@ -61,7 +73,15 @@ func Run(rootLogger *logrus.Logger) error {
 		return err
 	}
 
-	if err := loggingOptions.execute(rootLogger, fs); err != nil {
+	if err := manager.LoadConfigFile(fs); err != nil {
+		return err
+	}
+
+	if manager.ShouldDumpConfig() {
+		return manager.DumpConfig(fs, os.Stdout)
+	}
+
+	if err := loggingOptions.execute(rootLogger, logLevels, fs); err != nil {
 		return err
 	}
 
@@ -71,11 +91,23 @@ func Run(rootLogger *logrus.Logger) error {
 
 	manager.TrimDisabled(rootLogger)
 
+	if written, err := loggingOptions.writeGraph(rootLogger, manager); err != nil {
+		return fmt.Errorf("cannot write dependency graph: %w", err)
+	} else if written {
+		return nil
+	}
+
+	if err := manager.Validate(); err != nil {
+		return fmt.Errorf("invalid options:\n%w", err)
+	}
+
 	if err := manager.Init(ctx, rootLogger); err != nil {
 		return err
 	}
 
 	shutdownTrigger.SetupSignalHandler()
+	manager.AddReloadable("log-level", logLevelReloader{levels: logLevels})
+	setupReloadHandler(ctx, manager, rootLogger)
 	if err := manager.Start(rootLogger, ctx); err != nil {
 		return err
 	}
@@ -88,9 +120,39 @@ func Run(rootLogger *logrus.Logger) error {
 	return manager.Close(ctx, rootLogger)
 }
 
-func provideUtils(m *manager.Manager, logger logrus.FieldLogger, shutdownTrigger *shutdown.ShutdownTrigger) {
+func setupReloadHandler(ctx context.Context, manager *manager.Manager, logger logrus.FieldLogger) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	go func() {
+		defer shutdown.RecoverPanic(logger)
+		defer signal.Stop(ch)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				logger.Info("Received SIGHUP, reloading options")
+				if err := manager.Reload(logger); err != nil {
+					logger.WithError(err).Error("Error reloading options")
+				}
+			}
+		}
+	}()
+}
+
+func provideUtils(
+	m *manager.Manager,
+	logger logrus.FieldLogger,
+	logLevels *loglevel.Levels,
+	shutdownTrigger *shutdown.ShutdownTrigger,
+) {
 	m.ProvideUtil(func(ctx *manager.UtilContext) (logrus.FieldLogger, error) {
-		return logger.WithField("mod", ctx.ComponentName), nil
+		return logger.WithField(loglevel.ModField, ctx.ComponentName), nil
+	})
+	m.ProvideUtil(func() (*loglevel.Levels, error) {
+		return logLevels, nil
 	})
 	m.ProvideUtil(func() (*shutdown.ShutdownTrigger, error) {
 		return shutdownTrigger, nil
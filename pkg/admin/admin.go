@@ -0,0 +1,337 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Admin HTTP API for introspecting and controlling the components of a running process.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("admin", manager.Ptr(&api{}))
+}
+
+type options struct {
+	enable bool
+	token  string
+	users  []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "admin-enable", false, "enable the admin API under /admin on the HTTP server")
+	fs.StringVar(
+		&options.token,
+		"admin-token",
+		"",
+		"requests to the admin API must contain this value in the 'Authorization: Bearer' header; "+
+			"required if the admin API is enabled without --admin-users",
+	)
+	fs.StringSliceVar(
+		&options.users,
+		"admin-users",
+		[]string{},
+		"users authenticated by --http-auth-enable that may access the admin API in addition to --admin-token",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+func (options *options) Validate() error {
+	if options.token == "" && len(options.users) == 0 {
+		return fmt.Errorf("--admin-token or --admin-users must be specified if --admin-enable is set")
+	}
+	return nil
+}
+
+type api struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Manager   *manager.Manager
+	Server    kelemetryhttp.Server
+	LogLevels *loglevel.Levels
+	Auth      *auth.Authenticator
+
+	users sets.Set[string]
+}
+
+func (api *api) Options() manager.Options { return &api.options }
+
+func (api *api) Init() error {
+	if len(api.options.users) > 0 && !api.Auth.Enabled() {
+		return fmt.Errorf("--admin-users requires --http-auth-enable")
+	}
+	api.users = sets.New(api.options.users...)
+
+	routes := api.Server.Routes()
+	routes.GET("/admin/components", api.handler(api.handleList))
+	routes.GET("/admin/components/:name", api.handler(api.handleGet))
+	routes.POST("/admin/components/:name/flush", api.handler(api.handleFlush))
+	routes.POST("/admin/components/:name/debug", api.handler(api.handleDebug))
+	routes.GET("/admin/log-levels", api.handler(api.handleGetLogLevels))
+	routes.POST("/admin/log-levels", api.handler(api.handleSetLogLevel))
+	routes.POST("/admin/reload", api.handler(api.handleReload))
+	routes.GET("/admin/graph", api.handler(api.handleGraph))
+
+	return nil
+}
+
+func (api *api) Start(ctx context.Context) error { return nil }
+func (api *api) Close(ctx context.Context) error { return nil }
+
+func (api *api) handler(handle func(ctx *gin.Context, logger logrus.FieldLogger) error) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := api.Logger.WithField("source", ctx.Request.RemoteAddr).WithField("path", ctx.FullPath())
+		defer shutdown.RecoverPanic(logger)
+
+		token, _ := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if api.options.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(api.options.token)) != 1 {
+			user, err := api.authenticateUser(ctx, token)
+			if err != nil {
+				logger.WithError(err).Warn("Unauthorized admin request")
+				ctx.Status(http.StatusUnauthorized)
+				return
+			}
+			logger = logger.WithField("user", user)
+		}
+
+		logger.WithField("method", ctx.Request.Method).Info("Admin request")
+
+		if err := handle(ctx, logger); err != nil {
+			logger.WithError(err).Error()
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	}
+}
+
+// authenticateUser accepts users in --admin-users as an alternative to --admin-token.
+func (api *api) authenticateUser(ctx *gin.Context, token string) (string, error) {
+	if api.users.Len() == 0 {
+		return "", fmt.Errorf("invalid admin token")
+	}
+
+	user, err := api.Auth.Authenticate(ctx.Request.Context(), token)
+	if err != nil {
+		return "", err
+	}
+	if !api.users.Has(user.Name) {
+		return "", fmt.Errorf("user %q is not an admin", user.Name)
+	}
+	return user.Name, nil
+}
+
+type componentView struct {
+	Name         string            `json:"name"`
+	Dependencies []string          `json:"dependencies"`
+	Options      map[string]string `json:"options"`
+	MuxImpls     []string          `json:"muxImpls,omitempty"`
+	MuxChosen    string            `json:"muxChosen,omitempty"`
+	LogLevel     string            `json:"logLevel"`
+	CanFlush     bool              `json:"canFlush"`
+	Status       map[string]any    `json:"status,omitempty"`
+}
+
+func (api *api) view(summary manager.ComponentSummary) componentView {
+	view := componentView{
+		Name:         summary.Name,
+		Dependencies: summary.Dependencies,
+		Options:      make(map[string]string, len(summary.Options)),
+		MuxImpls:     summary.MuxImpls,
+		MuxChosen:    summary.MuxChosen,
+		LogLevel:     api.LogLevels.Get(summary.Name).String(),
+	}
+
+	for name, value := range summary.Options {
+		if isSensitiveOption(name) && value != "" {
+			value = "<redacted>"
+		}
+		view.Options[name] = value
+	}
+
+	if _, canFlush := summary.Component.(manager.CacheFlusher); canFlush {
+		view.CanFlush = true
+	}
+
+	if reporter, isReporter := summary.Component.(manager.StatusReporter); isReporter {
+		view.Status = reporter.Status()
+	}
+
+	return view
+}
+
+// isSensitiveOption returns whether the value of an option should not be exposed in the admin API.
+func isSensitiveOption(name string) bool {
+	for _, keyword := range []string{"token", "password", "secret", "key", "credential"} {
+		if strings.Contains(name, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *api) find(name string) (manager.ComponentSummary, bool) {
+	for _, summary := range api.Manager.Components() {
+		if summary.Name == name {
+			return summary, true
+		}
+	}
+	return manager.ComponentSummary{}, false
+}
+
+func (api *api) handleList(ctx *gin.Context, logger logrus.FieldLogger) error {
+	summaries := api.Manager.Components()
+
+	views := make([]componentView, len(summaries))
+	for i, summary := range summaries {
+		views[i] = api.view(summary)
+	}
+
+	ctx.JSON(http.StatusOK, views)
+	return nil
+}
+
+func (api *api) handleGet(ctx *gin.Context, logger logrus.FieldLogger) error {
+	summary, exists := api.find(ctx.Param("name"))
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no such component"})
+		return nil
+	}
+
+	ctx.JSON(http.StatusOK, api.view(summary))
+	return nil
+}
+
+func (api *api) handleFlush(ctx *gin.Context, logger logrus.FieldLogger) error {
+	summary, exists := api.find(ctx.Param("name"))
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no such component"})
+		return nil
+	}
+
+	flusher, canFlush := summary.Component.(manager.CacheFlusher)
+	if !canFlush {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "component has no flushable cache"})
+		return nil
+	}
+
+	if err := flusher.FlushCache(ctx); err != nil {
+		return fmt.Errorf("cannot flush cache of %q: %w", summary.Name, err)
+	}
+
+	logger.WithField("target", summary.Name).Info("Flushed cache")
+	ctx.Status(http.StatusNoContent)
+	return nil
+}
+
+func (api *api) handleDebug(ctx *gin.Context, logger logrus.FieldLogger) error {
+	summary, exists := api.find(ctx.Param("name"))
+	if !exists {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no such component"})
+		return nil
+	}
+
+	enable, err := strconv.ParseBool(ctx.DefaultQuery("enable", "true"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid enable parameter: %s", err.Error())})
+		return nil
+	}
+
+	if enable {
+		api.LogLevels.SetOverride(summary.Name, logrus.DebugLevel)
+	} else {
+		api.LogLevels.ClearOverride(summary.Name)
+	}
+
+	logger.WithField("target", summary.Name).WithField("enable", enable).Info("Toggled debug logging")
+	ctx.Status(http.StatusNoContent)
+	return nil
+}
+
+type logLevelsView struct {
+	Default   string            `json:"default"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+func (api *api) handleGetLogLevels(ctx *gin.Context, logger logrus.FieldLogger) error {
+	ctx.JSON(http.StatusOK, logLevelsView{
+		Default:   api.LogLevels.Default().String(),
+		Overrides: api.LogLevels.Overrides(),
+	})
+	return nil
+}
+
+func (api *api) handleSetLogLevel(ctx *gin.Context, logger logrus.FieldLogger) error {
+	module := strings.Trim(ctx.Query("module"), "/")
+	if module == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "module parameter is required"})
+		return nil
+	}
+
+	levelString := ctx.Query("level")
+	if levelString == "" {
+		api.LogLevels.ClearOverride(module)
+		logger.WithField("module", module).Info("Cleared log level override")
+		ctx.Status(http.StatusNoContent)
+		return nil
+	}
+
+	level, err := logrus.ParseLevel(levelString)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid level parameter: %s", err.Error())})
+		return nil
+	}
+
+	api.LogLevels.SetOverride(module, level)
+	logger.WithField("module", module).WithField("level", level).Info("Set log level override")
+	ctx.Status(http.StatusNoContent)
+	return nil
+}
+
+func (api *api) handleReload(ctx *gin.Context, logger logrus.FieldLogger) error {
+	if err := api.Manager.Reload(logger); err != nil {
+		return err
+	}
+
+	ctx.Status(http.StatusNoContent)
+	return nil
+}
+
+func (api *api) handleGraph(ctx *gin.Context, logger logrus.FieldLogger) error {
+	switch format := ctx.DefaultQuery("format", "json"); format {
+	case "json":
+		ctx.JSON(http.StatusOK, api.Manager.Graph())
+	case "dot":
+		ctx.String(http.StatusOK, api.Manager.Dot())
+	default:
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown format %q", format)})
+	}
+
+	return nil
+}
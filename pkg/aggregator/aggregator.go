@@ -16,11 +16,16 @@ package aggregator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/utils/clock"
 
@@ -28,11 +33,17 @@ import (
 	"github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator"
 	linkjob "github.com/kubewharf/kelemetry/pkg/aggregator/linker/job"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/shard"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/spancache"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracecontext"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterhealth"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
+	"github.com/kubewharf/kelemetry/pkg/util/logfields"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
 )
 
@@ -41,11 +52,20 @@ func init() {
 }
 
 type options struct {
-	reserveTtl       time.Duration
-	spanTtl          time.Duration
-	spanExtraTtl     time.Duration
-	globalPseudoTags map[string]string
-	globalEventTags  map[string]string
+	reserveTtl          time.Duration
+	reserveMargin       time.Duration
+	spanTtl             time.Duration
+	spanTtlOverrides    map[string]string
+	spanExtraTtl        time.Duration
+	activityIdle        time.Duration
+	activityMaxDuration time.Duration
+	activityCheckpoint  string
+	checkpointInterval  time.Duration
+	chainWindows        bool
+	globalPseudoTags    map[string]string
+	globalEventTags     map[string]string
+	pseudoSpanName      string
+	eventSpanName       string
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -56,11 +76,54 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		"if an object span has not been created after this duration, "+
 			"another goroutine/process will try to create it",
 	)
+	fs.DurationVar(
+		&options.reserveMargin,
+		"aggregator-reserve-expiry-margin",
+		time.Second,
+		"abandon a reservation instead of creating the object span "+
+			"if less than this duration remains before --aggregator-reserve-ttl elapses, "+
+			"since another goroutine/process may have taken over the reservation",
+	)
 	fs.DurationVar(&options.spanTtl,
 		"aggregator-span-ttl",
 		time.Minute*30,
 		"duration of each span",
 	)
+	fs.StringToStringVar(&options.spanTtlOverrides,
+		"aggregator-span-ttl-override",
+		map[string]string{},
+		"duration of spans of specific resources in the form 'resource.group=duration' overriding --aggregator-span-ttl, "+
+			"e.g. 'deployments.apps=2h,pods=10m'",
+	)
+	fs.DurationVar(&options.activityIdle,
+		"aggregator-activity-window-idle",
+		0,
+		"if nonzero, events of an object that arrive within this duration after the previous event "+
+			"continue the trace of the previous window instead of starting a new one; "+
+			"requires events of the same object to be consumed by the same replica",
+	)
+	fs.DurationVar(&options.activityMaxDuration,
+		"aggregator-activity-window-max-duration",
+		time.Hour*6,
+		"maximum duration of a trace extended by --aggregator-activity-window-idle",
+	)
+	fs.StringVar(&options.activityCheckpoint,
+		"aggregator-activity-checkpoint-path",
+		"",
+		"if nonempty, periodically save the windows extended by --aggregator-activity-window-idle to this file "+
+			"and restore them on startup, so that traces of active objects continue after a crash; "+
+			"the file should be on a volume that survives container restarts",
+	)
+	fs.DurationVar(&options.checkpointInterval,
+		"aggregator-activity-checkpoint-interval",
+		time.Second*30,
+		"frequency to save the activity windows to --aggregator-activity-checkpoint-path",
+	)
+	fs.BoolVar(&options.chainWindows,
+		"aggregator-chain-windows",
+		true,
+		"link the object span of each window to the object span of the previous window with a follows-from reference",
+	)
 	fs.DurationVar(&options.spanExtraTtl,
 		"aggregator-span-extra-ttl",
 		0,
@@ -76,6 +139,18 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		map[string]string{},
 		"tags applied to all event spans",
 	)
+	fs.StringVar(&options.pseudoSpanName,
+		"aggregator-pseudo-span-name-template",
+		defaultPseudoSpanNameTemplate,
+		"Go template of the operation name of object/spec/status/deletion pseudo-spans; "+
+			"available fields are .Cluster, .Group, .Version, .Resource, .Namespace, .Name and .PseudoType",
+	)
+	fs.StringVar(&options.eventSpanName,
+		"aggregator-event-span-name-template",
+		defaultEventSpanNameTemplate,
+		"Go template of the operation name of event spans; "+
+			"available fields are those of pseudo-spans, .TraceSource, .Title, .Verb (audit spans only) and .Tags",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -93,7 +168,16 @@ type Aggregator interface {
 		eventTime time.Time,
 	) (tracer.SpanContext, error)
 
+	// TouchObjectSpan is EnsureObjectSpan, additionally returning whether the object span was created by this call,
+	// i.e. no other events of the object have been sent in the same window.
+	TouchObjectSpan(
+		ctx context.Context,
+		object utilobject.Rich,
+		eventTime time.Time,
+	) (span tracer.SpanContext, isNew bool, err error)
+
 	// GetOrCreatePseudoSpan creates a span following the pseudospan standard with the required tags.
+	// Returns an error wrapping shard.ErrOwnerUnavailable if the creation should be retried later.
 	GetOrCreatePseudoSpan(
 		ctx context.Context,
 		object utilobject.Rich,
@@ -114,6 +198,10 @@ type aggregator struct {
 	Tracer           tracer.Tracer
 	Metrics          metrics.Client
 	LinkJobPublisher linkjob.Publisher
+	ShardRouter      *shard.Router
+	TraceContext     *tracecontext.Extractor
+	ClusterHealth    *clusterhealth.Health
+	SelfTrace        *selftrace.Tracer
 
 	EventDecorators      *manager.List[eventdecorator.Decorator]
 	ObjectSpanDecorators *manager.List[objectspandecorator.Decorator]
@@ -122,6 +210,16 @@ type aggregator struct {
 	SinceEventMetric         *metrics.Metric[*sinceEventMetric]
 	LazySpanMetric           *metrics.Metric[*lazySpanMetric]
 	LazySpanRetryCountMetric *metrics.Metric[*lazySpanRetryCountMetric]
+	ReservationHoldMetric    *metrics.Metric[*reservationHoldMetric]
+
+	ttlOverrides map[schema.GroupResource]time.Duration
+
+	pseudoSpanNameTemplate *template.Template
+	eventSpanNameTemplate  *template.Template
+	activity               activityTracker
+
+	// tracks in-flight calls so that Close returns before the tracer is flushed.
+	inflight sync.WaitGroup
 }
 
 type sendMetric struct {
@@ -152,29 +250,121 @@ type lazySpanRetryCountMetric lazySpanMetric
 
 func (*lazySpanRetryCountMetric) MetricName() string { return "aggregator_lazy_span_retry_count" }
 
+// reservationHoldMetric observes the duration between reserving a span cache entry and persisting it.
+type reservationHoldMetric struct {
+	Cluster    string
+	PseudoType zconstants.PseudoTypeValue
+	Result     string
+}
+
+func (*reservationHoldMetric) MetricName() string { return "aggregator_reservation_hold" }
+
 func (aggregator *aggregator) Options() manager.Options {
 	return &aggregator.options
 }
 
-func (aggregator *aggregator) Init() error { return nil }
+func (aggregator *aggregator) Init() error {
+	if aggregator.options.spanTtl < time.Second {
+		return fmt.Errorf("--aggregator-span-ttl must be at least 1s")
+	}
+
+	if aggregator.options.reserveMargin < 0 || aggregator.options.reserveMargin >= aggregator.options.reserveTtl {
+		return fmt.Errorf("--aggregator-reserve-expiry-margin must be non-negative and less than --aggregator-reserve-ttl")
+	}
+
+	ttlOverrides, err := parseTtlOverrides(aggregator.options.spanTtlOverrides)
+	if err != nil {
+		return fmt.Errorf("invalid --aggregator-span-ttl-override: %w", err)
+	}
+	aggregator.ttlOverrides = ttlOverrides
+
+	aggregator.pseudoSpanNameTemplate, err = parseSpanNameTemplate(aggregator.options.pseudoSpanName, defaultPseudoSpanNameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid --aggregator-pseudo-span-name-template: %w", err)
+	}
+	aggregator.eventSpanNameTemplate, err = parseSpanNameTemplate(aggregator.options.eventSpanName, defaultEventSpanNameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid --aggregator-event-span-name-template: %w", err)
+	}
+
+	aggregator.activity.objects = map[utilobject.Key]*objectActivity{}
+	if aggregator.options.activityIdle > 0 && aggregator.options.activityCheckpoint != "" {
+		if aggregator.options.checkpointInterval <= 0 {
+			return fmt.Errorf("--aggregator-activity-checkpoint-interval must be positive")
+		}
+
+		aggregator.restoreActivity()
+	}
+
+	aggregator.ShardRouter.SetHandler(aggregator.handleForwardedPseudoSpan)
+	return nil
+}
+
+func (aggregator *aggregator) Start(ctx context.Context) error {
+	if aggregator.options.activityIdle > 0 {
+		go func() {
+			defer shutdown.RecoverPanic(aggregator.Logger)
+			aggregator.runActivityPruner(ctx)
+		}()
+
+		if aggregator.options.activityCheckpoint != "" {
+			go func() {
+				defer shutdown.RecoverPanic(aggregator.Logger)
+				aggregator.runActivityCheckpointer(ctx)
+			}()
+		}
+	}
 
-func (aggregator *aggregator) Start(ctx context.Context) error { return nil }
+	return nil
+}
 
-func (aggregator *aggregator) Close(ctx context.Context) error { return nil }
+func (aggregator *aggregator) Close(ctx context.Context) error {
+	doneCh := make(chan struct{})
+	go func() {
+		aggregator.inflight.Wait()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for in-flight aggregation: %w", ctx.Err())
+	}
+
+	if aggregator.options.activityIdle > 0 && aggregator.options.activityCheckpoint != "" {
+		aggregator.checkpointActivity()
+	}
+
+	return nil
+}
 
 func (aggregator *aggregator) Send(
 	ctx context.Context,
 	object utilobject.Rich,
 	event *aggregatorevent.Event,
 ) (err error) {
+	aggregator.inflight.Add(1)
+	defer aggregator.inflight.Done()
+
 	sendMetric := &sendMetric{Cluster: object.Cluster, TraceSource: event.TraceSource}
 	defer aggregator.SendMetric.DeferCount(aggregator.Clock.Now(), sendMetric)
 
+	ctx, selfSpan := aggregator.SelfTrace.StartChildSpan(
+		ctx,
+		"aggregator.send",
+		attribute.String("cluster", object.Cluster),
+		attribute.String("resource", object.Resource),
+		attribute.String("traceSource", event.TraceSource),
+	)
+	defer func() { selftrace.EndSpan(selfSpan, err) }()
+
 	aggregator.SinceEventMetric.
 		With(&sinceEventMetric{Cluster: object.Cluster, TraceSource: event.TraceSource}).
 		Summary(float64(aggregator.Clock.Since(event.Time).Nanoseconds()))
 
-	parentSpan, err := aggregator.EnsureObjectSpan(ctx, object, event.Time)
+	ensureCtx, ensureSpan := aggregator.SelfTrace.StartChildSpan(ctx, "aggregator.ensureObjectSpan")
+	parentSpan, err := aggregator.EnsureObjectSpan(ensureCtx, object, event.Time)
+	selftrace.EndSpan(ensureSpan, err)
 	if err != nil {
 		sendMetric.Error = metrics.LabelError(err, "EnsureObjectSpan")
 		return fmt.Errorf("%w during ensuring object span", err)
@@ -190,21 +380,26 @@ func (aggregator *aggregator) Send(
 
 	span := tracer.Span{
 		Type:       event.TraceSource,
-		Name:       event.Title,
 		StartTime:  event.Time,
 		FinishTime: event.GetEndTime(),
 		Parent:     parentSpan,
 		Tags:       tags,
 		Logs:       event.Logs,
 	}
+	eventTags := make(map[string]string, len(event.Tags))
 	for tagKey, tagValue := range event.Tags {
-		span.Tags[tagKey] = fmt.Sprint(tagValue)
+		eventTags[tagKey] = fmt.Sprint(tagValue)
+		span.Tags[tagKey] = eventTags[tagKey]
 	}
+	span.Name = aggregator.eventSpanName(object, event.TraceSource, event.Title, eventTags)
 	for tagKey, tagValue := range aggregator.options.globalPseudoTags {
 		span.Tags[tagKey] = tagValue
 	}
+	aggregator.tagDegraded(object.Cluster, span.Tags)
 
-	_, err = aggregator.Tracer.CreateSpan(span)
+	_, createSpan := aggregator.SelfTrace.StartChildSpan(ctx, "tracer.createSpan")
+	spanContext, err := aggregator.Tracer.CreateSpan(span)
+	selftrace.EndSpan(createSpan, err)
 	if err != nil {
 		sendMetric.Error = metrics.LabelError(err, "CreateSpan")
 		return fmt.Errorf("cannot create span: %w", err)
@@ -213,6 +408,7 @@ func (aggregator *aggregator) Send(
 	sendMetric.Success = true
 
 	aggregator.Logger.WithFields(object.AsFields("object")).
+		WithField(logfields.TraceId, tracer.TraceIdOf(spanContext)).
 		WithField("event", event.Title).
 		WithField("logs", len(event.Logs)).
 		Debug("CreateSpan")
@@ -225,9 +421,21 @@ func (agg *aggregator) EnsureObjectSpan(
 	object utilobject.Rich,
 	eventTime time.Time,
 ) (tracer.SpanContext, error) {
+	span, _, err := agg.TouchObjectSpan(ctx, object, eventTime)
+	return span, err
+}
+
+func (agg *aggregator) TouchObjectSpan(
+	ctx context.Context,
+	object utilobject.Rich,
+	eventTime time.Time,
+) (tracer.SpanContext, bool, error) {
+	agg.inflight.Add(1)
+	defer agg.inflight.Done()
+
 	span, isNew, err := agg.GetOrCreatePseudoSpan(ctx, object, zconstants.PseudoTypeObject, eventTime, nil, nil, nil, "object")
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	if isNew {
@@ -238,7 +446,7 @@ func (agg *aggregator) EnsureObjectSpan(
 		})
 	}
 
-	return span, nil
+	return span, isNew, nil
 }
 
 type spanCreator struct {
@@ -247,6 +455,9 @@ type spanCreator struct {
 	retries     int32
 	fetchedSpan tracer.SpanContext
 	reserveUid  spancache.Uid
+	// reservedAt is a lower bound of the time at which the reservation was created,
+	// taken before the request so that the reservation TTL is never overestimated.
+	reservedAt time.Time
 }
 
 func (c *spanCreator) fetchOrReserve(
@@ -255,6 +466,7 @@ func (c *spanCreator) fetchOrReserve(
 ) error {
 	c.retries += 1
 
+	requestTime := agg.Clock.Now()
 	entry, err := agg.SpanCache.FetchOrReserve(ctx, c.cacheKey, agg.options.reserveTtl)
 	if err != nil {
 		return metrics.LabelError(fmt.Errorf("%w during fetch-or-reserve of object span", err), "FetchOrReserve")
@@ -273,9 +485,14 @@ func (c *spanCreator) fetchOrReserve(
 
 	// else, a new reservation was created
 	c.reserveUid = entry.LastUid
+	c.reservedAt = requestTime
 	return nil
 }
 
+// maxForwardReroutes is the number of times pseudospan creation is forwarded to a new shard owner
+// after being rejected by the previous one, to avoid bouncing between replicas during lease churn.
+const maxForwardReroutes = 3
+
 func (agg *aggregator) GetOrCreatePseudoSpan(
 	ctx context.Context,
 	object utilobject.Rich,
@@ -285,6 +502,135 @@ func (agg *aggregator) GetOrCreatePseudoSpan(
 	followsFrom tracer.SpanContext,
 	extraTags map[string]string,
 	dedupId string,
+) (_span tracer.SpanContext, _isNew bool, _err error) {
+	agg.inflight.Add(1)
+	defer agg.inflight.Done()
+
+	owner := agg.ShardRouter.Route(object.Key)
+	for attempt := 0; owner != ""; attempt++ {
+		span, isNew, rejected, err := agg.forwardPseudoSpan(ctx, owner, object, pseudoType, eventTime, parent, followsFrom, extraTags, dedupId)
+		if err == nil {
+			return span, isNew, nil
+		}
+		if !rejected {
+			// the owner may have created the pseudospan, so creating it locally may duplicate it
+			return nil, false, fmt.Errorf("cannot forward pseudospan creation to shard owner %s: %w", owner, err)
+		}
+
+		// the owner has not created the pseudospan, so it can be created by the new owner or locally
+		newOwner := agg.ShardRouter.Route(object.Key)
+		if newOwner == owner || attempt >= maxForwardReroutes {
+			return nil, false, fmt.Errorf("shard owner %s rejected pseudospan creation: %w: %w", owner, shard.ErrOwnerUnavailable, err)
+		}
+
+		agg.Logger.WithFields(object.AsFields("object")).
+			WithField("owner", owner).
+			WithField("newOwner", newOwner).
+			WithError(err).
+			Debug("shard owner rejected pseudospan creation, rerouting")
+		owner = newOwner
+	}
+
+	return agg.getOrCreatePseudoSpanLocal(ctx, object, pseudoType, eventTime, parent, followsFrom, extraTags, dedupId)
+}
+
+func (agg *aggregator) forwardPseudoSpan(
+	ctx context.Context,
+	owner string,
+	object utilobject.Rich,
+	pseudoType zconstants.PseudoTypeValue,
+	eventTime time.Time,
+	parent tracer.SpanContext,
+	followsFrom tracer.SpanContext,
+	extraTags map[string]string,
+	dedupId string,
+) (_ tracer.SpanContext, _isNew bool, _rejected bool, _ error) {
+	request := &shard.PseudoSpanRequest{
+		Object:     object,
+		PseudoType: pseudoType,
+		EventTime:  eventTime,
+		ExtraTags:  extraTags,
+		DedupId:    dedupId,
+	}
+
+	var err error
+	if parent != nil {
+		if request.Parent, err = agg.Tracer.InjectCarrier(parent); err != nil {
+			return nil, false, false, metrics.LabelError(fmt.Errorf("cannot serialize parent span context: %w", err), "InjectCarrier")
+		}
+	}
+	if followsFrom != nil {
+		if request.FollowsFrom, err = agg.Tracer.InjectCarrier(followsFrom); err != nil {
+			return nil, false, false, metrics.LabelError(fmt.Errorf("cannot serialize followsFrom span context: %w", err), "InjectCarrier")
+		}
+	}
+
+	response, rejected, err := agg.ShardRouter.Forward(ctx, owner, request)
+	if err != nil {
+		return nil, false, rejected, err
+	}
+
+	span, err := agg.Tracer.ExtractCarrier(response.Span)
+	if err != nil {
+		return nil, false, false, metrics.LabelError(fmt.Errorf("shard owner returned invalid span context: %w", err), "BadCarrier")
+	}
+
+	return span, response.IsNew, false, nil
+}
+
+func (agg *aggregator) handleForwardedPseudoSpan(
+	ctx context.Context,
+	request *shard.PseudoSpanRequest,
+) (*shard.PseudoSpanResponse, error) {
+	agg.inflight.Add(1)
+	defer agg.inflight.Done()
+
+	var parent, followsFrom tracer.SpanContext
+	var err error
+	if request.Parent != nil {
+		if parent, err = agg.Tracer.ExtractCarrier(request.Parent); err != nil {
+			return nil, fmt.Errorf("invalid parent span context: %w", err)
+		}
+	}
+	if request.FollowsFrom != nil {
+		if followsFrom, err = agg.Tracer.ExtractCarrier(request.FollowsFrom); err != nil {
+			return nil, fmt.Errorf("invalid followsFrom span context: %w", err)
+		}
+	}
+
+	// always create locally, even if the shard moved to another replica in the meantime,
+	// to avoid forwarding loops
+	span, isNew, err := agg.getOrCreatePseudoSpanLocal(
+		ctx,
+		request.Object,
+		request.PseudoType,
+		request.EventTime,
+		parent,
+		followsFrom,
+		request.ExtraTags,
+		request.DedupId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	carrier, err := agg.Tracer.InjectCarrier(span)
+	if err != nil {
+		return nil, fmt.Errorf("cannot serialize span context: %w", err)
+	}
+
+	return &shard.PseudoSpanResponse{Span: carrier, IsNew: isNew}, nil
+}
+
+func (agg *aggregator) getOrCreatePseudoSpanLocal(
+	ctx context.Context,
+	object utilobject.Rich,
+	pseudoType zconstants.PseudoTypeValue,
+	eventTime time.Time,
+	parent tracer.SpanContext,
+	followsFrom tracer.SpanContext,
+	extraTags map[string]string,
+	dedupId string,
 ) (_span tracer.SpanContext, _isNew bool, _err error) {
 	lazySpanMetric := &lazySpanMetric{
 		Cluster:    object.Cluster,
@@ -293,7 +639,8 @@ func (agg *aggregator) GetOrCreatePseudoSpan(
 	}
 	defer agg.LazySpanMetric.DeferCount(agg.Clock.Now(), lazySpanMetric)
 
-	cacheKey := agg.expiringSpanCacheKey(object.Key, eventTime, dedupId)
+	window, previousWindow := agg.resolveWindow(object.Key, eventTime)
+	cacheKey := agg.expiringSpanCacheKey(object.Key, window, dedupId)
 
 	logger := agg.Logger.
 		WithField("step", "GetOrCreatePseudoSpan").
@@ -331,7 +678,30 @@ func (agg *aggregator) GetOrCreatePseudoSpan(
 	// we have a new reservation, need to initialize it now
 	startTime := agg.Clock.Now()
 
-	span, err := agg.CreatePseudoSpan(ctx, object, pseudoType, eventTime, parent, followsFrom, extraTags)
+	holdMetric := &reservationHoldMetric{
+		Cluster:    object.Cluster,
+		PseudoType: pseudoType,
+		Result:     "error",
+	}
+	defer func() {
+		agg.ReservationHoldMetric.With(holdMetric).Histogram(float64(agg.Clock.Since(creator.reservedAt).Nanoseconds()))
+	}()
+
+	if agg.options.chainWindows && pseudoType == zconstants.PseudoTypeObject && followsFrom == nil {
+		followsFrom = agg.fetchPreviousWindowSpan(ctx, logger, object.Key, previousWindow, dedupId)
+	}
+
+	// The span cannot be retracted once created,
+	// so do not create it if the reservation may expire before it is persisted.
+	if held := agg.Clock.Since(creator.reservedAt); held >= agg.options.reserveTtl-agg.options.reserveMargin {
+		holdMetric.Result = "expired"
+		return nil, false, metrics.LabelError(
+			fmt.Errorf("reservation of %q has been held for %s, too close to expiry", cacheKey, held),
+			"ReservationExpired",
+		)
+	}
+
+	span, err := agg.CreatePseudoSpan(ctx, object, pseudoType, window, parent, followsFrom, extraTags)
 	if err != nil {
 		return nil, false, metrics.LabelError(fmt.Errorf("cannot create span: %w", err), "CreateSpan")
 	}
@@ -341,12 +711,18 @@ func (agg *aggregator) GetOrCreatePseudoSpan(
 		return nil, false, metrics.LabelError(fmt.Errorf("cannot serialize span context: %w", err), "InjectCarrier")
 	}
 
-	totalTtl := agg.options.spanTtl + agg.options.spanExtraTtl
-	err = agg.SpanCache.SetReserved(ctx, cacheKey, entryValue, creator.reserveUid, totalTtl)
+	err = agg.SpanCache.SetReserved(ctx, cacheKey, entryValue, creator.reserveUid, agg.cacheTtl(window))
 	if err != nil {
+		if errors.Is(err, spancache.ErrUidMismatch) || errors.Is(err, spancache.ErrInvalidKey) {
+			holdMetric.Result = "fenced"
+			logger.WithError(err).WithField("span", span).
+				Warn("reservation was taken over before the span was persisted, another span may have been created for the same object")
+		}
 		return nil, false, metrics.LabelError(fmt.Errorf("cannot persist reserved value: %w", err), "PersistCarrier")
 	}
 
+	holdMetric.Result = "persisted"
+
 	logger.WithField("duration", agg.Clock.Since(startTime)).Debug("Created new span")
 
 	lazySpanMetric.Result = "create"
@@ -354,17 +730,44 @@ func (agg *aggregator) GetOrCreatePseudoSpan(
 	return span, true, nil
 }
 
+// fetchPreviousWindowSpan returns the span of the same object in the previous window, if any,
+// so that consecutive traces of the same object are chained by a follows-from reference.
+func (agg *aggregator) fetchPreviousWindowSpan(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	object utilobject.Key,
+	previousWindow spanWindow,
+	dedupId string,
+) tracer.SpanContext {
+	entry, err := agg.SpanCache.Fetch(ctx, agg.expiringSpanCacheKey(object, previousWindow, dedupId))
+	if err != nil {
+		logger.WithError(err).Warn("cannot fetch span of previous window")
+		return nil
+	}
+
+	if entry == nil || entry.Value == nil {
+		return nil
+	}
+
+	span, err := agg.Tracer.ExtractCarrier(entry.Value)
+	if err != nil {
+		logger.WithError(err).Warn("span of previous window contains invalid data")
+		return nil
+	}
+
+	return span
+}
+
 func (agg *aggregator) CreatePseudoSpan(
 	ctx context.Context,
 	object utilobject.Rich,
 	pseudoType zconstants.PseudoTypeValue,
-	eventTime time.Time,
+	window spanWindow,
 	parent tracer.SpanContext,
 	followsFrom tracer.SpanContext,
 	extraTags map[string]string,
 ) (tracer.SpanContext, error) {
-	remainderSeconds := eventTime.Unix() % int64(agg.options.spanTtl.Seconds())
-	startTime := eventTime.Add(-time.Duration(remainderSeconds) * time.Second)
+	startTime := window.start()
 
 	tags := zconstants.VersionedKeyToSpanTags(object.VersionedKey)
 	tags[zconstants.TraceSource] = zconstants.TraceSourceObject
@@ -373,9 +776,9 @@ func (agg *aggregator) CreatePseudoSpan(
 
 	span := tracer.Span{
 		Type:       string(pseudoType),
-		Name:       fmt.Sprintf("%s/%s", object.Resource, object.Name),
+		Name:       agg.pseudoSpanName(object, pseudoType),
 		StartTime:  startTime,
-		FinishTime: startTime.Add(agg.options.spanTtl),
+		FinishTime: window.finish(),
 		Parent:     parent,
 		Follows:    followsFrom,
 		Tags:       tags,
@@ -391,6 +794,11 @@ func (agg *aggregator) CreatePseudoSpan(
 		for _, decorator := range agg.ObjectSpanDecorators.Impls {
 			decorator.Decorate(ctx, object, span.Type, span.Tags)
 		}
+		agg.tagDegraded(object.Cluster, span.Tags)
+
+		if agg.TraceContext.Enabled() {
+			agg.linkTraceContext(ctx, object, &span)
+		}
 	}
 
 	spanContext, err := agg.Tracer.CreateSpan(span)
@@ -400,21 +808,47 @@ func (agg *aggregator) CreatePseudoSpan(
 
 	agg.Logger.
 		WithFields(object.AsFields("object")).
+		WithField(logfields.TraceId, tracer.TraceIdOf(spanContext)).
 		WithField("parent", parent).
 		Debug("CreateSpan")
 
 	return spanContext, nil
 }
 
+// linkTraceContext links the span to the external span declared in the trace context annotation of the object.
+func (agg *aggregator) linkTraceContext(ctx context.Context, object utilobject.Rich, span *tracer.Span) {
+	link, ok := agg.TraceContext.Lookup(ctx, object)
+	if !ok {
+		return
+	}
+
+	spanContext, err := agg.Tracer.ExtractCarrier(link.Carrier)
+	if err != nil {
+		agg.Logger.WithFields(object.AsFields("object")).WithError(err).Warn("cannot extract trace context from annotation")
+		return
+	}
+
+	span.Links = append(span.Links, spanContext)
+	// the frontend rewrites trace IDs of displayed spans, so the external trace is also identified in tags
+	span.Tags["externalTraceId"] = link.TraceId
+	span.Tags["externalSpanId"] = link.SpanId
+}
+
 func (aggregator *aggregator) expiringSpanCacheKey(
 	object utilobject.Key,
-	timestamp time.Time,
+	window spanWindow,
 	subObject string,
 ) string {
-	expiringWindow := timestamp.Unix() / int64(aggregator.options.spanTtl.Seconds())
-	return aggregator.spanCacheKey(object, fmt.Sprintf("field=%s,window=%d", subObject, expiringWindow))
+	return aggregator.spanCacheKey(object, fmt.Sprintf("field=%s,window=%d", subObject, window.index))
 }
 
 func (aggregator *aggregator) spanCacheKey(object utilobject.Key, window string) string {
 	return fmt.Sprintf("%s/%s", object.String(), window)
 }
+
+// tagDegraded marks spans whose apiserver-dependent decorations were skipped because the cluster is unhealthy.
+func (aggregator *aggregator) tagDegraded(cluster string, tags map[string]string) {
+	if aggregator.ClusterHealth.Degraded(cluster) {
+		tags[clusterhealth.DegradedTag] = "apiserver unhealthy, object-dependent tags skipped"
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Adds span tags evaluated from user-configured CEL expressions over the object, its namespace and the event.
+package celtagger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.Provide("cel-tagger", manager.Ptr(&CelTagger{}))
+}
+
+type options struct {
+	tags []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringArrayVar(
+		&options.tags,
+		"cel-tag",
+		[]string{},
+		"span tag evaluated from a CEL expression in the form 'tagKey=expression', can be specified multiple times. "+
+			"The expression can access 'object' (the object), 'ns' (the namespace object of the object, or an empty map), "+
+			"'key' (cluster, group, resource, namespace and name of the object) "+
+			"and 'event' (traceSource, title and tags of an event span, empty for object spans). "+
+			"The tag is omitted if evaluation fails or returns null or an empty string. "+
+			`e.g. 'team=ns.metadata.labels["team"]'`,
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type CelTagger struct {
+	options     options
+	Clock       clock.Clock
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+
+	EvalMetric *metrics.Metric[*evalMetric]
+
+	rules []Rule
+}
+
+type evalMetric struct {
+	Tag    string
+	Result string
+}
+
+func (*evalMetric) MetricName() string { return "aggregator_cel_tagger" }
+
+var _ manager.Component = &CelTagger{}
+
+func (tagger *CelTagger) Options() manager.Options { return &tagger.options }
+
+func (tagger *CelTagger) Init() error {
+	env, err := NewEnv()
+	if err != nil {
+		return fmt.Errorf("cannot create CEL environment: %w", err)
+	}
+
+	for _, spec := range tagger.options.tags {
+		rule, err := ParseRule(env, spec)
+		if err != nil {
+			return fmt.Errorf("invalid --cel-tag: %w", err)
+		}
+		tagger.rules = append(tagger.rules, rule)
+	}
+
+	return nil
+}
+
+func (tagger *CelTagger) Start(ctx context.Context) error { return nil }
+func (tagger *CelTagger) Close(ctx context.Context) error { return nil }
+
+// Rule is a compiled tag expression.
+type Rule struct {
+	Tag     string
+	program cel.Program
+}
+
+func NewEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("ns", cel.DynType),
+		cel.Variable("key", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("event", cel.DynType),
+	)
+}
+
+// ParseRule parses and compiles a rule in the form `tagKey=expression`.
+func ParseRule(env *cel.Env, spec string) (Rule, error) {
+	tag, expr, ok := strings.Cut(spec, "=")
+	if !ok || tag == "" || expr == "" {
+		return Rule{}, fmt.Errorf("expected 'tagKey=expression', got %q", spec)
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues.Err() != nil {
+		return Rule{}, fmt.Errorf("invalid CEL expression for tag %q: %w", tag, issues.Err())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid CEL expression for tag %q: %w", tag, err)
+	}
+
+	return Rule{Tag: tag, program: program}, nil
+}
+
+// Enabled returns true if any tag expressions are configured.
+func (tagger *CelTagger) Enabled() bool { return len(tagger.rules) > 0 }
+
+// Decorate evaluates all configured expressions and calls setTag with the non-empty results.
+// event is nil for object spans.
+func (tagger *CelTagger) Decorate(ctx context.Context, object utilobject.Rich, event *aggregatorevent.Event, setTag func(key string, value string)) {
+	if len(tagger.rules) == 0 {
+		return
+	}
+
+	logger := tagger.Logger.WithFields(object.AsFields("object"))
+
+	activation, err := interpreter.NewActivation(map[string]any{
+		"object": func() any { return tagger.fetchObject(ctx, logger, object) },
+		"ns":     func() any { return tagger.fetchNamespace(ctx, logger, object.Key) },
+		"key": map[string]string{
+			"cluster":   object.Cluster,
+			"group":     object.Group,
+			"resource":  object.Resource,
+			"namespace": object.Namespace,
+			"name":      object.Name,
+		},
+		"event": eventToMap(event),
+	})
+	if err != nil {
+		logger.WithError(err).Error("cannot create CEL activation")
+		return
+	}
+
+	EvaluateRules(tagger.rules, activation, func(tag string, value string, result string) {
+		tagger.EvalMetric.With(&evalMetric{Tag: tag, Result: result}).Count(1)
+		if value != "" {
+			setTag(tag, value)
+		}
+	})
+}
+
+// EvaluateRules evaluates each rule with the activation and reports the stringified result.
+func EvaluateRules(rules []Rule, activation interpreter.Activation, report func(tag string, value string, result string)) {
+	for _, rule := range rules {
+		output, _, err := rule.program.Eval(activation)
+		if err != nil {
+			// missing fields are expected for objects not carrying the configured metadata
+			report(rule.Tag, "", "Error")
+			continue
+		}
+
+		if output == types.NullValue {
+			report(rule.Tag, "", "Null")
+			continue
+		}
+
+		value := fmt.Sprint(output.Value())
+		if value == "" {
+			report(rule.Tag, "", "Empty")
+			continue
+		}
+
+		report(rule.Tag, value, "Ok")
+	}
+}
+
+func eventToMap(event *aggregatorevent.Event) map[string]any {
+	if event == nil {
+		return map[string]any{}
+	}
+
+	tags := make(map[string]any, len(event.Tags))
+	for tagKey, tagValue := range event.Tags {
+		tags[tagKey] = fmt.Sprint(tagValue)
+	}
+
+	return map[string]any{
+		"traceSource": event.TraceSource,
+		"title":       event.Title,
+		"tags":        tags,
+	}
+}
+
+func (tagger *CelTagger) fetchObject(ctx context.Context, logger logrus.FieldLogger, object utilobject.Rich) map[string]any {
+	if object.Raw != nil {
+		return object.Raw.Object
+	}
+
+	return tagger.fetch(ctx, logger, object.VersionedKey)
+}
+
+func (tagger *CelTagger) fetchNamespace(ctx context.Context, logger logrus.FieldLogger, key utilobject.Key) map[string]any {
+	if key.Namespace == "" {
+		return map[string]any{}
+	}
+
+	return tagger.fetch(ctx, logger, utilobject.VersionedKey{
+		Key: utilobject.Key{
+			Cluster:  key.Cluster,
+			Resource: "namespaces",
+			Name:     key.Namespace,
+		},
+		Version: "v1",
+	})
+}
+
+func (tagger *CelTagger) fetch(ctx context.Context, logger logrus.FieldLogger, key utilobject.VersionedKey) map[string]any {
+	startTime := tagger.Clock.Now()
+	raw, err := tagger.ObjectCache.Get(ctx, key)
+	logger = logger.WithField("fetchKey", key).WithField("duration", tagger.Clock.Since(startTime))
+	if err != nil {
+		logger.WithError(err).Warn("cannot fetch object for CEL tagger")
+		return map[string]any{}
+	}
+
+	if raw == nil {
+		logger.Debug("object for CEL tagger no longer exists")
+		return map[string]any{}
+	}
+
+	return raw.Object
+}
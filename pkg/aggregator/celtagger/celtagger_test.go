@@ -0,0 +1,98 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package celtagger_test
+
+import (
+	"testing"
+
+	"github.com/google/cel-go/interpreter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/celtagger"
+)
+
+func TestParseRule(t *testing.T) {
+	env, err := celtagger.NewEnv()
+	assert.NoError(t, err)
+
+	for _, spec := range []string{"", "team", "=object", "team=", "team=object.("} {
+		_, err := celtagger.ParseRule(env, spec)
+		assert.Error(t, err, spec)
+	}
+
+	rule, err := celtagger.ParseRule(env, `team=ns.metadata.labels["team"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, "team", rule.Tag)
+}
+
+func TestEvaluateRules(t *testing.T) {
+	env, err := celtagger.NewEnv()
+	assert.NoError(t, err)
+
+	var rules []celtagger.Rule
+	for _, spec := range []string{
+		`team=ns.metadata.labels["team"]`,
+		`costCenter=object.metadata.annotations["example.com/cost-center"]`,
+		`replicas=object.spec.replicas`,
+		`missing=object.metadata.labels["missing"]`,
+		`empty=""`,
+		`null=null`,
+		`cluster=key.cluster + "/" + key.resource`,
+	} {
+		rule, err := celtagger.ParseRule(env, spec)
+		assert.NoError(t, err)
+		rules = append(rules, rule)
+	}
+
+	objectFetches := 0
+	activation, err := interpreter.NewActivation(map[string]any{
+		"object": func() any {
+			objectFetches++
+			return map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]any{"example.com/cost-center": "cc-1"},
+					"labels":      map[string]any{},
+				},
+				"spec": map[string]any{"replicas": int64(3)},
+			}
+		},
+		"ns": map[string]any{
+			"metadata": map[string]any{"labels": map[string]any{"team": "infra"}},
+		},
+		"key":   map[string]string{"cluster": "c1", "resource": "deployments"},
+		"event": map[string]any{},
+	})
+	assert.NoError(t, err)
+
+	values := map[string]string{}
+	results := map[string]string{}
+	celtagger.EvaluateRules(rules, activation, func(tag string, value string, result string) {
+		if value != "" {
+			values[tag] = value
+		}
+		results[tag] = result
+	})
+
+	assert.Equal(t, map[string]string{
+		"team":       "infra",
+		"costCenter": "cc-1",
+		"replicas":   "3",
+		"cluster":    "c1/deployments",
+	}, values)
+	assert.Equal(t, "Error", results["missing"])
+	assert.Equal(t, "Empty", results["empty"])
+	assert.Equal(t, "Null", results["null"])
+	assert.Equal(t, 1, objectFetches)
+}
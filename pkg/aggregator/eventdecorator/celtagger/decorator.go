@@ -0,0 +1,65 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventceltagger
+
+import (
+	"context"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/celtagger"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("cel-event-tag", manager.Ptr(&eventTagDecorator{}), &manager.List[eventdecorator.Decorator]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "cel-event-tag-enable", false, "add event span tags from --cel-tag expressions")
+}
+
+func (options *options) EnableFlag() *bool {
+	return &options.enable
+}
+
+type eventTagDecorator struct {
+	CelTagger *celtagger.CelTagger
+	options   options
+}
+
+var _ manager.Component = &eventTagDecorator{}
+
+func (d *eventTagDecorator) Options() manager.Options        { return &d.options }
+func (d *eventTagDecorator) Init() error                     { return nil }
+func (d *eventTagDecorator) Start(ctx context.Context) error { return nil }
+func (d *eventTagDecorator) Close(ctx context.Context) error { return nil }
+
+func (d *eventTagDecorator) Decorate(ctx context.Context, object utilobject.Rich, event *aggregatorevent.Event) {
+	if event == nil {
+		return
+	}
+
+	d.CelTagger.Decorate(ctx, object, event, func(key string, value string) {
+		event.Tags[key] = value
+	})
+}
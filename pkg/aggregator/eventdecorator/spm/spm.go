@@ -0,0 +1,163 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Computes RED metrics of event spans in the format of the Jaeger service performance monitoring (SPM),
+// i.e. the metrics generated by the spanmetrics connector of the OpenTelemetry collector,
+// so that the Jaeger Monitor tab and SPM dashboards can query them from Prometheus.
+package spm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("spm", manager.Ptr(&decorator{}), &manager.List[eventdecorator.Decorator]{})
+}
+
+const (
+	// Path is the path of the metrics endpoint on the HTTP server.
+	Path = "/metrics/spm"
+
+	// All event spans are reported as server spans, which the Jaeger Monitor tab displays by default.
+	SpanKind        = "SPAN_KIND_SERVER"
+	StatusCodeError = "STATUS_CODE_ERROR"
+	StatusCodeUnset = "STATUS_CODE_UNSET"
+)
+
+var labelNames = []string{"service_name", "span_name", "span_kind", "status_code", "cluster", "namespace"}
+
+type options struct {
+	enable          bool
+	durationBuckets []float64
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"spm-enable",
+		false,
+		"serve Jaeger SPM metrics (calls_total and duration_milliseconds) of event spans at "+Path+" on the HTTP server",
+	)
+	fs.Float64SliceVar(
+		&options.durationBuckets,
+		"spm-duration-buckets",
+		[]float64{2, 4, 6, 8, 10, 50, 100, 200, 400, 800, 1000, 1400, 2000, 5000, 10_000, 15_000},
+		"histogram buckets of event durations in milliseconds",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options options
+	Server  kelemetryhttp.Server
+
+	registry *prometheus.Registry
+	calls    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var _ manager.Component = &decorator{}
+
+func (d *decorator) Options() manager.Options { return &d.options }
+
+func (d *decorator) Init() error {
+	if len(d.options.durationBuckets) == 0 {
+		return fmt.Errorf("--spm-duration-buckets must not be empty")
+	}
+
+	d.initCollectors()
+	d.Server.Routes().GET(Path, gin.WrapH(promhttp.HandlerFor(d.registry, promhttp.HandlerOpts{Registry: d.registry})))
+
+	return nil
+}
+
+func (d *decorator) initCollectors() {
+	d.registry = prometheus.NewRegistry()
+	d.calls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "calls_total",
+		Help: "Number of event spans.",
+	}, labelNames)
+	d.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "duration_milliseconds",
+		Help:    "Duration of event spans with an end time, such as the latency of audited requests.",
+		Buckets: d.options.durationBuckets,
+	}, labelNames)
+	d.registry.MustRegister(d.calls, d.duration)
+}
+
+func (d *decorator) Start(ctx context.Context) error { return nil }
+func (d *decorator) Close(ctx context.Context) error { return nil }
+
+func (d *decorator) Decorate(ctx context.Context, object utilobject.Rich, event *aggregatorevent.Event) {
+	if event == nil {
+		return
+	}
+
+	labels := prometheus.Labels{
+		"service_name": object.GroupResource().String(),
+		"span_name":    operationOf(event),
+		"span_kind":    SpanKind,
+		"status_code":  StatusCodeUnset,
+		"cluster":      object.Cluster,
+		"namespace":    object.Namespace,
+	}
+	if isError(event) {
+		labels["status_code"] = StatusCodeError
+	}
+
+	d.calls.With(labels).Inc()
+
+	// events without an end time are displayed with a dummy duration, which is not meaningful for latency
+	if event.EndTime != nil {
+		d.duration.With(labels).Observe(float64(event.EndTime.Sub(event.Time).Microseconds()) / 1000)
+	}
+}
+
+// operationOf returns the "tag" of the event, e.g. the verb of audit spans,
+// since the span name contains the object name, which has unbounded cardinality.
+func operationOf(event *aggregatorevent.Event) string {
+	if tag, hasTag := event.Tags["tag"]; hasTag {
+		return fmt.Sprint(tag)
+	}
+	return event.TraceSource
+}
+
+// isError returns whether the event has a true "error" tag or a "responseCode" tag of at least 400.
+func isError(event *aggregatorevent.Event) bool {
+	if isErr, ok := event.Tags["error"].(bool); ok && isErr {
+		return true
+	}
+
+	if code, hasCode := event.Tags["responseCode"]; hasCode {
+		if code, err := strconv.Atoi(fmt.Sprint(code)); err == nil && code >= 400 {
+			return true
+		}
+	}
+
+	return false
+}
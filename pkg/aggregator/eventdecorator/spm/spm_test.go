@@ -0,0 +1,62 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func TestDecorate(t *testing.T) {
+	assert := assert.New(t)
+
+	d := &decorator{options: options{durationBuckets: []float64{10, 100}}}
+	d.initCollectors()
+
+	object := utilobject.Rich{VersionedKey: utilobject.VersionedKey{
+		Key:     utilobject.Key{Cluster: "test", Group: "apps", Resource: "deployments", Namespace: "default", Name: "foo"},
+		Version: "v1",
+	}}
+	base := time.Unix(1000, 0)
+
+	d.Decorate(context.Background(), object, aggregatorevent.NewEvent("alice update", base, zconstants.TraceSourceAudit).
+		SetDuration(time.Millisecond*5).
+		SetTag("tag", "update").
+		SetTag("responseCode", int32(200)))
+	d.Decorate(context.Background(), object, aggregatorevent.NewEvent("alice update (Conflict)", base, zconstants.TraceSourceAudit).
+		SetDuration(time.Millisecond*50).
+		SetTag("tag", "update").
+		SetTag("responseCode", int32(409)))
+	d.Decorate(context.Background(), object, aggregatorevent.NewEvent("BackOff", base, zconstants.TraceSourceEvent).
+		SetTag("error", true))
+
+	ok := d.calls.WithLabelValues("deployments.apps", "update", SpanKind, StatusCodeUnset, "test", "default")
+	assert.Equal(1.0, testutil.ToFloat64(ok))
+	conflict := d.calls.WithLabelValues("deployments.apps", "update", SpanKind, StatusCodeError, "test", "default")
+	assert.Equal(1.0, testutil.ToFloat64(conflict))
+	event := d.calls.WithLabelValues("deployments.apps", zconstants.TraceSourceEvent, SpanKind, StatusCodeError, "test", "default")
+	assert.Equal(1.0, testutil.ToFloat64(event))
+
+	// the event without an end time is not observed in the duration histogram
+	assert.Equal(2, testutil.CollectAndCount(d.duration))
+}
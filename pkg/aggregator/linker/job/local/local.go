@@ -39,7 +39,11 @@ type queue struct {
 	subscribers   map[*subscriberKey]*channel.UnboundedQueue[*linkjob.LinkJob]
 }
 
-type subscriberKey struct{}
+type subscriberKey struct {
+	name string
+}
+
+var _ manager.StatusReporter = &queue{}
 
 func (queue *queue) Options() manager.Options { return &manager.NoOptions{} }
 func (queue *queue) Init() error {
@@ -49,6 +53,18 @@ func (queue *queue) Init() error {
 func (queue *queue) Start(ctx context.Context) error { return nil }
 func (queue *queue) Close(ctx context.Context) error { return nil }
 
+func (queue *queue) Status() map[string]any {
+	queue.subscribersMu.RLock()
+	defer queue.subscribersMu.RUnlock()
+
+	depths := map[string]int{}
+	for key, sub := range queue.subscribers {
+		depths[key.name] += sub.Length()
+	}
+
+	return map[string]any{"queueDepths": depths}
+}
+
 type publisher struct {
 	Queue *queue
 	manager.MuxImplBase
@@ -92,7 +108,7 @@ func (subscriber *subscriber) Subscribe(ctx context.Context, name string) <-chan
 	subscriber.Queue.subscribersMu.Lock()
 	defer subscriber.Queue.subscribersMu.Unlock()
 
-	key := &subscriberKey{}
+	key := &subscriberKey{name: name}
 	subscriber.Queue.subscribers[key] = queue
 
 	go func() {
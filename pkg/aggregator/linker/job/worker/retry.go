@@ -0,0 +1,109 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkjobworker
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	linkjob "github.com/kubewharf/kelemetry/pkg/aggregator/linker/job"
+)
+
+// retryItem is a linker execution parked until its parent becomes resolvable.
+type retryItem struct {
+	job       *linkjob.LinkJob
+	linker    linker.Linker
+	attempt   int
+	deadline  time.Time
+	nextRetry time.Time
+}
+
+// retryHeap is a min-heap of retry items ordered by the next retry time.
+type retryHeap []*retryItem
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].nextRetry.Before(h[j].nextRetry) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x any)        { *h = append(*h, x.(*retryItem)) }
+func (h *retryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
+
+// park schedules a retry of the item after exponential backoff.
+// Returns false if the retry window since the event has expired or the queue is full.
+func (worker *worker) park(item *retryItem) (_ok bool, _reason string) {
+	now := worker.Clock.Now()
+
+	backoff := worker.options.RetryBackoff << item.attempt
+	item.attempt++
+	item.nextRetry = now.Add(backoff)
+
+	if item.nextRetry.After(item.deadline) {
+		return false, "Expired"
+	}
+
+	worker.retryMu.Lock()
+	defer worker.retryMu.Unlock()
+
+	if worker.retryQueue.Len() >= worker.options.RetryQueueSize {
+		return false, "QueueFull"
+	}
+
+	heap.Push(&worker.retryQueue, item)
+	worker.RetryQueueMetric.With(&retryQueueMetric{}).Gauge(float64(worker.retryQueue.Len()))
+	return true, "Parked"
+}
+
+// popDue removes all items whose next retry time has passed.
+func (worker *worker) popDue(now time.Time) []*retryItem {
+	worker.retryMu.Lock()
+	defer worker.retryMu.Unlock()
+
+	var due []*retryItem
+	for worker.retryQueue.Len() > 0 && !worker.retryQueue[0].nextRetry.After(now) {
+		due = append(due, heap.Pop(&worker.retryQueue).(*retryItem))
+	}
+
+	if len(due) > 0 {
+		worker.RetryQueueMetric.With(&retryQueueMetric{}).Gauge(float64(worker.retryQueue.Len()))
+	}
+
+	return due
+}
+
+func (worker *worker) runRetryLoop(ctx context.Context) {
+	ticker := worker.Clock.Tick(worker.options.RetryInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker:
+			for _, item := range worker.popDue(now) {
+				select {
+				case worker.retryCh <- item:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
@@ -16,7 +16,10 @@ package linkjobworker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -26,6 +29,8 @@ import (
 	"github.com/kubewharf/kelemetry/pkg/aggregator"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
 	linkjob "github.com/kubewharf/kelemetry/pkg/aggregator/linker/job"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/shard"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
@@ -37,11 +42,29 @@ func init() {
 }
 
 type workerOptions struct {
-	WorkerCount int
+	WorkerCount    int
+	RetryWindow    time.Duration
+	RetryBackoff   time.Duration
+	RetryInterval  time.Duration
+	RetryQueueSize int
 }
 
 func (options *workerOptions) Setup(fs *pflag.FlagSet) {
 	fs.IntVar(&options.WorkerCount, "linker-worker-count", 0, "Number of workers to execute link jobs")
+	fs.DurationVar(
+		&options.RetryWindow,
+		"linker-worker-retry-window",
+		time.Second*30,
+		"duration after the event during which links that are not resolvable yet are retried; 0 to disable retry",
+	)
+	fs.DurationVar(
+		&options.RetryBackoff,
+		"linker-worker-retry-backoff",
+		time.Second,
+		"initial backoff of retrying unresolvable links, doubled after each attempt",
+	)
+	fs.DurationVar(&options.RetryInterval, "linker-worker-retry-interval", time.Millisecond*200, "frequency of polling the retry queue")
+	fs.IntVar(&options.RetryQueueSize, "linker-worker-retry-queue-size", 10000, "maximum number of link jobs parked for retry")
 }
 func (options *workerOptions) EnableFlag() *bool { return ptr.To(options.WorkerCount > 0) }
 
@@ -53,8 +76,16 @@ type worker struct {
 	Subscriber       linkjob.Subscriber
 	Aggregator       aggregator.Aggregator
 	ExecuteJobMetric *metrics.Metric[*executeJobMetric]
+	RetryMetric      *metrics.Metric[*retryMetric]
+	RetryQueueMetric *metrics.Metric[*retryQueueMetric]
+	Dropped          *dropped.Recorder
 
 	ch <-chan *linkjob.LinkJob
+	wg sync.WaitGroup
+
+	retryMu    sync.Mutex
+	retryQueue retryHeap
+	retryCh    chan *retryItem
 }
 
 type executeJobMetric struct {
@@ -64,15 +95,32 @@ type executeJobMetric struct {
 
 func (*executeJobMetric) MetricName() string { return "linker_job_exec" }
 
+type retryMetric struct {
+	Linker string
+	Result string
+}
+
+func (*retryMetric) MetricName() string { return "linker_job_retry" }
+
+type retryQueueMetric struct{}
+
+func (*retryQueueMetric) MetricName() string { return "linker_job_retry_queue" }
+
 func (worker *worker) Options() manager.Options { return &worker.options }
 func (worker *worker) Init() error {
 	worker.ch = worker.Subscriber.Subscribe(context.Background(), "worker") // background context, never unsubscribe
+	worker.retryCh = make(chan *retryItem)
 	return nil
 }
 
 func (worker *worker) Start(ctx context.Context) error {
+	// the in-flight job is allowed to complete after shutdown is triggered
+	jobCtx := context.WithoutCancel(ctx)
+
+	worker.wg.Add(worker.options.WorkerCount)
 	for workerId := 0; workerId < worker.options.WorkerCount; workerId++ {
 		go func(workerId int) {
+			defer worker.wg.Done()
 			defer shutdown.RecoverPanic(worker.Logger)
 
 			for {
@@ -80,23 +128,86 @@ func (worker *worker) Start(ctx context.Context) error {
 				case <-ctx.Done():
 					return
 				case job := <-worker.ch:
-					worker.executeJob(ctx, worker.Logger.WithFields(job.Object.AsFields("job")), job)
+					worker.executeJob(jobCtx, worker.Logger.WithFields(job.Object.AsFields("job")), job)
+				case item := <-worker.retryCh:
+					worker.executeLinker(jobCtx, worker.Logger.WithFields(item.job.Object.AsFields("job")), item)
 				}
 			}
 		}(workerId)
 	}
 
+	if worker.options.RetryWindow > 0 {
+		go func() {
+			defer shutdown.RecoverPanic(worker.Logger)
+			worker.runRetryLoop(ctx)
+		}()
+	}
+
 	return nil
 }
-func (worker *worker) Close(ctx context.Context) error { return nil }
+
+func (worker *worker) Close(ctx context.Context) error {
+	doneCh := make(chan struct{})
+	go func() {
+		worker.wg.Wait()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+		worker.retryMu.Lock()
+		defer worker.retryMu.Unlock()
+		if pending := worker.retryQueue.Len(); pending > 0 {
+			err := fmt.Errorf("link jobs pending retry during shutdown")
+			worker.Dropped.DropN(worker.Logger, dropped.StageLinker, "Shutdown", pending, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for in-flight link jobs: %w", ctx.Err())
+	}
+}
 
 func (worker *worker) executeJob(ctx context.Context, logger logrus.FieldLogger, job *linkjob.LinkJob) {
 	for _, linker := range worker.Linkers.Impls {
-		linkerLogger := logger.WithField("linker", linker.LinkerName())
-		if err := worker.execute(ctx, linkerLogger, linker, job); err != nil {
-			linkerLogger.WithError(err).Error("generating links")
+		worker.executeLinker(ctx, logger, &retryItem{
+			job:      job,
+			linker:   linker,
+			deadline: job.EventTime.Add(worker.options.RetryWindow),
+		})
+	}
+}
+
+func (worker *worker) executeLinker(ctx context.Context, logger logrus.FieldLogger, item *retryItem) {
+	linkerLogger := logger.WithField("linker", item.linker.LinkerName())
+
+	err := worker.execute(linker.WithEventTime(ctx, item.job.EventTime), linkerLogger, item.linker, item.job)
+	if err == nil {
+		if item.attempt > 0 {
+			worker.RetryMetric.With(&retryMetric{Linker: item.linker.LinkerName(), Result: "Resolved"}).Count(1)
 		}
+		return
+	}
+
+	retriable := errors.Is(err, linker.ErrNotReady) || errors.Is(err, shard.ErrOwnerUnavailable)
+	if worker.options.RetryWindow > 0 && retriable {
+		ok, reason := worker.park(item)
+		worker.RetryMetric.With(&retryMetric{Linker: item.linker.LinkerName(), Result: reason}).Count(1)
+		if ok {
+			linkerLogger.WithError(err).WithField("attempt", item.attempt).Debug("links not resolvable yet, retrying later")
+			return
+		}
+
+		// the object span remains an orphan root if its parent never becomes resolvable
+		linkerLogger = linkerLogger.WithField("retryResult", reason)
+	}
+
+	reason := "LinkError"
+	if errors.Is(err, linker.ErrNotReady) {
+		reason = "NotReady"
+	} else if errors.Is(err, shard.ErrOwnerUnavailable) {
+		reason = "ShardOwnerUnavailable"
 	}
+	worker.Dropped.Drop(linkerLogger, dropped.StageLinker, reason, err)
 }
 
 func (worker *worker) execute(ctx context.Context, logger logrus.FieldLogger, linker linker.Linker, job *linkjob.LinkJob) error {
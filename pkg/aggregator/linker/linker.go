@@ -16,6 +16,8 @@ package linker
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
 	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
@@ -32,3 +34,21 @@ type LinkerResult struct {
 	Class   string
 	DedupId string
 }
+
+// ErrNotReady indicates that the links of an object cannot be resolved yet,
+// e.g. because the object or its owner has not been observed by the apiserver cache or discovery.
+// Linkers wrap this error to request the lookup to be retried later.
+var ErrNotReady = errors.New("links are not resolvable yet")
+
+type eventTimeKey struct{}
+
+// WithEventTime returns a context for Lookup carrying the time of the event that triggered the lookup.
+func WithEventTime(ctx context.Context, eventTime time.Time) context.Context {
+	return context.WithValue(ctx, eventTimeKey{}, eventTime)
+}
+
+// EventTimeFrom returns the time of the event that triggered the lookup, if known.
+func EventTimeFrom(ctx context.Context) (time.Time, bool) {
+	eventTime, ok := ctx.Value(eventTimeKey{}).(time.Time)
+	return eventTime, ok
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tags object spans with resource usage metrics queried from Prometheus.
+//
+// When an object span is created, the PromQL templates configured for the resource are rendered with the object key
+// and evaluated as instant queries, so that resource pressure can be correlated with control plane activity.
+package objectspanpromtagger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"prometheus-object-tag",
+		manager.Ptr(&Decorator{}),
+		&manager.List[objectspandecorator.Decorator]{},
+	)
+}
+
+var defaultQueries = []string{
+	`pods#cpu=sum(rate(container_cpu_usage_seconds_total{namespace="{{.Namespace}}",pod="{{.Name}}",container!=""}[5m]))`,
+	`pods#memory=sum(container_memory_working_set_bytes{namespace="{{.Namespace}}",pod="{{.Name}}",container!=""})`,
+	`pods#restarts=sum(kube_pod_container_status_restarts_total{namespace="{{.Namespace}}",pod="{{.Name}}"})`,
+}
+
+type options struct {
+	enable  bool
+	address string
+	queries []string
+	timeout time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "prometheus-object-tag-enable", false, "tag object spans with the results of PromQL queries")
+	fs.StringVar(&options.address, "prometheus-object-tag-address", "http://localhost:9090", "base URL of the Prometheus HTTP API")
+	fs.StringArrayVar(
+		&options.queries,
+		"prometheus-object-tag-query",
+		defaultQueries,
+		"PromQL query template in the form 'resource[.group]#tagKey=template', "+
+			"where the template is rendered with the fields Cluster, Group, Resource, Namespace and Name of the object",
+	)
+	fs.DurationVar(&options.timeout, "prometheus-object-tag-timeout", time.Second*2, "timeout for each Prometheus query")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type Decorator struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+
+	QueryMetric *metrics.Metric[*queryMetric]
+
+	queries    map[schema.GroupResource][]Query
+	httpClient http.Client
+}
+
+type queryMetric struct {
+	Resource string
+	Tag      string
+	Error    metrics.LabeledError
+}
+
+func (*queryMetric) MetricName() string { return "aggregator_prometheus_tagger" }
+
+// Query is a PromQL template that produces the value of an object span tag.
+type Query struct {
+	GroupResource schema.GroupResource
+	TagKey        string
+	Template      *template.Template
+}
+
+// ParseQuery parses a query in the form `resource[.group]#tagKey=template`.
+func ParseQuery(spec string) (Query, error) {
+	resource, rest, ok := strings.Cut(spec, "#")
+	if !ok {
+		return Query{}, fmt.Errorf("query %q does not contain a resource", spec)
+	}
+
+	tagKey, expr, ok := strings.Cut(rest, "=")
+	if !ok || tagKey == "" || expr == "" {
+		return Query{}, fmt.Errorf("query %q is not in the form resource#tagKey=template", spec)
+	}
+
+	tmpl, err := template.New(tagKey).Option("missingkey=error").Parse(expr)
+	if err != nil {
+		return Query{}, fmt.Errorf("query template %q is invalid: %w", tagKey, err)
+	}
+
+	return Query{
+		GroupResource: schema.ParseGroupResource(resource),
+		TagKey:        tagKey,
+		Template:      tmpl,
+	}, nil
+}
+
+// Render renders the PromQL expression for an object.
+func (query Query) Render(object utilobject.Key) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := query.Template.Execute(buf, object); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var _ manager.Component = &Decorator{}
+
+func (d *Decorator) Options() manager.Options { return &d.options }
+
+func (d *Decorator) Init() error {
+	d.queries = map[schema.GroupResource][]Query{}
+	for _, spec := range d.options.queries {
+		query, err := ParseQuery(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --prometheus-object-tag-query: %w", err)
+		}
+		d.queries[query.GroupResource] = append(d.queries[query.GroupResource], query)
+	}
+
+	d.httpClient.Timeout = d.options.timeout
+
+	return nil
+}
+
+func (d *Decorator) Start(ctx context.Context) error { return nil }
+func (d *Decorator) Close(ctx context.Context) error { return nil }
+
+func (d *Decorator) Decorate(ctx context.Context, object utilobject.Rich, traceSource string, tags map[string]string) {
+	if tags == nil {
+		return
+	}
+
+	now := d.Clock.Now()
+
+	for _, query := range d.queries[object.GroupResource()] {
+		metric := &queryMetric{Resource: object.Resource, Tag: query.TagKey}
+
+		value, err := d.evaluate(ctx, query, object.Key, now)
+		if err != nil {
+			metric.Error = metrics.LabelError(err, "Query")
+			d.Logger.WithFields(object.AsFields("object")).WithField("tag", query.TagKey).WithError(err).Debug("cannot query Prometheus")
+		} else if value != "" {
+			tags[query.TagKey] = value
+		}
+
+		d.QueryMetric.With(metric).Count(1)
+	}
+}
+
+func (d *Decorator) evaluate(ctx context.Context, query Query, object utilobject.Key, when time.Time) (string, error) {
+	expr, err := query.Render(object)
+	if err != nil {
+		return "", fmt.Errorf("cannot render query: %w", err)
+	}
+
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("time", strconv.FormatFloat(float64(when.UnixMilli())/1000, 'f', 3, 64))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(d.options.address, "/")+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := ParseResponse(body)
+	if err != nil {
+		return "", fmt.Errorf("invalid response with status %d: %w", resp.StatusCode, err)
+	}
+
+	return value, nil
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Value returns the formatted value of a scalar result or the first sample of a vector result.
+// Returns an empty string if the vector is empty.
+func (resp queryResponse) Value() (string, error) {
+	if resp.Status != "success" {
+		return "", fmt.Errorf("query failed: %s", resp.Error)
+	}
+
+	var sample []any
+	switch resp.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(resp.Data.Result, &sample); err != nil {
+			return "", fmt.Errorf("invalid scalar result: %w", err)
+		}
+	case "vector":
+		var vector []struct {
+			Value []any `json:"value"`
+		}
+		if err := json.Unmarshal(resp.Data.Result, &vector); err != nil {
+			return "", fmt.Errorf("invalid vector result: %w", err)
+		}
+		if len(vector) == 0 {
+			return "", nil
+		}
+		sample = vector[0].Value
+	default:
+		return "", fmt.Errorf("unsupported result type %q", resp.Data.ResultType)
+	}
+
+	if len(sample) != 2 {
+		return "", fmt.Errorf("invalid sample")
+	}
+
+	str, ok := sample[1].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid sample value")
+	}
+
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return str, nil
+	}
+
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+
+	return strconv.FormatFloat(value, 'g', 4, 64), nil
+}
+
+// ParseResponse parses the body of a Prometheus instant query response.
+func ParseResponse(body []byte) (string, error) {
+	var resp queryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", err
+	}
+	return resp.Value()
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectspanpromtagger_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	objectspanpromtagger "github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator/promtagger"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func TestParseQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	query, err := objectspanpromtagger.ParseQuery(`deployments.apps#replicas=kube_deployment_status_replicas{namespace="{{.Namespace}}",deployment="{{.Name}}"}`)
+	assert.NoError(err)
+	assert.Equal(schema.GroupResource{Group: "apps", Resource: "deployments"}, query.GroupResource)
+	assert.Equal("replicas", query.TagKey)
+
+	expr, err := query.Render(utilobject.Key{Group: "apps", Resource: "deployments", Namespace: "default", Name: "web"})
+	assert.NoError(err)
+	assert.Equal(`kube_deployment_status_replicas{namespace="default",deployment="web"}`, expr)
+
+	_, err = objectspanpromtagger.ParseQuery("pods=up")
+	assert.Error(err)
+	_, err = objectspanpromtagger.ParseQuery("pods#cpu")
+	assert.Error(err)
+	_, err = objectspanpromtagger.ParseQuery("pods#cpu={{.Name")
+	assert.Error(err)
+}
+
+func TestParseResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	value, err := objectspanpromtagger.ParseResponse([]byte(
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000.1,"0.123456"]}]}}`,
+	))
+	assert.NoError(err)
+	assert.Equal("0.1235", value)
+
+	value, err = objectspanpromtagger.ParseResponse([]byte(
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000.1,"268435456"]}]}}`,
+	))
+	assert.NoError(err)
+	assert.Equal("268435456", value)
+
+	value, err = objectspanpromtagger.ParseResponse([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	assert.NoError(err)
+	assert.Equal("", value)
+
+	value, err = objectspanpromtagger.ParseResponse([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"3"]}}`))
+	assert.NoError(err)
+	assert.Equal("3", value)
+
+	_, err = objectspanpromtagger.ParseResponse([]byte(`{"status":"error","error":"parse error"}`))
+	assert.ErrorContains(err, "parse error")
+
+	_, err = objectspanpromtagger.ParseResponse([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	assert.Error(err)
+}
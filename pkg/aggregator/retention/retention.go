@@ -0,0 +1,214 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Span retention policies by cluster and resource.
+//
+// The policy is enforced by the trace stores owned by Kelemetry (ClickHouse and Badger)
+// by assigning each span a retention when it is written.
+// Stores managed externally (Elasticsearch, Cassandra, etc.) can only enforce retention per index or table,
+// so the policy is only reported as guidance for them.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.Provide("span-retention", manager.Ptr(&Policy{}))
+}
+
+type options struct {
+	clusters  map[string]string
+	resources map[string]string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringToStringVar(
+		&options.clusters,
+		"span-retention-cluster",
+		map[string]string{},
+		"retention of spans from specific clusters in the form 'cluster=duration', e.g. 'staging=24h'; "+
+			"0 retains the spans forever",
+	)
+	fs.StringToStringVar(
+		&options.resources,
+		"span-retention-resource",
+		map[string]string{},
+		"retention of spans of specific resources in the form 'resource.group=duration' or 'cluster/resource.group=duration', "+
+			"e.g. 'events=6h,prod/deployments.apps=720h'; "+
+			"takes precedence over --span-retention-cluster, and rules with a cluster take precedence over those without",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+// Policy resolves the retention of each span from its cluster and resource tags.
+// Spans matching no rules use the default retention of the store.
+type Policy struct {
+	options options
+
+	clusters         map[string]time.Duration
+	resources        map[schema.GroupResource]time.Duration
+	clusterResources map[clusterResource]time.Duration
+}
+
+type clusterResource struct {
+	cluster  string
+	resource schema.GroupResource
+}
+
+var _ manager.Component = &Policy{}
+
+func (policy *Policy) Options() manager.Options { return &policy.options }
+
+func (policy *Policy) Init() error {
+	policy.clusters = make(map[string]time.Duration, len(policy.options.clusters))
+	for cluster, value := range policy.options.clusters {
+		retention, err := parseRetention(value)
+		if err != nil {
+			return fmt.Errorf("invalid --span-retention-cluster for %q: %w", cluster, err)
+		}
+		policy.clusters[cluster] = retention
+	}
+
+	policy.resources = map[schema.GroupResource]time.Duration{}
+	policy.clusterResources = map[clusterResource]time.Duration{}
+	for key, value := range policy.options.resources {
+		retention, err := parseRetention(value)
+		if err != nil {
+			return fmt.Errorf("invalid --span-retention-resource for %q: %w", key, err)
+		}
+
+		if cluster, gr, hasCluster := strings.Cut(key, "/"); hasCluster {
+			policy.clusterResources[clusterResource{cluster: cluster, resource: schema.ParseGroupResource(gr)}] = retention
+		} else {
+			policy.resources[schema.ParseGroupResource(key)] = retention
+		}
+	}
+
+	return nil
+}
+
+func parseRetention(value string) (time.Duration, error) {
+	retention, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if retention != 0 && retention < time.Hour {
+		return 0, fmt.Errorf("retention must be 0 or at least 1h")
+	}
+	return retention, nil
+}
+
+func (policy *Policy) Start(ctx context.Context) error { return nil }
+func (policy *Policy) Close(ctx context.Context) error { return nil }
+
+// IsEmpty returns true if no retention rules are configured.
+func (policy *Policy) IsEmpty() bool {
+	return len(policy.clusters) == 0 && len(policy.resources) == 0 && len(policy.clusterResources) == 0
+}
+
+// Get returns the retention of spans with the given cluster and resource,
+// or defaultRetention if no rules match. Zero means the spans are retained forever.
+func (policy *Policy) Get(cluster string, resource schema.GroupResource, defaultRetention time.Duration) time.Duration {
+	if retention, exists := policy.clusterResources[clusterResource{cluster: cluster, resource: resource}]; exists {
+		return retention
+	}
+	if retention, exists := policy.resources[resource]; exists {
+		return retention
+	}
+	if retention, exists := policy.clusters[cluster]; exists {
+		return retention
+	}
+	return defaultRetention
+}
+
+// ForSpan returns the retention of a span from its object key tags.
+func (policy *Policy) ForSpan(tags map[string]string, defaultRetention time.Duration) time.Duration {
+	return policy.Get(tags["cluster"], schema.GroupResource{Group: tags["group"], Resource: tags["resource"]}, defaultRetention)
+}
+
+func (policy *Policy) rules() []time.Duration {
+	output := make([]time.Duration, 0, len(policy.clusters)+len(policy.resources)+len(policy.clusterResources))
+	for _, retention := range policy.clusters {
+		output = append(output, retention)
+	}
+	for _, retention := range policy.resources {
+		output = append(output, retention)
+	}
+	for _, retention := range policy.clusterResources {
+		output = append(output, retention)
+	}
+	return output
+}
+
+// Distinct returns the sorted distinct retentions that Get may return, including defaultRetention.
+func (policy *Policy) Distinct(defaultRetention time.Duration) []time.Duration {
+	set := map[time.Duration]struct{}{defaultRetention: {}}
+	for _, retention := range policy.rules() {
+		set[retention] = struct{}{}
+	}
+
+	output := make([]time.Duration, 0, len(set))
+	for retention := range set {
+		output = append(output, retention)
+	}
+	sort.Slice(output, func(i, j int) bool { return output[i] < output[j] })
+	return output
+}
+
+// LongestRule returns the longest retention among the configured rules,
+// and whether any rule retains spans forever.
+// Stores that can only expire whole indices or tables should retain them for at least this duration.
+func (policy *Policy) LongestRule() (longest time.Duration, forever bool) {
+	for _, retention := range policy.rules() {
+		if retention == 0 {
+			forever = true
+		} else if retention > longest {
+			longest = retention
+		}
+	}
+	return longest, forever
+}
+
+// Guidance describes how an external store that expires whole units (indices, tables, etc.)
+// should be configured to satisfy the policy, or returns an empty string if no rules are configured.
+func (policy *Policy) Guidance(store string, unit string) string {
+	if policy.IsEmpty() {
+		return ""
+	}
+
+	longest, forever := policy.LongestRule()
+	if forever {
+		return fmt.Sprintf(
+			"span retention rules are not enforced by %s, and some rules retain spans forever, so %s must not be deleted",
+			store, unit,
+		)
+	}
+
+	return fmt.Sprintf(
+		"span retention rules are not enforced by %s; retain %s for at least %s (%d days) "+
+			"so that no spans are deleted before their retention elapses",
+		store, unit, longest, int64((longest+time.Hour*24-1)/(time.Hour*24)),
+	)
+}
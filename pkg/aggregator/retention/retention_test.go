@@ -0,0 +1,81 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retention_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/retention"
+)
+
+func newPolicy(t *testing.T, args ...string) *retention.Policy {
+	t.Helper()
+
+	policy := &retention.Policy{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	policy.Options().Setup(fs)
+	assert.NoError(t, fs.Parse(args))
+	assert.NoError(t, policy.Init())
+	return policy
+}
+
+func TestPrecedence(t *testing.T) {
+	assert := assert.New(t)
+	policy := newPolicy(t,
+		"--span-retention-cluster=staging=24h,archive=0",
+		"--span-retention-resource=events=6h,staging/deployments.apps=168h",
+	)
+
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	events := schema.GroupResource{Resource: "events"}
+	pods := schema.GroupResource{Resource: "pods"}
+
+	assert.Equal(time.Hour*168, policy.Get("staging", deployments, time.Hour*72))
+	assert.Equal(time.Hour*6, policy.Get("staging", events, time.Hour*72))
+	assert.Equal(time.Hour*24, policy.Get("staging", pods, time.Hour*72))
+	assert.Equal(time.Duration(0), policy.Get("archive", pods, time.Hour*72))
+	assert.Equal(time.Hour*72, policy.Get("prod", deployments, time.Hour*72))
+
+	assert.Equal(time.Hour*6, policy.ForSpan(map[string]string{"cluster": "prod", "resource": "events"}, time.Hour*72))
+
+	assert.Equal(
+		[]time.Duration{0, time.Hour * 6, time.Hour * 24, time.Hour * 72, time.Hour * 168},
+		policy.Distinct(time.Hour*72),
+	)
+
+	longest, forever := policy.LongestRule()
+	assert.Equal(time.Hour*168, longest)
+	assert.True(forever)
+}
+
+func TestGuidance(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Empty(newPolicy(t).Guidance("elasticsearch", "indices"))
+	assert.Contains(newPolicy(t, "--span-retention-resource=pods=36h").Guidance("elasticsearch", "indices"), "(2 days)")
+}
+
+func TestInvalidRetention(t *testing.T) {
+	policy := &retention.Policy{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	policy.Options().Setup(fs)
+	assert.NoError(t, fs.Parse([]string{"--span-retention-cluster=staging=10m"}))
+	assert.Error(t, policy.Init())
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Assigns the creation of pseudospans to exactly one replica per object.
+//
+// Objects are hashed into a fixed number of shards, each backed by a Lease.
+// Each replica owns at most ceil(shards / live replicas) shards, so shards are rebalanced when replicas join or leave.
+// Pseudospan creation for objects in shards owned by other replicas is forwarded to the owner over HTTP,
+// so that replicas never race to create conflicting pseudospans for the same object,
+// even if the span cache is not shared or a reservation expires during creation.
+// A pseudospan is only created locally if this replica owns its shard or the shard has no known owner;
+// if the owner may have created the pseudospan (e.g. the request timed out), the caller retries later instead.
+package shard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/leaseshard"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("aggregator-shard", manager.Ptr(&Router{}))
+}
+
+const forwardPath = "/aggregator/shard/pseudospan"
+
+type options struct {
+	enable           bool
+	numShards        int32
+	namespace        string
+	leaseName        string
+	advertiseAddress string
+	leaseDuration    time.Duration
+	retryPeriod      time.Duration
+	forwardTimeout   time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"aggregator-shard-enable",
+		false,
+		"assign pseudospan creation of each object to exactly one replica using Kubernetes leases",
+	)
+	fs.Int32Var(&options.numShards, "aggregator-shard-count", 16, "number of object hash shards")
+	fs.StringVar(&options.namespace, "aggregator-shard-lease-namespace", "default", "namespace of the aggregator shard leases")
+	fs.StringVar(
+		&options.leaseName,
+		"aggregator-shard-lease-name",
+		"kelemetry-aggregator-shard",
+		"lease object name prefix for aggregator shards, to be appended with the shard number",
+	)
+	fs.StringVar(
+		&options.advertiseAddress,
+		"aggregator-shard-advertise-address",
+		"",
+		"host:port at which other replicas can reach the HTTP server of this replica",
+	)
+	fs.DurationVar(
+		&options.leaseDuration,
+		"aggregator-shard-lease-duration",
+		time.Second*15,
+		"duration after which a shard lease that was not renewed can be taken over by another replica",
+	)
+	fs.DurationVar(&options.retryPeriod, "aggregator-shard-lease-retry-period", time.Second*2, "interval between lease renew/acquire attempts")
+	fs.DurationVar(
+		&options.forwardTimeout,
+		"aggregator-shard-forward-timeout",
+		time.Second*10,
+		"timeout for forwarding pseudospan creation to shard owners; "+
+			"requests that time out are not created locally since the owner may have created the pseudospan",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+// ErrOwnerUnavailable indicates that the shard owner did not confirm the creation of a pseudospan,
+// e.g. because the request timed out, the owner failed or the shard is still assigned to an unresponsive replica.
+// The pseudospan must not be created locally since the owner may have created it, so callers should retry later.
+var ErrOwnerUnavailable = errors.New("shard owner is unavailable")
+
+// PseudoSpanRequest is a forwarded pseudospan creation request.
+type PseudoSpanRequest struct {
+	Object      utilobject.Rich            `json:"object"`
+	PseudoType  zconstants.PseudoTypeValue `json:"pseudoType"`
+	EventTime   time.Time                  `json:"eventTime"`
+	Parent      []byte                     `json:"parent,omitempty"`
+	FollowsFrom []byte                     `json:"followsFrom,omitempty"`
+	ExtraTags   map[string]string          `json:"extraTags,omitempty"`
+	DedupId     string                     `json:"dedupId"`
+}
+
+// PseudoSpanResponse contains the carrier of the pseudospan created or fetched by the shard owner.
+type PseudoSpanResponse struct {
+	Span  []byte `json:"span"`
+	IsNew bool   `json:"isNew"`
+}
+
+// Handler creates a pseudospan locally without further routing.
+type Handler func(ctx context.Context, request *PseudoSpanRequest) (*PseudoSpanResponse, error)
+
+type Router struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+	Server  kelemetryhttp.Server
+	Mtls    *mtls.Provider
+	Metrics metrics.Client
+
+	ForwardMetric *metrics.Metric[*forwardMetric]
+
+	shards     *leaseshard.Shards
+	handler    Handler
+	httpClient http.Client
+}
+
+type forwardMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*forwardMetric) MetricName() string { return "aggregator_shard_forward" }
+
+type ownedShardsMetric struct{}
+
+func (*ownedShardsMetric) MetricName() string { return "aggregator_shard_owned" }
+
+var _ manager.Component = &Router{}
+
+func (router *Router) Options() manager.Options { return &router.options }
+
+func (router *Router) Init() error {
+	if !router.options.enable {
+		return nil
+	}
+
+	if router.options.advertiseAddress == "" {
+		return fmt.Errorf("--aggregator-shard-advertise-address is required when --aggregator-shard-enable is set")
+	}
+
+	if router.options.numShards <= 0 {
+		return fmt.Errorf("--aggregator-shard-count must be positive")
+	}
+
+	router.httpClient.Timeout = router.options.forwardTimeout
+	router.Mtls.ConfigureHttpClient(&router.httpClient)
+	router.shards = leaseshard.New(
+		leaseshard.Config{
+			Namespace:        router.options.namespace,
+			Name:             router.options.leaseName,
+			AdvertiseAddress: router.options.advertiseAddress,
+			LeaseDuration:    router.options.leaseDuration,
+			RetryPeriod:      router.options.retryPeriod,
+		},
+		router.Logger,
+		router.Clock,
+		router.Clients.TargetCluster().KubernetesClient().CoordinationV1().Leases(router.options.namespace),
+	)
+
+	router.Server.Routes().POST(forwardPath, router.handleForward)
+
+	metrics.NewMonitor(router.Metrics, &ownedShardsMetric{}, func() float64 {
+		return float64(router.shards.NumOwned())
+	})
+
+	return nil
+}
+
+func (router *Router) Start(ctx context.Context) error {
+	if !router.options.enable {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(router.Logger)
+		router.shards.Run(ctx, router.options.numShards)
+	}()
+
+	return nil
+}
+
+func (router *Router) Close(ctx context.Context) error { return nil }
+
+// SetHandler sets the function that serves pseudospan creation requests forwarded from other replicas.
+// Must be called during the Init stage.
+func (router *Router) SetHandler(handler Handler) { router.handler = handler }
+
+// Route returns the address of the replica responsible for creating pseudospans of the object.
+// Returns an empty string if this replica is responsible, sharding is disabled or the shard has no known owner.
+func (router *Router) Route(object utilobject.Key) string {
+	if !router.options.enable {
+		return ""
+	}
+
+	return router.shards.Route(shardOf(object, router.options.numShards))
+}
+
+func shardOf(object utilobject.Key, numShards int32) leaseshard.ShardId {
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(object.String()))
+	return leaseshard.ShardId(hasher.Sum32() % uint32(numShards))
+}
+
+// Forward sends a pseudospan creation request to the replica at address.
+// rejected is true if the replica has certainly not handled the request,
+// in which case the caller may resolve the owner again and retry.
+// Errors where the replica may have created the pseudospan wrap ErrOwnerUnavailable.
+func (router *Router) Forward(
+	ctx context.Context,
+	address string,
+	request *PseudoSpanRequest,
+) (_ *PseudoSpanResponse, rejected bool, err error) {
+	metric := &forwardMetric{}
+	defer router.ForwardMetric.DeferCount(router.Clock.Now(), metric)
+	defer func() { metric.Error = err }()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, false, metrics.LabelError(fmt.Errorf("cannot encode request: %w", err), "Marshal")
+	}
+
+	url := fmt.Sprintf("%s://%s%s", router.Mtls.Scheme(), address, forwardPath)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, metrics.LabelError(fmt.Errorf("cannot create request: %w", err), "NewRequest")
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := router.httpClient.Do(httpReq)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// the owner may have created the pseudospan before the timeout
+			return nil, false, metrics.LabelError(fmt.Errorf("%w: request timed out: %w", ErrOwnerUnavailable, err), "Timeout")
+		}
+
+		return nil, true, metrics.LabelError(fmt.Errorf("cannot send request: %w", err), "Post")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, metrics.LabelError(fmt.Errorf("%w: cannot read response: %w", ErrOwnerUnavailable, err), "ReadResponse")
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusServiceUnavailable:
+		// the replica does not own the shard (anymore) or has not started, so it has not created the pseudospan
+		return nil, true, metrics.LabelError(
+			fmt.Errorf("shard owner rejected the request with status %d: %s", resp.StatusCode, string(respBody)),
+			fmt.Sprintf("Status%d", resp.StatusCode),
+		)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, false, metrics.LabelError(
+			fmt.Errorf("%w: responded with status %d: %s", ErrOwnerUnavailable, resp.StatusCode, string(respBody)),
+			fmt.Sprintf("Status%d", resp.StatusCode),
+		)
+	default:
+		return nil, false, metrics.LabelError(
+			fmt.Errorf("shard owner responded with status %d: %s", resp.StatusCode, string(respBody)),
+			fmt.Sprintf("Status%d", resp.StatusCode),
+		)
+	}
+
+	response := &PseudoSpanResponse{}
+	if err := json.Unmarshal(respBody, response); err != nil {
+		return nil, false, metrics.LabelError(fmt.Errorf("cannot decode response: %w", err), "Unmarshal")
+	}
+
+	return response, false, nil
+}
+
+func (router *Router) handleForward(ctx *gin.Context) {
+	request := &PseudoSpanRequest{}
+	if err := ctx.BindJSON(request); err != nil {
+		return
+	}
+
+	if router.handler == nil {
+		ctx.String(http.StatusServiceUnavailable, "aggregator is not initialized")
+		return
+	}
+
+	if owner := router.Route(request.Object.Key); owner != "" {
+		// the sender retries with the new owner
+		ctx.String(http.StatusConflict, "shard is owned by %s", owner)
+		return
+	}
+
+	response, err := router.handler(ctx.Request.Context(), request)
+	if err != nil {
+		ctx.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
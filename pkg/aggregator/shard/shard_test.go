@@ -0,0 +1,88 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func TestForward(t *testing.T) {
+	assert := assert.New(t)
+
+	statuses := map[string]int{"ok": http.StatusOK, "conflict": http.StatusConflict, "failed": http.StatusInternalServerError}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &PseudoSpanRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if status, exists := statuses[request.Object.Name]; exists {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"isNew": true}`))
+			return
+		}
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+
+	metricsClient, _ := metrics.NewMock(clock.RealClock{})
+	router := &Router{
+		Logger:        logrus.New(),
+		Clock:         clock.RealClock{},
+		Mtls:          &mtls.Provider{},
+		ForwardMetric: metrics.New[*forwardMetric](metricsClient),
+	}
+	router.httpClient.Timeout = time.Millisecond * 100
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	forward := func(name string) (*PseudoSpanResponse, bool, error) {
+		return router.Forward(context.Background(), address, &PseudoSpanRequest{
+			Object: utilobject.Rich{VersionedKey: utilobject.VersionedKey{Key: utilobject.Key{Name: name}}},
+		})
+	}
+
+	response, rejected, err := forward("ok")
+	assert.NoError(err)
+	assert.False(rejected)
+	assert.True(response.IsNew)
+
+	// the replica does not own the shard, so the pseudospan was not created
+	_, rejected, err = forward("conflict")
+	assert.Error(err)
+	assert.NotErrorIs(err, ErrOwnerUnavailable)
+	assert.True(rejected)
+
+	// the owner may have created the pseudospan before failing or timing out
+	for _, name := range []string{"failed", "timeout"} {
+		_, rejected, err = forward(name)
+		assert.ErrorIs(err, ErrOwnerUnavailable, name)
+		assert.False(rejected, name)
+	}
+}
@@ -29,6 +29,7 @@ import (
 
 	"github.com/kubewharf/kelemetry/pkg/aggregator/spancache"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -40,12 +41,21 @@ func init() {
 
 type etcdOptions struct {
 	endpoints   []string
+	username    string
+	password    string
 	prefix      string
 	dialTimeout time.Duration
 }
 
 func (options *etcdOptions) Setup(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&options.endpoints, "span-cache-etcd-endpoints", []string{}, "etcd endpoints")
+	fs.StringVar(&options.username, "span-cache-etcd-username", "", "etcd username; accepts secret references such as 'file:/path'")
+	fs.StringVar(
+		&options.password,
+		"span-cache-etcd-password",
+		"",
+		"etcd password; accepts secret references such as 'file:/path', which are resolved on startup",
+	)
 	fs.StringVar(&options.prefix, "span-cache-etcd-prefix", "/span/", "etcd prefix")
 	fs.DurationVar(&options.dialTimeout, "span-cache-etcd-dial-timeout", time.Second*10, "dial timeout for span cache etcd connection")
 }
@@ -57,6 +67,7 @@ type Etcd struct {
 
 	options   etcdOptions
 	Logger    logrus.FieldLogger
+	Secrets   *secret.Store
 	Clock     clock.Clock
 	client    *etcdv3.Client
 	deferList *shutdown.DeferList
@@ -73,8 +84,20 @@ func (cache *Etcd) Init() error {
 		return fmt.Errorf("No etcd endpoints provided")
 	}
 
+	// the etcd client cannot change credentials without reconnecting
+	username, err := cache.Secrets.Resolve("span-cache-etcd-username", cache.options.username)
+	if err != nil {
+		return err
+	}
+	password, err := cache.Secrets.Resolve("span-cache-etcd-password", cache.options.password)
+	if err != nil {
+		return err
+	}
+
 	client, err := etcdv3.New(etcdv3.Config{
 		Endpoints:   cache.options.endpoints,
+		Username:    username,
+		Password:    password,
 		DialTimeout: cache.options.dialTimeout,
 	})
 	if err != nil {
@@ -142,23 +165,22 @@ func (cache *Etcd) FetchOrReserve(ctx context.Context, key string, ttl time.Dura
 
 			value, _ := io.ReadAll(reader) // ReadAll on bytes.Reader is infallible
 
-			uid := EncodeInt64(resp.CreateRevision)
-
 			return &spancache.Entry{
 				Value:   value,
-				LastUid: uid[:],
+				LastUid: revisionUid(resp.ModRevision),
 			}, nil
 		default:
 			return nil, fmt.Errorf("etcd returned value with invalid header")
 		}
 	}
 
+	// the revision of the reservation is the fencing token,
+	// which is greater than the revisions of all previous reservations of the key since etcd revisions are global.
 	resp := txn.Responses[0].GetResponsePut()
-	rev := EncodeInt64(resp.Header.Revision)
 
 	return &spancache.Entry{
 		Value:   nil,
-		LastUid: rev[:],
+		LastUid: revisionUid(resp.Header.Revision),
 	}, nil
 }
 
@@ -176,8 +198,6 @@ func (cache *Etcd) Fetch(ctx context.Context, key string) (*spancache.Entry, err
 
 	kv := resp.Kvs[0]
 
-	uid := EncodeInt64(kv.ModRevision)
-
 	reader := bytes.NewReader(kv.Value)
 	isInit, err := reader.ReadByte()
 	if err != nil {
@@ -197,16 +217,18 @@ func (cache *Etcd) Fetch(ctx context.Context, key string) (*spancache.Entry, err
 
 	return &spancache.Entry{
 		Value:   value,
-		LastUid: uid[:],
+		LastUid: revisionUid(kv.ModRevision),
 	}, nil
 }
 
 func (cache *Etcd) SetReserved(ctx context.Context, key string, value []byte, lastUid spancache.Uid, ttl time.Duration) error {
 	key = cache.options.prefix + key
 
-	var uid [8]byte
-	copy(uid[:], lastUid)
-	revision := DecodeInt64(uid)
+	token, ok := lastUid.Token()
+	if !ok {
+		return fmt.Errorf("%w (malformed UID %s)", spancache.ErrUidMismatch, lastUid)
+	}
+	revision := int64(token)
 
 	buf := append([]byte{1}, value...)
 
@@ -255,7 +277,10 @@ func DecodeInt64(b [8]byte) int64 {
 	return int64(binary.LittleEndian.Uint64(b[:]))
 }
 
+func revisionUid(revision int64) spancache.Uid {
+	return spancache.TokenUid(uint64(revision))
+}
+
 func (cache *Etcd) ReservedVarintTime() []byte {
-	now := EncodeInt64(cache.Clock.Now().UnixMilli())
-	return append([]byte{0}, now[:]...)
+	return binary.AppendVarint([]byte{0}, cache.Clock.Now().UnixMilli())
 }
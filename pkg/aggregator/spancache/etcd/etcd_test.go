@@ -58,13 +58,13 @@ func TestFetchOrReserveFetched(t *testing.T) {
 
 	putResp, err := client.Client().Put(ctx, key, string([]byte{1, 'o', 'k'}))
 	assert.Nil(err)
-	putRev := etcd.EncodeInt64(putResp.Header.Revision)
+	putRev := spancache.TokenUid(uint64(putResp.Header.Revision))
 
 	entry, err := client.FetchOrReserve(ctx, key, time.Second*10)
 	assert.Nil(err)
 	assert.NotNil(entry)
 	assert.Equal("ok", string(entry.Value))
-	assert.Equal(spancache.Uid(putRev[:]), entry.LastUid[:])
+	assert.Equal(putRev, entry.LastUid)
 }
 
 func TestFetchSucceed(t *testing.T) {
@@ -74,13 +74,13 @@ func TestFetchSucceed(t *testing.T) {
 
 	putResp, err := client.Client().Put(ctx, key, string([]byte{1, 'o', 'k'}))
 	assert.Nil(err)
-	putRev := etcd.EncodeInt64(putResp.Header.Revision)
+	putRev := spancache.TokenUid(uint64(putResp.Header.Revision))
 
 	entry, err := client.Fetch(ctx, key)
 	assert.Nil(err)
 	assert.NotNil(entry)
 	assert.Equal("ok", string(entry.Value))
-	assert.Equal(spancache.Uid(putRev[:]), entry.LastUid)
+	assert.Equal(putRev, entry.LastUid)
 }
 
 func TestFetchNotFound(t *testing.T) {
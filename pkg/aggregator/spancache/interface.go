@@ -16,6 +16,7 @@ package spancache
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"time"
 
@@ -33,12 +34,32 @@ func init() {
 }
 
 // Uid identifies an entry reservation.
+//
+// Uids are fencing tokens: each reservation of a key receives a token greater than all previous reservations,
+// and SetReserved only accepts the token of the current reservation,
+// so that a writer whose reservation has expired cannot overwrite the entry of a newer reservation.
 type Uid []byte
 
 func (uid Uid) String() string {
 	return hex.EncodeToString(uid)
 }
 
+// TokenUid encodes a fencing token as a Uid.
+func TokenUid(token uint64) Uid {
+	uid := make(Uid, 8)
+	binary.BigEndian.PutUint64(uid, token)
+	return uid
+}
+
+// Token decodes the fencing token of a Uid created by TokenUid.
+func (uid Uid) Token() (token uint64, ok bool) {
+	if len(uid) != 8 {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint64(uid), true
+}
+
 type Entry struct {
 	// The value of the entry, if it has been initialized.
 	// This slice is immutable.
@@ -87,6 +108,7 @@ type mux struct {
 	FetchMetric           *metrics.Metric[*fetchMetric]
 	UnsetAndReserveMetric *metrics.Metric[*unsetAndReserveMetric]
 	SetReservedMetric     *metrics.Metric[*setReservedMetric]
+	ContentionMetric      *metrics.Metric[*contentionMetric]
 }
 
 type fetchOrReserveMetric struct{}
@@ -105,9 +127,39 @@ type setReservedMetric struct{}
 
 func (*setReservedMetric) MetricName() string { return "spancache_set_reserved" }
 
+// contentionMetric counts requests rejected due to concurrent reservations of the same key.
+// A nonzero rate of UidMismatch or InvalidKey from SetReserved indicates that
+// a reservation expired before its holder persisted the entry, i.e. the span may have been created twice.
+type contentionMetric struct {
+	Operation string
+	Reason    string
+}
+
+func (*contentionMetric) MetricName() string { return "spancache_contention" }
+
+func (mux *mux) observeContention(operation string, err error) {
+	var reason string
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, ErrAlreadyReserved):
+		reason = "AlreadyReserved"
+	case errors.Is(err, ErrUidMismatch):
+		reason = "UidMismatch"
+	case errors.Is(err, ErrInvalidKey):
+		reason = "InvalidKey"
+	default:
+		return
+	}
+
+	mux.ContentionMetric.With(&contentionMetric{Operation: operation, Reason: reason}).Count(1)
+}
+
 func (mux *mux) FetchOrReserve(ctx context.Context, key string, ttl time.Duration) (*Entry, error) {
 	defer mux.FetchOrReserveMetric.DeferCount(mux.Clock.Now(), &fetchOrReserveMetric{})
-	return mux.Impl().(Cache).FetchOrReserve(ctx, key, ttl)
+	entry, err := mux.Impl().(Cache).FetchOrReserve(ctx, key, ttl)
+	mux.observeContention("FetchOrReserve", err)
+	return entry, err
 }
 
 func (mux *mux) Fetch(ctx context.Context, key string) (*Entry, error) {
@@ -117,5 +169,7 @@ func (mux *mux) Fetch(ctx context.Context, key string) (*Entry, error) {
 
 func (mux *mux) SetReserved(ctx context.Context, key string, value []byte, lastUid Uid, ttl time.Duration) error {
 	defer mux.SetReservedMetric.DeferCount(mux.Clock.Now(), &setReservedMetric{})
-	return mux.Impl().(Cache).SetReserved(ctx, key, value, lastUid, ttl)
+	err := mux.Impl().(Cache).SetReserved(ctx, key, value, lastUid, ttl)
+	mux.observeContention("SetReserved", err)
+	return err
 }
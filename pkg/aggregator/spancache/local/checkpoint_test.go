@@ -0,0 +1,70 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	path := filepath.Join(t.TempDir(), "spancache.json")
+
+	cache := NewMockLocal(clock).(*Local)
+	cache.options.checkpointPath = path
+
+	entry, err := cache.FetchOrReserve(ctx, "initialized", time.Second)
+	assert.NoError(err)
+	assert.NoError(cache.SetReserved(ctx, "initialized", []byte("span"), entry.LastUid, time.Minute))
+	_, err = cache.FetchOrReserve(ctx, "reserved", time.Minute)
+	assert.NoError(err)
+	entry, err = cache.FetchOrReserve(ctx, "expired", time.Second)
+	assert.NoError(err)
+	assert.NoError(cache.SetReserved(ctx, "expired", []byte("span"), entry.LastUid, time.Second*10))
+
+	assert.NoError(cache.Close(ctx))
+
+	clock.Step(time.Second * 30)
+
+	restored := NewMockLocal(clock).(*Local)
+	restored.options.checkpointPath = path
+	restored.options.checkpointInterval = time.Second
+	assert.NoError(restored.Init())
+
+	fetched, err := restored.Fetch(ctx, "initialized")
+	assert.NoError(err)
+	assert.Equal([]byte("span"), fetched.Value)
+
+	for _, key := range []string{"reserved", "expired"} {
+		fetched, err = restored.Fetch(ctx, key)
+		assert.NoError(err)
+		assert.Nil(fetched, key)
+	}
+
+	// new reservations must not reuse the fencing tokens issued before the restart
+	entry, err = restored.FetchOrReserve(ctx, "new", time.Minute)
+	assert.NoError(err)
+	token, _ := entry.LastUid.Token()
+	assert.Greater(token, cache.lastToken.Load())
+}
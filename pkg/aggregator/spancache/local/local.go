@@ -17,9 +17,9 @@ package local
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +28,7 @@ import (
 
 	"github.com/kubewharf/kelemetry/pkg/aggregator/spancache"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/util/checkpoint"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -38,7 +39,9 @@ func init() {
 }
 
 type options struct {
-	trimFrequency time.Duration
+	trimFrequency      time.Duration
+	checkpointPath     string
+	checkpointInterval time.Duration
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -48,6 +51,20 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		time.Minute*30,
 		"frequency to collect garbage from span cache",
 	)
+	fs.StringVar(
+		&options.checkpointPath,
+		"span-cache-local-checkpoint-path",
+		"",
+		"if nonempty, periodically save the span cache to this file and restore it on startup, "+
+			"so that spans created before a crash are reused after restart; "+
+			"the file should be on a volume that survives container restarts",
+	)
+	fs.DurationVar(
+		&options.checkpointInterval,
+		"span-cache-local-checkpoint-interval",
+		time.Second*30,
+		"frequency to save the span cache to --span-cache-local-checkpoint-path",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -62,6 +79,8 @@ type Local struct {
 	Clock       clock.Clock
 	entriesLock sync.Mutex
 	entries     map[string]*localEntry
+	// lastToken is the fencing token of the latest reservation or write.
+	lastToken atomic.Uint64
 }
 
 func NewMockLocal(clock clock.Clock) spancache.Cache {
@@ -76,7 +95,17 @@ func (_ *Local) MuxImplName() (name string, isDefault bool) { return "local", tr
 
 func (cache *Local) Options() manager.Options { return &cache.options }
 
-func (cache *Local) Init() error { return nil }
+func (cache *Local) Init() error {
+	if cache.options.checkpointPath != "" {
+		if cache.options.checkpointInterval <= 0 {
+			return fmt.Errorf("--span-cache-local-checkpoint-interval must be positive")
+		}
+
+		cache.restore()
+	}
+
+	return nil
+}
 
 func (cache *Local) Start(ctx context.Context) error {
 	go func() {
@@ -90,10 +119,31 @@ func (cache *Local) Start(ctx context.Context) error {
 			}
 		}
 	}()
+
+	if cache.options.checkpointPath != "" {
+		go func() {
+			defer shutdown.RecoverPanic(cache.Logger)
+			for {
+				select {
+				case <-cache.Clock.After(cache.options.checkpointInterval):
+					cache.checkpoint()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
 	return nil
 }
 
-func (cache *Local) Close(ctx context.Context) error { return nil }
+func (cache *Local) Close(ctx context.Context) error {
+	if cache.options.checkpointPath != "" {
+		cache.checkpoint()
+	}
+
+	return nil
+}
 
 func (cache *Local) Trim() {
 	cache.entriesLock.Lock()
@@ -127,30 +177,29 @@ func (cache *Local) getEntry(key string) *localEntry {
 	return cache.entries[key]
 }
 
-func (cache *Local) getOrInsertEntry(key string, expiry time.Time) (*localEntry, bool, error) {
+// getOrInsertEntry returns the entry of the key,
+// or creates a new reservation if the entry does not exist or has expired.
+func (cache *Local) getOrInsertEntry(key string, expiry time.Time) (*localEntry, bool) {
 	cache.entriesLock.Lock()
 	defer cache.entriesLock.Unlock()
 
 	isNew := false
-	if ent := cache.entries[key]; ent == nil {
-		uid, err := randUid()
-		if err != nil {
-			return nil, false, err
-		}
-
-		cache.entries[key] = &localEntry{creation: cache.Clock.Now(), expiry: expiry, uid: uid}
+	if ent := cache.entries[key]; ent == nil || ent.expired(cache.Clock) {
+		cache.entries[key] = &localEntry{creation: cache.Clock.Now(), expiry: expiry, uid: cache.nextUid()}
 		isNew = true
 	}
 
-	return cache.entries[key], isNew, nil
+	return cache.entries[key], isNew
+}
+
+// nextUid generates a new fencing token.
+func (cache *Local) nextUid() spancache.Uid {
+	return spancache.TokenUid(cache.lastToken.Add(1))
 }
 
 func (cache *Local) FetchOrReserve(ctx context.Context, key string, ttl time.Duration) (*spancache.Entry, error) {
 	expiry := cache.Clock.Now().Add(ttl)
-	ent, isInsert, err := cache.getOrInsertEntry(key, expiry)
-	if err != nil {
-		return nil, fmt.Errorf("create cache entry: %w", err)
-	}
+	ent, isInsert := cache.getOrInsertEntry(key, expiry)
 
 	ent.lock.RLock()
 	defer ent.lock.RUnlock()
@@ -176,7 +225,7 @@ func (cache *Local) FetchOrReserve(ctx context.Context, key string, ttl time.Dur
 func (cache *Local) Fetch(ctx context.Context, key string) (*spancache.Entry, error) {
 	ent := cache.getEntry(key)
 
-	if ent == nil {
+	if ent == nil || ent.expired(cache.Clock) {
 		return nil, nil
 	}
 
@@ -204,27 +253,77 @@ func (cache *Local) SetReserved(ctx context.Context, key string, value []byte, l
 	}
 
 	if !bytes.Equal(ent.uid, lastUid) {
-		return spancache.ErrUidMismatch
-	}
-
-	newUid, err := randUid()
-	if err != nil {
-		return err
+		return fmt.Errorf("%w (expect %s, persisted %s)", spancache.ErrUidMismatch, lastUid, ent.uid)
 	}
 
 	ent.expiry = cache.Clock.Now().Add(ttl)
 	ent.value = value
-	ent.uid = newUid // new version
+	ent.uid = cache.nextUid() // new version
 
 	return nil
 }
 
-func randUid() (spancache.Uid, error) {
-	entropy := make([]byte, 16)
-	_, err := rand.Read(entropy)
+// checkpointData is the persisted form of the span cache.
+// Reservations are not persisted because their holders do not survive the process.
+type checkpointData struct {
+	LastToken uint64                     `json:"lastToken"`
+	Entries   map[string]checkpointEntry `json:"entries"`
+}
+
+type checkpointEntry struct {
+	Value  []byte        `json:"value"`
+	Expiry time.Time     `json:"expiry"`
+	Uid    spancache.Uid `json:"uid"`
+}
+
+func (cache *Local) checkpoint() {
+	data := checkpointData{
+		LastToken: cache.lastToken.Load(),
+		Entries:   map[string]checkpointEntry{},
+	}
+
+	cache.entriesLock.Lock()
+	for key, ent := range cache.entries {
+		ent.lock.RLock()
+		if ent.value != nil && !ent.expiry.Before(cache.Clock.Now()) {
+			data.Entries[key] = checkpointEntry{Value: ent.value, Expiry: ent.expiry, Uid: ent.uid}
+		}
+		ent.lock.RUnlock()
+	}
+	cache.entriesLock.Unlock()
+
+	if err := checkpoint.Write(cache.options.checkpointPath, data); err != nil {
+		cache.Logger.WithError(err).Warn("cannot checkpoint span cache")
+	}
+}
+
+func (cache *Local) restore() {
+	var data checkpointData
+	found, err := checkpoint.Read(cache.options.checkpointPath, &data)
 	if err != nil {
-		return nil, fmt.Errorf("error getting random value: %w", err)
+		cache.Logger.WithError(err).Warn("cannot restore span cache from checkpoint")
+		return
+	}
+	if !found {
+		return
+	}
+
+	cache.entriesLock.Lock()
+	defer cache.entriesLock.Unlock()
+
+	now := cache.Clock.Now()
+	for key, ent := range data.Entries {
+		if ent.Expiry.Before(now) || ent.Value == nil {
+			continue
+		}
+
+		cache.entries[key] = &localEntry{value: ent.Value, creation: now, expiry: ent.Expiry, uid: ent.Uid}
+	}
+
+	// tokens must keep increasing across restarts to remain valid fencing tokens
+	if cache.lastToken.Load() < data.LastToken {
+		cache.lastToken.Store(data.LastToken)
 	}
 
-	return spancache.Uid(entropy), nil
+	cache.Logger.WithField("entries", len(cache.entries)).Info("restored span cache from checkpoint")
 }
@@ -72,3 +72,35 @@ func TestLocalReserveExpired(t *testing.T) {
 	assert.NotNil(err)
 	assert.ErrorIs(err, spancache.ErrInvalidKey)
 }
+
+func TestLocalReserveAfterExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	cache := local.NewMockLocal(clock)
+
+	entry1, err := cache.FetchOrReserve(context.Background(), "foo", 10)
+	assert.Nil(err)
+	token1, ok := entry1.LastUid.Token()
+	assert.True(ok)
+
+	clock.Step(15)
+
+	fetched, err := cache.Fetch(context.Background(), "foo")
+	assert.Nil(err)
+	assert.Nil(fetched)
+
+	entry2, err := cache.FetchOrReserve(context.Background(), "foo", 10)
+	assert.Nil(err)
+	assert.Nil(entry2.Value)
+	token2, ok := entry2.LastUid.Token()
+	assert.True(ok)
+	assert.Greater(token2, token1)
+
+	// the holder of the expired reservation is fenced off
+	err = cache.SetReserved(context.Background(), "foo", []byte("stale"), entry1.LastUid, 10)
+	assert.ErrorIs(err, spancache.ErrUidMismatch)
+
+	err = cache.SetReserved(context.Background(), "foo", []byte("bar"), entry2.LastUid, 10)
+	assert.Nil(err)
+}
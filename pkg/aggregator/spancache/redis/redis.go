@@ -0,0 +1,317 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/spancache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("spancache/redis", manager.Ptr(&Redis{
+		deferList: shutdown.NewDeferList(),
+	}), spancache.Cache.Fetch)
+}
+
+type redisOptions struct {
+	addresses   []string
+	masterName  string
+	username    string
+	password    string
+	db          int
+	prefix      string
+	dialTimeout time.Duration
+}
+
+func (options *redisOptions) Setup(fs *pflag.FlagSet) {
+	fs.StringSliceVar(
+		&options.addresses,
+		"span-cache-redis-addresses",
+		[]string{},
+		"redis host:port addresses; multiple addresses connect to a redis cluster unless a sentinel master name is set",
+	)
+	fs.StringVar(&options.masterName, "span-cache-redis-master-name", "", "redis sentinel master name, if the addresses are sentinels")
+	fs.StringVar(&options.username, "span-cache-redis-username", "", "redis ACL username; accepts secret references such as 'file:/path'")
+	fs.StringVar(&options.password, "span-cache-redis-password", "", "redis password; accepts secret references such as 'file:/path'")
+	fs.IntVar(&options.db, "span-cache-redis-db", 0, "redis database number, not supported by redis cluster")
+	fs.StringVar(&options.prefix, "span-cache-redis-prefix", "/span/", "redis key prefix")
+	fs.DurationVar(&options.dialTimeout, "span-cache-redis-dial-timeout", time.Second*10, "dial timeout for span cache redis connection")
+}
+
+func (options *redisOptions) EnableFlag() *bool { return nil }
+
+// Redis stores each entry as a hash with the fields `token`, `reservedAt` and (once initialized) `value`.
+//
+// The token is a fencing token incremented from a counter key when the entry is reserved,
+// which is returned as the entry UID and compared in SetReserved,
+// so that a writer whose reservation has expired cannot overwrite a newer reservation.
+// The counter is incremented in a separate command from the entry scripts,
+// so that each command only touches a single key, which is compatible with redis cluster.
+type Redis struct {
+	manager.MuxImplBase
+
+	options   redisOptions
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Secrets   *secret.Store
+	client    redis.UniversalClient
+	deferList *shutdown.DeferList
+}
+
+var _ spancache.Cache = &Redis{}
+
+func (_ *Redis) MuxImplName() (name string, isDefault bool) { return "redis", false }
+
+func (cache *Redis) Options() manager.Options { return &cache.options }
+
+func (cache *Redis) Init() error {
+	if len(cache.options.addresses) == 0 {
+		return fmt.Errorf("No redis addresses provided")
+	}
+
+	username, err := cache.Secrets.Watch("span-cache-redis-username", cache.options.username)
+	if err != nil {
+		return err
+	}
+	password, err := cache.Secrets.Watch("span-cache-redis-password", cache.options.password)
+	if err != nil {
+		return err
+	}
+
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:       cache.options.addresses,
+		MasterName:  cache.options.masterName,
+		DB:          cache.options.db,
+		DialTimeout: cache.options.dialTimeout,
+		// authenticate each new connection with the current credentials, so that rotated credentials apply without restarts
+		OnConnect: func(ctx context.Context, conn *redis.Conn) error {
+			return authenticateRedis(ctx, conn, username.Get(), password.Get())
+		},
+	})
+
+	cache.deferList.Defer("closing redis client", client.Close)
+	cache.client = client
+
+	return nil
+}
+
+func authenticateRedis(ctx context.Context, conn *redis.Conn, username string, password string) error {
+	if password == "" {
+		return nil
+	}
+
+	if username != "" {
+		return conn.AuthACL(ctx, username, password).Err()
+	}
+	return conn.Auth(ctx, password).Err()
+}
+
+func (cache *Redis) Start(ctx context.Context) error {
+	if err := cache.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("cannot connect to redis: %w", err)
+	}
+
+	return nil
+}
+
+func (cache *Redis) Close(ctx context.Context) error {
+	if name, err := cache.deferList.Run(ctx, cache.Logger); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+// reserveScript reserves the entry with the token ARGV[2] and returns {1, token} if the entry does not exist,
+// or {0, token, value, reservedAt} if the entry already exists, where value is nil if the entry is still reserved.
+var reserveScript = redis.NewScript(`
+local entry = redis.call('HMGET', KEYS[1], 'token', 'value', 'reservedAt')
+if entry[1] then
+	return {0, entry[1], entry[2], entry[3]}
+end
+
+local now = redis.call('TIME')
+local reservedAt = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+redis.call('HSET', KEYS[1], 'token', ARGV[2], 'reservedAt', reservedAt)
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return {1, ARGV[2]}
+`)
+
+// setReservedScript returns {0} on success, {-1} if the entry does not exist,
+// {-2, token} if the token mismatches and {-3} if the entry is already initialized.
+var setReservedScript = redis.NewScript(`
+local entry = redis.call('HMGET', KEYS[1], 'token', 'value')
+if not entry[1] then
+	return {-1}
+end
+if entry[1] ~= ARGV[1] then
+	return {-2, entry[1]}
+end
+if entry[2] then
+	return {-3}
+end
+
+redis.call('HSET', KEYS[1], 'value', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {0}
+`)
+
+func ttlMillis(ttl time.Duration) int64 {
+	if ms := ttl.Milliseconds(); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+func (cache *Redis) tokenKey() string { return cache.options.prefix + "fencing-token" }
+
+func parseToken(token any) (spancache.Uid, error) {
+	tokenString, _ := token.(string)
+	tokenInt, err := strconv.ParseUint(tokenString, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("redis returned value with invalid token %q", tokenString)
+	}
+	return spancache.TokenUid(tokenInt), nil
+}
+
+func (cache *Redis) FetchOrReserve(ctx context.Context, key string, ttl time.Duration) (*spancache.Entry, error) {
+	// The token is allocated before knowing whether the entry exists.
+	// Unused tokens are simply skipped, which does not affect monotonicity.
+	nextToken, err := cache.client.Incr(ctx, cache.tokenKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot allocate fencing token: %w", err)
+	}
+
+	result, err := reserveScript.Run(ctx, cache.client, []string{cache.options.prefix + key}, ttlMillis(ttl), nextToken).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create-or-get key: %w", err)
+	}
+
+	if len(result) < 2 {
+		return nil, fmt.Errorf("redis returned unexpected script result %v", result)
+	}
+
+	uid, err := parseToken(result[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if created, _ := result[0].(int64); created == 1 {
+		return &spancache.Entry{
+			Value:   nil,
+			LastUid: uid,
+		}, nil
+	}
+
+	if len(result) < 4 || result[2] == nil {
+		// reserved by another request
+
+		reservedAt, _ := result[3].(string)
+		var reserveTimeUnix int64
+		if _, err := fmt.Sscan(reservedAt, &reserveTimeUnix); err != nil {
+			return nil, fmt.Errorf("redis returned value with invalid reserve timestamp %q", reservedAt)
+		}
+		reserveTime := time.UnixMilli(reserveTimeUnix)
+
+		return nil, fmt.Errorf("%w for %s", spancache.ErrAlreadyReserved, cache.Clock.Since(reserveTime))
+	}
+
+	// already initialized
+
+	value, _ := result[2].(string)
+
+	return &spancache.Entry{
+		Value:   []byte(value),
+		LastUid: uid,
+	}, nil
+}
+
+func (cache *Redis) Fetch(ctx context.Context, key string) (*spancache.Entry, error) {
+	result, err := cache.client.HMGet(ctx, cache.options.prefix+key, "token", "value").Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis request error: %w", err)
+	}
+
+	if result[0] == nil {
+		return nil, nil
+	}
+
+	uid, err := parseToken(result[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var value []byte
+	if valueString, initialized := result[1].(string); initialized {
+		value = []byte(valueString)
+	}
+
+	return &spancache.Entry{
+		Value:   value,
+		LastUid: uid,
+	}, nil
+}
+
+func (cache *Redis) SetReserved(ctx context.Context, key string, value []byte, lastUid spancache.Uid, ttl time.Duration) error {
+	token, ok := lastUid.Token()
+	if !ok {
+		return fmt.Errorf("%w (malformed UID %s)", spancache.ErrUidMismatch, lastUid)
+	}
+
+	result, err := setReservedScript.Run(
+		ctx, cache.client,
+		[]string{cache.options.prefix + key},
+		strconv.FormatUint(token, 10), value, ttlMillis(ttl),
+	).Slice()
+	if err != nil {
+		return fmt.Errorf("cannot compare-and-swap key: %w", err)
+	}
+
+	if len(result) == 0 {
+		return fmt.Errorf("redis returned unexpected script result %v", result)
+	}
+
+	code, _ := result[0].(int64)
+	switch code {
+	case 0:
+		return nil
+	case -1:
+		return spancache.ErrInvalidKey
+	case -2:
+		var persisted any
+		if len(result) > 1 {
+			persisted = result[1]
+		}
+		return fmt.Errorf("%w (expect %d, persisted %v)", spancache.ErrUidMismatch, token, persisted)
+	case -3:
+		return fmt.Errorf("%w (entry is already initialized)", spancache.ErrUidMismatch)
+	default:
+		return fmt.Errorf("redis returned unexpected script result %v", result)
+	}
+}
+
+func (cache *Redis) Client() redis.UniversalClient { return cache.client }
@@ -0,0 +1,185 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/spancache"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func TestFetchOrReserveReserved(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	entry, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+	assert.Nil(entry.Value)
+	assert.NotEmpty(entry.LastUid)
+}
+
+func TestFetchOrReservePending(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	_, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+
+	_, err = client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.ErrorIs(err, spancache.ErrAlreadyReserved)
+}
+
+func TestFetchOrReserveFetched(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	assert.Nil(client.Client().HSet(ctx, key, "token", "1", "reservedAt", "0", "value", "ok").Err())
+
+	entry, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+	assert.NotNil(entry)
+	assert.Equal("ok", string(entry.Value))
+	assert.Equal(spancache.TokenUid(1), entry.LastUid)
+}
+
+func TestFetchNotFound(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	entry, err := client.Fetch(ctx, key)
+	assert.Nil(err)
+	assert.Nil(entry)
+}
+
+func TestSetReservedSucceed(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	entry, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+	assert.NotNil(entry)
+	assert.Nil(entry.Value)
+
+	value := []byte(randomKey())
+	err = client.SetReserved(ctx, key, value, entry.LastUid, time.Second*10)
+	assert.Nil(err)
+
+	fetched, err := client.Fetch(ctx, key)
+	assert.Nil(err)
+	assert.NotNil(fetched)
+	assert.Equal(value, fetched.Value)
+
+	err = client.SetReserved(ctx, key, value, entry.LastUid, time.Second*10)
+	assert.ErrorIs(err, spancache.ErrUidMismatch)
+}
+
+func TestSetReservedNotFound(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	err := client.SetReserved(ctx, key, []byte(randomKey()), []byte("abcdefgh"), time.Second*10)
+	assert.ErrorIs(err, spancache.ErrInvalidKey)
+}
+
+func TestSetReservedCasFailed(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	entry, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+	assert.Nil(entry.Value)
+
+	err = client.SetReserved(ctx, key, []byte(randomKey()), []byte("abcdefgh"), time.Second*10)
+	assert.ErrorIs(err, spancache.ErrUidMismatch)
+}
+
+func TestReservationExpires(t *testing.T) {
+	assert := assert.New(t)
+	ctx, client := testClient(t)
+	key := randomKey()
+
+	first, err := client.FetchOrReserve(ctx, key, time.Millisecond*100)
+	assert.Nil(err)
+
+	time.Sleep(time.Millisecond * 200)
+
+	second, err := client.FetchOrReserve(ctx, key, time.Second*10)
+	assert.Nil(err)
+	firstToken, _ := first.LastUid.Token()
+	secondToken, _ := second.LastUid.Token()
+	assert.Less(firstToken, secondToken)
+
+	// the expired reservation must not overwrite the new one
+	err = client.SetReserved(ctx, key, []byte(randomKey()), first.LastUid, time.Second*10)
+	assert.ErrorIs(err, spancache.ErrUidMismatch)
+}
+
+func testClient(t *testing.T) (context.Context, *Redis) {
+	comp := &Redis{
+		Logger:    logrus.New(),
+		Clock:     clock.RealClock{},
+		Secrets:   &secret.Store{},
+		deferList: shutdown.NewDeferList(),
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.PanicOnError)
+	comp.Options().Setup(fs)
+	if err := fs.Parse([]string{
+		"--span-cache-redis-addresses=127.0.0.1:6379",
+		"--span-cache-redis-prefix=", // to allow reusing the same key in direct ops
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*10)
+
+	if err := comp.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = comp.Close(context.Background())
+		cancelFunc()
+	})
+
+	if err := comp.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx, comp
+}
+
+func randomKey() string {
+	return rand.String(16)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+const (
+	defaultPseudoSpanNameTemplate = "{{.Resource}}/{{.Name}}"
+	defaultEventSpanNameTemplate  = "{{.Title}}"
+)
+
+// SpanNameData is the data available to span name templates.
+type SpanNameData struct {
+	Cluster   string
+	Group     string
+	Version   string
+	Resource  string
+	Namespace string
+	Name      string
+
+	// The pseudo type of a pseudo span, empty for event spans.
+	PseudoType string
+	// The trace source of an event span, or "object" for pseudo spans.
+	TraceSource string
+	// The built-in title of an event span, empty for pseudo spans.
+	Title string
+	// The request verb of an audit span, empty for other spans.
+	Verb string
+	// Tags of an event span.
+	Tags map[string]string
+}
+
+func newSpanNameData(object utilobject.Rich) SpanNameData {
+	return SpanNameData{
+		Cluster:   object.Cluster,
+		Group:     object.Group,
+		Version:   object.Version,
+		Resource:  object.Resource,
+		Namespace: object.Namespace,
+		Name:      object.Name,
+	}
+}
+
+var spanNameFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
+
+// parseSpanNameTemplate returns nil if the template is the same as the default,
+// in which case the built-in format is used without executing a template.
+func parseSpanNameTemplate(text string, defaultText string) (*template.Template, error) {
+	if text == defaultText {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("").Funcs(spanNameFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate the fields referenced by the template
+	if err := tmpl.Execute(&strings.Builder{}, SpanNameData{Tags: map[string]string{}}); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+func renderSpanName(tmpl *template.Template, data SpanNameData, fallback string) (string, error) {
+	if tmpl == nil {
+		return fallback, nil
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return fallback, err
+	}
+
+	return sb.String(), nil
+}
+
+func (aggregator *aggregator) pseudoSpanName(object utilobject.Rich, pseudoType zconstants.PseudoTypeValue) string {
+	fallback := fmt.Sprintf("%s/%s", object.Resource, object.Name)
+
+	data := newSpanNameData(object)
+	data.PseudoType = string(pseudoType)
+	data.TraceSource = zconstants.TraceSourceObject
+
+	name, err := renderSpanName(aggregator.pseudoSpanNameTemplate, data, fallback)
+	if err != nil {
+		aggregator.Logger.WithError(err).Warn("cannot render pseudo span name")
+	}
+	return name
+}
+
+func (aggregator *aggregator) eventSpanName(object utilobject.Rich, traceSource string, title string, tags map[string]string) string {
+	data := newSpanNameData(object)
+	data.TraceSource = traceSource
+	data.Title = title
+	data.Tags = tags
+	if traceSource == zconstants.TraceSourceAudit {
+		data.Verb = tags["tag"]
+	}
+
+	name, err := renderSpanName(aggregator.eventSpanNameTemplate, data, title)
+	if err != nil {
+		aggregator.Logger.WithError(err).Warn("cannot render event span name")
+	}
+	return name
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanNameTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpl, err := parseSpanNameTemplate(defaultPseudoSpanNameTemplate, defaultPseudoSpanNameTemplate)
+	assert.NoError(err)
+	assert.Nil(tmpl)
+
+	tmpl, err = parseSpanNameTemplate("{{.Cluster}}:{{.Group}}/{{.Resource}} {{.Namespace}}/{{.Name}} {{upper .Verb}}", "")
+	assert.NoError(err)
+
+	name, err := renderSpanName(tmpl, SpanNameData{
+		Cluster:   "tracetest",
+		Group:     "apps",
+		Resource:  "deployments",
+		Namespace: "default",
+		Name:      "web",
+		Verb:      "update",
+	}, "fallback")
+	assert.NoError(err)
+	assert.Equal("tracetest:apps/deployments default/web UPDATE", name)
+
+	tmpl, err = parseSpanNameTemplate(`{{index .Tags "username"}} {{.Title}}`, "")
+	assert.NoError(err)
+	name, err = renderSpanName(tmpl, SpanNameData{Title: "create", Tags: map[string]string{"username": "admin"}}, "fallback")
+	assert.NoError(err)
+	assert.Equal("admin create", name)
+
+	_, err = parseSpanNameTemplate("{{.Unknown}}", "")
+	assert.Error(err)
+
+	_, err = parseSpanNameTemplate("{{.Name", "")
+	assert.Error(err)
+}
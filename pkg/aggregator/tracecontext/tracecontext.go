@@ -0,0 +1,169 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links object traces to external traces declared in W3C trace context annotations.
+//
+// CI/CD and GitOps tools may write the `traceparent` of their deployment pipeline span on the objects they apply.
+// When the object span is created, the annotation is added as a span link
+// so that the pipeline trace and the resulting cluster activity are connected.
+package tracecontext
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.Provide("trace-context-annotation", manager.Ptr(&Extractor{}))
+}
+
+type options struct {
+	enable          bool
+	annotation      string
+	stateAnnotation string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"trace-context-annotation-enable",
+		false,
+		"link object spans to the external traces declared in the trace context annotation of the object",
+	)
+	fs.StringVar(&options.annotation, "trace-context-annotation", "traceparent", "annotation containing the W3C traceparent of the external span")
+	fs.StringVar(&options.stateAnnotation, "trace-context-state-annotation", "tracestate", "annotation containing the W3C tracestate of the external span")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Extractor struct {
+	options     options
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+
+	ExtractMetric *metrics.Metric[*extractMetric]
+}
+
+type extractMetric struct {
+	Cluster string
+	Result  string
+}
+
+func (*extractMetric) MetricName() string { return "aggregator_trace_context_annotation" }
+
+var _ manager.Component = &Extractor{}
+
+func (extractor *Extractor) Options() manager.Options        { return &extractor.options }
+func (extractor *Extractor) Init() error                     { return nil }
+func (extractor *Extractor) Start(ctx context.Context) error { return nil }
+func (extractor *Extractor) Close(ctx context.Context) error { return nil }
+
+// Enabled returns true if trace context annotations are linked.
+func (extractor *Extractor) Enabled() bool { return extractor.options.enable }
+
+// Link is an external span declared by an object.
+type Link struct {
+	TraceId string
+	SpanId  string
+	// Carrier is the JSON-encoded W3C trace context propagation carrier of the span.
+	Carrier []byte
+}
+
+var traceParentRegex = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+const (
+	invalidTraceId = "00000000000000000000000000000000"
+	invalidSpanId  = "0000000000000000"
+)
+
+// ParseTraceParent returns the trace ID and span ID in a W3C traceparent header value.
+func ParseTraceParent(value string) (traceId string, spanId string, ok bool) {
+	matches := traceParentRegex.FindStringSubmatch(value)
+	if matches == nil || matches[1] == "ff" || matches[2] == invalidTraceId || matches[3] == invalidSpanId {
+		return "", "", false
+	}
+
+	return matches[2], matches[3], true
+}
+
+// Lookup returns the external span declared in the annotations of the object, if any.
+func (extractor *Extractor) Lookup(ctx context.Context, object utilobject.Rich) (Link, bool) {
+	result := "NoAnnotation"
+	defer func() {
+		extractor.ExtractMetric.With(&extractMetric{Cluster: object.Cluster, Result: result}).Count(1)
+	}()
+
+	raw := object.Raw
+	if raw == nil {
+		var err error
+		raw, err = extractor.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			result = "FetchError"
+			extractor.Logger.WithFields(object.AsFields("object")).WithError(err).Debug("cannot fetch object for trace context")
+			return Link{}, false
+		}
+		if raw == nil {
+			result = "NotFound"
+			return Link{}, false
+		}
+	}
+
+	link, ok, valid := extractor.fromAnnotations(raw)
+	if !ok {
+		return Link{}, false
+	}
+	if !valid {
+		result = "Invalid"
+		return Link{}, false
+	}
+
+	result = "Linked"
+	return link, true
+}
+
+func (extractor *Extractor) fromAnnotations(raw *unstructured.Unstructured) (_ Link, _ok bool, _valid bool) {
+	annotations := raw.GetAnnotations()
+
+	traceParent, ok := annotations[extractor.options.annotation]
+	if !ok {
+		return Link{}, false, false
+	}
+
+	traceId, spanId, valid := ParseTraceParent(traceParent)
+	if !valid {
+		return Link{}, true, false
+	}
+
+	carrier := map[string]string{"traceparent": traceParent}
+	if traceState, hasState := annotations[extractor.options.stateAnnotation]; hasState {
+		carrier["tracestate"] = traceState
+	}
+
+	carrierJson, err := json.Marshal(carrier)
+	if err != nil {
+		return Link{}, true, false
+	}
+
+	return Link{TraceId: traceId, SpanId: spanId, Carrier: carrierJson}, true, true
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/jaegerspan"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilbadger "github.com/kubewharf/kelemetry/pkg/util/badger"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("tracer/badger", manager.Ptr(&badgerTracer{}), tracer.Tracer.CreateSpan)
+}
+
+// badgerTracer writes spans directly to the embedded badger store.
+type badgerTracer struct {
+	manager.MuxImplBase
+
+	Logger logrus.FieldLogger
+	Clock  clock.Clock
+	Store  utilbadger.Store
+
+	WriteMetric *metrics.Metric[*writeMetric]
+}
+
+type writeMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*writeMetric) MetricName() string { return "tracer_badger_write" }
+
+var _ tracer.Tracer = &badgerTracer{}
+
+func (*badgerTracer) MuxImplName() (name string, isDefault bool) { return "badger", false }
+
+func (*badgerTracer) Options() manager.Options { return &manager.NoOptions{} }
+
+func (*badgerTracer) Init() error                     { return nil }
+func (*badgerTracer) Start(ctx context.Context) error { return nil }
+func (*badgerTracer) Close(ctx context.Context) error { return nil }
+
+func (bt *badgerTracer) CreateSpan(span tracer.Span) (tracer.SpanContext, error) {
+	jaegerSpan, newContext, err := jaegerspan.FromSpan(span, jaegerspan.RandomId)
+	if err != nil {
+		return nil, err
+	}
+
+	metric := &writeMetric{}
+	defer bt.WriteMetric.DeferCount(bt.Clock.Now(), metric)
+
+	if err := bt.Store.SpanWriter(span.Tags).WriteSpan(context.Background(), jaegerSpan); err != nil {
+		metric.Error = metrics.LabelError(err, "WriteSpan")
+		return nil, fmt.Errorf("cannot write span to badger: %w", err)
+	}
+
+	return newContext, nil
+}
+
+func (bt *badgerTracer) InjectCarrier(spanContext tracer.SpanContext) ([]byte, error) {
+	return jaegerspan.InjectCarrier(spanContext)
+}
+
+func (bt *badgerTracer) ExtractCarrier(textMap []byte) (tracer.SpanContext, error) {
+	return jaegerspan.ExtractCarrier(textMap)
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badger_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	jaegerbadger "github.com/jaegertracing/jaeger/plugin/storage/badger"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/jaegerspan"
+	jaegerstorage "github.com/kubewharf/kelemetry/pkg/frontend/backend/jaeger-storage"
+	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	factory, err := jaegerbadger.NewFactoryWithConfig(jaegerbadger.NamespaceConfig{
+		SpanStoreTTL:          time.Hour,
+		Ephemeral:             true,
+		MaintenanceInterval:   time.Minute,
+		MetricsUpdateInterval: time.Minute,
+	}, metrics.NullFactory, zap.NewNop())
+	assert.NoError(err)
+	defer func() { assert.NoError(factory.Close()) }()
+
+	writer, err := factory.CreateSpanWriter()
+	assert.NoError(err)
+	reader, err := factory.CreateSpanReader()
+	assert.NoError(err)
+
+	nextId := uint64(0)
+	newId := func() uint64 {
+		nextId++
+		return nextId
+	}
+
+	start := time.Now().Truncate(time.Second)
+	objectTags := map[string]string{
+		"cluster":   "test",
+		"group":     "apps",
+		"resource":  "deployments",
+		"namespace": "default",
+		"name":      "foo",
+	}
+
+	root, rootContext, err := jaegerspan.FromSpan(tracer.Span{
+		Type:       zconstants.TraceSourceObject,
+		Name:       "deployments/foo",
+		StartTime:  start,
+		FinishTime: start.Add(time.Minute),
+		Tags:       objectTags,
+	}, newId)
+	assert.NoError(err)
+	assert.NoError(writer.WriteSpan(context.Background(), root))
+
+	child, _, err := jaegerspan.FromSpan(tracer.Span{
+		Type:       zconstants.TraceSourceAudit,
+		Name:       "update",
+		StartTime:  start.Add(time.Second),
+		FinishTime: start.Add(time.Second * 2),
+		Parent:     rootContext,
+		Tags:       map[string]string{"cluster": "test", "tag": "update"},
+		Logs:       []tracer.Log{{Type: zconstants.LogTypeRealVerbose, Message: "diff", Attrs: [][2]string{{"field", "spec"}}}},
+	}, newId)
+	assert.NoError(err)
+	assert.NoError(writer.WriteSpan(context.Background(), child))
+
+	assert.Equal(root.TraceID, child.TraceID)
+	assert.Equal(root.SpanID, child.ParentSpanID())
+	assert.Equal("diff", child.Logs[0].Fields[0].VStr)
+
+	ctx := context.WithValue(context.Background(), jaegerreader.WantPseudoSpansOnly{}, struct{}{})
+	thumbnails, err := jaegerstorage.ListFromReader(ctx, reader, &spanstore.TraceQueryParameters{
+		Tags:         map[string]string{"name": "foo"},
+		StartTimeMin: start.Add(-time.Minute),
+		StartTimeMax: start.Add(time.Minute),
+		NumTraces:    10,
+	})
+	assert.NoError(err)
+	assert.Len(thumbnails, 1)
+	if len(thumbnails) == 1 {
+		assert.Equal(root.SpanID, thumbnails[0].Spans.Root.SpanID)
+		assert.Len(thumbnails[0].Spans.GetSpans(), 2)
+	}
+}
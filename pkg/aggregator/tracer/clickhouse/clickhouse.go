@@ -0,0 +1,346 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/retention"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+	utilclickhouse "github.com/kubewharf/kelemetry/pkg/util/clickhouse"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("tracer/clickhouse", manager.Ptr(&clickhouseTracer{}), tracer.Tracer.CreateSpan)
+}
+
+type options struct {
+	config        utilclickhouse.Config
+	createTable   bool
+	ttl           time.Duration
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	options.config.SetupOptions(fs, "tracer-clickhouse", "span export")
+	fs.BoolVar(&options.createTable, "tracer-clickhouse-create-table", true, "create the span table on startup if it does not exist")
+	fs.DurationVar(
+		&options.ttl,
+		"tracer-clickhouse-ttl",
+		time.Hour*24*7,
+		"retention of spans not matching --span-retention-cluster or --span-retention-resource; 0 to retain forever",
+	)
+	fs.IntVar(&options.queueSize, "tracer-clickhouse-queue-size", 100000, "maximum number of spans buffered before new spans are dropped")
+	fs.IntVar(&options.batchSize, "tracer-clickhouse-batch-size", 5000, "maximum number of spans in each insert")
+	fs.DurationVar(&options.flushInterval, "tracer-clickhouse-flush-interval", time.Second*2, "maximum delay before buffered spans are inserted")
+	fs.IntVar(&options.maxRetries, "tracer-clickhouse-max-retries", 3, "number of retries of a failed insert before the batch is dropped")
+	fs.DurationVar(&options.retryBackoff, "tracer-clickhouse-retry-backoff", time.Second, "initial backoff between insert retries, doubled after each retry")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type clickhouseTracer struct {
+	manager.MuxImplBase
+
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Retention *retention.Policy
+	Secrets   *secret.Store
+
+	InsertMetric *metrics.Metric[*insertMetric]
+	DropMetric   *metrics.Metric[*dropMetric]
+	Dropped      *dropped.Recorder
+
+	client *utilclickhouse.Client
+	queue  chan utilclickhouse.SpanRow
+	doneCh chan struct{}
+}
+
+type insertMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*insertMetric) MetricName() string { return "tracer_clickhouse_insert" }
+
+type dropMetric struct {
+	Reason string
+}
+
+func (*dropMetric) MetricName() string { return "tracer_clickhouse_drop" }
+
+type spanContext struct {
+	TraceId string `json:"traceId"`
+	SpanId  string `json:"spanId"`
+}
+
+func (ctx spanContext) GetTraceId() string { return ctx.TraceId }
+
+var _ tracer.Tracer = &clickhouseTracer{}
+
+func (*clickhouseTracer) MuxImplName() (name string, isDefault bool) { return "clickhouse", false }
+
+func (ch *clickhouseTracer) Options() manager.Options { return &ch.options }
+
+func (ch *clickhouseTracer) Init() error {
+	if ch.options.batchSize <= 0 {
+		return fmt.Errorf("--tracer-clickhouse-batch-size must be positive")
+	}
+
+	client, err := utilclickhouse.NewClient(ch.options.config, ch.Secrets)
+	if err != nil {
+		return err
+	}
+	ch.client = client
+	ch.queue = make(chan utilclickhouse.SpanRow, ch.options.queueSize)
+	ch.doneCh = make(chan struct{})
+	return nil
+}
+
+func (ch *clickhouseTracer) Start(ctx context.Context) error {
+	if ch.options.createTable {
+		ddl := utilclickhouse.CreateTable(ch.options.config.QualifiedTable(), ch.options.ttl)
+		if err := ch.client.Exec(ctx, ddl, nil); err != nil {
+			return fmt.Errorf("cannot create clickhouse span table: %w", err)
+		}
+
+		for _, ddl := range utilclickhouse.MigrateRetention(ch.options.config.QualifiedTable(), ch.options.ttl) {
+			if err := ch.client.Exec(ctx, ddl, nil); err != nil {
+				return fmt.Errorf("cannot migrate clickhouse span table retention: %w", err)
+			}
+		}
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(ch.Logger)
+		defer close(ch.doneCh)
+		ch.runFlusher()
+	}()
+
+	return nil
+}
+
+func (ch *clickhouseTracer) Close(ctx context.Context) error {
+	close(ch.queue)
+
+	select {
+	case <-ch.doneCh:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for clickhouse span flush: %w", ctx.Err())
+	}
+}
+
+// runFlusher inserts buffered spans until the queue is closed.
+func (ch *clickhouseTracer) runFlusher() {
+	batch := make([]utilclickhouse.SpanRow, 0, ch.options.batchSize)
+	ticker := ch.Clock.Tick(ch.options.flushInterval)
+
+	for {
+		select {
+		case row, ok := <-ch.queue:
+			if !ok {
+				ch.insert(batch)
+				return
+			}
+
+			batch = append(batch, row)
+			if len(batch) >= ch.options.batchSize {
+				ch.insert(batch)
+				batch = batch[:0]
+			}
+		case <-ticker:
+			if len(batch) > 0 {
+				ch.insert(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (ch *clickhouseTracer) insert(batch []utilclickhouse.SpanRow) {
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := utilclickhouse.EncodeRows(batch)
+	if err != nil {
+		ch.DropMetric.With(&dropMetric{Reason: "Encode"}).Count(float64(len(batch)))
+		ch.Dropped.DropN(ch.Logger, dropped.StageTracer, "Encode", len(batch), err)
+		return
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", ch.options.config.QualifiedTable())
+	backoff := ch.options.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		metric := &insertMetric{}
+		start := ch.Clock.Now()
+
+		err := ch.client.Exec(context.Background(), query, strings.NewReader(body))
+		if err == nil {
+			ch.InsertMetric.With(metric).Histogram(float64(ch.Clock.Since(start).Nanoseconds()))
+			return
+		}
+
+		metric.Error = metrics.LabelError(err, "Insert")
+		ch.InsertMetric.With(metric).Histogram(float64(ch.Clock.Since(start).Nanoseconds()))
+
+		if attempt >= ch.options.maxRetries {
+			ch.DropMetric.With(&dropMetric{Reason: "Insert"}).Count(float64(len(batch)))
+			ch.Dropped.DropN(ch.Logger, dropped.StageTracer, "Insert", len(batch), err)
+			return
+		}
+
+		ch.Logger.WithError(err).WithField("attempt", attempt).Warn("cannot insert spans, retrying")
+		ch.Clock.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (ch *clickhouseTracer) CreateSpan(span tracer.Span) (tracer.SpanContext, error) {
+	row, newContext, err := ToRow(span, randomId)
+	if err != nil {
+		return nil, err
+	}
+	row.RetentionSeconds = uint32(ch.Retention.ForSpan(span.Tags, ch.options.ttl).Seconds())
+
+	select {
+	case ch.queue <- row:
+	default:
+		ch.DropMetric.With(&dropMetric{Reason: "QueueFull"}).Count(1)
+		ch.Dropped.Drop(ch.Logger, dropped.StageTracer, "QueueFull", fmt.Errorf("span queue is full"))
+	}
+
+	return newContext, nil
+}
+
+func randomId(length int) string {
+	buf := make([]byte, length)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("cannot read random bytes: %v", err))
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// ToRow converts a span to a table row.
+// newId generates a hex-encoded random ID of the given number of bytes.
+func ToRow(span tracer.Span, newId func(length int) string) (utilclickhouse.SpanRow, tracer.SpanContext, error) {
+	newContext := spanContext{SpanId: newId(8)}
+
+	parentSpanId := ""
+	if span.Parent != nil {
+		parent, ok := span.Parent.(spanContext)
+		if !ok {
+			return utilclickhouse.SpanRow{}, nil, fmt.Errorf("parent span context is not a clickhouse span context")
+		}
+
+		newContext.TraceId = parent.TraceId
+		parentSpanId = parent.SpanId
+	} else {
+		newContext.TraceId = newId(16)
+	}
+
+	references := []utilclickhouse.Reference{}
+	for _, linked := range append([]tracer.SpanContext{span.Follows}, span.Links...) {
+		if linkedContext, ok := linked.(spanContext); ok {
+			references = append(references, utilclickhouse.Reference(linkedContext))
+		}
+	}
+
+	tags := make(map[string]string, len(span.Tags))
+	for key, value := range span.Tags {
+		if _, isKey := utilclickhouse.KeyTagColumns[key]; !isKey {
+			tags[key] = value
+		}
+	}
+
+	logs := make([]utilclickhouse.Log, 0, len(span.Logs))
+	for _, log := range span.Logs {
+		fields := map[string]string{zconstants.LogTypeAttr: string(log.Type)}
+		for _, attr := range log.Attrs {
+			fields[attr[0]] = attr[1]
+		}
+		logs = append(logs, utilclickhouse.Log{Message: log.Message, Fields: fields})
+	}
+
+	duration := span.FinishTime.Sub(span.StartTime)
+	if duration < 0 {
+		duration = 0
+	}
+
+	row := utilclickhouse.SpanRow{
+		TraceId:      newContext.TraceId,
+		SpanId:       newContext.SpanId,
+		ParentSpanId: parentSpanId,
+		References:   utilclickhouse.EncodeJson(references),
+		Service:      span.Type,
+		Operation:    span.Name,
+		StartTime:    span.StartTime.UTC().Format(utilclickhouse.TimeFormat),
+		DurationUs:   uint64(duration.Microseconds()),
+		Cluster:      span.Tags["cluster"],
+		Group:        span.Tags["group"],
+		Resource:     span.Tags["resource"],
+		Namespace:    span.Tags["namespace"],
+		Name:         span.Tags["name"],
+		Tags:         tags,
+		Logs:         utilclickhouse.EncodeJson(logs),
+	}
+
+	return row, newContext, nil
+}
+
+func (ch *clickhouseTracer) InjectCarrier(spanContextAny tracer.SpanContext) ([]byte, error) {
+	ctx, ok := spanContextAny.(spanContext)
+	if !ok {
+		return nil, fmt.Errorf("span context is not a clickhouse span context")
+	}
+
+	return json.Marshal(ctx)
+}
+
+func (ch *clickhouseTracer) ExtractCarrier(textMap []byte) (tracer.SpanContext, error) {
+	var ctx spanContext
+	if err := json.Unmarshal(textMap, &ctx); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal span carrier: %w", err)
+	}
+
+	if ctx.TraceId == "" || ctx.SpanId == "" {
+		return nil, fmt.Errorf("span carrier does not contain a clickhouse span context")
+	}
+
+	return ctx, nil
+}
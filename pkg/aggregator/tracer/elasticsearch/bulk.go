@@ -0,0 +1,209 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/es/spanstore/dbmodel"
+)
+
+// IndexNames determines the indices that spans and services are written to.
+type IndexNames struct {
+	// Prefix is prepended to all index names, separated by `-`.
+	Prefix string
+	// DateLayout is the time layout appended to daily indices.
+	DateLayout string
+	// UseAliases writes to the `jaeger-span-write` and `jaeger-service-write` aliases instead of daily indices,
+	// which are rolled over by an ILM policy or the Jaeger es-rollover tool.
+	UseAliases bool
+}
+
+func (names IndexNames) prefix() string {
+	if names.Prefix == "" {
+		return ""
+	}
+	return names.Prefix + "-"
+}
+
+// Span returns the index that a span starting at the given time is written to.
+func (names IndexNames) Span(startTime time.Time) string {
+	return names.index("jaeger-span-", startTime)
+}
+
+// Service returns the index that a service/operation pair first seen at the given time is written to.
+func (names IndexNames) Service(startTime time.Time) string {
+	return names.index("jaeger-service-", startTime)
+}
+
+func (names IndexNames) index(base string, startTime time.Time) string {
+	if names.UseAliases {
+		return names.prefix() + base + "write"
+	}
+
+	return names.prefix() + base + startTime.UTC().Format(names.DateLayout)
+}
+
+// BulkItem is a document to be indexed by the bulk API.
+type BulkItem struct {
+	Index string
+	// Id is the document ID, or empty to let Elasticsearch generate one.
+	Id   string
+	Body []byte
+}
+
+// Size returns the approximate number of bytes of the item in a bulk request.
+func (item BulkItem) Size() int {
+	return len(item.Index) + len(item.Id) + len(item.Body) + 32
+}
+
+// ToBulkItems converts a span to the documents in the Jaeger index schema.
+// The service document is only returned if includeService is true.
+func ToBulkItems(
+	converter dbmodel.FromDomain,
+	names IndexNames,
+	span *model.Span,
+	includeService bool,
+) (spanItem BulkItem, serviceItem *BulkItem, err error) {
+	jsonSpan := converter.FromDomainEmbedProcess(span)
+
+	spanBody, err := json.Marshal(jsonSpan)
+	if err != nil {
+		return BulkItem{}, nil, fmt.Errorf("cannot encode span: %w", err)
+	}
+	spanItem = BulkItem{Index: names.Span(span.StartTime), Body: spanBody}
+
+	if includeService {
+		service := dbmodel.Service{
+			ServiceName:   jsonSpan.Process.ServiceName,
+			OperationName: jsonSpan.OperationName,
+		}
+
+		serviceBody, err := json.Marshal(service)
+		if err != nil {
+			return BulkItem{}, nil, fmt.Errorf("cannot encode service: %w", err)
+		}
+
+		serviceItem = &BulkItem{Index: names.Service(span.StartTime), Id: ServiceId(service), Body: serviceBody}
+	}
+
+	return spanItem, serviceItem, nil
+}
+
+// ServiceId returns the document ID of a service/operation pair,
+// so that repeated writes of the same pair do not create duplicate documents.
+func ServiceId(service dbmodel.Service) string {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(service.ServiceName))
+	_, _ = hash.Write([]byte(service.OperationName))
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// EncodeBulk encodes the items as an NDJSON bulk request body.
+func EncodeBulk(items []BulkItem) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, item := range items {
+		type indexAction struct {
+			Index string `json:"_index"`
+			Id    string `json:"_id,omitempty"`
+		}
+
+		action, err := json.Marshal(map[string]indexAction{"index": {Index: item.Index, Id: item.Id}})
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(item.Body)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// BulkResult classifies the items of a bulk request by the response.
+type BulkResult struct {
+	// Retry contains the items rejected with a retryable status, e.g. 429 due to a full write queue.
+	Retry []BulkItem
+	// Failed is the number of items rejected with a non-retryable status, e.g. 400 due to mapping conflicts.
+	Failed int
+	// FirstError describes the first rejected item, if any.
+	FirstError string
+}
+
+// ParseBulkResponse parses the response of a bulk request of the given items.
+func ParseBulkResponse(body []byte, items []BulkItem) (BulkResult, error) {
+	var resp bulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return BulkResult{}, fmt.Errorf("cannot decode bulk response: %w", err)
+	}
+
+	result := BulkResult{}
+	if !resp.Errors {
+		return result, nil
+	}
+
+	if len(resp.Items) != len(items) {
+		return BulkResult{}, fmt.Errorf("bulk response contains %d items, expected %d", len(resp.Items), len(items))
+	}
+
+	for i, respItem := range resp.Items {
+		for _, action := range respItem {
+			if action.Status >= 200 && action.Status < 300 {
+				continue
+			}
+
+			if result.FirstError == "" {
+				result.FirstError = fmt.Sprintf("status %d", action.Status)
+				if action.Error != nil {
+					result.FirstError = fmt.Sprintf("%s: %s: %s", result.FirstError, action.Error.Type, action.Error.Reason)
+				}
+			}
+
+			if IsRetryableStatus(action.Status) {
+				result.Retry = append(result.Retry, items[i])
+			} else {
+				result.Failed++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// IsRetryableStatus returns whether a request rejected with the status may succeed if retried.
+func IsRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
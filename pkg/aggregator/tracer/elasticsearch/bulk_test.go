@@ -0,0 +1,118 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/es/spanstore/dbmodel"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/elasticsearch"
+)
+
+func TestIndexNames(t *testing.T) {
+	assert := assert.New(t)
+
+	startTime := time.Date(2024, 3, 4, 23, 0, 0, 0, time.FixedZone("UTC-2", -7200))
+
+	daily := elasticsearch.IndexNames{DateLayout: "2006-01-02"}
+	assert.Equal("jaeger-span-2024-03-05", daily.Span(startTime))
+	assert.Equal("jaeger-service-2024-03-05", daily.Service(startTime))
+
+	aliases := elasticsearch.IndexNames{Prefix: "prod", UseAliases: true}
+	assert.Equal("prod-jaeger-span-write", aliases.Span(startTime))
+	assert.Equal("prod-jaeger-service-write", aliases.Service(startTime))
+}
+
+func TestToBulkItems(t *testing.T) {
+	assert := assert.New(t)
+
+	span := &model.Span{
+		TraceID:       model.NewTraceID(1, 2),
+		SpanID:        3,
+		OperationName: "update",
+		StartTime:     time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+		Tags:          []model.KeyValue{model.String("cluster", "test")},
+		Process:       &model.Process{ServiceName: "audit"},
+	}
+
+	names := elasticsearch.IndexNames{DateLayout: "2006-01-02"}
+	spanItem, serviceItem, err := elasticsearch.ToBulkItems(dbmodel.NewFromDomain(false, nil, "@"), names, span, true)
+	assert.NoError(err)
+
+	assert.Equal("jaeger-span-2024-03-04", spanItem.Index)
+	assert.Empty(spanItem.Id)
+
+	var doc map[string]any
+	assert.NoError(json.Unmarshal(spanItem.Body, &doc))
+	assert.Equal("00000000000000010000000000000002", doc["traceID"])
+	assert.Equal("update", doc["operationName"])
+	assert.Equal("audit", doc["process"].(map[string]any)["serviceName"])
+
+	if assert.NotNil(serviceItem) {
+		assert.Equal("jaeger-service-2024-03-04", serviceItem.Index)
+		assert.Equal(elasticsearch.ServiceId(dbmodel.Service{ServiceName: "audit", OperationName: "update"}), serviceItem.Id)
+	}
+
+	_, serviceItem, err = elasticsearch.ToBulkItems(dbmodel.NewFromDomain(false, nil, "@"), names, span, false)
+	assert.NoError(err)
+	assert.Nil(serviceItem)
+}
+
+func TestEncodeBulk(t *testing.T) {
+	assert := assert.New(t)
+
+	body, err := elasticsearch.EncodeBulk([]elasticsearch.BulkItem{
+		{Index: "a", Body: []byte(`{"x":1}`)},
+		{Index: "b", Id: "id", Body: []byte(`{"y":2}`)},
+	})
+	assert.NoError(err)
+	assert.Equal(strings.Join([]string{
+		`{"index":{"_index":"a"}}`,
+		`{"x":1}`,
+		`{"index":{"_index":"b","_id":"id"}}`,
+		`{"y":2}`,
+		``,
+	}, "\n"), string(body))
+}
+
+func TestParseBulkResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	items := []elasticsearch.BulkItem{{Index: "a"}, {Index: "b"}, {Index: "c"}}
+
+	result, err := elasticsearch.ParseBulkResponse([]byte(`{"errors":false,"items":[]}`), items)
+	assert.NoError(err)
+	assert.Empty(result.Retry)
+	assert.Zero(result.Failed)
+
+	result, err = elasticsearch.ParseBulkResponse([]byte(`{"errors":true,"items":[
+		{"index":{"status":201}},
+		{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}},
+		{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}
+	]}`), items)
+	assert.NoError(err)
+	assert.Equal([]elasticsearch.BulkItem{{Index: "b"}}, result.Retry)
+	assert.Equal(1, result.Failed)
+	assert.Equal("status 429: es_rejected_execution_exception: queue full", result.FirstError)
+
+	_, err = elasticsearch.ParseBulkResponse([]byte(`{"errors":true,"items":[]}`), items)
+	assert.Error(err)
+}
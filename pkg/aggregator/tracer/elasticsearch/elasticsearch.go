@@ -0,0 +1,483 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jaegertracing/jaeger/pkg/es"
+	"github.com/jaegertracing/jaeger/plugin/storage/es/mappings"
+	"github.com/jaegertracing/jaeger/plugin/storage/es/spanstore/dbmodel"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/retention"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/jaegerspan"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+	"github.com/kubewharf/kelemetry/pkg/util/cache"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("tracer/elasticsearch", manager.Ptr(&esTracer{}), tracer.Tracer.CreateSpan)
+}
+
+type options struct {
+	urls     []string
+	username string
+	password string
+	timeout  time.Duration
+
+	indexPrefix     string
+	indexDateLayout string
+	useAliases      bool
+	createTemplates bool
+	esVersion       uint
+	shards          int64
+	replicas        int64
+	ilmPolicy       string
+
+	queueSize         int
+	bulkActions       int
+	bulkBytes         int
+	flushInterval     time.Duration
+	maxRetries        int
+	retryBackoff      time.Duration
+	maxRetryBackoff   time.Duration
+	serviceCacheTtl   time.Duration
+	tagDotReplacement string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringSliceVar(&options.urls, "tracer-es-urls", []string{"http://localhost:9200"}, "Elasticsearch/OpenSearch endpoints, used in round robin")
+	fs.StringVar(&options.username, "tracer-es-username", "", "basic auth username; accepts secret references such as 'file:/path'")
+	fs.StringVar(&options.password, "tracer-es-password", "", "basic auth password; accepts secret references such as 'file:/path'")
+	fs.DurationVar(&options.timeout, "tracer-es-timeout", time.Second*30, "timeout of each bulk request")
+
+	fs.StringVar(&options.indexPrefix, "tracer-es-index-prefix", "", "index prefix, same as --es.index-prefix of Jaeger query")
+	fs.StringVar(&options.indexDateLayout, "tracer-es-index-date-layout", "2006-01-02", "Go time layout of daily index names")
+	fs.BoolVar(
+		&options.useAliases,
+		"tracer-es-use-aliases",
+		false,
+		"write to the jaeger-span-write and jaeger-service-write aliases instead of daily indices, for index rollover",
+	)
+	fs.BoolVar(&options.createTemplates, "tracer-es-create-templates", true, "create Jaeger index templates on startup")
+	fs.UintVar(&options.esVersion, "tracer-es-version", 7, "major version of the index templates to create; use 7 for OpenSearch")
+	fs.Int64Var(&options.shards, "tracer-es-shards", 5, "number of shards in created index templates")
+	fs.Int64Var(&options.replicas, "tracer-es-replicas", 1, "number of replicas in created index templates")
+	fs.StringVar(
+		&options.ilmPolicy,
+		"tracer-es-ilm-policy",
+		"",
+		"ILM policy to roll over the write aliases with; requires --tracer-es-use-aliases",
+	)
+
+	fs.IntVar(&options.queueSize, "tracer-es-queue-size", 100000, "maximum number of documents buffered before new spans are dropped")
+	fs.IntVar(&options.bulkActions, "tracer-es-bulk-actions", 1000, "maximum number of documents in each bulk request")
+	fs.IntVar(&options.bulkBytes, "tracer-es-bulk-size", 5<<20, "maximum size in bytes of each bulk request")
+	fs.DurationVar(&options.flushInterval, "tracer-es-flush-interval", time.Second, "maximum delay before buffered documents are sent")
+	fs.IntVar(&options.maxRetries, "tracer-es-max-retries", 5, "number of retries of rejected documents before they are dropped")
+	fs.DurationVar(&options.retryBackoff, "tracer-es-retry-backoff", time.Millisecond*500, "initial backoff between retries, doubled after each retry")
+	fs.DurationVar(&options.maxRetryBackoff, "tracer-es-max-retry-backoff", time.Second*30, "maximum backoff between retries")
+	fs.DurationVar(
+		&options.serviceCacheTtl,
+		"tracer-es-service-cache-ttl",
+		time.Hour*12,
+		"duration for which written service/operation pairs are not rewritten",
+	)
+	fs.StringVar(
+		&options.tagDotReplacement,
+		"tracer-es-tag-dot-replacement",
+		"@",
+		"replacement of dots in tag keys, same as --es.tags-as-fields.dot-replacement of Jaeger query",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type esTracer struct {
+	manager.MuxImplBase
+
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Retention *retention.Policy
+	Secrets   *secret.Store
+
+	BulkMetric *metrics.Metric[*bulkMetric]
+	DropMetric *metrics.Metric[*dropMetric]
+	Dropped    *dropped.Recorder
+
+	username     *secret.Value
+	password     *secret.Value
+	names        IndexNames
+	converter    dbmodel.FromDomain
+	httpClient   http.Client
+	nextUrl      atomic.Uint32
+	serviceCache *cache.TtlOnce
+	queue        chan BulkItem
+	doneCh       chan struct{}
+}
+
+type bulkMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*bulkMetric) MetricName() string { return "tracer_es_bulk" }
+
+type dropMetric struct {
+	Reason string
+}
+
+func (*dropMetric) MetricName() string { return "tracer_es_drop" }
+
+var _ tracer.Tracer = &esTracer{}
+
+func (*esTracer) MuxImplName() (name string, isDefault bool) { return "elasticsearch", false }
+
+func (et *esTracer) Options() manager.Options { return &et.options }
+
+func (et *esTracer) Init() error {
+	if len(et.options.urls) == 0 {
+		return fmt.Errorf("--tracer-es-urls must not be empty")
+	}
+	if et.options.bulkActions <= 0 || et.options.bulkBytes <= 0 {
+		return fmt.Errorf("--tracer-es-bulk-actions and --tracer-es-bulk-size must be positive")
+	}
+	if et.options.ilmPolicy != "" && !et.options.useAliases {
+		return fmt.Errorf("--tracer-es-ilm-policy requires --tracer-es-use-aliases")
+	}
+
+	var err error
+	if et.username, err = et.Secrets.Watch("tracer-es-username", et.options.username); err != nil {
+		return err
+	}
+	if et.password, err = et.Secrets.Watch("tracer-es-password", et.options.password); err != nil {
+		return err
+	}
+
+	et.names = IndexNames{
+		Prefix:     et.options.indexPrefix,
+		DateLayout: et.options.indexDateLayout,
+		UseAliases: et.options.useAliases,
+	}
+	et.converter = dbmodel.NewFromDomain(false, nil, et.options.tagDotReplacement)
+	et.httpClient.Timeout = et.options.timeout
+	et.serviceCache = cache.NewTtlOnce(et.options.serviceCacheTtl, et.Clock)
+	et.queue = make(chan BulkItem, et.options.queueSize)
+	et.doneCh = make(chan struct{})
+	return nil
+}
+
+func (et *esTracer) Start(ctx context.Context) error {
+	if guidance := et.Retention.Guidance("elasticsearch", "span indices (with es-index-cleaner or the ILM delete phase)"); guidance != "" {
+		et.Logger.Warn(guidance)
+	}
+
+	if et.options.createTemplates {
+		if err := et.createTemplates(ctx); err != nil {
+			return err
+		}
+	}
+
+	go et.serviceCache.RunCleanupLoop(ctx, et.Logger)
+
+	go func() {
+		defer shutdown.RecoverPanic(et.Logger)
+		defer close(et.doneCh)
+		et.runFlusher()
+	}()
+
+	return nil
+}
+
+func (et *esTracer) Close(ctx context.Context) error {
+	close(et.queue)
+
+	select {
+	case <-et.doneCh:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for elasticsearch span flush: %w", ctx.Err())
+	}
+}
+
+// createTemplates creates the Jaeger index templates, and the initial write indices if aliases are used.
+func (et *esTracer) createTemplates(ctx context.Context) error {
+	builder := mappings.MappingBuilder{
+		TemplateBuilder:         es.TextTemplateBuilder{},
+		Shards:                  et.options.shards,
+		Replicas:                et.options.replicas,
+		PrioritySpanTemplate:    500,
+		PriorityServiceTemplate: 501,
+		EsVersion:               et.options.esVersion,
+		IndexPrefix:             et.options.indexPrefix,
+		UseILM:                  et.options.ilmPolicy != "",
+		ILMPolicyName:           et.options.ilmPolicy,
+	}
+
+	spanMapping, serviceMapping, err := builder.GetSpanServiceMappings()
+	if err != nil {
+		return fmt.Errorf("cannot render index templates: %w", err)
+	}
+
+	templateApi := "_template"
+	if et.options.esVersion >= 8 {
+		templateApi = "_index_template"
+	}
+
+	for name, mapping := range map[string]string{"jaeger-span": spanMapping, "jaeger-service": serviceMapping} {
+		path := fmt.Sprintf("/%s/%s%s", templateApi, et.names.prefix(), name)
+		if _, err := et.request(ctx, http.MethodPut, path, "application/json", []byte(mapping)); err != nil {
+			return fmt.Errorf("cannot create index template %q: %w", name, err)
+		}
+
+		if et.options.useAliases {
+			if err := et.ensureWriteIndex(ctx, et.names.prefix()+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ensureWriteIndex creates the first rollover index behind the read and write aliases if the write alias does not exist.
+func (et *esTracer) ensureWriteIndex(ctx context.Context, base string) error {
+	_, err := et.request(ctx, http.MethodHead, "/_alias/"+base+"-write", "", nil)
+	if err == nil {
+		return nil
+	}
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusNotFound {
+		return fmt.Errorf("cannot check alias %q: %w", base+"-write", err)
+	}
+
+	body := fmt.Sprintf(`{"aliases":{%q:{"is_write_index":true},%q:{}}}`, base+"-write", base+"-read")
+	if _, err := et.request(ctx, http.MethodPut, "/"+base+"-000001", "application/json", []byte(body)); err != nil {
+		return fmt.Errorf("cannot create initial index for %q: %w", base, err)
+	}
+
+	return nil
+}
+
+type statusError struct {
+	status int
+	body   string
+}
+
+func (err *statusError) Error() string { return fmt.Sprintf("status %d: %s", err.status, err.body) }
+
+func (et *esTracer) request(ctx context.Context, method string, path string, contentType string, body []byte) ([]byte, error) {
+	url := et.options.urls[int(et.nextUrl.Add(1))%len(et.options.urls)]
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(url, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if username := et.username.Get(); username != "" {
+		req.SetBasicAuth(username, et.password.Get())
+	}
+
+	resp, err := et.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &statusError{status: resp.StatusCode, body: string(respBody)}
+	}
+
+	return respBody, nil
+}
+
+// runFlusher sends buffered documents until the queue is closed.
+func (et *esTracer) runFlusher() {
+	batch := make([]BulkItem, 0, et.options.bulkActions)
+	batchBytes := 0
+	ticker := et.Clock.Tick(et.options.flushInterval)
+
+	flush := func() {
+		et.flush(batch)
+		batch = batch[:0]
+		batchBytes = 0
+	}
+
+	for {
+		select {
+		case item, ok := <-et.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			if len(batch) > 0 && batchBytes+item.Size() > et.options.bulkBytes {
+				flush()
+			}
+
+			batch = append(batch, item)
+			batchBytes += item.Size()
+			if len(batch) >= et.options.bulkActions {
+				flush()
+			}
+		case <-ticker:
+			if len(batch) > 0 {
+				flush()
+			}
+		}
+	}
+}
+
+// flush sends a bulk request, retrying rejected documents with exponential backoff.
+func (et *esTracer) flush(items []BulkItem) {
+	backoff := et.options.retryBackoff
+
+	for attempt := 0; len(items) > 0; attempt++ {
+		retry, err := et.bulk(items)
+		if err != nil {
+			et.Logger.WithError(err).WithField("attempt", attempt).Warn("bulk request failed")
+		}
+
+		if len(retry) == 0 {
+			return
+		}
+
+		if attempt >= et.options.maxRetries {
+			et.DropMetric.With(&dropMetric{Reason: "Retry"}).Count(float64(len(retry)))
+			err := fmt.Errorf("cannot index documents after %d attempts", attempt+1)
+			et.Dropped.DropN(et.Logger, dropped.StageTracer, "Retry", len(retry), err)
+			return
+		}
+
+		et.Clock.Sleep(backoff)
+		backoff *= 2
+		if backoff > et.options.maxRetryBackoff {
+			backoff = et.options.maxRetryBackoff
+		}
+
+		items = retry
+	}
+}
+
+// bulk sends a bulk request and returns the items that should be retried.
+func (et *esTracer) bulk(items []BulkItem) (retry []BulkItem, err error) {
+	metric := &bulkMetric{}
+	defer et.BulkMetric.DeferCount(et.Clock.Now(), metric)
+
+	body, err := EncodeBulk(items)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Encode")
+		et.DropMetric.With(&dropMetric{Reason: "Encode"}).Count(float64(len(items)))
+		et.Dropped.DropN(et.Logger, dropped.StageTracer, "Encode", len(items), err)
+		return nil, err
+	}
+
+	respBody, err := et.request(context.Background(), http.MethodPost, "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Request")
+
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && !IsRetryableStatus(statusErr.status) {
+			reason := fmt.Sprintf("Status%d", statusErr.status)
+			et.DropMetric.With(&dropMetric{Reason: reason}).Count(float64(len(items)))
+			et.Dropped.DropN(et.Logger, dropped.StageTracer, reason, len(items), err)
+			return nil, err
+		}
+
+		return items, err
+	}
+
+	result, err := ParseBulkResponse(respBody, items)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Decode")
+		return items, err
+	}
+
+	if result.Failed > 0 {
+		metric.Error = metrics.MakeLabeledError("Rejected")
+		et.DropMetric.With(&dropMetric{Reason: "Rejected"}).Count(float64(result.Failed))
+		err := fmt.Errorf("documents rejected: %s", result.FirstError)
+		et.Dropped.DropN(et.Logger, dropped.StageTracer, "Rejected", result.Failed, err)
+	} else if len(result.Retry) > 0 {
+		metric.Error = metrics.MakeLabeledError("Retryable")
+	}
+
+	return result.Retry, nil
+}
+
+func (et *esTracer) CreateSpan(span tracer.Span) (tracer.SpanContext, error) {
+	jaegerSpan, newContext, err := jaegerspan.FromSpan(span, jaegerspan.RandomId)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceKey := et.names.Service(jaegerSpan.StartTime) + "/" + span.Type + "/" + span.Name
+	_, serviceWritten := et.serviceCache.Get(serviceKey)
+
+	spanItem, serviceItem, err := ToBulkItems(et.converter, et.names, jaegerSpan, !serviceWritten)
+	if err != nil {
+		return nil, err
+	}
+
+	et.enqueue(spanItem)
+	if serviceItem != nil {
+		et.serviceCache.Add(serviceKey, struct{}{})
+		et.enqueue(*serviceItem)
+	}
+
+	return newContext, nil
+}
+
+func (et *esTracer) enqueue(item BulkItem) {
+	select {
+	case et.queue <- item:
+	default:
+		et.DropMetric.With(&dropMetric{Reason: "QueueFull"}).Count(1)
+		et.Dropped.Drop(et.Logger, dropped.StageTracer, "QueueFull", fmt.Errorf("document queue is full"))
+	}
+}
+
+func (et *esTracer) InjectCarrier(spanContext tracer.SpanContext) ([]byte, error) {
+	return jaegerspan.InjectCarrier(spanContext)
+}
+
+func (et *esTracer) ExtractCarrier(textMap []byte) (tracer.SpanContext, error) {
+	return jaegerspan.ExtractCarrier(textMap)
+}
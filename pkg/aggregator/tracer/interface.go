@@ -15,14 +15,21 @@
 package tracer
 
 import (
+	"context"
 	"time"
 
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/live"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer/redact"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
 )
 
 func init() {
-	manager.Global.Provide("tracer", manager.Ptr(newMux()))
+	manager.Global.Provide("tracer", manager.Ptr[Tracer](&mux{
+		Mux: manager.NewMux("tracer", false),
+	}))
 }
 
 type Tracer interface {
@@ -38,12 +45,34 @@ type Span struct {
 	FinishTime time.Time
 	Parent     SpanContext
 	Follows    SpanContext
-	Tags       map[string]string
-	Logs       []Log
+	// Spans in other traces that are causally related to this span.
+	Links []SpanContext
+	Tags  map[string]string
+	Logs  []Log
 }
 
 type SpanContext any
 
+// TraceIdSpanContext is implemented by span contexts that expose their trace ID.
+type TraceIdSpanContext interface {
+	// GetTraceId returns the hex trace ID.
+	GetTraceId() string
+}
+
+// TraceIdOf returns the hex trace ID of a span context, or an empty string if it is unknown.
+func TraceIdOf(spanContext SpanContext) string {
+	switch spanContext := spanContext.(type) {
+	case TraceIdSpanContext:
+		return spanContext.GetTraceId()
+	case context.Context:
+		if otelContext := oteltrace.SpanContextFromContext(spanContext); otelContext.HasTraceID() {
+			return otelContext.TraceID().String()
+		}
+	}
+
+	return ""
+}
+
 type Log struct {
 	Type    zconstants.LogType
 	Message string
@@ -52,16 +81,45 @@ type Log struct {
 
 type mux struct {
 	*manager.Mux
+	Redactor *redact.Redactor
+	Live     *live.Broadcaster
 }
 
-func newMux() Tracer {
-	return &mux{
-		Mux: manager.NewMux("tracer", false),
+func (mux *mux) CreateSpan(span Span) (SpanContext, error) {
+	if mux.Redactor.Enabled() {
+		span.Tags = mux.Redactor.RedactTags(span.Type, span.Tags)
+
+		logs := make([]Log, len(span.Logs))
+		for i, log := range span.Logs {
+			logs[i] = log
+			logs[i].Message, logs[i].Attrs = mux.Redactor.RedactLog(span.Type, log.Message, log.Attrs)
+		}
+		span.Logs = logs
+	}
+
+	spanContext, err := mux.Impl().(Tracer).CreateSpan(span)
+	if err == nil && mux.Live.Enabled() {
+		mux.publishLive(span, spanContext)
 	}
+
+	return spanContext, err
 }
 
-func (mux *mux) CreateSpan(span Span) (SpanContext, error) {
-	return mux.Impl().(Tracer).CreateSpan(span)
+func (mux *mux) publishLive(span Span, spanContext SpanContext) {
+	logs := make([]live.Log, len(span.Logs))
+	for i, log := range span.Logs {
+		logs[i] = live.Log{Type: log.Type, Message: log.Message, Attrs: log.Attrs}
+	}
+
+	mux.Live.Publish(live.Span{
+		TraceId:    TraceIdOf(spanContext),
+		Type:       span.Type,
+		Name:       span.Name,
+		StartTime:  span.StartTime,
+		FinishTime: span.FinishTime,
+		Tags:       span.Tags,
+		Logs:       logs,
+	})
 }
 
 func (mux *mux) InjectCarrier(spanContext SpanContext) ([]byte, error) {
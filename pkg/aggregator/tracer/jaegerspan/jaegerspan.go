@@ -0,0 +1,132 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Converts tracer spans to the Jaeger model for tracers that write to Jaeger storage directly.
+package jaegerspan
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+// SpanContext is the tracer.SpanContext of spans converted by FromSpan.
+type SpanContext struct {
+	TraceId model.TraceID `json:"traceId"`
+	SpanId  model.SpanID  `json:"spanId"`
+}
+
+func (ctx SpanContext) GetTraceId() string { return ctx.TraceId.String() }
+
+// RandomId generates a random ID for FromSpan.
+func RandomId() uint64 {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("cannot read random bytes: %v", err))
+	}
+
+	return binary.BigEndian.Uint64(buf)
+}
+
+// FromSpan converts a span to the Jaeger model,
+// in the same representation as spans exported through OpenTelemetry.
+// newId generates random nonzero IDs.
+func FromSpan(span tracer.Span, newId func() uint64) (*model.Span, SpanContext, error) {
+	newContext := SpanContext{SpanId: model.SpanID(newId())}
+
+	references := []model.SpanRef{}
+	if span.Parent != nil {
+		parent, ok := span.Parent.(SpanContext)
+		if !ok {
+			return nil, SpanContext{}, fmt.Errorf("parent span context is not a jaeger span context")
+		}
+
+		newContext.TraceId = parent.TraceId
+		references = append(references, model.NewChildOfRef(parent.TraceId, parent.SpanId))
+	} else {
+		newContext.TraceId = model.NewTraceID(newId(), newId())
+	}
+
+	for _, linked := range append([]tracer.SpanContext{span.Follows}, span.Links...) {
+		if linkedContext, ok := linked.(SpanContext); ok {
+			references = append(references, model.NewFollowsFromRef(linkedContext.TraceId, linkedContext.SpanId))
+		}
+	}
+
+	tags := make([]model.KeyValue, 0, len(span.Tags))
+	for key, value := range span.Tags {
+		tags = append(tags, model.String(key, value))
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+
+	logs := make([]model.Log, 0, len(span.Logs))
+	for _, log := range span.Logs {
+		fields := []model.KeyValue{
+			model.String("event", log.Message),
+			model.String(zconstants.LogTypeAttr, string(log.Type)),
+		}
+		for _, attr := range log.Attrs {
+			fields = append(fields, model.String(attr[0], attr[1]))
+		}
+		logs = append(logs, model.Log{Timestamp: span.StartTime, Fields: fields})
+	}
+
+	duration := span.FinishTime.Sub(span.StartTime)
+	if duration < 0 {
+		duration = 0
+	}
+
+	jaegerSpan := &model.Span{
+		TraceID:       newContext.TraceId,
+		SpanID:        newContext.SpanId,
+		OperationName: span.Name,
+		References:    references,
+		StartTime:     span.StartTime,
+		Duration:      duration,
+		Tags:          tags,
+		Logs:          logs,
+		Process:       &model.Process{ServiceName: span.Type},
+	}
+
+	return jaegerSpan, newContext, nil
+}
+
+func InjectCarrier(spanContextAny tracer.SpanContext) ([]byte, error) {
+	ctx, ok := spanContextAny.(SpanContext)
+	if !ok {
+		return nil, fmt.Errorf("span context is not a jaeger span context")
+	}
+
+	return json.Marshal(ctx)
+}
+
+func ExtractCarrier(textMap []byte) (tracer.SpanContext, error) {
+	var ctx SpanContext
+	if err := json.Unmarshal(textMap, &ctx); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal span carrier: %w", err)
+	}
+
+	if ctx.TraceId == (model.TraceID{}) || ctx.SpanId == 0 {
+		return nil, fmt.Errorf("span carrier does not contain a jaeger span context")
+	}
+
+	return ctx, nil
+}
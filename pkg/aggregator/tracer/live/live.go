@@ -0,0 +1,347 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Streams the spans of an object to WebSocket clients as soon as they are exported,
+// so that an object can be followed during an incident without repeating searches.
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/websocket"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	pkghttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("tracer-live", manager.Ptr(&Broadcaster{}))
+}
+
+type options struct {
+	enable         bool
+	bufferSize     int
+	maxSubscribers int
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"tracer-live-enable",
+		false,
+		"stream the spans of an object to WebSocket clients of /live as they are exported",
+	)
+	fs.IntVar(
+		&options.bufferSize,
+		"tracer-live-buffer-size",
+		256,
+		"number of spans buffered for each client; clients that fall further behind are disconnected",
+	)
+	fs.IntVar(&options.maxSubscribers, "tracer-live-max-subscribers", 100, "maximum number of concurrent clients of /live")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if options.enable && options.bufferSize <= 0 {
+		return fmt.Errorf("--tracer-live-buffer-size must be positive")
+	}
+	return nil
+}
+
+// Span is the message sent to clients for each exported span.
+type Span struct {
+	TraceId    string            `json:"traceId,omitempty"`
+	Type       string            `json:"type"`
+	Name       string            `json:"name"`
+	StartTime  time.Time         `json:"startTime"`
+	FinishTime time.Time         `json:"finishTime"`
+	Tags       map[string]string `json:"tags"`
+	Logs       []Log             `json:"logs,omitempty"`
+}
+
+type Log struct {
+	Type    zconstants.LogType `json:"type"`
+	Message string             `json:"message"`
+	Attrs   [][2]string        `json:"attrs,omitempty"`
+}
+
+// Broadcaster streams spans to subscribers of their objects. Publish is a no-op if streaming is disabled.
+type Broadcaster struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Server  pkghttp.Server
+	Auth    *auth.Authenticator
+	Tenant  *tenant.Filter
+
+	StreamMetric  *metrics.Metric[*streamMetric]
+	PublishMetric *metrics.Metric[*publishMetric]
+
+	subscribersMu  sync.RWMutex
+	subscribers    map[utilobject.Key]map[*subscriber]struct{}
+	numSubscribers int
+	closed         bool
+}
+
+type streamMetric struct {
+	Cluster string
+	Reason  string
+}
+
+func (*streamMetric) MetricName() string { return "tracer_live_stream" }
+
+type publishMetric struct {
+	Cluster string
+}
+
+func (*publishMetric) MetricName() string { return "tracer_live_publish" }
+
+const (
+	closeReasonClient   = "ClientClosed"
+	closeReasonSlow     = "SlowClient"
+	closeReasonShutdown = "Shutdown"
+	closeReasonError    = "WriteError"
+)
+
+type subscriber struct {
+	object utilobject.Key
+	ch     chan []byte
+	// written once before ch is closed
+	closeReason string
+}
+
+var _ manager.Component = &Broadcaster{}
+
+func (broadcaster *Broadcaster) Options() manager.Options { return &broadcaster.options }
+
+func (broadcaster *Broadcaster) Init() error {
+	broadcaster.subscribers = map[utilobject.Key]map[*subscriber]struct{}{}
+
+	if !broadcaster.options.enable {
+		return nil
+	}
+
+	broadcaster.Server.Routes().GET("/live", broadcaster.Auth.Wrap(func(ctx *gin.Context) {
+		logger := broadcaster.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+
+		object := utilobject.Key{
+			Cluster:   ctx.Query("cluster"),
+			Group:     ctx.Query("group"),
+			Resource:  ctx.Query("resource"),
+			Namespace: ctx.Query("namespace"),
+			Name:      ctx.Query("name"),
+		}
+		if object.Cluster == "" || object.Resource == "" || object.Name == "" {
+			ctx.String(400, "cluster or resource or name is empty")
+			return
+		}
+		if !broadcaster.Tenant.Allows(broadcaster.Tenant.RequestContext(ctx.Request), object) {
+			// respond the same as a missing object to avoid revealing its existence
+			ctx.String(404, "object does not exist")
+			return
+		}
+
+		logger = logger.WithFields(object.AsFields("object"))
+
+		server := websocket.Server{
+			// requests are authenticated by the Authorization header instead of the origin
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(conn *websocket.Conn) {
+				defer conn.Close()
+
+				sub, err := broadcaster.subscribe(object)
+				if err != nil {
+					_ = websocket.JSON.Send(conn, gin.H{"error": err.Error()})
+					return
+				}
+
+				broadcaster.serve(logger, conn, sub)
+			},
+		}
+		server.ServeHTTP(ctx.Writer, ctx.Request)
+	}))
+
+	return nil
+}
+
+func (broadcaster *Broadcaster) Start(ctx context.Context) error { return nil }
+
+func (broadcaster *Broadcaster) Close(ctx context.Context) error {
+	broadcaster.subscribersMu.Lock()
+	defer broadcaster.subscribersMu.Unlock()
+
+	broadcaster.closed = true
+	for _, subs := range broadcaster.subscribers {
+		for sub := range subs {
+			broadcaster.removeLocked(sub, closeReasonShutdown)
+		}
+	}
+
+	return nil
+}
+
+func (broadcaster *Broadcaster) Enabled() bool { return broadcaster.options.enable }
+
+// Publish sends the span to the subscribers of its object without blocking.
+func (broadcaster *Broadcaster) Publish(span Span) {
+	object, ok := utilobject.FromMap(span.Tags)
+	if !ok {
+		return
+	}
+
+	broadcaster.subscribersMu.RLock()
+	subs := broadcaster.subscribers[object]
+	if len(subs) == 0 {
+		broadcaster.subscribersMu.RUnlock()
+		return
+	}
+
+	slow := []*subscriber{}
+	func() {
+		defer broadcaster.subscribersMu.RUnlock()
+
+		message, err := json.Marshal(span)
+		if err != nil {
+			broadcaster.Logger.WithError(err).Error("cannot encode live span")
+			return
+		}
+
+		broadcaster.PublishMetric.With(&publishMetric{Cluster: object.Cluster}).Count(float64(len(subs)))
+
+		for sub := range subs {
+			select {
+			case sub.ch <- message:
+			default:
+				slow = append(slow, sub)
+			}
+		}
+	}()
+
+	if len(slow) > 0 {
+		broadcaster.subscribersMu.Lock()
+		defer broadcaster.subscribersMu.Unlock()
+
+		for _, sub := range slow {
+			broadcaster.removeLocked(sub, closeReasonSlow)
+		}
+	}
+}
+
+func (broadcaster *Broadcaster) subscribe(object utilobject.Key) (*subscriber, error) {
+	broadcaster.subscribersMu.Lock()
+	defer broadcaster.subscribersMu.Unlock()
+
+	if broadcaster.closed {
+		return nil, fmt.Errorf("server is shutting down")
+	}
+	if broadcaster.numSubscribers >= broadcaster.options.maxSubscribers {
+		return nil, fmt.Errorf("too many live streams")
+	}
+
+	sub := &subscriber{
+		object: object,
+		ch:     make(chan []byte, broadcaster.options.bufferSize),
+	}
+
+	subs, exists := broadcaster.subscribers[object]
+	if !exists {
+		subs = map[*subscriber]struct{}{}
+		broadcaster.subscribers[object] = subs
+	}
+	subs[sub] = struct{}{}
+	broadcaster.numSubscribers++
+
+	return sub, nil
+}
+
+// unsubscribe removes the subscriber if it has not been removed yet.
+func (broadcaster *Broadcaster) unsubscribe(sub *subscriber, reason string) {
+	broadcaster.subscribersMu.Lock()
+	defer broadcaster.subscribersMu.Unlock()
+
+	broadcaster.removeLocked(sub, reason)
+}
+
+func (broadcaster *Broadcaster) removeLocked(sub *subscriber, reason string) {
+	subs := broadcaster.subscribers[sub.object]
+	if _, exists := subs[sub]; !exists {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(broadcaster.subscribers, sub.object)
+	}
+	broadcaster.numSubscribers--
+
+	sub.closeReason = reason
+	close(sub.ch)
+}
+
+func (broadcaster *Broadcaster) serve(logger logrus.FieldLogger, conn *websocket.Conn, sub *subscriber) {
+	metric := &streamMetric{Cluster: sub.object.Cluster}
+	defer broadcaster.StreamMetric.DeferCount(broadcaster.Clock.Now(), metric)
+
+	logger.Info("Live stream opened")
+	defer func() {
+		logger.WithField("reason", metric.Reason).Info("Live stream closed")
+	}()
+
+	// clients do not send messages, so reading only returns when the client closes the connection
+	clientClosed := make(chan struct{})
+	go func() {
+		defer shutdown.RecoverPanic(logger)
+		_, _ = io.Copy(io.Discard, conn)
+		close(clientClosed)
+	}()
+
+	for {
+		select {
+		case message, open := <-sub.ch:
+			if !open {
+				metric.Reason = sub.closeReason
+				return
+			}
+
+			if err := websocket.Message.Send(conn, string(message)); err != nil {
+				logger.WithError(err).Debug("cannot write live span")
+				broadcaster.unsubscribe(sub, closeReasonError)
+				metric.Reason = closeReasonError
+				return
+			}
+		case <-clientClosed:
+			broadcaster.unsubscribe(sub, closeReasonClient)
+			metric.Reason = closeReasonClient
+			return
+		}
+	}
+}
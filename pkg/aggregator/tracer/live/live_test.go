@@ -0,0 +1,128 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func newTestBroadcaster(bufferSize int, maxSubscribers int) *Broadcaster {
+	clock := clocktesting.NewFakeClock(time.Now())
+	metricsClient, _ := metrics.NewMock(clock)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return &Broadcaster{
+		options:       options{bufferSize: bufferSize, maxSubscribers: maxSubscribers},
+		Logger:        logger,
+		Clock:         clock,
+		StreamMetric:  metrics.New[*streamMetric](metricsClient),
+		PublishMetric: metrics.New[*publishMetric](metricsClient),
+		subscribers:   map[utilobject.Key]map[*subscriber]struct{}{},
+	}
+}
+
+var (
+	testObject  = utilobject.Key{Cluster: "test", Group: "apps", Resource: "deployments", Namespace: "default", Name: "web"}
+	otherObject = utilobject.Key{Cluster: "test", Group: "apps", Resource: "deployments", Namespace: "default", Name: "db"}
+)
+
+func testSpan(object utilobject.Key, name string) Span {
+	return Span{Name: name, Tags: zconstants.KeyToSpanTags(object)}
+}
+
+func TestPublish(t *testing.T) {
+	assert := assert.New(t)
+
+	broadcaster := newTestBroadcaster(4, 10)
+	sub, err := broadcaster.subscribe(testObject)
+	assert.NoError(err)
+
+	broadcaster.Publish(testSpan(otherObject, "other"))
+	broadcaster.Publish(testSpan(testObject, "update"))
+	broadcaster.Publish(Span{Name: "no object"})
+
+	if assert.Len(sub.ch, 1) {
+		span := Span{}
+		assert.NoError(json.Unmarshal(<-sub.ch, &span))
+		assert.Equal("update", span.Name)
+	}
+
+	broadcaster.unsubscribe(sub, closeReasonClient)
+	_, open := <-sub.ch
+	assert.False(open)
+	assert.Empty(broadcaster.subscribers)
+	assert.Equal(0, broadcaster.numSubscribers)
+}
+
+func TestPublishSlowSubscriber(t *testing.T) {
+	assert := assert.New(t)
+
+	broadcaster := newTestBroadcaster(2, 10)
+	slow, err := broadcaster.subscribe(testObject)
+	assert.NoError(err)
+	fast, err := broadcaster.subscribe(testObject)
+	assert.NoError(err)
+
+	for i := 0; i < 3; i++ {
+		broadcaster.Publish(testSpan(testObject, "update"))
+		if i < 2 {
+			<-fast.ch
+		}
+	}
+
+	// the slow subscriber receives the buffered spans before the stream ends
+	assert.Len(slow.ch, 2)
+	<-slow.ch
+	<-slow.ch
+	_, open := <-slow.ch
+	assert.False(open)
+	assert.Equal(closeReasonSlow, slow.closeReason)
+
+	assert.Len(fast.ch, 1)
+	assert.Equal(1, broadcaster.numSubscribers)
+}
+
+func TestSubscribeLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	broadcaster := newTestBroadcaster(2, 1)
+	sub, err := broadcaster.subscribe(testObject)
+	assert.NoError(err)
+
+	_, err = broadcaster.subscribe(otherObject)
+	assert.Error(err)
+
+	assert.NoError(broadcaster.Close(context.Background()))
+	_, open := <-sub.ch
+	assert.False(open)
+	assert.Equal(closeReasonShutdown, sub.closeReason)
+
+	_, err = broadcaster.subscribe(otherObject)
+	assert.Error(err)
+}
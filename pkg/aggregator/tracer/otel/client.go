@@ -0,0 +1,159 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelsdktrace "go.opentelemetry.io/otel/sdk/trace"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip compressor for otlptracegrpc.WithCompressor
+)
+
+const (
+	ProtocolGrpc = "grpc"
+	ProtocolHttp = "http"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+type exportOptions struct {
+	protocol    string
+	urlPath     string
+	headers     map[string]string
+	compression string
+	timeout     time.Duration
+
+	retryEnable          bool
+	retryInitialInterval time.Duration
+	retryMaxInterval     time.Duration
+	retryMaxElapsedTime  time.Duration
+
+	batchMaxQueueSize  int
+	batchMaxExportSize int
+	batchTimeout       time.Duration
+}
+
+func (options *exportOptions) setup(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&options.protocol,
+		"tracer-otel-protocol",
+		ProtocolGrpc,
+		fmt.Sprintf("OTLP transport protocol, either %q or %q (protobuf over HTTP)", ProtocolGrpc, ProtocolHttp),
+	)
+	fs.StringVar(&options.urlPath, "tracer-otel-url-path", "/v1/traces", "URL path of the OTLP/HTTP endpoint")
+	fs.StringToStringVar(&options.headers, "tracer-otel-headers", map[string]string{}, "headers or gRPC metadata sent with each export request")
+	fs.StringVar(
+		&options.compression,
+		"tracer-otel-compression",
+		CompressionNone,
+		fmt.Sprintf("compression of export requests, either %q or %q", CompressionNone, CompressionGzip),
+	)
+	fs.DurationVar(&options.timeout, "tracer-otel-timeout", time.Second*10, "timeout of each export request")
+
+	fs.BoolVar(&options.retryEnable, "tracer-otel-retry-enable", true, "retry failed export requests with exponential backoff")
+	fs.DurationVar(&options.retryInitialInterval, "tracer-otel-retry-initial-interval", time.Second*5, "initial backoff of export retries")
+	fs.DurationVar(&options.retryMaxInterval, "tracer-otel-retry-max-interval", time.Second*30, "maximum backoff of export retries")
+	fs.DurationVar(
+		&options.retryMaxElapsedTime,
+		"tracer-otel-retry-max-elapsed-time",
+		time.Minute,
+		"duration after which a failed batch is dropped",
+	)
+
+	fs.IntVar(
+		&options.batchMaxQueueSize,
+		"tracer-otel-batch-max-queue-size",
+		otelsdktrace.DefaultMaxQueueSize,
+		"maximum number of spans buffered per service before new spans are dropped",
+	)
+	fs.IntVar(
+		&options.batchMaxExportSize,
+		"tracer-otel-batch-max-export-size",
+		otelsdktrace.DefaultMaxExportBatchSize,
+		"maximum number of spans in each export request",
+	)
+	fs.DurationVar(
+		&options.batchTimeout,
+		"tracer-otel-batch-timeout",
+		time.Duration(otelsdktrace.DefaultScheduleDelay)*time.Millisecond,
+		"maximum delay before buffered spans are exported",
+	)
+}
+
+func (options *exportOptions) batchOptions() []otelsdktrace.BatchSpanProcessorOption {
+	return []otelsdktrace.BatchSpanProcessorOption{
+		otelsdktrace.WithMaxQueueSize(options.batchMaxQueueSize),
+		otelsdktrace.WithMaxExportBatchSize(options.batchMaxExportSize),
+		otelsdktrace.WithBatchTimeout(options.batchTimeout),
+	}
+}
+
+func newClient(endpoint string, insecure bool, options *exportOptions) (otlptrace.Client, error) {
+	if options.compression != CompressionNone && options.compression != CompressionGzip {
+		return nil, fmt.Errorf("unsupported --tracer-otel-compression %q", options.compression)
+	}
+
+	switch options.protocol {
+	case ProtocolGrpc:
+		grpcOptions := []otlptracegrpc.Option{
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithHeaders(options.headers),
+			otlptracegrpc.WithTimeout(options.timeout),
+			otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{
+				Enabled:         options.retryEnable,
+				InitialInterval: options.retryInitialInterval,
+				MaxInterval:     options.retryMaxInterval,
+				MaxElapsedTime:  options.retryMaxElapsedTime,
+			}),
+		}
+		if insecure {
+			grpcOptions = append(grpcOptions, otlptracegrpc.WithInsecure())
+		}
+		if options.compression == CompressionGzip {
+			grpcOptions = append(grpcOptions, otlptracegrpc.WithCompressor(CompressionGzip))
+		}
+		return otlptracegrpc.NewClient(grpcOptions...), nil
+
+	case ProtocolHttp:
+		httpOptions := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint),
+			otlptracehttp.WithURLPath(options.urlPath),
+			otlptracehttp.WithHeaders(options.headers),
+			otlptracehttp.WithTimeout(options.timeout),
+			otlptracehttp.WithRetry(otlptracehttp.RetryConfig{
+				Enabled:         options.retryEnable,
+				InitialInterval: options.retryInitialInterval,
+				MaxInterval:     options.retryMaxInterval,
+				MaxElapsedTime:  options.retryMaxElapsedTime,
+			}),
+		}
+		if insecure {
+			httpOptions = append(httpOptions, otlptracehttp.WithInsecure())
+		}
+		if options.compression == CompressionGzip {
+			httpOptions = append(httpOptions, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		return otlptracehttp.NewClient(httpOptions...), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported --tracer-otel-protocol %q", options.protocol)
+	}
+}
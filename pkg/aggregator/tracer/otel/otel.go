@@ -19,20 +19,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	otelsdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
 	oteltrace "go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/clock"
 
+	"github.com/kubewharf/kelemetry/pkg/aggregator/retention"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
 )
@@ -47,14 +52,18 @@ type options struct {
 	endpoint   string
 	insecure   bool
 	attributes map[string]string
+	export     exportOptions
+	shed       shedOptions
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
-	fs.StringVar(&options.endpoint, "tracer-otel-endpoint", "127.0.0.1:4317", "otel endpoint")
+	fs.StringVar(&options.endpoint, "tracer-otel-endpoint", "127.0.0.1:4317", "otel endpoint, e.g. 127.0.0.1:4318 for OTLP/HTTP")
 	fs.BoolVar(&options.insecure, "tracer-otel-insecure", false, "allow insecure otel connections")
 	fs.StringToStringVar(&options.attributes, "tracer-otel-resource-attributes", map[string]string{
 		string(semconv.ServiceVersionKey): "dev",
 	}, "otel resource service attributes")
+	options.export.setup(fs)
+	options.shed.setup(fs)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -64,11 +73,21 @@ type otelTracer struct {
 
 	options   options
 	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Metrics   metrics.Client
+	Retention *retention.Policy
+	SelfTrace *selftrace.Tracer
 	deferList *shutdown.DeferList
 
+	ShedMetric *metrics.Metric[*shedMetric]
+	Dropped    *dropped.Recorder
+
 	exporter   *otlptrace.Exporter
 	tracers    sync.Map // equiv. map[string]*onceTracer
 	propagator propagation.TextMapPropagator
+	shedder    *shedder
+	// the error of the last export, or nil if it succeeded
+	exportErr atomic.Pointer[error]
 }
 
 type onceTracer struct {
@@ -84,11 +103,20 @@ func (otel *otelTracer) Options() manager.Options {
 }
 
 func (otel *otelTracer) Init() error {
-	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(otel.options.endpoint)}
-	if otel.options.insecure {
-		options = append(options, otlptracegrpc.WithInsecure())
+	client, err := newClient(otel.options.endpoint, otel.options.insecure, &otel.options.export)
+	if err != nil {
+		return err
 	}
-	client := otlptracegrpc.NewClient(options...)
+
+	otel.shedder, err = newShedder(otel.options.shed, otel.Clock)
+	if err != nil {
+		return err
+	}
+	if otel.shedder != nil {
+		metrics.NewMonitor(otel.Metrics, &rateLimitMetric{}, otel.shedder.currentLimit)
+	}
+	client = observedClient{Client: client, observe: otel.observeExport, selfTrace: otel.SelfTrace}
+
 	exporter := otlptrace.NewUnstarted(client)
 	otel.exporter = exporter
 
@@ -97,6 +125,22 @@ func (otel *otelTracer) Init() error {
 	return nil
 }
 
+func (otel *otelTracer) observeExport(err error) {
+	otel.exportErr.Store(&err)
+
+	if otel.shedder != nil {
+		otel.shedder.observeExport(err)
+	}
+}
+
+// CheckReadiness fails if the last export to the otel endpoint failed.
+func (otel *otelTracer) CheckReadiness(ctx context.Context) error {
+	if errPtr := otel.exportErr.Load(); errPtr != nil && *errPtr != nil {
+		return fmt.Errorf("last export to %s failed: %w", otel.options.endpoint, *errPtr)
+	}
+	return nil
+}
+
 func (otel *otelTracer) getTracer(serviceName string) (oteltrace.Tracer, error) {
 	ch := make(chan struct{})
 	defer close(ch)
@@ -134,7 +178,7 @@ func (otel *otelTracer) createTracer(serviceName string) (oteltrace.Tracer, erro
 
 	tp := otelsdktrace.NewTracerProvider(
 		otelsdktrace.WithSampler(otelsdktrace.AlwaysSample()),
-		otelsdktrace.WithBatcher(otel.exporter),
+		otelsdktrace.WithBatcher(otel.exporter, otel.options.export.batchOptions()...),
 		otelsdktrace.WithResource(resource),
 	)
 	otel.deferList.DeferContextWithLock("close otel tracer provider", func(ctx context.Context) error {
@@ -145,6 +189,12 @@ func (otel *otelTracer) createTracer(serviceName string) (oteltrace.Tracer, erro
 }
 
 func (otel *otelTracer) Start(ctx context.Context) error {
+	// the retention of spans exported to the collector is determined by its storage backend,
+	// e.g. --cassandra.span-store-ttl or the index cleaner of Elasticsearch
+	if guidance := otel.Retention.Guidance("the otel collector", "spans in its storage backend"); guidance != "" {
+		otel.Logger.Warn(guidance)
+	}
+
 	err := otel.exporter.Start(ctx)
 	if err != nil {
 		return fmt.Errorf("cannot start trace exporter: %w", err)
@@ -173,7 +223,25 @@ func (otel *otelTracer) CreateSpan(span tracer.Span) (tracer.SpanContext, error)
 		return nil, err
 	}
 
-	newCtx, otelSpan := tracer.Start(ctx, span.Name, oteltrace.WithTimestamp(span.StartTime))
+	if otel.shedder != nil {
+		if priority := classifySpan(span); !otel.shedder.admit(priority) {
+			otel.ShedMetric.With(&shedMetric{Priority: priority}).Count(1)
+			otel.Dropped.Drop(otel.Logger, dropped.StageTracer, "Shed", fmt.Errorf("shed %s span under export backpressure", priority))
+			// pseudo-spans are never shed, so nothing should be attached to a shed span;
+			// return the parent context just in case.
+			return ctx, nil
+		}
+	}
+
+	startOptions := []oteltrace.SpanStartOption{oteltrace.WithTimestamp(span.StartTime)}
+	if span.Follows != nil {
+		startOptions = appendLink(startOptions, span.Follows)
+	}
+	for _, linked := range span.Links {
+		startOptions = appendLink(startOptions, linked)
+	}
+
+	newCtx, otelSpan := tracer.Start(ctx, span.Name, startOptions...)
 	defer otelSpan.End(oteltrace.WithTimestamp(span.FinishTime))
 
 	attributes := []attribute.KeyValue{}
@@ -195,6 +263,15 @@ func (otel *otelTracer) CreateSpan(span tracer.Span) (tracer.SpanContext, error)
 	return newCtx, nil
 }
 
+func appendLink(startOptions []oteltrace.SpanStartOption, linked tracer.SpanContext) []oteltrace.SpanStartOption {
+	linkedContext := oteltrace.SpanContextFromContext(linked.(context.Context))
+	if !linkedContext.IsValid() {
+		return startOptions
+	}
+
+	return append(startOptions, oteltrace.WithLinks(oteltrace.Link{SpanContext: linkedContext}))
+}
+
 func (otel *otelTracer) InjectCarrier(spanContext tracer.SpanContext) ([]byte, error) {
 	ctx := spanContext.(context.Context)
 
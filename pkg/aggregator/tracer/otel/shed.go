@@ -0,0 +1,202 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"golang.org/x/time/rate"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+type shedOptions struct {
+	rateLimit       float64
+	burst           int
+	minRateFraction float64
+	readThreshold   float64
+	statusThreshold float64
+}
+
+func (options *shedOptions) setup(fs *pflag.FlagSet) {
+	fs.Float64Var(
+		&options.rateLimit,
+		"tracer-otel-rate-limit",
+		0,
+		"maximum number of spans per second submitted to the exporter, 0 to disable rate limiting and shedding",
+	)
+	fs.IntVar(&options.burst, "tracer-otel-rate-burst", 1000, "number of spans that can be submitted above --tracer-otel-rate-limit in a burst")
+	fs.Float64Var(
+		&options.minRateFraction,
+		"tracer-otel-rate-min-fraction",
+		0.1,
+		"the rate limit is halved after each failed export down to this fraction of --tracer-otel-rate-limit, "+
+			"and restored gradually after successful exports",
+	)
+	fs.Float64Var(
+		&options.readThreshold,
+		"tracer-otel-shed-read-threshold",
+		0.5,
+		"shed spans of read requests when less than this fraction of the burst is available",
+	)
+	fs.Float64Var(
+		&options.statusThreshold,
+		"tracer-otel-shed-status-threshold",
+		0.25,
+		"shed spans of status-only updates when less than this fraction of the burst is available",
+	)
+}
+
+// spanPriority determines the order in which spans are shed when the exporter is saturated.
+type spanPriority string
+
+const (
+	// Pseudo-spans are never shed since other spans are attached to them.
+	priorityPseudo spanPriority = "pseudo"
+	priorityNormal spanPriority = "normal"
+	priorityStatus spanPriority = "status"
+	priorityRead   spanPriority = "read"
+)
+
+var readVerbs = map[string]struct{}{"get": {}, "list": {}, "watch": {}}
+
+func classifySpan(span tracer.Span) spanPriority {
+	if _, isPseudo := span.Tags[zconstants.PseudoType]; isPseudo {
+		return priorityPseudo
+	}
+
+	if span.Tags[zconstants.TraceSource] == zconstants.TraceSourceAudit {
+		if _, isRead := readVerbs[span.Tags["tag"]]; isRead {
+			return priorityRead
+		}
+	}
+
+	if span.Tags["subresource"] == "status" {
+		return priorityStatus
+	}
+
+	return priorityNormal
+}
+
+// shedder admits spans with a token bucket whose rate adapts to the health of the exporter.
+//
+// Lower-priority spans are shed while the bucket is still partially full,
+// so that higher-priority spans still get through when the exporter cannot keep up.
+// The rate is halved after each failed export (e.g. the collector is overloaded)
+// and restored additively after successful exports.
+type shedder struct {
+	options shedOptions
+	clock   clock.Clock
+	limiter *rate.Limiter
+
+	rateLock sync.Mutex
+}
+
+func newShedder(options shedOptions, clock clock.Clock) (*shedder, error) {
+	if options.rateLimit <= 0 {
+		return nil, nil
+	}
+	if options.burst <= 0 {
+		return nil, fmt.Errorf("--tracer-otel-rate-burst must be positive")
+	}
+	if options.minRateFraction <= 0 || options.minRateFraction > 1 {
+		return nil, fmt.Errorf("--tracer-otel-rate-min-fraction must be in (0, 1]")
+	}
+
+	return &shedder{
+		options: options,
+		clock:   clock,
+		limiter: rate.NewLimiter(rate.Limit(options.rateLimit), options.burst),
+	}, nil
+}
+
+// admit returns whether the span should be submitted.
+func (shedder *shedder) admit(priority spanPriority) bool {
+	now := shedder.clock.Now()
+
+	if priority == priorityPseudo {
+		// always consume a token, even if the bucket goes into debt, so that lower-priority spans are shed instead
+		shedder.limiter.ReserveN(now, 1)
+		return true
+	}
+
+	threshold := 0.0
+	switch priority {
+	case priorityRead:
+		threshold = shedder.options.readThreshold
+	case priorityStatus:
+		threshold = shedder.options.statusThreshold
+	}
+
+	if shedder.limiter.TokensAt(now) < threshold*float64(shedder.options.burst) {
+		return false
+	}
+
+	return shedder.limiter.AllowN(now, 1)
+}
+
+func (shedder *shedder) currentLimit() float64 {
+	return float64(shedder.limiter.Limit())
+}
+
+func (shedder *shedder) observeExport(err error) {
+	shedder.rateLock.Lock()
+	defer shedder.rateLock.Unlock()
+
+	limit := float64(shedder.limiter.Limit())
+	if err != nil {
+		limit = max(limit/2, shedder.options.rateLimit*shedder.options.minRateFraction)
+	} else {
+		limit = min(limit+shedder.options.rateLimit/20, shedder.options.rateLimit)
+	}
+
+	shedder.limiter.SetLimitAt(shedder.clock.Now(), rate.Limit(limit))
+}
+
+// observedClient reports the result of each export to the tracer.
+type observedClient struct {
+	otlptrace.Client
+	observe   func(err error)
+	selfTrace *selftrace.Tracer
+}
+
+func (client observedClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	ctx, span := client.selfTrace.StartSpan(ctx, "tracer.otel.export", attribute.Int("resourceSpans", len(protoSpans)))
+	err := client.Client.UploadTraces(ctx, protoSpans)
+	selftrace.EndSpan(span, err)
+
+	client.observe(err)
+	return err
+}
+
+// rateLimitMetric is the current adaptive rate limit in spans per second.
+type rateLimitMetric struct{}
+
+func (*rateLimitMetric) MetricName() string { return "tracer_otel_rate_limit" }
+
+type shedMetric struct {
+	Priority spanPriority
+}
+
+func (*shedMetric) MetricName() string { return "tracer_otel_shed" }
@@ -0,0 +1,104 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func TestClassifySpan(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(priorityPseudo, classifySpan(tracer.Span{Tags: map[string]string{zconstants.PseudoType: "object"}}))
+	assert.Equal(priorityRead, classifySpan(tracer.Span{Tags: map[string]string{
+		zconstants.TraceSource: zconstants.TraceSourceAudit,
+		"tag":                  "get",
+	}}))
+	assert.Equal(priorityStatus, classifySpan(tracer.Span{Tags: map[string]string{
+		zconstants.TraceSource: zconstants.TraceSourceAudit,
+		"tag":                  "update",
+		"subresource":          "status",
+	}}))
+	assert.Equal(priorityNormal, classifySpan(tracer.Span{Tags: map[string]string{
+		zconstants.TraceSource: zconstants.TraceSourceAudit,
+		"tag":                  "update",
+	}}))
+}
+
+func TestShedByPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	shedder, err := newShedder(shedOptions{
+		rateLimit:       1,
+		burst:           8,
+		minRateFraction: 0.25,
+		readThreshold:   0.5,
+		statusThreshold: 0.25,
+	}, clock)
+	assert.NoError(err)
+
+	admitted := func(priority spanPriority) int {
+		count := 0
+		for i := 0; i < 10; i++ {
+			if shedder.admit(priority) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// reads are admitted until half of the burst is consumed
+	assert.Equal(5, admitted(priorityRead))
+	// status updates are admitted until a quarter of the burst remains
+	assert.Equal(2, admitted(priorityStatus))
+	// normal spans are admitted until the bucket is empty
+	assert.Equal(1, admitted(priorityNormal))
+	// pseudo-spans are always admitted
+	assert.Equal(10, admitted(priorityPseudo))
+	assert.Equal(0, admitted(priorityNormal))
+}
+
+func TestAdaptiveRate(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	shedder, err := newShedder(shedOptions{rateLimit: 100, burst: 10, minRateFraction: 0.1}, clock)
+	assert.NoError(err)
+
+	shedder.observeExport(errors.New("unavailable"))
+	assert.Equal(50.0, shedder.currentLimit())
+
+	for i := 0; i < 5; i++ {
+		shedder.observeExport(errors.New("unavailable"))
+	}
+	assert.Equal(10.0, shedder.currentLimit())
+
+	shedder.observeExport(nil)
+	assert.Equal(15.0, shedder.currentLimit())
+
+	for i := 0; i < 100; i++ {
+		shedder.observeExport(nil)
+	}
+	assert.Equal(100.0, shedder.currentLimit())
+}
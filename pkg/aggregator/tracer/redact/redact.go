@@ -0,0 +1,389 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Redacts sensitive span tags and log contents right before spans are exported,
+// so that a single policy applies to the output of all decorators.
+package redact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("redact", manager.Ptr(&Redactor{}))
+}
+
+// Placeholder replaces stripped values.
+const Placeholder = "[redacted]"
+
+// valuePresets are named patterns for common sensitive values.
+var valuePresets = map[string]string{
+	"email":        `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	"ipv4":         `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`,
+	"bearer-token": `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,
+	"jwt":          `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+}
+
+// keyPresets are named patterns for tag and log attribute keys whose whole value is sensitive.
+var keyPresets = map[string]string{
+	"credential-keys": `(?i)(token|password|passwd|secret|credential|api[-_]?key)`,
+}
+
+// defaultExemptTags identify the object of a span and must stay intact for the frontend to assemble traces.
+var defaultExemptTags = []string{
+	"cluster", "group", "version", "resource", "namespace", "name",
+	zconstants.LinkedObjectCluster, zconstants.LinkedObjectGroup, zconstants.LinkedObjectResource,
+	zconstants.LinkedObjectNamespace, zconstants.LinkedObjectName, zconstants.LinkRole, zconstants.LinkClass,
+}
+
+type options struct {
+	enable        bool
+	presets       []string
+	valuePatterns []string
+	keyPatterns   []string
+	celRules      []string
+	action        string
+	hashSaltFile  string
+	exemptTags    []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "redact-enable", false, "redact span tags and logs matching the redaction rules before exporting spans")
+
+	presetNames := make([]string, 0, len(valuePresets)+len(keyPresets))
+	for name := range valuePresets {
+		presetNames = append(presetNames, name)
+	}
+	for name := range keyPresets {
+		presetNames = append(presetNames, name)
+	}
+	sort.Strings(presetNames)
+
+	fs.StringSliceVar(
+		&options.presets,
+		"redact-preset",
+		[]string{"bearer-token", "jwt", "credential-keys"},
+		fmt.Sprintf("built-in redaction rules to apply, out of %s", strings.Join(presetNames, ", ")),
+	)
+	fs.StringArrayVar(
+		&options.valuePatterns,
+		"redact-value-pattern",
+		[]string{},
+		"redact substrings of tag values and log contents matching a regular expression, in the form 'ruleName=regex'. "+
+			"Can be specified multiple times",
+	)
+	fs.StringArrayVar(
+		&options.keyPatterns,
+		"redact-key-pattern",
+		[]string{},
+		"redact the whole value of tags and log attributes whose key matches a regular expression, in the form 'ruleName=regex'. "+
+			"Can be specified multiple times",
+	)
+	fs.StringArrayVar(
+		&options.celRules,
+		"redact-cel",
+		[]string{},
+		"redact the whole value of tags, log attributes and log messages for which a CEL expression returns true, "+
+			"in the form 'ruleName=expression'. The expression can access 'spanType', 'key' ('message' for log messages) and 'value'. "+
+			`e.g. 'annotations=key.startsWith("annotation/") && value.size() > 1024'`,
+	)
+	fs.StringVar(
+		&options.action,
+		"redact-action",
+		"strip",
+		"'strip' to remove redacted values, or 'hash' to replace them with a keyed hash so that equal values remain correlatable",
+	)
+	fs.StringVar(&options.hashSaltFile, "redact-hash-salt-file", "", "file containing the secret key of --redact-action=hash")
+	fs.StringSliceVar(
+		&options.exemptTags,
+		"redact-exempt-tags",
+		defaultExemptTags,
+		"tags never redacted because the frontend needs them; tags prefixed with "+zconstants.Prefix+" are always exempt",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if !options.enable {
+		return nil
+	}
+	switch options.action {
+	case "strip":
+	case "hash":
+		if options.hashSaltFile == "" {
+			return fmt.Errorf("--redact-hash-salt-file is required with --redact-action=hash")
+		}
+	default:
+		return fmt.Errorf("--redact-action must be 'strip' or 'hash'")
+	}
+	return nil
+}
+
+// Redactor redacts span contents. All methods return the input unchanged if redaction is disabled.
+type Redactor struct {
+	options options
+	Logger  logrus.FieldLogger
+
+	MatchMetric *metrics.Metric[*matchMetric]
+
+	valueRules []patternRule
+	keyRules   []patternRule
+	celRules   []celRule
+	exempt     sets.Set[string]
+	salt       []byte
+}
+
+type matchMetric struct {
+	Rule     string
+	SpanType string
+}
+
+func (*matchMetric) MetricName() string { return "redact_match" }
+
+type patternRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+type celRule struct {
+	name    string
+	program cel.Program
+}
+
+var _ manager.Component = &Redactor{}
+
+func (redactor *Redactor) Options() manager.Options { return &redactor.options }
+
+func (redactor *Redactor) Init() error {
+	if !redactor.options.enable {
+		return nil
+	}
+
+	for _, preset := range redactor.options.presets {
+		if pattern, ok := valuePresets[preset]; ok {
+			redactor.valueRules = append(redactor.valueRules, patternRule{name: preset, pattern: regexp.MustCompile(pattern)})
+		} else if pattern, ok := keyPresets[preset]; ok {
+			redactor.keyRules = append(redactor.keyRules, patternRule{name: preset, pattern: regexp.MustCompile(pattern)})
+		} else {
+			return fmt.Errorf("unknown --redact-preset %q", preset)
+		}
+	}
+
+	valueRules, err := parsePatternRules(redactor.options.valuePatterns)
+	if err != nil {
+		return fmt.Errorf("invalid --redact-value-pattern: %w", err)
+	}
+	redactor.valueRules = append(redactor.valueRules, valueRules...)
+
+	keyRules, err := parsePatternRules(redactor.options.keyPatterns)
+	if err != nil {
+		return fmt.Errorf("invalid --redact-key-pattern: %w", err)
+	}
+	redactor.keyRules = append(redactor.keyRules, keyRules...)
+
+	redactor.celRules, err = parseCelRules(redactor.options.celRules)
+	if err != nil {
+		return fmt.Errorf("invalid --redact-cel: %w", err)
+	}
+
+	redactor.exempt = sets.New(redactor.options.exemptTags...)
+
+	if redactor.options.action == "hash" {
+		salt, err := os.ReadFile(redactor.options.hashSaltFile)
+		if err != nil {
+			return fmt.Errorf("cannot read --redact-hash-salt-file: %w", err)
+		}
+		redactor.salt = []byte(strings.TrimSpace(string(salt)))
+	}
+
+	return nil
+}
+
+func (redactor *Redactor) Start(ctx context.Context) error { return nil }
+func (redactor *Redactor) Close(ctx context.Context) error { return nil }
+
+func parsePatternRules(specs []string) ([]patternRule, error) {
+	rules := make([]patternRule, 0, len(specs))
+	for _, spec := range specs {
+		name, expr, ok := strings.Cut(spec, "=")
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("expected 'ruleName=regex', got %q", spec)
+		}
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for rule %q: %w", name, err)
+		}
+		rules = append(rules, patternRule{name: name, pattern: pattern})
+	}
+	return rules, nil
+}
+
+func parseCelRules(specs []string) ([]celRule, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("spanType", cel.StringType),
+		cel.Variable("key", cel.StringType),
+		cel.Variable("value", cel.StringType),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create CEL environment: %w", err)
+	}
+
+	rules := make([]celRule, 0, len(specs))
+	for _, spec := range specs {
+		name, expr, ok := strings.Cut(spec, "=")
+		if !ok || name == "" || expr == "" {
+			return nil, fmt.Errorf("expected 'ruleName=expression', got %q", spec)
+		}
+
+		ast, issues := env.Compile(expr)
+		if issues.Err() != nil {
+			return nil, fmt.Errorf("invalid CEL expression for rule %q: %w", name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return nil, fmt.Errorf("CEL expression for rule %q must return a bool", name)
+		}
+
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CEL expression for rule %q: %w", name, err)
+		}
+		rules = append(rules, celRule{name: name, program: program})
+	}
+	return rules, nil
+}
+
+// Enabled returns whether redaction is enabled.
+func (redactor *Redactor) Enabled() bool { return redactor.options.enable }
+
+// RedactTags returns a copy of the span tags with sensitive values redacted.
+func (redactor *Redactor) RedactTags(spanType string, tags map[string]string) map[string]string {
+	if !redactor.options.enable || tags == nil {
+		return tags
+	}
+
+	output := make(map[string]string, len(tags))
+	for key, value := range tags {
+		if redactor.isExempt(key) {
+			output[key] = value
+			continue
+		}
+
+		if value, keep := redactor.redact(spanType, key, value); keep {
+			output[key] = value
+		}
+	}
+	return output
+}
+
+// RedactLog returns the log message and a copy of the log attributes with sensitive values redacted.
+func (redactor *Redactor) RedactLog(spanType string, message string, attrs [][2]string) (string, [][2]string) {
+	if !redactor.options.enable {
+		return message, attrs
+	}
+
+	message, keep := redactor.redact(spanType, "message", message)
+	if !keep {
+		message = Placeholder
+	}
+
+	outputAttrs := make([][2]string, 0, len(attrs))
+	for _, attr := range attrs {
+		if strings.HasPrefix(attr[0], zconstants.Prefix) {
+			outputAttrs = append(outputAttrs, attr)
+			continue
+		}
+
+		if value, keep := redactor.redact(spanType, attr[0], attr[1]); keep {
+			outputAttrs = append(outputAttrs, [2]string{attr[0], value})
+		}
+	}
+
+	return message, outputAttrs
+}
+
+func (redactor *Redactor) isExempt(key string) bool {
+	return strings.HasPrefix(key, zconstants.Prefix) || redactor.exempt.Has(key)
+}
+
+// redact returns the redacted value, or false if the value should be stripped entirely.
+func (redactor *Redactor) redact(spanType string, key string, value string) (string, bool) {
+	for _, rule := range redactor.keyRules {
+		if rule.pattern.MatchString(key) {
+			return redactor.redactWhole(rule.name, spanType, value)
+		}
+	}
+
+	for _, rule := range redactor.celRules {
+		output, _, err := rule.program.Eval(map[string]any{"spanType": spanType, "key": key, "value": value})
+		if err == nil && output == types.True {
+			return redactor.redactWhole(rule.name, spanType, value)
+		}
+	}
+
+	for _, rule := range redactor.valueRules {
+		matched := false
+		value = rule.pattern.ReplaceAllStringFunc(value, func(match string) string {
+			matched = true
+			return redactor.replacement(match)
+		})
+		if matched {
+			redactor.MatchMetric.With(&matchMetric{Rule: rule.name, SpanType: spanType}).Count(1)
+		}
+	}
+
+	return value, true
+}
+
+func (redactor *Redactor) redactWhole(rule string, spanType string, value string) (string, bool) {
+	redactor.MatchMetric.With(&matchMetric{Rule: rule, SpanType: spanType}).Count(1)
+
+	if redactor.options.action == "hash" {
+		return redactor.replacement(value), true
+	}
+	return "", false
+}
+
+func (redactor *Redactor) replacement(value string) string {
+	if redactor.options.action != "hash" {
+		return Placeholder
+	}
+
+	mac := hmac.New(sha256.New, redactor.salt)
+	mac.Write([]byte(value))
+	return "hash:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redact
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func newTestRedactor(t *testing.T, options options) *Redactor {
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	options.enable = true
+	if options.action == "" {
+		options.action = "strip"
+	}
+	if options.exemptTags == nil {
+		options.exemptTags = defaultExemptTags
+	}
+
+	redactor := &Redactor{
+		options:     options,
+		Logger:      logger,
+		MatchMetric: metrics.New[*matchMetric](metricsClient),
+	}
+	assert.NoError(t, redactor.options.Validate())
+	assert.NoError(t, redactor.Init())
+	return redactor
+}
+
+func TestRedactTags(t *testing.T) {
+	assert := assert.New(t)
+
+	redactor := newTestRedactor(t, options{
+		presets:       []string{"email", "bearer-token", "credential-keys"},
+		valuePatterns: []string{"ssn=\\d{3}-\\d{2}-\\d{4}"},
+		celRules:      []string{`large=key.startsWith("annotation/") && value.size() > 8`},
+	})
+
+	tags := map[string]string{
+		"name":                  "alice@example.com",
+		zconstants.SpanName:     "alice@example.com",
+		"userAgent":             "kubectl by alice@example.com",
+		"authorization":         "Bearer abc.def",
+		"serviceAccountToken":   "abc",
+		"note":                  "ssn 123-45-6789",
+		"annotation/small":      "short",
+		"annotation/last-apply": "a very long value",
+	}
+	output := redactor.RedactTags("object", tags)
+
+	assert.Equal(map[string]string{
+		"name":              "alice@example.com",
+		zconstants.SpanName: "alice@example.com",
+		"userAgent":         "kubectl by " + Placeholder,
+		"authorization":     Placeholder,
+		"note":              "ssn " + Placeholder,
+		"annotation/small":  "short",
+	}, output)
+
+	// the input map is not modified
+	assert.Equal("abc", tags["serviceAccountToken"])
+}
+
+func TestRedactLog(t *testing.T) {
+	assert := assert.New(t)
+
+	redactor := newTestRedactor(t, options{
+		presets:  []string{"ipv4", "credential-keys"},
+		celRules: []string{`secrets=spanType == "secret" && key == "message"`},
+	})
+
+	message, attrs := redactor.RedactLog("object", "request from 10.0.0.1", [][2]string{
+		{zconstants.Prefix + "source", "10.0.0.2"},
+		{"password", "hunter2"},
+		{"peer", "192.168.1.1:443"},
+	})
+	assert.Equal("request from "+Placeholder, message)
+	assert.Equal([][2]string{
+		{zconstants.Prefix + "source", "10.0.0.2"},
+		{"peer", Placeholder + ":443"},
+	}, attrs)
+
+	message, _ = redactor.RedactLog("secret", "data: c2VjcmV0", nil)
+	assert.Equal(Placeholder, message)
+}
+
+func TestRedactHash(t *testing.T) {
+	assert := assert.New(t)
+
+	saltFile := filepath.Join(t.TempDir(), "salt")
+	assert.NoError(os.WriteFile(saltFile, []byte("salt\n"), 0o600))
+
+	redactor := newTestRedactor(t, options{
+		presets:      []string{"email", "credential-keys"},
+		action:       "hash",
+		hashSaltFile: saltFile,
+	})
+
+	output := redactor.RedactTags("object", map[string]string{
+		"user":   "alice@example.com",
+		"owner":  "alice@example.com",
+		"token":  "abc",
+		"client": "bob@example.com",
+	})
+
+	// equal values hash equally so that they remain correlatable
+	assert.True(strings.HasPrefix(output["user"], "hash:"))
+	assert.Equal(output["user"], output["owner"])
+	assert.NotEqual(output["user"], output["client"])
+	assert.True(strings.HasPrefix(output["token"], "hash:"))
+}
+
+func TestDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	redactor := &Redactor{}
+	tags := map[string]string{"token": "abc"}
+	assert.Equal(tags, redactor.RedactTags("object", tags))
+
+	message, attrs := redactor.RedactLog("object", "alice@example.com", nil)
+	assert.Equal("alice@example.com", message)
+	assert.Nil(attrs)
+}
@@ -0,0 +1,255 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/util/checkpoint"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+// spanWindow identifies the time window of the pseudospans of an object.
+// All pseudospans of an object in the same window belong to the same trace.
+type spanWindow struct {
+	// The index of the window, i.e. the start of the window in units of ttl since the epoch.
+	index int64
+	ttl   time.Duration
+}
+
+func (window spanWindow) start() time.Time {
+	return time.Unix(window.index*int64(window.ttl.Seconds()), 0)
+}
+
+func (window spanWindow) finish() time.Time {
+	return window.start().Add(window.ttl)
+}
+
+func parseTtlOverrides(overrides map[string]string) (map[schema.GroupResource]time.Duration, error) {
+	output := make(map[schema.GroupResource]time.Duration, len(overrides))
+	for gr, value := range overrides {
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid span TTL for %q: %w", gr, err)
+		}
+		if ttl < time.Second {
+			return nil, fmt.Errorf("span TTL for %q must be at least 1s", gr)
+		}
+
+		output[schema.ParseGroupResource(gr)] = ttl
+	}
+	return output, nil
+}
+
+func (agg *aggregator) spanTtl(object utilobject.Key) time.Duration {
+	if ttl, exists := agg.ttlOverrides[schema.GroupResource{Group: object.Group, Resource: object.Resource}]; exists {
+		return ttl
+	}
+	return agg.options.spanTtl
+}
+
+// cacheTtl is the duration for which a pseudospan of the given window remains in the span cache.
+func (agg *aggregator) cacheTtl(window spanWindow) time.Duration {
+	ttl := window.ttl + agg.options.spanExtraTtl
+	if agg.options.activityIdle > 0 && agg.options.activityMaxDuration > window.ttl {
+		// extended windows continue to reuse the pseudospans created at the start of the window
+		ttl += agg.options.activityMaxDuration - window.ttl
+	}
+	return ttl
+}
+
+// resolveWindow determines the window of the pseudospans of an object for an event at eventTime,
+// and the window that precedes it in the history of the object.
+func (agg *aggregator) resolveWindow(object utilobject.Key, eventTime time.Time) (window spanWindow, previous spanWindow) {
+	ttl := agg.spanTtl(object)
+	window = spanWindow{index: eventTime.Unix() / int64(ttl.Seconds()), ttl: ttl}
+	previous = spanWindow{index: window.index - 1, ttl: ttl}
+
+	if agg.options.activityIdle <= 0 {
+		return window, previous
+	}
+
+	return agg.activity.extend(object, eventTime, window, previous, agg.options.activityIdle, agg.options.activityMaxDuration)
+}
+
+// activityTracker tracks the latest activity of each object, so that a window is extended
+// while events of the object keep arriving, up to a maximum duration.
+//
+// The activity is tracked in memory and optionally checkpointed to a local file.
+// Events of the same object should be delivered to the same replica
+// (e.g. partitioning the queue by object) for windows to be extended consistently.
+type activityTracker struct {
+	mu      sync.Mutex
+	objects map[utilobject.Key]*objectActivity
+}
+
+type objectActivity struct {
+	window       spanWindow
+	previous     spanWindow
+	lastActivity time.Time
+}
+
+func (tracker *activityTracker) extend(
+	object utilobject.Key,
+	eventTime time.Time,
+	window spanWindow,
+	previous spanWindow,
+	idle time.Duration,
+	maxDuration time.Duration,
+) (spanWindow, spanWindow) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	activity, exists := tracker.objects[object]
+	if !exists {
+		tracker.objects[object] = &objectActivity{window: window, previous: previous, lastActivity: eventTime}
+		return window, previous
+	}
+
+	if activity.window.ttl == window.ttl &&
+		activity.window.index < window.index &&
+		eventTime.Before(activity.lastActivity.Add(idle)) &&
+		eventTime.Sub(activity.window.start()) < maxDuration {
+		// the object is still active since the previous window, continue the previous trace
+		window, previous = activity.window, activity.previous
+	} else if window.index == activity.window.index {
+		previous = activity.previous
+	}
+
+	if window.index > activity.window.index {
+		// the extended window may have covered indices before window.index - 1
+		if activity.window.ttl == window.ttl {
+			previous = activity.window
+		}
+		activity.window, activity.previous = window, previous
+	}
+	if eventTime.After(activity.lastActivity) {
+		activity.lastActivity = eventTime
+	}
+
+	return window, previous
+}
+
+// prune removes objects inactive since before the given time.
+func (tracker *activityTracker) prune(before time.Time) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	for object, activity := range tracker.objects {
+		if activity.lastActivity.Before(before) {
+			delete(tracker.objects, object)
+		}
+	}
+}
+
+func (agg *aggregator) runActivityPruner(ctx context.Context) {
+	ticker := agg.Clock.Tick(agg.options.activityIdle)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker:
+			agg.activity.prune(now.Add(-agg.options.activityIdle))
+		}
+	}
+}
+
+// activityCheckpoint is the persisted form of the activity of an object.
+type activityCheckpoint struct {
+	Object       utilobject.Key `json:"object"`
+	Ttl          time.Duration  `json:"ttl"`
+	Window       int64          `json:"window"`
+	Previous     int64          `json:"previous"`
+	LastActivity time.Time      `json:"lastActivity"`
+}
+
+func (tracker *activityTracker) snapshot() []activityCheckpoint {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	output := make([]activityCheckpoint, 0, len(tracker.objects))
+	for object, activity := range tracker.objects {
+		output = append(output, activityCheckpoint{
+			Object:       object,
+			Ttl:          activity.window.ttl,
+			Window:       activity.window.index,
+			Previous:     activity.previous.index,
+			LastActivity: activity.lastActivity,
+		})
+	}
+	return output
+}
+
+// restore adds the checkpointed activities active since the given time.
+func (tracker *activityTracker) restore(checkpoints []activityCheckpoint, since time.Time) int {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	restored := 0
+	for _, item := range checkpoints {
+		if item.LastActivity.Before(since) || item.Ttl < time.Second {
+			continue
+		}
+		if _, exists := tracker.objects[item.Object]; exists {
+			continue
+		}
+
+		tracker.objects[item.Object] = &objectActivity{
+			window:       spanWindow{index: item.Window, ttl: item.Ttl},
+			previous:     spanWindow{index: item.Previous, ttl: item.Ttl},
+			lastActivity: item.LastActivity,
+		}
+		restored++
+	}
+	return restored
+}
+
+func (agg *aggregator) checkpointActivity() {
+	if err := checkpoint.Write(agg.options.activityCheckpoint, agg.activity.snapshot()); err != nil {
+		agg.Logger.WithError(err).Warn("cannot checkpoint activity windows")
+	}
+}
+
+func (agg *aggregator) restoreActivity() {
+	var checkpoints []activityCheckpoint
+	found, err := checkpoint.Read(agg.options.activityCheckpoint, &checkpoints)
+	if err != nil {
+		agg.Logger.WithError(err).Warn("cannot restore activity windows from checkpoint")
+		return
+	}
+	if !found {
+		return
+	}
+
+	restored := agg.activity.restore(checkpoints, agg.Clock.Now().Add(-agg.options.activityIdle))
+	agg.Logger.WithField("objects", restored).Info("restored activity windows from checkpoint")
+}
+
+func (agg *aggregator) runActivityCheckpointer(ctx context.Context) {
+	ticker := agg.Clock.Tick(agg.options.checkpointInterval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker:
+			agg.checkpointActivity()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func TestActivityTrackerExtend(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := activityTracker{objects: map[utilobject.Key]*objectActivity{}}
+	object := utilobject.Key{Cluster: "test", Group: "apps", Resource: "deployments", Namespace: "default", Name: "foo"}
+
+	ttl := time.Minute * 30
+	idle := time.Minute * 5
+	maxDuration := time.Hour * 2
+
+	base := time.Unix(0, 0).Add(time.Hour * 100)
+	resolve := func(eventTime time.Time) int64 {
+		window := spanWindow{index: eventTime.Unix() / int64(ttl.Seconds()), ttl: ttl}
+		previous := spanWindow{index: window.index - 1, ttl: ttl}
+		window, _ = tracker.extend(object, eventTime, window, previous, idle, maxDuration)
+		return window.index
+	}
+
+	first := resolve(base.Add(time.Minute * 20))
+	assert.Equal(base.Unix()/int64(ttl.Seconds()), first)
+
+	// continuous activity across window boundaries stays in the first window
+	assert.Equal(first, resolve(base.Add(time.Minute*24)))
+	assert.Equal(first, resolve(base.Add(time.Minute*28)))
+	assert.Equal(first, resolve(base.Add(time.Minute*32)))
+	assert.Equal(first, resolve(base.Add(time.Minute*36)))
+
+	// out-of-order events within the extended window are unaffected
+	assert.Equal(first, resolve(base.Add(time.Minute*25)))
+
+	// after idling, a new window starts, preceded by the extended window
+	second := resolve(base.Add(time.Minute * 70))
+	assert.Equal(first+2, second)
+	window, previous := tracker.extend(
+		object,
+		base.Add(time.Minute*71),
+		spanWindow{index: second, ttl: ttl},
+		spanWindow{index: second - 1, ttl: ttl},
+		idle,
+		maxDuration,
+	)
+	assert.Equal(second, window.index)
+	assert.Equal(first, previous.index)
+
+	// activity cannot extend a window beyond the maximum duration
+	eventTime := base.Add(time.Minute * 71)
+	for eventTime.Sub(base.Add(time.Hour)) < maxDuration+time.Minute*30 {
+		eventTime = eventTime.Add(time.Minute * 4)
+		resolve(eventTime)
+	}
+	assert.Greater(resolve(eventTime.Add(time.Minute)), second)
+}
+
+func TestActivityTrackerRestore(t *testing.T) {
+	assert := assert.New(t)
+
+	ttl := time.Minute * 30
+	base := time.Unix(0, 0).Add(time.Hour * 100)
+	active := utilobject.Key{Cluster: "test", Resource: "pods", Namespace: "default", Name: "active"}
+	idle := utilobject.Key{Cluster: "test", Resource: "pods", Namespace: "default", Name: "idle"}
+
+	tracker := activityTracker{objects: map[utilobject.Key]*objectActivity{}}
+	tracker.objects[active] = &objectActivity{
+		window:       spanWindow{index: 10, ttl: ttl},
+		previous:     spanWindow{index: 8, ttl: ttl},
+		lastActivity: base,
+	}
+	tracker.objects[idle] = &objectActivity{
+		window:       spanWindow{index: 10, ttl: ttl},
+		previous:     spanWindow{index: 9, ttl: ttl},
+		lastActivity: base.Add(-time.Hour),
+	}
+
+	restored := activityTracker{objects: map[utilobject.Key]*objectActivity{}}
+	assert.Equal(1, restored.restore(tracker.snapshot(), base.Add(-time.Minute*5)))
+	assert.Equal(tracker.objects[active], restored.objects[active])
+	assert.NotContains(restored.objects, idle)
+}
@@ -103,5 +103,35 @@ func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]l
 		}}, nil
 	}
 
+	if ann, ok := raw.GetAnnotations()[ParentAnnotation]; ok {
+		ref, err := ParseParentRef(ann)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot parse parent annotation: %w", err), "ParseAnnotation")
+		}
+
+		if ref.Cluster == "" {
+			ref.Cluster = object.Cluster
+		}
+
+		cdc, err := ctrl.DiscoveryCache.ForCluster(ref.Cluster)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot get discovery cache for cluster %q: %w", ref.Cluster, err), "DiscoveryCache")
+		}
+
+		gvr, exists := cdc.LookupResource(ref.GroupVersionKind)
+		if !exists {
+			return nil, metrics.LabelError(fmt.Errorf("parent annotation refers to unknown GVK %v", ref.GroupVersionKind), "UnknownParentKind")
+		}
+
+		objectRef := utilobject.NewRich(ref.Cluster, gvr, ref.Namespace, ref.Name, "")
+		logger.WithFields(objectRef.AsFields("parent")).Debug("Resolved parent")
+
+		return []linker.LinkerResult{{
+			Object:  objectRef,
+			Role:    zconstants.LinkRoleParent,
+			DedupId: "annotation",
+		}}, nil
+	}
+
 	return nil, nil
 }
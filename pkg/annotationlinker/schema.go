@@ -15,7 +15,12 @@
 package annotationlinker
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
@@ -49,3 +54,69 @@ func (ln ParentLink) ToRich() utilobject.Rich {
 		Uid: ln.Uid,
 	}
 }
+
+// ParentAnnotation declares the logical parent of an object in the compact form
+// `group/version/Kind/namespace/name[@cluster]`.
+// The group is omitted for the core group (e.g. `v1/ConfigMap/ns/name`),
+// and the namespace is omitted for cluster-scoped parents (e.g. `v1/Node/name`).
+// The parent is in the same cluster as the object if the cluster is omitted.
+const ParentAnnotation = "kelemetry.kubewharf.io/parent"
+
+// ParentRef is the parsed value of ParentAnnotation.
+type ParentRef struct {
+	Cluster string
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+func ParseParentRef(value string) (ParentRef, error) {
+	ref := ParentRef{}
+
+	if at := strings.LastIndexByte(value, '@'); at != -1 {
+		ref.Cluster = value[at+1:]
+		value = value[:at]
+		if ref.Cluster == "" {
+			return ParentRef{}, fmt.Errorf("empty cluster name after '@'")
+		}
+	}
+
+	segments := strings.Split(value, "/")
+
+	// Groups and versions are always lowercase, so the first segment starting with an uppercase letter is the kind.
+	kindIndex := -1
+	for i, segment := range segments {
+		if segment != "" && unicode.IsUpper(rune(segment[0])) {
+			kindIndex = i
+			break
+		}
+	}
+
+	switch kindIndex {
+	case 1:
+		ref.Version = segments[0]
+	case 2:
+		ref.Group = segments[0]
+		ref.Version = segments[1]
+	default:
+		return ParentRef{}, fmt.Errorf("expected group/version/Kind or version/Kind prefix in %q", value)
+	}
+
+	ref.Kind = segments[kindIndex]
+
+	switch rest := segments[kindIndex+1:]; len(rest) {
+	case 1:
+		ref.Name = rest[0]
+	case 2:
+		ref.Namespace = rest[0]
+		ref.Name = rest[1]
+	default:
+		return ParentRef{}, fmt.Errorf("expected namespace/name or name after kind in %q", value)
+	}
+
+	if ref.Version == "" || ref.Name == "" || (kindIndex == 2 && ref.Group == "") {
+		return ParentRef{}, fmt.Errorf("empty segment in %q", value)
+	}
+
+	return ref, nil
+}
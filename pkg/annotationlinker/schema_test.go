@@ -0,0 +1,81 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotationlinker_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/annotationlinker"
+)
+
+func TestParseParentRef(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		value    string
+		expected annotationlinker.ParentRef
+	}{
+		{
+			name:  "namespaced",
+			value: "apps/v1/Deployment/ns/name",
+			expected: annotationlinker.ParentRef{
+				GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace:        "ns",
+				Name:             "name",
+			},
+		},
+		{
+			name:  "core cluster-scoped",
+			value: "v1/Node/node-1",
+			expected: annotationlinker.ParentRef{
+				GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Node"},
+				Name:             "node-1",
+			},
+		},
+		{
+			name:  "with cluster",
+			value: "example.com/v1alpha1/Widget/ns/name@host",
+			expected: annotationlinker.ParentRef{
+				Cluster:          "host",
+				GroupVersionKind: schema.GroupVersionKind{Group: "example.com", Version: "v1alpha1", Kind: "Widget"},
+				Namespace:        "ns",
+				Name:             "name",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ref, err := annotationlinker.ParseParentRef(tc.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ref)
+		})
+	}
+}
+
+func TestParseParentRefInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"apps/v1/deployment/ns/name",
+		"Deployment/ns/name",
+		"apps/v1/Deployment",
+		"apps/v1/Deployment/a/b/c",
+		"apps/v1/Deployment/ns/name@",
+		"/v1/Deployment/ns/name",
+	} {
+		_, err := annotationlinker.ParseParentRef(value)
+		assert.Error(t, err, value)
+	}
+}
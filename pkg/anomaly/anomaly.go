@@ -0,0 +1,46 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Flags statistically unusual activity in audit events.
+//
+// Detectors are registered as implementations of Detector.
+// Audit spans matched by any detector are tagged with the detector names,
+// and findings are optionally posted to a webhook.
+package anomaly
+
+import (
+	"time"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+)
+
+// Detector observes audit events of successful write requests in order of arrival.
+type Detector interface {
+	// Name is the value used in the anomaly tag of flagged spans.
+	Name() string
+
+	// Observe records the audit event and returns findings if the event is anomalous.
+	// eventTime is the timestamp of the audit span.
+	Observe(message *audit.Message, eventTime time.Time) []Finding
+}
+
+type Finding struct {
+	// Name of the detector that reported the finding.
+	Detector string `json:"detector"`
+	// Identifies the anomalous subject, e.g. the object or namespace.
+	// Notifications for the same detector and subject are deduplicated.
+	Subject string `json:"subject"`
+	// Human-readable description of the anomaly.
+	Summary string `json:"summary"`
+}
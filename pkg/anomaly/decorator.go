@@ -0,0 +1,106 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomaly
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("anomaly-decorator", manager.Ptr(&decorator{}), &manager.List[audit.Decorator]{})
+}
+
+var writeVerbs = map[string]struct{}{
+	audit.VerbCreate:   {},
+	audit.VerbUpdate:   {},
+	audit.VerbPatch:    {},
+	audit.VerbDelete:   {},
+	"deletecollection": {},
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "anomaly-enable", false, "tag audit spans of unusual object activity reported by anomaly detectors")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Detectors *manager.List[Detector]
+	Notifier  *Notifier
+
+	FindingMetric *metrics.Metric[*findingMetric]
+}
+
+type findingMetric struct {
+	Cluster  string
+	Detector string
+}
+
+func (*findingMetric) MetricName() string { return "anomaly_finding" }
+
+var _ manager.Component = &decorator{}
+
+func (d *decorator) Options() manager.Options        { return &d.options }
+func (d *decorator) Init() error                     { return nil }
+func (d *decorator) Start(ctx context.Context) error { return nil }
+func (d *decorator) Close(ctx context.Context) error { return nil }
+
+func (d *decorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	if _, isWrite := writeVerbs[message.Verb]; !isWrite || message.ObjectRef == nil {
+		return
+	}
+	if message.ResponseStatus == nil || message.ResponseStatus.Code >= 300 {
+		return
+	}
+
+	var names []string
+
+	for _, detector := range d.Detectors.Impls {
+		findings := detector.Observe(message, event.Time)
+		if len(findings) == 0 {
+			continue
+		}
+
+		names = append(names, detector.Name())
+
+		for _, finding := range findings {
+			d.FindingMetric.With(&findingMetric{Cluster: message.Cluster, Detector: finding.Detector}).Count(1)
+			event.Log(zconstants.LogTypeRealVerbose, finding.Summary)
+			d.Notifier.Notify(message, finding)
+		}
+	}
+
+	if len(names) > 0 {
+		event.SetTag("anomaly", strings.Join(names, ","))
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomalydetector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	anomalydetector "github.com/kubewharf/kelemetry/pkg/anomaly/detector"
+)
+
+func TestWindowCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	wc := anomalydetector.NewWindowCounter(time.Minute, 0.5)
+	rule := anomalydetector.SurgeRule{MinCount: 5, Factor: 3}
+
+	for i := 0; i < 4; i++ {
+		count, _, hasBaseline := wc.Add("a", base.Add(time.Second*time.Duration(i)))
+		assert.Equal(i+1, count)
+		assert.False(hasBaseline)
+	}
+
+	// no baseline yet, so exceeding the minimum count is a surge
+	assert.True(rule.IsSurge(wc.Add("a", base.Add(time.Second*5))))
+
+	// next window: baseline is 5
+	for i := 0; i < 15; i++ {
+		count, baseline, hasBaseline := wc.Add("a", base.Add(time.Minute+time.Second*time.Duration(i)))
+		assert.True(hasBaseline)
+		assert.InDelta(5, baseline, 1e-9)
+		assert.False(rule.IsSurge(count, baseline, hasBaseline))
+	}
+	assert.True(rule.IsSurge(wc.Add("a", base.Add(time.Minute+time.Second*20))))
+
+	// two windows later: baseline = (0.5*16 + 0.5*5) * 0.5
+	_, baseline, _ := wc.Add("a", base.Add(time.Minute*3))
+	assert.InDelta(5.25, baseline, 1e-9)
+
+	// keys are independent
+	count, _, hasBaseline := wc.Add("b", base.Add(time.Minute*3))
+	assert.Equal(1, count)
+	assert.False(hasBaseline)
+}
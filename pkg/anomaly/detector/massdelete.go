@@ -0,0 +1,100 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomalydetector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/anomaly"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("anomaly-mass-deletion", manager.Ptr(&massDeletion{}), &manager.List[anomaly.Detector]{})
+}
+
+type massDeletionOptions struct {
+	enable   bool
+	window   time.Duration
+	minCount int
+	factor   float64
+}
+
+func (options *massDeletionOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "anomaly-mass-deletion-enable", true, "flag namespaces with an unusually large number of deletions")
+	fs.DurationVar(&options.window, "anomaly-mass-deletion-window", time.Minute, "window over which deletions in a namespace are counted")
+	fs.IntVar(&options.minCount, "anomaly-mass-deletion-min-count", 50, "minimum number of deletions in a window to be considered a mass deletion")
+	fs.Float64Var(
+		&options.factor,
+		"anomaly-mass-deletion-factor",
+		5,
+		"a namespace is flagged if its deletions in a window exceed its moving average by this factor",
+	)
+}
+
+func (options *massDeletionOptions) EnableFlag() *bool { return &options.enable }
+
+type massDeletion struct {
+	options massDeletionOptions
+
+	counter *WindowCounter
+	rule    SurgeRule
+}
+
+var _ manager.Component = &massDeletion{}
+
+func (detector *massDeletion) Options() manager.Options { return &detector.options }
+
+func (detector *massDeletion) Init() error {
+	if detector.options.window <= 0 {
+		return fmt.Errorf("--anomaly-mass-deletion-window must be positive")
+	}
+
+	detector.counter = NewWindowCounter(detector.options.window, 0.3)
+	detector.rule = SurgeRule{MinCount: detector.options.minCount, Factor: detector.options.factor}
+	return nil
+}
+
+func (detector *massDeletion) Start(ctx context.Context) error { return nil }
+func (detector *massDeletion) Close(ctx context.Context) error { return nil }
+
+func (detector *massDeletion) Name() string { return "massDeletion" }
+
+func (detector *massDeletion) Observe(message *audit.Message, eventTime time.Time) []anomaly.Finding {
+	if message.Verb != audit.VerbDelete && message.Verb != "deletecollection" {
+		return nil
+	}
+
+	// cluster-scoped deletions are counted together
+	subject := fmt.Sprintf("%s/%s", message.Cluster, message.ObjectRef.Namespace)
+	count, baseline, hasBaseline := detector.counter.Add(subject, eventTime)
+	if !detector.rule.IsSurge(count, baseline, hasBaseline) {
+		return nil
+	}
+
+	return []anomaly.Finding{{
+		Detector: detector.Name(),
+		Subject:  subject,
+		Summary: fmt.Sprintf(
+			"%d deletions in namespace %q in %v%s",
+			count, message.ObjectRef.Namespace, detector.options.window, describeBaseline(baseline, hasBaseline),
+		),
+	}}
+}
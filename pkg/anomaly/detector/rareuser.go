@@ -0,0 +1,152 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomalydetector
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/anomaly"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("anomaly-rare-user", manager.Ptr(&rareUser{}), &manager.List[anomaly.Detector]{})
+}
+
+type rareUserOptions struct {
+	enable         bool
+	retention      time.Duration
+	warmup         time.Duration
+	excludePattern string
+}
+
+func (options *rareUserOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "anomaly-rare-user-enable", true, "flag writes by users not seen recently")
+	fs.DurationVar(
+		&options.retention,
+		"anomaly-rare-user-retention",
+		time.Hour*24*7,
+		"a user is considered rarely seen if it has not written to the cluster within this duration",
+	)
+	fs.DurationVar(
+		&options.warmup,
+		"anomaly-rare-user-warmup",
+		time.Hour*24,
+		"duration after the first observed event of a cluster during which users are only recorded and not flagged",
+	)
+	fs.StringVar(
+		&options.excludePattern,
+		"anomaly-rare-user-exclude-pattern",
+		"^system:node:",
+		"regular expression of usernames never flagged",
+	)
+}
+
+func (options *rareUserOptions) EnableFlag() *bool { return &options.enable }
+
+type rareUser struct {
+	options rareUserOptions
+
+	exclude *regexp.Regexp
+
+	mu       sync.Mutex
+	clusters map[string]*userHistory
+}
+
+type userHistory struct {
+	firstObserved time.Time
+	lastSweep     time.Time
+	lastSeen      map[string]time.Time
+}
+
+var _ manager.Component = &rareUser{}
+
+func (detector *rareUser) Options() manager.Options { return &detector.options }
+
+func (detector *rareUser) Init() (err error) {
+	if detector.options.excludePattern != "" {
+		detector.exclude, err = regexp.Compile(detector.options.excludePattern)
+		if err != nil {
+			return fmt.Errorf("invalid --anomaly-rare-user-exclude-pattern: %w", err)
+		}
+	}
+
+	detector.clusters = map[string]*userHistory{}
+	return nil
+}
+
+func (detector *rareUser) Start(ctx context.Context) error { return nil }
+func (detector *rareUser) Close(ctx context.Context) error { return nil }
+
+func (detector *rareUser) Name() string { return "rareUser" }
+
+func (detector *rareUser) Observe(message *audit.Message, eventTime time.Time) []anomaly.Finding {
+	username := message.User.Username
+	if username == "" || (detector.exclude != nil && detector.exclude.MatchString(username)) {
+		return nil
+	}
+
+	detector.mu.Lock()
+	defer detector.mu.Unlock()
+
+	history, exists := detector.clusters[message.Cluster]
+	if !exists {
+		history = &userHistory{
+			firstObserved: eventTime,
+			lastSweep:     eventTime,
+			lastSeen:      map[string]time.Time{},
+		}
+		detector.clusters[message.Cluster] = history
+	}
+
+	lastSeen, seen := history.lastSeen[username]
+	history.lastSeen[username] = eventTime
+
+	if eventTime.Sub(history.lastSweep) >= detector.options.retention {
+		for user, t := range history.lastSeen {
+			if eventTime.Sub(t) >= detector.options.retention {
+				delete(history.lastSeen, user)
+			}
+		}
+		history.lastSweep = eventTime
+	}
+
+	if eventTime.Sub(history.firstObserved) < detector.options.warmup {
+		return nil
+	}
+
+	var summary string
+	switch {
+	case !seen:
+		summary = fmt.Sprintf("first write by user %q", username)
+	case eventTime.Sub(lastSeen) >= detector.options.retention:
+		summary = fmt.Sprintf("first write by user %q since %s", username, lastSeen.Format(time.RFC3339))
+	default:
+		return nil
+	}
+
+	return []anomaly.Finding{{
+		Detector: detector.Name(),
+		Subject:  fmt.Sprintf("%s/%s", message.Cluster, username),
+		Summary:  summary,
+	}}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Built-in anomaly detectors.
+package anomalydetector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/anomaly"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("anomaly-update-surge", manager.Ptr(&updateSurge{}), &manager.List[anomaly.Detector]{})
+}
+
+type surgeOptions struct {
+	enable   bool
+	window   time.Duration
+	minCount int
+	factor   float64
+}
+
+func (options *surgeOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "anomaly-update-surge-enable", true, "flag objects receiving an unusually large number of updates")
+	fs.DurationVar(&options.window, "anomaly-update-surge-window", time.Minute, "window over which updates to an object are counted")
+	fs.IntVar(&options.minCount, "anomaly-update-surge-min-count", 20, "minimum number of updates in a window to be considered a surge")
+	fs.Float64Var(
+		&options.factor,
+		"anomaly-update-surge-factor",
+		5,
+		"an object is flagged if its updates in a window exceed its moving average by this factor",
+	)
+}
+
+func (options *surgeOptions) EnableFlag() *bool { return &options.enable }
+
+type updateSurge struct {
+	options surgeOptions
+
+	counter *WindowCounter
+	rule    SurgeRule
+}
+
+var _ manager.Component = &updateSurge{}
+
+func (detector *updateSurge) Options() manager.Options { return &detector.options }
+
+func (detector *updateSurge) Init() error {
+	if detector.options.window <= 0 {
+		return fmt.Errorf("--anomaly-update-surge-window must be positive")
+	}
+
+	detector.counter = NewWindowCounter(detector.options.window, 0.3)
+	detector.rule = SurgeRule{MinCount: detector.options.minCount, Factor: detector.options.factor}
+	return nil
+}
+
+func (detector *updateSurge) Start(ctx context.Context) error { return nil }
+func (detector *updateSurge) Close(ctx context.Context) error { return nil }
+
+func (detector *updateSurge) Name() string { return "updateSurge" }
+
+func (detector *updateSurge) Observe(message *audit.Message, eventTime time.Time) []anomaly.Finding {
+	if message.Verb != audit.VerbUpdate && message.Verb != audit.VerbPatch {
+		return nil
+	}
+
+	ref := message.ObjectRef
+	if ref.Name == "" {
+		return nil
+	}
+
+	subject := fmt.Sprintf("%s/%s/%s/%s/%s", message.Cluster, ref.APIGroup, ref.Resource, ref.Namespace, ref.Name)
+	count, baseline, hasBaseline := detector.counter.Add(subject, eventTime)
+	if !detector.rule.IsSurge(count, baseline, hasBaseline) {
+		return nil
+	}
+
+	return []anomaly.Finding{{
+		Detector: detector.Name(),
+		Subject:  subject,
+		Summary:  fmt.Sprintf("%d updates in %v%s", count, detector.options.window, describeBaseline(baseline, hasBaseline)),
+	}}
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomalydetector
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Counters of windows without activity are forgotten after this many windows,
+// by which the baseline has decayed to a negligible value.
+const staleWindows = 16
+
+// WindowCounter counts occurrences per key in fixed windows
+// and maintains an exponentially weighted moving average of the counts of past windows as the baseline.
+type WindowCounter struct {
+	window time.Duration
+	alpha  float64
+
+	mu        sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	windowStart time.Time
+	count       int
+	baseline    float64
+	hasBaseline bool
+}
+
+func NewWindowCounter(window time.Duration, alpha float64) *WindowCounter {
+	return &WindowCounter{
+		window:   window,
+		alpha:    alpha,
+		counters: map[string]*counter{},
+	}
+}
+
+// Add records an occurrence for the key at the given time.
+// Returns the count in the current window including this occurrence,
+// and the baseline if at least one window has completed for the key.
+func (wc *WindowCounter) Add(key string, now time.Time) (count int, baseline float64, hasBaseline bool) {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	windowStart := now.Truncate(wc.window)
+
+	c, exists := wc.counters[key]
+	if !exists {
+		c = &counter{windowStart: windowStart}
+		wc.counters[key] = c
+	}
+
+	if windowStart.After(c.windowStart) {
+		completedWindows := int(windowStart.Sub(c.windowStart) / wc.window)
+
+		if c.hasBaseline {
+			c.baseline = wc.alpha*float64(c.count) + (1-wc.alpha)*c.baseline
+		} else {
+			c.baseline = float64(c.count)
+			c.hasBaseline = true
+		}
+		// windows without any occurrences in between
+		c.baseline *= math.Pow(1-wc.alpha, float64(completedWindows-1))
+
+		c.windowStart = windowStart
+		c.count = 0
+	}
+
+	c.count++
+
+	if now.Sub(wc.lastSweep) >= wc.window*staleWindows {
+		wc.sweep(now)
+		wc.lastSweep = now
+	}
+
+	return c.count, c.baseline, c.hasBaseline
+}
+
+func (wc *WindowCounter) sweep(now time.Time) {
+	for key, c := range wc.counters {
+		if now.Sub(c.windowStart) >= wc.window*staleWindows {
+			delete(wc.counters, key)
+		}
+	}
+}
+
+// SurgeRule decides whether a window count is a surge.
+type SurgeRule struct {
+	// Counts below this value are never surges.
+	MinCount int
+	// A count is a surge if it exceeds the baseline by this factor.
+	Factor float64
+}
+
+func (rule SurgeRule) IsSurge(count int, baseline float64, hasBaseline bool) bool {
+	if count < rule.MinCount {
+		return false
+	}
+
+	return !hasBaseline || float64(count) > rule.Factor*baseline
+}
+
+func describeBaseline(baseline float64, hasBaseline bool) string {
+	if !hasBaseline {
+		return ""
+	}
+
+	return fmt.Sprintf(", usually %.1f", baseline)
+}
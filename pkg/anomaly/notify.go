@@ -0,0 +1,238 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomaly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("anomaly-notifier", manager.Ptr(&Notifier{
+		lastSent: map[notifyKey]time.Time{},
+	}))
+}
+
+const (
+	FormatGeneric = "generic"
+	FormatSlack   = "slack"
+)
+
+type notifyOptions struct {
+	url       string
+	format    string
+	timeout   time.Duration
+	cooldown  time.Duration
+	queueSize int
+}
+
+func (options *notifyOptions) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(&options.url, "anomaly-webhook-url", "", "URL to post anomaly findings to; leave empty to disable notifications")
+	fs.StringVar(
+		&options.format,
+		"anomaly-webhook-format",
+		FormatGeneric,
+		fmt.Sprintf("request body format of anomaly notifications, either %q (JSON finding) or %q (incoming webhook message)", FormatGeneric, FormatSlack),
+	)
+	fs.DurationVar(&options.timeout, "anomaly-webhook-timeout", time.Second*5, "timeout of each anomaly notification request")
+	fs.DurationVar(
+		&options.cooldown,
+		"anomaly-webhook-cooldown",
+		time.Minute*10,
+		"minimum interval between notifications for the same detector and subject",
+	)
+	fs.IntVar(&options.queueSize, "anomaly-webhook-queue-size", 100, "number of pending notifications before new findings are dropped")
+}
+
+func (options *notifyOptions) EnableFlag() *bool { return nil }
+
+// Notifier posts anomaly findings to a webhook.
+type Notifier struct {
+	options notifyOptions
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+
+	NotifyMetric *metrics.Metric[*notifyMetric]
+
+	httpClient http.Client
+	queue      chan notification
+
+	lastSentMu sync.Mutex
+	lastSent   map[notifyKey]time.Time
+}
+
+type notifyKey struct {
+	detector string
+	subject  string
+}
+
+type notification struct {
+	Finding
+	Cluster   string    `json:"cluster"`
+	Username  string    `json:"username"`
+	Verb      string    `json:"verb"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type notifyMetric struct {
+	Detector string
+	Error    metrics.LabeledError
+}
+
+func (*notifyMetric) MetricName() string { return "anomaly_notify" }
+
+var _ manager.Component = &Notifier{}
+
+func (notifier *Notifier) Options() manager.Options { return &notifier.options }
+
+func (notifier *Notifier) Init() error {
+	if notifier.options.format != FormatGeneric && notifier.options.format != FormatSlack {
+		return fmt.Errorf("unsupported --anomaly-webhook-format %q", notifier.options.format)
+	}
+
+	notifier.httpClient.Timeout = notifier.options.timeout
+	notifier.queue = make(chan notification, notifier.options.queueSize)
+	return nil
+}
+
+func (notifier *Notifier) Start(ctx context.Context) error {
+	if notifier.options.url == "" {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(notifier.Logger)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item := <-notifier.queue:
+				notifier.send(ctx, item)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (notifier *Notifier) Close(ctx context.Context) error { return nil }
+
+// Notify enqueues a notification for the finding unless the same subject was notified within the cooldown.
+func (notifier *Notifier) Notify(message *audit.Message, finding Finding) {
+	if notifier.options.url == "" {
+		return
+	}
+
+	now := notifier.Clock.Now()
+	key := notifyKey{detector: finding.Detector, subject: finding.Subject}
+
+	notifier.lastSentMu.Lock()
+	if last, exists := notifier.lastSent[key]; exists && now.Sub(last) < notifier.options.cooldown {
+		notifier.lastSentMu.Unlock()
+		return
+	}
+	notifier.lastSent[key] = now
+	for otherKey, last := range notifier.lastSent {
+		if now.Sub(last) >= notifier.options.cooldown {
+			delete(notifier.lastSent, otherKey)
+		}
+	}
+	notifier.lastSentMu.Unlock()
+
+	item := notification{
+		Finding:  finding,
+		Cluster:  message.Cluster,
+		Username: message.User.Username,
+		Verb:     message.Verb,
+		Time:     message.StageTimestamp.Time,
+	}
+	if message.ObjectRef != nil {
+		item.Resource = message.ObjectRef.Resource
+		item.Namespace = message.ObjectRef.Namespace
+		item.Name = message.ObjectRef.Name
+	}
+
+	select {
+	case notifier.queue <- item:
+	default:
+		notifier.NotifyMetric.With(&notifyMetric{Detector: finding.Detector, Error: metrics.MakeLabeledError("QueueFull")}).Count(1)
+	}
+}
+
+func (notifier *Notifier) send(ctx context.Context, item notification) {
+	metric := &notifyMetric{Detector: item.Detector}
+	defer notifier.NotifyMetric.DeferCount(notifier.Clock.Now(), metric)
+
+	logger := notifier.Logger.WithField("detector", item.Detector).WithField("subject", item.Subject)
+
+	var body any = item
+	if notifier.options.format == FormatSlack {
+		body = map[string]string{"text": FormatText(item.Finding, item.Cluster, item.Username)}
+	}
+
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Marshal")
+		logger.WithError(err).Error("cannot encode anomaly notification")
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notifier.options.url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "NewRequest")
+		logger.WithError(err).Error("cannot create anomaly notification request")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notifier.httpClient.Do(req)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Post")
+		logger.WithError(err).Warn("cannot send anomaly notification")
+		return
+	}
+
+	if err := resp.Body.Close(); err != nil {
+		logger.WithError(err).Debug("cannot close notification response body")
+	}
+
+	if resp.StatusCode >= 300 {
+		metric.Error = metrics.MakeLabeledError(fmt.Sprintf("Status%d", resp.StatusCode))
+		logger.WithField("status", resp.StatusCode).Warn("anomaly webhook rejected notification")
+	}
+}
+
+// FormatText renders a finding as a single-line chat message.
+func FormatText(finding Finding, cluster string, username string) string {
+	return fmt.Sprintf("[%s] %s: %s (cluster %s, user %s)", finding.Detector, finding.Subject, finding.Summary, cluster, username)
+}
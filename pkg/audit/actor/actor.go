@@ -0,0 +1,202 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Infers the controller or user acting in an audit event.
+//
+// Built-in rules recognize kube-controller-manager controllers, the scheduler, kubelets,
+// service accounts and human users. Custom rules are matched before built-in rules.
+package actor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Type string
+
+const (
+	TypeController     Type = "controller"
+	TypeScheduler      Type = "scheduler"
+	TypeNode           Type = "node"
+	TypeServiceAccount Type = "serviceaccount"
+	TypeSystem         Type = "system"
+	TypeUser           Type = "user"
+)
+
+// Identity is the request identity used for attribution.
+type Identity struct {
+	Username  string
+	UserAgent string
+}
+
+type Actor struct {
+	Name string
+	Type Type
+}
+
+type field string
+
+const (
+	fieldUsername       field = "username"
+	fieldUserAgent      field = "userAgent"
+	fieldServiceAccount field = "serviceAccount"
+)
+
+// Rule maps identities matching a pattern to an actor.
+type Rule struct {
+	field   field
+	pattern *regexp.Regexp
+	actor   string
+	ty      Type
+}
+
+// ParseRule parses a rule in the form `<actor>[:<actorType>]=<field>~<regex>`,
+// where field is one of username, userAgent or serviceAccount (`namespace/name`).
+// The actor may reference capture groups of the regex, e.g. `$1`.
+// The actor type defaults to "controller".
+func ParseRule(spec string) (Rule, error) {
+	target, matcher, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("expected '<actor>[:<actorType>]=<field>~<regex>', got %q", spec)
+	}
+
+	actorName, actorType, hasType := strings.Cut(target, ":")
+	if actorName == "" {
+		return Rule{}, fmt.Errorf("actor name must not be empty in %q", spec)
+	}
+	if !hasType {
+		actorType = string(TypeController)
+	}
+
+	fieldName, pattern, ok := strings.Cut(matcher, "~")
+	if !ok {
+		return Rule{}, fmt.Errorf("expected '<field>~<regex>', got %q", matcher)
+	}
+
+	switch field(fieldName) {
+	case fieldUsername, fieldUserAgent, fieldServiceAccount:
+	default:
+		return Rule{}, fmt.Errorf("unknown field %q, expected username, userAgent or serviceAccount", fieldName)
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+
+	return Rule{field: field(fieldName), pattern: regex, actor: actorName, ty: Type(actorType)}, nil
+}
+
+func (rule Rule) match(identity Identity) (Actor, bool) {
+	var value string
+	switch rule.field {
+	case fieldUsername:
+		value = identity.Username
+	case fieldUserAgent:
+		value = identity.UserAgent
+	case fieldServiceAccount:
+		namespace, name, isServiceAccount := parseServiceAccount(identity.Username)
+		if !isServiceAccount {
+			return Actor{}, false
+		}
+		value = namespace + "/" + name
+	}
+
+	submatches := rule.pattern.FindStringSubmatchIndex(value)
+	if submatches == nil {
+		return Actor{}, false
+	}
+
+	name := string(rule.pattern.ExpandString(nil, rule.actor, value, submatches))
+	return Actor{Name: name, Type: rule.ty}, true
+}
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+func parseServiceAccount(username string) (namespace string, name string, ok bool) {
+	if !strings.HasPrefix(username, serviceAccountPrefix) {
+		return "", "", false
+	}
+
+	return strings.Cut(strings.TrimPrefix(username, serviceAccountPrefix), ":")
+}
+
+// userAgentController returns the controller name appended to the user agent of a controller manager,
+// e.g. `kube-controller-manager/v1.27.3 (linux/amd64) kubernetes/25b4e43/deployment-controller`.
+func userAgentController(userAgent string) (string, bool) {
+	if !strings.HasPrefix(userAgent, "kube-controller-manager/") && !strings.HasPrefix(userAgent, "cloud-controller-manager/") {
+		return "", false
+	}
+
+	index := strings.LastIndex(userAgent, "/")
+	suffix := userAgent[index+1:]
+
+	if namespace, name, isServiceAccount := parseServiceAccount(suffix); isServiceAccount && namespace == "kube-system" {
+		return name, true
+	}
+
+	if strings.HasSuffix(suffix, "-controller") {
+		return suffix, true
+	}
+
+	return "", false
+}
+
+// Service accounts with these name suffixes are assumed to belong to controllers.
+var controllerSuffixes = []string{"-controller", "-operator", "-manager"}
+
+// Infer returns the actor of a request.
+func Infer(rules []Rule, identity Identity) Actor {
+	for _, rule := range rules {
+		if actor, ok := rule.match(identity); ok {
+			return actor
+		}
+	}
+
+	if name, ok := userAgentController(identity.UserAgent); ok {
+		return Actor{Name: name, Type: TypeController}
+	}
+
+	switch identity.Username {
+	case "system:kube-controller-manager", "system:cloud-controller-manager":
+		return Actor{Name: strings.TrimPrefix(identity.Username, "system:"), Type: TypeController}
+	case "system:kube-scheduler":
+		return Actor{Name: "kube-scheduler", Type: TypeScheduler}
+	case "system:kube-proxy":
+		return Actor{Name: "kube-proxy", Type: TypeNode}
+	case "system:apiserver":
+		return Actor{Name: "kube-apiserver", Type: TypeSystem}
+	}
+
+	if strings.HasPrefix(identity.Username, "system:node:") {
+		return Actor{Name: "kubelet", Type: TypeNode}
+	}
+
+	if _, name, ok := parseServiceAccount(identity.Username); ok {
+		for _, suffix := range controllerSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				return Actor{Name: name, Type: TypeController}
+			}
+		}
+
+		return Actor{Name: name, Type: TypeServiceAccount}
+	}
+
+	if strings.HasPrefix(identity.Username, "system:") {
+		return Actor{Name: strings.TrimPrefix(identity.Username, "system:"), Type: TypeSystem}
+	}
+
+	return Actor{Name: identity.Username, Type: TypeUser}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/actor"
+)
+
+func TestInferBuiltin(t *testing.T) {
+	for _, testCase := range []struct {
+		identity actor.Identity
+		expect   actor.Actor
+	}{
+		{
+			identity: actor.Identity{
+				Username:  "system:serviceaccount:kube-system:deployment-controller",
+				UserAgent: "kube-controller-manager/v1.27.3 (linux/amd64) kubernetes/25b4e43/system:serviceaccount:kube-system:deployment-controller",
+			},
+			expect: actor.Actor{Name: "deployment-controller", Type: actor.TypeController},
+		},
+		{
+			identity: actor.Identity{
+				Username:  "system:kube-controller-manager",
+				UserAgent: "kube-controller-manager/v1.27.3 (linux/amd64) kubernetes/25b4e43/replicaset-controller",
+			},
+			expect: actor.Actor{Name: "replicaset-controller", Type: actor.TypeController},
+		},
+		{
+			identity: actor.Identity{Username: "system:kube-controller-manager", UserAgent: "kube-controller-manager/v1.27.3"},
+			expect:   actor.Actor{Name: "kube-controller-manager", Type: actor.TypeController},
+		},
+		{
+			identity: actor.Identity{Username: "system:kube-scheduler"},
+			expect:   actor.Actor{Name: "kube-scheduler", Type: actor.TypeScheduler},
+		},
+		{
+			identity: actor.Identity{Username: "system:node:node-1", UserAgent: "kubelet/v1.27.3"},
+			expect:   actor.Actor{Name: "kubelet", Type: actor.TypeNode},
+		},
+		{
+			identity: actor.Identity{Username: "system:serviceaccount:argocd:argocd-application-controller"},
+			expect:   actor.Actor{Name: "argocd-application-controller", Type: actor.TypeController},
+		},
+		{
+			identity: actor.Identity{Username: "system:serviceaccount:default:ci-bot"},
+			expect:   actor.Actor{Name: "ci-bot", Type: actor.TypeServiceAccount},
+		},
+		{
+			identity: actor.Identity{Username: "alice@example.com", UserAgent: "kubectl/v1.27.3"},
+			expect:   actor.Actor{Name: "alice@example.com", Type: actor.TypeUser},
+		},
+	} {
+		assert.Equal(t, testCase.expect, actor.Infer(nil, testCase.identity), testCase.identity.Username)
+	}
+}
+
+func TestInferCustomRules(t *testing.T) {
+	var rules []actor.Rule
+	for _, spec := range []string{
+		"billing-operator=serviceAccount~^billing/",
+		"$1:release=userAgent~^(helm)/",
+	} {
+		rule, err := actor.ParseRule(spec)
+		assert.NoError(t, err)
+		rules = append(rules, rule)
+	}
+
+	assert.Equal(
+		t,
+		actor.Actor{Name: "billing-operator", Type: actor.TypeController},
+		actor.Infer(rules, actor.Identity{Username: "system:serviceaccount:billing:worker"}),
+	)
+	assert.Equal(
+		t,
+		actor.Actor{Name: "helm", Type: "release"},
+		actor.Infer(rules, actor.Identity{Username: "alice", UserAgent: "helm/v3.12.0"}),
+	)
+	assert.Equal(
+		t,
+		actor.Actor{Name: "alice", Type: actor.TypeUser},
+		actor.Infer(rules, actor.Identity{Username: "alice", UserAgent: "kubectl/v1.27.3"}),
+	)
+
+	for _, spec := range []string{"", "actor", "=username~x", "actor=host~x", "actor=username~(", "actor=username"} {
+		_, err := actor.ParseRule(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package actor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("actor-decorator", manager.Ptr(&decorator{}), &manager.List[audit.Decorator]{})
+}
+
+type options struct {
+	enable bool
+	rules  []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "actor-decorator-enable", false, "tag audit spans with the inferred acting controller or user")
+	fs.StringArrayVar(
+		&options.rules,
+		"actor-decorator-rule",
+		[]string{},
+		"custom actor rule in the form '<actor>[:<actorType>]=<field>~<regex>', matched before built-in rules; "+
+			"field is one of username, userAgent or serviceAccount ('namespace/name'), "+
+			"actor may reference regex capture groups and actorType defaults to 'controller', "+
+			"e.g. 'billing-operator=serviceAccount~^billing/.*$' or '$1:controller=userAgent~^(\\w+-controller)/'",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options options
+	rules   []Rule
+}
+
+var _ manager.Component = &decorator{}
+
+func (d *decorator) Options() manager.Options { return &d.options }
+
+func (d *decorator) Init() error {
+	for _, spec := range d.options.rules {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --actor-decorator-rule: %w", err)
+		}
+		d.rules = append(d.rules, rule)
+	}
+
+	return nil
+}
+
+func (d *decorator) Start(ctx context.Context) error { return nil }
+func (d *decorator) Close(ctx context.Context) error { return nil }
+
+func (d *decorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	// reuse the username resolved by the consumer, which respects impersonation settings
+	username, ok := event.Tags["username"].(string)
+	if !ok {
+		username = message.User.Username
+	}
+
+	actor := Infer(d.rules, Identity{Username: username, UserAgent: message.UserAgent})
+	if actor.Name == "" {
+		return
+	}
+
+	event.SetTag("actor", actor.Name)
+	event.SetTag("actorType", string(actor.Type))
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Extracts admission webhook invocations from the audit annotations of a request.
+//
+// The apiserver annotates each mutating webhook invocation with whether it mutated the object,
+// and each webhook that failed open with its name.
+// Validating webhooks that admitted the request leave no annotation.
+// Webhook latency is only reported as the total of each admission phase,
+// and only for requests slower than the apiserver latency threshold (500ms).
+package admission
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	mutationAnnotationPrefix             = "mutation.webhook.admission.k8s.io/"
+	mutatingFailedOpenAnnotationPrefix   = "failed-open.mutation.webhook.admission.k8s.io/"
+	validatingFailedOpenAnnotationPrefix = "failed-open.validating.webhook.admission.k8s.io/"
+
+	mutatingLatencyAnnotation   = "apiserver.latency.k8s.io/mutating-webhook"
+	validatingLatencyAnnotation = "apiserver.latency.k8s.io/validating-webhook"
+)
+
+type Phase string
+
+const (
+	PhaseMutating   Phase = "mutating"
+	PhaseValidating Phase = "validating"
+)
+
+type Result string
+
+const (
+	ResultMutated    Result = "Mutated"
+	ResultUnchanged  Result = "Unchanged"
+	ResultFailedOpen Result = "FailedOpen"
+	ResultRejected   Result = "Rejected"
+	ResultError      Result = "Error"
+)
+
+// Invocation is a single admission webhook call inferred from the audit event.
+type Invocation struct {
+	Phase         Phase
+	Round         int
+	Index         int
+	Configuration string
+	Webhook       string
+	Result        Result
+	// The message returned by the webhook, only set for rejections and errors.
+	Message string
+}
+
+type Summary struct {
+	Invocations       []Invocation
+	MutatingLatency   time.Duration
+	ValidatingLatency time.Duration
+}
+
+type mutationAnnotation struct {
+	Configuration string `json:"configuration"`
+	Webhook       string `json:"webhook"`
+	Mutated       bool   `json:"mutated"`
+}
+
+var (
+	roundIndexRegex = regexp.MustCompile(`^round_(\d+)_index_(\d+)$`)
+	deniedRegex     = regexp.MustCompile(`^admission webhook "([^"]+)" denied the request(?::\s*|\s+)(.*)$`)
+	callErrorRegex  = regexp.MustCompile(`failed calling webhook "([^"]+)": (.*)$`)
+)
+
+// Parse extracts the admission webhook invocations from the audit annotations and response status of a request.
+func Parse(annotations map[string]string, status *metav1.Status) Summary {
+	summary := Summary{}
+
+	// failed-open annotations are applied after all mutation annotations are collected
+	// since a mutating webhook that failed open may also have a mutation annotation
+	type failedOpen struct {
+		phase   Phase
+		suffix  string
+		webhook string
+	}
+	failedOpens := []failedOpen{}
+
+	for key, value := range annotations {
+		switch {
+		case strings.HasPrefix(key, mutationAnnotationPrefix):
+			round, index, ok := parseRoundIndex(strings.TrimPrefix(key, mutationAnnotationPrefix))
+			if !ok {
+				continue
+			}
+
+			var parsed mutationAnnotation
+			if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+				continue
+			}
+
+			result := ResultUnchanged
+			if parsed.Mutated {
+				result = ResultMutated
+			}
+
+			summary.Invocations = append(summary.Invocations, Invocation{
+				Phase:         PhaseMutating,
+				Round:         round,
+				Index:         index,
+				Configuration: parsed.Configuration,
+				Webhook:       parsed.Webhook,
+				Result:        result,
+			})
+		case strings.HasPrefix(key, mutatingFailedOpenAnnotationPrefix):
+			failedOpens = append(failedOpens, failedOpen{PhaseMutating, strings.TrimPrefix(key, mutatingFailedOpenAnnotationPrefix), value})
+		case strings.HasPrefix(key, validatingFailedOpenAnnotationPrefix):
+			failedOpens = append(failedOpens, failedOpen{PhaseValidating, strings.TrimPrefix(key, validatingFailedOpenAnnotationPrefix), value})
+		case key == mutatingLatencyAnnotation:
+			summary.MutatingLatency, _ = time.ParseDuration(value)
+		case key == validatingLatencyAnnotation:
+			summary.ValidatingLatency, _ = time.ParseDuration(value)
+		}
+	}
+
+	for _, item := range failedOpens {
+		summary.addFailedOpen(item.phase, item.suffix, item.webhook)
+	}
+
+	sort.Slice(summary.Invocations, func(i, j int) bool {
+		left, right := summary.Invocations[i], summary.Invocations[j]
+		if left.Phase != right.Phase {
+			return left.Phase == PhaseMutating
+		}
+		if left.Round != right.Round {
+			return left.Round < right.Round
+		}
+		return left.Index < right.Index
+	})
+
+	if status != nil && status.Code >= 300 {
+		if matches := deniedRegex.FindStringSubmatch(status.Message); matches != nil {
+			summary.Invocations = append(summary.Invocations, Invocation{
+				Webhook: matches[1],
+				Result:  ResultRejected,
+				Message: matches[2],
+			})
+		} else if matches := callErrorRegex.FindStringSubmatch(status.Message); matches != nil {
+			summary.Invocations = append(summary.Invocations, Invocation{
+				Webhook: matches[1],
+				Result:  ResultError,
+				Message: matches[2],
+			})
+		}
+	}
+
+	return summary
+}
+
+func (summary *Summary) addFailedOpen(phase Phase, suffix string, webhook string) {
+	round, index, ok := parseRoundIndex(suffix)
+	if !ok {
+		return
+	}
+
+	for i := range summary.Invocations {
+		invocation := &summary.Invocations[i]
+		if invocation.Phase == phase && invocation.Round == round && invocation.Index == index {
+			invocation.Result = ResultFailedOpen
+			return
+		}
+	}
+
+	summary.Invocations = append(summary.Invocations, Invocation{
+		Phase:   phase,
+		Round:   round,
+		Index:   index,
+		Webhook: webhook,
+		Result:  ResultFailedOpen,
+	})
+}
+
+func parseRoundIndex(suffix string) (round int, index int, ok bool) {
+	matches := roundIndexRegex.FindStringSubmatch(suffix)
+	if matches == nil {
+		return 0, 0, false
+	}
+
+	round, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	index, err = strconv.Atoi(matches[2])
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return round, index, true
+}
+
+// Rejection returns the invocation that rejected the request, if any.
+func (summary *Summary) Rejection() (Invocation, bool) {
+	for _, invocation := range summary.Invocations {
+		if invocation.Result == ResultRejected || invocation.Result == ResultError {
+			return invocation, true
+		}
+	}
+
+	return Invocation{}, false
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/admission"
+)
+
+func TestParseMutations(t *testing.T) {
+	summary := admission.Parse(map[string]string{
+		"mutation.webhook.admission.k8s.io/round_0_index_1":               `{"configuration":"cfg","webhook":"b.example.com","mutated":false}`,
+		"mutation.webhook.admission.k8s.io/round_0_index_0":               `{"configuration":"cfg","webhook":"a.example.com","mutated":true}`,
+		"mutation.webhook.admission.k8s.io/round_1_index_0":               `{"configuration":"cfg","webhook":"a.example.com","mutated":false}`,
+		"failed-open.mutation.webhook.admission.k8s.io/round_0_index_1":   "b.example.com",
+		"failed-open.validating.webhook.admission.k8s.io/round_0_index_2": "c.example.com",
+		"patch.webhook.admission.k8s.io/round_0_index_0":                  `{"configuration":"cfg","webhook":"a.example.com","patch":[]}`,
+		"apiserver.latency.k8s.io/mutating-webhook":                       "1.5s",
+		"apiserver.latency.k8s.io/validating-webhook":                     "250ms",
+		"mutation.webhook.admission.k8s.io/malformed":                     `{}`,
+	}, nil)
+
+	assert.Equal(t, time.Millisecond*1500, summary.MutatingLatency)
+	assert.Equal(t, time.Millisecond*250, summary.ValidatingLatency)
+	assert.Equal(t, []admission.Invocation{
+		{Phase: admission.PhaseMutating, Round: 0, Index: 0, Configuration: "cfg", Webhook: "a.example.com", Result: admission.ResultMutated},
+		{Phase: admission.PhaseMutating, Round: 0, Index: 1, Configuration: "cfg", Webhook: "b.example.com", Result: admission.ResultFailedOpen},
+		{Phase: admission.PhaseMutating, Round: 1, Index: 0, Configuration: "cfg", Webhook: "a.example.com", Result: admission.ResultUnchanged},
+		{Phase: admission.PhaseValidating, Round: 0, Index: 2, Webhook: "c.example.com", Result: admission.ResultFailedOpen},
+	}, summary.Invocations)
+
+	_, rejected := summary.Rejection()
+	assert.False(t, rejected)
+}
+
+func TestParseRejection(t *testing.T) {
+	summary := admission.Parse(nil, &metav1.Status{
+		Code:    403,
+		Message: `admission webhook "policy.example.com" denied the request: replicas must not exceed 10`,
+	})
+
+	rejection, rejected := summary.Rejection()
+	assert.True(t, rejected)
+	assert.Equal(t, "policy.example.com", rejection.Webhook)
+	assert.Equal(t, admission.ResultRejected, rejection.Result)
+	assert.Equal(t, "replicas must not exceed 10", rejection.Message)
+
+	summary = admission.Parse(nil, &metav1.Status{
+		Code:    500,
+		Message: `Internal error occurred: failed calling webhook "policy.example.com": context deadline exceeded`,
+	})
+
+	rejection, rejected = summary.Rejection()
+	assert.True(t, rejected)
+	assert.Equal(t, admission.ResultError, rejection.Result)
+	assert.Equal(t, "context deadline exceeded", rejection.Message)
+
+	summary = admission.Parse(nil, &metav1.Status{Code: 404, Message: `pods "foo" not found`})
+	_, rejected = summary.Rejection()
+	assert.False(t, rejected)
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admission
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("admission-decorator", manager.Ptr(&decorator{}), &manager.List[audit.Decorator]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"admission-decorator-enable",
+		false,
+		"annotate audit spans with the admission webhooks that mutated, failed open or rejected the request",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options options
+
+	WebhookMetric *metrics.Metric[*webhookMetric]
+}
+
+var _ manager.Component = &decorator{}
+
+type webhookMetric struct {
+	Cluster string
+	Phase   Phase
+	Webhook string
+	Result  Result
+}
+
+func (*webhookMetric) MetricName() string { return "audit_admission_webhook" }
+
+func (decorator *decorator) Options() manager.Options        { return &decorator.options }
+func (decorator *decorator) Init() error                     { return nil }
+func (decorator *decorator) Start(ctx context.Context) error { return nil }
+func (decorator *decorator) Close(ctx context.Context) error { return nil }
+
+func (decorator *decorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	summary := Parse(message.Annotations, message.ResponseStatus)
+
+	if summary.MutatingLatency > 0 {
+		event.SetTag("mutatingWebhookLatency", summary.MutatingLatency.String())
+	}
+	if summary.ValidatingLatency > 0 {
+		event.SetTag("validatingWebhookLatency", summary.ValidatingLatency.String())
+	}
+
+	mutatedBy := []string{}
+	failedOpen := []string{}
+
+	for _, invocation := range summary.Invocations {
+		decorator.WebhookMetric.With(&webhookMetric{
+			Cluster: message.Cluster,
+			Phase:   invocation.Phase,
+			Webhook: invocation.Webhook,
+			Result:  invocation.Result,
+		}).Count(1)
+
+		switch invocation.Result {
+		case ResultMutated:
+			mutatedBy = append(mutatedBy, invocation.Webhook)
+		case ResultFailedOpen:
+			failedOpen = append(failedOpen, invocation.Webhook)
+		case ResultRejected, ResultError:
+			event.SetTag("admissionRejectedBy", invocation.Webhook)
+		}
+
+		event.Log(
+			zconstants.LogTypeAdmissionWebhook,
+			describe(invocation),
+			"phase", string(invocation.Phase),
+			"configuration", invocation.Configuration,
+			"webhook", invocation.Webhook,
+			"result", string(invocation.Result),
+		)
+	}
+
+	if len(mutatedBy) > 0 {
+		event.SetTag("admissionMutatedBy", strings.Join(mutatedBy, ","))
+	}
+	if len(failedOpen) > 0 {
+		event.SetTag("admissionFailedOpen", strings.Join(failedOpen, ","))
+	}
+}
+
+func describe(invocation Invocation) string {
+	name := invocation.Webhook
+	if invocation.Configuration != "" {
+		name = fmt.Sprintf("%s/%s", invocation.Configuration, invocation.Webhook)
+	}
+
+	switch invocation.Result {
+	case ResultRejected:
+		return fmt.Sprintf("admission webhook %q rejected the request: %s", name, invocation.Message)
+	case ResultError:
+		return fmt.Sprintf("admission webhook %q could not be called: %s", name, invocation.Message)
+	default:
+		return fmt.Sprintf("%s webhook %q (round %d, index %d): %s", invocation.Phase, name, invocation.Round, invocation.Index, invocation.Result)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Estimates and corrects the clock offset between apiservers of each cluster and the local clock.
+//
+// The offset of a cluster is estimated as the minimum of (receive time - stage timestamp)
+// over a sliding window of audit events received by the webhook.
+// Since the delivery latency is always positive, the minimum converges to
+// the clock offset plus the minimum delivery latency.
+package clockskew
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.Provide("audit-clock-skew", manager.Ptr(&Estimator{
+		clusters: map[string]*clusterSamples{},
+	}))
+}
+
+const numBuckets = 10
+
+type options struct {
+	enable        bool
+	window        time.Duration
+	threshold     time.Duration
+	staticOffsets map[string]string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"audit-clock-skew-correction-enable",
+		false,
+		"shift audit event timestamps by the estimated clock offset of the source cluster",
+	)
+	fs.DurationVar(
+		&options.window,
+		"audit-clock-skew-window",
+		time.Minute*5,
+		"sliding window over which the clock offset of each cluster is estimated",
+	)
+	fs.DurationVar(
+		&options.threshold,
+		"audit-clock-skew-threshold",
+		time.Millisecond*500,
+		"estimated clock offsets smaller than this value are not corrected",
+	)
+	fs.StringToStringVar(
+		&options.staticOffsets,
+		"audit-clock-skew-static-offset",
+		map[string]string{},
+		"fixed clock offsets added to audit timestamps of the specified clusters, overriding the estimation, e.g. 'cluster1=-2s'",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Estimator struct {
+	options options
+	Clock   clock.Clock
+
+	SkewMetric *metrics.Metric[*skewMetric]
+
+	staticOffsets map[string]time.Duration
+	bucketWidth   time.Duration
+
+	clustersMu sync.RWMutex
+	clusters   map[string]*clusterSamples
+}
+
+type skewMetric struct {
+	Cluster string
+}
+
+func (*skewMetric) MetricName() string { return "audit_clock_skew" }
+
+var _ manager.Component = &Estimator{}
+
+func (estimator *Estimator) Options() manager.Options { return &estimator.options }
+
+func (estimator *Estimator) Init() error {
+	estimator.staticOffsets = make(map[string]time.Duration, len(estimator.options.staticOffsets))
+	for cluster, value := range estimator.options.staticOffsets {
+		offset, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid --audit-clock-skew-static-offset for cluster %q: %w", cluster, err)
+		}
+		estimator.staticOffsets[cluster] = offset
+	}
+
+	if estimator.options.window < numBuckets {
+		return fmt.Errorf("--audit-clock-skew-window is too small")
+	}
+	estimator.bucketWidth = estimator.options.window / numBuckets
+
+	return nil
+}
+
+func (estimator *Estimator) Start(ctx context.Context) error { return nil }
+func (estimator *Estimator) Close(ctx context.Context) error { return nil }
+
+// Observe records a sample of the duration between the stage timestamp reported by the apiserver
+// and the time at which the event was received locally.
+// Messages without a stage timestamp or receive time are ignored.
+func (estimator *Estimator) Observe(cluster string, stageTime time.Time, receiveTime *time.Time) {
+	if stageTime.IsZero() || receiveTime == nil || receiveTime.IsZero() {
+		return
+	}
+
+	samples := estimator.getOrCreate(cluster)
+
+	samples.mu.Lock()
+	defer samples.mu.Unlock()
+
+	samples.observe(estimator.bucketWidth, *receiveTime, receiveTime.Sub(stageTime))
+
+	if offset, ok := samples.estimate(estimator.bucketWidth, *receiveTime); ok {
+		estimator.SkewMetric.With(&skewMetric{Cluster: cluster}).Gauge(float64(offset.Nanoseconds()))
+	}
+}
+
+// Offset returns the duration to be added to timestamps reported by the apiservers of a cluster.
+// Returns zero if correction is disabled, not enough samples are available or the offset is below the threshold.
+func (estimator *Estimator) Offset(cluster string) time.Duration {
+	if offset, isStatic := estimator.staticOffsets[cluster]; isStatic {
+		return offset
+	}
+
+	if !estimator.options.enable {
+		return 0
+	}
+
+	estimator.clustersMu.RLock()
+	samples, exists := estimator.clusters[cluster]
+	estimator.clustersMu.RUnlock()
+
+	if !exists {
+		return 0
+	}
+
+	samples.mu.Lock()
+	defer samples.mu.Unlock()
+
+	offset, ok := samples.estimate(estimator.bucketWidth, estimator.Clock.Now())
+	if !ok || (offset < estimator.options.threshold && offset > -estimator.options.threshold) {
+		return 0
+	}
+
+	return offset
+}
+
+func (estimator *Estimator) getOrCreate(cluster string) *clusterSamples {
+	estimator.clustersMu.RLock()
+	samples, exists := estimator.clusters[cluster]
+	estimator.clustersMu.RUnlock()
+
+	if exists {
+		return samples
+	}
+
+	estimator.clustersMu.Lock()
+	defer estimator.clustersMu.Unlock()
+
+	if samples, exists := estimator.clusters[cluster]; exists {
+		return samples
+	}
+
+	samples = &clusterSamples{}
+	estimator.clusters[cluster] = samples
+	return samples
+}
+
+// clusterSamples is a ring of per-bucket minimum samples.
+type clusterSamples struct {
+	mu      sync.Mutex
+	buckets [numBuckets]bucket
+}
+
+type bucket struct {
+	start time.Time
+	min   time.Duration
+	valid bool
+}
+
+func (samples *clusterSamples) observe(width time.Duration, now time.Time, sample time.Duration) {
+	start := now.Truncate(width)
+	b := &samples.buckets[(start.UnixNano()/int64(width))%numBuckets]
+
+	if !b.valid || !b.start.Equal(start) {
+		*b = bucket{start: start, min: sample, valid: true}
+		return
+	}
+
+	if sample < b.min {
+		b.min = sample
+	}
+}
+
+func (samples *clusterSamples) estimate(width time.Duration, now time.Time) (time.Duration, bool) {
+	windowStart := now.Add(-width * numBuckets)
+
+	var result time.Duration
+	found := false
+
+	for _, b := range samples.buckets {
+		if b.valid && b.start.After(windowStart) && (!found || b.min < result) {
+			result = b.min
+			found = true
+		}
+	}
+
+	return result, found
+}
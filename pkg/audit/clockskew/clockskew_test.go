@@ -0,0 +1,50 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clockskew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateWindowMinimum(t *testing.T) {
+	assert := assert.New(t)
+
+	width := time.Second * 30
+	base := time.Unix(1700000000, 0)
+	samples := &clusterSamples{}
+
+	samples.observe(width, base, time.Second*3)
+	samples.observe(width, base.Add(time.Second), time.Second*2)
+	samples.observe(width, base.Add(width), time.Second*4)
+
+	offset, ok := samples.estimate(width, base.Add(width))
+	assert.True(ok)
+	assert.Equal(time.Second*2, offset)
+
+	// the first bucket falls out of the window
+	samples.observe(width, base.Add(width*numBuckets), time.Second*5)
+	offset, ok = samples.estimate(width, base.Add(width*numBuckets))
+	assert.True(ok)
+	assert.Equal(time.Second*4, offset)
+}
+
+func TestEstimateEmpty(t *testing.T) {
+	samples := &clusterSamples{}
+	_, ok := samples.estimate(time.Second, time.Unix(1700000000, 0))
+	assert.False(t, ok)
+}
@@ -18,11 +18,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -33,11 +38,19 @@ import (
 	"github.com/kubewharf/kelemetry/pkg/aggregator"
 	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
 	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/audit/clockskew"
 	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/audit/signature"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
 	"github.com/kubewharf/kelemetry/pkg/filter"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterid"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clustershard"
 	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/memory"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
+	"github.com/kubewharf/kelemetry/pkg/util/channel"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
@@ -56,6 +69,15 @@ type options struct {
 	clusterFilter     string
 	ignoreImpersonate bool
 	enableSubObject   bool
+	requestActor      bool
+	workerCount       int
+	drainTimeout      time.Duration
+
+	summarizeFailures   bool
+	summarizeCodes      []int
+	summarizeWindow     time.Duration
+	summarizeTop        int
+	summarizeMaxObjects int
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -75,6 +97,53 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		"if set to true, direct username is always used even with impersonation",
 	)
 	fs.BoolVar(&options.enableSubObject, "audit-consumer-group-failures", false, "whether failed requests should be grouped together")
+	fs.BoolVar(
+		&options.requestActor,
+		"audit-consumer-request-metric-actor",
+		false,
+		"label the audit_consumer_request metric with the names of inferred controllers, schedulers and system components; "+
+			"service accounts and human users are only labeled by actor type to bound cardinality",
+	)
+	fs.IntVar(
+		&options.workerCount,
+		"audit-consumer-worker-count",
+		0,
+		"number of workers to process audit events concurrently; "+
+			"events of the same object are always processed serially by the same worker. "+
+			"If zero, events are processed on the message queue consumer goroutine",
+	)
+	fs.DurationVar(
+		&options.drainTimeout,
+		"audit-consumer-drain-timeout",
+		time.Second*10,
+		"maximum duration to finish in-flight audit events during shutdown; "+
+			"should be shorter than --shutdown-timeout to leave time for flushing spans",
+	)
+	fs.BoolVar(
+		&options.summarizeFailures,
+		"audit-consumer-summarize-failures",
+		false,
+		"aggregate failed requests with the same response code on the same object into one summary span per window",
+	)
+	fs.IntSliceVar(
+		&options.summarizeCodes,
+		"audit-consumer-summarize-codes",
+		[]int{http.StatusConflict, http.StatusTooManyRequests},
+		"response codes of failed requests to summarize",
+	)
+	fs.DurationVar(
+		&options.summarizeWindow,
+		"audit-consumer-summarize-window",
+		time.Minute,
+		"duration after the first failure of an object after which the summary span is sent",
+	)
+	fs.IntVar(&options.summarizeTop, "audit-consumer-summarize-top", 5, "number of top offending users listed in summary spans")
+	fs.IntVar(
+		&options.summarizeMaxObjects,
+		"audit-consumer-summarize-max-objects",
+		10000,
+		"maximum number of objects with pending summaries; further failures are traced individually",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return &options.enable }
@@ -85,15 +154,42 @@ type receiver struct {
 	Clock          clock.Clock
 	Aggregator     aggregator.Aggregator
 	Mq             mq.Queue
+	Signer         *signature.Signer
 	DecoratorList  *manager.List[audit.Decorator]
 	Filter         filter.Filter
 	Metrics        metrics.Client
 	DiscoveryCache discovery.DiscoveryCache
+	ClockSkew      *clockskew.Estimator
+	ClusterShard   *clustershard.Assigner
+	ClusterId      *clusterid.Identifier
+	SelfTrace      *selftrace.Tracer
+	Dropped        *dropped.Recorder
+	Memory         *memory.Watchdog
 
 	ConsumeMetric    *metrics.Metric[*consumeMetric]
 	E2eLatencyMetric *metrics.Metric[*e2eLatencyMetric]
+	RequestMetric    *metrics.Metric[*requestMetric]
+
+	consumers  map[mq.PartitionId]mq.Consumer
+	workers    []*channel.UnboundedQueue[*workerTask]
+	workersWg  sync.WaitGroup
+	summarizer *failureSummarizer
 
-	consumers map[mq.PartitionId]mq.Consumer
+	// workerCtx outlives the shutdown signal so that dispatched tasks can be drained.
+	workerCtx    context.Context
+	cancelWorker context.CancelFunc
+}
+
+// workerTask is an audit message or a failure summary dispatched to the worker that owns its object.
+// A nil task marks the end of the queue during drain.
+type workerTask struct {
+	logger    logrus.FieldLogger
+	message   *audit.Message
+	metric    *consumeMetric
+	startTime time.Time
+	summary   *summaryFlush
+	// the self tracing span that dispatched the task
+	spanContext oteltrace.SpanContext
 }
 
 var _ manager.Component = &receiver{}
@@ -115,6 +211,12 @@ type e2eLatencyMetric struct {
 
 func (*e2eLatencyMetric) MetricName() string { return "audit_consumer_e2e_latency" }
 
+type workerLagMetric struct {
+	Worker int
+}
+
+func (*workerLagMetric) MetricName() string { return "audit_consumer_worker_lag" }
+
 func (recv *receiver) Options() manager.Options {
 	return &recv.options
 }
@@ -136,11 +238,106 @@ func (recv *receiver) Init() error {
 		recv.consumers[partition] = consumer
 	}
 
+	recv.workers = make([]*channel.UnboundedQueue[*workerTask], recv.options.workerCount)
+	for i := range recv.workers {
+		recv.workers[i] = channel.NewUnboundedQueue[*workerTask](16)
+		channel.InitMetricLoop(recv.workers[i], recv.Metrics, &workerLagMetric{Worker: i})
+	}
+
+	if recv.options.summarizeFailures {
+		if recv.options.summarizeWindow <= 0 {
+			return fmt.Errorf("--audit-consumer-summarize-window must be positive")
+		}
+
+		recv.summarizer = newFailureSummarizer(
+			recv.options.summarizeCodes,
+			recv.options.summarizeWindow,
+			recv.options.summarizeTop,
+			recv.options.summarizeMaxObjects,
+		)
+	}
+
+	return nil
+}
+
+func (recv *receiver) Start(ctx context.Context) error {
+	recv.workerCtx, recv.cancelWorker = context.WithCancel(context.WithoutCancel(ctx))
+
+	recv.workersWg.Add(len(recv.workers))
+
+	for workerId, queue := range recv.workers {
+		go recv.runWorker(workerId, queue)
+	}
+
+	if recv.summarizer != nil {
+		go recv.runSummaryLoop(ctx)
+	}
+
 	return nil
 }
 
-func (recv *receiver) Start(ctx context.Context) error { return nil }
-func (recv *receiver) Close(ctx context.Context) error { return nil }
+// Close drains the consumer before the message queue and the aggregator are closed.
+// Consumers stop claiming new messages and finish the in-flight message,
+// then workers finish the tasks already dispatched to them.
+// Remaining work is abandoned when the drain timeout is exceeded.
+func (recv *receiver) Close(ctx context.Context) error {
+	defer recv.cancelWorker()
+
+	ctx, cancelFunc := context.WithTimeout(ctx, recv.options.drainTimeout)
+	defer cancelFunc()
+
+	for partition, consumer := range recv.consumers {
+		if err := consumer.Drain(ctx); err != nil {
+			return fmt.Errorf("draining consumer for partition %d: %w", partition, err)
+		}
+	}
+
+	if recv.summarizer != nil {
+		for _, flush := range recv.summarizer.flush(time.Time{}) {
+			recv.dispatchSummary(flush)
+		}
+	}
+
+	for _, queue := range recv.workers {
+		queue.Send(nil)
+	}
+
+	workersDone := make(chan struct{})
+	go func() {
+		defer shutdown.RecoverPanic(recv.Logger)
+		recv.workersWg.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+		return nil
+	case <-ctx.Done():
+		pending := 0
+		for _, queue := range recv.workers {
+			pending += queue.Length()
+		}
+		return fmt.Errorf("draining workers: %w (%d tasks pending)", ctx.Err(), pending)
+	}
+}
+
+func (recv *receiver) runWorker(workerId int, queue *channel.UnboundedQueue[*workerTask]) {
+	defer recv.workersWg.Done()
+	defer shutdown.RecoverPanic(recv.Logger.WithField("worker", workerId))
+
+	for {
+		select {
+		case <-recv.workerCtx.Done():
+			return
+		case task, chOpen := <-queue.Receiver():
+			if !chOpen || task == nil {
+				return
+			}
+
+			recv.processItem(recv.workerCtx, task)
+		}
+	}
+}
 
 func (recv *receiver) handleMessage(
 	ctx context.Context,
@@ -152,27 +349,50 @@ func (recv *receiver) handleMessage(
 ) {
 	logger := fieldLogger.WithField("mod", "audit-consumer")
 
+	// slow down consumption under memory pressure so that the backlog stays in the message queue
+	recv.Memory.Throttle(ctx)
+
 	metric := &consumeMetric{
 		ConsumerGroup: consumerGroup,
 		Partition:     partition,
 	}
-	defer recv.ConsumeMetric.DeferCount(recv.Clock.Now(), metric)
+	startTime := recv.Clock.Now()
 
 	// The first part of the message key is always the cluster no matter what partitioning method we use.
-	cluster := strings.SplitN(string(msgKey), "/", 2)[0]
+	cluster := recv.ClusterId.Normalize(strings.SplitN(string(msgKey), "/", 2)[0])
 	metric.Cluster = cluster
 
 	if recv.options.clusterFilter != "" && recv.options.clusterFilter != cluster {
+		recv.ConsumeMetric.DeferCount(startTime, metric)
 		return
 	}
 
-	message := &audit.Message{}
-	if err := json.Unmarshal(msgValue, message); err != nil {
-		logger.WithError(err).Error("error decoding audit data")
+	msgValue, integrity, err := recv.Signer.Open(msgValue)
+	if err != nil {
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "Signature", err)
+		recv.ConsumeMetric.DeferCount(startTime, metric)
 		return
 	}
 
-	recv.handleItem(ctx, logger.WithField("auditId", message.Event.AuditID), message, metric)
+	message := &audit.Message{Integrity: integrity}
+	if err := audit.DecodeMessage(msgValue, message); err != nil {
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "Decode", err)
+		recv.ConsumeMetric.DeferCount(startTime, metric)
+		return
+	}
+
+	// messages produced by older versions or other sources may carry non-canonical names
+	message.Cluster = recv.ClusterId.Normalize(message.Cluster)
+
+	ctx, span := recv.SelfTrace.StartChildSpan(
+		recv.SelfTrace.Extract(ctx, message.TraceParent),
+		"audit.consume",
+		attribute.String("cluster", message.Cluster),
+		attribute.Int("partition", int(partition)),
+	)
+	defer span.End()
+
+	recv.handleItem(ctx, logger.WithField("auditId", message.Event.AuditID), message, metric, startTime)
 }
 
 var supportedVerbs = sets.NewString(
@@ -182,34 +402,141 @@ var supportedVerbs = sets.NewString(
 	audit.VerbPatch,
 )
 
+// handleItem filters the message and resolves its object reference,
+// then processes it directly or dispatches it to the worker that owns the object.
 func (recv *receiver) handleItem(
 	ctx context.Context,
 	logger logrus.FieldLogger,
 	message *audit.Message,
 	metric *consumeMetric,
+	startTime time.Time,
 ) {
 	defer shutdown.RecoverPanic(logger)
 
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			recv.ConsumeMetric.DeferCount(startTime, metric)
+		}
+	}()
+
+	recv.ClockSkew.Observe(message.Cluster, message.StageTimestamp.Time, message.ReceiveTime)
+
+	if !recv.ClusterShard.Owns(message.Cluster) {
+		// processed by the replica that owns the cluster
+		return
+	}
+
+	recv.observeRequest(message)
+
 	if !supportedVerbs.Has(message.Verb) {
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "UnsupportedVerb", nil)
 		return
 	}
 
 	if message.Stage != auditv1.StageResponseComplete {
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "IncompleteStage", nil)
 		return
 	}
 
 	if !recv.Filter.TestAuditEvent(&message.Event) {
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "Filtered", nil)
 		return
 	}
 
 	if message.ObjectRef == nil || message.ObjectRef.Name == "" {
 		// try reconstructing ObjectRef from ResponseObject
 		if err := recv.inferObjectRef(message); err != nil {
-			logger.WithError(err).Debug("Invalid objectRef, cannot infer")
+			recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "NoObjectRef", err)
 			return
 		}
 	}
 
+	if len(recv.workers) == 0 {
+		recv.sendItem(ctx, logger, message, metric)
+		return
+	}
+
+	objectKey := utilobject.RichFromAudit(message.ObjectRef, message.Cluster).Key
+	workerId := recv.workerFor(objectKey)
+
+	recv.workers[workerId].Send(&workerTask{
+		logger:      logger.WithField("worker", workerId),
+		message:     message,
+		metric:      metric,
+		startTime:   startTime,
+		spanContext: oteltrace.SpanContextFromContext(ctx),
+	})
+	dispatched = true
+}
+
+func (recv *receiver) workerFor(objectKey utilobject.Key) int {
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(objectKey.String())) // fnv.Write is infallible
+	return int(hasher.Sum32() % uint32(len(recv.workers)))
+}
+
+func (recv *receiver) runSummaryLoop(ctx context.Context) {
+	defer shutdown.RecoverPanic(recv.Logger)
+
+	ticker := recv.Clock.Tick(recv.options.summarizeWindow / 4)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker:
+			for _, flush := range recv.summarizer.flush(recv.Clock.Now()) {
+				recv.dispatchSummary(flush)
+			}
+		}
+	}
+}
+
+// dispatchSummary sends a failure summary through the worker that owns the object,
+// so that it is not sent concurrently with other events of the same object.
+func (recv *receiver) dispatchSummary(flush summaryFlush) {
+	logger := recv.Logger.WithFields(flush.object.AsFields("object"))
+
+	if len(recv.workers) == 0 {
+		recv.sendEvent(recv.workerCtx, logger, flush.object, flush.event)
+		return
+	}
+
+	workerId := recv.workerFor(flush.object.Key)
+	recv.workers[workerId].Send(&workerTask{
+		logger:  logger.WithField("worker", workerId),
+		summary: &flush,
+	})
+}
+
+func (recv *receiver) processItem(ctx context.Context, task *workerTask) {
+	defer shutdown.RecoverPanic(task.logger)
+
+	if task.summary != nil {
+		recv.sendEvent(ctx, task.logger, task.summary.object, task.summary.event)
+		return
+	}
+	defer recv.ConsumeMetric.DeferCount(task.startTime, task.metric)
+
+	ctx, span := recv.SelfTrace.StartChildSpan(oteltrace.ContextWithSpanContext(ctx, task.spanContext), "audit.worker")
+	defer span.End()
+
+	recv.sendItem(ctx, task.logger, task.message, task.metric)
+}
+
+// sendItem converts the message into an aggregator event and sends it.
+// Messages for the same object must not be sent concurrently.
+func (recv *receiver) sendItem(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	message *audit.Message,
+	metric *consumeMetric,
+) {
+	if offset := recv.ClockSkew.Offset(message.Cluster); offset != 0 {
+		message.RequestReceivedTimestamp.Time = message.RequestReceivedTimestamp.Add(offset)
+		message.StageTimestamp.Time = message.StageTimestamp.Add(offset)
+	}
+
 	objectRef := utilobject.RichFromAudit(message.ObjectRef, message.Cluster)
 
 	if message.ResponseObject != nil {
@@ -219,7 +546,7 @@ func (recv *receiver) handleItem(
 
 		err := json.Unmarshal(message.ResponseObject.Raw, &objectRef.Raw.Object)
 		if err != nil {
-			logger.Errorf("cannot decode responseObject: %s", err.Error())
+			recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "DecodeResponseObject", err)
 			return
 		}
 	}
@@ -234,10 +561,7 @@ func (recv *receiver) handleItem(
 		WithField("name", message.ObjectRef.Name).
 		WithField("latency", e2eLatency)
 
-	username := message.User.Username
-	if message.ImpersonatedUser != nil && !recv.options.ignoreImpersonate {
-		username = message.ImpersonatedUser.Username
-	}
+	username := recv.usernameOf(message)
 	title := fmt.Sprintf("%s %s", username, message.Verb)
 	if message.ObjectRef.Subresource != "" {
 		title += fmt.Sprintf(" %s", message.ObjectRef.Subresource)
@@ -256,6 +580,14 @@ func (recv *receiver) handleItem(
 		SetTag("apiserver", message.ApiserverAddr).
 		SetTag("tag", message.Verb)
 
+	if message.ObjectRef.Subresource != "" {
+		event = event.SetTag("subresource", message.ObjectRef.Subresource)
+	}
+
+	if message.Integrity != "" {
+		event = event.SetTag("integrity", message.Integrity)
+	}
+
 	if len(message.SourceIPs) > 0 {
 		event = event.SetTag("sourceIP", message.SourceIPs[0])
 
@@ -274,14 +606,31 @@ func (recv *receiver) handleItem(
 		Resource: objectRef.Resource,
 	}).Summary(float64(e2eLatency.Nanoseconds()))
 
+	metric.HasTrace = true
+
+	if recv.summarizer != nil && recv.summarizer.intercept(objectRef, message, event) {
+		fieldLogger.Debug("Summarize")
+		return
+	}
+
+	recv.sendEvent(ctx, fieldLogger, objectRef, event)
+}
+
+// usernameOf returns the user that a request is attributed to.
+func (recv *receiver) usernameOf(message *audit.Message) string {
+	if message.ImpersonatedUser != nil && !recv.options.ignoreImpersonate {
+		return message.ImpersonatedUser.Username
+	}
+	return message.User.Username
+}
+
+func (recv *receiver) sendEvent(ctx context.Context, logger logrus.FieldLogger, objectRef utilobject.Rich, event *aggregatorevent.Event) {
 	err := recv.Aggregator.Send(ctx, objectRef, event)
 	if err != nil {
-		fieldLogger.WithError(err).Error()
+		recv.Dropped.Drop(logger, dropped.StageAuditConsumer, "Send", err)
 	} else {
-		fieldLogger.Debug("Send")
+		logger.Debug("Send")
 	}
-
-	metric.HasTrace = true
 }
 
 func (receiver *receiver) inferObjectRef(message *audit.Message) error {
@@ -0,0 +1,90 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/audit/actor"
+)
+
+// requestMetric counts all completed requests received from the apiserver, including verbs that are not traced,
+// for capacity planning and identifying the clients that send the most requests.
+// The histogram value is the request duration in nanoseconds.
+type requestMetric struct {
+	Cluster     string
+	ApiGroup    schema.GroupVersion
+	Resource    string
+	Subresource string
+	Verb        string
+	ActorType   string
+	Actor       string
+	Code        string
+}
+
+func (*requestMetric) MetricName() string { return "audit_consumer_request" }
+
+func (recv *receiver) observeRequest(message *audit.Message) {
+	if message.Stage != auditv1.StageResponseComplete {
+		return
+	}
+
+	metric := &requestMetric{
+		Cluster: message.Cluster,
+		Verb:    message.Verb,
+	}
+
+	if ref := message.ObjectRef; ref != nil {
+		metric.ApiGroup = schema.GroupVersion{Group: ref.APIGroup, Version: ref.APIVersion}
+		metric.Resource = ref.Resource
+		metric.Subresource = ref.Subresource
+	}
+
+	if message.ResponseStatus != nil {
+		metric.Code = codeClass(message.ResponseStatus.Code)
+	}
+
+	requestActor := actor.Infer(nil, actor.Identity{Username: recv.usernameOf(message), UserAgent: message.UserAgent})
+	metric.ActorType = string(requestActor.Type)
+	if recv.options.requestActor && hasBoundedNames(requestActor.Type) {
+		metric.Actor = requestActor.Name
+	}
+
+	duration := message.StageTimestamp.Sub(message.RequestReceivedTimestamp.Time)
+	recv.RequestMetric.With(metric).Histogram(float64(duration.Nanoseconds()))
+}
+
+// codeClass groups response codes by their first digit, e.g. "2xx".
+func codeClass(code int32) string {
+	if code < 100 || code >= 600 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// hasBoundedNames returns whether the number of distinct actor names of the type is bounded by the cluster setup
+// rather than the number of users or tenants.
+func hasBoundedNames(ty actor.Type) bool {
+	switch ty {
+	case actor.TypeController, actor.TypeScheduler, actor.TypeNode, actor.TypeSystem:
+		return true
+	default:
+		return false
+	}
+}
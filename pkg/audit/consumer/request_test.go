@@ -0,0 +1,80 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestObserveRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, metricsOutput := metrics.NewMock(clock)
+
+	recv := &receiver{
+		options:       options{requestActor: true},
+		RequestMetric: metrics.New[*requestMetric](metricsClient),
+	}
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	message := func(username string, stage auditv1.Stage) *audit.Message {
+		return &audit.Message{
+			Cluster: "c",
+			Event: auditv1.Event{
+				Stage:                    stage,
+				Verb:                     "list",
+				User:                     authnv1.UserInfo{Username: username},
+				UserAgent:                "test",
+				ObjectRef:                &auditv1.ObjectReference{Resource: "pods", APIVersion: "v1"},
+				ResponseStatus:           &metav1.Status{Code: 200},
+				RequestReceivedTimestamp: metav1.NewMicroTime(base),
+				StageTimestamp:           metav1.NewMicroTime(base.Add(time.Millisecond)),
+			},
+		}
+	}
+
+	recv.observeRequest(message("system:kube-scheduler", auditv1.StageResponseComplete))
+	recv.observeRequest(message("system:kube-scheduler", auditv1.StageRequestReceived))
+	recv.observeRequest(message("alice", auditv1.StageResponseComplete))
+
+	tags := map[string]string{
+		"cluster":     "c",
+		"apiGroup":    "v1",
+		"resource":    "pods",
+		"subresource": "",
+		"verb":        "list",
+		"code":        "2xx",
+	}
+
+	tags["actorType"], tags["actor"] = "scheduler", "kube-scheduler"
+	entry := metricsOutput.Get("audit_consumer_request", tags)
+	assert.Equal([]float64{float64(time.Millisecond)}, entry.Hist, metricsOutput.PrintAll())
+
+	// user names are not used as labels
+	tags["actorType"], tags["actor"] = "user", ""
+	entry = metricsOutput.Get("audit_consumer_request", tags)
+	assert.Len(entry.Hist, 1, metricsOutput.PrintAll())
+}
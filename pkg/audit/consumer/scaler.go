@@ -0,0 +1,108 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("audit-consumer-scaler", manager.Ptr(&scaler{}))
+}
+
+type scalerOptions struct {
+	enable bool
+}
+
+func (options *scalerOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"audit-consumer-scaler-enable",
+		false,
+		"serve the audit backlog of this replica at /scaler/audit-consumer for autoscalers such as the KEDA metrics-api scaler",
+	)
+}
+
+func (options *scalerOptions) EnableFlag() *bool { return &options.enable }
+
+// scaler exposes the audit backlog as a scaling signal,
+// which correlates with the required number of consumer replicas better than CPU usage.
+type scaler struct {
+	options  scalerOptions
+	Logger   logrus.FieldLogger
+	Server   kelemetryhttp.Server
+	Metrics  metrics.Client
+	Consumer *receiver
+}
+
+type backlogMetric struct{}
+
+func (*backlogMetric) MetricName() string { return "audit_consumer_backlog" }
+
+var _ manager.Component = &scaler{}
+
+func (scaler *scaler) Options() manager.Options { return &scaler.options }
+
+func (scaler *scaler) Init() error {
+	scaler.Server.Routes().GET("/scaler/audit-consumer", func(ctx *gin.Context) {
+		defer shutdown.RecoverPanic(scaler.Logger)
+		ctx.JSON(http.StatusOK, scaler.Consumer.backlog())
+	})
+
+	metrics.NewMonitor(scaler.Metrics, &backlogMetric{}, func() float64 { return float64(scaler.Consumer.backlog().Total) })
+
+	return nil
+}
+
+func (scaler *scaler) Start(ctx context.Context) error { return nil }
+func (scaler *scaler) Close(ctx context.Context) error { return nil }
+
+type backlog struct {
+	// Lag is the number of messages in the consumed partitions not handled yet,
+	// if reported by the message queue.
+	Lag int64 `json:"lag"`
+	// Pending is the number of messages dispatched to workers but not processed yet.
+	Pending int64 `json:"pending"`
+	// Total is the sum of Lag and Pending.
+	Total int64 `json:"total"`
+}
+
+func (recv *receiver) backlog() backlog {
+	var result backlog
+
+	for _, consumer := range recv.consumers {
+		if reporter, ok := consumer.(mq.LagReporter); ok {
+			result.Lag += reporter.Lag()
+		}
+	}
+
+	for _, queue := range recv.workers {
+		result.Pending += int64(queue.Length())
+	}
+
+	result.Total = result.Lag + result.Pending
+	return result
+}
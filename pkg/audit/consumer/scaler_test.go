@@ -0,0 +1,54 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/util/channel"
+)
+
+type lagConsumer struct {
+	mq.Consumer
+	lag int64
+}
+
+func (consumer lagConsumer) Lag() int64 { return consumer.lag }
+
+func TestBacklog(t *testing.T) {
+	assert := assert.New(t)
+
+	recv := &receiver{
+		consumers: map[mq.PartitionId]mq.Consumer{
+			0: lagConsumer{lag: 3},
+			1: lagConsumer{lag: 4},
+			// consumers that do not report lag are ignored
+			2: nil,
+		},
+		workers: []*channel.UnboundedQueue[*workerTask]{
+			channel.NewUnboundedQueue[*workerTask](1),
+			channel.NewUnboundedQueue[*workerTask](1),
+		},
+	}
+
+	recv.workers[0].Send(&workerTask{})
+	recv.workers[1].Send(&workerTask{})
+	recv.workers[1].Send(&workerTask{})
+
+	assert.Equal(backlog{Lag: 7, Pending: 3, Total: 10}, recv.backlog())
+}
@@ -0,0 +1,193 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+// failureSummarizer aggregates failed requests with the same response code on the same object
+// into a single summary event per window, so that hot-looping clients do not flood the trace.
+type failureSummarizer struct {
+	codes      map[int32]bool
+	window     time.Duration
+	topN       int
+	maxObjects int
+
+	mu      sync.Mutex
+	buckets map[summaryKey]*summaryBucket
+}
+
+type summaryKey struct {
+	object utilobject.Key
+	code   int32
+}
+
+type summaryBucket struct {
+	object utilobject.Rich
+	code   int32
+	// the original event, sent as-is if it is the only failure in the window
+	first     *aggregatorevent.Event
+	start     time.Time
+	end       time.Time
+	count     int
+	offenders map[string]int
+	verbs     map[string]struct{}
+	sample    string
+}
+
+// summaryFlush is a summary event to be sent to the object trace.
+type summaryFlush struct {
+	object utilobject.Rich
+	event  *aggregatorevent.Event
+}
+
+func newFailureSummarizer(codes []int, window time.Duration, topN int, maxObjects int) *failureSummarizer {
+	codeSet := make(map[int32]bool, len(codes))
+	for _, code := range codes {
+		codeSet[int32(code)] = true
+	}
+
+	return &failureSummarizer{
+		codes:      codeSet,
+		window:     window,
+		topN:       topN,
+		maxObjects: maxObjects,
+		buckets:    map[summaryKey]*summaryBucket{},
+	}
+}
+
+// intercept buffers the event if it is a failure to be summarized.
+// Returns false if the event should be sent directly.
+func (summarizer *failureSummarizer) intercept(object utilobject.Rich, message *audit.Message, event *aggregatorevent.Event) bool {
+	if message.ResponseStatus == nil || !summarizer.codes[message.ResponseStatus.Code] {
+		return false
+	}
+
+	summarizer.mu.Lock()
+	defer summarizer.mu.Unlock()
+
+	key := summaryKey{object: object.Key, code: message.ResponseStatus.Code}
+	bucket, exists := summarizer.buckets[key]
+	if !exists {
+		if len(summarizer.buckets) >= summarizer.maxObjects {
+			return false
+		}
+
+		bucket = &summaryBucket{
+			object:    object.Clone(),
+			code:      message.ResponseStatus.Code,
+			first:     event,
+			start:     message.RequestReceivedTimestamp.Time,
+			offenders: map[string]int{},
+			verbs:     map[string]struct{}{},
+			sample:    fmt.Sprintf("%s: %s", message.ResponseStatus.Reason, message.ResponseStatus.Message),
+		}
+		summarizer.buckets[key] = bucket
+	}
+
+	bucket.count++
+	if end := message.StageTimestamp.Time; end.After(bucket.end) {
+		bucket.end = end
+	}
+
+	username, _ := event.Tags["username"].(string)
+	bucket.offenders[username]++
+	bucket.verbs[message.Verb] = struct{}{}
+
+	return true
+}
+
+// flush removes the buckets whose window has elapsed before now, or all buckets if now is zero.
+func (summarizer *failureSummarizer) flush(now time.Time) []summaryFlush {
+	summarizer.mu.Lock()
+	defer summarizer.mu.Unlock()
+
+	var flushes []summaryFlush
+	for key, bucket := range summarizer.buckets {
+		if !now.IsZero() && now.Sub(bucket.start) < summarizer.window {
+			continue
+		}
+
+		delete(summarizer.buckets, key)
+		flushes = append(flushes, summaryFlush{object: bucket.object, event: summarizer.summarize(bucket)})
+	}
+
+	return flushes
+}
+
+func (summarizer *failureSummarizer) summarize(bucket *summaryBucket) *aggregatorevent.Event {
+	if bucket.count == 1 {
+		return bucket.first
+	}
+
+	event := aggregatorevent.NewEvent(
+		fmt.Sprintf("%d requests (%s)", bucket.count, http.StatusText(int(bucket.code))),
+		bucket.start,
+		zconstants.TraceSourceAudit,
+	).
+		SetEndTime(bucket.end).
+		SetTag("responseCode", bucket.code).
+		SetTag("count", bucket.count).
+		SetTag("topOffenders", summarizer.topOffenders(bucket.offenders)).
+		SetTag("verbs", strings.Join(sortedKeys(bucket.verbs), ",")).
+		SetTag("tag", "summary").
+		Log(zconstants.LogTypeRealError, bucket.sample)
+
+	return event
+}
+
+func (summarizer *failureSummarizer) topOffenders(offenders map[string]int) string {
+	names := make([]string, 0, len(offenders))
+	for name := range offenders {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if offenders[names[i]] != offenders[names[j]] {
+			return offenders[names[i]] > offenders[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	if len(names) > summarizer.topN {
+		names = names[:summarizer.topN]
+	}
+
+	entries := make([]string, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fmt.Sprintf("%s=%d", name, offenders[name]))
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
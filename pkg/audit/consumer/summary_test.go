@@ -0,0 +1,84 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditconsumer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func failedMessage(code int32, verb string, when time.Time) *audit.Message {
+	return &audit.Message{
+		Event: auditv1.Event{
+			Verb:                     verb,
+			ResponseStatus:           &metav1.Status{Code: code, Reason: metav1.StatusReasonConflict, Message: "object has been modified"},
+			RequestReceivedTimestamp: metav1.NewMicroTime(when),
+			StageTimestamp:           metav1.NewMicroTime(when.Add(time.Millisecond)),
+		},
+	}
+}
+
+func TestFailureSummarizer(t *testing.T) {
+	summarizer := newFailureSummarizer([]int{http.StatusConflict}, time.Minute, 1, 10)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	object := utilobject.Rich{VersionedKey: utilobject.VersionedKey{
+		Key: utilobject.Key{Cluster: "c", Group: "apps", Resource: "deployments", Namespace: "default", Name: "app"},
+	}}
+	single := object
+	single.Name = "single"
+
+	for i, username := range []string{"ctrl-a", "ctrl-b", "ctrl-a"} {
+		event := aggregatorevent.NewEvent("update (Conflict)", base, zconstants.TraceSourceAudit).SetTag("username", username)
+		assert.True(t, summarizer.intercept(object, failedMessage(409, "update", base.Add(time.Duration(i)*time.Second)), event))
+	}
+
+	singleEvent := aggregatorevent.NewEvent("patch (Conflict)", base, zconstants.TraceSourceAudit)
+	assert.True(t, summarizer.intercept(single, failedMessage(409, "patch", base), singleEvent))
+
+	// other codes are not summarized
+	assert.False(t, summarizer.intercept(object, failedMessage(404, "update", base), aggregatorevent.NewEvent("", base, "")))
+
+	assert.Empty(t, summarizer.flush(base.Add(time.Second*30)))
+
+	flushes := summarizer.flush(base.Add(time.Minute))
+	assert.Len(t, flushes, 2)
+
+	for _, flush := range flushes {
+		if flush.object.Name == "single" {
+			assert.Same(t, singleEvent, flush.event)
+			continue
+		}
+
+		assert.Equal(t, "3 requests (Conflict)", flush.event.Title)
+		assert.Equal(t, base, flush.event.Time)
+		assert.Equal(t, base.Add(time.Second*2+time.Millisecond), *flush.event.EndTime)
+		assert.Equal(t, 3, flush.event.Tags["count"])
+		assert.Equal(t, "ctrl-a=2", flush.event.Tags["topOffenders"])
+		assert.Equal(t, "update", flush.event.Tags["verbs"])
+	}
+
+	assert.Empty(t, summarizer.flush(time.Time{}))
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Invalidates the discovery cache of an API group when audit events show that
+// its CustomResourceDefinitions or APIServices have changed,
+// so that new resources are recognized without waiting for the next full discovery resync.
+package discoveryinvalidator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("discovery-invalidator", manager.Ptr(&decorator{}), &manager.List[audit.Decorator]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"discovery-invalidator-enable",
+		true,
+		"refresh the discovery cache of an API group when audit events of its CustomResourceDefinitions or APIServices are received",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Discovery discovery.DiscoveryCache
+
+	InvalidateMetric *metrics.Metric[*invalidateMetric]
+}
+
+type invalidateMetric struct {
+	Cluster  string
+	Resource string
+}
+
+func (*invalidateMetric) MetricName() string { return "discovery_invalidate" }
+
+var _ manager.Component = &decorator{}
+
+func (d *decorator) Options() manager.Options        { return &d.options }
+func (d *decorator) Init() error                     { return nil }
+func (d *decorator) Start(ctx context.Context) error { return nil }
+func (d *decorator) Close(ctx context.Context) error { return nil }
+
+func (d *decorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	group, ok := InvalidatedGroup(message)
+	if !ok {
+		return
+	}
+
+	cdc, err := d.Discovery.ForCluster(message.Cluster)
+	if err != nil {
+		d.Logger.WithField("cluster", message.Cluster).WithError(err).Warn("cannot invalidate discovery cache")
+		return
+	}
+
+	cdc.InvalidateGroup(group)
+	d.InvalidateMetric.With(&invalidateMetric{Cluster: message.Cluster, Resource: message.ObjectRef.Resource}).Count(1)
+}
+
+// InvalidatedGroup returns the API group whose discovery results may be changed by a successful audit event.
+// The status subresource is included because new resources are only served after the CRD becomes established.
+func InvalidatedGroup(message *audit.Message) (string, bool) {
+	ref := message.ObjectRef
+	if ref == nil {
+		return "", false
+	}
+
+	switch message.Verb {
+	case audit.VerbCreate, audit.VerbUpdate, audit.VerbPatch, audit.VerbDelete:
+	default:
+		return "", false
+	}
+
+	if message.ResponseStatus != nil && (message.ResponseStatus.Code < 200 || message.ResponseStatus.Code >= 300) {
+		return "", false
+	}
+
+	switch {
+	case ref.APIGroup == "apiextensions.k8s.io" && ref.Resource == "customresourcedefinitions":
+		// named as "<plural>.<group>"
+		_, group, ok := strings.Cut(ref.Name, ".")
+		return group, ok
+	case ref.APIGroup == "apiregistration.k8s.io" && ref.Resource == "apiservices":
+		// named as "<version>.<group>", where the group is empty for the core group
+		_, group, ok := strings.Cut(ref.Name, ".")
+		return group, ok
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discoveryinvalidator_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/audit/discoveryinvalidator"
+)
+
+func message(verb string, code int32, group, resource, name string) *audit.Message {
+	return &audit.Message{Event: auditv1.Event{
+		Verb:           verb,
+		ObjectRef:      &auditv1.ObjectReference{APIGroup: group, Resource: resource, Name: name},
+		ResponseStatus: &metav1.Status{Code: code},
+	}}
+}
+
+func TestInvalidatedGroup(t *testing.T) {
+	for _, testCase := range []struct {
+		name    string
+		message *audit.Message
+		group   string
+		ok      bool
+	}{
+		{"crd", message("create", 201, "apiextensions.k8s.io", "customresourcedefinitions", "widgets.example.com"), "example.com", true},
+		{"apiservice", message("update", 200, "apiregistration.k8s.io", "apiservices", "v1beta1.metrics.k8s.io"), "metrics.k8s.io", true},
+		{"core apiservice", message("update", 200, "apiregistration.k8s.io", "apiservices", "v1."), "", true},
+		{"failed", message("create", 409, "apiextensions.k8s.io", "customresourcedefinitions", "widgets.example.com"), "", false},
+		{"read", message("get", 200, "apiextensions.k8s.io", "customresourcedefinitions", "widgets.example.com"), "", false},
+		{"other", message("create", 201, "apps", "deployments", "foo"), "", false},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			group, ok := discoveryinvalidator.InvalidatedGroup(testCase.message)
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.group, group)
+		})
+	}
+}
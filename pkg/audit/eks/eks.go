@@ -0,0 +1,258 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ingests EKS control plane audit logs from CloudWatch Logs.
+//
+// The kube-apiserver-audit log streams of EKS clusters should be streamed
+// through a CloudWatch Logs subscription filter to a Kinesis Data Firehose delivery stream
+// with an HTTP endpoint destination targeting the /audit/eks endpoint.
+package auditeks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/utils/clock"
+
+	auditwebhook "github.com/kubewharf/kelemetry/pkg/audit/webhook"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("audit-eks", manager.Ptr(&receiver{}))
+}
+
+type options struct {
+	enable         bool
+	accessKey      string
+	clusterNames   map[string]string
+	maxRecordBytes int64
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "audit-eks-enable", false, "enable ingestion of EKS audit logs from Kinesis Data Firehose")
+	fs.StringVar(
+		&options.accessKey,
+		"audit-eks-access-key",
+		"",
+		"if nonempty, Firehose requests must contain this value in the X-Amz-Firehose-Access-Key header",
+	)
+	fs.StringToStringVar(
+		&options.clusterNames,
+		"audit-eks-cluster-name",
+		map[string]string{},
+		"map EKS cluster names to kelemetry cluster names; unmapped clusters keep the EKS name",
+	)
+	fs.Int64Var(
+		&options.maxRecordBytes,
+		"audit-eks-max-record-bytes",
+		16<<20,
+		"maximum size of each Firehose record after decompression; larger records are rejected",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+func (options *options) Validate() error {
+	if options.maxRecordBytes <= 0 {
+		return fmt.Errorf("--audit-eks-max-record-bytes must be positive")
+	}
+	return nil
+}
+
+type receiver struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Server  kelemetryhttp.Server
+	Webhook auditwebhook.Webhook
+
+	RecordMetric *metrics.Metric[*recordMetric]
+}
+
+type recordMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*recordMetric) MetricName() string { return "audit_eks_record" }
+
+func (recv *receiver) Options() manager.Options { return &recv.options }
+
+func (recv *receiver) Init() error {
+	recv.Server.Routes().POST("/audit/eks", recv.handleRequest)
+	return nil
+}
+
+func (recv *receiver) Start(ctx context.Context) error { return nil }
+func (recv *receiver) Close(ctx context.Context) error { return nil }
+
+// firehoseRequest is the request body of a Firehose HTTP endpoint delivery.
+type firehoseRequest struct {
+	RequestId string `json:"requestId"`
+	Timestamp int64  `json:"timestamp"`
+	Records   []struct {
+		// Data is base64-encoded, decoded automatically by encoding/json.
+		Data []byte `json:"data"`
+	} `json:"records"`
+}
+
+type firehoseResponse struct {
+	RequestId    string `json:"requestId"`
+	Timestamp    int64  `json:"timestamp"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// logsPayload is the payload delivered by a CloudWatch Logs subscription filter.
+type logsPayload struct {
+	MessageType string `json:"messageType"`
+	LogGroup    string `json:"logGroup"`
+	LogStream   string `json:"logStream"`
+	LogEvents   []struct {
+		Id        string `json:"id"`
+		Timestamp int64  `json:"timestamp"`
+		Message   string `json:"message"`
+	} `json:"logEvents"`
+}
+
+// EKS control plane logs are written to the log group /aws/eks/{cluster}/cluster.
+var logGroupRegex = regexp.MustCompile(`^/aws/eks/([^/]+)/cluster$`)
+
+const auditLogStreamPrefix = "kube-apiserver-audit-"
+
+func (recv *receiver) handleRequest(ctx *gin.Context) {
+	logger := recv.Logger.WithField("source", ctx.Request.RemoteAddr)
+	defer shutdown.RecoverPanic(logger)
+
+	receiveTime := recv.Clock.Now()
+
+	response := firehoseResponse{
+		// the request ID is also sent in the header, so that unauthorized requests are rejected without decoding the body
+		RequestId: ctx.GetHeader("X-Amz-Firehose-Request-Id"),
+		Timestamp: receiveTime.UnixMilli(),
+	}
+
+	if recv.options.accessKey != "" &&
+		subtle.ConstantTimeCompare([]byte(ctx.GetHeader("X-Amz-Firehose-Access-Key")), []byte(recv.options.accessKey)) != 1 {
+		recv.RecordMetric.With(&recordMetric{Error: metrics.MakeLabeledError("Unauthorized")}).Count(1)
+		response.ErrorMessage = "invalid access key"
+		ctx.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	request := &firehoseRequest{}
+	if err := ctx.BindJSON(request); err != nil {
+		logger.WithError(err).Error("cannot decode Firehose request")
+		recv.RecordMetric.With(&recordMetric{Error: metrics.MakeLabeledError("DecodeRequest")}).Count(1)
+		response.ErrorMessage = err.Error()
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	response.RequestId = request.RequestId
+
+	for _, record := range request.Records {
+		metric := &recordMetric{}
+		if err := recv.handleRecord(ctx.Request.Context(), logger, record.Data, receiveTime, metric); err != nil {
+			// do not fail the whole batch, since Firehose would redeliver all records
+			logger.WithError(err).Error()
+			metric.Error = err
+		}
+		recv.RecordMetric.DeferCount(receiveTime, metric)
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (recv *receiver) handleRecord(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	data []byte,
+	receiveTime time.Time,
+	metric *recordMetric,
+) metrics.LabeledError {
+	// subscription filter payloads are gzipped unless decompression is enabled in Firehose
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return metrics.LabelError(fmt.Errorf("cannot decompress record: %w", err), "Decompress")
+		}
+
+		// the body size limit of the HTTP server does not limit the decompressed size
+		data, err = io.ReadAll(io.LimitReader(reader, recv.options.maxRecordBytes+1))
+		if err != nil {
+			return metrics.LabelError(fmt.Errorf("cannot decompress record: %w", err), "Decompress")
+		}
+		if int64(len(data)) > recv.options.maxRecordBytes {
+			return metrics.LabelError(
+				fmt.Errorf("decompressed record exceeds %d bytes", recv.options.maxRecordBytes),
+				"RecordTooLarge",
+			)
+		}
+	}
+
+	payload := &logsPayload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot decode subscription payload: %w", err), "DecodePayload")
+	}
+
+	if payload.MessageType != "DATA_MESSAGE" || !strings.HasPrefix(payload.LogStream, auditLogStreamPrefix) {
+		// control messages and non-audit control plane logs
+		return nil
+	}
+
+	match := logGroupRegex.FindStringSubmatch(payload.LogGroup)
+	if match == nil {
+		return metrics.LabelError(fmt.Errorf("unexpected log group %q", payload.LogGroup), "UnknownLogGroup")
+	}
+
+	cluster := match[1]
+	if mapped, exists := recv.options.clusterNames[cluster]; exists {
+		cluster = mapped
+	}
+	metric.Cluster = cluster
+
+	eventList := &auditv1.EventList{
+		Items: make([]auditv1.Event, 0, len(payload.LogEvents)),
+	}
+	for _, logEvent := range payload.LogEvents {
+		var event auditv1.Event
+		if err := json.Unmarshal([]byte(logEvent.Message), &event); err != nil {
+			logger.WithError(err).WithField("logEventId", logEvent.Id).Warn("cannot decode audit event")
+			continue
+		}
+
+		eventList.Items = append(eventList.Items, event)
+	}
+
+	// the log stream identifies the apiserver instance
+	recv.Webhook.Publish(ctx, cluster, payload.LogStream, receiveTime, eventList)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditeks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func newTestReceiver(options options) *receiver {
+	clock := clocktesting.NewFakeClock(time.Unix(1000, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return &receiver{
+		options:      options,
+		Logger:       logger,
+		Clock:        clock,
+		RecordMetric: metrics.New[*recordMetric](metricsClient),
+	}
+}
+
+func TestUnauthorizedBeforeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	recv := newTestReceiver(options{accessKey: "secret", maxRecordBytes: 1024})
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/audit/eks", strings.NewReader("not json"))
+	ctx.Request.Header.Set("X-Amz-Firehose-Request-Id", "req-1")
+	recv.handleRequest(ctx)
+
+	// the malformed body is not decoded before the access key is checked
+	assert.Equal(http.StatusUnauthorized, recorder.Code)
+	assert.Contains(recorder.Body.String(), "req-1")
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	recv := newTestReceiver(options{maxRecordBytes: 1024})
+
+	compressed := &bytes.Buffer{}
+	writer := gzip.NewWriter(compressed)
+	_, err := writer.Write(make([]byte, 1<<20))
+	assert.NoError(err)
+	assert.NoError(writer.Close())
+
+	err = recv.handleRecord(context.Background(), recv.Logger, compressed.Bytes(), recv.Clock.Now(), &recordMetric{})
+	assert.ErrorContains(err, "exceeds 1024 bytes")
+}
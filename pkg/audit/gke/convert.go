@@ -0,0 +1,236 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditgke
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+// LogEntry is the subset of a Cloud Logging LogEntry used for Kubernetes audit logs.
+type LogEntry struct {
+	InsertId  string    `json:"insertId"`
+	LogName   string    `json:"logName"`
+	Timestamp time.Time `json:"timestamp"`
+	Resource  struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	Operation *struct {
+		Id string `json:"id"`
+	} `json:"operation"`
+	ProtoPayload AuditLog `json:"protoPayload"`
+}
+
+// AuditLog is the subset of google.cloud.audit.AuditLog used for Kubernetes audit logs.
+type AuditLog struct {
+	ServiceName        string `json:"serviceName"`
+	MethodName         string `json:"methodName"`
+	ResourceName       string `json:"resourceName"`
+	AuthenticationInfo struct {
+		PrincipalEmail string `json:"principalEmail"`
+	} `json:"authenticationInfo"`
+	RequestMetadata struct {
+		CallerIp                string `json:"callerIp"`
+		CallerSuppliedUserAgent string `json:"callerSuppliedUserAgent"`
+	} `json:"requestMetadata"`
+	Status *struct {
+		Code    int32  `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response"`
+}
+
+const kubernetesServiceName = "k8s.io"
+
+// ConvertEntry converts a Cloud Audit Log entry into a Kubernetes audit event.
+// Returns nil if the entry is not a Kubernetes API request.
+func ConvertEntry(entry *LogEntry) (*auditv1.Event, error) {
+	payload := &entry.ProtoPayload
+	if payload.ServiceName != kubernetesServiceName {
+		return nil, nil
+	}
+
+	methodParts := strings.Split(payload.MethodName, ".")
+	verb := methodParts[len(methodParts)-1]
+	if len(methodParts) < 2 || verb == "" {
+		return nil, fmt.Errorf("malformed methodName %q", payload.MethodName)
+	}
+
+	objectRef, err := parseResourceName(payload.ResourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	auditId := entry.InsertId
+	if entry.Operation != nil && entry.Operation.Id != "" {
+		auditId = entry.Operation.Id
+	}
+
+	var code int32 = http.StatusOK
+	var statusMessage string
+	if payload.Status != nil {
+		code = rpcCodeToHttp(payload.Status.Code)
+		statusMessage = payload.Status.Message
+	}
+	if code == http.StatusOK && verb == "create" {
+		code = http.StatusCreated
+	}
+
+	timestamp := metav1.NewMicroTime(entry.Timestamp)
+
+	event := &auditv1.Event{
+		Level:      auditv1.LevelRequestResponse,
+		AuditID:    types.UID(auditId),
+		Stage:      auditv1.StageResponseComplete,
+		RequestURI: "/" + payload.ResourceName,
+		Verb:       verb,
+		User: authnv1.UserInfo{
+			Username: payload.AuthenticationInfo.PrincipalEmail,
+		},
+		UserAgent: payload.RequestMetadata.CallerSuppliedUserAgent,
+		ObjectRef: objectRef,
+		ResponseStatus: &metav1.Status{
+			Code:    code,
+			Message: statusMessage,
+		},
+		RequestReceivedTimestamp: timestamp,
+		StageTimestamp:           timestamp,
+	}
+
+	if payload.RequestMetadata.CallerIp != "" {
+		event.SourceIPs = []string{payload.RequestMetadata.CallerIp}
+	}
+
+	if event.RequestObject, err = stripTypeField(payload.Request); err != nil {
+		return nil, fmt.Errorf("malformed request object: %w", err)
+	}
+
+	if event.ResponseObject, err = stripTypeField(payload.Response); err != nil {
+		return nil, fmt.Errorf("malformed response object: %w", err)
+	}
+
+	if event.ResponseObject != nil {
+		var partial metav1.PartialObjectMetadata
+		if err := json.Unmarshal(event.ResponseObject.Raw, &partial); err == nil {
+			objectRef.UID = partial.UID
+			objectRef.ResourceVersion = partial.ResourceVersion
+		}
+	}
+
+	return event, nil
+}
+
+// parseResourceName parses resource names in the form
+// `{group}/{version}[/namespaces/{namespace}]/{resource}/{name}[/{subresource}]`,
+// where the core group is named "core".
+func parseResourceName(resourceName string) (*auditv1.ObjectReference, error) {
+	parts := strings.Split(resourceName, "/")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("malformed resourceName %q", resourceName)
+	}
+
+	objectRef := &auditv1.ObjectReference{
+		APIGroup:   parts[0],
+		APIVersion: parts[1],
+	}
+	if objectRef.APIGroup == "core" {
+		objectRef.APIGroup = ""
+	}
+
+	rest := parts[2:]
+	// "namespaces/{name}[/{subresource}]" itself refers to a cluster-scoped object
+	if rest[0] == "namespaces" && len(rest) >= 3 && !namespaceSubresources[rest[2]] {
+		objectRef.Namespace = rest[1]
+		rest = rest[2:]
+	}
+
+	objectRef.Resource = rest[0]
+	if len(rest) > 1 {
+		// the name is absent for collection requests
+		objectRef.Name = rest[1]
+	}
+	if len(rest) > 2 {
+		objectRef.Subresource = strings.Join(rest[2:], "/")
+	}
+
+	return objectRef, nil
+}
+
+var namespaceSubresources = map[string]bool{"status": true, "finalize": true}
+
+// stripTypeField removes the "@type" field inserted by Cloud Audit Logs.
+func stripTypeField(raw json.RawMessage) (*runtime.Unknown, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+
+	delete(object, "@type")
+
+	stripped, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtime.Unknown{Raw: stripped, ContentType: runtime.ContentTypeJSON}, nil
+}
+
+// rpcCodeToHttp maps google.rpc.Code values to the HTTP status codes returned by the apiserver.
+func rpcCodeToHttp(code int32) int32 {
+	switch code {
+	case 0: // OK
+		return http.StatusOK
+	case 1: // CANCELLED
+		return 499
+	case 3: // INVALID_ARGUMENT
+		return http.StatusUnprocessableEntity
+	case 4: // DEADLINE_EXCEEDED
+		return http.StatusGatewayTimeout
+	case 5: // NOT_FOUND
+		return http.StatusNotFound
+	case 6, 10: // ALREADY_EXISTS, ABORTED
+		return http.StatusConflict
+	case 7: // PERMISSION_DENIED
+		return http.StatusForbidden
+	case 8: // RESOURCE_EXHAUSTED
+		return http.StatusTooManyRequests
+	case 9: // FAILED_PRECONDITION
+		return http.StatusBadRequest
+	case 12: // UNIMPLEMENTED
+		return http.StatusMethodNotAllowed
+	case 14: // UNAVAILABLE
+		return http.StatusServiceUnavailable
+	case 16: // UNAUTHENTICATED
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
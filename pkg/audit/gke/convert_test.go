@@ -0,0 +1,118 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditgke_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	auditgke "github.com/kubewharf/kelemetry/pkg/audit/gke"
+)
+
+const sampleEntry = `{
+	"insertId": "abc",
+	"logName": "projects/p/logs/cloudaudit.googleapis.com%2Factivity",
+	"timestamp": "2023-06-01T12:34:56.789Z",
+	"resource": {"type": "k8s_cluster", "labels": {"cluster_name": "c1", "location": "us-central1"}},
+	"operation": {"id": "7f0c1e2d"},
+	"protoPayload": {
+		"@type": "type.googleapis.com/google.cloud.audit.AuditLog",
+		"serviceName": "k8s.io",
+		"methodName": "io.k8s.apps.v1.deployments.patch",
+		"resourceName": "apps/v1/namespaces/default/deployments/web",
+		"authenticationInfo": {"principalEmail": "alice@example.com"},
+		"requestMetadata": {"callerIp": "10.0.0.1", "callerSuppliedUserAgent": "kubectl/v1.27.0"},
+		"response": {
+			"@type": "apps.k8s.io/v1.Deployment",
+			"apiVersion": "apps/v1",
+			"kind": "Deployment",
+			"metadata": {"name": "web", "namespace": "default", "uid": "u1", "resourceVersion": "42"}
+		}
+	}
+}`
+
+func TestConvertEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	entry := &auditgke.LogEntry{}
+	assert.NoError(json.Unmarshal([]byte(sampleEntry), entry))
+
+	event, err := auditgke.ConvertEntry(entry)
+	assert.NoError(err)
+	assert.NotNil(event)
+
+	assert.Equal("patch", event.Verb)
+	assert.Equal(auditv1.StageResponseComplete, event.Stage)
+	assert.Equal("7f0c1e2d", string(event.AuditID))
+	assert.Equal("alice@example.com", event.User.Username)
+	assert.Equal([]string{"10.0.0.1"}, event.SourceIPs)
+	assert.Equal(int32(200), event.ResponseStatus.Code)
+
+	assert.Equal("apps", event.ObjectRef.APIGroup)
+	assert.Equal("v1", event.ObjectRef.APIVersion)
+	assert.Equal("deployments", event.ObjectRef.Resource)
+	assert.Equal("default", event.ObjectRef.Namespace)
+	assert.Equal("web", event.ObjectRef.Name)
+	assert.Equal("42", event.ObjectRef.ResourceVersion)
+
+	assert.NotContains(string(event.ResponseObject.Raw), "@type")
+}
+
+func TestConvertEntryResourceNames(t *testing.T) {
+	for _, testCase := range []struct {
+		resourceName string
+		group        string
+		namespace    string
+		resource     string
+		name         string
+		subresource  string
+	}{
+		{"core/v1/namespaces/default/pods/foo/status", "", "default", "pods", "foo", "status"},
+		{"core/v1/namespaces/foo", "", "", "namespaces", "foo", ""},
+		{"core/v1/namespaces/foo/finalize", "", "", "namespaces", "foo", "finalize"},
+		{"core/v1/nodes/n1", "", "", "nodes", "n1", ""},
+		{"apps/v1/namespaces/default/deployments", "apps", "default", "deployments", "", ""},
+	} {
+		t.Run(testCase.resourceName, func(t *testing.T) {
+			assert := assert.New(t)
+
+			entry := &auditgke.LogEntry{}
+			entry.ProtoPayload.ServiceName = "k8s.io"
+			entry.ProtoPayload.MethodName = "io.k8s.core.v1.pods.update"
+			entry.ProtoPayload.ResourceName = testCase.resourceName
+
+			event, err := auditgke.ConvertEntry(entry)
+			assert.NoError(err)
+
+			assert.Equal(testCase.group, event.ObjectRef.APIGroup)
+			assert.Equal(testCase.namespace, event.ObjectRef.Namespace)
+			assert.Equal(testCase.resource, event.ObjectRef.Resource)
+			assert.Equal(testCase.name, event.ObjectRef.Name)
+			assert.Equal(testCase.subresource, event.ObjectRef.Subresource)
+		})
+	}
+}
+
+func TestConvertEntrySkipsOtherServices(t *testing.T) {
+	entry := &auditgke.LogEntry{}
+	entry.ProtoPayload.ServiceName = "container.googleapis.com"
+
+	event, err := auditgke.ConvertEntry(entry)
+	assert.NoError(t, err)
+	assert.Nil(t, event)
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ingests GKE control plane audit logs from Cloud Audit Logs.
+//
+// Audit log entries should be routed through a Cloud Logging sink to a Pub/Sub topic
+// with a push subscription targeting the /audit/gke endpoint.
+package auditgke
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/utils/clock"
+
+	auditwebhook "github.com/kubewharf/kelemetry/pkg/audit/webhook"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("audit-gke", manager.Ptr(&receiver{}))
+}
+
+type options struct {
+	enable        bool
+	pushToken     string
+	clusterNames  map[string]string
+	sourceAddress string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "audit-gke-enable", false, "enable ingestion of GKE Cloud Audit Logs from Pub/Sub push subscriptions")
+	fs.StringVar(
+		&options.pushToken,
+		"audit-gke-push-token",
+		"",
+		"if nonempty, push requests must contain this value in the 'token' query parameter",
+	)
+	fs.StringToStringVar(
+		&options.clusterNames,
+		"audit-gke-cluster-name",
+		map[string]string{},
+		"map GKE cluster names (the cluster_name resource label) to kelemetry cluster names; unmapped clusters keep the GKE name",
+	)
+	fs.StringVar(
+		&options.sourceAddress,
+		"audit-gke-source-address",
+		"gke",
+		"apiserver address reported for events ingested from Cloud Audit Logs",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type receiver struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Server  kelemetryhttp.Server
+	Webhook auditwebhook.Webhook
+
+	PushMetric *metrics.Metric[*pushMetric]
+}
+
+type pushMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*pushMetric) MetricName() string { return "audit_gke_push" }
+
+func (recv *receiver) Options() manager.Options { return &recv.options }
+
+func (recv *receiver) Init() error {
+	recv.Server.Routes().POST("/audit/gke", recv.handleRequest)
+	return nil
+}
+
+func (recv *receiver) Start(ctx context.Context) error { return nil }
+func (recv *receiver) Close(ctx context.Context) error { return nil }
+
+// pushEnvelope is the request body of a Pub/Sub push subscription.
+type pushEnvelope struct {
+	Message struct {
+		// Data is the base64-encoded LogEntry JSON, decoded automatically by encoding/json.
+		Data      []byte `json:"data"`
+		MessageId string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+func (recv *receiver) handleRequest(ctx *gin.Context) {
+	logger := recv.Logger.WithField("source", ctx.Request.RemoteAddr)
+	defer shutdown.RecoverPanic(logger)
+
+	metric := &pushMetric{}
+	defer recv.PushMetric.DeferCount(recv.Clock.Now(), metric)
+
+	if recv.options.pushToken != "" &&
+		subtle.ConstantTimeCompare([]byte(ctx.Query("token")), []byte(recv.options.pushToken)) != 1 {
+		metric.Error = metrics.MakeLabeledError("Unauthorized")
+		ctx.Status(http.StatusUnauthorized)
+		return
+	}
+
+	if err := recv.handle(ctx, logger, metric); err != nil {
+		logger.WithError(err).Error()
+		metric.Error = err
+	}
+
+	// Always acknowledge the message once authorized.
+	// Malformed entries would fail again on redelivery.
+	ctx.Status(http.StatusNoContent)
+}
+
+func (recv *receiver) handle(ctx *gin.Context, logger logrus.FieldLogger, metric *pushMetric) metrics.LabeledError {
+	receiveTime := recv.Clock.Now()
+
+	envelope := &pushEnvelope{}
+	if err := ctx.BindJSON(envelope); err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot decode push envelope: %w", err), "DecodeEnvelope")
+	}
+
+	entry := &LogEntry{}
+	if err := json.Unmarshal(envelope.Message.Data, entry); err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot decode log entry: %w", err), "DecodeEntry")
+	}
+
+	cluster := entry.Resource.Labels["cluster_name"]
+	if mapped, exists := recv.options.clusterNames[cluster]; exists {
+		cluster = mapped
+	}
+	metric.Cluster = cluster
+
+	event, err := ConvertEntry(entry)
+	if err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot convert log entry %q: %w", entry.InsertId, err), "Convert")
+	}
+
+	if event == nil {
+		logger.WithField("methodName", entry.ProtoPayload.MethodName).Debug("Skipping non-Kubernetes log entry")
+		return nil
+	}
+
+	recv.Webhook.Publish(ctx.Request.Context(), cluster, recv.options.sourceAddress, receiveTime, &auditv1.EventList{
+		Items: []auditv1.Event{*event},
+	})
+
+	return nil
+}
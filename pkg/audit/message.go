@@ -14,11 +14,24 @@
 
 package audit
 
-import auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+import (
+	"time"
+
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
 
 type Message struct {
 	Cluster       string `json:"cluster"`
 	ApiserverAddr string `json:"sourceAddr"`
+	// The local time at which the webhook received the event.
+	// Used for estimating the clock offset of the source cluster.
+	// Nil if the producer did not record the receive time.
+	ReceiveTime *time.Time `json:"receiveTime,omitempty"`
+	// The W3C traceparent of the pipeline span that produced this message, if self tracing sampled it.
+	TraceParent string `json:"traceParent,omitempty"`
+	// Set by the consumer if the message is unsigned or has an invalid signature.
+	// Not serialized since it describes the envelope of the message.
+	Integrity string `json:"-"`
 	auditv1.Event
 }
 
@@ -43,7 +43,20 @@ type Producer interface {
 	Send(partitionKey []byte, value []byte) error
 }
 
-type Consumer any
+type Consumer interface {
+	// Drain stops claiming new messages, waits for the in-flight message to be handled
+	// and commits the offset of the last handled message.
+	//
+	// Drain must only be called after the context passed to Start is canceled.
+	// If the deadline of ctx is exceeded before the in-flight message is handled,
+	// the context passed to the handler is canceled and ctx.Err() is returned.
+	Drain(ctx context.Context) error
+}
+
+// LagReporter is implemented by consumers that know the number of messages in their partition not handled yet.
+type LagReporter interface {
+	Lag() int64
+}
 
 type mux struct {
 	*manager.Mux
@@ -0,0 +1,400 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/leaseshard"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("mq-local-partition-assigner", manager.Ptr(&partitionAssigner{}))
+}
+
+const forwardPath = "/mq/local/partition/:partition"
+
+type assignOptions struct {
+	enable           bool
+	namespace        string
+	leaseName        string
+	advertiseAddress string
+	leaseDuration    time.Duration
+	retryPeriod      time.Duration
+	forwardTimeout   time.Duration
+	forwardQueueSize int
+	forwardRetries   int
+}
+
+func (options *assignOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"mq-local-lease-enable",
+		false,
+		"assign local MQ partitions across replicas using Kubernetes leases; "+
+			"messages for partitions owned by other replicas are forwarded to the owner",
+	)
+	fs.StringVar(&options.namespace, "mq-local-lease-namespace", "default", "namespace of the local MQ partition leases")
+	fs.StringVar(
+		&options.leaseName,
+		"mq-local-lease-name",
+		"kelemetry-mq-local-partition",
+		"lease object name prefix for local MQ partitions, to be appended with the partition number",
+	)
+	fs.StringVar(
+		&options.advertiseAddress,
+		"mq-local-advertise-address",
+		"",
+		"host:port at which other replicas can reach the HTTP server of this replica",
+	)
+	fs.DurationVar(
+		&options.leaseDuration,
+		"mq-local-lease-duration",
+		time.Second*15,
+		"duration after which a partition lease that was not renewed can be taken over by another replica",
+	)
+	fs.DurationVar(&options.retryPeriod, "mq-local-lease-retry-period", time.Second*2, "interval between lease renew/acquire attempts")
+	fs.DurationVar(
+		&options.forwardTimeout,
+		"mq-local-forward-timeout",
+		time.Second*10,
+		"timeout for forwarding messages to partition owners; "+
+			"messages that time out are dropped since the owner may have accepted them",
+	)
+	fs.IntVar(
+		&options.forwardQueueSize,
+		"mq-local-forward-queue-size",
+		1024,
+		"maximum number of messages pending forwarding to each partition owner; messages are dropped when the queue is full",
+	)
+	fs.IntVar(
+		&options.forwardRetries,
+		"mq-local-forward-retries",
+		3,
+		"number of times to retry forwarding a message rejected by or unreachable at the partition owner, "+
+			"waiting --mq-local-lease-retry-period between attempts, before dropping it",
+	)
+}
+
+func (options *assignOptions) EnableFlag() *bool { return nil }
+
+// partitionAssigner distributes the partitions of the local queue across replicas.
+//
+// Each partition is backed by a Lease object whose holder identity contains the advertised address of the owner.
+// Messages produced for a partition owned by another replica are forwarded to the owner over HTTP,
+// so that all messages of the same partition are consumed by the same replica.
+// Partitions are rebalanced automatically as each replica only keeps ceil(partitions / live replicas) partitions.
+// Messages are forwarded asynchronously through a bounded queue per owner,
+// so that a slow owner does not block the producer.
+type partitionAssigner struct {
+	options assignOptions
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+	Server  kelemetryhttp.Server
+	Mtls    *mtls.Provider
+	Metrics metrics.Client
+	Dropped *dropped.Recorder
+
+	ForwardMetric *metrics.Metric[*forwardMetric]
+
+	shards        *leaseshard.Shards
+	numPartitions int32
+	deliver       func(partition mq.PartitionId, key []byte, value []byte)
+	httpClient    http.Client
+
+	ctx          context.Context
+	forwardersMu sync.Mutex
+	// queues of messages to forward, indexed by owner address
+	forwarders map[string]chan forwardedMessage
+}
+
+type forwardMetric struct {
+	Partition mq.PartitionId
+	Error     metrics.LabeledError
+}
+
+func (*forwardMetric) MetricName() string { return "audit_mq_local_forward" }
+
+type ownedPartitionsMetric struct{}
+
+func (*ownedPartitionsMetric) MetricName() string { return "audit_mq_local_owned_partitions" }
+
+// forwardedMessage is a message forwarded to the partition owner, which assigns the offset on delivery.
+type forwardedMessage struct {
+	Partition mq.PartitionId `json:"-"`
+	Key       []byte         `json:"key"`
+	Value     []byte         `json:"value"`
+}
+
+func (assigner *partitionAssigner) Options() manager.Options { return &assigner.options }
+
+func (assigner *partitionAssigner) Init() error {
+	if !assigner.options.enable {
+		return nil
+	}
+
+	if assigner.options.advertiseAddress == "" {
+		return fmt.Errorf("--mq-local-advertise-address is required when --mq-local-lease-enable is set")
+	}
+
+	if assigner.options.forwardQueueSize <= 0 || assigner.options.forwardRetries < 0 {
+		return fmt.Errorf("--mq-local-forward-queue-size must be positive and --mq-local-forward-retries must be non-negative")
+	}
+	assigner.forwarders = map[string]chan forwardedMessage{}
+
+	assigner.httpClient.Timeout = assigner.options.forwardTimeout
+	assigner.Mtls.ConfigureHttpClient(&assigner.httpClient)
+	assigner.shards = leaseshard.New(
+		leaseshard.Config{
+			Namespace:        assigner.options.namespace,
+			Name:             assigner.options.leaseName,
+			AdvertiseAddress: assigner.options.advertiseAddress,
+			LeaseDuration:    assigner.options.leaseDuration,
+			RetryPeriod:      assigner.options.retryPeriod,
+		},
+		assigner.Logger,
+		assigner.Clock,
+		assigner.Clients.TargetCluster().KubernetesClient().CoordinationV1().Leases(assigner.options.namespace),
+	)
+
+	assigner.Server.Routes().POST(forwardPath, assigner.handleForward)
+
+	metrics.NewMonitor(assigner.Metrics, &ownedPartitionsMetric{}, func() float64 {
+		return float64(assigner.shards.NumOwned())
+	})
+
+	return nil
+}
+
+func (assigner *partitionAssigner) Start(ctx context.Context) error { return nil }
+func (assigner *partitionAssigner) Close(ctx context.Context) error { return nil }
+
+func (assigner *partitionAssigner) enabled() bool { return assigner.options.enable }
+
+// run starts the lease loop for the given number of partitions.
+// Called from LocalQueue.Start after the partition count is known.
+func (assigner *partitionAssigner) run(
+	ctx context.Context,
+	numPartitions int32,
+	deliver func(partition mq.PartitionId, key []byte, value []byte),
+) {
+	assigner.ctx = ctx
+	assigner.numPartitions = numPartitions
+	assigner.deliver = deliver
+
+	go func() {
+		defer shutdown.RecoverPanic(assigner.Logger)
+		assigner.shards.Run(ctx, numPartitions)
+	}()
+}
+
+// route determines where a message for the partition should be delivered.
+// Returns an empty string if the message should be consumed locally,
+// including when nobody owns the partition yet so that the message is not dropped.
+func (assigner *partitionAssigner) route(partition mq.PartitionId) string {
+	return assigner.shards.Route(leaseshard.ShardId(partition))
+}
+
+// forward enqueues a message to be forwarded to the owner at address.
+func (assigner *partitionAssigner) forward(address string, message forwardedMessage) {
+	queue := assigner.forwarderFor(address)
+
+	select {
+	case queue <- message:
+	default:
+		logger := assigner.Logger.WithField("partition", message.Partition).WithField("owner", address)
+		assigner.Dropped.Drop(logger, dropped.StageMq, "ForwardQueueFull", fmt.Errorf("too many messages pending forwarding"))
+	}
+}
+
+func (assigner *partitionAssigner) forwarderFor(address string) chan forwardedMessage {
+	assigner.forwardersMu.Lock()
+	defer assigner.forwardersMu.Unlock()
+
+	if queue, exists := assigner.forwarders[address]; exists {
+		return queue
+	}
+
+	queue := make(chan forwardedMessage, assigner.options.forwardQueueSize)
+	assigner.forwarders[address] = queue
+
+	go func() {
+		defer shutdown.RecoverPanic(assigner.Logger)
+		assigner.runForwarder(address, queue)
+	}()
+
+	return queue
+}
+
+// runForwarder forwards the messages queued for an owner one by one,
+// so that messages of the same partition arrive in order.
+func (assigner *partitionAssigner) runForwarder(address string, queue chan forwardedMessage) {
+	for {
+		select {
+		case message := <-queue:
+			assigner.forwardWithRetry(message)
+		case <-assigner.ctx.Done():
+			if pending := len(queue); pending > 0 {
+				logger := assigner.Logger.WithField("owner", address)
+				assigner.Dropped.DropN(logger, dropped.StageMq, "Shutdown", pending, fmt.Errorf("messages pending forwarding during shutdown"))
+			}
+			return
+		}
+	}
+}
+
+// forwardWithRetry forwards a message to the current owner of its partition.
+// The message is only consumed locally if the partition is no longer owned by another replica,
+// since the owner may still be consuming earlier messages of the partition.
+func (assigner *partitionAssigner) forwardWithRetry(message forwardedMessage) {
+	logger := assigner.Logger.WithField("partition", message.Partition)
+
+	for attempt := 0; ; attempt++ {
+		owner := assigner.route(message.Partition)
+		if owner == "" {
+			logger.Debug("partition ownership moved to this replica, consuming locally")
+			assigner.deliver(message.Partition, message.Key, message.Value)
+			return
+		}
+
+		retriable, err := assigner.post(owner, message)
+		if err == nil {
+			return
+		}
+
+		ownerLogger := logger.WithField("owner", owner).WithField("attempt", attempt)
+		if !retriable {
+			assigner.Dropped.Drop(ownerLogger, dropped.StageMq, "Forward", err)
+			return
+		}
+		if attempt >= assigner.options.forwardRetries {
+			assigner.Dropped.Drop(ownerLogger, dropped.StageMq, "ForwardRetry", err)
+			return
+		}
+
+		ownerLogger.WithError(err).Debug("cannot forward message to partition owner, retrying")
+		select {
+		case <-assigner.Clock.After(assigner.options.retryPeriod):
+		case <-assigner.ctx.Done():
+			assigner.Dropped.Drop(ownerLogger, dropped.StageMq, "Shutdown", err)
+			return
+		}
+	}
+}
+
+// post sends a message to the owner.
+// retriable is true if the owner has certainly not accepted the message.
+func (assigner *partitionAssigner) post(address string, message forwardedMessage) (retriable bool, err error) {
+	metric := &forwardMetric{Partition: message.Partition}
+	defer assigner.ForwardMetric.DeferCount(assigner.Clock.Now(), metric)
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Marshal")
+		return false, fmt.Errorf("cannot encode forwarded message: %w", err)
+	}
+
+	url := fmt.Sprintf(
+		"%s://%s%s",
+		assigner.Mtls.Scheme(),
+		address,
+		strings.ReplaceAll(forwardPath, ":partition", fmt.Sprint(int32(message.Partition))),
+	)
+	resp, err := assigner.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// the owner may have accepted the message before the timeout
+			metric.Error = metrics.LabelError(err, "Timeout")
+			return false, fmt.Errorf("forward request timed out: %w", err)
+		}
+
+		metric.Error = metrics.LabelError(err, "Post")
+		return true, fmt.Errorf("cannot forward message: %w", err)
+	}
+
+	if err := resp.Body.Close(); err != nil {
+		assigner.Logger.WithError(err).Debug("cannot close forward response body")
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusConflict, http.StatusServiceUnavailable:
+		// the owner has not delivered the message because it does not own the partition (anymore) or has not started
+		metric.Error = metrics.MakeLabeledError(fmt.Sprintf("Status%d", resp.StatusCode))
+		return true, fmt.Errorf("partition owner responded with status %d", resp.StatusCode)
+	default:
+		metric.Error = metrics.MakeLabeledError(fmt.Sprintf("Status%d", resp.StatusCode))
+		return false, fmt.Errorf("partition owner responded with status %d", resp.StatusCode)
+	}
+}
+
+func (assigner *partitionAssigner) handleForward(ctx *gin.Context) {
+	partitionInt, err := strconv.ParseInt(ctx.Param("partition"), 10, 32)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "invalid partition")
+		return
+	}
+
+	var body forwardedMessage
+	if err := ctx.BindJSON(&body); err != nil {
+		return
+	}
+
+	if assigner.deliver == nil {
+		ctx.String(http.StatusServiceUnavailable, "local queue is not started")
+		return
+	}
+
+	partition := mq.PartitionId(partitionInt)
+	if partitionInt < 0 || partitionInt >= int64(assigner.numPartitions) {
+		ctx.String(http.StatusBadRequest, "unknown partition")
+		return
+	}
+
+	if owner := assigner.route(partition); owner != "" {
+		// the sender retries with the new owner
+		ctx.String(http.StatusConflict, "partition is owned by %s", owner)
+		return
+	}
+
+	assigner.deliver(partition, body.Key, body.Value)
+	ctx.Status(http.StatusOK)
+}
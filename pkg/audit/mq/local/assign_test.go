@@ -0,0 +1,80 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+)
+
+func TestPost(t *testing.T) {
+	assert := assert.New(t)
+
+	statuses := map[string]int{"/mq/local/partition/1": http.StatusOK, "/mq/local/partition/2": http.StatusConflict}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, exists := statuses[r.URL.Path]; exists {
+			w.WriteHeader(status)
+			return
+		}
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+
+	metricsClient, _ := metrics.NewMock(clock.RealClock{})
+	assigner := &partitionAssigner{
+		Logger:        logrus.New(),
+		Clock:         clock.RealClock{},
+		Mtls:          &mtls.Provider{},
+		ForwardMetric: metrics.New[*forwardMetric](metricsClient),
+	}
+	assigner.httpClient.Timeout = time.Millisecond * 100
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	retriable, err := assigner.post(address, forwardedMessage{Partition: 1})
+	assert.NoError(err)
+	assert.False(retriable)
+
+	// the owner does not own the partition, so the message was not delivered
+	retriable, err = assigner.post(address, forwardedMessage{Partition: 2})
+	assert.Error(err)
+	assert.True(retriable)
+
+	// the owner may have delivered the message before the timeout
+	retriable, err = assigner.post(address, forwardedMessage{Partition: 3})
+	assert.Error(err)
+	assert.False(retriable)
+}
+
+func TestDeliverOffsets(t *testing.T) {
+	assert := assert.New(t)
+
+	queue := &LocalQueue{partitions: make([]partitionOffset, 2)}
+	queue.deliver(0, nil, nil)
+	queue.deliver(1, nil, nil)
+	queue.deliver(0, nil, nil)
+
+	assert.Equal(int64(2), queue.partitions[0].offset)
+	assert.Equal(int64(1), queue.partitions[1].offset)
+}
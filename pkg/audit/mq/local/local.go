@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	"github.com/kubewharf/kelemetry/pkg/util/channel"
@@ -56,13 +58,22 @@ func (options *Options) EnableFlag() *bool { return nil }
 type LocalQueue struct {
 	manager.MuxImplBase
 
-	options Options
-	Logger  logrus.FieldLogger
-	Metrics metrics.Client
+	options  Options
+	Logger   logrus.FieldLogger
+	Metrics  metrics.Client
+	Assigner *partitionAssigner
+	Dropped  *dropped.Recorder
 
 	producer      *localProducer
 	consumers     map[mq.ConsumerGroup]map[mq.PartitionId]*localConsumer
 	numPartitions int32
+	partitions    []partitionOffset
+}
+
+// partitionOffset assigns increasing offsets to the messages delivered to a partition.
+type partitionOffset struct {
+	mu     sync.Mutex
+	offset int64
 }
 
 type lagMetric struct {
@@ -94,6 +105,7 @@ func (q *LocalQueue) Start(ctx context.Context) error {
 		numPartitions = len(consumers)
 	}
 	q.numPartitions = int32(numPartitions)
+	q.partitions = make([]partitionOffset, max(numPartitions, 0))
 
 	for _, consumers := range q.consumers {
 		for _, consumer := range consumers {
@@ -101,10 +113,53 @@ func (q *LocalQueue) Start(ctx context.Context) error {
 		}
 	}
 
+	if q.Assigner.enabled() {
+		q.Assigner.run(ctx, q.numPartitions, q.deliver)
+	}
+
 	return nil
 }
 
+// deliver sends a message to the consumers of the partition in all consumer groups.
+// Offsets are assigned by the replica consuming the partition, so they increase within the partition
+// even if messages are produced by different replicas.
+func (q *LocalQueue) deliver(partition mq.PartitionId, key []byte, value []byte) {
+	state := &q.partitions[partition]
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	state.offset++
+	message := localMessage{offset: state.offset, key: key, value: value}
+
+	for _, consumers := range q.consumers {
+		if consumer, exists := consumers[partition]; exists {
+			consumer.uq.Send(message)
+		}
+	}
+}
+
 func (q *LocalQueue) Close(ctx context.Context) error {
+	// drain consumers not drained by their owners yet
+	for _, consumers := range q.consumers {
+		for _, consumer := range consumers {
+			if err := consumer.Drain(ctx); err != nil {
+				consumer.logger.WithError(err).Warn("Consumer drain incomplete")
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckLiveness reports consumers that exited unexpectedly.
+func (q *LocalQueue) CheckLiveness(ctx context.Context) error {
+	for group, consumers := range q.consumers {
+		for partition, consumer := range consumers {
+			if consumer.exited() {
+				return fmt.Errorf("consumer %q/%d has exited", group, partition)
+			}
+		}
+	}
 	return nil
 }
 
@@ -117,9 +172,8 @@ func (q *LocalQueue) CreateProducer() (_ mq.Producer, err error) {
 }
 
 type localProducer struct {
-	logger        logrus.FieldLogger
-	queue         *LocalQueue
-	offsetCounter int64
+	logger logrus.FieldLogger
+	queue  *LocalQueue
 }
 
 func (q *LocalQueue) newLocalProducer() *localProducer {
@@ -142,17 +196,15 @@ func (producer *localProducer) Send(partitionKey []byte, value []byte) error {
 
 	partitionId := mq.PartitionId(partition)
 
-	offset := atomic.AddInt64(&producer.offsetCounter, 1)
-
-	message := localMessage{
-		offset: offset,
-		key:    partitionKey,
-		value:  value,
-	}
-	for _, consumers := range producer.queue.consumers {
-		consumers[partitionId].uq.Send(message)
+	if producer.queue.Assigner.enabled() {
+		if owner := producer.queue.Assigner.route(partitionId); owner != "" {
+			producer.queue.Assigner.forward(owner, forwardedMessage{Partition: partitionId, Key: partitionKey, Value: value})
+			return nil
+		}
 	}
 
+	producer.queue.deliver(partitionId, partitionKey, value)
+
 	return nil
 }
 
@@ -169,28 +221,45 @@ func (q *LocalQueue) CreateConsumer(group mq.ConsumerGroup, partition mq.Partiti
 	metrics.NewMonitor(q.Metrics, &lagMetric{
 		ConsumerGroup: group,
 		Partition:     partition,
-	}, func() float64 { return float64(consumer.uq.Length()) })
+	}, func() float64 { return float64(consumer.Lag()) })
 	q.consumers[group][partition] = consumer
 	return consumer, nil
 }
 
 type localConsumer struct {
 	logger      logrus.FieldLogger
+	dropped     *dropped.Recorder
 	handler     mq.MessageHandler
 	uq          *channel.UnboundedQueue[localMessage]
 	completions atomic.Int64
+
+	// the last offset that has been completely handled
+	committedOffset atomic.Int64
+	// closed when the consumer goroutine exits
+	doneCh chan struct{}
+	// canceled when the drain deadline is exceeded
+	cancelHandler context.CancelFunc
+	drained       atomic.Bool
 }
 
 func (q *LocalQueue) newConsumer(group mq.ConsumerGroup, partition mq.PartitionId, handler mq.MessageHandler) *localConsumer {
 	return &localConsumer{
 		logger:  q.Logger.WithField("submod", "consumer").WithField("group", string(group)).WithField("partition", int32(partition)),
+		dropped: q.Dropped,
 		handler: handler,
 		uq:      channel.NewUnboundedQueue[localMessage](64),
+		doneCh:  make(chan struct{}),
 	}
 }
 
 func (consumer *localConsumer) start(ctx context.Context) {
+	// The in-flight message should still be handled after shutdown is triggered,
+	// so the handler context is only canceled when draining times out.
+	handlerCtx, cancelHandler := context.WithCancel(context.WithoutCancel(ctx))
+	consumer.cancelHandler = cancelHandler
+
 	go func() {
+		defer close(consumer.doneCh)
 		defer shutdown.RecoverPanic(consumer.logger)
 
 		for {
@@ -200,8 +269,14 @@ func (consumer *localConsumer) start(ctx context.Context) {
 					return
 				}
 
-				consumer.handler(ctx, consumer.logger.WithField("offset", message.offset), message.key, message.value)
+				if ctx.Err() != nil {
+					// stop claiming new messages after shutdown is triggered
+					return
+				}
+
+				consumer.handler(handlerCtx, consumer.logger.WithField("offset", message.offset), message.key, message.value)
 
+				consumer.committedOffset.Store(message.offset)
 				consumer.completions.Add(1)
 			case <-ctx.Done():
 				return
@@ -210,6 +285,45 @@ func (consumer *localConsumer) start(ctx context.Context) {
 	}()
 }
 
+// Lag returns the number of messages delivered to the consumer but not handled yet.
+func (consumer *localConsumer) Lag() int64 { return int64(consumer.uq.Length()) }
+
+// exited returns true if the consumer goroutine has exited without being drained.
+func (consumer *localConsumer) exited() bool {
+	if consumer.drained.Load() {
+		return false
+	}
+
+	select {
+	case <-consumer.doneCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (consumer *localConsumer) Drain(ctx context.Context) error {
+	if consumer.cancelHandler == nil || consumer.drained.Swap(true) {
+		// never started or already drained
+		return nil
+	}
+	defer consumer.cancelHandler()
+
+	select {
+	case <-consumer.doneCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// the local queue is not persistent, so committing only records the offset for diagnosis.
+	consumer.logger.WithField("offset", consumer.committedOffset.Load()).Info("Consumer drained")
+	if remaining := consumer.uq.Length(); remaining > 0 {
+		consumer.dropped.DropN(consumer.logger, dropped.StageMq, "Shutdown", remaining, fmt.Errorf("local queue is not persistent"))
+	}
+
+	return nil
+}
+
 // Busy-waits until all consumers have no lagging messages at some point.
 // Only used for testing.
 func (q *LocalQueue) WaitForCompletions(request int64) {
@@ -16,19 +16,22 @@ package auditproducer
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/kelemetry/pkg/audit"
 	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/audit/signature"
 	auditwebhook "github.com/kubewharf/kelemetry/pkg/audit/webhook"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
 )
 
 func init() {
@@ -39,6 +42,7 @@ type options struct {
 	enable           bool
 	workerCount      int
 	partitionKeyType partitionKeyType
+	encoding         utilwire.Encoding
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -54,6 +58,17 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 			[]string{"cluster", "object", "audit-id"},
 		),
 	)
+
+	options.encoding = utilwire.EncodingJson
+	fs.Var(
+		&options.encoding,
+		"audit-producer-encoding",
+		fmt.Sprintf(
+			"encoding of audit messages in the message queue. Possible values are %q. "+
+				"Consumers accept both encodings, so only switch to protobuf after all consumers are upgraded.",
+			[]utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf},
+		),
+	)
 }
 
 func (options *options) EnableFlag() *bool { return &options.enable }
@@ -96,12 +111,14 @@ func (ty *partitionKeyType) Set(input string) error {
 func (ty *partitionKeyType) Type() string { return "partitionKeyType" }
 
 type producer struct {
-	options options
-	Logger  logrus.FieldLogger
-	Clock   clock.Clock
-	Webhook auditwebhook.Webhook
-	Queue   mq.Queue
-	Metrics metrics.Client
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Webhook   auditwebhook.Webhook
+	Queue     mq.Queue
+	Signer    *signature.Signer
+	Metrics   metrics.Client
+	SelfTrace *selftrace.Tracer
 
 	ProduceMetric *metrics.Metric[*produceMetric]
 
@@ -160,11 +177,24 @@ func (producer *producer) workerLoop(ctx context.Context, workerId int) {
 	}
 }
 
-func (producer *producer) handleEvent(message *audit.Message) error {
+func (producer *producer) handleEvent(message *audit.Message) (err error) {
 	defer producer.ProduceMetric.DeferCount(producer.Clock.Now(), &produceMetric{
 		Cluster: message.Cluster,
 	})
 
+	traceCtx, span := producer.SelfTrace.StartChildSpan(
+		producer.SelfTrace.Extract(context.Background(), message.TraceParent),
+		"audit.produce",
+		attribute.String("cluster", message.Cluster),
+	)
+	defer func() { selftrace.EndSpan(span, err) }()
+	if traceParent := producer.SelfTrace.Inject(traceCtx); traceParent != message.TraceParent {
+		// the message is shared with other subscribers of the webhook
+		traced := *message
+		traced.TraceParent = traceParent
+		message = &traced
+	}
+
 	partitionKey := []byte(nil)
 
 	switch producer.options.partitionKeyType {
@@ -187,12 +217,12 @@ func (producer *producer) handleEvent(message *audit.Message) error {
 		partitionKey = []byte(fmt.Sprintf("%s/%s", message.Cluster, message.AuditID))
 	}
 
-	messageJson, err := json.Marshal(message)
+	messageBuf, err := audit.EncodeMessage(message, producer.options.encoding)
 	if err != nil {
-		return fmt.Errorf("cannot reserialize event JSON: %w", err)
+		return fmt.Errorf("cannot reserialize event: %w", err)
 	}
 
-	err = producer.producer.Send(partitionKey, messageJson)
+	err = producer.producer.Send(partitionKey, producer.Signer.Sign(messageBuf))
 	if err != nil {
 		return fmt.Errorf("cannot send event to message queue: %w", err)
 	}
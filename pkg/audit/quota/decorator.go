@@ -0,0 +1,189 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("quota-decorator", manager.Ptr(&decorator{}), &manager.List[audit.Decorator]{})
+}
+
+var quotaGvr = corev1.SchemeGroupVersion.WithResource("resourcequotas")
+
+type options struct {
+	enable bool
+	mirror bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"quota-decorator-enable",
+		false,
+		"tag audit spans rejected by ResourceQuota or LimitRange admission with the quota usage and violated constraints",
+	)
+	fs.BoolVar(
+		&options.mirror,
+		"quota-decorator-mirror-event",
+		true,
+		"also send an event to the trace of the exceeded ResourceQuota",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type decorator struct {
+	options     options
+	Logger      logrus.FieldLogger
+	Aggregator  aggregator.Aggregator
+	ObjectCache *objectcache.ObjectCache
+
+	RejectionMetric *metrics.Metric[*rejectionMetric]
+}
+
+type rejectionMetric struct {
+	Cluster  string
+	Resource string
+	Type     string
+	Error    metrics.LabeledError
+}
+
+func (*rejectionMetric) MetricName() string { return "audit_quota_rejection" }
+
+var _ manager.Component = &decorator{}
+
+func (d *decorator) Options() manager.Options        { return &d.options }
+func (d *decorator) Init() error                     { return nil }
+func (d *decorator) Start(ctx context.Context) error { return nil }
+func (d *decorator) Close(ctx context.Context) error { return nil }
+
+func (d *decorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	if message.ObjectRef == nil || message.ResponseStatus == nil || message.ResponseStatus.Code != 403 {
+		return
+	}
+
+	statusMessage := message.ResponseStatus.Message
+
+	if exceeded, ok := ParseExceeded(statusMessage); ok {
+		d.decorateExceeded(ctx, message, event, exceeded)
+		return
+	}
+
+	if violations := ParseViolations(statusMessage); len(violations) > 0 {
+		constraints := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			constraints = append(constraints, fmt.Sprintf("%s %s per %s", violation.Constraint, violation.Resource, violation.Kind))
+			event.Log(zconstants.LogTypeRealError, violation.Message)
+		}
+
+		event.SetTag("limitRangeViolations", strings.Join(constraints, ","))
+		d.RejectionMetric.With(&rejectionMetric{Cluster: message.Cluster, Resource: message.ObjectRef.Resource, Type: "LimitRange"}).Count(1)
+	}
+}
+
+func (d *decorator) decorateExceeded(ctx context.Context, message *audit.Message, event *aggregatorevent.Event, exceeded Exceeded) {
+	metric := &rejectionMetric{Cluster: message.Cluster, Resource: message.ObjectRef.Resource, Type: "ResourceQuota"}
+	defer func() { d.RejectionMetric.With(metric).Count(1) }()
+
+	namespace := message.ObjectRef.Namespace
+	quotaRef := utilobject.Rich{
+		VersionedKey: utilobject.VersionedKey{
+			Key: utilobject.Key{
+				Cluster:   message.Cluster,
+				Group:     quotaGvr.Group,
+				Resource:  quotaGvr.Resource,
+				Namespace: namespace,
+				Name:      exceeded.Quota,
+			},
+			Version: quotaGvr.Version,
+		},
+	}
+
+	event.SetTag("resourceQuota", fmt.Sprintf("%s/%s", namespace, exceeded.Quota))
+	if exceeded.Missing != "" {
+		event.SetTag("quotaMissingResources", exceeded.Missing)
+	} else {
+		event.SetTag("quotaRequested", exceeded.Requested)
+		event.SetTag("quotaLimited", exceeded.Limited)
+	}
+
+	usage := ""
+	if status, err := d.fetchStatus(ctx, quotaRef); err != nil {
+		metric.Error = metrics.LabelError(err, "FetchQuota")
+		d.Logger.WithFields(quotaRef.AsFields("quota")).WithError(err).Debug("cannot fetch resource quota")
+	} else if status != nil {
+		usage = FormatUsage(*status)
+		event.SetTag("quotaUsage", usage)
+		event.Log(zconstants.LogTypeRealVerbose, fmt.Sprintf("usage of quota %s: %s", exceeded.Quota, usage))
+	}
+
+	if !d.options.mirror {
+		return
+	}
+
+	subject := message.ObjectRef.Resource
+	if message.ObjectRef.Name != "" {
+		subject += "/" + message.ObjectRef.Name
+	}
+
+	mirrored := aggregatorevent.NewEvent(fmt.Sprintf("Quota exceeded by %s", subject), event.Time, zconstants.TraceSourceAnalysis).
+		SetTag("username", message.User.Username).
+		SetTag("verb", message.Verb).
+		SetTag("tag", "quotaExceeded").
+		Log(zconstants.LogTypeRealError, message.ResponseStatus.Message)
+	if usage != "" {
+		mirrored.SetTag("quotaUsage", usage)
+	}
+
+	if err := d.Aggregator.Send(ctx, quotaRef, mirrored); err != nil {
+		metric.Error = metrics.LabelError(err, "Send")
+		d.Logger.WithFields(quotaRef.AsFields("quota")).WithError(err).Error("cannot send quota exceeded event")
+	}
+}
+
+func (d *decorator) fetchStatus(ctx context.Context, quotaRef utilobject.Rich) (*corev1.ResourceQuotaStatus, error) {
+	raw, err := d.ObjectCache.Get(ctx, quotaRef.VersionedKey)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	quota := &corev1.ResourceQuota{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, quota); err != nil {
+		return nil, err
+	}
+
+	return &quota.Status, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Explains requests rejected by ResourceQuota and LimitRange admission.
+//
+// Quota rejections are tagged with the usage snapshot of the exceeded ResourceQuota
+// and mirrored as an event on the ResourceQuota object trace.
+// LimitRange violations are tagged with the violated constraints.
+package quota
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Exceeded is a request rejected because it would exceed a ResourceQuota.
+type Exceeded struct {
+	Quota     string
+	Requested string
+	Used      string
+	Limited   string
+	// Missing is the list of resources that must be specified in the request for the quota to be evaluated.
+	Missing string
+}
+
+var (
+	exceededRegex = regexp.MustCompile(`exceeded quota: ([^,]+), requested: (\S*), used: (\S*), limited: (\S*)`)
+	failedRegex   = regexp.MustCompile(`failed quota: ([^:]+): must specify (\S+)`)
+)
+
+// ParseExceeded parses the status message of a request rejected by the ResourceQuota admission plugin.
+func ParseExceeded(message string) (Exceeded, bool) {
+	if matches := exceededRegex.FindStringSubmatch(message); matches != nil {
+		return Exceeded{Quota: matches[1], Requested: matches[2], Used: matches[3], Limited: matches[4]}, true
+	}
+
+	if matches := failedRegex.FindStringSubmatch(message); matches != nil {
+		return Exceeded{Quota: matches[1], Missing: matches[2]}, true
+	}
+
+	return Exceeded{}, false
+}
+
+// Violation is a constraint of a LimitRange violated by a request.
+type Violation struct {
+	Constraint string
+	Resource   string
+	Kind       string
+	Message    string
+}
+
+var violationRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`(maximum|minimum) (\S+) usage per (\w+) is \S+, but (?:limit|request) is [^,\]]+`),
+	regexp.MustCompile(`(\S+) max limit to request ratio per (\w+) is \S+, but provided ratio is [^,\]]+`),
+}
+
+// ParseViolations parses the status message of a request rejected by the LimitRanger admission plugin.
+func ParseViolations(message string) []Violation {
+	var violations []Violation
+
+	for _, match := range violationRegexes[0].FindAllStringSubmatch(message, -1) {
+		violations = append(violations, Violation{Constraint: match[1], Resource: match[2], Kind: match[3], Message: match[0]})
+	}
+
+	for _, match := range violationRegexes[1].FindAllStringSubmatch(message, -1) {
+		violations = append(violations, Violation{Constraint: "maxLimitRequestRatio", Resource: match[1], Kind: match[2], Message: match[0]})
+	}
+
+	return violations
+}
+
+// FormatUsage formats the used and hard limits of a quota as `resource=used/hard`, sorted by resource name.
+func FormatUsage(status corev1.ResourceQuotaStatus) string {
+	names := make([]string, 0, len(status.Hard))
+	for name := range status.Hard {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		hard := status.Hard[corev1.ResourceName(name)]
+		used := "0"
+		if quantity, hasUsed := status.Used[corev1.ResourceName(name)]; hasUsed {
+			used = quantity.String()
+		}
+		items = append(items, fmt.Sprintf("%s=%s/%s", name, used, hard.String()))
+	}
+
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/quota"
+)
+
+func TestParseExceeded(t *testing.T) {
+	assert := assert.New(t)
+
+	exceeded, ok := quota.ParseExceeded(`pods "web-1" is forbidden: exceeded quota: compute, requested: limits.cpu=2,limits.memory=1Gi, ` +
+		`used: limits.cpu=3,limits.memory=2Gi, limited: limits.cpu=4,limits.memory=4Gi`)
+	assert.True(ok)
+	assert.Equal(quota.Exceeded{
+		Quota:     "compute",
+		Requested: "limits.cpu=2,limits.memory=1Gi",
+		Used:      "limits.cpu=3,limits.memory=2Gi",
+		Limited:   "limits.cpu=4,limits.memory=4Gi",
+	}, exceeded)
+
+	exceeded, ok = quota.ParseExceeded(`pods "web-1" is forbidden: failed quota: compute: must specify limits.cpu,limits.memory`)
+	assert.True(ok)
+	assert.Equal(quota.Exceeded{Quota: "compute", Missing: "limits.cpu,limits.memory"}, exceeded)
+
+	_, ok = quota.ParseExceeded(`pods "web-1" is forbidden: User "alice" cannot create resource "pods"`)
+	assert.False(ok)
+}
+
+func TestParseViolations(t *testing.T) {
+	assert := assert.New(t)
+
+	violations := quota.ParseViolations(`pods "web-1" is forbidden: [maximum cpu usage per Container is 2, but limit is 3, ` +
+		`minimum memory usage per Pod is 1Gi, but request is 512Mi, cpu max limit to request ratio per Container is 2, but provided ratio is 4.000000]`)
+	assert.Equal([]quota.Violation{
+		{Constraint: "maximum", Resource: "cpu", Kind: "Container", Message: "maximum cpu usage per Container is 2, but limit is 3"},
+		{Constraint: "minimum", Resource: "memory", Kind: "Pod", Message: "minimum memory usage per Pod is 1Gi, but request is 512Mi"},
+		{
+			Constraint: "maxLimitRequestRatio",
+			Resource:   "cpu",
+			Kind:       "Container",
+			Message:    "cpu max limit to request ratio per Container is 2, but provided ratio is 4.000000",
+		},
+	}, violations)
+
+	assert.Empty(quota.ParseViolations(`pods "web-1" is forbidden: unrelated`))
+}
+
+func TestFormatUsage(t *testing.T) {
+	assert.Equal(t, "limits.memory=2Gi/4Gi,pods=0/10", quota.FormatUsage(corev1.ResourceQuotaStatus{
+		Hard: corev1.ResourceList{
+			corev1.ResourcePods:         resource.MustParse("10"),
+			corev1.ResourceLimitsMemory: resource.MustParse("4Gi"),
+		},
+		Used: corev1.ResourceList{
+			corev1.ResourceLimitsMemory: resource.MustParse("2Gi"),
+		},
+	}))
+}
@@ -0,0 +1,362 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Signs audit messages at the producer and verifies them at the consumer.
+//
+// A signed message is wrapped in an envelope starting with a magic byte
+// that neither JSON nor utilwire frames start with, followed by the SignedEnvelope protobuf in message.proto.
+// Consumers always unwrap envelopes, so producers can start signing before consumers verify signatures.
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
+)
+
+func init() {
+	manager.Global.Provide("audit-signature", manager.Ptr(&Signer{}))
+}
+
+const envelopeMagic byte = 1
+
+const (
+	envelopeFieldKeyId     protowire.Number = 1
+	envelopeFieldSignature protowire.Number = 2
+	envelopeFieldPayload   protowire.Number = 3
+)
+
+const (
+	AlgorithmHmacSha256 = "hmac-sha256"
+	AlgorithmEd25519    = "ed25519"
+)
+
+const (
+	// PolicyIgnore unwraps signed messages without verifying them.
+	PolicyIgnore = "ignore"
+	// PolicyFlag verifies signatures and flags unsigned or invalid messages.
+	PolicyFlag = "flag"
+	// PolicyReject verifies signatures and rejects unsigned or invalid messages.
+	PolicyReject = "reject"
+)
+
+// Verdicts of Open for messages that failed verification.
+const (
+	VerdictUnsigned = "unsigned"
+	VerdictInvalid  = "invalid"
+)
+
+type options struct {
+	algorithm            string
+	signingKeyFile       string
+	verificationKeyFiles []string
+	policy               string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&options.algorithm,
+		"audit-signature-algorithm",
+		AlgorithmHmacSha256,
+		fmt.Sprintf("algorithm to sign audit messages with, one of %q", []string{AlgorithmHmacSha256, AlgorithmEd25519}),
+	)
+	fs.StringVar(
+		&options.signingKeyFile,
+		"audit-signature-signing-key-file",
+		"",
+		"if nonempty, the audit producer signs messages with the key in this file, "+
+			"which contains the shared secret for hmac-sha256 or a PEM PKCS#8 private key for ed25519",
+	)
+	fs.StringSliceVar(
+		&options.verificationKeyFiles,
+		"audit-signature-verification-key-files",
+		[]string{},
+		"files of keys accepted by the audit consumer, which contain shared secrets for hmac-sha256 or PEM public keys for ed25519. "+
+			"Multiple keys can be accepted during rotation. "+
+			"Defaults to --audit-signature-signing-key-file for hmac-sha256",
+	)
+	fs.StringVar(
+		&options.policy,
+		"audit-signature-policy",
+		PolicyIgnore,
+		fmt.Sprintf(
+			"how the audit consumer handles unsigned messages and messages with invalid signatures. "+
+				"%q does not verify signatures, "+
+				"%q traces such messages with an %q tag, "+
+				"%q drops such messages",
+			PolicyIgnore, PolicyFlag, "integrity", PolicyReject,
+		),
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if options.algorithm != AlgorithmHmacSha256 && options.algorithm != AlgorithmEd25519 {
+		return fmt.Errorf("unsupported --audit-signature-algorithm %q", options.algorithm)
+	}
+
+	switch options.policy {
+	case PolicyIgnore:
+	case PolicyFlag, PolicyReject:
+		if len(options.verificationKeyFiles) == 0 &&
+			!(options.algorithm == AlgorithmHmacSha256 && options.signingKeyFile != "") {
+			return fmt.Errorf("--audit-signature-verification-key-files is required with --audit-signature-policy=%s", options.policy)
+		}
+	default:
+		return fmt.Errorf("unsupported --audit-signature-policy %q", options.policy)
+	}
+
+	return nil
+}
+
+// Signer signs and verifies audit message payloads.
+type Signer struct {
+	options options
+	Logger  logrus.FieldLogger
+
+	VerifyMetric *metrics.Metric[*VerifyMetric]
+
+	signingKey *signingKey
+	// verification keys indexed by key ID
+	verificationKeys map[string]verificationKey
+}
+
+type VerifyMetric struct {
+	Verdict string
+}
+
+func (*VerifyMetric) MetricName() string { return "audit_signature_verify" }
+
+type signingKey struct {
+	id   string
+	sign func(payload []byte) []byte
+}
+
+type verificationKey func(payload []byte, signature []byte) bool
+
+var _ manager.Component = &Signer{}
+
+func (signer *Signer) Options() manager.Options { return &signer.options }
+
+func (signer *Signer) Init() error {
+	if signer.options.signingKeyFile != "" {
+		keyPem, err := os.ReadFile(signer.options.signingKeyFile)
+		if err != nil {
+			return fmt.Errorf("cannot read --audit-signature-signing-key-file: %w", err)
+		}
+
+		signer.signingKey, err = parseSigningKey(signer.options.algorithm, keyPem)
+		if err != nil {
+			return fmt.Errorf("invalid --audit-signature-signing-key-file: %w", err)
+		}
+	}
+
+	if signer.options.policy == PolicyIgnore {
+		return nil
+	}
+
+	verificationKeyFiles := signer.options.verificationKeyFiles
+	if len(verificationKeyFiles) == 0 {
+		verificationKeyFiles = []string{signer.options.signingKeyFile}
+	}
+
+	signer.verificationKeys = make(map[string]verificationKey, len(verificationKeyFiles))
+	for _, file := range verificationKeyFiles {
+		keyPem, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("cannot read verification key %q: %w", file, err)
+		}
+
+		id, key, err := parseVerificationKey(signer.options.algorithm, keyPem)
+		if err != nil {
+			return fmt.Errorf("invalid verification key %q: %w", file, err)
+		}
+		signer.verificationKeys[id] = key
+	}
+
+	return nil
+}
+
+func (signer *Signer) Start(ctx context.Context) error { return nil }
+func (signer *Signer) Close(ctx context.Context) error { return nil }
+
+func hmacKeyId(secret []byte) string {
+	// derive the ID from the secret without revealing it
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("kelemetry-audit-key-id"))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func ed25519KeyId(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func parseSigningKey(algorithm string, data []byte) (*signingKey, error) {
+	if algorithm == AlgorithmHmacSha256 {
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("empty secret")
+		}
+
+		return &signingKey{
+			id: hmacKeyId(secret),
+			sign: func(payload []byte) []byte {
+				mac := hmac.New(sha256.New, secret)
+				mac.Write(payload)
+				return mac.Sum(nil)
+			},
+		}, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an ed25519 private key, got %T", key)
+	}
+
+	return &signingKey{
+		id:   ed25519KeyId(privateKey.Public().(ed25519.PublicKey)),
+		sign: func(payload []byte) []byte { return ed25519.Sign(privateKey, payload) },
+	}, nil
+}
+
+func parseVerificationKey(algorithm string, data []byte) (string, verificationKey, error) {
+	if algorithm == AlgorithmHmacSha256 {
+		key, err := parseSigningKey(algorithm, data)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return key.id, func(payload []byte, signature []byte) bool {
+			return hmac.Equal(key.sign(payload), signature)
+		}, nil
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot parse public key: %w", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return "", nil, fmt.Errorf("expected an ed25519 public key, got %T", key)
+	}
+
+	return ed25519KeyId(publicKey), func(payload []byte, signature []byte) bool {
+		return ed25519.Verify(publicKey, payload, signature)
+	}, nil
+}
+
+// Sign wraps the payload in a signed envelope, or returns it unchanged if no signing key is configured.
+func (signer *Signer) Sign(payload []byte) []byte {
+	if signer.signingKey == nil {
+		return payload
+	}
+
+	buf := []byte{envelopeMagic}
+	buf = utilwire.AppendString(buf, envelopeFieldKeyId, signer.signingKey.id)
+	buf = utilwire.AppendBytes(buf, envelopeFieldSignature, signer.signingKey.sign(payload))
+	buf = utilwire.AppendBytes(buf, envelopeFieldPayload, payload)
+	return buf
+}
+
+// Open unwraps a payload possibly wrapped by Sign and verifies it according to the policy.
+// verdict is nonempty if the payload should be flagged as unsigned or invalid.
+// An error is returned if the envelope is malformed or the payload is rejected by the policy.
+func (signer *Signer) Open(payload []byte) (body []byte, verdict string, err error) {
+	body, verdict, err = signer.open(payload)
+
+	if signer.options.policy == PolicyIgnore {
+		return body, "", err
+	}
+
+	metricVerdict := verdict
+	if metricVerdict == "" {
+		metricVerdict = "valid"
+	}
+	signer.VerifyMetric.With(&VerifyMetric{Verdict: metricVerdict}).Count(1)
+
+	if err == nil && verdict != "" && signer.options.policy == PolicyReject {
+		err = fmt.Errorf("rejected %s message", verdict)
+	}
+	return body, verdict, err
+}
+
+func (signer *Signer) open(payload []byte) (body []byte, verdict string, err error) {
+	if len(payload) == 0 || payload[0] != envelopeMagic {
+		return payload, VerdictUnsigned, nil
+	}
+
+	fields, err := utilwire.Fields(payload[1:])
+	if err != nil {
+		return nil, VerdictInvalid, fmt.Errorf("malformed signed envelope: %w", err)
+	}
+
+	var keyId string
+	var signature []byte
+	for _, field := range fields {
+		switch field.Number {
+		case envelopeFieldKeyId:
+			keyId = string(field.Bytes)
+		case envelopeFieldSignature:
+			signature = field.Bytes
+		case envelopeFieldPayload:
+			body = field.Bytes
+		}
+	}
+
+	if signer.options.policy == PolicyIgnore {
+		return body, "", nil
+	}
+
+	key, known := signer.verificationKeys[keyId]
+	if !known {
+		signer.Logger.WithField("keyId", keyId).Warn("audit message is signed with an unknown key")
+		return body, VerdictInvalid, nil
+	}
+
+	if !key(body, signature) {
+		signer.Logger.WithField("keyId", keyId).Warn("audit message has an invalid signature")
+		return body, VerdictInvalid, nil
+	}
+
+	return body, "", nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func newTestSigner(t *testing.T, options options) *Signer {
+	metricsClient, _ := metrics.NewMock(clocktesting.NewFakeClock(time.Unix(0, 0)))
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	signer := &Signer{
+		options:      options,
+		Logger:       logger,
+		VerifyMetric: metrics.New[*VerifyMetric](metricsClient),
+	}
+	assert.NoError(t, signer.options.Validate())
+	assert.NoError(t, signer.Init())
+	return signer
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestHmac(t *testing.T) {
+	assert := assert.New(t)
+
+	secret := writeFile(t, []byte("secret\n"))
+	producer := newTestSigner(t, options{algorithm: AlgorithmHmacSha256, signingKeyFile: secret, policy: PolicyIgnore})
+	consumer := newTestSigner(t, options{algorithm: AlgorithmHmacSha256, signingKeyFile: secret, policy: PolicyReject})
+
+	payload := []byte(`{"cluster":"test"}`)
+	signed := producer.Sign(payload)
+	assert.NotEqual(payload, signed)
+
+	body, verdict, err := consumer.Open(signed)
+	assert.NoError(err)
+	assert.Empty(verdict)
+	assert.Equal(payload, body)
+
+	// tampered payloads are rejected
+	tampered := append([]byte{}, signed...)
+	tampered[len(tampered)-2] = 'x'
+	_, verdict, err = consumer.Open(tampered)
+	assert.Error(err)
+	assert.Equal(VerdictInvalid, verdict)
+
+	// unsigned payloads are rejected
+	_, verdict, err = consumer.Open(payload)
+	assert.Error(err)
+	assert.Equal(VerdictUnsigned, verdict)
+
+	// consumers that do not verify still unwrap signed payloads
+	body, verdict, err = producer.Open(signed)
+	assert.NoError(err)
+	assert.Empty(verdict)
+	assert.Equal(payload, body)
+}
+
+func TestEd25519Rotation(t *testing.T) {
+	assert := assert.New(t)
+
+	newKeyPair := func() (privateFile string, publicFile string) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		assert.NoError(err)
+		privateDer, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		assert.NoError(err)
+		publicDer, err := x509.MarshalPKIXPublicKey(publicKey)
+		assert.NoError(err)
+
+		return writeFile(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})),
+			writeFile(t, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}))
+	}
+	oldPrivate, oldPublic := newKeyPair()
+	newPrivate, newPublic := newKeyPair()
+	_, otherPublic := newKeyPair()
+
+	oldProducer := newTestSigner(t, options{algorithm: AlgorithmEd25519, signingKeyFile: oldPrivate, policy: PolicyIgnore})
+	newProducer := newTestSigner(t, options{algorithm: AlgorithmEd25519, signingKeyFile: newPrivate, policy: PolicyIgnore})
+
+	consumer := newTestSigner(t, options{
+		algorithm:            AlgorithmEd25519,
+		verificationKeyFiles: []string{oldPublic, newPublic},
+		policy:               PolicyFlag,
+	})
+	for _, producer := range []*Signer{oldProducer, newProducer} {
+		body, verdict, err := consumer.Open(producer.Sign([]byte("payload")))
+		assert.NoError(err)
+		assert.Empty(verdict)
+		assert.Equal([]byte("payload"), body)
+	}
+
+	// messages signed by unknown keys are flagged but still delivered
+	otherConsumer := newTestSigner(t, options{
+		algorithm:            AlgorithmEd25519,
+		verificationKeyFiles: []string{otherPublic},
+		policy:               PolicyFlag,
+	})
+	body, verdict, err := otherConsumer.Open(newProducer.Sign([]byte("payload")))
+	assert.NoError(err)
+	assert.Equal(VerdictInvalid, verdict)
+	assert.Equal([]byte("payload"), body)
+}
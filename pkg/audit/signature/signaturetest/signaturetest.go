@@ -0,0 +1,50 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Test helpers for components that sign or verify audit messages.
+package signaturetest
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/signature"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+// NewSigner creates a Signer configured with the given command line flags, e.g. "--audit-signature-policy=reject".
+func NewSigner(logger logrus.FieldLogger, metricsClient metrics.Client, args ...string) (*signature.Signer, error) {
+	signer := &signature.Signer{
+		Logger:       logger,
+		VerifyMetric: metrics.New[*signature.VerifyMetric](metricsClient),
+	}
+
+	options := signer.Options()
+	fs := pflag.NewFlagSet("signature", pflag.ContinueOnError)
+	options.Setup(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if options, ok := options.(manager.ValidatingOptions); ok {
+		if err := options.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := signer.Init(); err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package target
+
+import (
+	"context"
+
+	"github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("cluster-name/target", manager.Ptr(&TargetResolver{}), clustername.Resolver.Resolve)
+}
+
+// TargetResolver attributes all audit webhook requests without a cluster path to the target cluster,
+// which is suitable for single-cluster deployments where the target cluster name is detected automatically.
+type TargetResolver struct {
+	manager.MuxImplBase
+	Clients k8s.Clients
+}
+
+func (_ *TargetResolver) MuxImplName() (name string, isDefault bool) { return "target", false }
+
+func (resolver *TargetResolver) Options() manager.Options { return &manager.NoOptions{} }
+
+func (resolver *TargetResolver) Init() error { return nil }
+
+func (resolver *TargetResolver) Start(ctx context.Context) error { return nil }
+
+func (resolver *TargetResolver) Close(ctx context.Context) error { return nil }
+
+func (resolver *TargetResolver) Resolve(ip string) string {
+	return resolver.Clients.TargetCluster().ClusterName()
+}
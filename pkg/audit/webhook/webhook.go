@@ -18,18 +18,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
 	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
 	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/kelemetry/pkg/audit"
 	"github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername"
 	"github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterid"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/selftrace"
 	"github.com/kubewharf/kelemetry/pkg/util/channel"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
@@ -58,6 +62,12 @@ type Webhook interface {
 	// AddRawSubscriber registers a new event list handler.
 	// Handlers must consume all event lists, otherwise this would leak memory.
 	AddRawSubscriber(name string) <-chan *audit.RawMessage
+
+	// Publish dispatches an event list to all subscribers
+	// as if it was received from the webhook endpoint.
+	// This allows sources other than the audit webhook to reuse the same pipeline.
+	// ctx is only used for propagating the self tracing span.
+	Publish(ctx context.Context, cluster string, sourceAddr string, receiveTime time.Time, eventList *auditv1.EventList)
 }
 
 type webhook struct {
@@ -66,7 +76,9 @@ type webhook struct {
 	Clock               clock.Clock
 	Metrics             metrics.Client
 	ClusterNameResolver clustername.Resolver
+	ClusterId           *clusterid.Identifier
 	Server              http.Server
+	SelfTrace           *selftrace.Tracer
 
 	RequestMetric  *metrics.Metric[*requestMetric]
 	SendRateMetric *metrics.Metric[*sendRateMetric]
@@ -119,7 +131,10 @@ func (webhook *webhook) handleRequest(ctx *gin.Context) {
 	}
 }
 
-func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metric *requestMetric) error {
+func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metric *requestMetric) (err error) {
+	traceCtx, span := webhook.SelfTrace.StartSpan(ctx.Request.Context(), "audit.webhook")
+	defer func() { selftrace.EndSpan(span, err) }()
+
 	cluster := ctx.Param("cluster")
 	if cluster == "" {
 		cluster = webhook.ClusterNameResolver.Resolve(ctx.ClientIP())
@@ -128,6 +143,8 @@ func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metr
 	metric.Cluster = cluster
 	logger = logger.WithField("cluster", cluster)
 
+	receiveTime := webhook.Clock.Now()
+
 	postData, err := ctx.GetRawData()
 	if err != nil {
 		return fmt.Errorf("cannot read POST data: %w", err)
@@ -141,11 +158,34 @@ func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metr
 
 	logger.WithField("itemCount", len(eventList.Items)).Debug("Received EventList")
 
+	webhook.Publish(traceCtx, cluster, ctx.ClientIP(), receiveTime, eventList)
+
+	return nil
+}
+
+func (webhook *webhook) Publish(
+	ctx context.Context,
+	cluster string,
+	sourceAddr string,
+	receiveTime time.Time,
+	eventList *auditv1.EventList,
+) {
 	// TODO optimize these loops to reduce memory usage
 
+	cluster = webhook.ClusterId.Normalize(cluster)
+
+	ctx, span := webhook.SelfTrace.StartSpan(
+		ctx,
+		"audit.publish",
+		attribute.String("cluster", cluster),
+		attribute.Int("events", len(eventList.Items)),
+	)
+	defer span.End()
+	traceParent := webhook.SelfTrace.Inject(ctx)
+
 	rawMessage := &audit.RawMessage{
 		Cluster:    cluster,
-		SourceAddr: ctx.ClientIP(),
+		SourceAddr: sourceAddr,
 		EventList:  eventList,
 	}
 	for _, ch := range webhook.rawSubscribers {
@@ -156,7 +196,9 @@ func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metr
 	for _, auditEvent := range eventList.Items {
 		message := &audit.Message{
 			Cluster:       cluster,
-			ApiserverAddr: ctx.ClientIP(),
+			ApiserverAddr: sourceAddr,
+			ReceiveTime:   &receiveTime,
+			TraceParent:   traceParent,
 			Event:         auditEvent,
 		}
 
@@ -165,8 +207,6 @@ func (webhook *webhook) handle(ctx *gin.Context, logger logrus.FieldLogger, metr
 			ch.queue.Send(message)
 		}
 	}
-
-	return nil
 }
 
 func (webhook *webhook) Start(ctx context.Context) error { return nil }
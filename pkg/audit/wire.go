@@ -0,0 +1,100 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
+)
+
+const messageVersion byte = 1
+
+const (
+	messageFieldCluster       protowire.Number = 1
+	messageFieldApiserverAddr protowire.Number = 2
+	messageFieldReceiveTime   protowire.Number = 3
+	messageFieldEvent         protowire.Number = 4
+	messageFieldTraceParent   protowire.Number = 5
+)
+
+// EncodeMessage serializes a message in the given encoding, following the schema in message.proto.
+func EncodeMessage(message *Message, encoding utilwire.Encoding) ([]byte, error) {
+	if encoding != utilwire.EncodingProtobuf {
+		return json.Marshal(message)
+	}
+
+	event, err := message.Event.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode audit event: %w", err)
+	}
+
+	buf := []byte{}
+	buf = utilwire.AppendString(buf, messageFieldCluster, message.Cluster)
+	buf = utilwire.AppendString(buf, messageFieldApiserverAddr, message.ApiserverAddr)
+	if message.ReceiveTime != nil {
+		buf = utilwire.AppendTime(buf, messageFieldReceiveTime, *message.ReceiveTime)
+	}
+	buf = utilwire.AppendBytes(buf, messageFieldEvent, event)
+	if message.TraceParent != "" {
+		buf = utilwire.AppendString(buf, messageFieldTraceParent, message.TraceParent)
+	}
+
+	return utilwire.Frame(messageVersion, buf), nil
+}
+
+// DecodeMessage deserializes a message encoded by EncodeMessage in any encoding.
+func DecodeMessage(payload []byte, message *Message) error {
+	isFramed, version, body, err := utilwire.Unframe(payload)
+	if err != nil {
+		return err
+	}
+
+	if !isFramed {
+		return json.Unmarshal(payload, message)
+	}
+
+	if version != messageVersion {
+		return fmt.Errorf("unsupported audit message version %d", version)
+	}
+
+	fields, err := utilwire.Fields(body)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case messageFieldCluster:
+			message.Cluster = string(field.Bytes)
+		case messageFieldApiserverAddr:
+			message.ApiserverAddr = string(field.Bytes)
+		case messageFieldReceiveTime:
+			receiveTime := field.Time()
+			message.ReceiveTime = &receiveTime
+		case messageFieldEvent:
+			if err := message.Event.Unmarshal(field.Bytes); err != nil {
+				return fmt.Errorf("cannot decode audit event: %w", err)
+			}
+		case messageFieldTraceParent:
+			message.TraceParent = string(field.Bytes)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 678000000, time.UTC)
+
+	message := &audit.Message{
+		Cluster:       "test",
+		ApiserverAddr: "10.0.0.1",
+		ReceiveTime:   &now,
+		TraceParent:   "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		Event: auditv1.Event{
+			AuditID:                  "abc",
+			Stage:                    auditv1.StageResponseComplete,
+			Verb:                     audit.VerbUpdate,
+			ObjectRef:                &auditv1.ObjectReference{Resource: "pods", Namespace: "default", Name: "foo"},
+			ResponseObject:           &runtime.Unknown{Raw: []byte(`{"kind":"Pod"}`)},
+			StageTimestamp:           metav1.NewMicroTime(now),
+			RequestReceivedTimestamp: metav1.NewMicroTime(now.Add(-time.Second)),
+		},
+	}
+
+	for _, encoding := range []utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf} {
+		t.Run(string(encoding), func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf, err := audit.EncodeMessage(message, encoding)
+			assert.NoError(err)
+
+			decoded := &audit.Message{}
+			assert.NoError(audit.DecodeMessage(buf, decoded))
+
+			assert.Equal(message.Cluster, decoded.Cluster)
+			assert.Equal(message.ApiserverAddr, decoded.ApiserverAddr)
+			if assert.NotNil(decoded.ReceiveTime) {
+				assert.True(message.ReceiveTime.Equal(*decoded.ReceiveTime))
+			}
+			assert.Equal(message.TraceParent, decoded.TraceParent)
+			assert.Equal(message.AuditID, decoded.AuditID)
+			assert.Equal(message.Verb, decoded.Verb)
+			assert.Equal(message.ObjectRef, decoded.ObjectRef)
+			assert.JSONEq(string(message.ResponseObject.Raw), string(decoded.ResponseObject.Raw))
+			assert.True(message.StageTimestamp.Equal(&decoded.StageTimestamp))
+		})
+	}
+}
+
+func TestMessageWithoutReceiveTime(t *testing.T) {
+	message := &audit.Message{Cluster: "test"}
+
+	for _, encoding := range []utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf} {
+		t.Run(string(encoding), func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf, err := audit.EncodeMessage(message, encoding)
+			assert.NoError(err)
+			assert.NotContains(string(buf), "receiveTime")
+
+			decoded := &audit.Message{}
+			assert.NoError(audit.DecodeMessage(buf, decoded))
+			assert.Nil(decoded.ReceiveTime)
+		})
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	assert.Error(t, audit.DecodeMessage(utilwire.Frame(255, nil), &audit.Message{}))
+}
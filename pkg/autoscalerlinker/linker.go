@@ -0,0 +1,127 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links HorizontalPodAutoscalers and VerticalPodAutoscalers under their target workloads.
+package autoscalerlinker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("autoscaler-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "autoscaler-linker-enable", false, "enable linker for HPA and VPA objects")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options        options
+	Logger         logrus.FieldLogger
+	DiscoveryCache discovery.DiscoveryCache
+	ObjectCache    *objectcache.ObjectCache
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options        { return &ctrl.options }
+func (ctrl *controller) Init() error                     { return nil }
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+// the field path of the target reference for each autoscaler type
+var targetRefFields = map[schema.GroupResource][]string{
+	{Group: "autoscaling", Resource: "horizontalpodautoscalers"}:      {"spec", "scaleTargetRef"},
+	{Group: "autoscaling.k8s.io", Resource: "verticalpodautoscalers"}: {"spec", "targetRef"},
+}
+
+func (ctrl *controller) LinkerName() string { return "autoscaler-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	fieldPath, isAutoscaler := targetRefFields[object.GroupVersionResource().GroupResource()]
+	if !isAutoscaler {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	targetRef, found, err := unstructured.NestedStringMap(raw.Object, fieldPath...)
+	if err != nil || !found {
+		logger.Debug("autoscaler has no target reference")
+		return nil, nil
+	}
+
+	groupVersion, err := schema.ParseGroupVersion(targetRef["apiVersion"])
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("invalid target apiVersion: %w", err), "ParseTarget")
+	}
+
+	gvk := groupVersion.WithKind(targetRef["kind"])
+
+	cdc, err := ctrl.DiscoveryCache.ForCluster(object.Cluster)
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot get discovery cache: %w", err), "DiscoveryCache")
+	}
+
+	gvr, exists := cdc.LookupResource(gvk)
+	if !exists {
+		return nil, metrics.LabelError(fmt.Errorf("autoscaler targets unknown GVK %v", gvk), "UnknownTarget")
+	}
+
+	target := utilobject.NewRich(object.Cluster, gvr, object.Namespace, targetRef["name"], "")
+	logger.WithFields(target.AsFields("target")).Debug("Resolved autoscaler target")
+
+	return []linker.LinkerResult{{
+		Object:  target,
+		Role:    zconstants.LinkRoleParent,
+		Class:   "children",
+		DedupId: "autoscalerTarget",
+	}}, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerfailure
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"container-failure-audit-decorator",
+		manager.Ptr(&auditDecorator{}),
+		&manager.List[audit.Decorator]{},
+	)
+}
+
+type auditOptions struct {
+	enable  bool
+	recency time.Duration
+}
+
+func (options *auditOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"container-failure-audit-decorator-enable",
+		false,
+		"tag pod status update audit spans with crash-looping and OOM-killed containers as errors; "+
+			"requires the RequestResponse audit level for pods/status",
+	)
+	fs.DurationVar(
+		&options.recency,
+		"container-failure-audit-decorator-recency",
+		time.Minute,
+		"OOM kills are only reported in status updates within this duration after the container terminated",
+	)
+}
+
+func (options *auditOptions) EnableFlag() *bool { return &options.enable }
+
+type auditDecorator struct {
+	options auditOptions
+	Logs    *LogFetcher
+
+	FailureMetric *metrics.Metric[*failureMetric]
+}
+
+var _ manager.Component = &auditDecorator{}
+
+func (d *auditDecorator) Options() manager.Options        { return &d.options }
+func (d *auditDecorator) Init() error                     { return nil }
+func (d *auditDecorator) Start(ctx context.Context) error { return nil }
+func (d *auditDecorator) Close(ctx context.Context) error { return nil }
+
+func (d *auditDecorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	if message.ObjectRef == nil || message.ObjectRef.APIGroup != "" || message.ObjectRef.Resource != "pods" ||
+		message.ObjectRef.Subresource != "status" {
+		return
+	}
+
+	if message.ResponseObject == nil || message.ResponseStatus != nil && message.ResponseStatus.Code >= 300 {
+		return
+	}
+
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(message.ResponseObject.Raw, pod); err != nil || pod.Kind != "Pod" {
+		return
+	}
+
+	failures := FromPodStatus(pod, message.StageTimestamp.Time, d.options.recency)
+	for _, failure := range failures {
+		d.FailureMetric.With(&failureMetric{Cluster: message.Cluster, Type: failure.Type, Source: "PodStatus"}).Count(1)
+	}
+
+	apply(event, failures)
+	d.Logs.Attach(ctx, message.Cluster, message.ObjectRef.Namespace, message.ObjectRef.Name, failures, event)
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerfailure
+
+import (
+	"context"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"container-failure-event-decorator",
+		manager.Ptr(&eventDecorator{}),
+		&manager.List[eventdecorator.Decorator]{},
+	)
+}
+
+type eventOptions struct {
+	enable bool
+}
+
+func (options *eventOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"container-failure-event-decorator-enable",
+		false,
+		"tag kubelet back-off and probe failure event spans of pods as errors",
+	)
+}
+
+func (options *eventOptions) EnableFlag() *bool { return &options.enable }
+
+type eventDecorator struct {
+	options eventOptions
+	Logs    *LogFetcher
+
+	FailureMetric *metrics.Metric[*failureMetric]
+}
+
+type failureMetric struct {
+	Cluster string
+	Type    Type
+	Source  string
+}
+
+func (*failureMetric) MetricName() string { return "container_failure" }
+
+var _ manager.Component = &eventDecorator{}
+
+func (d *eventDecorator) Options() manager.Options        { return &d.options }
+func (d *eventDecorator) Init() error                     { return nil }
+func (d *eventDecorator) Start(ctx context.Context) error { return nil }
+func (d *eventDecorator) Close(ctx context.Context) error { return nil }
+
+func (d *eventDecorator) Decorate(ctx context.Context, object utilobject.Rich, event *aggregatorevent.Event) {
+	if event == nil || event.TraceSource != zconstants.TraceSourceEvent {
+		return
+	}
+
+	if object.Group != "" || object.Resource != "pods" {
+		return
+	}
+
+	message := ""
+	for _, log := range event.Logs {
+		if log.Type == zconstants.LogTypeEventMessage {
+			message = log.Message
+			break
+		}
+	}
+
+	failure, ok := FromEvent(event.Title, message)
+	if !ok {
+		return
+	}
+
+	d.FailureMetric.With(&failureMetric{Cluster: object.Cluster, Type: failure.Type, Source: "Event"}).Count(1)
+
+	// the event message is already logged by the event controller
+	failure.Message = ""
+	apply(event, []Failure{failure})
+	d.Logs.Attach(ctx, object.Cluster, object.Namespace, object.Name, []Failure{failure}, event)
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tags Pod event spans with container failures reported by the kubelet.
+//
+// Kubelet events (BackOff and Unhealthy) and container states in pod status updates are classified into
+// crash loops, OOM kills and probe failures, which are attached to the span as error logs.
+// Optionally, the last log lines of the failed containers are attached as well.
+package containerfailure
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+type Type string
+
+const (
+	TypeCrashLoopBackOff     Type = "CrashLoopBackOff"
+	TypeOOMKilled            Type = "OOMKilled"
+	TypeLivenessProbeFailed  Type = "LivenessProbeFailed"
+	TypeReadinessProbeFailed Type = "ReadinessProbeFailed"
+	TypeStartupProbeFailed   Type = "StartupProbeFailed"
+)
+
+// Failure is a container failure observed on a pod.
+type Failure struct {
+	Type      Type
+	Container string
+	Message   string
+}
+
+var (
+	backOffRegex = regexp.MustCompile(`^Back-off restarting failed container (\S+)`)
+	probePrefix  = map[string]Type{
+		"Liveness probe failed:":  TypeLivenessProbeFailed,
+		"Readiness probe failed:": TypeReadinessProbeFailed,
+		"Startup probe failed:":   TypeStartupProbeFailed,
+	}
+)
+
+// FromEvent classifies a kubelet event on a pod.
+// The container name is not available for probe failures.
+func FromEvent(reason string, message string) (Failure, bool) {
+	switch reason {
+	case "BackOff":
+		matches := backOffRegex.FindStringSubmatch(message)
+		if matches == nil {
+			// image pull back-off is also reported with the BackOff reason
+			return Failure{}, false
+		}
+		return Failure{Type: TypeCrashLoopBackOff, Container: matches[1], Message: message}, true
+	case "Unhealthy":
+		for prefix, ty := range probePrefix {
+			if strings.HasPrefix(message, prefix) {
+				return Failure{Type: ty, Message: strings.TrimSpace(strings.TrimPrefix(message, prefix))}, true
+			}
+		}
+	}
+
+	return Failure{}, false
+}
+
+// FromPodStatus returns the container failures in the status of a pod.
+// OOM kills are only reported if the container terminated within `recency` before `now`,
+// since the last termination state is retained in all subsequent status updates.
+func FromPodStatus(pod *corev1.Pod, now time.Time, recency time.Duration) []Failure {
+	var failures []Failure
+
+	statusLists := [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses}
+	for _, statuses := range statusLists {
+		for _, status := range statuses {
+			if waiting := status.State.Waiting; waiting != nil && waiting.Reason == string(TypeCrashLoopBackOff) {
+				failures = append(failures, Failure{Type: TypeCrashLoopBackOff, Container: status.Name, Message: waiting.Message})
+			}
+
+			terminated := status.LastTerminationState.Terminated
+			if status.State.Terminated != nil {
+				terminated = status.State.Terminated
+			}
+			if terminated != nil && terminated.Reason == string(TypeOOMKilled) &&
+				!terminated.FinishedAt.IsZero() && now.Sub(terminated.FinishedAt.Time) <= recency {
+				failures = append(failures, Failure{Type: TypeOOMKilled, Container: status.Name, Message: terminated.Message})
+			}
+		}
+	}
+
+	return failures
+}
+
+func apply(event *aggregatorevent.Event, failures []Failure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	types := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		types = append(types, string(failure.Type))
+
+		message := string(failure.Type)
+		if failure.Container != "" {
+			message += " (" + failure.Container + ")"
+		}
+		if failure.Message != "" {
+			message += ": " + failure.Message
+		}
+		event.Log(zconstants.LogTypeRealError, message, "container", failure.Container, "failure", string(failure.Type))
+	}
+
+	event.SetTag("error", true)
+	event.SetTag("containerFailure", strings.Join(types, ","))
+}
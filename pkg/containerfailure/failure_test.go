@@ -0,0 +1,82 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerfailure_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/containerfailure"
+)
+
+func TestFromEvent(t *testing.T) {
+	failure, ok := containerfailure.FromEvent("BackOff", "Back-off restarting failed container app in pod app-0_default(uid)")
+	assert.True(t, ok)
+	assert.Equal(t, containerfailure.TypeCrashLoopBackOff, failure.Type)
+	assert.Equal(t, "app", failure.Container)
+
+	failure, ok = containerfailure.FromEvent("Unhealthy", "Liveness probe failed: HTTP probe failed with statuscode: 500")
+	assert.True(t, ok)
+	assert.Equal(t, containerfailure.TypeLivenessProbeFailed, failure.Type)
+	assert.Equal(t, "HTTP probe failed with statuscode: 500", failure.Message)
+
+	_, ok = containerfailure.FromEvent("BackOff", `Back-off pulling image "nginx:nonexistent"`)
+	assert.False(t, ok)
+
+	_, ok = containerfailure.FromEvent("Scheduled", "Successfully assigned default/app-0 to node-1")
+	assert.False(t, ok)
+}
+
+func TestFromPodStatus(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{{
+				Name:  "init",
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}},
+			}},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "app",
+					State: corev1.ContainerState{
+						Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff", Message: "back-off 20s"},
+					},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Reason:     "OOMKilled",
+						FinishedAt: metav1.NewTime(now.Add(-time.Second * 10)),
+					}},
+				},
+				{
+					Name:  "sidecar",
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+					LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Reason:     "OOMKilled",
+						FinishedAt: metav1.NewTime(now.Add(-time.Hour)),
+					}},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []containerfailure.Failure{
+		{Type: containerfailure.TypeCrashLoopBackOff, Container: "app", Message: "back-off 20s"},
+		{Type: containerfailure.TypeOOMKilled, Container: "app"},
+	}, containerfailure.FromPodStatus(pod, now, time.Minute))
+}
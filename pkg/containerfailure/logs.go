@@ -0,0 +1,280 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerfailure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("container-log-excerpt", manager.Ptr(&LogFetcher{
+		lastFetch: map[containerKey]time.Time{},
+	}))
+}
+
+const redactedText = "[REDACTED]"
+
+type logOptions struct {
+	enable         bool
+	lines          int64
+	maxBytes       int
+	timeout        time.Duration
+	cooldown       time.Duration
+	excludePattern string
+	redactPattern  string
+}
+
+func (options *logOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"container-log-excerpt-enable",
+		false,
+		"attach the last log lines of failed containers to container failure spans; "+
+			"requires the container failure decorators and permission to get pods/log",
+	)
+	fs.Int64Var(&options.lines, "container-log-excerpt-lines", 20, "number of log lines to attach")
+	fs.IntVar(&options.maxBytes, "container-log-excerpt-max-bytes", 4096, "maximum size of each attached log excerpt")
+	fs.DurationVar(&options.timeout, "container-log-excerpt-timeout", time.Second*5, "timeout for fetching container logs")
+	fs.DurationVar(
+		&options.cooldown,
+		"container-log-excerpt-cooldown",
+		time.Minute*5,
+		"logs of the same container are attached at most once within this duration",
+	)
+	fs.StringVar(
+		&options.excludePattern,
+		"container-log-excerpt-exclude-pattern",
+		"$this matches nothing^",
+		"logs are not fetched for containers matching this regexp pattern in the form cluster/namespace/pod/container",
+	)
+	fs.StringVar(
+		&options.redactPattern,
+		"container-log-excerpt-redact-pattern",
+		`(?i)(password|passwd|secret|token|api[_-]?key|authorization)(["']?\s*[:=]\s*|\s+)\S+`,
+		"substrings of log lines matching this regexp pattern are replaced with "+redactedText+
+			", retaining the first two capture groups if present",
+	)
+}
+
+func (options *logOptions) EnableFlag() *bool { return nil }
+
+// LogFetcher attaches log excerpts of failed containers to events.
+type LogFetcher struct {
+	options logOptions
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+
+	ExcerptMetric *metrics.Metric[*excerptMetric]
+
+	excludeRegex *regexp.Regexp
+	redactRegex  *regexp.Regexp
+
+	lastFetchMu sync.Mutex
+	lastFetch   map[containerKey]time.Time
+}
+
+type excerptMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*excerptMetric) MetricName() string { return "container_log_excerpt" }
+
+type containerKey struct {
+	cluster   string
+	namespace string
+	pod       string
+	container string
+}
+
+var _ manager.Component = &LogFetcher{}
+
+func (fetcher *LogFetcher) Options() manager.Options { return &fetcher.options }
+
+func (fetcher *LogFetcher) Init() (err error) {
+	if !fetcher.options.enable {
+		return nil
+	}
+
+	fetcher.excludeRegex, err = regexp.Compile(fetcher.options.excludePattern)
+	if err != nil {
+		return fmt.Errorf("cannot compile --container-log-excerpt-exclude-pattern: %w", err)
+	}
+
+	if fetcher.options.redactPattern != "" {
+		fetcher.redactRegex, err = regexp.Compile(fetcher.options.redactPattern)
+		if err != nil {
+			return fmt.Errorf("cannot compile --container-log-excerpt-redact-pattern: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (fetcher *LogFetcher) Start(ctx context.Context) error { return nil }
+func (fetcher *LogFetcher) Close(ctx context.Context) error { return nil }
+
+// Attach fetches the logs of each failed container of the pod and logs them on the event.
+// Failures without a container name are skipped.
+func (fetcher *LogFetcher) Attach(
+	ctx context.Context,
+	cluster, namespace, pod string,
+	failures []Failure,
+	event *aggregatorevent.Event,
+) {
+	if !fetcher.options.enable {
+		return
+	}
+
+	attached := map[string]struct{}{}
+	for _, failure := range failures {
+		if failure.Container == "" {
+			continue
+		}
+		if _, seen := attached[failure.Container]; seen {
+			continue
+		}
+		attached[failure.Container] = struct{}{}
+
+		key := containerKey{cluster: cluster, namespace: namespace, pod: pod, container: failure.Container}
+		if fetcher.excludeRegex.MatchString(strings.Join([]string{cluster, namespace, pod, failure.Container}, "/")) {
+			continue
+		}
+		if !fetcher.tryAcquire(key) {
+			continue
+		}
+
+		excerpt, err := fetcher.fetch(ctx, key)
+		metric := &excerptMetric{Cluster: cluster}
+		if err != nil {
+			metric.Error = metrics.LabelError(err, "GetLogs")
+			fetcher.Logger.
+				WithField("cluster", cluster).
+				WithField("namespace", namespace).
+				WithField("pod", pod).
+				WithField("container", failure.Container).
+				WithError(err).
+				Debug("cannot fetch container logs")
+		} else if excerpt != "" {
+			event.Log(zconstants.LogTypeContainerLogs, excerpt, "container", failure.Container)
+		}
+		fetcher.ExcerptMetric.With(metric).Count(1)
+	}
+}
+
+func (fetcher *LogFetcher) tryAcquire(key containerKey) bool {
+	now := fetcher.Clock.Now()
+
+	fetcher.lastFetchMu.Lock()
+	defer fetcher.lastFetchMu.Unlock()
+
+	if last, exists := fetcher.lastFetch[key]; exists && now.Sub(last) < fetcher.options.cooldown {
+		return false
+	}
+
+	for otherKey, last := range fetcher.lastFetch {
+		if now.Sub(last) >= fetcher.options.cooldown {
+			delete(fetcher.lastFetch, otherKey)
+		}
+	}
+
+	fetcher.lastFetch[key] = now
+	return true
+}
+
+func (fetcher *LogFetcher) fetch(ctx context.Context, key containerKey) (string, error) {
+	client, err := fetcher.Clients.Cluster(key.cluster)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancelFunc := context.WithTimeout(ctx, fetcher.options.timeout)
+	defer cancelFunc()
+
+	// fetch a few extra bytes so that the first line can be identified as truncated
+	limitBytes := int64(fetcher.options.maxBytes) * 2
+	stream, err := client.KubernetesClient().CoreV1().Pods(key.namespace).GetLogs(key.pod, &corev1.PodLogOptions{
+		Container: key.container,
+		// the failure logs are from the terminated instance of a crash-looping or OOM-killed container
+		Previous:   true,
+		TailLines:  &fetcher.options.lines,
+		LimitBytes: &limitBytes,
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	raw, err := io.ReadAll(io.LimitReader(stream, limitBytes))
+	if err != nil {
+		return "", err
+	}
+
+	return Excerpt(string(raw), fetcher.options.maxBytes, fetcher.redactRegex), nil
+}
+
+// Excerpt redacts the log and keeps the complete trailing lines within maxBytes.
+// If the last line alone exceeds maxBytes, its tail is kept.
+func Excerpt(log string, maxBytes int, redact *regexp.Regexp) string {
+	log = strings.TrimRight(log, "\n")
+
+	if redact != nil {
+		lines := strings.Split(log, "\n")
+		for i, line := range lines {
+			lines[i] = redactLine(line, redact)
+		}
+		log = strings.Join(lines, "\n")
+	}
+
+	if len(log) <= maxBytes {
+		return log
+	}
+
+	log = log[len(log)-maxBytes:]
+	if newline := strings.IndexByte(log, '\n'); newline != -1 {
+		log = log[newline+1:]
+	}
+
+	return log
+}
+
+// redactLine replaces the value following each matched key with redactedText, retaining the key for context.
+func redactLine(line string, redact *regexp.Regexp) string {
+	return redact.ReplaceAllStringFunc(line, func(match string) string {
+		submatches := redact.FindStringSubmatch(match)
+		if len(submatches) >= 3 {
+			return submatches[1] + submatches[2] + redactedText
+		}
+		return redactedText
+	})
+}
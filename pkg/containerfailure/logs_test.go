@@ -0,0 +1,39 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containerfailure_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/containerfailure"
+)
+
+func TestExcerpt(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("a\nb", containerfailure.Excerpt("a\nb\n", 100, nil))
+	assert.Equal("ccc\ndd", containerfailure.Excerpt("aaaa\nbbbb\nccc\ndd\n", 8, nil))
+	assert.Equal("efgh", containerfailure.Excerpt("abcdefgh", 4, nil))
+
+	redact := regexp.MustCompile(`(?i)(password|token)(["']?\s*[:=]\s*|\s+)\S+`)
+	assert.Equal(
+		"connecting with password=[REDACTED]\nTOKEN: [REDACTED] rejected",
+		containerfailure.Excerpt("connecting with password=hunter2\nTOKEN: abc123 rejected\n", 100, redact),
+	)
+	assert.Equal("x [REDACTED]", containerfailure.Excerpt("x secret", 100, regexp.MustCompile(`secret`)))
+}
@@ -26,7 +26,9 @@ import (
 	"k8s.io/utils/clock"
 
 	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
 	"github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
 	"github.com/kubewharf/kelemetry/pkg/k8s"
 	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
 	"github.com/kubewharf/kelemetry/pkg/manager"
@@ -57,6 +59,8 @@ type api struct {
 	ObjectCache   *objectcache.ObjectCache
 	Server        http.Server
 	Clients       k8s.Clients
+	Auth          *auth.Authenticator
+	Tenant        *tenant.Filter
 	RequestMetric *metrics.Metric[*requestMetric]
 	ScanMetric    *metrics.Metric[*scanMetric]
 }
@@ -74,7 +78,7 @@ func (api *api) Options() manager.Options {
 }
 
 func (api *api) Init() error {
-	api.Server.Routes().GET("/diff/:group/:version/:resource/:namespace/:name/:rv", func(ctx *gin.Context) {
+	api.Server.Routes().GET("/diff/:group/:version/:resource/:namespace/:name/:rv", api.Auth.Wrap(func(ctx *gin.Context) {
 		logger := api.Logger.WithField("source", ctx.Request.RemoteAddr)
 		defer shutdown.RecoverPanic(logger)
 		metric := &requestMetric{}
@@ -83,9 +87,9 @@ func (api *api) Init() error {
 		if err := api.handleGet(ctx); err != nil {
 			logger.WithError(err).Error()
 		}
-	})
+	}))
 
-	api.Server.Routes().GET("/diff/:group/:version/:resource/:namespace/:name", func(ctx *gin.Context) {
+	api.Server.Routes().GET("/diff/:group/:version/:resource/:namespace/:name", api.Auth.Wrap(func(ctx *gin.Context) {
 		logger := api.Logger.WithField("source", ctx.Request.RemoteAddr)
 		defer shutdown.RecoverPanic(logger)
 		metric := &scanMetric{}
@@ -94,7 +98,7 @@ func (api *api) Init() error {
 		if err := api.handleScan(ctx); err != nil {
 			logger.WithError(err).Error()
 		}
-	})
+	}))
 
 	return nil
 }
@@ -114,16 +118,19 @@ func (api *api) handleGet(ctx *gin.Context) error {
 		cluster = clusterQuery
 	}
 
-	raw, err := api.ObjectCache.Get(ctx, utilobject.VersionedKey{
-		Key: utilobject.Key{
-			Cluster:   cluster,
-			Group:     group,
-			Resource:  resource,
-			Namespace: namespace,
-			Name:      name,
-		},
-		Version: version,
-	})
+	key := utilobject.Key{
+		Cluster:   cluster,
+		Group:     group,
+		Resource:  resource,
+		Namespace: namespace,
+		Name:      name,
+	}
+	if !api.Tenant.Allows(api.Tenant.RequestContext(ctx.Request), key) {
+		// respond the same as a missing object to avoid revealing its existence
+		return ctx.AbortWithError(404, fmt.Errorf("object does not exist"))
+	}
+
+	raw, err := api.ObjectCache.Get(ctx, utilobject.VersionedKey{Key: key, Version: version})
 	if err != nil {
 		return err
 	}
@@ -165,16 +172,19 @@ func (api *api) handleScan(ctx *gin.Context) error {
 		limit = parsedLimit
 	}
 
-	raw, err := api.ObjectCache.Get(ctx, utilobject.VersionedKey{
-		Key: utilobject.Key{
-			Cluster:   cluster,
-			Group:     group,
-			Resource:  resource,
-			Namespace: namespace,
-			Name:      name,
-		},
-		Version: version,
-	})
+	key := utilobject.Key{
+		Cluster:   cluster,
+		Group:     group,
+		Resource:  resource,
+		Namespace: namespace,
+		Name:      name,
+	}
+	if !api.Tenant.Allows(api.Tenant.RequestContext(ctx.Request), key) {
+		// respond the same as a missing object to avoid revealing its existence
+		return ctx.AbortWithError(404, fmt.Errorf("object does not exist"))
+	}
+
+	raw, err := api.ObjectCache.Get(ctx, utilobject.VersionedKey{Key: key, Version: version})
 	if err != nil {
 		return err
 	}
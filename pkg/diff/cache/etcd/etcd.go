@@ -16,7 +16,6 @@ package etcd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -26,9 +25,11 @@ import (
 	etcdv3 "go.etcd.io/etcd/client/v3"
 
 	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
 	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/secret"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
@@ -41,12 +42,21 @@ func init() {
 
 type etcdOptions struct {
 	endpoints   []string
+	username    string
+	password    string
 	prefix      string
 	dialTimeout time.Duration
 }
 
 func (options *etcdOptions) Setup(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&options.endpoints, "diff-cache-etcd-endpoints", []string{}, "etcd endpoints")
+	fs.StringVar(&options.username, "diff-cache-etcd-username", "", "etcd username; accepts secret references such as 'file:/path'")
+	fs.StringVar(
+		&options.password,
+		"diff-cache-etcd-password",
+		"",
+		"etcd password; accepts secret references such as 'file:/path', which are resolved on startup",
+	)
 	fs.StringVar(&options.prefix, "diff-cache-etcd-prefix", "/diff/", "etcd prefix")
 	fs.DurationVar(
 		&options.dialTimeout,
@@ -58,12 +68,21 @@ func (options *etcdOptions) Setup(fs *pflag.FlagSet) {
 
 func (options *etcdOptions) EnableFlag() *bool { return nil }
 
+func (options *etcdOptions) Validate() error {
+	if len(options.endpoints) == 0 {
+		return fmt.Errorf("--diff-cache-etcd-endpoints must be specified if --diff-cache=etcd")
+	}
+	return nil
+}
+
 type Etcd struct {
 	manager.MuxImplBase
 
 	options        etcdOptions
 	Logger         logrus.FieldLogger
+	Secrets        *secret.Store
 	ClusterConfigs k8sconfig.Config
+	Dropped        *dropped.Recorder
 
 	client    *etcdv3.Client
 	deferList *shutdown.DeferList
@@ -76,12 +95,20 @@ func (_ *Etcd) MuxImplName() (name string, isDefault bool) { return "etcd", fals
 func (cache *Etcd) Options() manager.Options { return &cache.options }
 
 func (cache *Etcd) Init() error {
-	if len(cache.options.endpoints) == 0 {
-		return fmt.Errorf("no etcd endpoints provided")
+	// the etcd client cannot change credentials without reconnecting
+	username, err := cache.Secrets.Resolve("diff-cache-etcd-username", cache.options.username)
+	if err != nil {
+		return err
+	}
+	password, err := cache.Secrets.Resolve("diff-cache-etcd-password", cache.options.password)
+	if err != nil {
+		return err
 	}
 
 	client, err := etcdv3.New(etcdv3.Config{
 		Endpoints:   cache.options.endpoints,
+		Username:    username,
+		Password:    password,
 		DialTimeout: cache.options.dialTimeout,
 	})
 	if err != nil {
@@ -106,27 +133,42 @@ func (cache *Etcd) Close(ctx context.Context) error {
 	return nil
 }
 
+// CheckReadiness checks whether etcd is reachable.
+func (cache *Etcd) CheckReadiness(ctx context.Context) error {
+	if _, err := cache.client.KV.Get(ctx, "health", etcdv3.WithCountOnly()); err != nil {
+		return fmt.Errorf("etcd is unreachable: %w", err)
+	}
+	return nil
+}
+
 func (cache *Etcd) GetCommonOptions() *diffcache.CommonOptions {
 	return cache.GetAdditionalOptions().(*diffcache.CommonOptions)
 }
 
 func (cache *Etcd) Store(ctx context.Context, object utilobject.Key, patch *diffcache.Patch) {
-	patchJson, err := json.Marshal(patch)
+	logger := cache.Logger.WithFields(object.AsFields("object"))
+
+	patchBuf, err := diffcache.EncodePatch(patch, cache.GetCommonOptions().Encoding)
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot marshal patch")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "EncodePatch", err)
+		return
+	}
+
+	if err := cache.GetCommonOptions().CheckValueSize(len(patchBuf)); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "PatchTooLarge", err)
 		return
 	}
 
 	lease, err := cache.client.Lease.Grant(ctx, int64(cache.GetCommonOptions().PatchTtl.Seconds()))
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot grant lease for diff cache")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "GrantLease", err)
 		return
 	}
 
 	keyRv, _ := cache.ClusterConfigs.Provide(object.Cluster).ChooseResourceVersion(patch.OldResourceVersion, &patch.NewResourceVersion)
-	_, err = cache.client.KV.Put(ctx, cache.cacheKey(object, keyRv), string(patchJson), etcdv3.WithLease(lease.ID))
+	_, err = cache.client.KV.Put(ctx, cache.cacheKey(object, keyRv), string(patchBuf), etcdv3.WithLease(lease.ID))
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot write cache")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "WritePatch", err)
 		return
 	}
 }
@@ -154,9 +196,8 @@ func (cache *Etcd) Fetch(
 		return nil, nil
 	}
 
-	jsonBuf := resp.Kvs[0].Value
 	patch := &diffcache.Patch{}
-	if err := json.Unmarshal(jsonBuf, patch); err != nil {
+	if err := diffcache.DecodePatch(resp.Kvs[0].Value, patch); err != nil {
 		cache.Logger.WithError(err).Error("cannot decode etcd result")
 		return nil, metrics.LabelError(err, "EtcdValueError")
 	}
@@ -165,22 +206,29 @@ func (cache *Etcd) Fetch(
 }
 
 func (cache *Etcd) StoreSnapshot(ctx context.Context, object utilobject.Key, snapshotName string, snapshot *diffcache.Snapshot) {
-	snapshotJson, err := json.Marshal(snapshot)
+	logger := cache.Logger.WithFields(object.AsFields("object")).WithField("snapshot", snapshotName)
+
+	snapshotBuf, err := diffcache.EncodeSnapshot(snapshot, cache.GetCommonOptions().Encoding)
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot marshal snapshot")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "EncodeSnapshot", err)
+		return
+	}
+
+	if err := cache.GetCommonOptions().CheckValueSize(len(snapshotBuf)); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "SnapshotTooLarge", err)
 		return
 	}
 
 	lease, err := cache.client.Lease.Grant(ctx, int64(cache.GetCommonOptions().SnapshotTtl.Seconds()))
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot grant lease for diff cache")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "GrantLease", err)
 		return
 	}
 
 	key := cache.snapshotKey(object, snapshotName)
-	_, err = cache.client.KV.Put(ctx, key, string(snapshotJson), etcdv3.WithLease(lease.ID))
+	_, err = cache.client.KV.Put(ctx, key, string(snapshotBuf), etcdv3.WithLease(lease.ID))
 	if err != nil {
-		cache.Logger.WithError(err).Error("cannot write cache")
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "WriteSnapshot", err)
 		return
 	}
 }
@@ -197,9 +245,8 @@ func (cache *Etcd) FetchSnapshot(ctx context.Context, object utilobject.Key, sna
 		return nil, nil
 	}
 
-	jsonBuf := resp.Kvs[0].Value
 	snapshot := &diffcache.Snapshot{}
-	if err := json.Unmarshal(jsonBuf, snapshot); err != nil {
+	if err := diffcache.DecodeSnapshot(resp.Kvs[0].Value, snapshot); err != nil {
 		cache.Logger.WithError(err).Error("cannot decode etcd result")
 		return nil, metrics.LabelError(err, "EtcdValueError")
 	}
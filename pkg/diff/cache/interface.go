@@ -17,6 +17,7 @@ package diffcache
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -28,6 +29,7 @@ import (
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
 )
 
 func init() {
@@ -52,6 +54,8 @@ type CommonOptions struct {
 	PatchTtl           time.Duration
 	SnapshotTtl        time.Duration
 	EnableCacheWrapper bool
+	Encoding           utilwire.Encoding
+	MaxValueSize       int
 }
 
 func (options *CommonOptions) Setup(fs *pflag.FlagSet) {
@@ -63,6 +67,32 @@ func (options *CommonOptions) Setup(fs *pflag.FlagSet) {
 		"duration for which snapshot cache remains (0 to disable TTL)",
 	)
 	fs.BoolVar(&options.EnableCacheWrapper, "diff-cache-wrapper-enable", false, "enable an intermediate layer of cache in memory")
+
+	options.Encoding = utilwire.EncodingJson
+	fs.Var(
+		&options.Encoding,
+		"diff-cache-encoding",
+		fmt.Sprintf(
+			"encoding of patches and snapshots in remote caches. Possible values are %q. "+
+				"Both encodings are accepted when reading, so only switch to protobuf after all replicas are upgraded.",
+			[]utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf},
+		),
+	)
+	fs.IntVar(
+		&options.MaxValueSize,
+		"diff-cache-max-value-size",
+		1<<20,
+		"maximum size in bytes of an encoded patch or snapshot stored in remote caches; "+
+			"larger values are dropped instead of failing the write. 0 for no limit",
+	)
+}
+
+// CheckValueSize returns an error if an encoded value of size bytes exceeds --diff-cache-max-value-size.
+func (options *CommonOptions) CheckValueSize(size int) error {
+	if options.MaxValueSize > 0 && size > options.MaxValueSize {
+		return fmt.Errorf("encoded value has %d bytes, exceeding --diff-cache-max-value-size=%d", size, options.MaxValueSize)
+	}
+	return nil
 }
 
 type Cache interface {
@@ -161,6 +191,20 @@ func (mux *mux) Start(ctx context.Context) error {
 	return nil
 }
 
+// FlushCache drops the in-memory cache layer if --diff-cache-wrapper-enable is set.
+func (mux *mux) FlushCache(ctx context.Context) error {
+	if wrapped, ok := mux.impl.(*CacheWrapper); ok {
+		if wrapped.patchCache != nil {
+			wrapped.patchCache.Clear()
+		}
+		if wrapped.snapshotCache != nil {
+			wrapped.snapshotCache.Clear()
+		}
+	}
+
+	return nil
+}
+
 func (mux *mux) GetCommonOptions() *CommonOptions {
 	return mux.options
 }
@@ -0,0 +1,346 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Diff cache backed by a key-value store implemented in a plugin binary.
+//
+// Plugins implement Backend and serve it with (importing this package as diffcacheplugin)
+// `plugin.Serve(plugin.Impl{Kind: diffcacheplugin.Kind, Name: "my-store", Impl: backend})`,
+// then Kelemetry uses it with `--diff-cache=plugin --diff-cache-plugin-impl=my-store`.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+	"strings"
+	"time"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	"github.com/kubewharf/kelemetry/pkg/dropped"
+	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/plugin"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+// Kind is the plugin kind of diff cache backends.
+const Kind = "diff-cache"
+
+func init() {
+	plugin.RegisterKind(Kind, func(impls map[string]any) goplugin.Plugin { return &kindPlugin{impls: impls} })
+	manager.Global.ProvideMuxImpl("diff-cache/plugin", manager.Ptr(&Cache{}), diffcache.Cache.Store)
+}
+
+// Backend is a key-value store implemented by plugins.
+type Backend interface {
+	// Put stores a value that expires after ttl, or never expires if ttl is 0.
+	Put(key string, value []byte, ttl time.Duration) error
+	// Get returns the value of a key, or nil if the key does not exist.
+	Get(key string) ([]byte, error)
+	// ListKeys returns up to limit keys with the prefix, preferably in descending order.
+	ListKeys(prefix string, limit int) ([]string, error)
+}
+
+type options struct {
+	impl string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(&options.impl, "diff-cache-plugin-impl", "", "name of the plugin implementation used if --diff-cache=plugin")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if options.impl == "" {
+		return fmt.Errorf("--diff-cache-plugin-impl must be specified if --diff-cache=plugin")
+	}
+	return nil
+}
+
+type Cache struct {
+	manager.MuxImplBase
+
+	options        options
+	Logger         logrus.FieldLogger
+	ClusterConfigs k8sconfig.Config
+	Host           *plugin.Host
+	Dropped        *dropped.Recorder
+
+	backend Backend
+}
+
+var _ diffcache.Cache = &Cache{}
+
+func (*Cache) MuxImplName() (name string, isDefault bool) { return "plugin", false }
+
+func (cache *Cache) Options() manager.Options { return &cache.options }
+
+func (cache *Cache) Init() error {
+	raw, err := cache.Host.Dispense(Kind, cache.options.impl)
+	if err != nil {
+		return err
+	}
+
+	cache.backend = &backendClient{client: raw.(*rpc.Client), name: cache.options.impl}
+	return nil
+}
+
+func (cache *Cache) Start(ctx context.Context) error { return nil }
+func (cache *Cache) Close(ctx context.Context) error { return nil }
+
+func (cache *Cache) GetCommonOptions() *diffcache.CommonOptions {
+	return cache.GetAdditionalOptions().(*diffcache.CommonOptions)
+}
+
+func (cache *Cache) Store(ctx context.Context, object utilobject.Key, patch *diffcache.Patch) {
+	logger := cache.Logger.WithFields(object.AsFields("object"))
+
+	patchBuf, err := diffcache.EncodePatch(patch, cache.GetCommonOptions().Encoding)
+	if err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "EncodePatch", err)
+		return
+	}
+
+	if err := cache.GetCommonOptions().CheckValueSize(len(patchBuf)); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "PatchTooLarge", err)
+		return
+	}
+
+	keyRv, _ := cache.ClusterConfigs.Provide(object.Cluster).ChooseResourceVersion(patch.OldResourceVersion, &patch.NewResourceVersion)
+	if err := cache.backend.Put(cache.cacheKey(object, keyRv), patchBuf, cache.GetCommonOptions().PatchTtl); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "WritePatch", err)
+	}
+}
+
+func (cache *Cache) Fetch(
+	ctx context.Context,
+	object utilobject.Key,
+	oldResourceVersion string,
+	newResourceVersion *string,
+) (*diffcache.Patch, error) {
+	keyRv, err := cache.ClusterConfigs.Provide(object.Cluster).ChooseResourceVersion(oldResourceVersion, newResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := cache.backend.Get(cache.cacheKey(object, keyRv))
+	if err != nil {
+		return nil, metrics.LabelError(err, "PluginError")
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	patch := &diffcache.Patch{}
+	if err := diffcache.DecodePatch(value, patch); err != nil {
+		return nil, metrics.LabelError(err, "PluginValueError")
+	}
+
+	return patch, nil
+}
+
+func (cache *Cache) StoreSnapshot(ctx context.Context, object utilobject.Key, snapshotName string, snapshot *diffcache.Snapshot) {
+	logger := cache.Logger.WithFields(object.AsFields("object")).WithField("snapshot", snapshotName)
+
+	snapshotBuf, err := diffcache.EncodeSnapshot(snapshot, cache.GetCommonOptions().Encoding)
+	if err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "EncodeSnapshot", err)
+		return
+	}
+
+	if err := cache.GetCommonOptions().CheckValueSize(len(snapshotBuf)); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "SnapshotTooLarge", err)
+		return
+	}
+
+	if err := cache.backend.Put(cache.snapshotKey(object, snapshotName), snapshotBuf, cache.GetCommonOptions().SnapshotTtl); err != nil {
+		cache.Dropped.Drop(logger, dropped.StageDiffCache, "WriteSnapshot", err)
+	}
+}
+
+func (cache *Cache) FetchSnapshot(ctx context.Context, object utilobject.Key, snapshotName string) (*diffcache.Snapshot, error) {
+	value, err := cache.backend.Get(cache.snapshotKey(object, snapshotName))
+	if err != nil {
+		return nil, metrics.LabelError(err, "PluginError")
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	snapshot := &diffcache.Snapshot{}
+	if err := diffcache.DecodeSnapshot(value, snapshot); err != nil {
+		return nil, metrics.LabelError(err, "PluginValueError")
+	}
+
+	return snapshot, nil
+}
+
+func (cache *Cache) List(ctx context.Context, object utilobject.Key, limit int) ([]string, error) {
+	keys, err := cache.backend.ListKeys(cache.cacheKeyPrefix(object), limit)
+	if err != nil {
+		return nil, fmt.Errorf("plugin list error: %w", err)
+	}
+
+	for i, key := range keys {
+		keys[i] = key[strings.LastIndexByte(key, '/')+1:]
+	}
+	return keys, nil
+}
+
+func (cache *Cache) cacheKeyPrefix(object utilobject.Key) string {
+	return object.String() + "/"
+}
+
+func (cache *Cache) cacheKey(object utilobject.Key, keyRv string) string {
+	whichRv := "newRv"
+	if cluster := cache.ClusterConfigs.Provide(object.Cluster); cluster != nil && cluster.UseOldResourceVersion {
+		whichRv = "oldRv"
+	}
+
+	return cache.cacheKeyPrefix(object) + fmt.Sprintf("%s/%s", whichRv, keyRv)
+}
+
+func (cache *Cache) snapshotKey(object utilobject.Key, snapshotName string) string {
+	return cache.cacheKeyPrefix(object) + snapshotName
+}
+
+type kindPlugin struct {
+	impls map[string]any
+}
+
+func (p *kindPlugin) Server(*goplugin.MuxBroker) (any, error) {
+	return &backendServer{impls: p.impls}, nil
+}
+
+func (*kindPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (any, error) {
+	return client, nil
+}
+
+type PutArgs struct {
+	Impl  string
+	Key   string
+	Value []byte
+	Ttl   time.Duration
+}
+
+type GetArgs struct {
+	Impl string
+	Key  string
+}
+
+type GetResult struct {
+	Value  []byte
+	Exists bool
+}
+
+type ListKeysArgs struct {
+	Impl   string
+	Prefix string
+	Limit  int
+}
+
+type backendServer struct {
+	impls map[string]any
+}
+
+func (server *backendServer) backend(name string) (Backend, error) {
+	impl, exists := server.impls[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown implementation %q", name)
+	}
+	return impl.(Backend), nil
+}
+
+func (server *backendServer) Put(args PutArgs, _ *struct{}) error {
+	backend, err := server.backend(args.Impl)
+	if err != nil {
+		return err
+	}
+
+	value := args.Value
+	if value == nil {
+		// gob decodes empty slices as nil
+		value = []byte{}
+	}
+	return backend.Put(args.Key, value, args.Ttl)
+}
+
+func (server *backendServer) Get(args GetArgs, result *GetResult) error {
+	backend, err := server.backend(args.Impl)
+	if err != nil {
+		return err
+	}
+
+	value, err := backend.Get(args.Key)
+	if err != nil {
+		return err
+	}
+
+	*result = GetResult{Value: value, Exists: value != nil}
+	return nil
+}
+
+func (server *backendServer) ListKeys(args ListKeysArgs, result *[]string) error {
+	backend, err := server.backend(args.Impl)
+	if err != nil {
+		return err
+	}
+
+	keys, err := backend.ListKeys(args.Prefix, args.Limit)
+	if err != nil {
+		return err
+	}
+
+	*result = keys
+	return nil
+}
+
+type backendClient struct {
+	client *rpc.Client
+	name   string
+}
+
+func (client *backendClient) Put(key string, value []byte, ttl time.Duration) error {
+	return client.client.Call("Plugin.Put", PutArgs{Impl: client.name, Key: key, Value: value, Ttl: ttl}, &struct{}{})
+}
+
+func (client *backendClient) Get(key string) ([]byte, error) {
+	var result GetResult
+	if err := client.client.Call("Plugin.Get", GetArgs{Impl: client.name, Key: key}, &result); err != nil {
+		return nil, err
+	}
+
+	if !result.Exists {
+		return nil, nil
+	}
+	if result.Value == nil {
+		// gob decodes empty slices as nil
+		return []byte{}, nil
+	}
+	return result.Value, nil
+}
+
+func (client *backendClient) ListKeys(prefix string, limit int) ([]string, error) {
+	var keys []string
+	if err := client.client.Call("Plugin.ListKeys", ListKeysArgs{Impl: client.name, Prefix: prefix, Limit: limit}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
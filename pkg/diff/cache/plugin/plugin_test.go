@@ -0,0 +1,91 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/rpc"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryBackend struct {
+	data map[string][]byte
+}
+
+func (backend *memoryBackend) Put(key string, value []byte, ttl time.Duration) error {
+	backend.data[key] = value
+	return nil
+}
+
+func (backend *memoryBackend) Get(key string) ([]byte, error) {
+	return backend.data[key], nil
+}
+
+func (backend *memoryBackend) ListKeys(prefix string, limit int) ([]string, error) {
+	keys := []string{}
+	for key := range backend.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func TestBackendRpc(t *testing.T) {
+	assert := assert.New(t)
+
+	backend := &memoryBackend{data: map[string][]byte{}}
+	client, _ := goplugin.TestPluginRPCConn(t, goplugin.PluginSet{
+		Kind: &kindPlugin{impls: map[string]any{"memory": backend}},
+	}, nil)
+	defer client.Close()
+
+	raw, err := client.Dispense(Kind)
+	assert.NoError(err)
+	proxy := &backendClient{client: raw.(*rpc.Client), name: "memory"}
+
+	assert.NoError(proxy.Put("obj/newRv/1", []byte("a"), time.Minute))
+	assert.NoError(proxy.Put("obj/newRv/2", []byte{}, time.Minute))
+	assert.NoError(proxy.Put("other/newRv/3", []byte("c"), time.Minute))
+
+	value, err := proxy.Get("obj/newRv/1")
+	assert.NoError(err)
+	assert.Equal([]byte("a"), value)
+
+	value, err = proxy.Get("obj/newRv/2")
+	assert.NoError(err)
+	assert.Equal([]byte{}, value)
+
+	value, err = proxy.Get("obj/newRv/4")
+	assert.NoError(err)
+	assert.Nil(value)
+
+	keys, err := proxy.ListKeys("obj/", 10)
+	assert.NoError(err)
+	assert.Equal([]string{"obj/newRv/2", "obj/newRv/1"}, keys)
+
+	unknown := &backendClient{client: raw.(*rpc.Client), name: "unknown"}
+	_, err = unknown.Get("obj/newRv/1")
+	assert.ErrorContains(err, `unknown implementation "unknown"`)
+}
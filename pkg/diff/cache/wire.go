@@ -0,0 +1,204 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffcache
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	diffcmp "github.com/kubewharf/kelemetry/pkg/diff/cmp"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
+)
+
+const (
+	patchVersion    byte = 1
+	snapshotVersion byte = 1
+)
+
+const (
+	patchFieldInformerTime       protowire.Number = 1
+	patchFieldOldResourceVersion protowire.Number = 2
+	patchFieldNewResourceVersion protowire.Number = 3
+	patchFieldRedacted           protowire.Number = 4
+	patchFieldDiffs              protowire.Number = 5
+
+	diffFieldJsonPath protowire.Number = 1
+	diffFieldOld      protowire.Number = 2
+	diffFieldNew      protowire.Number = 3
+
+	snapshotFieldResourceVersion protowire.Number = 1
+	snapshotFieldRedacted        protowire.Number = 2
+	snapshotFieldValue           protowire.Number = 3
+)
+
+// EncodePatch serializes a patch in the given encoding, following the schema in cache.proto.
+func EncodePatch(patch *Patch, encoding utilwire.Encoding) ([]byte, error) {
+	if encoding != utilwire.EncodingProtobuf {
+		return json.Marshal(patch)
+	}
+
+	buf := []byte{}
+	buf = utilwire.AppendTime(buf, patchFieldInformerTime, patch.InformerTime)
+	buf = utilwire.AppendString(buf, patchFieldOldResourceVersion, patch.OldResourceVersion)
+	buf = utilwire.AppendString(buf, patchFieldNewResourceVersion, patch.NewResourceVersion)
+	buf = utilwire.AppendBool(buf, patchFieldRedacted, patch.Redacted)
+
+	for _, diff := range patch.DiffList.Diffs {
+		diffBuf, err := encodeDiff(diff)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode diff of %q: %w", diff.JsonPath, err)
+		}
+
+		buf = protowire.AppendTag(buf, patchFieldDiffs, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, diffBuf)
+	}
+
+	return utilwire.Frame(patchVersion, buf), nil
+}
+
+func encodeDiff(diff diffcmp.Diff) ([]byte, error) {
+	buf := utilwire.AppendString(nil, diffFieldJsonPath, diff.JsonPath)
+
+	for _, value := range []struct {
+		number protowire.Number
+		value  any
+	}{{diffFieldOld, diff.Old}, {diffFieldNew, diff.New}} {
+		if value.value == nil {
+			continue
+		}
+
+		valueJson, err := json.Marshal(value.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = utilwire.AppendBytes(buf, value.number, valueJson)
+	}
+
+	return buf, nil
+}
+
+// DecodePatch deserializes a patch encoded by EncodePatch in any encoding.
+func DecodePatch(payload []byte, patch *Patch) error {
+	fields, isFramed, err := unframe(payload, patchVersion, "patch")
+	if err != nil {
+		return err
+	}
+
+	if !isFramed {
+		return json.Unmarshal(payload, patch)
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case patchFieldInformerTime:
+			patch.InformerTime = field.Time()
+		case patchFieldOldResourceVersion:
+			patch.OldResourceVersion = string(field.Bytes)
+		case patchFieldNewResourceVersion:
+			patch.NewResourceVersion = string(field.Bytes)
+		case patchFieldRedacted:
+			patch.Redacted = field.Varint != 0
+		case patchFieldDiffs:
+			diff, err := decodeDiff(field.Bytes)
+			if err != nil {
+				return err
+			}
+			patch.DiffList.Diffs = append(patch.DiffList.Diffs, diff)
+		}
+	}
+
+	return nil
+}
+
+func decodeDiff(body []byte) (diffcmp.Diff, error) {
+	diff := diffcmp.Diff{}
+
+	fields, err := utilwire.Fields(body)
+	if err != nil {
+		return diff, fmt.Errorf("invalid diff: %w", err)
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case diffFieldJsonPath:
+			diff.JsonPath = string(field.Bytes)
+		case diffFieldOld:
+			if err := json.Unmarshal(field.Bytes, &diff.Old); err != nil {
+				return diff, fmt.Errorf("invalid old value of %q: %w", diff.JsonPath, err)
+			}
+		case diffFieldNew:
+			if err := json.Unmarshal(field.Bytes, &diff.New); err != nil {
+				return diff, fmt.Errorf("invalid new value of %q: %w", diff.JsonPath, err)
+			}
+		}
+	}
+
+	return diff, nil
+}
+
+// EncodeSnapshot serializes a snapshot in the given encoding, following the schema in cache.proto.
+func EncodeSnapshot(snapshot *Snapshot, encoding utilwire.Encoding) ([]byte, error) {
+	if encoding != utilwire.EncodingProtobuf {
+		return json.Marshal(snapshot)
+	}
+
+	buf := []byte{}
+	buf = utilwire.AppendString(buf, snapshotFieldResourceVersion, snapshot.ResourceVersion)
+	buf = utilwire.AppendBool(buf, snapshotFieldRedacted, snapshot.Redacted)
+	buf = utilwire.AppendBytes(buf, snapshotFieldValue, snapshot.Value)
+
+	return utilwire.Frame(snapshotVersion, buf), nil
+}
+
+// DecodeSnapshot deserializes a snapshot encoded by EncodeSnapshot in any encoding.
+func DecodeSnapshot(payload []byte, snapshot *Snapshot) error {
+	fields, isFramed, err := unframe(payload, snapshotVersion, "snapshot")
+	if err != nil {
+		return err
+	}
+
+	if !isFramed {
+		return json.Unmarshal(payload, snapshot)
+	}
+
+	for _, field := range fields {
+		switch field.Number {
+		case snapshotFieldResourceVersion:
+			snapshot.ResourceVersion = string(field.Bytes)
+		case snapshotFieldRedacted:
+			snapshot.Redacted = field.Varint != 0
+		case snapshotFieldValue:
+			snapshot.Value = json.RawMessage(field.Bytes)
+		}
+	}
+
+	return nil
+}
+
+func unframe(payload []byte, expectVersion byte, kind string) (_ []utilwire.Field, isFramed bool, _ error) {
+	isFramed, version, body, err := utilwire.Unframe(payload)
+	if err != nil || !isFramed {
+		return nil, isFramed, err
+	}
+
+	if version != expectVersion {
+		return nil, true, fmt.Errorf("unsupported %s version %d", kind, version)
+	}
+
+	fields, err := utilwire.Fields(body)
+	return fields, true, err
+}
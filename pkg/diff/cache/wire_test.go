@@ -0,0 +1,76 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffcache_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	diffcmp "github.com/kubewharf/kelemetry/pkg/diff/cmp"
+	utilwire "github.com/kubewharf/kelemetry/pkg/util/wire"
+)
+
+func TestPatchRoundTrip(t *testing.T) {
+	patch := &diffcache.Patch{
+		InformerTime:       time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC),
+		OldResourceVersion: "1",
+		NewResourceVersion: "2",
+		Redacted:           true,
+		DiffList: diffcmp.DiffList{Diffs: []diffcmp.Diff{
+			{JsonPath: "spec.replicas", Old: float64(1), New: float64(2)},
+			{JsonPath: "metadata.labels.foo", New: "bar"},
+			{JsonPath: "spec.template", Old: map[string]any{"a": []any{"b"}}},
+		}},
+	}
+
+	for _, encoding := range []utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf} {
+		t.Run(string(encoding), func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf, err := diffcache.EncodePatch(patch, encoding)
+			assert.NoError(err)
+
+			decoded := &diffcache.Patch{}
+			assert.NoError(diffcache.DecodePatch(buf, decoded))
+			assert.True(patch.InformerTime.Equal(decoded.InformerTime))
+			decoded.InformerTime = patch.InformerTime
+			assert.Equal(patch, decoded)
+		})
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	snapshot := &diffcache.Snapshot{
+		ResourceVersion: "3",
+		Value:           json.RawMessage(`{"kind":"Pod"}`),
+	}
+
+	for _, encoding := range []utilwire.Encoding{utilwire.EncodingJson, utilwire.EncodingProtobuf} {
+		t.Run(string(encoding), func(t *testing.T) {
+			assert := assert.New(t)
+
+			buf, err := diffcache.EncodeSnapshot(snapshot, encoding)
+			assert.NoError(err)
+
+			decoded := &diffcache.Snapshot{}
+			assert.NoError(diffcache.DecodeSnapshot(buf, decoded))
+			assert.Equal(snapshot, decoded)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffcmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Apply applies the diffs to the old object and returns the new object.
+// The old object is modified in place.
+//
+// Since a nil New value cannot be distinguished from a removed field,
+// fields and list items set to null are removed.
+func (list DiffList) Apply(obj any) (any, error) {
+	return list.apply(obj, func(diff Diff) any { return diff.New })
+}
+
+// Revert applies the diffs in reverse to the new object and returns the old object.
+// The new object is modified in place.
+func (list DiffList) Revert(obj any) (any, error) {
+	return list.apply(obj, func(diff Diff) any { return diff.Old })
+}
+
+// removed marks list items to be removed after all diffs are applied,
+// since removed list items are reported by ascending offset.
+type removed struct{}
+
+func (list DiffList) apply(obj any, valueOf func(Diff) any) (any, error) {
+	for _, diff := range list.Diffs {
+		path, err := parseJsonPath(diff.JsonPath)
+		if err != nil {
+			return nil, err
+		}
+
+		obj, err = applyValue(obj, path, valueOf(diff))
+		if err != nil {
+			return nil, fmt.Errorf("cannot apply diff at %q: %w", diff.JsonPath, err)
+		}
+	}
+
+	return trimRemoved(obj), nil
+}
+
+func applyValue(obj any, path []jsonPathPart, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	part := path[0]
+	if part.isListOffset {
+		slice, isSlice := obj.([]any)
+		if obj != nil && !isSlice {
+			return nil, fmt.Errorf("expected list, got %T", obj)
+		}
+
+		for len(slice) <= part.listOffset {
+			slice = append(slice, nil)
+		}
+
+		if len(path) == 1 && value == nil {
+			slice[part.listOffset] = removed{}
+			return slice, nil
+		}
+
+		item, err := applyValue(slice[part.listOffset], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		slice[part.listOffset] = item
+		return slice, nil
+	}
+
+	m, isMap := obj.(map[string]any)
+	if obj != nil && !isMap {
+		return nil, fmt.Errorf("expected object, got %T", obj)
+	}
+	if m == nil {
+		m = map[string]any{}
+	}
+
+	if len(path) == 1 && value == nil {
+		delete(m, part.objectField)
+		return m, nil
+	}
+
+	field, err := applyValue(m[part.objectField], path[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	m[part.objectField] = field
+	return m, nil
+}
+
+func trimRemoved(obj any) any {
+	switch obj := obj.(type) {
+	case map[string]any:
+		for key, value := range obj {
+			obj[key] = trimRemoved(value)
+		}
+		return obj
+	case []any:
+		output := obj[:0]
+		for _, item := range obj {
+			if _, isRemoved := item.(removed); !isRemoved {
+				output = append(output, trimRemoved(item))
+			}
+		}
+		return output
+	case removed:
+		return nil
+	default:
+		return obj
+	}
+}
+
+// parseJsonPath parses the output of formatJsonPath.
+func parseJsonPath(jsonPath string) ([]jsonPathPart, error) {
+	path := []jsonPathPart{}
+
+	for rest := jsonPath; len(rest) > 0; {
+		switch {
+		case strings.HasPrefix(rest, `["`):
+			rest = rest[2:]
+
+			field := new(strings.Builder)
+			for {
+				if len(rest) == 0 {
+					return nil, fmt.Errorf("unterminated field name in JSON path %q", jsonPath)
+				}
+				if strings.HasPrefix(rest, `\"`) {
+					field.WriteByte('"')
+					rest = rest[2:]
+					continue
+				}
+				if strings.HasPrefix(rest, `"]`) {
+					rest = rest[2:]
+					break
+				}
+				field.WriteByte(rest[0])
+				rest = rest[1:]
+			}
+
+			path = append(path, jsonPathPart{objectField: field.String()})
+
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated list offset in JSON path %q", jsonPath)
+			}
+
+			offset, err := strconv.Atoi(rest[1:end])
+			if err != nil || offset < 0 {
+				return nil, fmt.Errorf("invalid list offset in JSON path %q", jsonPath)
+			}
+
+			path = append(path, jsonPathPart{isListOffset: true, listOffset: offset})
+			rest = rest[end+1:]
+
+		default:
+			if len(path) > 0 {
+				if rest[0] != '.' {
+					return nil, fmt.Errorf("unexpected character %q in JSON path %q", rest[0], jsonPath)
+				}
+				rest = rest[1:]
+			}
+
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+
+			path = append(path, jsonPathPart{objectField: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+
+	return path, nil
+}
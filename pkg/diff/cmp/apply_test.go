@@ -0,0 +1,82 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffcmp_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	diffcmp "github.com/kubewharf/kelemetry/pkg/diff/cmp"
+)
+
+func decodeJson(t *testing.T, value string) any {
+	var obj any
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestApplyRevert(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+	}{
+		{name: "primitive", old: `"a"`, new: `"b"`},
+		{name: "field change", old: `{"spec": {"replicas": 1}}`, new: `{"spec": {"replicas": 2}}`},
+		{name: "field add remove", old: `{"a": 1, "b": {"c": 2}}`, new: `{"a": 1, "d": [1, 2]}`},
+		{name: "special field names", old: `{"metadata": {"labels": {"app.kubernetes.io/name": "a"}}}`, new: `{"metadata": {"labels": {
+			"app.kubernetes.io/name": "b", "quoted\"key": "c"
+		}}}`},
+		{name: "list grow", old: `{"items": [{"name": "a"}]}`, new: `{"items": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}`},
+		{name: "list shrink", old: `{"items": [{"name": "a", "x": [1]}, {"name": "b"}, 3]}`, new: `{"items": [{"name": "b", "x": [1, 2]}]}`},
+		{name: "type change", old: `{"a": {"b": 1}}`, new: `{"a": [1]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			diffs := diffcmp.Compare(decodeJson(t, tc.old), decodeJson(t, tc.new))
+
+			// round trip through JSON like the diff cache
+			diffsJson, err := json.Marshal(diffs)
+			assert.NoError(err)
+			decodedDiffs := diffcmp.DiffList{}
+			assert.NoError(json.Unmarshal(diffsJson, &decodedDiffs))
+
+			applied, err := decodedDiffs.Apply(decodeJson(t, tc.old))
+			assert.NoError(err)
+			assert.Equal(decodeJson(t, tc.new), applied)
+
+			reverted, err := decodedDiffs.Revert(decodeJson(t, tc.new))
+			assert.NoError(err)
+			assert.Equal(decodeJson(t, tc.old), reverted)
+		})
+	}
+}
+
+func TestApplyInvalidPath(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := diffcmp.DiffList{Diffs: []diffcmp.Diff{{JsonPath: `a[x]`, New: 1}}}.Apply(map[string]any{})
+	assert.Error(err)
+
+	_, err = diffcmp.DiffList{Diffs: []diffcmp.Diff{{JsonPath: `a["b`, New: 1}}}.Apply(map[string]any{})
+	assert.Error(err)
+
+	_, err = diffcmp.DiffList{Diffs: []diffcmp.Diff{{JsonPath: `a.b`, New: 1}}}.Apply(map[string]any{"a": "c"})
+	assert.Error(err)
+}
@@ -29,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	toolscache "k8s.io/client-go/tools/cache"
@@ -37,11 +38,13 @@ import (
 
 	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
 	diffcmp "github.com/kubewharf/kelemetry/pkg/diff/cmp"
+	"github.com/kubewharf/kelemetry/pkg/diff/finalizer"
 	"github.com/kubewharf/kelemetry/pkg/filter"
 	"github.com/kubewharf/kelemetry/pkg/k8s"
 	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
 	"github.com/kubewharf/kelemetry/pkg/k8s/multileader"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/memory"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	"github.com/kubewharf/kelemetry/pkg/util/channel"
 	informerutil "github.com/kubewharf/kelemetry/pkg/util/informer"
@@ -72,6 +75,9 @@ type ctrlOptions struct {
 
 	storeTimeout time.Duration
 	workerCount  int
+	watchList    bool
+
+	lowPriorityResources []string
 
 	watchElectorOptions multileader.Config
 	writeElectorOptions multileader.Config
@@ -88,6 +94,19 @@ func (options *ctrlOptions) Setup(fs *pflag.FlagSet) {
 	fs.BoolVar(&options.deletionSnapshot, "diff-controller-deletion-snapshot", true, "take a snapshot of objects during deletion")
 	fs.DurationVar(&options.storeTimeout, "diff-controller-store-timeout", time.Second*10, "timeout for storing cache")
 	fs.IntVar(&options.workerCount, "diff-controller-worker-count", 8, "number of workers for all object types to compute diff")
+	fs.BoolVar(
+		&options.watchList,
+		"diff-controller-watch-list",
+		false,
+		"stream the initial state of each resource from the apiserver watch cache instead of listing it; "+
+			"falls back to listing if the WatchList feature is not enabled on the apiserver",
+	)
+	fs.StringSliceVar(
+		&options.lowPriorityResources,
+		"diff-controller-low-priority-resources",
+		[]string{},
+		"resources in the form resource.group (e.g. replicasets.apps) whose informers are stopped under hard memory pressure",
+	)
 	options.watchElectorOptions.SetupOptions(fs, "diff-controller", "diff controller", 2)
 	options.writeElectorOptions.SetupOptions(fs, "diff-writer", "diff controller cache writer", 1)
 }
@@ -103,12 +122,16 @@ type controller struct {
 	Cache     diffcache.Cache
 	Filter    filter.Filter
 	Metrics   metrics.Client
+	Finalizer *finalizer.Tracker
+	Memory    *memory.Watchdog
 
 	redactRegex       *regexp.Regexp
+	lowPriority       sets.Set[schema.GroupResource]
 	discoveryResyncCh <-chan struct{}
 	OnCreateMetric    *metrics.Metric[*onCreateMetric]
 	OnUpdateMetric    *metrics.Metric[*onUpdateMetric]
 	OnDeleteMetric    *metrics.Metric[*onDeleteMetric]
+	ListMetric        *metrics.Metric[*listMetric]
 	watchElector      *multileader.Elector
 	monitors          map[schema.GroupVersionResource]*monitor
 	monitorsLock      sync.RWMutex
@@ -146,6 +169,14 @@ type onDeleteMetric struct {
 
 func (*onDeleteMetric) MetricName() string { return "diff_controller_on_delete" }
 
+type listMetric struct {
+	ApiGroup schema.GroupVersion
+	Resource string
+	Kind     informerutil.ListKind
+}
+
+func (*listMetric) MetricName() string { return "diff_controller_list" }
+
 type taskPoolMetric struct{}
 
 func (*taskPoolMetric) MetricName() string { return "diff_controller_task_pool" }
@@ -160,6 +191,11 @@ func (ctrl *controller) Init() (err error) {
 		return fmt.Errorf("cannot compile --diff-controller-redact-pattern value: %w", err)
 	}
 
+	ctrl.lowPriority = sets.New[schema.GroupResource]()
+	for _, resource := range ctrl.options.lowPriorityResources {
+		ctrl.lowPriority.Insert(schema.ParseGroupResource(resource))
+	}
+
 	cdc, err := ctrl.Discovery.ForCluster(ctrl.Clients.TargetCluster().ClusterName())
 	if err != nil {
 		return fmt.Errorf("cannot initialize discovery cache for target cluster: %w", err)
@@ -312,6 +348,8 @@ func (ctrl *controller) resyncMonitorsLoop(ctx context.Context) {
 		case <-ctx.Done():
 			stopped = true
 		case <-ctrl.discoveryResyncCh:
+		case <-ctrl.Memory.Changed():
+			// low-priority monitors are stopped or restarted
 		}
 
 		if stopped {
@@ -353,6 +391,10 @@ func (ctrl *controller) shouldMonitorType(gvr schema.GroupVersionResource, apiRe
 		return false
 	}
 
+	if ctrl.Memory.Level() >= memory.LevelHard && ctrl.lowPriority.Has(gvr.GroupResource()) {
+		return false
+	}
+
 	return true
 }
 
@@ -402,7 +444,7 @@ func (ctrl *controller) compareMonitors(expected discovery.GvrDetails) (toStart,
 		}
 	}
 	for gvr := range ctrl.monitors {
-		if _, exists := expected[gvr]; !exists {
+		if apiResource, exists := expected[gvr]; !exists || !ctrl.shouldMonitorType(gvr, apiResource) {
 			toStop = append(toStop, gvr)
 		}
 	}
@@ -488,10 +530,10 @@ func (ctrl *controller) startMonitor(ctx context.Context, gvr schema.GroupVersio
 		ctrl.taskPool.Send(func() writerTask { return monitor.onUpdate(ctx, oldObj, newObj) })
 	}
 	store.OnDelete = func(oldObj *unstructured.Unstructured) {
-		ctrl.taskPool.Send(func() writerTask { return monitor.onNeedSnapshot(ctx, oldObj, diffcache.SnapshotNameDeletion) })
+		ctrl.taskPool.Send(func() writerTask { return monitor.onDelete(ctx, oldObj) })
 	}
 
-	nsableReflectorClient := ctrl.Clients.TargetCluster().DynamicClient().Resource(gvr)
+	nsableReflectorClient := ctrl.Clients.TargetCluster().DynamicClientFor(k8s.PurposeInformer).Resource(gvr)
 	var reflectorClient dynamic.ResourceInterface
 	if apiResource.Namespaced {
 		reflectorClient = nsableReflectorClient.Namespace(metav1.NamespaceAll)
@@ -512,7 +554,7 @@ func (ctrl *controller) startMonitor(ctx context.Context, gvr schema.GroupVersio
 		},
 	}
 
-	reflector := toolscache.NewReflector(
+	reflector := informerutil.NewReflector(
 		lw,
 		&unstructured.Unstructured{
 			Object: map[string]any{
@@ -521,7 +563,15 @@ func (ctrl *controller) startMonitor(ctx context.Context, gvr schema.GroupVersio
 			},
 		},
 		store,
-		0,
+		informerutil.ReflectorOptions{
+			WatchList: ctrl.options.watchList,
+			OnList: func(kind informerutil.ListKind) {
+				if kind == informerutil.ListKindFull && hasSynced.Load() {
+					logger.Info("relisting from scratch")
+				}
+				ctrl.ListMetric.With(&listMetric{ApiGroup: gvr.GroupVersion(), Resource: gvr.Resource, Kind: kind}).Count(1)
+			},
+		},
 	)
 
 	go func() {
@@ -585,6 +635,10 @@ func (monitor *monitor) onUpdate(
 	objectRef := utilobject.RichFromUnstructured(newObj, monitor.ctrl.Clients.TargetCluster().ClusterName(), monitor.gvr).Clone()
 
 	return func(ctx context.Context) {
+		if monitor.ctrl.Finalizer.Enabled() {
+			monitor.ctrl.Finalizer.OnUpdate(ctx, objectRef, oldObj, newObj, patch.InformerTime)
+		}
+
 		ctx, cancelFunc := context.WithTimeout(ctx, monitor.ctrl.options.storeTimeout)
 		defer cancelFunc()
 
@@ -596,6 +650,25 @@ func (monitor *monitor) onUpdate(
 	}
 }
 
+func (monitor *monitor) onDelete(
+	ctx context.Context,
+	oldObj *unstructured.Unstructured,
+) writerTask {
+	snapshotTask := monitor.onNeedSnapshot(ctx, oldObj, diffcache.SnapshotNameDeletion)
+
+	if !monitor.ctrl.Finalizer.Enabled() {
+		return snapshotTask
+	}
+
+	objectRef := utilobject.RichFromUnstructured(oldObj, monitor.ctrl.Clients.TargetCluster().ClusterName(), monitor.gvr).Clone()
+	informerTime := monitor.ctrl.Clock.Now()
+
+	return func(ctx context.Context) {
+		monitor.ctrl.Finalizer.OnDelete(ctx, objectRef, oldObj, informerTime)
+		snapshotTask(ctx)
+	}
+}
+
 func (monitor *monitor) onNeedSnapshot(
 	ctx context.Context,
 	obj *unstructured.Unstructured,
@@ -30,7 +30,9 @@ import (
 
 	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
 	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/audit/actor"
 	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	"github.com/kubewharf/kelemetry/pkg/diff/fight"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
@@ -82,6 +84,7 @@ type decorator struct {
 	Logger  logrus.FieldLogger
 	Clock   clock.Clock
 	Cache   diffcache.Cache
+	Fight   *fight.Detector
 
 	DiffMetric            *metrics.Metric[*diffMetric]
 	InformerLatencyMetric *metrics.Metric[*informerLatencyMetric]
@@ -343,6 +346,16 @@ func (decorator *decorator) tryUpdateOnce(
 	}
 	event.Log(zconstants.LogTypeObjectDiff, diffInfo)
 
+	if decorator.Fight.Enabled() {
+		paths := make([]string, 0, len(patch.DiffList.Diffs))
+		for _, diff := range patch.DiffList.Diffs {
+			paths = append(paths, diff.JsonPath)
+		}
+
+		acting := actor.Infer(nil, actor.Identity{Username: message.User.Username, UserAgent: message.UserAgent})
+		decorator.Fight.Observe(ctx, object, acting.Name, paths, message.StageTimestamp.Time)
+	}
+
 	informerLatency := patch.InformerTime.Sub(message.StageTimestamp.Time)
 	decorator.InformerLatencyMetric.With(&informerLatencyMetric{
 		Cluster: message.Cluster,
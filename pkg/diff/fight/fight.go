@@ -0,0 +1,321 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Detects controller fights, where different actors repeatedly flip the same field of an object.
+//
+// Field changes are fed by the diff decorator.
+// When the changes to a field within the window alternate between actors at least the configured number of times,
+// a warning event is sent to the object trace.
+package fight
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("controller-fight", manager.Ptr(&Detector{
+		fields: map[fieldKey]*fieldHistory{},
+	}))
+}
+
+// maxChanges is the maximum number of changes retained for each field.
+const maxChanges = 64
+
+type options struct {
+	enable       bool
+	window       time.Duration
+	minFlips     int
+	maxFields    int
+	ignoreFields []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"controller-fight-enable",
+		false,
+		"detect different actors repeatedly changing the same field and send warning events to the object trace; "+
+			"requires the diff decorator",
+	)
+	fs.DurationVar(&options.window, "controller-fight-window", time.Minute, "sliding window over which field changes are counted")
+	fs.IntVar(
+		&options.minFlips,
+		"controller-fight-min-flips",
+		4,
+		"minimum number of changes to a field by an actor different from the previous change within the window",
+	)
+	fs.IntVar(&options.maxFields, "controller-fight-max-fields", 100000, "maximum number of object fields tracked simultaneously")
+	fs.StringSliceVar(
+		&options.ignoreFields,
+		"controller-fight-ignore-fields",
+		[]string{"metadata.resourceVersion", "metadata.generation", "metadata.managedFields", "status.observedGeneration"},
+		"JSON path prefixes of fields not tracked for fights",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Detector struct {
+	options    options
+	Logger     logrus.FieldLogger
+	Clock      clock.Clock
+	Aggregator aggregator.Aggregator
+
+	FightMetric   *metrics.Metric[*fightMetric]
+	DroppedMetric *metrics.Metric[*droppedMetric]
+
+	fieldsMu sync.Mutex
+	fields   map[fieldKey]*fieldHistory
+}
+
+type fightMetric struct {
+	Cluster  string
+	Group    string
+	Resource string
+	Actors   string
+	Error    metrics.LabeledError
+}
+
+func (*fightMetric) MetricName() string { return "controller_fight" }
+
+type droppedMetric struct{}
+
+func (*droppedMetric) MetricName() string { return "controller_fight_dropped_fields" }
+
+type fieldKey struct {
+	object utilobject.Key
+	path   string
+}
+
+type change struct {
+	time  time.Time
+	actor string
+}
+
+type fieldHistory struct {
+	changes      []change
+	lastReported time.Time
+}
+
+var _ manager.Component = &Detector{}
+
+func (detector *Detector) Options() manager.Options { return &detector.options }
+
+func (detector *Detector) Init() error {
+	if !detector.options.enable {
+		return nil
+	}
+
+	if detector.options.window <= 0 {
+		return fmt.Errorf("--controller-fight-window must be positive")
+	}
+
+	if detector.options.minFlips < 1 {
+		return fmt.Errorf("--controller-fight-min-flips must be positive")
+	}
+
+	return nil
+}
+
+func (detector *Detector) Start(ctx context.Context) error {
+	if !detector.options.enable {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(detector.Logger)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-detector.Clock.After(detector.options.window):
+				detector.prune(detector.Clock.Now())
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (detector *Detector) Close(ctx context.Context) error { return nil }
+
+// Enabled returns true if fight detection is enabled.
+func (detector *Detector) Enabled() bool { return detector.options.enable }
+
+// Fight is a detected controller fight on a field.
+type Fight struct {
+	Path   string
+	Actors []string
+	Flips  int
+}
+
+// Observe records that actor changed the fields at the JSON paths of an object at the given time,
+// and sends a warning event for each field that is found to be fought over.
+func (detector *Detector) Observe(ctx context.Context, object utilobject.Rich, actor string, paths []string, when time.Time) {
+	if !detector.options.enable {
+		return
+	}
+
+	fights := detector.record(object.Key, actor, paths, when)
+
+	for _, fight := range fights {
+		detector.report(ctx, object, fight, when)
+	}
+}
+
+func (detector *Detector) record(object utilobject.Key, actor string, paths []string, when time.Time) []Fight {
+	detector.fieldsMu.Lock()
+	defer detector.fieldsMu.Unlock()
+
+	var fights []Fight
+
+	for _, path := range paths {
+		if detector.isIgnored(path) {
+			continue
+		}
+
+		key := fieldKey{object: object, path: path}
+		history, exists := detector.fields[key]
+		if !exists {
+			if len(detector.fields) >= detector.options.maxFields {
+				detector.DroppedMetric.With(&droppedMetric{}).Count(1)
+				continue
+			}
+
+			history = &fieldHistory{}
+			detector.fields[key] = history
+		}
+
+		history.trim(when.Add(-detector.options.window))
+		history.changes = append(history.changes, change{time: when, actor: actor})
+		if len(history.changes) > maxChanges {
+			history.changes = history.changes[len(history.changes)-maxChanges:]
+		}
+
+		flips, actors := history.flips()
+		if len(actors) < 2 || flips < detector.options.minFlips {
+			continue
+		}
+
+		if !history.lastReported.IsZero() && when.Sub(history.lastReported) < detector.options.window {
+			// report each fight at most once per window
+			continue
+		}
+		history.lastReported = when
+
+		fights = append(fights, Fight{Path: path, Actors: actors, Flips: flips})
+	}
+
+	return fights
+}
+
+func (detector *Detector) isIgnored(path string) bool {
+	for _, prefix := range detector.options.ignoreFields {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trim removes changes before cutoff.
+func (history *fieldHistory) trim(cutoff time.Time) {
+	i := 0
+	for i < len(history.changes) && history.changes[i].time.Before(cutoff) {
+		i++
+	}
+	history.changes = history.changes[i:]
+}
+
+// flips returns the number of changes made by an actor different from the previous change,
+// and the sorted list of distinct actors.
+func (history *fieldHistory) flips() (int, []string) {
+	flips := 0
+	actorSet := map[string]struct{}{}
+
+	for i, change := range history.changes {
+		actorSet[change.actor] = struct{}{}
+		if i > 0 && history.changes[i-1].actor != change.actor {
+			flips++
+		}
+	}
+
+	actors := make([]string, 0, len(actorSet))
+	for actor := range actorSet {
+		actors = append(actors, actor)
+	}
+	sort.Strings(actors)
+
+	return flips, actors
+}
+
+func (detector *Detector) prune(now time.Time) {
+	detector.fieldsMu.Lock()
+	defer detector.fieldsMu.Unlock()
+
+	cutoff := now.Add(-detector.options.window)
+	for key, history := range detector.fields {
+		history.trim(cutoff)
+		if len(history.changes) == 0 && (history.lastReported.IsZero() || history.lastReported.Before(cutoff)) {
+			delete(detector.fields, key)
+		}
+	}
+}
+
+func (detector *Detector) report(ctx context.Context, object utilobject.Rich, fight Fight, when time.Time) {
+	metric := &fightMetric{
+		Cluster:  object.Cluster,
+		Group:    object.Group,
+		Resource: object.Resource,
+		Actors:   strings.Join(fight.Actors, ","),
+	}
+
+	message := fmt.Sprintf(
+		"%s was changed back and forth %d times within %s by %s",
+		fight.Path, fight.Flips, detector.options.window, strings.Join(fight.Actors, ", "),
+	)
+
+	event := aggregatorevent.NewEvent(fmt.Sprintf("Controller fight on %s", fight.Path), when, zconstants.TraceSourceAnalysis).
+		SetTag("field", fight.Path).
+		SetTag("actors", strings.Join(fight.Actors, ",")).
+		SetTag("flips", fight.Flips).
+		SetTag("tag", "controllerFight").
+		Log(zconstants.LogTypeRealError, message)
+
+	if err := detector.Aggregator.Send(ctx, object, event); err != nil {
+		metric.Error = metrics.LabelError(err, "Send")
+		detector.Logger.WithFields(object.AsFields("object")).WithError(err).Error("cannot send controller fight event")
+	}
+
+	detector.FightMetric.With(metric).Count(1)
+}
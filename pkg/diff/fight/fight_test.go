@@ -0,0 +1,81 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fight
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func newTestDetector() *Detector {
+	metricsClient, _ := metrics.NewMock(clocktesting.NewFakeClock(time.Time{}))
+	return &Detector{
+		options: options{
+			enable:       true,
+			window:       time.Minute,
+			minFlips:     3,
+			maxFields:    2,
+			ignoreFields: []string{"metadata.resourceVersion"},
+		},
+		DroppedMetric: metrics.New[*droppedMetric](metricsClient),
+		fields:        map[fieldKey]*fieldHistory{},
+	}
+}
+
+func TestRecord(t *testing.T) {
+	detector := newTestDetector()
+	object := utilobject.Key{Cluster: "c", Group: "apps", Resource: "deployments", Namespace: "default", Name: "app"}
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	paths := []string{"spec.replicas", "metadata.resourceVersion"}
+	assert.Empty(t, detector.record(object, "hpa", paths, base))
+	assert.Empty(t, detector.record(object, "argocd", paths, base.Add(time.Second)))
+	assert.Empty(t, detector.record(object, "hpa", paths, base.Add(time.Second*2)))
+
+	fights := detector.record(object, "argocd", paths, base.Add(time.Second*3))
+	assert.Equal(t, []Fight{{Path: "spec.replicas", Actors: []string{"argocd", "hpa"}, Flips: 3}}, fights)
+
+	// reported at most once per window
+	assert.Empty(t, detector.record(object, "hpa", paths, base.Add(time.Second*4)))
+
+	// changes by the same actor are not flips
+	other := object
+	other.Name = "other"
+	for i := 0; i < 5; i++ {
+		assert.Empty(t, detector.record(other, "hpa", paths, base.Add(time.Duration(i)*time.Second)))
+	}
+
+	// old changes leave the window
+	detector.prune(base.Add(time.Hour))
+	assert.Empty(t, detector.fields)
+}
+
+func TestRecordWindow(t *testing.T) {
+	detector := newTestDetector()
+	object := utilobject.Key{Cluster: "c", Resource: "configmaps", Namespace: "default", Name: "cm"}
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	actors := []string{"a", "b", "a", "b"}
+	for i, actor := range actors {
+		// changes are 30s apart, so at most 2 changes are within the window
+		assert.Empty(t, detector.record(object, actor, []string{`data["key"]`}, base.Add(time.Duration(i)*time.Second*30)))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Traces the deletion flow of objects with finalizers.
+//
+// When an object enters deletion, an event is sent to the object trace with the pending finalizers.
+// Each finalizer is traced as a span from the deletion timestamp until the finalizer is removed,
+// so that the finalizer blocking the deletion of an object can be identified directly from the trace.
+// Object updates are fed by the diff controller.
+package finalizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("finalizer-tracker", manager.Ptr(&Tracker{}))
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"finalizer-tracker-enable",
+		false,
+		"trace the interval between the deletion timestamp and the removal of each finalizer of deleting objects; "+
+			"requires the diff controller",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Tracker struct {
+	options    options
+	Logger     logrus.FieldLogger
+	Clock      clock.Clock
+	Aggregator aggregator.Aggregator
+
+	RemovalMetric *metrics.Metric[*removalMetric]
+}
+
+type removalMetric struct {
+	Cluster   string
+	Group     string
+	Resource  string
+	Finalizer string
+	Error     metrics.LabeledError
+}
+
+func (*removalMetric) MetricName() string { return "finalizer_removal" }
+
+var _ manager.Component = &Tracker{}
+
+func (tracker *Tracker) Options() manager.Options { return &tracker.options }
+
+func (tracker *Tracker) Init() error                     { return nil }
+func (tracker *Tracker) Start(ctx context.Context) error { return nil }
+func (tracker *Tracker) Close(ctx context.Context) error { return nil }
+
+// Enabled returns true if finalizer tracking is enabled.
+func (tracker *Tracker) Enabled() bool { return tracker.options.enable }
+
+// Removed returns the finalizers in old that are absent in new, in the order of old.
+func Removed(old, new []string) []string {
+	remaining := make(map[string]struct{}, len(new))
+	for _, finalizer := range new {
+		remaining[finalizer] = struct{}{}
+	}
+
+	var removed []string
+	for _, finalizer := range old {
+		if _, exists := remaining[finalizer]; !exists {
+			removed = append(removed, finalizer)
+		}
+	}
+
+	return removed
+}
+
+// OnUpdate traces the deletion start and finalizer removals between two consecutive states of an object.
+func (tracker *Tracker) OnUpdate(ctx context.Context, object utilobject.Rich, oldObj, newObj metav1.Object, when time.Time) {
+	deletionTimestamp := newObj.GetDeletionTimestamp()
+	if deletionTimestamp.IsZero() {
+		return
+	}
+
+	if oldObj.GetDeletionTimestamp().IsZero() {
+		tracker.sendDeletionStart(ctx, object, deletionTimestamp.Time, newObj.GetFinalizers())
+	}
+
+	remaining := newObj.GetFinalizers()
+	for _, finalizer := range Removed(oldObj.GetFinalizers(), remaining) {
+		tracker.sendRemoval(ctx, object, finalizer, deletionTimestamp.Time, when, remaining)
+	}
+}
+
+// OnDelete traces the removal of the finalizers remaining in the last observed state of a deleted object.
+//
+// The apiserver deletes the object as soon as the last finalizer is removed,
+// so the last finalizer removal is only observed as the deletion of the object.
+func (tracker *Tracker) OnDelete(ctx context.Context, object utilobject.Rich, lastObj metav1.Object, when time.Time) {
+	deletionTimestamp := lastObj.GetDeletionTimestamp()
+	if deletionTimestamp.IsZero() {
+		return
+	}
+
+	for _, finalizer := range lastObj.GetFinalizers() {
+		tracker.sendRemoval(ctx, object, finalizer, deletionTimestamp.Time, when, nil)
+	}
+}
+
+func (tracker *Tracker) sendDeletionStart(ctx context.Context, object utilobject.Rich, deletionTimestamp time.Time, finalizers []string) {
+	event := aggregatorevent.NewEvent("Deletion started", deletionTimestamp, zconstants.TraceSourceAnalysis).
+		SetTag("pendingFinalizers", strings.Join(finalizers, ",")).
+		SetTag("tag", "deletion")
+
+	if err := tracker.Aggregator.Send(ctx, object, event); err != nil {
+		tracker.Logger.WithFields(object.AsFields("object")).WithError(err).Error("cannot send deletion start event")
+	}
+}
+
+func (tracker *Tracker) sendRemoval(
+	ctx context.Context,
+	object utilobject.Rich,
+	finalizer string,
+	deletionTimestamp time.Time,
+	when time.Time,
+	remaining []string,
+) {
+	metric := &removalMetric{
+		Cluster:   object.Cluster,
+		Group:     object.Group,
+		Resource:  object.Resource,
+		Finalizer: finalizer,
+	}
+
+	wait := when.Sub(deletionTimestamp)
+	if wait < 0 {
+		// clock skew between the apiserver and the informer
+		wait = 0
+		deletionTimestamp = when
+	}
+
+	event := aggregatorevent.NewEvent(fmt.Sprintf("Waiting for finalizer %s", finalizer), deletionTimestamp, zconstants.TraceSourceAnalysis).
+		SetEndTime(when).
+		SetTag("finalizer", finalizer).
+		SetTag("remainingFinalizers", strings.Join(remaining, ",")).
+		SetTag("tag", "finalizer").
+		Log(zconstants.LogTypeRealVerbose, fmt.Sprintf("finalizer %s was removed %s after the deletion timestamp", finalizer, wait))
+
+	if err := tracker.Aggregator.Send(ctx, object, event); err != nil {
+		metric.Error = metrics.LabelError(err, "Send")
+		tracker.Logger.WithFields(object.AsFields("object")).WithError(err).Error("cannot send finalizer removal event")
+	}
+
+	tracker.RemovalMetric.With(metric).Histogram(wait.Seconds())
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package finalizer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/diff/finalizer"
+)
+
+func TestRemoved(t *testing.T) {
+	assert.Equal(t, []string{"b", "d"}, finalizer.Removed([]string{"a", "b", "c", "d"}, []string{"c", "a"}))
+	assert.Equal(t, []string{"a"}, finalizer.Removed([]string{"a"}, nil))
+	assert.Empty(t, finalizer.Removed([]string{"a"}, []string{"a", "b"}))
+	assert.Empty(t, finalizer.Removed(nil, []string{"a"}))
+}
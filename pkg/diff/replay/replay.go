@@ -0,0 +1,217 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reconstructs objects at a past time by replaying the patches in the diff cache
+// onto the creation snapshot, or reverting them from the deletion snapshot.
+package diffreplay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+var (
+	ErrNoSnapshot = errors.New("no snapshot of the object is cached")
+	ErrRedacted   = errors.New("sensitive object content has been redacted")
+	ErrNotCreated = errors.New("the object was not created yet at the requested time")
+)
+
+type Result struct {
+	Object *unstructured.Unstructured
+	// The snapshot that the object was reconstructed from.
+	Base           string
+	AppliedPatches int
+	// Nonempty if the result may be inaccurate, e.g. because of missing patches.
+	Warnings []string
+}
+
+// Reconstruct reconstructs the object as observed by the diff controller at the given time.
+//
+// Only the latest maxPatches patches in the cache are used.
+// Since patches expire after --diff-cache-patch-ttl, the result is only accurate for recent times.
+func Reconstruct(ctx context.Context, cache diffcache.Cache, object utilobject.Key, at time.Time, maxPatches int) (*Result, error) {
+	creation, err := fetchSnapshot(ctx, cache, object, diffcache.SnapshotNameCreation)
+	if err != nil {
+		return nil, err
+	}
+	deletion, err := fetchSnapshot(ctx, cache, object, diffcache.SnapshotNameDeletion)
+	if err != nil {
+		return nil, err
+	}
+	if creation == nil && deletion == nil {
+		return nil, ErrNoSnapshot
+	}
+
+	patches, err := listPatches(ctx, cache, object, maxPatches)
+	if err != nil {
+		return nil, err
+	}
+
+	if creation != nil {
+		if creation.GetCreationTimestamp().Time.After(at) {
+			return nil, ErrNotCreated
+		}
+		return replay(creation, patches, at)
+	}
+
+	return revert(deletion, patches, at)
+}
+
+func fetchSnapshot(
+	ctx context.Context,
+	cache diffcache.Cache,
+	object utilobject.Key,
+	snapshotName string,
+) (*unstructured.Unstructured, error) {
+	snapshot, err := cache.FetchSnapshot(ctx, object, snapshotName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch %s snapshot: %w", snapshotName, err)
+	}
+	if snapshot == nil {
+		return nil, nil
+	}
+	if snapshot.Redacted {
+		return nil, ErrRedacted
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(snapshot.Value, &obj.Object); err != nil {
+		return nil, fmt.Errorf("cached %s snapshot is not a valid object: %w", snapshotName, err)
+	}
+	return obj, nil
+}
+
+func listPatches(ctx context.Context, cache diffcache.Cache, object utilobject.Key, maxPatches int) ([]*diffcache.Patch, error) {
+	keys, err := cache.List(ctx, object, maxPatches)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list patches: %w", err)
+	}
+
+	patches := []*diffcache.Patch{}
+	seen := map[string]struct{}{}
+	for _, key := range keys {
+		if key == diffcache.SnapshotNameCreation || key == diffcache.SnapshotNameDeletion {
+			continue
+		}
+
+		// the key is the resource version chosen by the cluster config, so it is passed as both resource versions
+		patch, err := cache.Fetch(ctx, object, key, &key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch patch %q: %w", key, err)
+		}
+		if patch == nil {
+			continue // expired since listing
+		}
+
+		if _, exists := seen[patch.NewResourceVersion]; exists {
+			continue
+		}
+		seen[patch.NewResourceVersion] = struct{}{}
+
+		patches = append(patches, patch)
+	}
+
+	sort.Slice(patches, func(i, j int) bool { return patches[i].InformerTime.Before(patches[j].InformerTime) })
+	return patches, nil
+}
+
+// replay applies the patches observed until the given time to the creation snapshot.
+func replay(obj *unstructured.Unstructured, patches []*diffcache.Patch, at time.Time) (*Result, error) {
+	result := &Result{Base: diffcache.SnapshotNameCreation}
+
+	for _, patch := range patches {
+		if patch.InformerTime.After(at) {
+			break
+		}
+		if patch.NewResourceVersion == obj.GetResourceVersion() {
+			continue // the snapshot already includes this patch
+		}
+
+		if err := applyPatch(obj, patch, result, false); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Object = obj
+	return result, nil
+}
+
+// revert reverts the patches observed after the given time from the deletion snapshot.
+func revert(obj *unstructured.Unstructured, patches []*diffcache.Patch, at time.Time) (*Result, error) {
+	result := &Result{Base: diffcache.SnapshotNameDeletion}
+
+	for i := len(patches) - 1; i >= 0; i-- {
+		patch := patches[i]
+		if !patch.InformerTime.After(at) {
+			break
+		}
+		if patch.OldResourceVersion == obj.GetResourceVersion() {
+			continue // the snapshot was taken before this patch
+		}
+
+		if err := applyPatch(obj, patch, result, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(patches) == 0 || !patches[0].InformerTime.Before(at) {
+		result.Warnings = append(result.Warnings, "no cached patch was observed before the requested time")
+	}
+
+	result.Object = obj
+	return result, nil
+}
+
+func applyPatch(obj *unstructured.Unstructured, patch *diffcache.Patch, result *Result, reverse bool) error {
+	if patch.Redacted {
+		return ErrRedacted
+	}
+
+	expectedRv, nextRv := patch.OldResourceVersion, patch.NewResourceVersion
+	if reverse {
+		expectedRv, nextRv = nextRv, expectedRv
+	}
+	if rv := obj.GetResourceVersion(); rv != expectedRv {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("patches between resource versions %s and %s are missing", rv, expectedRv))
+	}
+
+	apply := patch.DiffList.Apply
+	if reverse {
+		apply = patch.DiffList.Revert
+	}
+
+	newObj, err := apply(obj.Object)
+	if err != nil {
+		return fmt.Errorf("cannot apply patch %s: %w", patch.NewResourceVersion, err)
+	}
+	newMap, isMap := newObj.(map[string]any)
+	if !isMap {
+		return fmt.Errorf("patch %s does not produce an object", patch.NewResourceVersion)
+	}
+
+	obj.Object = newMap
+	// resourceVersion is usually in the diff, but set it explicitly in case the patch is incomplete
+	obj.SetResourceVersion(nextRv)
+	result.AppliedPatches++
+	return nil
+}
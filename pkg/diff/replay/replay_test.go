@@ -0,0 +1,161 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diffreplay_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	diffcmp "github.com/kubewharf/kelemetry/pkg/diff/cmp"
+	diffreplay "github.com/kubewharf/kelemetry/pkg/diff/replay"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+type fakeCache struct {
+	patches   map[string]*diffcache.Patch
+	snapshots map[string]*diffcache.Snapshot
+}
+
+func (cache *fakeCache) GetCommonOptions() *diffcache.CommonOptions {
+	return &diffcache.CommonOptions{}
+}
+
+func (cache *fakeCache) Store(ctx context.Context, object utilobject.Key, patch *diffcache.Patch) {}
+
+func (cache *fakeCache) Fetch(ctx context.Context, object utilobject.Key, oldRv string, newRv *string) (*diffcache.Patch, error) {
+	return cache.patches[*newRv], nil
+}
+
+func (cache *fakeCache) StoreSnapshot(ctx context.Context, object utilobject.Key, name string, snapshot *diffcache.Snapshot) {
+}
+
+func (cache *fakeCache) FetchSnapshot(ctx context.Context, object utilobject.Key, name string) (*diffcache.Snapshot, error) {
+	return cache.snapshots[name], nil
+}
+
+func (cache *fakeCache) List(ctx context.Context, object utilobject.Key, limit int) ([]string, error) {
+	keys := []string{}
+	for key := range cache.patches {
+		keys = append(keys, key)
+	}
+	for key := range cache.snapshots {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+var base = time.Date(2023, 1, 1, 3, 0, 0, 0, time.UTC)
+
+func deployment(rv int, replicas int) map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{
+			"name":              "web",
+			"resourceVersion":   fmt.Sprint(rv),
+			"creationTimestamp": base.Format(time.RFC3339),
+		},
+		"spec": map[string]any{"replicas": float64(replicas)},
+	}
+}
+
+// newFakeCache creates a cache with one patch every minute that sets replicas to rv.
+func newFakeCache(t *testing.T, numPatches int, withCreation, withDeletion bool) *fakeCache {
+	cache := &fakeCache{
+		patches:   map[string]*diffcache.Patch{},
+		snapshots: map[string]*diffcache.Snapshot{},
+	}
+
+	snapshot := func(obj map[string]any, rv int) *diffcache.Snapshot {
+		value, err := json.Marshal(obj)
+		assert.NoError(t, err)
+		return &diffcache.Snapshot{ResourceVersion: fmt.Sprint(rv), Value: value}
+	}
+
+	if withCreation {
+		cache.snapshots[diffcache.SnapshotNameCreation] = snapshot(deployment(1, 1), 1)
+	}
+	for rv := 2; rv <= numPatches+1; rv++ {
+		cache.patches[fmt.Sprint(rv)] = &diffcache.Patch{
+			InformerTime:       base.Add(time.Minute * time.Duration(rv-1)),
+			OldResourceVersion: fmt.Sprint(rv - 1),
+			NewResourceVersion: fmt.Sprint(rv),
+			DiffList:           diffcmp.Compare(deployment(rv-1, rv-1), deployment(rv, rv)),
+		}
+	}
+	if withDeletion {
+		cache.snapshots[diffcache.SnapshotNameDeletion] = snapshot(deployment(numPatches+1, numPatches+1), numPatches+1)
+	}
+
+	return cache
+}
+
+func TestReconstructFromCreation(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newFakeCache(t, 5, true, true)
+	result, err := diffreplay.Reconstruct(context.Background(), cache, utilobject.Key{}, base.Add(time.Minute*3+time.Second), 100)
+	assert.NoError(err)
+	assert.Equal(diffcache.SnapshotNameCreation, result.Base)
+	assert.Equal(3, result.AppliedPatches)
+	assert.Empty(result.Warnings)
+	assert.Equal("4", result.Object.GetResourceVersion())
+	assert.Equal(deployment(4, 4), result.Object.Object)
+
+	_, err = diffreplay.Reconstruct(context.Background(), cache, utilobject.Key{}, base.Add(-time.Second), 100)
+	assert.ErrorIs(err, diffreplay.ErrNotCreated)
+}
+
+func TestReconstructFromDeletion(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newFakeCache(t, 5, false, true)
+	result, err := diffreplay.Reconstruct(context.Background(), cache, utilobject.Key{}, base.Add(time.Minute*3+time.Second), 100)
+	assert.NoError(err)
+	assert.Equal(diffcache.SnapshotNameDeletion, result.Base)
+	assert.Equal(2, result.AppliedPatches)
+	assert.Empty(result.Warnings)
+	assert.Equal(deployment(4, 4), result.Object.Object)
+}
+
+func TestReconstructMissingPatches(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newFakeCache(t, 5, true, false)
+	delete(cache.patches, "3")
+
+	result, err := diffreplay.Reconstruct(context.Background(), cache, utilobject.Key{}, base.Add(time.Hour), 100)
+	assert.NoError(err)
+	assert.Equal(4, result.AppliedPatches)
+	assert.Len(result.Warnings, 1)
+	assert.Equal("6", result.Object.GetResourceVersion())
+}
+
+func TestReconstructRedacted(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newFakeCache(t, 5, true, false)
+	cache.snapshots[diffcache.SnapshotNameCreation].Redacted = true
+
+	_, err := diffreplay.Reconstruct(context.Background(), cache, utilobject.Key{}, base.Add(time.Hour), 100)
+	assert.ErrorIs(err, diffreplay.ErrRedacted)
+
+	_, err = diffreplay.Reconstruct(context.Background(), &fakeCache{}, utilobject.Key{}, base.Add(time.Hour), 100)
+	assert.ErrorIs(err, diffreplay.ErrNoSnapshot)
+}
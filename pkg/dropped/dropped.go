@@ -0,0 +1,153 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Accounts for data that is dropped anywhere in the pipeline.
+//
+// Every drop increments the dropped_events counter labeled with the pipeline stage and a reason code,
+// and is logged at most once per --dropped-log-interval for each stage and reason,
+// so that a missing trace can be attributed to a reason without flooding the logs.
+package dropped
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.Provide("dropped", manager.Ptr(&Recorder{
+		logs: map[dropMetric]*logState{},
+	}))
+}
+
+// Pipeline stages that drop data.
+const (
+	StageAuditConsumer = "audit-consumer"
+	StageDiffCache     = "diff-cache"
+	StageLinker        = "linker"
+	StageMq            = "mq"
+	StageTracer        = "tracer"
+)
+
+type options struct {
+	logInterval time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.DurationVar(
+		&options.logInterval,
+		"dropped-log-interval",
+		time.Minute,
+		"minimum interval between logs of dropped data with the same stage and reason; "+
+			"drops in between are only counted in the dropped_events metric",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if options.logInterval < 0 {
+		return fmt.Errorf("--dropped-log-interval must not be negative")
+	}
+	return nil
+}
+
+// Recorder counts and logs dropped data.
+type Recorder struct {
+	options options
+	Clock   clock.Clock
+
+	DropMetric *metrics.Metric[*dropMetric]
+
+	logsMu sync.Mutex
+	logs   map[dropMetric]*logState
+}
+
+type dropMetric struct {
+	Stage  string
+	Reason string
+}
+
+func (*dropMetric) MetricName() string { return "dropped_events" }
+
+type logState struct {
+	lastLog    time.Time
+	suppressed int
+}
+
+var _ manager.Component = &Recorder{}
+
+func (recorder *Recorder) Options() manager.Options { return &recorder.options }
+
+func (recorder *Recorder) Init() error                     { return nil }
+func (recorder *Recorder) Start(ctx context.Context) error { return nil }
+func (recorder *Recorder) Close(ctx context.Context) error { return nil }
+
+// Drop records that one item was dropped at stage for reason.
+// err is the cause of the drop, or nil if the item was dropped intentionally, e.g. by a filter.
+func (recorder *Recorder) Drop(logger logrus.FieldLogger, stage string, reason string, err error) {
+	recorder.DropN(logger, stage, reason, 1, err)
+}
+
+// DropN records that count items were dropped at stage for reason.
+func (recorder *Recorder) DropN(logger logrus.FieldLogger, stage string, reason string, count int, err error) {
+	key := dropMetric{Stage: stage, Reason: reason}
+	recorder.DropMetric.With(&key).Count(float64(count))
+
+	suppressed, ok := recorder.shouldLog(key, count)
+	if !ok {
+		return
+	}
+
+	logger = logger.WithField("stage", stage).WithField("reason", reason).WithField("count", count)
+	if suppressed > 0 {
+		logger = logger.WithField("suppressed", suppressed)
+	}
+	if err != nil {
+		logger.WithError(err).Warn("Dropped data")
+	} else {
+		logger.Debug("Dropped data")
+	}
+}
+
+// shouldLog returns whether a drop should be logged,
+// and the number of items dropped for the same key since the last log.
+func (recorder *Recorder) shouldLog(key dropMetric, count int) (suppressed int, ok bool) {
+	recorder.logsMu.Lock()
+	defer recorder.logsMu.Unlock()
+
+	now := recorder.Clock.Now()
+
+	state, exists := recorder.logs[key]
+	if !exists {
+		state = &logState{}
+		recorder.logs[key] = state
+	} else if now.Sub(state.lastLog) < recorder.options.logInterval {
+		state.suppressed += count
+		return 0, false
+	}
+
+	suppressed = state.suppressed
+	state.lastLog = now
+	state.suppressed = 0
+	return suppressed, true
+}
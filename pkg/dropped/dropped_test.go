@@ -0,0 +1,73 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dropped
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestDrop(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, metricsOutput := metrics.NewMock(clock)
+	logger, logs := logtest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+
+	recorder := &Recorder{
+		options:    options{logInterval: time.Minute},
+		Clock:      clock,
+		DropMetric: metrics.New[*dropMetric](metricsClient),
+		logs:       map[dropMetric]*logState{},
+	}
+
+	recorder.Drop(logger, StageTracer, "QueueFull", fmt.Errorf("queue is full"))
+	recorder.Drop(logger, StageTracer, "QueueFull", fmt.Errorf("queue is full"))
+	recorder.DropN(logger, StageTracer, "QueueFull", 3, fmt.Errorf("queue is full"))
+	recorder.Drop(logger, StageAuditConsumer, "Filtered", nil)
+
+	assert.Equal(5.0, metricsOutput.Get("dropped_events", map[string]string{
+		"stage":  StageTracer,
+		"reason": "QueueFull",
+	}).Int, metricsOutput.PrintAll())
+	assert.Equal(1.0, metricsOutput.Get("dropped_events", map[string]string{
+		"stage":  StageAuditConsumer,
+		"reason": "Filtered",
+	}).Int, metricsOutput.PrintAll())
+
+	// only the first drop of each key is logged within the interval
+	entries := logs.AllEntries()
+	assert.Len(entries, 2)
+	assert.Equal(logrus.WarnLevel, entries[0].Level)
+	assert.Equal("QueueFull", entries[0].Data["reason"])
+	assert.Equal(logrus.DebugLevel, entries[1].Level)
+	assert.Equal("Filtered", entries[1].Data["reason"])
+
+	clock.Step(time.Minute)
+	recorder.Drop(logger, StageTracer, "QueueFull", fmt.Errorf("queue is full"))
+
+	entries = logs.AllEntries()
+	assert.Len(entries, 3)
+	assert.Equal(4, entries[2].Data["suppressed"])
+}
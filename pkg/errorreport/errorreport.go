@@ -0,0 +1,297 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reports panics and recurrent errors logged by any component to Sentry or a generic webhook,
+// so that crashed goroutines and persistent failures are noticed without watching logs.
+package errorreport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("error-report", manager.Ptr(&Reporter{}))
+}
+
+const componentName = "error-report"
+
+type options struct {
+	enable      bool
+	sentryDsn   string
+	webhookUrl  string
+	environment string
+	threshold   int
+	window      time.Duration
+	timeout     time.Duration
+	queueSize   int
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "error-report-enable", false, "report panics and recurrent errors to Sentry or a webhook")
+	fs.StringVar(&options.sentryDsn, "error-report-sentry-dsn", "", "Sentry DSN to report errors to")
+	fs.StringVar(&options.webhookUrl, "error-report-webhook-url", "", "URL to POST error reports to in JSON")
+	fs.StringVar(&options.environment, "error-report-environment", "", "environment name attached to error reports")
+	fs.IntVar(
+		&options.threshold,
+		"error-report-threshold",
+		10,
+		"number of errors with the same component and message within --error-report-window before they are reported; "+
+			"panics are always reported",
+	)
+	fs.DurationVar(
+		&options.window,
+		"error-report-window",
+		time.Minute*10,
+		"time window for counting recurrent errors; each error signature is reported at most once per window",
+	)
+	fs.DurationVar(&options.timeout, "error-report-timeout", time.Second*5, "timeout for sending each error report")
+	fs.IntVar(&options.queueSize, "error-report-queue-size", 100, "maximum number of error reports waiting to be sent")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+func (options *options) Validate() error {
+	if !options.enable {
+		return nil
+	}
+	if options.sentryDsn == "" && options.webhookUrl == "" {
+		return fmt.Errorf("--error-report-sentry-dsn or --error-report-webhook-url is required with --error-report-enable")
+	}
+	if options.threshold < 1 {
+		return fmt.Errorf("--error-report-threshold must be positive")
+	}
+	if options.window <= 0 {
+		return fmt.Errorf("--error-report-window must be positive")
+	}
+	return nil
+}
+
+// Report is an error reported to the sinks. It is also the request body of the webhook sink.
+type Report struct {
+	Time        time.Time         `json:"time"`
+	Level       string            `json:"level"`
+	Component   string            `json:"component"`
+	Message     string            `json:"message"`
+	Signature   string            `json:"signature"`
+	Count       int               `json:"count"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Stack       string            `json:"stack,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+}
+
+type sink interface {
+	name() string
+	send(ctx context.Context, report *Report) error
+}
+
+// Reporter is a log hook that reports panics and recurrent errors.
+type Reporter struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	LogLevels *loglevel.Levels
+
+	ReportMetric *metrics.Metric[*reportMetric]
+
+	sinks    []sink
+	hostname string
+	queue    chan *Report
+
+	signaturesMu sync.Mutex
+	signatures   map[string]*signatureState
+}
+
+type reportMetric struct {
+	Sink  string
+	Panic bool
+	Error metrics.LabeledError
+}
+
+func (*reportMetric) MetricName() string { return "error_report" }
+
+type signatureState struct {
+	windowStart time.Time
+	count       int
+	reported    bool
+}
+
+var (
+	_ manager.Component = &Reporter{}
+	_ logrus.Hook       = &Reporter{}
+)
+
+func (reporter *Reporter) Options() manager.Options { return &reporter.options }
+
+func (reporter *Reporter) Init() error {
+	if reporter.options.sentryDsn != "" {
+		sentry, err := newSentrySink(reporter.options.sentryDsn)
+		if err != nil {
+			return fmt.Errorf("invalid --error-report-sentry-dsn: %w", err)
+		}
+		reporter.sinks = append(reporter.sinks, sentry)
+	}
+	if reporter.options.webhookUrl != "" {
+		reporter.sinks = append(reporter.sinks, &webhookSink{url: reporter.options.webhookUrl})
+	}
+
+	reporter.hostname, _ = os.Hostname()
+	reporter.queue = make(chan *Report, reporter.options.queueSize)
+	reporter.signatures = map[string]*signatureState{}
+
+	reporter.LogLevels.AddHook(reporter)
+	return nil
+}
+
+func (reporter *Reporter) Start(ctx context.Context) error {
+	go func() {
+		defer shutdown.RecoverPanic(reporter.Logger)
+
+		pruneTicker := reporter.Clock.Tick(reporter.options.window)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case report := <-reporter.queue:
+				reporter.send(ctx, report)
+			case <-pruneTicker:
+				reporter.prune()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (reporter *Reporter) Close(ctx context.Context) error { return nil }
+
+func (reporter *Reporter) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (reporter *Reporter) Fire(entry *logrus.Entry) error {
+	component, _ := entry.Data[loglevel.ModField].(string)
+	if component == componentName {
+		// do not report failures of the reporter itself
+		return nil
+	}
+	if submod, ok := entry.Data[loglevel.SubmodField].(string); ok && submod != "" {
+		component += "/" + submod
+	}
+
+	message := entry.Message
+	if err, ok := entry.Data[logrus.ErrorKey]; ok && message == "" {
+		message = fmt.Sprint(err)
+	}
+
+	report := &Report{
+		Time:        entry.Time,
+		Level:       entry.Level.String(),
+		Component:   component,
+		Message:     message,
+		Signature:   fmt.Sprintf("%s: %s", component, entry.Message),
+		Count:       1,
+		Fields:      make(map[string]string, len(entry.Data)),
+		Hostname:    reporter.hostname,
+		Environment: reporter.options.environment,
+	}
+	for key, value := range entry.Data {
+		if key == shutdown.PanicField {
+			report.Stack = fmt.Sprint(value)
+			continue
+		}
+		report.Fields[key] = fmt.Sprint(value)
+	}
+
+	if report.Stack != "" {
+		// the process crashes after the panic is logged, so the report must be sent before returning
+		report.Level = "fatal"
+		reporter.send(context.Background(), report)
+		return nil
+	}
+
+	count, ok := reporter.observe(report.Signature)
+	if !ok {
+		return nil
+	}
+	report.Count = count
+
+	select {
+	case reporter.queue <- report:
+	default:
+		reporter.ReportMetric.With(&reportMetric{Sink: "queue", Error: metrics.MakeLabeledError("QueueFull")}).Count(1)
+	}
+
+	return nil
+}
+
+// observe counts an error and returns whether it has just become recurrent in the current window.
+func (reporter *Reporter) observe(signature string) (count int, shouldReport bool) {
+	reporter.signaturesMu.Lock()
+	defer reporter.signaturesMu.Unlock()
+
+	now := reporter.Clock.Now()
+	state, exists := reporter.signatures[signature]
+	if !exists || now.Sub(state.windowStart) >= reporter.options.window {
+		state = &signatureState{windowStart: now}
+		reporter.signatures[signature] = state
+	}
+
+	state.count++
+	if state.reported || state.count < reporter.options.threshold {
+		return state.count, false
+	}
+
+	state.reported = true
+	return state.count, true
+}
+
+func (reporter *Reporter) prune() {
+	reporter.signaturesMu.Lock()
+	defer reporter.signaturesMu.Unlock()
+
+	now := reporter.Clock.Now()
+	for signature, state := range reporter.signatures {
+		if now.Sub(state.windowStart) >= reporter.options.window {
+			delete(reporter.signatures, signature)
+		}
+	}
+}
+
+func (reporter *Reporter) send(ctx context.Context, report *Report) {
+	ctx, cancelFunc := context.WithTimeout(ctx, reporter.options.timeout)
+	defer cancelFunc()
+
+	for _, sink := range reporter.sinks {
+		metric := &reportMetric{Sink: sink.name(), Panic: report.Stack != ""}
+		if err := sink.send(ctx, report); err != nil {
+			reporter.Logger.WithError(err).WithField("sink", sink.name()).Warn("cannot send error report")
+			metric.Error = metrics.LabelError(err, "Send")
+		}
+		reporter.ReportMetric.With(metric).Count(1)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorreport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var reports []Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report Report
+		assert.NoError(json.NewDecoder(r.Body).Decode(&report))
+		mu.Lock()
+		reports = append(reports, report)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	rootLogger := logrus.New()
+	rootLogger.SetOutput(io.Discard)
+
+	reporter := &Reporter{
+		options: options{
+			enable:     true,
+			webhookUrl: server.URL,
+			threshold:  3,
+			window:     time.Minute,
+			timeout:    time.Second,
+			queueSize:  10,
+		},
+		Logger:       rootLogger.WithField(loglevel.ModField, componentName),
+		Clock:        clock,
+		LogLevels:    loglevel.New(rootLogger),
+		ReportMetric: metrics.New[*reportMetric](metricsClient),
+	}
+	assert.NoError(reporter.Init())
+
+	logger := rootLogger.WithField(loglevel.ModField, "diff-controller")
+
+	// panics are sent synchronously
+	logger.WithField("error", "boom").WithField(shutdown.PanicField, "goroutine 1").Error("Panic recovered")
+	assert.Len(reports, 1)
+	assert.Equal("fatal", reports[0].Level)
+	assert.Equal("diff-controller", reports[0].Component)
+	assert.Equal("goroutine 1", reports[0].Stack)
+	assert.Equal("boom", reports[0].Fields["error"])
+
+	// recurrent errors are queued once the threshold is reached within the window
+	for i := 0; i < 5; i++ {
+		logger.WithError(fmt.Errorf("error %d", i)).Error("cannot list objects")
+	}
+	logger.Warn("warnings are not reported")
+	assert.Len(reporter.queue, 1)
+	report := <-reporter.queue
+	assert.Equal(3, report.Count)
+	assert.Equal("diff-controller: cannot list objects", report.Signature)
+
+	clock.Step(time.Minute)
+	for i := 0; i < 3; i++ {
+		logger.Error("cannot list objects")
+	}
+	assert.Len(reporter.queue, 1)
+
+	// errors of the reporter itself are ignored
+	for i := 0; i < 3; i++ {
+		reporter.Logger.Error("cannot send error report")
+	}
+	assert.Len(reporter.queue, 1)
+}
+
+func TestSentryDsn(t *testing.T) {
+	assert := assert.New(t)
+
+	sink, err := newSentrySink("https://abc@sentry.example.com/prefix/42")
+	assert.NoError(err)
+	assert.Equal("https://sentry.example.com/prefix/api/42/store/", sink.storeUrl)
+	assert.Contains(sink.auth, "sentry_key=abc")
+
+	_, err = newSentrySink("https://sentry.example.com/42")
+	assert.Error(err)
+	_, err = newSentrySink("https://abc@sentry.example.com")
+	assert.Error(err)
+}
@@ -0,0 +1,153 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errorreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func postJson(ctx context.Context, url string, body any, header http.Header) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("cannot encode report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookSink posts the report as JSON to a URL.
+type webhookSink struct {
+	url string
+}
+
+func (*webhookSink) name() string { return "webhook" }
+
+func (sink *webhookSink) send(ctx context.Context, report *Report) error {
+	return postJson(ctx, sink.url, report, nil)
+}
+
+// sentrySink sends events to the store endpoint of a Sentry project.
+type sentrySink struct {
+	storeUrl string
+	auth     string
+}
+
+// newSentrySink parses a DSN in the form "https://publicKey@host/path/projectId".
+func newSentrySink(dsn string) (*sentrySink, error) {
+	parsed, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.User == nil || parsed.User.Username() == "" {
+		return nil, fmt.Errorf("DSN has no public key")
+	}
+
+	path := strings.TrimSuffix(parsed.Path, "/")
+	slash := strings.LastIndexByte(path, '/')
+	projectId := path[slash+1:]
+	if projectId == "" {
+		return nil, fmt.Errorf("DSN has no project ID")
+	}
+
+	storeUrl := url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: fmt.Sprintf("%s/api/%s/store/", path[:slash], projectId)}
+
+	return &sentrySink{
+		storeUrl: storeUrl.String(),
+		auth:     fmt.Sprintf("Sentry sentry_version=7, sentry_client=kelemetry/1.0, sentry_key=%s", parsed.User.Username()),
+	}, nil
+}
+
+func (*sentrySink) name() string { return "sentry" }
+
+type sentryEvent struct {
+	EventId     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger,omitempty"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Fingerprint []string          `json:"fingerprint"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+}
+
+func (sink *sentrySink) send(ctx context.Context, report *Report) error {
+	eventId := make([]byte, 16)
+	if _, err := rand.Read(eventId); err != nil {
+		return fmt.Errorf("cannot generate event ID: %w", err)
+	}
+
+	extra := make(map[string]any, len(report.Fields)+2)
+	for key, value := range report.Fields {
+		extra[key] = value
+	}
+	extra["count"] = report.Count
+	if report.Stack != "" {
+		extra["stack"] = report.Stack
+	}
+
+	level := report.Level
+	if level == "panic" {
+		level = "fatal"
+	}
+
+	event := sentryEvent{
+		EventId:     hex.EncodeToString(eventId),
+		Timestamp:   report.Time.UTC().Format(time.RFC3339),
+		Level:       level,
+		Logger:      report.Component,
+		Platform:    "go",
+		ServerName:  report.Hostname,
+		Environment: report.Environment,
+		Message:     report.Message,
+		Fingerprint: []string{report.Signature},
+		Tags:        map[string]string{"component": report.Component},
+		Extra:       extra,
+	}
+
+	return postJson(ctx, sink.storeUrl, event, http.Header{"X-Sentry-Auth": []string{sink.auth}})
+}
@@ -24,9 +24,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	toolscache "k8s.io/client-go/tools/cache"
@@ -51,6 +53,11 @@ const (
 	configMapLastUpdatedKey = "lastUpdated"
 )
 
+const (
+	apiCoreV1   = "v1"
+	apiEventsV1 = "events.k8s.io/v1"
+)
+
 func init() {
 	manager.Global.Provide("event-informer", manager.Ptr(&controller{
 		configMapUpdateCh: make(chan func(*corev1.ConfigMap), 50),
@@ -64,6 +71,10 @@ type options struct {
 	configMapName         string
 	configMapNamespace    string
 	workerCount           int
+	api                   string
+	seriesFlushInterval   time.Duration
+	seriesRetention       time.Duration
+	watchList             bool
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -97,6 +108,32 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		8,
 		"number of worker counts",
 	)
+	fs.StringVar(
+		&options.api,
+		"event-informer-api",
+		apiCoreV1,
+		fmt.Sprintf("the events API to watch, either %q or %q", apiCoreV1, apiEventsV1),
+	)
+	fs.DurationVar(
+		&options.seriesFlushInterval,
+		"event-informer-series-flush-interval",
+		time.Second*30,
+		"repeated occurrences of an event series within this interval are collapsed into a single span with a count tag; "+
+			"set to 0 to emit a span for every update",
+	)
+	fs.DurationVar(
+		&options.seriesRetention,
+		"event-informer-series-retention",
+		time.Hour,
+		"duration after the last update of an event series before its occurrence count is forgotten",
+	)
+	fs.BoolVar(
+		&options.watchList,
+		"event-informer-watch-list",
+		false,
+		"stream the initial events from the apiserver watch cache instead of listing them; "+
+			"falls back to listing if the WatchList feature is not enabled on the apiserver",
+	)
 	options.electorOptions.SetupOptions(
 		fs,
 		"event-informer",
@@ -119,6 +156,8 @@ type controller struct {
 
 	EventHandleMetric  *metrics.Metric[*eventHandleMetric]
 	EventLatencyMetric *metrics.Metric[*eventLatencyMetric]
+	EventSeriesMetric  *metrics.Metric[*eventSeriesMetric]
+	ListMetric         *metrics.Metric[*listMetric]
 
 	elector           *multileader.Elector
 	isLeader          uint32
@@ -126,6 +165,7 @@ type controller struct {
 	configMapClient   corev1client.ConfigMapInterface
 	lastEventTime     time.Time
 	configMapUpdateCh chan func(*corev1.ConfigMap)
+	series            *seriesAggregator
 }
 
 var _ manager.Component = &controller{}
@@ -141,6 +181,12 @@ type eventHandleMetric struct {
 
 func (*eventHandleMetric) MetricName() string { return "event_handle" }
 
+type eventSeriesMetric struct {
+	Resource string
+}
+
+func (*eventSeriesMetric) MetricName() string { return "event_series_occurrences" }
+
 type eventLatencyMetric struct {
 	Group    string
 	Version  string
@@ -149,6 +195,12 @@ type eventLatencyMetric struct {
 
 func (*eventLatencyMetric) MetricName() string { return "event_latency" }
 
+type listMetric struct {
+	Kind informerutil.ListKind
+}
+
+func (*listMetric) MetricName() string { return "event_informer_list" }
+
 func (ctrl *controller) Options() manager.Options {
 	return &ctrl.options
 }
@@ -170,6 +222,14 @@ func (ctrl *controller) Init() (err error) {
 
 	ctrl.configMapClient = client.KubernetesClient().CoreV1().ConfigMaps(ctrl.options.configMapNamespace)
 
+	if ctrl.options.api != apiCoreV1 && ctrl.options.api != apiEventsV1 {
+		return fmt.Errorf("unsupported --event-informer-api %q", ctrl.options.api)
+	}
+
+	if ctrl.options.seriesFlushInterval > 0 {
+		ctrl.series = newSeriesAggregator(ctrl.options.seriesFlushInterval, ctrl.options.seriesRetention)
+	}
+
 	return nil
 }
 
@@ -191,21 +251,60 @@ func (ctrl *controller) runLeader(ctx context.Context) {
 
 	startReadyCh := make(chan struct{})
 
-	eventClient := ctrl.Clients.TargetCluster().KubernetesClient().CoreV1().Events(metav1.NamespaceAll)
-	lw := toolscache.ListWatch{
-		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-			return eventClient.List(ctx, options)
-		},
-		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-			return eventClient.Watch(ctx, options)
-		},
+	if ctrl.options.api == apiEventsV1 {
+		eventClient := ctrl.Clients.TargetCluster().KubernetesClient().EventsV1().Events(metav1.NamespaceAll)
+		runInformer(ctx, ctrl, startReadyCh, &eventsv1.Event{}, toolscache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return eventClient.List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return eventClient.Watch(ctx, options)
+			},
+		}, eventsV1EventInfo)
+	} else {
+		eventClient := ctrl.Clients.TargetCluster().KubernetesClient().CoreV1().Events(metav1.NamespaceAll)
+		runInformer(ctx, ctrl, startReadyCh, &corev1.Event{}, toolscache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return eventClient.List(ctx, options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return eventClient.Watch(ctx, options)
+			},
+		}, coreEventInfo)
 	}
 
-	store := informerutil.NewDecayingInformer[*corev1.Event]()
+	if ctrl.series != nil {
+		go func() {
+			defer shutdown.RecoverPanic(ctrl.Logger)
+			<-startReadyCh
+			wait.UntilWithContext(ctx, ctrl.flushSeries, ctrl.options.seriesFlushInterval)
+		}()
+	}
+
+	ctrl.syncConfigMap(ctx, startReadyCh)
+}
+
+func runInformer[E interface {
+	metav1.Object
+	runtime.Object
+}](
+	ctx context.Context,
+	ctrl *controller,
+	startReadyCh <-chan struct{},
+	example E,
+	lw toolscache.ListWatch,
+	toInfo func(E) eventInfo,
+) {
+	store := informerutil.NewDecayingInformer[E]()
 	addCh := store.SetAddCh()
 	replaceCh := store.SetReplaceCh()
 
-	reflector := toolscache.NewReflector(&lw, &corev1.Event{}, store, 0)
+	reflector := informerutil.NewReflector(&lw, example, store, informerutil.ReflectorOptions{
+		WatchList: ctrl.options.watchList,
+		OnList: func(kind informerutil.ListKind) {
+			ctrl.ListMetric.With(&listMetric{Kind: kind}).Count(1)
+		},
+	})
 	go func() {
 		defer shutdown.RecoverPanic(ctrl.Logger)
 		reflector.Run(ctx.Done())
@@ -220,88 +319,135 @@ func (ctrl *controller) runLeader(ctx context.Context) {
 			for {
 				select {
 				case event := <-addCh:
-					ctrl.handleEvent(ctx, event)
+					ctrl.handleEvent(ctx, toInfo(event))
 				case event := <-replaceCh:
-					ctrl.handleEvent(ctx, event)
+					ctrl.handleEvent(ctx, toInfo(event))
 				case <-ctx.Done():
 					return
 				}
 			}
 		}(workerId)
 	}
-
-	ctrl.syncConfigMap(ctx, startReadyCh)
 }
 
-func (ctrl *controller) handleEvent(ctx context.Context, event *corev1.Event) {
+func (ctrl *controller) handleEvent(ctx context.Context, event eventInfo) {
 	isLeader := atomic.LoadUint32(&ctrl.isLeader)
 	if isLeader == 0 {
 		return
 	}
 
 	metric := &eventHandleMetric{
-		Group:   event.InvolvedObject.GroupVersionKind().Group,
-		Version: event.InvolvedObject.GroupVersionKind().Version,
-		Kind:    event.InvolvedObject.Kind,
+		Group:         event.regarding.GroupVersionKind().Group,
+		Version:       event.regarding.GroupVersionKind().Version,
+		Kind:          event.regarding.Kind,
+		TimestampType: event.timestampType,
 	}
 	defer ctrl.EventHandleMetric.DeferCount(ctrl.Clock.Now(), metric)
 
-	logger := ctrl.Logger.WithField("event", event.Name).WithField("subject", event.InvolvedObject)
+	logger := ctrl.Logger.WithField("event", event.key).WithField("subject", event.regarding)
 
-	eventTime := event.EventTime.Time
-	metric.TimestampType = "EventTime"
-	if eventTime.IsZero() {
-		eventTime = event.LastTimestamp.Time
-		metric.TimestampType = "LastTimestamp"
-	}
-	if eventTime.IsZero() {
+	if event.eventTime.IsZero() {
 		metric.TimestampType = ""
 		metric.Error = metrics.MakeLabeledError("InferTimestamp")
 		logger.WithField("object", event).Warn("cannot infer timestamp")
 		return
 	}
 
-	if eventTime.Before(ctrl.lastEventTime) {
+	// lastObserved is the time of the latest occurrence, which is the same as eventTime for singleton events
+	observedTime := event.lastObserved
+
+	if observedTime.Before(ctrl.lastEventTime) {
 		metric.Error = metrics.MakeLabeledError("BeforeRestart")
 		return
 	}
 
-	if ctrl.Clock.Since(eventTime) > 5*time.Minute {
+	if ctrl.Clock.Since(observedTime) > 5*time.Minute {
 		metric.Error = metrics.MakeLabeledError("EventTooOld")
 		return
 	}
 
-	logger = logger.WithField("eventTime", eventTime)
+	logger = logger.WithField("eventTime", observedTime)
 	ctrl.configMapUpdateCh <- func(cm *corev1.ConfigMap) {
 		t, err := time.Parse(time.RFC3339, cm.Data[configMapLastEventKey])
-		if err != nil || t.Before(eventTime) {
-			cm.Data[configMapLastEventKey] = eventTime.Format(time.RFC3339)
+		if err != nil || t.Before(observedTime) {
+			cm.Data[configMapLastEventKey] = observedTime.Format(time.RFC3339)
 		}
 	}
 
 	clusterName := ctrl.Clients.TargetCluster().ClusterName()
 
-	if !ctrl.Filter.TestGvk(clusterName, event.InvolvedObject.GroupVersionKind()) {
+	if !ctrl.Filter.TestGvk(clusterName, event.regarding.GroupVersionKind()) {
 		metric.Error = metrics.MakeLabeledError("Filtered")
 		return
 	}
 
-	aggregatorEvent := aggregatorevent.NewEvent(event.Reason, eventTime, zconstants.TraceSourceEvent).
-		SetTag("source", event.Source.Component).
-		SetTag("action", event.Action).
-		Log(zconstants.LogTypeEventMessage, event.Message)
+	batch := seriesBatch{info: event, start: event.eventTime, occurrences: 1}
+	if ctrl.series != nil {
+		var emit bool
+		batch, emit = ctrl.series.observe(event, ctrl.Clock.Now())
+		if !emit {
+			metric.Error = metrics.MakeLabeledError("SeriesBuffered")
+			return
+		}
+	}
+
+	if err := ctrl.sendBatch(ctx, logger, clusterName, batch, metric); err != nil {
+		return
+	}
+
+	logger.Debug("Send")
+}
+
+func (ctrl *controller) flushSeries(ctx context.Context) {
+	clusterName := ctrl.Clients.TargetCluster().ClusterName()
+
+	for _, batch := range ctrl.series.flush(ctrl.Clock.Now()) {
+		metric := &eventHandleMetric{
+			Group:         batch.info.regarding.GroupVersionKind().Group,
+			Version:       batch.info.regarding.GroupVersionKind().Version,
+			Kind:          batch.info.regarding.Kind,
+			TimestampType: "SeriesFlush",
+		}
+		logger := ctrl.Logger.WithField("event", batch.info.key).WithField("subject", batch.info.regarding)
+
+		_ = ctrl.sendBatch(ctx, logger, clusterName, batch, metric)
+		ctrl.EventHandleMetric.With(metric).Count(1)
+	}
+}
+
+func (ctrl *controller) sendBatch(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	clusterName string,
+	batch seriesBatch,
+	metric *eventHandleMetric,
+) error {
+	event := batch.info
+
+	aggregatorEvent := aggregatorevent.NewEvent(event.reason, batch.start, zconstants.TraceSourceEvent).
+		SetTag("source", event.source).
+		SetTag("action", event.action).
+		Log(zconstants.LogTypeEventMessage, event.message)
+	if ctrl.series != nil && event.count > 1 {
+		if event.lastObserved.After(batch.start) {
+			aggregatorEvent = aggregatorEvent.SetEndTime(event.lastObserved)
+		}
+		aggregatorEvent = aggregatorEvent.
+			SetTag("count", batch.occurrences).
+			SetTag("seriesCount", event.count)
+	}
 
 	cdc, err := ctrl.DiscoveryCache.ForCluster(clusterName)
 	if err != nil {
 		logger.WithError(err).Error("cannot init discovery cache for target cluster")
 		metric.Error = metrics.MakeLabeledError("invalid cluster")
-		return
+		return err
 	}
-	gvr, found := cdc.LookupResource(event.InvolvedObject.GroupVersionKind())
+	gvr, found := cdc.LookupResource(event.regarding.GroupVersionKind())
 	if !found {
-		logger.WithField("gvk", event.InvolvedObject.GroupVersionKind()).Error("unknown gvk")
+		logger.WithField("gvk", event.regarding.GroupVersionKind()).Error("unknown gvk")
 		metric.Error = metrics.MakeLabeledError("UnknownGVK")
-		return
+		return fmt.Errorf("unknown gvk")
 	}
 
 	metric.Resource = gvr.Resource
@@ -310,7 +456,8 @@ func (ctrl *controller) handleEvent(ctx context.Context, event *corev1.Event) {
 		Group:    gvr.Group,
 		Version:  gvr.Version,
 		Resource: gvr.Resource,
-	}).Summary(float64(ctrl.Clock.Since(eventTime).Nanoseconds()))
+	}).Summary(float64(ctrl.Clock.Since(event.lastObserved).Nanoseconds()))
+	ctrl.EventSeriesMetric.With(&eventSeriesMetric{Resource: gvr.Resource}).Histogram(float64(batch.occurrences))
 
 	if err := ctrl.Aggregator.Send(ctx, utilobject.Rich{
 		VersionedKey: utilobject.VersionedKey{
@@ -318,19 +465,19 @@ func (ctrl *controller) handleEvent(ctx context.Context, event *corev1.Event) {
 				Cluster:   clusterName,
 				Group:     gvr.Group,
 				Resource:  gvr.Resource,
-				Namespace: event.InvolvedObject.Namespace,
-				Name:      event.InvolvedObject.Name,
+				Namespace: event.regarding.Namespace,
+				Name:      event.regarding.Name,
 			},
 			Version: gvr.Version,
 		},
-		Uid: event.InvolvedObject.UID,
+		Uid: event.regarding.UID,
 	}, aggregatorEvent); err != nil {
 		logger.WithError(err).Error("Cannot send trace")
 		metric.Error = metrics.LabelError(err, "SendTrace")
-		return
+		return err
 	}
 
-	logger.Debug("Send")
+	return nil
 }
 
 func (ctrl *controller) syncConfigMap(ctx context.Context, startReadyCh chan<- struct{}) {
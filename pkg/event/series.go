@@ -0,0 +1,216 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+)
+
+// eventInfo is the API-version-independent view of an event object.
+type eventInfo struct {
+	// namespace/name of the event object, identifying the series.
+	key           string
+	reason        string
+	message       string
+	source        string
+	action        string
+	regarding     corev1.ObjectReference
+	eventTime     time.Time
+	timestampType string
+	// number of occurrences of the series observed so far, at least 1.
+	count int32
+	// time of the latest occurrence of the series.
+	lastObserved time.Time
+}
+
+func coreEventInfo(event *corev1.Event) eventInfo {
+	info := eventInfo{
+		key:           event.Namespace + "/" + event.Name,
+		reason:        event.Reason,
+		message:       event.Message,
+		source:        event.Source.Component,
+		action:        event.Action,
+		regarding:     event.InvolvedObject,
+		eventTime:     event.EventTime.Time,
+		timestampType: "EventTime",
+		count:         event.Count,
+		lastObserved:  event.LastTimestamp.Time,
+	}
+	if info.eventTime.IsZero() {
+		info.eventTime = event.LastTimestamp.Time
+		info.timestampType = "LastTimestamp"
+	}
+	if event.Series != nil {
+		info.count = event.Series.Count
+		info.lastObserved = event.Series.LastObservedTime.Time
+	}
+
+	info.normalize()
+	return info
+}
+
+func eventsV1EventInfo(event *eventsv1.Event) eventInfo {
+	info := eventInfo{
+		key:           event.Namespace + "/" + event.Name,
+		reason:        event.Reason,
+		message:       event.Note,
+		source:        event.ReportingController,
+		action:        event.Action,
+		regarding:     event.Regarding,
+		eventTime:     event.EventTime.Time,
+		timestampType: "EventTime",
+		count:         event.DeprecatedCount,
+		lastObserved:  event.DeprecatedLastTimestamp.Time,
+	}
+	if info.source == "" {
+		info.source = event.DeprecatedSource.Component
+	}
+	if info.eventTime.IsZero() {
+		info.eventTime = event.DeprecatedLastTimestamp.Time
+		info.timestampType = "DeprecatedLastTimestamp"
+	}
+	if event.Series != nil {
+		info.count = event.Series.Count
+		info.lastObserved = event.Series.LastObservedTime.Time
+	}
+
+	info.normalize()
+	return info
+}
+
+func (info *eventInfo) normalize() {
+	if info.count < 1 {
+		info.count = 1
+	}
+	if info.lastObserved.Before(info.eventTime) {
+		info.lastObserved = info.eventTime
+	}
+}
+
+// seriesBatch is a group of occurrences of an event series to be emitted as one span.
+type seriesBatch struct {
+	info eventInfo
+	// start time of the span, which is the event time for the first batch of a series,
+	// or the earliest observed occurrence in the batch for subsequent batches.
+	start time.Time
+	// number of occurrences in this batch.
+	occurrences int32
+}
+
+// seriesAggregator collapses repeated occurrences of the same event series into batches.
+//
+// The first observation of a series is emitted immediately.
+// Subsequent occurrences are buffered and emitted as a single batch
+// once flushInterval has elapsed since the first buffered occurrence.
+type seriesAggregator struct {
+	flushInterval time.Duration
+	retention     time.Duration
+
+	mu     sync.Mutex
+	series map[string]*seriesState
+}
+
+type seriesState struct {
+	emittedCount int32
+	lastSeen     time.Time
+
+	pending      *eventInfo
+	pendingSince time.Time
+	pendingStart time.Time
+}
+
+func newSeriesAggregator(flushInterval time.Duration, retention time.Duration) *seriesAggregator {
+	return &seriesAggregator{
+		flushInterval: flushInterval,
+		retention:     retention,
+		series:        map[string]*seriesState{},
+	}
+}
+
+// observe records an observation of an event object.
+// Returns a batch if it should be emitted immediately.
+func (agg *seriesAggregator) observe(info eventInfo, now time.Time) (seriesBatch, bool) {
+	agg.mu.Lock()
+	defer agg.mu.Unlock()
+
+	state, exists := agg.series[info.key]
+	if !exists {
+		agg.series[info.key] = &seriesState{
+			emittedCount: info.count,
+			lastSeen:     now,
+		}
+		return seriesBatch{info: info, start: info.eventTime, occurrences: info.count}, true
+	}
+
+	state.lastSeen = now
+
+	if info.count <= state.emittedCount {
+		// no new occurrences, e.g. relist or an unrelated update
+		return seriesBatch{}, false
+	}
+
+	if state.pending == nil {
+		state.pendingSince = now
+		state.pendingStart = info.lastObserved
+	} else if info.count < state.pending.count {
+		return seriesBatch{}, false
+	}
+
+	state.pending = &info
+
+	if now.Sub(state.pendingSince) >= agg.flushInterval {
+		return state.flush(), true
+	}
+
+	return seriesBatch{}, false
+}
+
+// flush returns the batches that have been buffered for at least flushInterval,
+// and forgets series that have not been observed for the retention period.
+func (agg *seriesAggregator) flush(now time.Time) []seriesBatch {
+	agg.mu.Lock()
+	defer agg.mu.Unlock()
+
+	var batches []seriesBatch
+
+	for key, state := range agg.series {
+		if state.pending != nil && now.Sub(state.pendingSince) >= agg.flushInterval {
+			batches = append(batches, state.flush())
+		}
+
+		if state.pending == nil && now.Sub(state.lastSeen) >= agg.retention {
+			delete(agg.series, key)
+		}
+	}
+
+	return batches
+}
+
+func (state *seriesState) flush() seriesBatch {
+	batch := seriesBatch{
+		info:        *state.pending,
+		start:       state.pendingStart,
+		occurrences: state.pending.count - state.emittedCount,
+	}
+
+	state.emittedCount = state.pending.count
+	state.pending = nil
+
+	return batch
+}
@@ -0,0 +1,109 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEventsV1EventInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := eventsV1EventInfo(&eventsv1.Event{
+		ObjectMeta:          metav1.ObjectMeta{Namespace: "default", Name: "web-1.abc"},
+		EventTime:           metav1.NewMicroTime(base),
+		Reason:              "BackOff",
+		Note:                "Back-off restarting failed container",
+		ReportingController: "kubelet",
+		Regarding:           corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-1"},
+		Series:              &eventsv1.EventSeries{Count: 12, LastObservedTime: metav1.NewMicroTime(base.Add(time.Minute))},
+	})
+
+	assert.Equal("default/web-1.abc", info.key)
+	assert.Equal("Back-off restarting failed container", info.message)
+	assert.Equal("kubelet", info.source)
+	assert.Equal(int32(12), info.count)
+	assert.Equal(base, info.eventTime)
+	assert.Equal(base.Add(time.Minute), info.lastObserved)
+}
+
+func TestCoreEventInfoSingleton(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := coreEventInfo(&corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Namespace: "default", Name: "web-1.abc"},
+		LastTimestamp: metav1.NewTime(base),
+	})
+
+	assert.Equal("LastTimestamp", info.timestampType)
+	assert.Equal(int32(1), info.count)
+	assert.Equal(base, info.eventTime)
+	assert.Equal(base, info.lastObserved)
+}
+
+func TestSeriesAggregator(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	agg := newSeriesAggregator(time.Second*30, time.Hour)
+
+	occurrence := func(count int32, offset time.Duration) eventInfo {
+		return eventInfo{key: "default/e", eventTime: base, count: count, lastObserved: base.Add(offset)}
+	}
+
+	batch, emit := agg.observe(occurrence(1, 0), base)
+	assert.True(emit)
+	assert.Equal(int32(1), batch.occurrences)
+	assert.Equal(base, batch.start)
+
+	// duplicate update
+	_, emit = agg.observe(occurrence(1, 0), base.Add(time.Second))
+	assert.False(emit)
+
+	_, emit = agg.observe(occurrence(3, time.Second*5), base.Add(time.Second*5))
+	assert.False(emit)
+	_, emit = agg.observe(occurrence(7, time.Second*20), base.Add(time.Second*20))
+	assert.False(emit)
+
+	assert.Empty(agg.flush(base.Add(time.Second * 25)))
+
+	batches := agg.flush(base.Add(time.Second * 40))
+	assert.Len(batches, 1)
+	assert.Equal(int32(6), batches[0].occurrences)
+	assert.Equal(int32(7), batches[0].info.count)
+	assert.Equal(base.Add(time.Second*5), batches[0].start)
+	assert.Equal(base.Add(time.Second*20), batches[0].info.lastObserved)
+
+	// observed after the flush interval elapsed without a flush
+	_, emit = agg.observe(occurrence(8, time.Minute), base.Add(time.Minute))
+	assert.False(emit)
+	batch, emit = agg.observe(occurrence(9, time.Minute*2), base.Add(time.Minute*2))
+	assert.True(emit)
+	assert.Equal(int32(2), batch.occurrences)
+
+	// forgotten after the retention period
+	assert.Empty(agg.flush(base.Add(time.Hour * 2)))
+	batch, emit = agg.observe(occurrence(10, time.Hour*2), base.Add(time.Hour*2))
+	assert.True(emit)
+	assert.Equal(int32(10), batch.occurrences)
+}
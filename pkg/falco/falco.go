@@ -0,0 +1,258 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Ingests Falco runtime security alerts as events on the affected Pod or Node.
+//
+// Alerts are received in the JSON format of Falco http_output and the falcosidekick webhook output.
+package falco
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername"
+	"github.com/kubewharf/kelemetry/pkg/filter"
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("falco", manager.Ptr(&receiver{}))
+}
+
+type options struct {
+	enable      bool
+	minPriority string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "falco-enable", false, "enable Falco alert ingestion on /falco and /falco/:cluster")
+	fs.StringVar(
+		&options.minPriority,
+		"falco-min-priority",
+		"notice",
+		"alerts with lower priority are dropped (one of emergency, alert, critical, error, warning, notice, informational, debug)",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type receiver struct {
+	options             options
+	Logger              logrus.FieldLogger
+	Clock               clock.Clock
+	Server              kelemetryhttp.Server
+	Aggregator          aggregator.Aggregator
+	Filter              filter.Filter
+	ClusterNameResolver clustername.Resolver
+
+	AlertMetric *metrics.Metric[*alertMetric]
+
+	minPriority Priority
+}
+
+type alertMetric struct {
+	Cluster  string
+	Resource string
+	Priority string
+	Error    metrics.LabeledError
+}
+
+func (*alertMetric) MetricName() string { return "falco_alert" }
+
+func (recv *receiver) Options() manager.Options { return &recv.options }
+
+func (recv *receiver) Init() error {
+	minPriority, err := ParsePriority(recv.options.minPriority)
+	if err != nil {
+		return fmt.Errorf("invalid --falco-min-priority: %w", err)
+	}
+	recv.minPriority = minPriority
+
+	recv.Server.Routes().POST("/falco", recv.handleRequest)
+	recv.Server.Routes().POST("/falco/:cluster", recv.handleRequest)
+
+	return nil
+}
+
+func (recv *receiver) Start(ctx context.Context) error { return nil }
+func (recv *receiver) Close(ctx context.Context) error { return nil }
+
+// Alert is a Falco alert in JSON output format.
+type Alert struct {
+	Time         time.Time      `json:"time"`
+	Rule         string         `json:"rule"`
+	Priority     string         `json:"priority"`
+	Source       string         `json:"source"`
+	Output       string         `json:"output"`
+	OutputFields map[string]any `json:"output_fields"`
+	Tags         []string       `json:"tags"`
+	Hostname     string         `json:"hostname"`
+}
+
+// Priority is the severity of a Falco alert, where lower values are more severe.
+type Priority int
+
+var priorityNames = []string{"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug"}
+
+func ParsePriority(name string) (Priority, error) {
+	name = strings.ToLower(name)
+	if name == "info" {
+		name = "informational"
+	}
+
+	for i, known := range priorityNames {
+		if known == name {
+			return Priority(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown priority %q", name)
+}
+
+func (priority Priority) String() string { return priorityNames[priority] }
+
+var (
+	podGvr  = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodeGvr = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+)
+
+// ObjectFromAlert returns the object that the alert should be attached to and its kind.
+// Alerts from Kubernetes containers are attached to the Pod, other alerts are attached to the Node.
+func ObjectFromAlert(cluster string, alert *Alert) (_ utilobject.Rich, kind string, _ bool) {
+	gvr, kind, namespace, name := nodeGvr, "Node", "", alert.Hostname
+	var uid types.UID
+
+	podName, hasPod := alert.OutputFields["k8s.pod.name"].(string)
+	podNamespace, hasNamespace := alert.OutputFields["k8s.ns.name"].(string)
+	if hasPod && hasNamespace && podName != "" && podName != "<NA>" {
+		gvr, kind, namespace, name = podGvr, "Pod", podNamespace, podName
+		if podUid, ok := alert.OutputFields["k8s.pod.uid"].(string); ok && podUid != "<NA>" {
+			uid = types.UID(podUid)
+		}
+	}
+
+	if name == "" {
+		return utilobject.Rich{}, "", false
+	}
+
+	return utilobject.Rich{
+		VersionedKey: utilobject.VersionedKey{
+			Key: utilobject.Key{
+				Cluster:   cluster,
+				Group:     gvr.Group,
+				Resource:  gvr.Resource,
+				Namespace: namespace,
+				Name:      name,
+			},
+			Version: gvr.Version,
+		},
+		Uid: uid,
+	}, kind, true
+}
+
+func (recv *receiver) handleRequest(ctx *gin.Context) {
+	logger := recv.Logger.WithField("source", ctx.Request.RemoteAddr)
+	defer shutdown.RecoverPanic(logger)
+
+	metric := &alertMetric{}
+	defer recv.AlertMetric.DeferCount(recv.Clock.Now(), metric)
+
+	if err := recv.handle(ctx, logger, metric); err != nil {
+		logger.WithError(err).Error()
+		metric.Error = err
+		ctx.Status(http.StatusBadRequest)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func (recv *receiver) handle(ctx *gin.Context, logger logrus.FieldLogger, metric *alertMetric) metrics.LabeledError {
+	cluster := ctx.Param("cluster")
+	if cluster == "" {
+		cluster = recv.ClusterNameResolver.Resolve(ctx.ClientIP())
+	}
+	metric.Cluster = cluster
+
+	alert := &Alert{}
+	if err := ctx.BindJSON(alert); err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot decode alert: %w", err), "Decode")
+	}
+
+	priority, err := ParsePriority(alert.Priority)
+	if err != nil {
+		return metrics.LabelError(err, "UnknownPriority")
+	}
+	metric.Priority = priority.String()
+
+	if priority > recv.minPriority {
+		return nil
+	}
+
+	object, kind, ok := ObjectFromAlert(cluster, alert)
+	if !ok {
+		return metrics.MakeLabeledError("NoObject")
+	}
+	metric.Resource = object.Resource
+
+	if !recv.Filter.TestGvk(cluster, object.GroupVersion().WithKind(kind)) {
+		return nil
+	}
+
+	eventTime := alert.Time
+	if eventTime.IsZero() {
+		eventTime = recv.Clock.Now()
+	}
+
+	event := aggregatorevent.NewEvent(alert.Rule, eventTime, zconstants.TraceSourceFalco).
+		SetTag("priority", priority.String()).
+		SetTag("source", alert.Source).
+		SetTag("hostname", alert.Hostname).
+		SetTag("tag", alert.Rule).
+		Log(zconstants.LogTypeFalcoOutput, alert.Output)
+
+	if len(alert.Tags) > 0 {
+		event = event.SetTag("falcoTags", strings.Join(alert.Tags, ","))
+	}
+
+	for _, field := range []string{"container.id", "container.name", "proc.cmdline", "user.name"} {
+		if value, exists := alert.OutputFields[field]; exists {
+			event = event.SetTag(field, value)
+		}
+	}
+
+	if err := recv.Aggregator.Send(ctx, object, event); err != nil {
+		return metrics.LabelError(fmt.Errorf("cannot send trace: %w", err), "SendTrace")
+	}
+
+	logger.WithFields(object.AsFields("object")).Debug("Send")
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package falco_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/falco"
+)
+
+func TestObjectFromAlert(t *testing.T) {
+	assert := assert.New(t)
+
+	object, kind, ok := falco.ObjectFromAlert("c1", &falco.Alert{
+		Hostname: "node-1",
+		OutputFields: map[string]any{
+			"k8s.pod.name": "web-0",
+			"k8s.ns.name":  "default",
+		},
+	})
+	assert.True(ok)
+	assert.Equal("Pod", kind)
+	assert.Equal("pods", object.Resource)
+	assert.Equal("default", object.Namespace)
+	assert.Equal("web-0", object.Name)
+
+	object, kind, ok = falco.ObjectFromAlert("c1", &falco.Alert{
+		Hostname: "node-1",
+		OutputFields: map[string]any{
+			"k8s.pod.name": "<NA>",
+		},
+	})
+	assert.True(ok)
+	assert.Equal("Node", kind)
+	assert.Equal("nodes", object.Resource)
+	assert.Equal("node-1", object.Name)
+
+	_, _, ok = falco.ObjectFromAlert("c1", &falco.Alert{})
+	assert.False(ok)
+}
+
+func TestParsePriority(t *testing.T) {
+	assert := assert.New(t)
+
+	warning, err := falco.ParsePriority("Warning")
+	assert.NoError(err)
+	notice, err := falco.ParsePriority("notice")
+	assert.NoError(err)
+	assert.Less(warning, notice)
+
+	info, err := falco.ParsePriority("info")
+	assert.NoError(err)
+	assert.Equal("informational", info.String())
+
+	_, err = falco.ParsePriority("bogus")
+	assert.Error(err)
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links objects propagated to member clusters by a federation control plane
+// to the binding objects in the host cluster that they were propagated from.
+package federationlinker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("federation-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	enable       bool
+	hostClusters map[string]string
+	providers    []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "federation-linker-enable", false, "enable linker for objects propagated by federation control planes")
+	fs.StringToStringVar(
+		&options.hostClusters,
+		"federation-linker-host-cluster",
+		map[string]string{},
+		"host cluster of each member cluster, e.g. 'member1=host,member2=host'; '*' matches all other clusters",
+	)
+	fs.StringSliceVar(
+		&options.providers,
+		"federation-linker-providers",
+		[]string{"karmada", "clusternet"},
+		"federation control planes whose propagation metadata are recognized, any of "+fmt.Sprint(ProviderNames()),
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options     options
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+
+	providers []Provider
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+func (ctrl *controller) Init() error {
+	for _, name := range ctrl.options.providers {
+		provider, exists := providers[name]
+		if !exists {
+			return fmt.Errorf("unknown federation provider %q", name)
+		}
+		ctrl.providers = append(ctrl.providers, provider)
+	}
+
+	return nil
+}
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) hostCluster(member string) (string, bool) {
+	if host, exists := ctrl.options.hostClusters[member]; exists {
+		return host, host != member
+	}
+
+	if host, exists := ctrl.options.hostClusters["*"]; exists {
+		return host, host != member
+	}
+
+	return "", false
+}
+
+func (ctrl *controller) LinkerName() string { return "federation-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	host, isMember := ctrl.hostCluster(object.Cluster)
+	if !isMember {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	for _, provider := range ctrl.providers {
+		binding, found := provider.Resolve(raw)
+		if !found {
+			continue
+		}
+
+		bindingRef := utilobject.NewRich(host, binding.GroupVersionResource, binding.Namespace, binding.Name, "")
+		logger.WithFields(bindingRef.AsFields("binding")).WithField("provider", provider.Name).Debug("Resolved federation binding")
+
+		return []linker.LinkerResult{{
+			Object:  bindingRef,
+			Role:    zconstants.LinkRoleParent,
+			Class:   "federation",
+			DedupId: "federation",
+		}}, nil
+	}
+
+	return nil, nil
+}
+
+// Binding identifies the host cluster object that a member cluster object was propagated from.
+type Binding struct {
+	schema.GroupVersionResource
+	Namespace string
+	Name      string
+}
+
+// Provider recognizes the propagation metadata written by a federation control plane.
+type Provider struct {
+	Name    string
+	Resolve func(raw *unstructured.Unstructured) (Binding, bool)
+}
+
+var providers = map[string]Provider{}
+
+func registerProvider(provider Provider) { providers[provider.Name] = provider }
+
+// ProviderNames returns the names of all recognized federation providers.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveByMetadata resolves a binding whose name and namespace are stored in a pair of labels or annotations.
+func resolveByMetadata(
+	raw *unstructured.Unstructured,
+	gvr schema.GroupVersionResource,
+	nameKey, namespaceKey string,
+) (Binding, bool) {
+	for _, metadata := range []map[string]string{raw.GetAnnotations(), raw.GetLabels()} {
+		name, hasName := metadata[nameKey]
+		if !hasName || name == "" {
+			continue
+		}
+
+		binding := Binding{GroupVersionResource: gvr, Name: name}
+		if namespaceKey != "" {
+			binding.Namespace = metadata[namespaceKey]
+		}
+		return binding, true
+	}
+
+	return Binding{}, false
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federationlinker
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func init() {
+	registerProvider(Provider{Name: "karmada", Resolve: resolveKarmada})
+	registerProvider(Provider{Name: "clusternet", Resolve: resolveClusternet})
+}
+
+var (
+	karmadaResourceBinding = schema.GroupVersionResource{
+		Group:    "work.karmada.io",
+		Version:  "v1alpha2",
+		Resource: "resourcebindings",
+	}
+	karmadaClusterResourceBinding = schema.GroupVersionResource{
+		Group:    "work.karmada.io",
+		Version:  "v1alpha2",
+		Resource: "clusterresourcebindings",
+	}
+	clusternetSubscription = schema.GroupVersionResource{
+		Group:    "apps.clusternet.io",
+		Version:  "v1alpha1",
+		Resource: "subscriptions",
+	}
+)
+
+// Karmada execution controller annotates (labels in older versions) propagated objects
+// with the ResourceBinding or ClusterResourceBinding that scheduled them.
+func resolveKarmada(raw *unstructured.Unstructured) (Binding, bool) {
+	if binding, ok := resolveByMetadata(
+		raw,
+		karmadaResourceBinding,
+		"resourcebinding.karmada.io/name",
+		"resourcebinding.karmada.io/namespace",
+	); ok {
+		return binding, true
+	}
+
+	return resolveByMetadata(raw, karmadaClusterResourceBinding, "clusterresourcebinding.karmada.io/name", "")
+}
+
+// Clusternet agents label deployed objects with the Subscription they were deployed from.
+func resolveClusternet(raw *unstructured.Unstructured) (Binding, bool) {
+	return resolveByMetadata(
+		raw,
+		clusternetSubscription,
+		"apps.clusternet.io/subs.name",
+		"apps.clusternet.io/subs.namespace",
+	)
+}
@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -57,11 +58,27 @@ type Filter interface {
 }
 
 type options struct {
+	rules ruleOptions
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	options.rules.Setup(fs)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	_, err := parseRules(&options.rules)
+	return err
+}
+
+// ruleOptions are the options that can be reloaded at runtime.
+type ruleOptions struct {
 	excludedTypes      []string
 	excludedUserAgents []string
 }
 
-func (options *options) Setup(fs *pflag.FlagSet) {
+func (options *ruleOptions) Setup(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&options.excludedTypes, "filter-exclude-types", []string{
 		"events",
 		"events.k8s.io/events",
@@ -73,17 +90,15 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 	}, "requests from user agents with any of these substrings are not traced")
 }
 
-func (options *options) EnableFlag() *bool { return nil }
-
 type filter struct {
 	options   options
 	Logger    logrus.FieldLogger
 	Discovery discovery.DiscoveryCache
 	Clients   k8s.Clients
 
-	excludeTypeHashTable map[schema.GroupResource]struct{}
-	configMapInformer    informers.SharedInformerFactory
-	recorder             record.EventRecorder
+	rules             atomic.Pointer[rules]
+	configMapInformer informers.SharedInformerFactory
+	recorder          record.EventRecorder
 
 	configMutex sync.RWMutex
 	config      *config
@@ -93,16 +108,15 @@ type config struct {
 	excludeRegex *regexp.Regexp
 }
 
-var _ = func() manager.Component { return &filter{} }
-
-func (filter *filter) Options() manager.Options {
-	return &filter.options
+type rules struct {
+	excludeTypeHashTable map[schema.GroupResource]struct{}
+	excludedUserAgents   []string
 }
 
-func (filter *filter) Init() error {
-	filter.excludeTypeHashTable = make(map[schema.GroupResource]struct{}, len(filter.options.excludedTypes))
+func parseRules(options *ruleOptions) (*rules, error) {
+	excludeTypeHashTable := make(map[schema.GroupResource]struct{}, len(options.excludedTypes))
 
-	for _, ty := range filter.options.excludedTypes {
+	for _, ty := range options.excludedTypes {
 		split := strings.Split(ty, "/")
 		var parsed schema.GroupResource
 		switch len(split) {
@@ -112,19 +126,41 @@ func (filter *filter) Init() error {
 			parsed.Group = split[0]
 			parsed.Resource = split[1]
 		default:
-			return fmt.Errorf("cannot parse %q as a GVR", ty)
+			return nil, fmt.Errorf("invalid --filter-exclude-types: cannot parse %q as a GVR", ty)
 		}
 
-		filter.excludeTypeHashTable[parsed] = struct{}{}
+		excludeTypeHashTable[parsed] = struct{}{}
 	}
 
+	return &rules{
+		excludeTypeHashTable: excludeTypeHashTable,
+		excludedUserAgents:   options.excludedUserAgents,
+	}, nil
+}
+
+var (
+	_ = func() manager.Component { return &filter{} }
+	_ = func() manager.Reloadable { return &filter{} }
+)
+
+func (filter *filter) Options() manager.Options {
+	return &filter.options
+}
+
+func (filter *filter) Init() error {
+	rules, err := parseRules(&filter.options.rules)
+	if err != nil {
+		return err
+	}
+	filter.rules.Store(rules)
+
 	filter.configMapInformer = filter.Clients.TargetCluster().NewInformerFactory(
 		informers.WithNamespace(configMapNamespace),
 		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
 			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", configMapName).String()
 		}),
 	)
-	_, err := filter.configMapInformer.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+	_, err = filter.configMapInformer.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc:    func(obj any) { filter.setConfig(obj.(*corev1.ConfigMap)) },
 		UpdateFunc: func(oldObj, newObj any) { filter.setConfig(newObj.(*corev1.ConfigMap)) },
 		DeleteFunc: func(obj any) { filter.setConfig(nil) },
@@ -146,6 +182,18 @@ func (filter *filter) Start(ctx context.Context) error {
 
 func (filter *filter) Close(ctx context.Context) error { return nil }
 
+func (filter *filter) ReloadOptions() manager.ReloadOptions { return &ruleOptions{} }
+
+func (filter *filter) Reload(options manager.ReloadOptions) error {
+	rules, err := parseRules(options.(*ruleOptions))
+	if err != nil {
+		return err
+	}
+
+	filter.rules.Store(rules)
+	return nil
+}
+
 func (filter *filter) setConfig(cm *corev1.ConfigMap) {
 	var c *config
 	if cm != nil {
@@ -202,7 +250,7 @@ func (filter *filter) TestGvk(cluster string, gvk schema.GroupVersionKind) bool
 
 func (filter *filter) TestGvr(gvr schema.GroupVersionResource) bool {
 	ty := gvr.GroupResource()
-	if _, exists := filter.excludeTypeHashTable[ty]; exists {
+	if _, exists := filter.rules.Load().excludeTypeHashTable[ty]; exists {
 		return false
 	}
 
@@ -235,7 +283,7 @@ func (filter *filter) TestAuditEvent(event *auditv1.Event) bool {
 		}
 	}
 
-	for _, banned := range filter.options.excludedUserAgents {
+	for _, banned := range filter.rules.Load().excludedUserAgents {
 		if strings.Contains(event.UserAgent, banned) {
 			return false
 		}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badgerbackend
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	jaegerstorage "github.com/kubewharf/kelemetry/pkg/frontend/backend/jaeger-storage"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilbadger "github.com/kubewharf/kelemetry/pkg/util/badger"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("jaeger-backend/badger", manager.Ptr(&Backend{}), jaegerbackend.Backend.List)
+}
+
+// Backend queries spans from the embedded badger store written by the badger tracer.
+type Backend struct {
+	manager.MuxImplBase
+	Logger logrus.FieldLogger
+	Store  utilbadger.Store
+}
+
+var _ jaegerbackend.Backend = &Backend{}
+
+func (backend *Backend) MuxImplName() (name string, isDefault bool) { return "badger", false }
+
+func (backend *Backend) Options() manager.Options { return &manager.NoOptions{} }
+
+func (backend *Backend) Init() error                     { return nil }
+func (backend *Backend) Start(ctx context.Context) error { return nil }
+func (backend *Backend) Close(ctx context.Context) error { return nil }
+
+func (backend *Backend) List(
+	ctx context.Context,
+	params *spanstore.TraceQueryParameters,
+) ([]*jaegerbackend.TraceThumbnail, error) {
+	return jaegerstorage.ListFromReader(ctx, backend.Store.SpanReader(), params)
+}
+
+func (backend *Backend) Get(
+	ctx context.Context,
+	identifierJson json.RawMessage,
+	traceId model.TraceID,
+	startTime, endTime time.Time,
+) (*model.Trace, error) {
+	return jaegerstorage.GetFromReader(ctx, backend.Logger, backend.Store.SpanReader(), identifierJson)
+}
@@ -0,0 +1,371 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhousebackend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+	utilclickhouse "github.com/kubewharf/kelemetry/pkg/util/clickhouse"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideMuxImpl("jaeger-backend/clickhouse", manager.Ptr(&Backend{}), jaegerbackend.Backend.List)
+}
+
+type options struct {
+	config        utilclickhouse.Config
+	defaultLimit  int
+	maxTraceSpans int
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	options.config.SetupOptions(fs, "jaeger-backend-clickhouse", "trace queries")
+	fs.IntVar(&options.defaultLimit, "jaeger-backend-clickhouse-default-limit", 20, "number of traces returned if the query does not specify a limit")
+	fs.IntVar(&options.maxTraceSpans, "jaeger-backend-clickhouse-max-trace-spans", 100000, "maximum number of spans fetched for each query")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Backend struct {
+	manager.MuxImplBase
+
+	options options
+	Logger  logrus.FieldLogger
+	Secrets *secret.Store
+
+	client *utilclickhouse.Client
+}
+
+type identifier struct {
+	TraceId string `json:"traceId"`
+	SpanId  string `json:"spanId"`
+}
+
+var _ jaegerbackend.Backend = &Backend{}
+
+func (backend *Backend) MuxImplName() (name string, isDefault bool) { return "clickhouse", false }
+
+func (backend *Backend) Options() manager.Options { return &backend.options }
+
+func (backend *Backend) Init() error {
+	client, err := utilclickhouse.NewClient(backend.options.config, backend.Secrets)
+	if err != nil {
+		return err
+	}
+	backend.client = client
+	return nil
+}
+
+func (backend *Backend) Start(ctx context.Context) error { return nil }
+func (backend *Backend) Close(ctx context.Context) error { return nil }
+
+func (backend *Backend) List(
+	ctx context.Context,
+	params *spanstore.TraceQueryParameters,
+) ([]*jaegerbackend.TraceThumbnail, error) {
+	var traceSources []string
+	if ctx.Value(jaegerreader.WantPseudoSpansOnly{}) != nil {
+		traceSources = zconstants.KnownPseudoTraceSources()
+	} else {
+		traceSources = zconstants.KnownNonPseudoTraceSources()
+	}
+
+	limit := params.NumTraces
+	if limit == 0 {
+		limit = backend.options.defaultLimit
+	}
+
+	query, queryParams := BuildFindTraceIds(backend.options.config.QualifiedTable(), traceSources, params, limit)
+
+	traceIds := []string{}
+	if err := backend.client.Select(ctx, query, queryParams, func(line []byte) error {
+		var row struct {
+			TraceId string `json:"trace_id"`
+		}
+		if err := json.Unmarshal(line, &row); err != nil {
+			return err
+		}
+		traceIds = append(traceIds, row.TraceId)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("find traces from clickhouse: %w", err)
+	}
+
+	if len(traceIds) == 0 {
+		return []*jaegerbackend.TraceThumbnail{}, nil
+	}
+
+	traces, err := backend.fetchSpans(ctx, traceIds)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails := make([]*jaegerbackend.TraceThumbnail, 0, len(traceIds))
+	for _, traceId := range traceIds {
+		spans := traces[traceId]
+		if len(spans) == 0 {
+			continue
+		}
+
+		tree := tftree.NewSpanTree(spans)
+		thumbnails = append(thumbnails, &jaegerbackend.TraceThumbnail{
+			Identifier: identifier{
+				TraceId: traceId,
+				SpanId:  tree.Root.SpanID.String(),
+			},
+			Spans: tree,
+		})
+	}
+
+	return thumbnails, nil
+}
+
+func (backend *Backend) Get(
+	ctx context.Context,
+	identifierJson json.RawMessage,
+	traceId model.TraceID,
+	startTime, endTime time.Time,
+) (*model.Trace, error) {
+	var ident identifier
+	if err := json.Unmarshal(identifierJson, &ident); err != nil {
+		return nil, fmt.Errorf("persisted invalid trace identifier: %w", err)
+	}
+
+	traces, err := backend.fetchSpans(ctx, []string{ident.TraceId})
+	if err != nil {
+		return nil, err
+	}
+
+	spans := traces[ident.TraceId]
+	if len(spans) == 0 {
+		return nil, fmt.Errorf("clickhouse backend returned empty trace")
+	}
+
+	rootId, err := model.SpanIDFromString(ident.SpanId)
+	if err != nil {
+		return nil, fmt.Errorf("persisted invalid span ID: %w", err)
+	}
+
+	tree := tftree.NewSpanTree(spans)
+	if err := tree.SetRoot(rootId); err != nil {
+		if errors.Is(err, tftree.ErrRootDoesNotExist) {
+			return nil, fmt.Errorf("cached span does not exist in refreshed trace result: %w", err)
+		}
+
+		return nil, fmt.Errorf("error calling SetRoot: %w", err)
+	}
+
+	trace := &model.Trace{Spans: tree.GetSpans()}
+	backend.Logger.WithField("filteredSpans", len(trace.Spans)).Debug("fetched trace")
+
+	return trace, nil
+}
+
+func (backend *Backend) fetchSpans(ctx context.Context, traceIds []string) (map[string][]*model.Span, error) {
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE trace_id IN {traceIds:Array(String)} LIMIT %d",
+		utilclickhouse.SelectColumns, backend.options.config.QualifiedTable(), backend.options.maxTraceSpans,
+	)
+
+	traces := map[string][]*model.Span{}
+	if err := backend.client.Select(ctx, query, map[string]string{"traceIds": FormatArray(traceIds)}, func(line []byte) error {
+		var row utilclickhouse.SpanRow
+		if err := json.Unmarshal(line, &row); err != nil {
+			return err
+		}
+
+		span, err := ToJaegerSpan(row)
+		if err != nil {
+			return err
+		}
+
+		traces[row.TraceId] = append(traces[row.TraceId], span)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("fetch spans from clickhouse: %w", err)
+	}
+
+	return traces, nil
+}
+
+// BuildFindTraceIds returns the query and parameters that select the IDs of traces matching the query parameters,
+// most recent traces first.
+func BuildFindTraceIds(
+	table string,
+	traceSources []string,
+	params *spanstore.TraceQueryParameters,
+	limit int,
+) (string, map[string]string) {
+	conditions := []string{"service IN {services:Array(String)}"}
+	queryParams := map[string]string{"services": FormatArray(traceSources)}
+
+	if !params.StartTimeMin.IsZero() {
+		conditions = append(conditions, "start_time >= fromUnixTimestamp64Micro({startTimeMin:Int64})")
+		queryParams["startTimeMin"] = strconv.FormatInt(params.StartTimeMin.UnixMicro(), 10)
+	}
+	if !params.StartTimeMax.IsZero() {
+		conditions = append(conditions, "start_time <= fromUnixTimestamp64Micro({startTimeMax:Int64})")
+		queryParams["startTimeMax"] = strconv.FormatInt(params.StartTimeMax.UnixMicro(), 10)
+	}
+	if params.DurationMin != 0 {
+		conditions = append(conditions, "duration_us >= {durationMin:UInt64}")
+		queryParams["durationMin"] = strconv.FormatInt(params.DurationMin.Microseconds(), 10)
+	}
+	if params.DurationMax != 0 {
+		conditions = append(conditions, "duration_us <= {durationMax:UInt64}")
+		queryParams["durationMax"] = strconv.FormatInt(params.DurationMax.Microseconds(), 10)
+	}
+
+	tagKeys := make([]string, 0, len(params.Tags))
+	for key := range params.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	for i, key := range tagKeys {
+		valueParam := fmt.Sprintf("tagValue%d", i)
+		queryParams[valueParam] = params.Tags[key]
+
+		if column, isKey := utilclickhouse.KeyTagColumns[key]; isKey {
+			conditions = append(conditions, fmt.Sprintf("%s = {%s:String}", column, valueParam))
+		} else {
+			keyParam := fmt.Sprintf("tagKey%d", i)
+			queryParams[keyParam] = key
+			conditions = append(conditions, fmt.Sprintf("tags[{%s:String}] = {%s:String}", keyParam, valueParam))
+		}
+	}
+
+	query := fmt.Sprintf(
+		"SELECT trace_id FROM %s WHERE %s GROUP BY trace_id ORDER BY max(start_time) DESC LIMIT %d",
+		table, strings.Join(conditions, " AND "), limit,
+	)
+	return query, queryParams
+}
+
+// FormatArray formats a string array as a ClickHouse query parameter value.
+func FormatArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+	}
+
+	return "[" + strings.Join(quoted, ",") + "]"
+}
+
+// ToJaegerSpan converts a table row to a Jaeger span.
+func ToJaegerSpan(row utilclickhouse.SpanRow) (*model.Span, error) {
+	traceId, err := model.TraceIDFromString(row.TraceId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace ID %q: %w", row.TraceId, err)
+	}
+	spanId, err := model.SpanIDFromString(row.SpanId)
+	if err != nil {
+		return nil, fmt.Errorf("invalid span ID %q: %w", row.SpanId, err)
+	}
+
+	references := []model.SpanRef{}
+	if row.ParentSpanId != "" {
+		parentId, err := model.SpanIDFromString(row.ParentSpanId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent span ID %q: %w", row.ParentSpanId, err)
+		}
+		references = append(references, model.NewChildOfRef(traceId, parentId))
+	}
+
+	var links []utilclickhouse.Reference
+	if err := json.Unmarshal([]byte(row.References), &links); err != nil {
+		return nil, fmt.Errorf("invalid references: %w", err)
+	}
+	for _, link := range links {
+		linkTraceId, err := model.TraceIDFromString(link.TraceId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid referenced trace ID %q: %w", link.TraceId, err)
+		}
+		linkSpanId, err := model.SpanIDFromString(link.SpanId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid referenced span ID %q: %w", link.SpanId, err)
+		}
+		references = append(references, model.NewFollowsFromRef(linkTraceId, linkSpanId))
+	}
+
+	startTime := time.UnixMicro(row.StartTimeUs)
+
+	tags := make([]model.KeyValue, 0, len(row.Tags)+len(utilclickhouse.KeyTagColumns))
+	if row.Cluster != "" {
+		tags = append(tags,
+			model.String("cluster", row.Cluster),
+			model.String("group", row.Group),
+			model.String("resource", row.Resource),
+			model.String("namespace", row.Namespace),
+			model.String("name", row.Name),
+		)
+	}
+	tagKeys := make([]string, 0, len(row.Tags))
+	for key := range row.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		tags = append(tags, model.String(key, row.Tags[key]))
+	}
+
+	var rowLogs []utilclickhouse.Log
+	if err := json.Unmarshal([]byte(row.Logs), &rowLogs); err != nil {
+		return nil, fmt.Errorf("invalid logs: %w", err)
+	}
+	logs := make([]model.Log, 0, len(rowLogs))
+	for _, log := range rowLogs {
+		fields := []model.KeyValue{model.String("event", log.Message)}
+		fieldKeys := make([]string, 0, len(log.Fields))
+		for key := range log.Fields {
+			fieldKeys = append(fieldKeys, key)
+		}
+		sort.Strings(fieldKeys)
+		for _, key := range fieldKeys {
+			fields = append(fields, model.String(key, log.Fields[key]))
+		}
+		logs = append(logs, model.Log{Timestamp: startTime, Fields: fields})
+	}
+
+	return &model.Span{
+		TraceID:       traceId,
+		SpanID:        spanId,
+		OperationName: row.Operation,
+		References:    references,
+		StartTime:     startTime,
+		Duration:      time.Duration(row.DurationUs) * time.Microsecond,
+		Tags:          tags,
+		Logs:          logs,
+		Process:       &model.Process{ServiceName: row.Service},
+	}, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhousebackend_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/tracer"
+	clickhousetracer "github.com/kubewharf/kelemetry/pkg/aggregator/tracer/clickhouse"
+	clickhousebackend "github.com/kubewharf/kelemetry/pkg/frontend/backend/clickhouse"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func sequentialIds() func(length int) string {
+	next := 0
+	return func(length int) string {
+		next++
+		return fmt.Sprintf("%0*x", length*2, next)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	newId := sequentialIds()
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	objectRow, objectContext, err := clickhousetracer.ToRow(tracer.Span{
+		Type:       "object",
+		Name:       "pods/web-1",
+		StartTime:  start,
+		FinishTime: start.Add(time.Minute),
+		Tags: map[string]string{
+			"cluster": "tracetest", "group": "", "resource": "pods", "namespace": "default", "name": "web-1",
+			"pseudoType": "object",
+		},
+	}, newId)
+	assert.NoError(err)
+	assert.Empty(objectRow.ParentSpanId)
+	assert.Equal("tracetest", objectRow.Cluster)
+	assert.NotContains(objectRow.Tags, "cluster")
+
+	auditRow, _, err := clickhousetracer.ToRow(tracer.Span{
+		Type:       "audit",
+		Name:       "admin update",
+		StartTime:  start.Add(time.Second),
+		FinishTime: start.Add(time.Second * 2),
+		Parent:     objectContext,
+		Tags:       map[string]string{"cluster": "tracetest", "resource": "pods", "name": "web-1", "tag": "update"},
+		Logs:       []tracer.Log{{Type: zconstants.LogTypeRealError, Message: "denied", Attrs: [][2]string{{"reason", "quota"}}}},
+	}, newId)
+	assert.NoError(err)
+	assert.Equal(objectRow.TraceId, auditRow.TraceId)
+	assert.Equal(objectRow.SpanId, auditRow.ParentSpanId)
+
+	// fields converted by clickhouse when selecting
+	auditRow.StartTimeUs = start.Add(time.Second).UnixMicro()
+
+	span, err := clickhousebackend.ToJaegerSpan(auditRow)
+	assert.NoError(err)
+	assert.Equal("admin update", span.OperationName)
+	assert.Equal("audit", span.Process.ServiceName)
+	assert.Equal(time.Second, span.Duration)
+	assert.Len(span.References, 1)
+	assert.Equal(model.ChildOf, span.References[0].RefType)
+	assert.Equal(objectRow.SpanId, span.References[0].SpanID.String())
+
+	cluster, _ := model.KeyValues(span.Tags).FindByKey("cluster")
+	assert.Equal("tracetest", cluster.VStr)
+	tag, _ := model.KeyValues(span.Tags).FindByKey("tag")
+	assert.Equal("update", tag.VStr)
+
+	assert.Len(span.Logs, 1)
+	message, _ := model.KeyValues(span.Logs[0].Fields).FindByKey("event")
+	assert.Equal("denied", message.VStr)
+	logType, _ := model.KeyValues(span.Logs[0].Fields).FindByKey(zconstants.LogTypeAttr)
+	assert.Equal(string(zconstants.LogTypeRealError), logType.VStr)
+}
+
+func TestBuildFindTraceIds(t *testing.T) {
+	assert := assert.New(t)
+
+	query, params := clickhousebackend.BuildFindTraceIds("`kelemetry`.`spans`", []string{"object"}, &spanstore.TraceQueryParameters{
+		Tags:         map[string]string{"cluster": "tracetest", "name": "web-1", "username": "admin"},
+		StartTimeMin: time.UnixMicro(100),
+	}, 20)
+
+	assert.Equal(
+		"SELECT trace_id FROM `kelemetry`.`spans` WHERE service IN {services:Array(String)} "+
+			"AND start_time >= fromUnixTimestamp64Micro({startTimeMin:Int64}) "+
+			"AND cluster = {tagValue0:String} AND name = {tagValue1:String} AND tags[{tagKey2:String}] = {tagValue2:String} "+
+			"GROUP BY trace_id ORDER BY max(start_time) DESC LIMIT 20",
+		query,
+	)
+	assert.Equal(map[string]string{
+		"services":     "['object']",
+		"startTimeMin": "100",
+		"tagValue0":    "tracetest",
+		"tagValue1":    "web-1",
+		"tagKey2":      "username",
+		"tagValue2":    "admin",
+	}, params)
+
+	assert.Equal(`['a\'b','c\\d']`, clickhousebackend.FormatArray([]string{"a'b", `c\d`}))
+}
@@ -151,6 +151,15 @@ func (backend *Backend) Close(ctx context.Context) error { return nil }
 func (backend *Backend) List(
 	ctx context.Context,
 	params *spanstore.TraceQueryParameters,
+) ([]*jaegerbackend.TraceThumbnail, error) {
+	return ListFromReader(ctx, backend.reader, params)
+}
+
+// ListFromReader lists traces from a Jaeger span reader, querying each known trace source as a service.
+func ListFromReader(
+	ctx context.Context,
+	reader spanstore.Reader,
+	params *spanstore.TraceQueryParameters,
 ) ([]*jaegerbackend.TraceThumbnail, error) {
 	traceThumbnails := []*jaegerbackend.TraceThumbnail{}
 
@@ -178,7 +187,7 @@ func (backend *Backend) List(
 			newParams.NumTraces = params.NumTraces - len(traceThumbnails)
 		}
 
-		traces, err := backend.reader.FindTraces(ctx, newParams)
+		traces, err := reader.FindTraces(ctx, newParams)
 		if err != nil {
 			return nil, fmt.Errorf("find traces from backend err: %w", err)
 		}
@@ -210,13 +219,23 @@ func (backend *Backend) Get(
 	identifierJson json.RawMessage,
 	traceId model.TraceID,
 	startTime, endTime time.Time,
+) (*model.Trace, error) {
+	return GetFromReader(ctx, backend.Logger, backend.reader, identifierJson)
+}
+
+// GetFromReader fetches the trace identified by an identifier returned from ListFromReader.
+func GetFromReader(
+	ctx context.Context,
+	logger logrus.FieldLogger,
+	reader spanstore.Reader,
+	identifierJson json.RawMessage,
 ) (*model.Trace, error) {
 	var ident identifier
 	if err := json.Unmarshal(identifierJson, &ident); err != nil {
 		return nil, fmt.Errorf("persisted invalid trace identifier: %w", err)
 	}
 
-	trace, err := backend.reader.GetTrace(ctx, ident.TraceId)
+	trace, err := reader.GetTrace(ctx, ident.TraceId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get trace from backend: %w", err)
 	}
@@ -235,7 +254,7 @@ func (backend *Backend) Get(
 	}
 
 	trace.Spans = tree.GetSpans()
-	backend.Logger.WithField("filteredSpans", len(trace.Spans)).Debug("fetched trace")
+	logger.WithField("filteredSpans", len(trace.Spans)).Debug("fetched trace")
 
 	return trace, nil
 }
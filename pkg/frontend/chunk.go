@@ -0,0 +1,91 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/jaegertracing/jaeger/proto-gen/storage_v1"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkingHandler is the Jaeger storage plugin handler with GetTrace responses split by size,
+// since the default handler splits them by span count only,
+// which exceeds the gRPC message size limit of Jaeger query for traces with large spans.
+type chunkingHandler struct {
+	*shared.GRPCHandler
+	plugin *Plugin
+}
+
+func (handler *chunkingHandler) register(server *grpc.Server) {
+	storage_v1.RegisterSpanReaderPluginServer(server, handler)
+	storage_v1.RegisterSpanWriterPluginServer(server, handler)
+	storage_v1.RegisterArchiveSpanReaderPluginServer(server, handler)
+	storage_v1.RegisterArchiveSpanWriterPluginServer(server, handler)
+	storage_v1.RegisterPluginCapabilitiesServer(server, handler)
+	storage_v1.RegisterDependenciesReaderPluginServer(server, handler)
+	storage_v1.RegisterStreamingSpanWriterPluginServer(server, handler)
+}
+
+func (handler *chunkingHandler) GetTrace(request *storage_v1.GetTraceRequest, stream storage_v1.SpanReaderPlugin_GetTraceServer) error {
+	trace, err := handler.plugin.SpanReader_.GetTrace(stream.Context(), request.TraceID)
+	if errors.Is(err, spanstore.ErrTraceNotFound) {
+		return status.Errorf(codes.NotFound, spanstore.ErrTraceNotFound.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	return sendChunks(trace.Spans, handler.plugin.options.maxChunkBytes, handler.plugin.options.maxChunkSpans, stream.Send)
+}
+
+// sendChunks sends the spans in chunks of at most maxBytes bytes and maxSpans spans.
+// A span larger than maxBytes is sent in its own chunk.
+func sendChunks(spans []*model.Span, maxBytes int, maxSpans int, send func(*storage_v1.SpansResponseChunk) error) error {
+	chunk := make([]model.Span, 0, min(len(spans), maxSpans))
+	chunkBytes := 0
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		if err := send(&storage_v1.SpansResponseChunk{Spans: chunk}); err != nil {
+			return fmt.Errorf("cannot send span chunk: %w", err)
+		}
+		chunk = chunk[:0]
+		chunkBytes = 0
+		return nil
+	}
+
+	for _, span := range spans {
+		spanBytes := span.Size()
+		if len(chunk) >= maxSpans || len(chunk) > 0 && chunkBytes+spanBytes > maxBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		chunk = append(chunk, *span)
+		chunkBytes += spanBytes
+	}
+
+	return flush()
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package frontend
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/proto-gen/storage_v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendChunks(t *testing.T) {
+	assert := assert.New(t)
+
+	spans := []*model.Span{}
+	for i := 1; i <= 10; i++ {
+		spans = append(spans, &model.Span{SpanID: model.SpanID(i), OperationName: strings.Repeat("x", 100)})
+	}
+	// a span larger than the chunk size
+	spans[5].OperationName = strings.Repeat("x", 1000)
+
+	chunkSizes := []int{}
+	numSpans := 0
+	err := sendChunks(spans, 300, 2, func(chunk *storage_v1.SpansResponseChunk) error {
+		assert.LessOrEqual(len(chunk.Spans), 2)
+		for i, span := range chunk.Spans {
+			numSpans++
+			assert.Equal(model.SpanID(numSpans), span.SpanID)
+			if i > 0 {
+				assert.LessOrEqual(chunk.Size(), 300)
+			}
+		}
+		chunkSizes = append(chunkSizes, len(chunk.Spans))
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(10, numSpans)
+	assert.Equal([]int{2, 2, 1, 1, 2, 2}, chunkSizes)
+}
@@ -0,0 +1,339 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Compares two traces of the same object, e.g. a good and a bad rollout of a deployment,
+// to find the steps that became slower and the errors that newly appeared.
+//
+// Traces are compared after transformation, so the display mode must display events as spans (e.g. "tree").
+// Events are matched by the operation name and the object they belong to,
+// where generated name suffixes of the object are ignored so that objects of different rollouts
+// (e.g. "web-7d9c8f6b5c-x2k4z" and "web-5f6d7c8b9d-q8w7v") are matched.
+package compare
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// Status describes how a step changed from the baseline to the target.
+type Status string
+
+const (
+	StatusUnchanged Status = "unchanged"
+	StatusSlower    Status = "slower"
+	StatusFaster    Status = "faster"
+	StatusAdded     Status = "added"
+	StatusRemoved   Status = "removed"
+)
+
+// Tags set on the spans of the target trace by Annotate.
+const (
+	TagStatus           = "compare.status"
+	TagBaselineDuration = "compare.baselineDuration"
+	TagDurationDelta    = "compare.durationDelta"
+)
+
+type Options struct {
+	// A step is slower or faster if its duration changes by more than this ratio of the baseline duration...
+	Threshold float64
+	// ...and by more than this duration.
+	MinDelta time.Duration
+}
+
+var DefaultOptions = Options{Threshold: 0.2, MinDelta: time.Second}
+
+// Stats are the aggregated timings of the occurrences of a step in one trace.
+type Stats struct {
+	Count int `json:"count"`
+	// Offset of the first occurrence from the first event in the trace.
+	OffsetUs int64 `json:"offsetUs"`
+	// Total duration of all occurrences.
+	// For objects, the duration from the start of the first event to the end of the last event of the object.
+	DurationUs int64 `json:"durationUs"`
+	Errors     int   `json:"errors"`
+}
+
+type Step struct {
+	// Object is the resource and the name of the object without generated suffixes.
+	Object string `json:"object"`
+	// Operation is the name of the event, or empty for the aggregate of all events of the object.
+	Operation       string `json:"operation,omitempty"`
+	Baseline        *Stats `json:"baseline,omitempty"`
+	Target          *Stats `json:"target,omitempty"`
+	Status          Status `json:"status"`
+	DurationDeltaUs int64  `json:"durationDeltaUs"`
+	OffsetDeltaUs   int64  `json:"offsetDeltaUs"`
+	// NewError is true if the step has errors in the target but not in the baseline.
+	NewError bool `json:"newError"`
+}
+
+type Result struct {
+	BaselineDurationUs int64 `json:"baselineDurationUs"`
+	TargetDurationUs   int64 `json:"targetDurationUs"`
+	// Steps are sorted by the offset in the target trace, followed by removed steps.
+	Steps []Step `json:"steps"`
+}
+
+type stepKey struct {
+	object    string
+	operation string
+}
+
+// generatedSuffix matches the suffixes generated by controllers, such as pod template hashes and generateName suffixes,
+// which only contain the consonants and digits of the safe encoding alphabet of the apimachinery rand package.
+var generatedSuffix = regexp.MustCompile(`(-[bcdfghjklmnpqrstvwxz2456789]{5,10})+$`)
+
+func normalizeName(name string) string {
+	return generatedSuffix.ReplaceAllString(name, "")
+}
+
+// objectOf returns the normalized object identity if the span is an object span.
+func objectOf(span *model.Span) (string, bool) {
+	tags := model.KeyValues(span.Tags)
+	resource, hasResource := tags.FindByKey("resource")
+	name, hasName := tags.FindByKey("name")
+	if !hasResource || !hasName {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s/%s", resource.AsString(), normalizeName(name.AsString())), true
+}
+
+func isError(span *model.Span) bool {
+	for _, tag := range span.Tags {
+		switch tag.Key {
+		case "error":
+			if tag.VType == model.BoolType && tag.Bool() {
+				return true
+			}
+		case "responseCode":
+			if tag.VType == model.Int64Type && tag.Int64() >= 400 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type indexedTrace struct {
+	stats map[stepKey]*Stats
+	// the step key of each event span and object span
+	spanKeys map[model.SpanID]stepKey
+	duration time.Duration
+}
+
+func index(trace *model.Trace) indexedTrace {
+	spanMap := make(map[model.SpanID]*model.Span, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spanMap[span.SpanID] = span
+	}
+
+	// the object span that each span belongs to
+	var objectSpanOf func(span *model.Span) (*model.Span, string)
+	objectSpanOf = func(span *model.Span) (*model.Span, string) {
+		for depth := 0; span != nil && depth < len(spanMap); depth++ {
+			if object, isObject := objectOf(span); isObject {
+				return span, object
+			}
+			span = spanMap[span.ParentSpanID()]
+		}
+		return nil, ""
+	}
+
+	var origin, end time.Time
+	type event struct {
+		span   *model.Span
+		object *model.Span
+		key    stepKey
+	}
+	events := []event{}
+	for _, span := range trace.Spans {
+		if _, isObject := objectOf(span); isObject {
+			continue
+		}
+
+		objectSpan, object := objectSpanOf(span)
+		if objectSpan == nil {
+			continue
+		}
+
+		events = append(events, event{span: span, object: objectSpan, key: stepKey{object: object, operation: span.OperationName}})
+		if origin.IsZero() || span.StartTime.Before(origin) {
+			origin = span.StartTime
+		}
+		if spanEnd := span.StartTime.Add(span.Duration); spanEnd.After(end) {
+			end = spanEnd
+		}
+	}
+
+	indexed := indexedTrace{
+		stats:    map[stepKey]*Stats{},
+		spanKeys: map[model.SpanID]stepKey{},
+		duration: end.Sub(origin),
+	}
+
+	objectEnds := map[stepKey]time.Time{}
+	for _, event := range events {
+		offset := event.span.StartTime.Sub(origin).Microseconds()
+		objectKey := stepKey{object: event.key.object}
+
+		indexed.spanKeys[event.span.SpanID] = event.key
+		indexed.spanKeys[event.object.SpanID] = objectKey
+
+		for _, key := range []stepKey{event.key, objectKey} {
+			stats, exists := indexed.stats[key]
+			if !exists {
+				stats = &Stats{OffsetUs: offset}
+				indexed.stats[key] = stats
+			}
+
+			stats.Count++
+			if offset < stats.OffsetUs {
+				stats.OffsetUs = offset
+			}
+			if isError(event.span) {
+				stats.Errors++
+			}
+		}
+
+		indexed.stats[event.key].DurationUs += event.span.Duration.Microseconds()
+
+		if spanEnd := event.span.StartTime.Add(event.span.Duration); spanEnd.After(objectEnds[objectKey]) {
+			objectEnds[objectKey] = spanEnd
+		}
+	}
+
+	for key, objectEnd := range objectEnds {
+		stats := indexed.stats[key]
+		stats.DurationUs = objectEnd.Sub(origin).Microseconds() - stats.OffsetUs
+	}
+
+	return indexed
+}
+
+// Compare compares the target trace against the baseline trace.
+func Compare(baseline, target *model.Trace, options Options) *Result {
+	baselineIndex := index(baseline)
+	targetIndex := index(target)
+
+	result := &Result{
+		BaselineDurationUs: baselineIndex.duration.Microseconds(),
+		TargetDurationUs:   targetIndex.duration.Microseconds(),
+	}
+
+	keys := map[stepKey]struct{}{}
+	for key := range baselineIndex.stats {
+		keys[key] = struct{}{}
+	}
+	for key := range targetIndex.stats {
+		keys[key] = struct{}{}
+	}
+
+	for key := range keys {
+		result.Steps = append(result.Steps, compareStep(key, baselineIndex.stats[key], targetIndex.stats[key], options))
+	}
+
+	sort.Slice(result.Steps, func(i, j int) bool {
+		left, right := result.Steps[i], result.Steps[j]
+		if (left.Target == nil) != (right.Target == nil) {
+			return left.Target != nil
+		}
+		if left.Target != nil && left.Target.OffsetUs != right.Target.OffsetUs {
+			return left.Target.OffsetUs < right.Target.OffsetUs
+		}
+		if left.Object != right.Object {
+			return left.Object < right.Object
+		}
+		return left.Operation < right.Operation
+	})
+
+	return result
+}
+
+func compareStep(key stepKey, baseline, target *Stats, options Options) Step {
+	step := Step{
+		Object:    key.object,
+		Operation: key.operation,
+		Baseline:  baseline,
+		Target:    target,
+		Status:    StatusUnchanged,
+	}
+
+	switch {
+	case baseline == nil:
+		step.Status = StatusAdded
+		step.NewError = target.Errors > 0
+		return step
+	case target == nil:
+		step.Status = StatusRemoved
+		return step
+	}
+
+	step.DurationDeltaUs = target.DurationUs - baseline.DurationUs
+	step.OffsetDeltaUs = target.OffsetUs - baseline.OffsetUs
+	step.NewError = target.Errors > 0 && baseline.Errors == 0
+
+	delta := step.DurationDeltaUs
+	if delta < 0 {
+		delta = -delta
+	}
+	if float64(delta) > float64(baseline.DurationUs)*options.Threshold && delta > options.MinDelta.Microseconds() {
+		if step.DurationDeltaUs > 0 {
+			step.Status = StatusSlower
+		} else {
+			step.Status = StatusFaster
+		}
+	}
+
+	return step
+}
+
+// Annotate adds the comparison result to the spans of the target trace,
+// and adds warnings to the spans with new errors, so that the target trace can be displayed as the comparison view.
+func Annotate(target *model.Trace, result *Result) {
+	steps := make(map[stepKey]Step, len(result.Steps))
+	for _, step := range result.Steps {
+		steps[stepKey{object: step.Object, operation: step.Operation}] = step
+	}
+
+	spanKeys := index(target).spanKeys
+	for _, span := range target.Spans {
+		key, hasKey := spanKeys[span.SpanID]
+		if !hasKey {
+			continue
+		}
+		step := steps[key]
+
+		span.Tags = append(span.Tags, model.String(TagStatus, string(step.Status)))
+		if step.Baseline != nil {
+			span.Tags = append(span.Tags,
+				model.String(TagBaselineDuration, (time.Duration(step.Baseline.DurationUs)*time.Microsecond).String()),
+				model.String(TagDurationDelta, (time.Duration(step.DurationDeltaUs)*time.Microsecond).String()),
+			)
+		}
+
+		if step.NewError && isError(span) {
+			span.Warnings = append(span.Warnings, "error not present in the baseline")
+		}
+		if step.Status == StatusSlower && step.Operation != "" {
+			delta := time.Duration(step.DurationDeltaUs) * time.Microsecond
+			span.Warnings = append(span.Warnings, fmt.Sprintf("slower than the baseline by %v", delta))
+		}
+	}
+}
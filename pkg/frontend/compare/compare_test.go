@@ -0,0 +1,139 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compare_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/compare"
+)
+
+type testEvent struct {
+	object    int
+	operation string
+	offset    time.Duration
+	duration  time.Duration
+	tags      []model.KeyValue
+}
+
+// newTrace creates a trace with one span per object under the root object span, and events under the object spans.
+func newTrace(start time.Time, objectNames []string, events []testEvent) *model.Trace {
+	traceId := model.NewTraceID(1, 1)
+	spans := []*model.Span{}
+
+	for i, name := range objectNames {
+		span := &model.Span{
+			TraceID:   traceId,
+			SpanID:    model.SpanID(i + 1),
+			StartTime: start,
+			Duration:  time.Hour,
+			Tags:      []model.KeyValue{model.String("resource", "pods"), model.String("name", name)},
+		}
+		if i == 0 {
+			span.Tags[0] = model.String("resource", "deployments")
+		} else {
+			span.References = []model.SpanRef{model.NewChildOfRef(traceId, 1)}
+		}
+		spans = append(spans, span)
+	}
+
+	for i, event := range events {
+		spans = append(spans, &model.Span{
+			TraceID:       traceId,
+			SpanID:        model.SpanID(100 + i),
+			OperationName: event.operation,
+			References:    []model.SpanRef{model.NewChildOfRef(traceId, model.SpanID(event.object+1))},
+			StartTime:     start.Add(event.offset),
+			Duration:      event.duration,
+			Tags:          event.tags,
+		})
+	}
+
+	return &model.Trace{Spans: spans}
+}
+
+func findStep(result *compare.Result, object string, operation string) *compare.Step {
+	for i := range result.Steps {
+		if result.Steps[i].Object == object && result.Steps[i].Operation == operation {
+			return &result.Steps[i]
+		}
+	}
+	return nil
+}
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	baseline := newTrace(time.Unix(1000, 0), []string{"web", "web-7d9c8f6b5c-x2k4z"}, []testEvent{
+		{object: 0, operation: "update", offset: 0, duration: time.Second},
+		{object: 1, operation: "Pulling", offset: time.Second * 2, duration: time.Second * 10},
+		{object: 1, operation: "Started", offset: time.Second * 12, duration: time.Second},
+	})
+	target := newTrace(time.Unix(5000, 0), []string{"web", "web-5f6d7c8b9d-q8w7v"}, []testEvent{
+		{object: 0, operation: "update", offset: 0, duration: time.Second},
+		{object: 1, operation: "Pulling", offset: time.Second * 2, duration: time.Second * 40},
+		{object: 1, operation: "BackOff", offset: time.Second * 42, duration: time.Second, tags: []model.KeyValue{model.Bool("error", true)}},
+	})
+
+	result := compare.Compare(baseline, target, compare.DefaultOptions)
+	assert.Equal((time.Second * 13).Microseconds(), result.BaselineDurationUs)
+	assert.Equal((time.Second * 43).Microseconds(), result.TargetDurationUs)
+
+	update := findStep(result, "deployments/web", "update")
+	if assert.NotNil(update) {
+		assert.Equal(compare.StatusUnchanged, update.Status)
+	}
+
+	pulling := findStep(result, "pods/web", "Pulling")
+	if assert.NotNil(pulling) {
+		assert.Equal(compare.StatusSlower, pulling.Status)
+		assert.Equal((time.Second * 30).Microseconds(), pulling.DurationDeltaUs)
+	}
+
+	backOff := findStep(result, "pods/web", "BackOff")
+	if assert.NotNil(backOff) {
+		assert.Equal(compare.StatusAdded, backOff.Status)
+		assert.True(backOff.NewError)
+	}
+
+	started := findStep(result, "pods/web", "Started")
+	if assert.NotNil(started) {
+		assert.Equal(compare.StatusRemoved, started.Status)
+	}
+	assert.Equal(compare.StatusRemoved, result.Steps[len(result.Steps)-1].Status)
+
+	pod := findStep(result, "pods/web", "")
+	if assert.NotNil(pod) {
+		assert.Equal((time.Second * 11).Microseconds(), pod.Baseline.DurationUs)
+		assert.Equal((time.Second * 41).Microseconds(), pod.Target.DurationUs)
+		assert.Equal(compare.StatusSlower, pod.Status)
+	}
+
+	compare.Annotate(target, result)
+	for _, span := range target.Spans {
+		switch span.OperationName {
+		case "BackOff":
+			assert.Contains(span.Warnings, "error not present in the baseline")
+		case "Pulling":
+			status, _ := model.KeyValues(span.Tags).FindByKey(compare.TagStatus)
+			assert.Equal(string(compare.StatusSlower), status.AsString())
+			assert.Len(span.Warnings, 1)
+		}
+	}
+}
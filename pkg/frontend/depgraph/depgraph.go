@@ -0,0 +1,343 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Builds graphs of the relationships between objects observed by the linkers,
+// from the link pseudospans stored in the backend.
+package depgraph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("frontend-dependency-graph", manager.Ptr(&Reader{}))
+}
+
+// Granularity determines which objects are merged into the same node.
+type Granularity string
+
+const (
+	// Each object is a node.
+	GranularityObject Granularity = "object"
+	// Objects of the same resource are merged into the same node.
+	GranularityResource Granularity = "resource"
+)
+
+type options struct {
+	maxTraces     int
+	jaeger        bool
+	jaegerCluster string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.IntVar(
+		&options.maxTraces,
+		"frontend-dependency-graph-max-traces",
+		1000,
+		"maximum number of object traces scanned to build a dependency graph",
+	)
+	fs.BoolVar(
+		&options.jaeger,
+		"frontend-dependency-graph-jaeger",
+		false,
+		"serve the relationships between resources as Jaeger dependencies, displayed in the System Architecture tab",
+	)
+	fs.StringVar(
+		&options.jaegerCluster,
+		"frontend-dependency-graph-jaeger-cluster",
+		"",
+		"only include objects of this cluster in Jaeger dependencies; empty for all clusters",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Reader struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Backend jaegerbackend.Backend
+	Tenant  *tenant.Filter
+
+	BuildMetric *metrics.Metric[*buildMetric]
+}
+
+type buildMetric struct {
+	Granularity Granularity
+	Truncated   bool
+	Error       metrics.LabeledError
+}
+
+func (*buildMetric) MetricName() string { return "frontend_dependency_graph_build" }
+
+var _ manager.Component = &Reader{}
+
+func (reader *Reader) Options() manager.Options        { return &reader.options }
+func (reader *Reader) Init() error                     { return nil }
+func (reader *Reader) Start(ctx context.Context) error { return nil }
+func (reader *Reader) Close(ctx context.Context) error { return nil }
+
+// JaegerEnabled returns whether the graph should be served as Jaeger dependencies.
+func (reader *Reader) JaegerEnabled() bool { return reader.options.jaeger }
+
+// Query selects the objects whose links are included in the graph.
+// Empty fields match all objects.
+type Query struct {
+	Cluster     string
+	Group       string
+	Resource    string
+	Namespace   string
+	Start       time.Time
+	End         time.Time
+	Granularity Granularity
+}
+
+func (query Query) matches(key utilobject.Key) bool {
+	for _, field := range []struct{ expected, actual string }{
+		{query.Cluster, key.Cluster},
+		{query.Group, key.Group},
+		{query.Resource, key.Resource},
+		{query.Namespace, key.Namespace},
+	} {
+		if field.expected != "" && field.expected != field.actual {
+			return false
+		}
+	}
+	return true
+}
+
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// Truncated is true if more than --frontend-dependency-graph-max-traces traces matched the query,
+	// in which case some edges are missing.
+	Truncated bool `json:"truncated"`
+}
+
+type Node struct {
+	Id       string `json:"id"`
+	Cluster  string `json:"cluster,omitempty"`
+	Group    string `json:"group"`
+	Resource string `json:"resource"`
+	// Only set for GranularityObject.
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type Edge struct {
+	// Parent is the ID of the owner, controller or other upstream node.
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+	// Class is the link class of the linker, e.g. "children" for owner references.
+	Class string `json:"class,omitempty"`
+	// Count is the number of link spans between the objects, i.e. the number of pseudospan windows
+	// in which the relationship was observed.
+	Count uint64 `json:"count"`
+}
+
+type edgeKey struct {
+	parent, child, class string
+}
+
+// Build builds the graph of the links observed between the start and end time.
+func (reader *Reader) Build(ctx context.Context, query Query) (*Graph, error) {
+	metric := &buildMetric{Granularity: query.Granularity}
+	defer reader.BuildMetric.DeferCount(reader.Clock.Now(), metric)
+
+	tags := map[string]string{}
+	for key, value := range map[string]string{
+		"cluster":   query.Cluster,
+		"group":     query.Group,
+		"resource":  query.Resource,
+		"namespace": query.Namespace,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+
+	tts, err := reader.Backend.List(
+		context.WithValue(ctx, jaegerreader.WantPseudoSpansOnly{}, jaegerreader.WantPseudoSpansOnly{}),
+		&spanstore.TraceQueryParameters{
+			Tags:         tags,
+			StartTimeMin: query.Start,
+			StartTimeMax: query.End,
+			NumTraces:    reader.options.maxTraces,
+		},
+	)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "List")
+		return nil, fmt.Errorf("cannot list object traces: %w", err)
+	}
+
+	nodes := map[string]Node{}
+	edges := map[edgeKey]uint64{}
+
+	for _, tt := range tts {
+		if !reader.Tenant.FilterTree(ctx, tt.Spans) {
+			continue
+		}
+
+		for _, span := range tt.Spans.GetSpans() {
+			reader.addLink(ctx, query, span, nodes, edges)
+		}
+	}
+
+	graph := &Graph{
+		Nodes:     make([]Node, 0, len(nodes)),
+		Edges:     make([]Edge, 0, len(edges)),
+		Truncated: len(tts) >= reader.options.maxTraces,
+	}
+	metric.Truncated = graph.Truncated
+
+	for _, node := range nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Id < graph.Nodes[j].Id })
+
+	for key, count := range edges {
+		graph.Edges = append(graph.Edges, Edge{Parent: key.parent, Child: key.child, Class: key.class, Count: count})
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		left, right := graph.Edges[i], graph.Edges[j]
+		if left.Count != right.Count {
+			return left.Count > right.Count
+		}
+		if left.Parent != right.Parent {
+			return left.Parent < right.Parent
+		}
+		if left.Child != right.Child {
+			return left.Child < right.Child
+		}
+		return left.Class < right.Class
+	})
+
+	return graph, nil
+}
+
+// addLink adds the edge of a link span to the graph.
+//
+// The linker worker stores a link span on both objects of each link,
+// so each link is only counted on one side to avoid counting it twice.
+func (reader *Reader) addLink(ctx context.Context, query Query, span *model.Span, nodes map[string]Node, edges map[edgeKey]uint64) {
+	linked, isLink := zconstants.LinkedKeyFromSpan(span)
+	if !isLink {
+		return
+	}
+	if span.StartTime.After(query.End) || span.StartTime.Add(span.Duration).Before(query.Start) {
+		return
+	}
+
+	owner := zconstants.ObjectKeyFromSpan(span)
+	if !reader.Tenant.Allows(ctx, linked) {
+		return
+	}
+
+	tags := model.KeyValues(span.Tags)
+	role, _ := tags.FindByKey(zconstants.LinkRole)
+	class, _ := tags.FindByKey(zconstants.LinkClass)
+
+	var parent, child utilobject.Key
+	switch zconstants.LinkRoleValue(role.AsString()) {
+	case zconstants.LinkRoleChild:
+		parent, child = owner, linked
+	case zconstants.LinkRoleParent:
+		// counted on the parent unless the parent trace is not scanned
+		if query.matches(linked) {
+			return
+		}
+		parent, child = linked, owner
+	default:
+		// links without direction are counted on the object with the smaller key
+		if query.matches(linked) && linked.String() < owner.String() {
+			return
+		}
+		parent, child = owner, linked
+	}
+
+	parentNode := newNode(parent, query.Granularity)
+	childNode := newNode(child, query.Granularity)
+	nodes[parentNode.Id] = parentNode
+	nodes[childNode.Id] = childNode
+
+	edges[edgeKey{parent: parentNode.Id, child: childNode.Id, class: class.AsString()}]++
+}
+
+func newNode(key utilobject.Key, granularity Granularity) Node {
+	if granularity == GranularityObject {
+		return Node{
+			Id:        key.String(),
+			Cluster:   key.Cluster,
+			Group:     key.Group,
+			Resource:  key.Resource,
+			Namespace: key.Namespace,
+			Name:      key.Name,
+		}
+	}
+
+	return Node{
+		Id:       key.GroupResource().String(),
+		Group:    key.Group,
+		Resource: key.Resource,
+	}
+}
+
+// GetDependencies implements the Jaeger dependency reader with the resource graph of all namespaces.
+func (reader *Reader) GetDependencies(ctx context.Context, endTime time.Time, lookback time.Duration) ([]model.DependencyLink, error) {
+	graph, err := reader.Build(ctx, Query{
+		Cluster:     reader.options.jaegerCluster,
+		Start:       endTime.Add(-lookback),
+		End:         endTime,
+		Granularity: GranularityResource,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Jaeger merges links between the same services, so classes are dropped
+	counts := map[[2]string]uint64{}
+	for _, edge := range graph.Edges {
+		counts[[2]string{edge.Parent, edge.Child}] += edge.Count
+	}
+
+	links := make([]model.DependencyLink, 0, len(counts))
+	for pair, count := range counts {
+		links = append(links, model.DependencyLink{Parent: pair[0], Child: pair[1], CallCount: count, Source: "kelemetry"})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Parent != links[j].Parent {
+			return links[i].Parent < links[j].Parent
+		}
+		return links[i].Child < links[j].Child
+	})
+
+	return links, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package depgraph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+var (
+	startTime = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deployment = utilobject.Key{Cluster: "test", Group: "apps", Resource: "deployments", Namespace: "default", Name: "web"}
+	replicaSet = utilobject.Key{Cluster: "test", Group: "apps", Resource: "replicasets", Namespace: "default", Name: "web-1"}
+	pod1       = utilobject.Key{Cluster: "test", Group: "", Resource: "pods", Namespace: "default", Name: "web-1-a"}
+	pod2       = utilobject.Key{Cluster: "test", Group: "", Resource: "pods", Namespace: "default", Name: "web-1-b"}
+)
+
+type fakeBackend struct {
+	traces map[utilobject.Key]*tftree.SpanTree
+}
+
+func (backend *fakeBackend) List(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error) {
+	tts := []*jaegerbackend.TraceThumbnail{}
+	for key, tree := range backend.traces {
+		if resource, exists := query.Tags["resource"]; exists && resource != key.Resource {
+			continue
+		}
+		tts = append(tts, &jaegerbackend.TraceThumbnail{Identifier: key, Spans: tree})
+	}
+	return tts, nil
+}
+
+func (backend *fakeBackend) Get(
+	ctx context.Context,
+	identifier json.RawMessage,
+	traceId model.TraceID,
+	startTime, endTime time.Time,
+) (*model.Trace, error) {
+	panic("unused")
+}
+
+func objectTags(key utilobject.Key) []model.KeyValue {
+	tags := []model.KeyValue{}
+	for tagKey, value := range zconstants.KeyToSpanTags(key) {
+		tags = append(tags, model.String(tagKey, value))
+	}
+	return tags
+}
+
+// objectTrace creates the trace of an object with a link span to each of the links.
+func objectTrace(key utilobject.Key, links ...zconstants.LinkRef) *tftree.SpanTree {
+	spans := []*model.Span{{
+		SpanID:    1,
+		StartTime: startTime,
+		Duration:  time.Hour,
+		Tags:      append(objectTags(key), model.String(zconstants.PseudoType, string(zconstants.PseudoTypeObject))),
+	}}
+
+	for i, link := range links {
+		linkTags := map[string]string{}
+		zconstants.TagLinkedObject(linkTags, link)
+
+		tags := append(objectTags(key), model.String(zconstants.PseudoType, string(zconstants.PseudoTypeLink)))
+		for tagKey, value := range linkTags {
+			tags = append(tags, model.String(tagKey, value))
+		}
+
+		spans = append(spans, &model.Span{
+			SpanID:     model.SpanID(i + 2),
+			StartTime:  startTime,
+			Duration:   time.Hour,
+			Tags:       tags,
+			References: []model.SpanRef{{SpanID: 1, RefType: model.ChildOf}},
+		})
+	}
+
+	return tftree.NewSpanTree(spans)
+}
+
+func newTestReader() *Reader {
+	clock := clocktesting.NewFakeClock(startTime)
+	metricsClient, _ := metrics.NewMock(clock)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	owner := func(key utilobject.Key, role zconstants.LinkRoleValue) zconstants.LinkRef {
+		return zconstants.LinkRef{Key: key, Role: role, Class: "children"}
+	}
+
+	return &Reader{
+		options: options{maxTraces: 100},
+		Logger:  logger,
+		Clock:   clock,
+		Backend: &fakeBackend{traces: map[utilobject.Key]*tftree.SpanTree{
+			deployment: objectTrace(deployment, owner(replicaSet, zconstants.LinkRoleChild)),
+			replicaSet: objectTrace(
+				replicaSet,
+				owner(deployment, zconstants.LinkRoleParent),
+				owner(pod1, zconstants.LinkRoleChild),
+				owner(pod2, zconstants.LinkRoleChild),
+			),
+			pod1: objectTrace(pod1, owner(replicaSet, zconstants.LinkRoleParent)),
+			pod2: objectTrace(pod2, owner(replicaSet, zconstants.LinkRoleParent)),
+		}},
+		Tenant:      &tenant.Filter{Authorizers: &manager.List[tenant.Authorizer]{}},
+		BuildMetric: metrics.New[*buildMetric](metricsClient),
+	}
+}
+
+func TestBuildObjectGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	graph, err := newTestReader().Build(context.Background(), Query{
+		Start:       startTime,
+		End:         startTime.Add(time.Hour),
+		Granularity: GranularityObject,
+	})
+	assert.NoError(err)
+	assert.False(graph.Truncated)
+	assert.Len(graph.Nodes, 4)
+
+	// links stored on both objects are only counted once
+	assert.ElementsMatch([]Edge{
+		{Parent: deployment.String(), Child: replicaSet.String(), Class: "children", Count: 1},
+		{Parent: replicaSet.String(), Child: pod1.String(), Class: "children", Count: 1},
+		{Parent: replicaSet.String(), Child: pod2.String(), Class: "children", Count: 1},
+	}, graph.Edges)
+}
+
+func TestBuildFilteredResourceGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	// the owner traces are not scanned, so links are counted on the replicaset side
+	graph, err := newTestReader().Build(context.Background(), Query{
+		Resource:    "replicasets",
+		Start:       startTime,
+		End:         startTime.Add(time.Hour),
+		Granularity: GranularityResource,
+	})
+	assert.NoError(err)
+	assert.Equal([]Node{
+		{Id: "deployments.apps", Group: "apps", Resource: "deployments"},
+		{Id: "pods", Group: "", Resource: "pods"},
+		{Id: "replicasets.apps", Group: "apps", Resource: "replicasets"},
+	}, graph.Nodes)
+	assert.Equal([]Edge{
+		{Parent: "replicasets.apps", Child: "pods", Class: "children", Count: 2},
+		{Parent: "deployments.apps", Child: "replicasets.apps", Class: "children", Count: 1},
+	}, graph.Edges)
+}
+
+func TestBuildOutOfRange(t *testing.T) {
+	assert := assert.New(t)
+
+	graph, err := newTestReader().Build(context.Background(), Query{
+		Start:       startTime.Add(2 * time.Hour),
+		End:         startTime.Add(3 * time.Hour),
+		Granularity: GranularityObject,
+	})
+	assert.NoError(err)
+	assert.Empty(graph.Edges)
+}
+
+func TestGetDependencies(t *testing.T) {
+	assert := assert.New(t)
+
+	links, err := newTestReader().GetDependencies(context.Background(), startTime.Add(time.Hour), time.Hour)
+	assert.NoError(err)
+	assert.Equal([]model.DependencyLink{
+		{Parent: "deployments.apps", Child: "replicasets.apps", CallCount: 1, Source: "kelemetry"},
+		{Parent: "replicasets.apps", Child: "pods", CallCount: 2, Source: "kelemetry"},
+	}, links)
+}
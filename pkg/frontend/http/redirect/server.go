@@ -29,8 +29,10 @@ import (
 
 	"github.com/kubewharf/kelemetry/pkg/frontend/clusterlist"
 	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
 	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
 	pkghttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
@@ -58,6 +60,8 @@ type server struct {
 	SpanReader       jaegerreader.Interface
 	ClusterList      clusterlist.Lister
 	TransformConfigs tfconfig.Provider
+	Tenant           *tenant.Filter
+	Auth             *auth.Authenticator
 
 	RequestMetric *metrics.Metric[*requestMetric]
 }
@@ -73,7 +77,7 @@ func (server *server) Options() manager.Options {
 }
 
 func (server *server) Init() error {
-	server.Server.Routes().GET("/redirect", func(ctx *gin.Context) {
+	server.Server.Routes().GET("/redirect", server.Auth.Wrap(func(ctx *gin.Context) {
 		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
 		defer shutdown.RecoverPanic(logger)
 		metric := &requestMetric{}
@@ -87,7 +91,7 @@ func (server *server) Init() error {
 			_, _ = ctx.Writer.WriteString(err.Error())
 			ctx.Abort()
 		}
-	})
+	}))
 
 	return nil
 }
@@ -130,15 +134,20 @@ func (server *server) handleGet(ctx *gin.Context, metric *requestMetric) (code i
 		tags["namespace"] = namespace
 	}
 
+	displayMode := ctx.Query(tfconfig.DisplayModeTag)
+	if displayMode == "" {
+		displayMode = server.TransformConfigs.DefaultName()
+	}
+
 	parameters := &spanstore.TraceQueryParameters{
-		ServiceName:   server.TransformConfigs.DefaultName(),
+		ServiceName:   displayMode,
 		OperationName: cluster,
 		Tags:          tags,
 		StartTimeMin:  timestamp.Add(time.Minute * -30),
 		StartTimeMax:  timestamp.Add(time.Minute * 30),
 		NumTraces:     2,
 	}
-	traceIDs, err := server.SpanReader.FindTraceIDs(context.Background(), parameters)
+	traceIDs, err := server.SpanReader.FindTraceIDs(server.Tenant.RequestContext(ctx.Request), parameters)
 	if err != nil {
 		metric.Error = metrics.MakeLabeledError("TraceError")
 		return 500, fmt.Errorf("failed to find trace ids %w", err)
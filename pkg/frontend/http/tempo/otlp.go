@@ -0,0 +1,173 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tempo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/jaegertracing/jaeger/model"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// FormatTraceId formats a trace ID as the 32-digit hex string used by Tempo.
+func FormatTraceId(traceId model.TraceID) string {
+	return fmt.Sprintf("%016x%016x", traceId.High, traceId.Low)
+}
+
+func traceIdBytes(traceId model.TraceID) []byte {
+	bytes := make([]byte, 16)
+	binary.BigEndian.PutUint64(bytes[:8], traceId.High)
+	binary.BigEndian.PutUint64(bytes[8:], traceId.Low)
+	return bytes
+}
+
+func spanIdBytes(spanId model.SpanID) []byte {
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(bytes, uint64(spanId))
+	return bytes
+}
+
+// ToOtlp converts a Jaeger trace to OTLP resource spans, grouping spans by service name.
+func ToOtlp(trace *model.Trace) []*tracev1.ResourceSpans {
+	processes := map[string]*model.Process{}
+	for i := range trace.ProcessMap {
+		processes[trace.ProcessMap[i].ProcessID] = &trace.ProcessMap[i].Process
+	}
+
+	groups := map[string]*tracev1.ResourceSpans{}
+	for _, span := range trace.Spans {
+		process := span.Process
+		if process == nil {
+			process = processes[span.ProcessID]
+		}
+
+		serviceName := ""
+		if process != nil {
+			serviceName = process.ServiceName
+		}
+
+		group, exists := groups[serviceName]
+		if !exists {
+			resource := &resourcev1.Resource{
+				Attributes: []*commonv1.KeyValue{stringAttribute("service.name", serviceName)},
+			}
+			if process != nil {
+				resource.Attributes = append(resource.Attributes, toAttributes(process.Tags)...)
+			}
+
+			group = &tracev1.ResourceSpans{
+				Resource:   resource,
+				ScopeSpans: []*tracev1.ScopeSpans{{Scope: &commonv1.InstrumentationScope{Name: "kelemetry"}}},
+			}
+			groups[serviceName] = group
+		}
+
+		group.ScopeSpans[0].Spans = append(group.ScopeSpans[0].Spans, toOtlpSpan(span))
+	}
+
+	serviceNames := make([]string, 0, len(groups))
+	for serviceName := range groups {
+		serviceNames = append(serviceNames, serviceName)
+	}
+	sort.Strings(serviceNames)
+
+	output := make([]*tracev1.ResourceSpans, len(serviceNames))
+	for i, serviceName := range serviceNames {
+		output[i] = groups[serviceName]
+	}
+
+	return output
+}
+
+func toOtlpSpan(span *model.Span) *tracev1.Span {
+	output := &tracev1.Span{
+		TraceId:           traceIdBytes(span.TraceID),
+		SpanId:            spanIdBytes(span.SpanID),
+		Name:              span.OperationName,
+		Kind:              tracev1.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(span.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(span.StartTime.Add(span.Duration).UnixNano()),
+		Attributes:        toAttributes(span.Tags),
+	}
+
+	for _, ref := range span.References {
+		if ref.RefType == model.ChildOf && output.ParentSpanId == nil {
+			output.ParentSpanId = spanIdBytes(ref.SpanID)
+		} else {
+			output.Links = append(output.Links, &tracev1.Span_Link{
+				TraceId: traceIdBytes(ref.TraceID),
+				SpanId:  spanIdBytes(ref.SpanID),
+			})
+		}
+	}
+
+	for _, log := range span.Logs {
+		event := &tracev1.Span_Event{
+			TimeUnixNano: uint64(log.Timestamp.UnixNano()),
+			Name:         "log",
+		}
+
+		for _, field := range log.Fields {
+			if field.Key == "event" && field.VType == model.StringType {
+				event.Name = field.VStr
+			} else {
+				event.Attributes = append(event.Attributes, toAttribute(field))
+			}
+		}
+
+		output.Events = append(output.Events, event)
+	}
+
+	if errorTag, ok := model.KeyValues(span.Tags).FindByKey("error"); ok && errorTag.Bool() {
+		output.Status = &tracev1.Status{Code: tracev1.Status_STATUS_CODE_ERROR}
+	}
+
+	return output
+}
+
+func toAttributes(tags []model.KeyValue) []*commonv1.KeyValue {
+	attributes := make([]*commonv1.KeyValue, 0, len(tags))
+	for _, tag := range tags {
+		attributes = append(attributes, toAttribute(tag))
+	}
+	return attributes
+}
+
+func toAttribute(tag model.KeyValue) *commonv1.KeyValue {
+	value := &commonv1.AnyValue{}
+
+	switch tag.VType {
+	case model.BoolType:
+		value.Value = &commonv1.AnyValue_BoolValue{BoolValue: tag.Bool()}
+	case model.Int64Type:
+		value.Value = &commonv1.AnyValue_IntValue{IntValue: tag.Int64()}
+	case model.Float64Type:
+		value.Value = &commonv1.AnyValue_DoubleValue{DoubleValue: tag.Float64()}
+	case model.BinaryType:
+		value.Value = &commonv1.AnyValue_BytesValue{BytesValue: tag.Binary()}
+	default:
+		value.Value = &commonv1.AnyValue_StringValue{StringValue: tag.AsString()}
+	}
+
+	return &commonv1.KeyValue{Key: tag.Key, Value: value}
+}
+
+func stringAttribute(key string, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}}}
+}
@@ -0,0 +1,154 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tempo
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseLogfmt parses the `tags` search parameter in the form `key1=value1 key2="value 2"`.
+func ParseLogfmt(input string) (map[string]string, error) {
+	output := map[string]string{}
+
+	rest := strings.TrimSpace(input)
+	for rest != "" {
+		key, afterKey, ok := strings.Cut(rest, "=")
+		if !ok || key == "" || strings.ContainsFunc(key, unicode.IsSpace) {
+			return nil, fmt.Errorf("expected key=value at %q", rest)
+		}
+
+		value, afterValue, err := cutValue(afterKey)
+		if err != nil {
+			return nil, err
+		}
+
+		output[key] = value
+		rest = strings.TrimLeftFunc(afterValue, unicode.IsSpace)
+	}
+
+	return output, nil
+}
+
+// cutValue reads a bare or double-quoted value from the start of the input.
+func cutValue(input string) (value string, rest string, err error) {
+	if !strings.HasPrefix(input, `"`) {
+		end := strings.IndexFunc(input, unicode.IsSpace)
+		if end == -1 {
+			return input, "", nil
+		}
+		return input[:end], input[end:], nil
+	}
+
+	var sb strings.Builder
+	for i := 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 < len(input) {
+				i++
+				sb.WriteByte(input[i])
+			}
+		case '"':
+			return sb.String(), input[i+1:], nil
+		default:
+			sb.WriteByte(input[i])
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated quoted value %q", input)
+}
+
+// ParseTraceQL converts a TraceQL query to tag equality conditions.
+//
+// Only a single spanset of `&&`-joined equality conditions on string attributes is supported,
+// e.g. `{ resource.service.name = "object" && .cluster = "foo" && span.name = "bar" }`.
+// The `resource.`, `span.` and `.` scopes are treated the same since Kelemetry stores object keys as span tags.
+func ParseTraceQL(query string) (map[string]string, error) {
+	query = strings.TrimSpace(query)
+	if query == "" || query == "{}" {
+		return map[string]string{}, nil
+	}
+
+	if !strings.HasPrefix(query, "{") || !strings.HasSuffix(query, "}") {
+		return nil, fmt.Errorf("only a single spanset selector is supported")
+	}
+	body := strings.TrimSpace(query[1 : len(query)-1])
+
+	output := map[string]string{}
+	if body == "" {
+		return output, nil
+	}
+
+	for _, condition := range splitConditions(body) {
+		attr, valueExpr, ok := strings.Cut(condition, "=")
+		if !ok || strings.HasSuffix(attr, "!") || strings.HasPrefix(valueExpr, "~") {
+			return nil, fmt.Errorf("unsupported condition %q, only '=' is supported", condition)
+		}
+
+		key, err := attributeName(strings.TrimSpace(attr))
+		if err != nil {
+			return nil, err
+		}
+
+		value, rest, err := cutValue(strings.TrimSpace(valueExpr))
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after value", rest)
+		}
+
+		output[key] = value
+	}
+
+	return output, nil
+}
+
+// splitConditions splits the spanset body by `&&` outside quoted strings.
+func splitConditions(body string) []string {
+	conditions := []string{}
+	inQuote := false
+	start := 0
+
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && inQuote:
+			i++
+		case body[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(body[i:], "&&"):
+			conditions = append(conditions, strings.TrimSpace(body[start:i]))
+			start = i + 2
+			i++
+		}
+	}
+
+	return append(conditions, strings.TrimSpace(body[start:]))
+}
+
+func attributeName(attr string) (string, error) {
+	for _, prefix := range []string{"resource.", "span.", "."} {
+		if strings.HasPrefix(attr, prefix) {
+			name := strings.TrimPrefix(attr, prefix)
+			if name == "" {
+				return "", fmt.Errorf("empty attribute name in %q", attr)
+			}
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported attribute %q, only scoped attributes are supported", attr)
+}
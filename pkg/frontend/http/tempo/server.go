@@ -0,0 +1,385 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Serves a subset of the Grafana Tempo query API so that Grafana can use Kelemetry as a Tempo data source.
+package tempo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/clusterlist"
+	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	pkghttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("tempo-server", manager.Ptr(&server{}))
+}
+
+// searchTags are the tags that can be used in search queries.
+var searchTags = []string{"cluster", "group", "resource", "namespace", "name", tfconfig.DisplayModeTag}
+
+type options struct {
+	enable          bool
+	displayMode     string
+	defaultLookback time.Duration
+	defaultLimit    int
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "tempo-server-enable", false, "enable Grafana Tempo compatible query API for frontend")
+	fs.StringVar(
+		&options.displayMode,
+		"tempo-server-display-mode",
+		"tracing",
+		"display mode used for searches that do not specify the displayMode tag",
+	)
+	fs.DurationVar(
+		&options.defaultLookback,
+		"tempo-server-default-lookback",
+		time.Hour,
+		"time range to search when the start and end parameters are not specified",
+	)
+	fs.IntVar(&options.defaultLimit, "tempo-server-default-limit", 20, "maximum number of traces returned when the limit parameter is not specified")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type server struct {
+	options          options
+	Logger           logrus.FieldLogger
+	Clock            clock.Clock
+	Server           pkghttp.Server
+	SpanReader       jaegerreader.Interface
+	ClusterList      clusterlist.Lister
+	TransformConfigs tfconfig.Provider
+	Tenant           *tenant.Filter
+	Auth             *auth.Authenticator
+
+	RequestMetric *metrics.Metric[*requestMetric]
+}
+
+type requestMetric struct {
+	Endpoint string
+	Error    metrics.LabeledError
+}
+
+func (*requestMetric) MetricName() string { return "tempo_request" }
+
+func (server *server) Options() manager.Options {
+	return &server.options
+}
+
+func (server *server) Init() error {
+	if _, err := tfconfig.Resolve(server.TransformConfigs, server.options.displayMode); err != nil {
+		return fmt.Errorf("unknown display mode %q for --tempo-server-display-mode", server.options.displayMode)
+	}
+
+	routes := server.Server.Routes()
+
+	routes.GET("/api/echo", func(ctx *gin.Context) { ctx.String(200, "echo") })
+	routes.GET("/api/status/buildinfo", func(ctx *gin.Context) {
+		ctx.JSON(200, gin.H{"version": "kelemetry"})
+	})
+
+	routes.GET("/api/traces/:traceId", server.handler("trace", func(ctx *gin.Context, metric *requestMetric) (int, error) {
+		return server.handleTrace(ctx, metric, false)
+	}))
+	routes.GET("/api/v2/traces/:traceId", server.handler("trace", func(ctx *gin.Context, metric *requestMetric) (int, error) {
+		return server.handleTrace(ctx, metric, true)
+	}))
+	routes.GET("/api/search", server.handler("search", server.handleSearch))
+	routes.GET("/api/search/tags", server.handler("tags", server.handleTags))
+	routes.GET("/api/v2/search/tags", server.handler("tags", server.handleTagsV2))
+	routes.GET("/api/search/tag/:tagName/values", server.handler("tagValues", server.handleTagValues))
+	routes.GET("/api/v2/search/tag/:tagName/values", server.handler("tagValues", server.handleTagValuesV2))
+
+	return nil
+}
+
+func (server *server) Start(ctx context.Context) error { return nil }
+
+func (server *server) Close(ctx context.Context) error { return nil }
+
+func (server *server) handler(
+	endpoint string,
+	handle func(ctx *gin.Context, metric *requestMetric) (code int, err error),
+) gin.HandlerFunc {
+	return server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr).WithField("endpoint", endpoint)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{Endpoint: endpoint}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET %s", ctx.Request.URL.Path)
+
+		if code, err := handle(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	})
+}
+
+func (server *server) handleTrace(ctx *gin.Context, metric *requestMetric, v2 bool) (code int, err error) {
+	traceId, err := model.TraceIDFromString(ctx.Param("traceId"))
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTraceId")
+		return 400, fmt.Errorf("invalid trace ID: %w", err)
+	}
+
+	trace, err := server.SpanReader.GetTrace(server.Tenant.RequestContext(ctx.Request), traceId)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "GetTrace")
+		return 404, fmt.Errorf("cannot get trace: %w", err)
+	}
+
+	otlpTrace := &tracev1.TracesData{ResourceSpans: ToOtlp(trace)}
+
+	if strings.Contains(ctx.GetHeader("Accept"), "application/protobuf") {
+		data, err := proto.Marshal(otlpTrace)
+		if err != nil {
+			metric.Error = metrics.LabelError(err, "Marshal")
+			return 500, fmt.Errorf("cannot encode trace: %w", err)
+		}
+
+		ctx.Data(200, "application/protobuf", data)
+		return 0, nil
+	}
+
+	// Tempo uses `batches` instead of `resourceSpans` as the key of the trace object,
+	// and additionally wraps the trace in a `trace` object in the v2 API.
+	batches := make([]json.RawMessage, len(otlpTrace.ResourceSpans))
+	for i, resourceSpans := range otlpTrace.ResourceSpans {
+		batches[i], err = protojson.Marshal(resourceSpans)
+		if err != nil {
+			metric.Error = metrics.LabelError(err, "Marshal")
+			return 500, fmt.Errorf("cannot encode trace: %w", err)
+		}
+	}
+
+	var body any = jsonTrace{Batches: batches}
+	if v2 {
+		body = gin.H{"trace": body}
+	}
+
+	ctx.JSON(200, body)
+	return 0, nil
+}
+
+type jsonTrace struct {
+	Batches []json.RawMessage `json:"batches"`
+}
+
+type searchResponse struct {
+	Traces  []searchTrace `json:"traces"`
+	Metrics struct{}      `json:"metrics"`
+}
+
+type searchTrace struct {
+	TraceId           string `json:"traceID"`
+	RootServiceName   string `json:"rootServiceName"`
+	RootTraceName     string `json:"rootTraceName"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	DurationMs        int64  `json:"durationMs"`
+}
+
+func (server *server) handleSearch(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	var tags map[string]string
+	if query := ctx.Query("q"); query != "" {
+		tags, err = ParseTraceQL(query)
+	} else {
+		tags, err = ParseLogfmt(ctx.Query("tags"))
+	}
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidQuery")
+		return 400, fmt.Errorf("invalid query: %w", err)
+	}
+
+	displayMode := server.options.displayMode
+	if value, exists := tags[tfconfig.DisplayModeTag]; exists {
+		displayMode = value
+		delete(tags, tfconfig.DisplayModeTag)
+	}
+
+	end := server.Clock.Now()
+	if value := ctx.Query("end"); value != "" {
+		if end, err = parseUnixSeconds(value); err != nil {
+			metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+			return 400, fmt.Errorf("invalid end param: %w", err)
+		}
+	}
+
+	start := end.Add(-server.options.defaultLookback)
+	if value := ctx.Query("start"); value != "" {
+		if start, err = parseUnixSeconds(value); err != nil {
+			metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+			return 400, fmt.Errorf("invalid start param: %w", err)
+		}
+	}
+
+	limit := server.options.defaultLimit
+	if value := ctx.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			metric.Error = metrics.MakeLabeledError("InvalidLimit")
+			return 400, fmt.Errorf("invalid limit param %q", value)
+		}
+	}
+
+	parameters := &spanstore.TraceQueryParameters{
+		ServiceName:  displayMode,
+		Tags:         tags,
+		StartTimeMin: start,
+		StartTimeMax: end,
+		NumTraces:    limit,
+	}
+
+	for param, field := range map[string]*time.Duration{
+		"minDuration": &parameters.DurationMin,
+		"maxDuration": &parameters.DurationMax,
+	} {
+		if value := ctx.Query(param); value != "" {
+			if *field, err = time.ParseDuration(value); err != nil {
+				metric.Error = metrics.MakeLabeledError("InvalidDuration")
+				return 400, fmt.Errorf("invalid %s param: %w", param, err)
+			}
+		}
+	}
+
+	traces, err := server.SpanReader.FindTraces(server.Tenant.RequestContext(ctx.Request), parameters)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "FindTraces")
+		return 500, fmt.Errorf("cannot find traces: %w", err)
+	}
+
+	response := searchResponse{Traces: make([]searchTrace, 0, len(traces))}
+	for _, trace := range traces {
+		if len(trace.Spans) == 0 {
+			continue
+		}
+
+		response.Traces = append(response.Traces, summarizeTrace(trace))
+	}
+
+	ctx.JSON(200, response)
+	return 0, nil
+}
+
+// summarizeTrace describes a trace by its root span and the overall time range of its spans.
+func summarizeTrace(trace *model.Trace) searchTrace {
+	root := trace.Spans[0]
+	start := root.StartTime
+	end := root.StartTime.Add(root.Duration)
+
+	for _, span := range trace.Spans {
+		if len(span.References) == 0 && len(root.References) > 0 {
+			root = span
+		}
+		if span.StartTime.Before(start) {
+			start = span.StartTime
+		}
+		if spanEnd := span.StartTime.Add(span.Duration); spanEnd.After(end) {
+			end = spanEnd
+		}
+	}
+
+	output := searchTrace{
+		TraceId:           FormatTraceId(root.TraceID),
+		RootTraceName:     root.OperationName,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		DurationMs:        end.Sub(start).Milliseconds(),
+	}
+	if root.Process != nil {
+		output.RootServiceName = root.Process.ServiceName
+	}
+
+	return output
+}
+
+func parseUnixSeconds(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(seconds, 0), nil
+}
+
+func (server *server) handleTags(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	ctx.JSON(200, gin.H{"tagNames": searchTags})
+	return 0, nil
+}
+
+func (server *server) handleTagsV2(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	ctx.JSON(200, gin.H{"scopes": []gin.H{{"name": "span", "tags": searchTags}}})
+	return 0, nil
+}
+
+func (server *server) tagValues(tagName string) []string {
+	// v2 tag names are scoped, e.g. `span.cluster`.
+	if index := strings.LastIndexByte(tagName, '.'); index != -1 {
+		tagName = tagName[index+1:]
+	}
+
+	values := []string{}
+
+	switch tagName {
+	case "cluster":
+		values = append(values, server.ClusterList.List()...)
+	case tfconfig.DisplayModeTag:
+		values = append(values, server.TransformConfigs.Names()...)
+		values = append(values, server.TransformConfigs.PresetNames()...)
+	}
+
+	sort.Strings(values)
+	return values
+}
+
+func (server *server) handleTagValues(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	ctx.JSON(200, gin.H{"tagValues": server.tagValues(ctx.Param("tagName"))})
+	return 0, nil
+}
+
+func (server *server) handleTagValuesV2(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	values := []gin.H{}
+	for _, value := range server.tagValues(ctx.Param("tagName")) {
+		values = append(values, gin.H{"type": "string", "value": value})
+	}
+
+	ctx.JSON(200, gin.H{"tagValues": values})
+	return 0, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tempo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/http/tempo"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	assert := assert.New(t)
+
+	tags, err := tempo.ParseLogfmt(`cluster=foo  name="bar \"baz\"" namespace=default`)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"cluster": "foo", "name": `bar "baz"`, "namespace": "default"}, tags)
+
+	tags, err = tempo.ParseLogfmt("")
+	assert.NoError(err)
+	assert.Empty(tags)
+
+	_, err = tempo.ParseLogfmt(`cluster`)
+	assert.Error(err)
+
+	_, err = tempo.ParseLogfmt(`name="unterminated`)
+	assert.Error(err)
+}
+
+func TestParseTraceQL(t *testing.T) {
+	assert := assert.New(t)
+
+	tags, err := tempo.ParseTraceQL(`{ resource.cluster = "foo" && span.name="a && b" && .namespace = "default" }`)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"cluster": "foo", "name": "a && b", "namespace": "default"}, tags)
+
+	tags, err = tempo.ParseTraceQL(`{}`)
+	assert.NoError(err)
+	assert.Empty(tags)
+
+	for _, query := range []string{
+		`{ .name != "foo" }`,
+		`{ .name =~ "foo.*" }`,
+		`{ name = "foo" }`,
+		`{ .name = "foo" } | count() > 1`,
+		`{ .name = "foo" "bar" }`,
+	} {
+		_, err := tempo.ParseTraceQL(query)
+		assert.Error(err, query)
+	}
+}
+
+func TestToOtlp(t *testing.T) {
+	assert := assert.New(t)
+
+	traceId := model.NewTraceID(1, 2)
+	start := time.Unix(100, 0)
+
+	trace := &model.Trace{
+		Spans: []*model.Span{
+			{
+				TraceID:       traceId,
+				SpanID:        1,
+				OperationName: "root",
+				StartTime:     start,
+				Duration:      time.Second,
+				Process:       &model.Process{ServiceName: "object"},
+				Tags:          []model.KeyValue{model.String("cluster", "foo")},
+			},
+			{
+				TraceID:       traceId,
+				SpanID:        2,
+				OperationName: "child",
+				StartTime:     start,
+				Duration:      time.Millisecond,
+				Process:       &model.Process{ServiceName: "audit"},
+				References: []model.SpanRef{
+					model.NewChildOfRef(traceId, 1),
+					model.NewFollowsFromRef(traceId, 3),
+				},
+				Tags: []model.KeyValue{model.Bool("error", true)},
+				Logs: []model.Log{{
+					Timestamp: start,
+					Fields:    []model.KeyValue{model.String("event", "ping"), model.Int64("code", 200)},
+				}},
+			},
+		},
+	}
+
+	output := tempo.ToOtlp(trace)
+	assert.Len(output, 2)
+
+	assert.Equal("service.name", output[0].Resource.Attributes[0].Key)
+	assert.Equal("audit", output[0].Resource.Attributes[0].Value.GetStringValue())
+	assert.Equal("object", output[1].Resource.Attributes[0].Value.GetStringValue())
+
+	root := output[1].ScopeSpans[0].Spans[0]
+	assert.Equal([]byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 2}, root.TraceId)
+	assert.Nil(root.ParentSpanId)
+	assert.Equal(uint64(101e9), root.EndTimeUnixNano)
+	assert.Equal("foo", root.Attributes[0].Value.GetStringValue())
+
+	child := output[0].ScopeSpans[0].Spans[0]
+	assert.Equal(root.SpanId, child.ParentSpanId)
+	assert.Len(child.Links, 1)
+	assert.Equal([]byte{0, 0, 0, 0, 0, 0, 0, 3}, child.Links[0].SpanId)
+	assert.Equal("ping", child.Events[0].Name)
+	assert.Equal(int64(200), child.Events[0].Attributes[0].Value.GetIntValue())
+	assert.NotNil(child.Status)
+
+	assert.Equal("00000000000000010000000000000002", tempo.FormatTraceId(traceId))
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaegertracing/jaeger/model"
+	uiconv "github.com/jaegertracing/jaeger/model/converter/json"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/compare"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type compareQuery struct {
+	Cluster       string  `form:"cluster"`
+	Resource      string  `form:"resource"`
+	Namespace     string  `form:"namespace"`
+	Name          string  `form:"name"`
+	BaselineStart string  `form:"baselineStart"`
+	BaselineEnd   string  `form:"baselineEnd"`
+	TargetStart   string  `form:"targetStart"`
+	TargetEnd     string  `form:"targetEnd"`
+	DisplayMode   string  `form:"displayMode"`
+	Threshold     float64 `form:"threshold"`
+	MinDelta      string  `form:"minDelta"`
+	// "json" for the comparison result, or "trace" for the target trace annotated with the comparison.
+	Format string `form:"format"`
+}
+
+// handleCompare compares the traces of the same object in two time windows.
+func (server *server) handleCompare(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := compareQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	if query.DisplayMode == "" {
+		query.DisplayMode = "tree"
+	}
+
+	options := compare.DefaultOptions
+	if query.Threshold != 0 {
+		options.Threshold = query.Threshold
+	}
+	if query.MinDelta != "" {
+		if options.MinDelta, err = time.ParseDuration(query.MinDelta); err != nil {
+			metric.Error = metrics.MakeLabeledError("InvalidParam")
+			return 400, fmt.Errorf("invalid minDelta param %w", err)
+		}
+	}
+
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+
+	baseline, code, err := server.findTrace(reqCtx, metric, query.DisplayMode, traceQuery{
+		Cluster:   query.Cluster,
+		Resource:  query.Resource,
+		Namespace: query.Namespace,
+		Name:      query.Name,
+		Start:     query.BaselineStart,
+		End:       query.BaselineEnd,
+	})
+	if err != nil {
+		return code, fmt.Errorf("baseline: %w", err)
+	}
+	if baseline, err = server.getFullTrace(reqCtx, baseline); err != nil {
+		metric.Error = metrics.MakeLabeledError("TraceError")
+		return 500, fmt.Errorf("baseline: %w", err)
+	}
+
+	target, code, err := server.findTrace(reqCtx, metric, query.DisplayMode, traceQuery{
+		Cluster:   query.Cluster,
+		Resource:  query.Resource,
+		Namespace: query.Namespace,
+		Name:      query.Name,
+		Start:     query.TargetStart,
+		End:       query.TargetEnd,
+	})
+	if err != nil {
+		return code, fmt.Errorf("target: %w", err)
+	}
+	if target, err = server.getFullTrace(reqCtx, target); err != nil {
+		metric.Error = metrics.MakeLabeledError("TraceError")
+		return 500, fmt.Errorf("target: %w", err)
+	}
+
+	result := compare.Compare(baseline, target, options)
+
+	switch query.Format {
+	case "", "json":
+		ctx.JSON(200, result)
+	case "trace":
+		compare.Annotate(target, result)
+		ctx.JSON(200, uiconv.FromDomain(target))
+	default:
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("unknown format %q", query.Format)
+	}
+
+	return 0, nil
+}
+
+// getFullTrace fetches the trace listed by FindTraces again, since listed traces may not contain all spans and logs.
+func (server *server) getFullTrace(ctx context.Context, trace *model.Trace) (*model.Trace, error) {
+	if len(trace.Spans) == 0 {
+		return trace, nil
+	}
+
+	fullTrace, err := server.SpanReader.GetTrace(ctx, trace.Spans[0].TraceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trace %w", err)
+	}
+
+	return fullTrace, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaegertracing/jaeger/model"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+type diffQuery struct {
+	TraceId string `form:"traceId"`
+	SpanId  string `form:"spanId"`
+}
+
+type diffResponse struct {
+	Object             utilobject.Key   `json:"object"`
+	Verb               string           `json:"verb"`
+	OldResourceVersion string           `json:"oldResourceVersion,omitempty"`
+	NewResourceVersion string           `json:"newResourceVersion,omitempty"`
+	Patch              *diffcache.Patch `json:"patch,omitempty"`
+	// The object before and after the request in YAML, if the snapshot of the same resource version is still cached.
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// handleDiff returns the full object diff and snapshots of the audit event displayed as a span.
+func (server *server) handleDiff(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := diffQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	traceId, err := model.TraceIDFromString(query.TraceId)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid traceId param %w", err)
+	}
+	spanId, err := model.SpanIDFromString(query.SpanId)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid spanId param %w", err)
+	}
+
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+
+	trace, err := server.SpanReader.GetTrace(reqCtx, traceId)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("TraceError")
+		return 500, fmt.Errorf("failed to get trace %w", err)
+	}
+
+	span, objectSpan := findEventSpan(trace, spanId)
+	if span == nil || objectSpan == nil {
+		metric.Error = metrics.MakeLabeledError("NoSpanMatch")
+		return 404, fmt.Errorf("trace has no event span %v", spanId)
+	}
+
+	tags := model.KeyValues(span.Tags)
+	verb, _ := tags.FindByKey("tag")
+	oldRv, _ := tags.FindByKey("resourceVersion")
+	newRv, hasNewRv := tags.FindByKey("newResourceVersion")
+
+	resp := diffResponse{
+		Object:             zconstants.ObjectKeyFromSpan(objectSpan),
+		Verb:               verb.AsString(),
+		OldResourceVersion: oldRv.AsString(),
+		NewResourceVersion: newRv.AsString(),
+	}
+	if !server.Tenant.Allows(reqCtx, resp.Object) {
+		// respond the same as a missing span to avoid revealing the object
+		metric.Error = metrics.MakeLabeledError("NoSpanMatch")
+		return 404, fmt.Errorf("trace has no event span %v", spanId)
+	}
+
+	switch resp.Verb {
+	case audit.VerbUpdate, audit.VerbPatch:
+		var newRvPtr *string
+		if hasNewRv {
+			newRvPtr = &resp.NewResourceVersion
+		}
+
+		resp.Patch, err = server.DiffCache.Fetch(reqCtx, resp.Object, resp.OldResourceVersion, newRvPtr)
+		if err != nil {
+			metric.Error = metrics.MakeLabeledError("DiffCacheError")
+			return 500, fmt.Errorf("failed to fetch patch %w", err)
+		}
+		if resp.Patch == nil {
+			metric.Error = metrics.MakeLabeledError("NoPatch")
+			return 404, fmt.Errorf("patch of %s is no longer cached", resp.Object)
+		}
+		if resp.NewResourceVersion == "" {
+			resp.NewResourceVersion = resp.Patch.NewResourceVersion
+		}
+
+		// the object is only known in full at the start and the end of its lifecycle
+		if resp.Before, err = server.fetchSnapshotYaml(reqCtx, resp.Object, diffcache.SnapshotNameCreation, resp.OldResourceVersion); err != nil {
+			metric.Error = metrics.MakeLabeledError("DiffCacheError")
+			return 500, err
+		}
+		if resp.After, err = server.fetchSnapshotYaml(reqCtx, resp.Object, diffcache.SnapshotNameDeletion, resp.NewResourceVersion); err != nil {
+			metric.Error = metrics.MakeLabeledError("DiffCacheError")
+			return 500, err
+		}
+	case audit.VerbCreate:
+		if resp.After, err = server.fetchSnapshotYaml(reqCtx, resp.Object, diffcache.SnapshotNameCreation, ""); err != nil {
+			metric.Error = metrics.MakeLabeledError("DiffCacheError")
+			return 500, err
+		}
+	case audit.VerbDelete:
+		if resp.Before, err = server.fetchSnapshotYaml(reqCtx, resp.Object, diffcache.SnapshotNameDeletion, ""); err != nil {
+			metric.Error = metrics.MakeLabeledError("DiffCacheError")
+			return 500, err
+		}
+	default:
+		metric.Error = metrics.MakeLabeledError("UnsupportedVerb")
+		return 400, fmt.Errorf("span %v is a %q event without object diff", spanId, resp.Verb)
+	}
+
+	ctx.JSON(200, resp)
+	return 0, nil
+}
+
+// findEventSpan finds the span with the given ID and the object span that it belongs to.
+func findEventSpan(trace *model.Trace, spanId model.SpanID) (span *model.Span, objectSpan *model.Span) {
+	spanMap := make(map[model.SpanID]*model.Span, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spanMap[span.SpanID] = span
+	}
+
+	span = spanMap[spanId]
+	for ancestor, depth := span, 0; ancestor != nil && depth < len(spanMap); depth++ {
+		tags := model.KeyValues(ancestor.Tags)
+		_, hasResource := tags.FindByKey("resource")
+		_, hasName := tags.FindByKey("name")
+		if hasResource && hasName {
+			return span, ancestor
+		}
+		ancestor = spanMap[ancestor.ParentSpanID()]
+	}
+
+	return span, nil
+}
+
+// fetchSnapshotYaml returns the snapshot in YAML if it exists, is not redacted,
+// and has the expected resource version if it is nonempty.
+func (server *server) fetchSnapshotYaml(
+	ctx context.Context,
+	object utilobject.Key,
+	snapshotName string,
+	resourceVersion string,
+) (string, error) {
+	snapshot, err := server.DiffCache.FetchSnapshot(ctx, object, snapshotName)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s snapshot %w", snapshotName, err)
+	}
+
+	if snapshot == nil || snapshot.Redacted || resourceVersion != "" && snapshot.ResourceVersion != resourceVersion {
+		return "", nil
+	}
+
+	yamlBytes, err := yaml.JSONToYAML(snapshot.Value)
+	if err != nil {
+		return "", fmt.Errorf("cached %s snapshot is not valid JSON: %w", snapshotName, err)
+	}
+
+	return string(yamlBytes), nil
+}
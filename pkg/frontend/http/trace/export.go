@@ -0,0 +1,97 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaegertracing/jaeger/model"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/timeline"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type exportQuery struct {
+	traceQuery
+	// TraceId exports a trace opened in the Jaeger UI instead of searching the trace of an object.
+	TraceId string `form:"traceId"`
+	// "json", "yaml" or "text".
+	Format string `form:"format"`
+}
+
+// handleExport renders the events of a trace as a timeline.
+func (server *server) handleExport(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := exportQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	if query.DisplayMode == "" {
+		query.DisplayMode = "tree"
+	}
+
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+
+	var trace *model.Trace
+	if query.TraceId != "" {
+		traceId, err := model.TraceIDFromString(query.TraceId)
+		if err != nil {
+			metric.Error = metrics.MakeLabeledError("InvalidParam")
+			return 400, fmt.Errorf("invalid traceId param %w", err)
+		}
+
+		if trace, err = server.SpanReader.GetTrace(reqCtx, traceId); err != nil {
+			metric.Error = metrics.MakeLabeledError("TraceError")
+			return 404, fmt.Errorf("failed to get trace %w", err)
+		}
+	} else {
+		trace, code, err = server.findTrace(reqCtx, metric, query.DisplayMode, query.traceQuery)
+		if err != nil {
+			return code, err
+		}
+		if trace, err = server.getFullTrace(reqCtx, trace); err != nil {
+			metric.Error = metrics.MakeLabeledError("TraceError")
+			return 500, err
+		}
+	}
+
+	result := timeline.Build(trace)
+
+	switch query.Format {
+	case "", "json":
+		ctx.JSON(200, result)
+	case "yaml":
+		yamlBytes, err := yaml.Marshal(result)
+		if err != nil {
+			metric.Error = metrics.MakeLabeledError("MarshalError")
+			return 500, fmt.Errorf("cannot encode timeline: %w", err)
+		}
+		ctx.Data(200, "application/yaml", yamlBytes)
+	case "text":
+		ctx.Header("Content-Type", "text/plain; charset=utf-8")
+		ctx.Status(200)
+		if err := result.WriteText(ctx.Writer); err != nil {
+			return 500, fmt.Errorf("cannot write timeline: %w", err)
+		}
+	default:
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("unknown format %q", query.Format)
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/depgraph"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type graphQuery struct {
+	Cluster     string `form:"cluster"`
+	Group       string `form:"group"`
+	Resource    string `form:"resource"`
+	Namespace   string `form:"namespace"`
+	Start       string `form:"start"`
+	End         string `form:"end"`
+	Granularity string `form:"granularity"`
+}
+
+// handleGraph returns the graph of the relationships between objects observed by the linkers.
+func (server *server) handleGraph(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := graphQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	granularity := depgraph.Granularity(query.Granularity)
+	switch granularity {
+	case "":
+		granularity = depgraph.GranularityObject
+	case depgraph.GranularityObject, depgraph.GranularityResource:
+	default:
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("granularity must be %q or %q", depgraph.GranularityObject, depgraph.GranularityResource)
+	}
+
+	startTimestamp, err := time.Parse(time.RFC3339, query.Start)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+		return 400, fmt.Errorf("invalid timestamp for start param %w", err)
+	}
+
+	endTimestamp, err := time.Parse(time.RFC3339, query.End)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+		return 400, fmt.Errorf("invalid timestamp for end param %w", err)
+	}
+
+	graph, err := server.DepGraph.Build(server.Tenant.RequestContext(ctx.Request), depgraph.Query{
+		Cluster:     query.Cluster,
+		Group:       query.Group,
+		Resource:    query.Resource,
+		Namespace:   query.Namespace,
+		Start:       startTimestamp,
+		End:         endTimestamp,
+		Granularity: granularity,
+	})
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("GraphError")
+		return 500, err
+	}
+
+	ctx.JSON(200, graph)
+	return 0, nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"sigs.k8s.io/yaml"
+
+	diffreplay "github.com/kubewharf/kelemetry/pkg/diff/replay"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+type objectQuery struct {
+	Cluster   string `form:"cluster"`
+	Group     string `form:"group"`
+	Resource  string `form:"resource"`
+	Namespace string `form:"namespace"`
+	Name      string `form:"name"`
+	Time      string `form:"time"`
+	// "json" for the reconstruction details, or "yaml" for the object only.
+	Format string `form:"format"`
+}
+
+type objectResponse struct {
+	Object         utilobject.Key `json:"object"`
+	Time           time.Time      `json:"time"`
+	Base           string         `json:"base"`
+	AppliedPatches int            `json:"appliedPatches"`
+	Warnings       []string       `json:"warnings,omitempty"`
+	Yaml           string         `json:"yaml"`
+}
+
+// handleObject reconstructs the object at the given time from the diff cache.
+func (server *server) handleObject(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := objectQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	if query.Cluster == "" || query.Resource == "" || query.Name == "" {
+		metric.Error = metrics.MakeLabeledError("EmptyParam")
+		return 400, fmt.Errorf("cluster or resource or name is empty")
+	}
+
+	at, err := time.Parse(time.RFC3339, query.Time)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+		return 400, fmt.Errorf("invalid timestamp for time param %w", err)
+	}
+
+	object := utilobject.Key{
+		Cluster:   query.Cluster,
+		Group:     query.Group,
+		Resource:  query.Resource,
+		Namespace: query.Namespace,
+		Name:      query.Name,
+	}
+
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+	if !server.Tenant.Allows(reqCtx, object) {
+		// respond the same as a missing object to avoid revealing its existence
+		metric.Error = metrics.MakeLabeledError("NoSnapshot")
+		return 404, diffreplay.ErrNoSnapshot
+	}
+
+	result, err := diffreplay.Reconstruct(reqCtx, server.DiffCache, object, at, server.options.replayMaxPatches)
+	if err != nil {
+		switch {
+		case errors.Is(err, diffreplay.ErrNoSnapshot):
+			metric.Error = metrics.MakeLabeledError("NoSnapshot")
+			return 404, err
+		case errors.Is(err, diffreplay.ErrNotCreated):
+			metric.Error = metrics.MakeLabeledError("NotCreated")
+			return 404, err
+		case errors.Is(err, diffreplay.ErrRedacted):
+			metric.Error = metrics.MakeLabeledError("Redacted")
+			return 403, err
+		default:
+			metric.Error = metrics.MakeLabeledError("ReplayError")
+			return 500, err
+		}
+	}
+
+	yamlBytes, err := yaml.Marshal(result.Object.Object)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("ReplayError")
+		return 500, fmt.Errorf("cannot encode object %w", err)
+	}
+
+	switch query.Format {
+	case "", "json":
+		ctx.JSON(200, objectResponse{
+			Object:         object,
+			Time:           at,
+			Base:           result.Base,
+			AppliedPatches: result.AppliedPatches,
+			Warnings:       result.Warnings,
+			Yaml:           string(yamlBytes),
+		})
+	case "yaml":
+		ctx.Data(200, "application/yaml", yamlBytes)
+	default:
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("unknown format %q", query.Format)
+	}
+
+	return 0, nil
+}
@@ -16,6 +16,7 @@ package trace
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -23,15 +24,20 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jaegertracing/jaeger/model"
 	uiconv "github.com/jaegertracing/jaeger/model/converter/json"
+	uimodel "github.com/jaegertracing/jaeger/model/json"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"k8s.io/utils/clock"
 
+	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
 	"github.com/kubewharf/kelemetry/pkg/frontend/clusterlist"
+	"github.com/kubewharf/kelemetry/pkg/frontend/depgraph"
 	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
 	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
 	pkghttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
@@ -42,11 +48,18 @@ func init() {
 }
 
 type options struct {
-	enable bool
+	enable           bool
+	replayMaxPatches int
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.BoolVar(&options.enable, "trace-server-enable", false, "enable trace server for frontend")
+	fs.IntVar(
+		&options.replayMaxPatches,
+		"trace-server-replay-max-patches",
+		1000,
+		"maximum number of cached patches replayed to reconstruct an object at a past time",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return &options.enable }
@@ -59,6 +72,10 @@ type server struct {
 	SpanReader       jaegerreader.Interface
 	ClusterList      clusterlist.Lister
 	TransformConfigs tfconfig.Provider
+	Tenant           *tenant.Filter
+	Auth             *auth.Authenticator
+	DiffCache        diffcache.Cache
+	DepGraph         *depgraph.Reader
 
 	RequestMetric *metrics.Metric[*requestMetric]
 }
@@ -74,7 +91,7 @@ func (server *server) Options() manager.Options {
 }
 
 func (server *server) Init() error {
-	server.Server.Routes().GET("/extensions/api/v1/trace", func(ctx *gin.Context) {
+	server.Server.Routes().GET("/extensions/api/v1/trace", server.Auth.Wrap(func(ctx *gin.Context) {
 		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
 		defer shutdown.RecoverPanic(logger)
 		metric := &requestMetric{}
@@ -88,7 +105,97 @@ func (server *server) Init() error {
 			_, _ = ctx.Writer.WriteString(err.Error())
 			ctx.Abort()
 		}
-	})
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/traces", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/traces %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleTraces(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/compare", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/compare %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleCompare(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/diff", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/diff %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleDiff(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/object", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/object %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleObject(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/graph", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/graph %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleGraph(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
+	server.Server.Routes().GET("/extensions/api/v1/export", server.Auth.Wrap(func(ctx *gin.Context) {
+		logger := server.Logger.WithField("source", ctx.Request.RemoteAddr)
+		defer shutdown.RecoverPanic(logger)
+		metric := &requestMetric{}
+		defer server.RequestMetric.DeferCount(server.Clock.Now(), metric)
+
+		logger.WithField("query", ctx.Request.URL.RawQuery).Infof("GET /extensions/api/v1/export %v", ctx.Request.URL.Query())
+
+		if code, err := server.handleExport(ctx, metric); err != nil {
+			logger.WithError(err).Error()
+			ctx.Status(code)
+			_, _ = ctx.Writer.WriteString(err.Error())
+			ctx.Abort()
+		}
+	}))
 
 	return nil
 }
@@ -109,7 +216,9 @@ func (server *server) handleTrace(ctx *gin.Context, metric *requestMetric) (code
 		query.DisplayMode = "tracing"
 	}
 
-	trace, code, err := server.findTrace(metric, query.DisplayMode, query)
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+
+	trace, code, err := server.findTrace(reqCtx, metric, query.DisplayMode, query)
 	if err != nil {
 		return code, err
 	}
@@ -121,7 +230,7 @@ func (server *server) handleTrace(ctx *gin.Context, metric *requestMetric) (code
 		}
 	}
 	if !hasLogs && len(trace.Spans) > 0 {
-		trace, err = server.SpanReader.GetTrace(context.Background(), trace.Spans[0].TraceID)
+		trace, err = server.SpanReader.GetTrace(reqCtx, trace.Spans[0].TraceID)
 		if err != nil {
 			metric.Error = metrics.MakeLabeledError("TraceError")
 			return 500, fmt.Errorf("failed to find trace ids %w", err)
@@ -163,7 +272,12 @@ type traceQuery struct {
 	DisplayMode string `form:"displayMode"`
 }
 
-func (server *server) findTrace(metric *requestMetric, serviceName string, query traceQuery) (trace *model.Trace, code int, err error) {
+func (server *server) findTrace(
+	ctx context.Context,
+	metric *requestMetric,
+	serviceName string,
+	query traceQuery,
+) (trace *model.Trace, code int, err error) {
 	cluster := query.Cluster
 	resource := query.Resource
 	namespace := query.Namespace
@@ -213,7 +327,7 @@ func (server *server) findTrace(metric *requestMetric, serviceName string, query
 		StartTimeMax:  endTimestamp,
 		NumTraces:     20,
 	}
-	traces, err := server.SpanReader.FindTraces(context.Background(), parameters)
+	traces, err := server.SpanReader.FindTraces(ctx, parameters)
 	if err != nil {
 		metric.Error = metrics.MakeLabeledError("TraceError")
 		return nil, 500, fmt.Errorf("failed to find trace ids %w", err)
@@ -229,3 +343,99 @@ func (server *server) findTrace(metric *requestMetric, serviceName string, query
 	}
 	return traces[0], 200, nil
 }
+
+type tracesQuery struct {
+	Cluster     string   `form:"cluster"`
+	Group       string   `form:"group"`
+	Resource    string   `form:"resource"`
+	Namespace   string   `form:"namespace"`
+	Name        string   `form:"name"`
+	Tags        []string `form:"tag"`
+	Start       string   `form:"start"`
+	End         string   `form:"end"`
+	Limit       int      `form:"limit"`
+	PageToken   string   `form:"pageToken"`
+	DisplayMode string   `form:"displayMode"`
+}
+
+type tracesResponse struct {
+	Data          []*uimodel.Trace `json:"data"`
+	NextPageToken string           `json:"nextPageToken,omitempty"`
+}
+
+// handleTraces lists traces matching the query page by page.
+// Pass the nextPageToken of a response as the pageToken of the next request with the same query to get the next page.
+func (server *server) handleTraces(ctx *gin.Context, metric *requestMetric) (code int, err error) {
+	query := tracesQuery{}
+	if err := ctx.BindQuery(&query); err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidParam")
+		return 400, fmt.Errorf("invalid param %w", err)
+	}
+
+	if query.DisplayMode == "" {
+		query.DisplayMode = "tracing"
+	}
+
+	startTimestamp, err := time.Parse(time.RFC3339, query.Start)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+		return 400, fmt.Errorf("invalid timestamp for start param %w", err)
+	}
+
+	endTimestamp, err := time.Parse(time.RFC3339, query.End)
+	if err != nil {
+		metric.Error = metrics.MakeLabeledError("InvalidTimestamp")
+		return 400, fmt.Errorf("invalid timestamp for end param %w", err)
+	}
+
+	tags := map[string]string{}
+	for _, tag := range query.Tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			metric.Error = metrics.MakeLabeledError("InvalidParam")
+			return 400, fmt.Errorf("tag %q is not in the form key=value", tag)
+		}
+		tags[key] = value
+	}
+	for key, value := range map[string]string{
+		"group":     query.Group,
+		"resource":  query.Resource,
+		"namespace": query.Namespace,
+		"name":      query.Name,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+
+	parameters := &spanstore.TraceQueryParameters{
+		ServiceName:   query.DisplayMode,
+		OperationName: query.Cluster,
+		Tags:          tags,
+		StartTimeMin:  startTimestamp,
+		StartTimeMax:  endTimestamp,
+		NumTraces:     query.Limit,
+	}
+
+	reqCtx := server.Tenant.RequestContext(ctx.Request)
+	traces, nextPageToken, err := server.SpanReader.FindTracesPage(reqCtx, parameters, query.PageToken)
+	if err != nil {
+		if errors.Is(err, jaegerreader.ErrInvalidPageToken) {
+			metric.Error = metrics.MakeLabeledError("InvalidPageToken")
+			return 400, err
+		}
+		metric.Error = metrics.MakeLabeledError("TraceError")
+		return 500, fmt.Errorf("failed to find traces %w", err)
+	}
+
+	resp := tracesResponse{
+		Data:          make([]*uimodel.Trace, len(traces)),
+		NextPageToken: nextPageToken,
+	}
+	for i, trace := range traces {
+		resp.Data[i] = uiconv.FromDomain(trace)
+	}
+
+	ctx.JSON(200, resp)
+	return 0, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Resolves the "selector" search tag to the objects whose current labels match it,
+// so that traces can be searched with label selectors instead of exact object names.
+package labelselector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("frontend-label-selector", manager.Ptr(&resolver{}), &manager.List[Resolver]{})
+}
+
+// Tag is the search tag that contains the label selector, e.g. "app=nginx,env=prod".
+const Tag = "selector"
+
+// Query selects objects of a resource by their current labels.
+type Query struct {
+	Cluster  string
+	Group    string
+	Resource string
+	// Namespace is empty to select objects in all namespaces.
+	Namespace string
+	Selector  string
+}
+
+// Resolver resolves label selectors to objects.
+type Resolver interface {
+	// Resolve returns the keys of the objects that currently match the query.
+	Resolve(ctx context.Context, query Query) ([]utilobject.Key, error)
+}
+
+type options struct {
+	enable     bool
+	maxObjects int64
+	cacheTtl   time.Duration
+	cacheSize  int
+	timeout    time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"frontend-label-selector-enable",
+		false,
+		"support the 'selector' search tag by listing objects with the label selector from the cluster; "+
+			"requires the list permission on the searched resources",
+	)
+	fs.Int64Var(&options.maxObjects, "frontend-label-selector-max-objects", 20, "maximum number of objects to search traces for per label selector")
+	fs.DurationVar(&options.cacheTtl, "frontend-label-selector-cache-ttl", time.Minute, "duration to cache the objects matching each label selector")
+	fs.IntVar(&options.cacheSize, "frontend-label-selector-cache-size", 1000, "maximum number of cached label selector results")
+	fs.DurationVar(&options.timeout, "frontend-label-selector-timeout", time.Second*10, "timeout for listing objects with a label selector")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type resolver struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Clients   k8s.Clients
+	Discovery discovery.DiscoveryCache
+
+	ResolveMetric *metrics.Metric[*resolveMetric]
+
+	cache *cache.LRUExpireCache
+}
+
+type resolveMetric struct {
+	Cluster string
+	Hit     bool
+	Error   metrics.LabeledError
+}
+
+func (*resolveMetric) MetricName() string { return "frontend_label_selector_resolve" }
+
+var _ Resolver = &resolver{}
+
+func (resolver *resolver) Options() manager.Options { return &resolver.options }
+
+func (resolver *resolver) Init() error {
+	resolver.cache = cache.NewLRUExpireCacheWithClock(resolver.options.cacheSize, resolver.Clock)
+	return nil
+}
+
+func (resolver *resolver) Start(ctx context.Context) error { return nil }
+func (resolver *resolver) Close(ctx context.Context) error { return nil }
+
+func (resolver *resolver) Resolve(ctx context.Context, query Query) (_ []utilobject.Key, err error) {
+	metric := &resolveMetric{Cluster: query.Cluster}
+	defer resolver.ResolveMetric.DeferCount(resolver.Clock.Now(), metric)
+
+	if keys, cached := resolver.cache.Get(query); cached {
+		metric.Hit = true
+		return keys.([]utilobject.Key), nil
+	}
+
+	keys, err := resolver.list(ctx, query)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "List")
+		return nil, err
+	}
+
+	resolver.cache.Add(query, keys, resolver.options.cacheTtl)
+	return keys, nil
+}
+
+func (resolver *resolver) list(ctx context.Context, query Query) ([]utilobject.Key, error) {
+	selector, err := labels.Parse(query.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector %q: %w", query.Selector, err)
+	}
+
+	cdc, err := resolver.Discovery.ForCluster(query.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get discovery for cluster %q: %w", query.Cluster, err)
+	}
+
+	gvr, found := findResource(cdc.GetAll(), query.Group, query.Resource)
+	if !found {
+		return nil, fmt.Errorf("resource %q is not served in cluster %q", schema.GroupResource{Group: query.Group, Resource: query.Resource}, query.Cluster)
+	}
+
+	client, err := resolver.Clients.Cluster(query.Cluster)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get client for cluster %q: %w", query.Cluster, err)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(ctx, resolver.options.timeout)
+	defer cancelFunc()
+
+	list, err := client.DynamicClientFor(k8s.PurposeObjectFetch).Resource(gvr).Namespace(query.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+		Limit:         resolver.options.maxObjects,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list %s with selector %q: %w", gvr.Resource, selector.String(), err)
+	}
+
+	keys := make([]utilobject.Key, 0, len(list.Items))
+	for _, item := range list.Items {
+		// the limit is only a hint to the apiserver
+		if int64(len(keys)) >= resolver.options.maxObjects {
+			break
+		}
+
+		keys = append(keys, utilobject.FromObject(&item, query.Cluster, gvr).Key)
+	}
+
+	return keys, nil
+}
+
+// findResource returns the preferred version of the resource.
+func findResource(details discovery.GvrDetails, group string, resource string) (schema.GroupVersionResource, bool) {
+	for gvr := range details {
+		if gvr.Group == group && gvr.Resource == resource {
+			return gvr, true
+		}
+	}
+
+	return schema.GroupVersionResource{}, false
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package labelselector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+type mockDiscovery struct {
+	discovery.ClusterDiscoveryCache
+	details discovery.GvrDetails
+}
+
+func (mock *mockDiscovery) ForCluster(name string) (discovery.ClusterDiscoveryCache, error) {
+	if name != "prod" {
+		return nil, fmt.Errorf("cluster %q not found", name)
+	}
+	return mock, nil
+}
+
+func (mock *mockDiscovery) GetAll() discovery.GvrDetails { return mock.details }
+
+func newDeployment(name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	metricsClient, metricsOutput := metrics.NewMock(clock)
+
+	resolver := &resolver{
+		options: options{maxObjects: 10, cacheTtl: time.Minute, cacheSize: 10, timeout: time.Second},
+		Logger:  logrus.New(),
+		Clock:   clock,
+		Clients: &k8s.MockClients{
+			TargetClusterName: "prod",
+			Clients: map[string]*k8s.MockClient{
+				"prod": {
+					Name: "prod",
+					Objects: []runtime.Object{
+						newDeployment("nginx", map[string]string{"app": "nginx", "env": "prod"}),
+						newDeployment("nginx-canary", map[string]string{"app": "nginx", "env": "canary"}),
+						newDeployment("redis", map[string]string{"app": "redis", "env": "prod"}),
+					},
+				},
+			},
+		},
+		Discovery: &mockDiscovery{details: discovery.GvrDetails{
+			appsv1.SchemeGroupVersion.WithResource("deployments"): &metav1.APIResource{Name: "deployments"},
+		}},
+		ResolveMetric: metrics.New[*resolveMetric](metricsClient),
+	}
+	assert.NoError(resolver.Init())
+
+	query := Query{Cluster: "prod", Group: "apps", Resource: "deployments", Selector: "app=nginx,env=prod"}
+
+	for i := 0; i < 2; i++ {
+		keys, err := resolver.Resolve(context.Background(), query)
+		assert.NoError(err)
+		assert.Equal([]utilobject.Key{{Cluster: "prod", Group: "apps", Resource: "deployments", Namespace: "default", Name: "nginx"}}, keys)
+	}
+
+	hits := metricsOutput.Get("frontend_label_selector_resolve", map[string]string{"cluster": "prod", "hit": "true", "error": "<nil>"})
+	assert.Equal(float64(1), hits.Int, metricsOutput.PrintAll())
+
+	_, err := resolver.Resolve(context.Background(), Query{Cluster: "prod", Group: "apps", Resource: "statefulsets", Selector: "app=nginx"})
+	assert.Error(err)
+
+	_, err = resolver.Resolve(context.Background(), Query{Cluster: "prod", Group: "apps", Resource: "deployments", Selector: "app in nginx"})
+	assert.Error(err)
+}
+
+func TestFindResource(t *testing.T) {
+	assert := assert.New(t)
+
+	details := discovery.GvrDetails{
+		{Group: "", Version: "v1", Resource: "pods"}:            &metav1.APIResource{},
+		{Group: "", Version: "v1", Resource: "pods/status"}:     &metav1.APIResource{},
+		{Group: "apps", Version: "v1", Resource: "deployments"}: &metav1.APIResource{},
+	}
+
+	gvr, found := findResource(details, "", "pods")
+	assert.True(found)
+	assert.Equal(schema.GroupVersionResource{Version: "v1", Resource: "pods"}, gvr)
+
+	_, found = findResource(details, "", "deployments")
+	assert.False(found)
+}
@@ -28,9 +28,16 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/kubewharf/kelemetry/pkg/frontend/depgraph"
 	jaegerreader "github.com/kubewharf/kelemetry/pkg/frontend/reader"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -39,13 +46,35 @@ func init() {
 }
 
 type options struct {
-	enable  bool
-	address string
+	enable        bool
+	address       string
+	maxChunkBytes int
+	maxChunkSpans int
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.BoolVar(&options.enable, "jaeger-storage-plugin-enable", false, "enable jaeger storage plugin")
 	fs.StringVar(&options.address, "jaeger-storage-plugin-address", ":17271", "storage plugin grpc server bind address")
+	fs.IntVar(
+		&options.maxChunkBytes,
+		"jaeger-storage-plugin-max-chunk-bytes",
+		1<<20,
+		"maximum size of each message streaming the spans of a trace to Jaeger query, "+
+			"which must be less than the gRPC message size limit of Jaeger query (4 MiB by default)",
+	)
+	fs.IntVar(
+		&options.maxChunkSpans,
+		"jaeger-storage-plugin-max-chunk-spans",
+		1000,
+		"maximum number of spans in each message streaming the spans of a trace to Jaeger query",
+	)
+}
+
+func (options *options) Validate() error {
+	if options.maxChunkBytes <= 0 || options.maxChunkSpans <= 0 {
+		return fmt.Errorf("--jaeger-storage-plugin-max-chunk-bytes and --jaeger-storage-plugin-max-chunk-spans must be positive")
+	}
+	return nil
 }
 
 func (options *options) EnableFlag() *bool { return &options.enable }
@@ -54,8 +83,13 @@ type Plugin struct {
 	options     options
 	Logger      logrus.FieldLogger
 	SpanReader_ jaegerreader.Interface
+	DepGraph    *depgraph.Reader
+	Tenant      *tenant.Filter
+	Auth        *auth.Authenticator
+	Mtls        *mtls.Provider
 
-	grpcServer *grpc.Server
+	grpcServer   *grpc.Server
+	healthServer *health.Server
 }
 
 var _ manager.Component = &Plugin{}
@@ -80,13 +114,27 @@ func (plugin *Plugin) Init() error {
 }
 
 func (plugin *Plugin) Start(ctx context.Context) error {
-	sharedPlugin := shared.StorageGRPCPlugin{
-		Impl: plugin,
+	serverOptions := plugin.Mtls.GrpcServerOptions()
+	// authentication must run before the tenant interceptor, which prefers the tenant of the authenticated user
+	serverOptions = append(serverOptions, plugin.Auth.ServerOptions()...)
+	serverOptions = append(serverOptions, plugin.Tenant.ServerOptions()...)
+	grpcServer := grpc.NewServer(serverOptions...)
+	handler := &chunkingHandler{
+		GRPCHandler: shared.NewGRPCHandlerWithPlugins(plugin, nil, nil),
+		plugin:      plugin,
 	}
-	grpcServer := grpc.NewServer()
-	if err := sharedPlugin.GRPCServer(nil, grpcServer); err != nil {
-		return fmt.Errorf("cannot create grpc query server: %w", err)
+	handler.register(grpcServer)
+
+	// The Jaeger remote storage API (the "grpc" storage type that replaces "grpc-plugin", and the Jaeger v2 grpc storage backend)
+	// uses the same services as the storage plugin over a network connection,
+	// with the standard gRPC health and reflection services like jaeger-remote-storage.
+	// Health and reflection calls are exempt from the authentication and tenant interceptors.
+	healthServer := health.NewServer()
+	for serviceName := range grpcServer.GetServiceInfo() {
+		healthServer.SetServingStatus(serviceName, healthpb.HealthCheckResponse_SERVING)
 	}
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
 
 	listener, err := net.Listen("tcp", plugin.options.address)
 	if err != nil {
@@ -102,16 +150,23 @@ func (plugin *Plugin) Start(ctx context.Context) error {
 	}()
 
 	plugin.grpcServer = grpcServer
+	plugin.healthServer = healthServer
 
 	return nil
 }
 
 func (plugin *Plugin) Close(ctx context.Context) error {
+	plugin.healthServer.Shutdown()
 	plugin.grpcServer.Stop()
 	return nil
 }
 
-func (plugin *Plugin) DependencyReader() dependencystore.Reader { return nilDepReader{} }
+func (plugin *Plugin) DependencyReader() dependencystore.Reader {
+	if plugin.DepGraph.JaegerEnabled() {
+		return plugin.DepGraph
+	}
+	return nilDepReader{}
+}
 
 func (plugin *Plugin) SpanReader() spanstore.Reader { return plugin.SpanReader_ }
 
@@ -0,0 +1,163 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Hides objects from frontend users who cannot `get` them in their cluster,
+// so that traces and diffs do not expose objects that RBAC would deny.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("frontend-rbac", manager.Ptr(&authorizer{}), &manager.List[tenant.Authorizer]{})
+}
+
+type options struct {
+	enable    bool
+	verb      string
+	cacheTtl  time.Duration
+	cacheSize int
+	timeout   time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"frontend-rbac-enable",
+		false,
+		"hide objects that the authenticated user cannot access in their cluster, checked with SubjectAccessReview",
+	)
+	fs.StringVar(&options.verb, "frontend-rbac-verb", "get", "verb that the user must be allowed to perform on the object")
+	fs.DurationVar(&options.cacheTtl, "frontend-rbac-cache-ttl", time.Minute, "duration to cache each access review result")
+	fs.IntVar(&options.cacheSize, "frontend-rbac-cache-size", 10000, "maximum number of cached access review results")
+	fs.DurationVar(&options.timeout, "frontend-rbac-timeout", time.Second*5, "timeout for each SubjectAccessReview request")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type authorizer struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+	Auth    *auth.Authenticator
+
+	ReviewMetric *metrics.Metric[*reviewMetric]
+
+	cache *cache.LRUExpireCache
+}
+
+type reviewMetric struct {
+	Cluster string
+	Allowed bool
+	Error   metrics.LabeledError
+}
+
+func (*reviewMetric) MetricName() string { return "frontend_rbac_review" }
+
+type cacheKey struct {
+	user   string
+	groups string
+	object utilobject.Key
+}
+
+var _ tenant.Authorizer = &authorizer{}
+
+func (authorizer *authorizer) Options() manager.Options { return &authorizer.options }
+
+func (authorizer *authorizer) Init() error {
+	if !authorizer.Auth.Enabled() {
+		return fmt.Errorf("--frontend-rbac-enable requires --http-auth-enable to identify users")
+	}
+
+	authorizer.cache = cache.NewLRUExpireCacheWithClock(authorizer.options.cacheSize, authorizer.Clock)
+	return nil
+}
+
+func (authorizer *authorizer) Start(ctx context.Context) error { return nil }
+func (authorizer *authorizer) Close(ctx context.Context) error { return nil }
+
+func (authorizer *authorizer) Authorize(ctx context.Context, key utilobject.Key) bool {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return false
+	}
+
+	cacheKey := cacheKey{user: user.Name, groups: strings.Join(user.Groups, "\n"), object: key}
+	if allowed, cached := authorizer.cache.Get(cacheKey); cached {
+		return allowed.(bool)
+	}
+
+	metric := &reviewMetric{Cluster: key.Cluster}
+	defer authorizer.ReviewMetric.DeferCount(authorizer.Clock.Now(), metric)
+
+	allowed, err := authorizer.review(ctx, user, key)
+	if err != nil {
+		// do not cache errors so that transient failures are retried
+		authorizer.Logger.WithError(err).WithFields(key.AsFields("object")).WithField("user", user.Name).Warn("cannot review access")
+		metric.Error = metrics.LabelError(err, "Review")
+		return false
+	}
+
+	metric.Allowed = allowed
+	authorizer.cache.Add(cacheKey, allowed, authorizer.options.cacheTtl)
+	return allowed
+}
+
+func (authorizer *authorizer) review(ctx context.Context, user *auth.User, key utilobject.Key) (bool, error) {
+	client, err := authorizer.Clients.Cluster(key.Cluster)
+	if err != nil {
+		return false, fmt.Errorf("cannot get client for cluster: %w", err)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(ctx, authorizer.options.timeout)
+	defer cancelFunc()
+
+	review, err := client.KubernetesClient().AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Name,
+			Groups: user.Groups,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: key.Namespace,
+				Verb:      authorizer.options.verb,
+				Group:     key.Group,
+				Resource:  key.Resource,
+				Name:      key.Name,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return review.Status.Allowed, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func TestAuthorize(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	client := &k8s.MockClient{Name: "prod"}
+	reviews := 0
+	client.KubernetesClient().(*k8sfake.Clientset).PrependReactor(
+		"create", "subjectaccessreviews",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			reviews++
+			review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+			attrs := review.Spec.ResourceAttributes
+			review.Status.Allowed = review.Spec.User == "alice" && attrs.Verb == "get" && attrs.Namespace == "payments"
+			return true, review, nil
+		},
+	)
+
+	authorizer := &authorizer{
+		options:      options{verb: "get", cacheTtl: time.Minute, timeout: time.Second},
+		Logger:       logger,
+		Clock:        clock,
+		Clients:      &k8s.MockClients{TargetClusterName: "prod", Clients: map[string]*k8s.MockClient{"prod": client}},
+		ReviewMetric: metrics.New[*reviewMetric](metricsClient),
+		cache:        cache.NewLRUExpireCacheWithClock(10, clock),
+	}
+
+	alice := auth.WithUser(context.Background(), &auth.User{Name: "alice"})
+	bob := auth.WithUser(context.Background(), &auth.User{Name: "bob"})
+	payments := utilobject.Key{Cluster: "prod", Resource: "pods", Namespace: "payments", Name: "web"}
+	billing := utilobject.Key{Cluster: "prod", Resource: "pods", Namespace: "billing", Name: "web"}
+
+	assert.True(authorizer.Authorize(alice, payments))
+	assert.False(authorizer.Authorize(alice, billing))
+	assert.False(authorizer.Authorize(bob, payments))
+	assert.Equal(3, reviews)
+
+	// results are cached per user and object
+	assert.True(authorizer.Authorize(alice, payments))
+	assert.Equal(3, reviews)
+
+	clock.Step(time.Minute * 2)
+	assert.True(authorizer.Authorize(alice, payments))
+	assert.Equal(4, reviews)
+
+	// unknown clusters and unauthenticated requests are denied
+	assert.False(authorizer.Authorize(alice, utilobject.Key{Cluster: "staging", Resource: "pods", Namespace: "payments", Name: "web"}))
+	assert.False(authorizer.Authorize(context.Background(), payments))
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"strings"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+)
+
+// identityTagAliases maps the tag keys accepted in trace search to the identity tags set on audit event spans.
+var identityTagAliases = map[string]string{
+	"username":        "username",
+	"user":            "username",
+	"audit.username":  "username",
+	"actor":           "actor",
+	"audit.actor":     "actor",
+	"actorType":       "actorType",
+	"audit.actorType": "actorType",
+}
+
+// serviceAccountTag is a search-only tag in the form "namespace/name" that matches the username of a service account.
+const serviceAccountTag = "serviceaccount"
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// identityFilter matches traces with an event span whose identity tag starts with a prefix.
+type identityFilter struct {
+	key    string
+	prefix string
+}
+
+// extractIdentityFilters rewrites identity tags in the search query to the tags stored on event spans.
+//
+// Exact values are kept in the query for the backend to match.
+// Values ending with "*" are removed from the query and returned as prefix filters,
+// since backends only support exact tag matches.
+func extractIdentityFilters(tags map[string]string) []identityFilter {
+	aliases := make([]string, 0, len(tags))
+	for alias := range tags {
+		aliases = append(aliases, alias)
+	}
+
+	var filters []identityFilter
+
+	for _, alias := range aliases {
+		value := tags[alias]
+		key, isIdentity := identityTagAliases[alias]
+		if alias == serviceAccountTag {
+			key, isIdentity = "username", true
+			value = serviceAccountPrefix + strings.Replace(value, "/", ":", 1)
+		}
+		if !isIdentity {
+			continue
+		}
+
+		delete(tags, alias)
+
+		if prefix, isPrefix := strings.CutSuffix(value, "*"); isPrefix {
+			filters = append(filters, identityFilter{key: key, prefix: prefix})
+		} else {
+			tags[key] = value
+		}
+	}
+
+	return filters
+}
+
+// filterByIdentity retains the traces that match all filters.
+func filterByIdentity(tts []*jaegerbackend.TraceThumbnail, filters []identityFilter) []*jaegerbackend.TraceThumbnail {
+	if len(filters) == 0 {
+		return tts
+	}
+
+	retained := make([]*jaegerbackend.TraceThumbnail, 0, len(tts))
+	for _, tt := range tts {
+		spans := tt.Spans.GetSpans()
+
+		matchesAll := true
+		for _, filter := range filters {
+			if !filter.matchesAny(spans) {
+				matchesAll = false
+				break
+			}
+		}
+
+		if matchesAll {
+			retained = append(retained, tt)
+		}
+	}
+
+	return retained
+}
+
+func (filter identityFilter) matchesAny(spans []*model.Span) bool {
+	for _, span := range spans {
+		if tag, exists := model.KeyValues(span.Tags).FindByKey(filter.key); exists && strings.HasPrefix(tag.AsString(), filter.prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+)
+
+func TestExtractIdentityFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := map[string]string{
+		"resource":    "deployments",
+		"user":        "alice",
+		"audit.actor": "deployment-controller",
+	}
+	assert.Empty(extractIdentityFilters(tags))
+	assert.Equal(map[string]string{
+		"resource": "deployments",
+		"username": "alice",
+		"actor":    "deployment-controller",
+	}, tags)
+
+	tags = map[string]string{"serviceaccount": "kube-system/replicaset-controller"}
+	assert.Empty(extractIdentityFilters(tags))
+	assert.Equal(map[string]string{"username": "system:serviceaccount:kube-system:replicaset-controller"}, tags)
+
+	tags = map[string]string{"serviceaccount": "kube-system/*", "actorType": "controller"}
+	assert.Equal([]identityFilter{{key: "username", prefix: "system:serviceaccount:kube-system:"}}, extractIdentityFilters(tags))
+	assert.Equal(map[string]string{"actorType": "controller"}, tags)
+
+	assert.Empty(extractIdentityFilters(nil))
+}
+
+func newIdentityThumbnail(id uint64, usernames ...string) *jaegerbackend.TraceThumbnail {
+	traceId := model.NewTraceID(id, id)
+	spans := []*model.Span{{TraceID: traceId, SpanID: model.SpanID(1)}}
+	for i, username := range usernames {
+		spans = append(spans, &model.Span{
+			TraceID:    traceId,
+			SpanID:     model.SpanID(i + 2),
+			References: []model.SpanRef{model.NewChildOfRef(traceId, model.SpanID(1))},
+			Tags:       []model.KeyValue{model.String("username", username)},
+		})
+	}
+
+	return &jaegerbackend.TraceThumbnail{Identifier: id, Spans: tftree.NewSpanTree(spans)}
+}
+
+func TestFilterByIdentity(t *testing.T) {
+	assert := assert.New(t)
+
+	tts := []*jaegerbackend.TraceThumbnail{
+		newIdentityThumbnail(1, "alice"),
+		newIdentityThumbnail(2, "bob", "system:serviceaccount:kube-system:replicaset-controller"),
+		newIdentityThumbnail(3),
+	}
+
+	assert.Equal(tts, filterByIdentity(tts, nil))
+
+	retained := filterByIdentity(tts, []identityFilter{{key: "username", prefix: "system:serviceaccount:kube-system:"}})
+	assert.Equal([]*jaegerbackend.TraceThumbnail{tts[1]}, retained)
+
+	retained = filterByIdentity(tts, []identityFilter{
+		{key: "username", prefix: "system:serviceaccount:"},
+		{key: "username", prefix: "alice"},
+	})
+	assert.Empty(retained)
+}
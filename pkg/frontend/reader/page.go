@@ -0,0 +1,160 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+)
+
+// ErrInvalidPageToken is returned when the page token was not returned by a search with the same time range.
+var ErrInvalidPageToken = fmt.Errorf("invalid page token")
+
+// pageCursor is the position where the next page of a search starts.
+type pageCursor struct {
+	// End of the time bucket to continue from.
+	Before time.Time `json:"before"`
+	// Number of traces in the bucket returned in previous pages.
+	Skip int `json:"skip,omitempty"`
+}
+
+func (cursor pageCursor) encode() string {
+	buf, err := json.Marshal(cursor)
+	if err != nil {
+		panic(err) // the struct is always serializable
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodePageToken(token string, query *spanstore.TraceQueryParameters) (pageCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("%w: %w", ErrInvalidPageToken, err)
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(buf, &cursor); err != nil {
+		return pageCursor{}, fmt.Errorf("%w: %w", ErrInvalidPageToken, err)
+	}
+
+	if !cursor.Before.After(query.StartTimeMin) || cursor.Before.After(query.StartTimeMax) || cursor.Skip < 0 {
+		return pageCursor{}, fmt.Errorf("%w: position is not within the search time range", ErrInvalidPageToken)
+	}
+
+	return cursor, nil
+}
+
+// listPage lists up to query.NumTraces traces from the newest to the oldest in buckets of --frontend-search-bucket,
+// so that busy objects do not need to be listed over the whole time range.
+//
+// The returned cursor is nil if there are no more traces.
+// If the search takes longer than --frontend-search-timeout, the traces found so far are returned with a cursor to the next bucket.
+func (reader *spanReader) listPage(
+	ctx context.Context,
+	query *spanstore.TraceQueryParameters,
+	cursor pageCursor,
+	list func(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error),
+	identityFilters []identityFilter,
+) ([]*jaegerbackend.TraceThumbnail, *pageCursor, error) {
+	searchStart := reader.Clock.Now()
+
+	bucketEnd := query.StartTimeMax
+	if !cursor.Before.IsZero() {
+		bucketEnd = cursor.Before
+	}
+	skip := cursor.Skip
+
+	tts := []*jaegerbackend.TraceThumbnail{}
+	seen := map[model.TraceID]struct{}{}
+
+	for bucketEnd.After(query.StartTimeMin) {
+		if len(tts) > 0 && reader.options.searchTimeout > 0 && reader.Clock.Since(searchStart) > reader.options.searchTimeout {
+			reader.Logger.WithField("searchedUntil", bucketEnd).Warn("search timeout exceeded, returning partial results")
+			return tts, &pageCursor{Before: bucketEnd}, nil
+		}
+
+		bucketStart := query.StartTimeMin
+		if reader.options.searchBucket > 0 && bucketEnd.Add(-reader.options.searchBucket).After(query.StartTimeMin) {
+			bucketStart = bucketEnd.Add(-reader.options.searchBucket)
+		}
+
+		remaining := query.NumTraces - len(tts)
+
+		bucketQuery := *query
+		bucketQuery.StartTimeMin = bucketStart
+		bucketQuery.StartTimeMax = bucketEnd
+		bucketQuery.NumTraces = skip + remaining
+
+		bucketTts, err := list(ctx, &bucketQuery)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		bucketTts = filterByIdentity(bucketTts, identityFilters)
+		sortThumbnails(bucketTts)
+
+		taken := 0
+		for i, tt := range bucketTts {
+			if i < skip {
+				continue
+			}
+
+			if taken == remaining {
+				break
+			}
+			taken++
+
+			// traces across the bucket boundary are returned by both buckets
+			if _, exists := seen[tt.Spans.Root.TraceID]; exists {
+				continue
+			}
+			seen[tt.Spans.Root.TraceID] = struct{}{}
+
+			tts = append(tts, tt)
+		}
+
+		if taken == remaining {
+			return tts, &pageCursor{Before: bucketEnd, Skip: skip + taken}, nil
+		}
+
+		bucketEnd = bucketStart
+		skip = 0
+	}
+
+	return tts, nil, nil
+}
+
+// sortThumbnails sorts traces from the newest to the oldest, so that pages within a bucket are stable.
+func sortThumbnails(tts []*jaegerbackend.TraceThumbnail) {
+	sort.SliceStable(tts, func(i, j int) bool {
+		left, right := tts[i].Spans.Root, tts[j].Spans.Root
+		if !left.StartTime.Equal(right.StartTime) {
+			return left.StartTime.After(right.StartTime)
+		}
+		if left.TraceID.High != right.TraceID.High {
+			return left.TraceID.High < right.TraceID.High
+		}
+		return left.TraceID.Low < right.TraceID.Low
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+)
+
+var pageBase = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newPageTestList returns a list function over one trace every 10 minutes, returned from the newest like the backends,
+// and the number of list calls.
+func newPageTestList(numTraces int) (func(context.Context, *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error), *int) {
+	calls := 0
+	return func(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error) {
+		calls++
+
+		tts := []*jaegerbackend.TraceThumbnail{}
+		for i := numTraces - 1; i >= 0 && len(tts) < query.NumTraces; i-- {
+			startTime := pageBase.Add(time.Duration(i) * time.Minute * 10)
+			if startTime.Before(query.StartTimeMin) || !startTime.Before(query.StartTimeMax) {
+				continue
+			}
+
+			traceId := model.NewTraceID(0, uint64(i))
+			tree := tftree.NewSpanTree([]*model.Span{{TraceID: traceId, SpanID: 1, StartTime: startTime}})
+			tts = append(tts, &jaegerbackend.TraceThumbnail{Identifier: i, Spans: tree})
+		}
+		return tts, nil
+	}, &calls
+}
+
+func newPageTestReader(bucket time.Duration) *spanReader {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return &spanReader{
+		options: options{searchBucket: bucket},
+		Logger:  logger,
+		Clock:   clocktesting.NewFakeClock(pageBase),
+	}
+}
+
+func pageIdentifiers(tts []*jaegerbackend.TraceThumbnail) []any {
+	ids := make([]any, len(tts))
+	for i, tt := range tts {
+		ids[i] = tt.Identifier
+	}
+	return ids
+}
+
+func TestListPage(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newPageTestReader(time.Hour)
+	list, calls := newPageTestList(18) // 3 hours of traces
+
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: pageBase,
+		StartTimeMax: pageBase.Add(time.Hour * 3),
+		NumTraces:    4,
+	}
+
+	// the newest bucket has enough traces
+	tts, cursor, err := reader.listPage(context.Background(), query, pageCursor{}, list, nil)
+	assert.NoError(err)
+	assert.Equal([]any{17, 16, 15, 14}, pageIdentifiers(tts))
+	assert.Equal(1, *calls)
+	assert.Equal(&pageCursor{Before: pageBase.Add(time.Hour * 3), Skip: 4}, cursor)
+
+	// the next page continues in the same bucket and spans into the next bucket
+	decoded, err := decodePageToken(cursor.encode(), query)
+	assert.NoError(err)
+	tts, cursor, err = reader.listPage(context.Background(), query, decoded, list, nil)
+	assert.NoError(err)
+	assert.Equal([]any{13, 12, 11, 10}, pageIdentifiers(tts))
+	assert.Equal(&pageCursor{Before: pageBase.Add(time.Hour * 2), Skip: 2}, cursor)
+
+	// the last page has no cursor
+	query.NumTraces = 100
+	tts, cursor, err = reader.listPage(context.Background(), query, *cursor, list, nil)
+	assert.NoError(err)
+	assert.Len(tts, 10)
+	assert.Nil(cursor)
+}
+
+func TestListPageWithoutBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newPageTestReader(0)
+	list, calls := newPageTestList(18)
+
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: pageBase,
+		StartTimeMax: pageBase.Add(time.Hour * 3),
+		NumTraces:    100,
+	}
+
+	tts, cursor, err := reader.listPage(context.Background(), query, pageCursor{}, list, nil)
+	assert.NoError(err)
+	assert.Len(tts, 18)
+	assert.Nil(cursor)
+	assert.Equal(1, *calls)
+}
+
+func TestListPageTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	reader := newPageTestReader(time.Hour)
+	reader.options.searchTimeout = time.Second
+	clock := reader.Clock.(*clocktesting.FakeClock)
+
+	slowList, _ := newPageTestList(18)
+	list := func(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error) {
+		clock.Step(time.Second * 2)
+		return slowList(ctx, query)
+	}
+
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: pageBase,
+		StartTimeMax: pageBase.Add(time.Hour * 3),
+		NumTraces:    100,
+	}
+
+	tts, cursor, err := reader.listPage(context.Background(), query, pageCursor{}, list, nil)
+	assert.NoError(err)
+	assert.Len(tts, 6)
+	assert.Equal(&pageCursor{Before: pageBase.Add(time.Hour * 2)}, cursor)
+}
+
+func TestDecodePageToken(t *testing.T) {
+	assert := assert.New(t)
+
+	query := &spanstore.TraceQueryParameters{
+		StartTimeMin: pageBase,
+		StartTimeMax: pageBase.Add(time.Hour),
+	}
+
+	_, err := decodePageToken("not a token", query)
+	assert.True(errors.Is(err, ErrInvalidPageToken))
+
+	_, err = decodePageToken(pageCursor{Before: pageBase.Add(time.Hour * 2)}.encode(), query)
+	assert.True(errors.Is(err, ErrInvalidPageToken))
+
+	cursor, err := decodePageToken(pageCursor{Before: pageBase.Add(time.Minute), Skip: 3}.encode(), query)
+	assert.NoError(err)
+	assert.Equal(3, cursor.Skip)
+}
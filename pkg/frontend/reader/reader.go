@@ -19,18 +19,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/jaegertracing/jaeger/model"
 	"github.com/jaegertracing/jaeger/storage/spanstore"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/utils/clock"
 
 	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
 	"github.com/kubewharf/kelemetry/pkg/frontend/clusterlist"
+	"github.com/kubewharf/kelemetry/pkg/frontend/labelselector"
 	"github.com/kubewharf/kelemetry/pkg/frontend/reader/merge"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
 	transform "github.com/kubewharf/kelemetry/pkg/frontend/tf"
 	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
 	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
@@ -48,6 +50,10 @@ func init() {
 
 type Interface interface {
 	spanstore.Reader
+
+	// FindTracesPage is FindTraces continuing from the page token returned by the previous page.
+	// The returned page token is empty if there are no more traces.
+	FindTracesPage(ctx context.Context, query *spanstore.TraceQueryParameters, pageToken string) ([]*model.Trace, string, error)
 }
 
 type options struct {
@@ -55,6 +61,15 @@ type options struct {
 	followLinkConcurrency int
 	followLinkLimit       int32
 	followLinksInList     bool
+	pseudoSpanWindow      time.Duration
+	maxTraces             int
+	searchBucket          time.Duration
+	searchTimeout         time.Duration
+	listCombinations      bool
+	resultCacheSize       int
+	resultCacheTtl        time.Duration
+	resultCacheActiveTtl  time.Duration
+	maxTraceSpans         int
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -82,6 +97,75 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		true,
 		"whether links should be recursed into when listing traces",
 	)
+	fs.DurationVar(
+		&options.pseudoSpanWindow,
+		"frontend-pseudo-span-window",
+		time.Minute*30,
+		"the longest pseudospan window used by the aggregator, i.e. the maximum of --aggregator-span-ttl and --aggregator-span-ttl-override",
+	)
+	fs.IntVar(
+		&options.maxTraces,
+		"frontend-search-max-traces",
+		100,
+		"maximum number of traces returned per search, also used if the search does not specify a limit",
+	)
+	fs.DurationVar(
+		&options.searchBucket,
+		"frontend-search-bucket",
+		time.Hour,
+		"split searches into time buckets of this duration, searched from the newest until enough traces are found; 0 to search the whole range at once",
+	)
+	fs.DurationVar(
+		&options.searchTimeout,
+		"frontend-search-timeout",
+		time.Second*20,
+		"stop searching older buckets after this duration and return the traces found so far; 0 to disable",
+	)
+	fs.BoolVar(
+		&options.listCombinations,
+		"frontend-list-modifier-combinations",
+		true,
+		"list every combination of display modes and modifiers as a service in the Jaeger UI; "+
+			"if disabled, only display modes without modifiers and presets are listed, "+
+			"and modifiers are selected with the displayMode search tag",
+	)
+	fs.IntVar(
+		&options.resultCacheSize,
+		"frontend-trace-result-cache-size",
+		16,
+		"maximum number of transformed traces cached in memory to serve repeated requests; 0 to disable",
+	)
+	fs.DurationVar(
+		&options.resultCacheTtl,
+		"frontend-trace-result-cache-ttl",
+		time.Minute*10,
+		"duration to cache each transformed trace",
+	)
+	fs.DurationVar(
+		&options.resultCacheActiveTtl,
+		"frontend-trace-result-cache-active-ttl",
+		time.Second*10,
+		"duration to cache each transformed trace whose time range may still receive new spans; 0 to not cache such traces",
+	)
+	fs.IntVar(
+		&options.maxTraceSpans,
+		"frontend-max-trace-spans",
+		0,
+		"maximum number of spans in a trace, removing the deepest spans beyond the limit; 0 for unlimited",
+	)
+}
+
+func (options *options) Validate() error {
+	if options.maxTraces <= 0 {
+		return fmt.Errorf("--frontend-search-max-traces must be positive")
+	}
+	if options.resultCacheSize < 0 {
+		return fmt.Errorf("--frontend-trace-result-cache-size must not be negative")
+	}
+	if options.maxTraceSpans < 0 {
+		return fmt.Errorf("--frontend-max-trace-spans must not be negative")
+	}
+	return nil
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -95,12 +179,17 @@ type spanReader struct {
 	ClusterList      clusterlist.Lister
 	Transformer      *transform.Transformer
 	TransformConfigs tfconfig.Provider
+	Tenant           *tenant.Filter
+	LabelSelectors   *manager.List[labelselector.Resolver]
 
 	GetServicesMetric         *metrics.Metric[*GetServicesMetric]
 	GetOperationsMetric       *metrics.Metric[*GetOperationsMetric]
 	FindTracesMetric          *metrics.Metric[*FindTracesMetric]
 	FindTracesTimeRangeMetric *metrics.Metric[*FindTracesTimeRangeMetric]
 	GetTraceMetric            *metrics.Metric[*GetTraceMetric]
+	ResultCacheMetric         *metrics.Metric[*resultCacheMetric]
+
+	resultCache *cache.LRUExpireCache
 }
 
 type GetServicesMetric struct{}
@@ -125,8 +214,14 @@ type GetTraceMetric struct{}
 
 func (*GetTraceMetric) MetricName() string { return "frontend_get_trace" }
 
-func (reader *spanReader) Options() manager.Options        { return &reader.options }
-func (reader *spanReader) Init() error                     { return nil }
+func (reader *spanReader) Options() manager.Options { return &reader.options }
+func (reader *spanReader) Init() error {
+	if reader.resultCacheEnabled() {
+		reader.resultCache = cache.NewLRUExpireCacheWithClock(reader.options.resultCacheSize, reader.Clock)
+	}
+	return nil
+}
+
 func (reader *spanReader) Start(ctx context.Context) error { return nil }
 func (reader *spanReader) Close(ctx context.Context) error { return nil }
 
@@ -138,11 +233,17 @@ func (reader *spanReader) GetServices(ctx context.Context) ([]string, error) {
 	}
 
 	for _, name := range reader.TransformConfigs.Names() {
-		if name != reader.TransformConfigs.DefaultName() {
-			configNames = append(configNames, name)
+		if name == reader.TransformConfigs.DefaultName() {
+			continue
 		}
+		if !reader.options.listCombinations && reader.TransformConfigs.GetByName(name).ModifierNames.Len() > 0 {
+			continue
+		}
+		configNames = append(configNames, name)
 	}
 
+	configNames = append(configNames, reader.TransformConfigs.PresetNames()...)
+
 	reader.Logger.WithField("services", configNames).Info("query display mode list")
 
 	return configNames, nil
@@ -154,6 +255,10 @@ func (reader *spanReader) GetOperations(ctx context.Context, query spanstore.Ope
 	clusterNames := reader.ClusterList.List()
 	operations := make([]spanstore.Operation, 0, len(clusterNames))
 	for _, verb := range clusterNames {
+		if !reader.Tenant.AllowsCluster(ctx, verb) {
+			continue
+		}
+
 		operations = append(operations, spanstore.Operation{
 			SpanKind: query.SpanKind,
 			Name:     verb,
@@ -179,14 +284,39 @@ func (reader *spanReader) FindTraceIDs(ctx context.Context, query *spanstore.Tra
 }
 
 func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*model.Trace, error) {
+	traces, _, err := reader.FindTracesPage(ctx, query, "")
+	return traces, err
+}
+
+func (reader *spanReader) FindTracesPage(
+	ctx context.Context,
+	query *spanstore.TraceQueryParameters,
+	pageToken string,
+) ([]*model.Trace, string, error) {
 	defer reader.FindTracesMetric.DeferCount(reader.Clock.Now(), &FindTracesMetric{})
 
 	reader.FindTracesTimeRangeMetric.With(&FindTracesTimeRangeMetric{}).Summary(query.StartTimeMax.Sub(query.StartTimeMin).Seconds())
 
-	configName := strings.TrimPrefix(query.ServiceName, "* ")
-	config := reader.TransformConfigs.GetByName(configName)
-	if config == nil {
-		return nil, fmt.Errorf("invalid display mode %q", query.ServiceName)
+	selection := query.ServiceName
+	if displayMode, hasDisplayMode := query.Tags[tfconfig.DisplayModeTag]; hasDisplayMode {
+		selection = displayMode
+		delete(query.Tags, tfconfig.DisplayModeTag)
+	}
+
+	config, err := tfconfig.Resolve(reader.TransformConfigs, selection)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if query.NumTraces <= 0 || query.NumTraces > reader.options.maxTraces {
+		query.NumTraces = reader.options.maxTraces
+	}
+
+	var cursor pageCursor
+	if pageToken != "" {
+		if cursor, err = decodePageToken(pageToken, query); err != nil {
+			return nil, "", err
+		}
 	}
 
 	reader.Logger.WithField("query", query).
@@ -200,9 +330,18 @@ func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.Trace
 		query.Tags["cluster"] = query.OperationName
 	}
 
-	tts, err := reader.Backend.List(ctx, query)
+	identityFilters := extractIdentityFilters(query.Tags)
+
+	list := reader.Backend.List
+	if selector, hasSelector := query.Tags[labelselector.Tag]; hasSelector {
+		list = func(ctx context.Context, query *spanstore.TraceQueryParameters) ([]*jaegerbackend.TraceThumbnail, error) {
+			return reader.listBySelector(ctx, query, selector)
+		}
+	}
+
+	tts, nextCursor, err := reader.listPage(ctx, query, cursor, list, identityFilters)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	twmList := make([]merge.TraceWithMetadata[any], len(tts))
@@ -215,7 +354,7 @@ func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.Trace
 
 	merger := merge.Merger[any]{}
 	if _, err := merger.AddTraces(twmList); err != nil {
-		return nil, fmt.Errorf("group traces by object: %w", err)
+		return nil, "", fmt.Errorf("group traces by object: %w", err)
 	}
 
 	if reader.options.followLinksInList {
@@ -223,16 +362,21 @@ func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.Trace
 			ctx,
 			config.LinkSelector,
 			query.StartTimeMin, query.StartTimeMax,
-			mergeListWithBackend[any](reader.Backend, reflectutil.Identity[any], OriginalTraceRequest{FindTraces: query}),
+			mergeListWithBackend[any](
+				reader.Backend,
+				reflectutil.Identity[any],
+				OriginalTraceRequest{FindTraces: query},
+				reader.options.pseudoSpanWindow,
+			),
 			reader.options.followLinkConcurrency, reader.options.followLinkLimit, false,
 		); err != nil {
-			return nil, fmt.Errorf("follow links: %w", err)
+			return nil, "", fmt.Errorf("follow links: %w", err)
 		}
 	}
 
 	mergeTrees, err := merger.MergeTraces()
 	if err != nil {
-		return nil, fmt.Errorf("merging split and linked traces: %w", err)
+		return nil, "", fmt.Errorf("merging split and linked traces: %w", err)
 	}
 
 	var rootKey *utilobject.Key
@@ -243,18 +387,22 @@ func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.Trace
 	cacheEntries := []tracecache.Entry{}
 	traces := []*model.Trace{}
 	for _, mergeTree := range mergeTrees {
+		if !reader.Tenant.FilterTree(ctx, mergeTree.Tree) {
+			continue
+		}
+
 		cacheId := generateCacheId(config.Id)
 
 		trace, extensionCache, err := reader.prepareEntry(ctx, rootKey, query, mergeTree.Tree, cacheId)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		traces = append(traces, trace)
 
 		cacheEntry, err := reader.prepareCache(rootKey, query, mergeTree.Metadata, cacheId, extensionCache)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 
 		cacheEntries = append(cacheEntries, cacheEntry)
@@ -262,13 +410,18 @@ func (reader *spanReader) FindTraces(ctx context.Context, query *spanstore.Trace
 
 	if len(cacheEntries) > 0 {
 		if err := reader.TraceCache.Persist(ctx, cacheEntries); err != nil {
-			return nil, fmt.Errorf("cannot persist trace cache: %w", err)
+			return nil, "", fmt.Errorf("cannot persist trace cache: %w", err)
 		}
 	}
 
 	reader.Logger.WithField("numTraces", len(traces)).Info("query trace list")
 
-	return traces, nil
+	nextPageToken := ""
+	if nextCursor != nil {
+		nextPageToken = nextCursor.encode()
+	}
+
+	return traces, nextPageToken, nil
 }
 
 func (reader *spanReader) prepareEntry(
@@ -357,6 +510,24 @@ func (reader *spanReader) GetTrace(ctx context.Context, cacheId model.TraceID) (
 	}
 
 	displayMode := extractDisplayMode(cacheId)
+	displayConfig := reader.TransformConfigs.GetById(displayMode)
+	if displayConfig == nil {
+		return nil, fmt.Errorf("display mode %x does not exist", displayMode)
+	}
+
+	// spans may still be exported to the adjacent windows followed by the display mode
+	windowEnd := entry.EndTime
+	if displayConfig.FollowWindows > 0 && entry.RootObject != nil {
+		windowEnd = windowEnd.Add(reader.options.pseudoSpanWindow * time.Duration(displayConfig.FollowWindows))
+	}
+
+	var resultKey resultCacheKey
+	if reader.resultCacheEnabled() {
+		resultKey = reader.newResultCacheKey(ctx, entry, displayMode)
+		if trace, hit := reader.getCachedResult(resultKey, cacheId, windowEnd); hit {
+			return trace, nil
+		}
+	}
 
 	traces := make([]merge.TraceWithMetadata[struct{}], 0, len(entry.Identifiers))
 	for _, identifier := range entry.Identifiers {
@@ -374,16 +545,26 @@ func (reader *spanReader) GetTrace(ctx context.Context, cacheId model.TraceID) (
 		return nil, fmt.Errorf("grouping traces by object: %w", err)
 	}
 
-	displayConfig := reader.TransformConfigs.GetById(displayMode)
-	if displayConfig == nil {
-		return nil, fmt.Errorf("display mode %x does not exist", displayMode)
+	lister := mergeListWithBackend[struct{}](
+		reader.Backend,
+		func(any) struct{} { return struct{}{} },
+		OriginalTraceRequest{GetTrace: &cacheId},
+		reader.options.pseudoSpanWindow,
+	)
+
+	startTime, endTime := entry.StartTime, entry.EndTime
+	if displayConfig.FollowWindows > 0 && entry.RootObject != nil {
+		startTime, endTime, err = reader.followWindows(ctx, &merger, lister, *entry.RootObject, startTime, endTime, displayConfig.FollowWindows)
+		if err != nil {
+			return nil, fmt.Errorf("cannot follow adjacent windows: %w", err)
+		}
 	}
 
 	if err := merger.FollowLinks(
 		ctx,
 		displayConfig.LinkSelector,
-		entry.StartTime, entry.EndTime,
-		mergeListWithBackend[struct{}](reader.Backend, func(any) struct{} { return struct{}{} }, OriginalTraceRequest{GetTrace: &cacheId}),
+		startTime, endTime,
+		lister,
 		reader.options.followLinkConcurrency, reader.options.followLinkLimit, true,
 	); err != nil {
 		return nil, fmt.Errorf("cannot follow links: %w", err)
@@ -398,6 +579,10 @@ func (reader *spanReader) GetTrace(ctx context.Context, cacheId model.TraceID) (
 		return nil, fmt.Errorf("inconsistent linked trace count %d", len(mergedTrees))
 	}
 	mergedTree := mergedTrees[0]
+	if !reader.Tenant.FilterTree(ctx, mergedTree.Tree) {
+		return nil, fmt.Errorf("trace %v not found", cacheId)
+	}
+
 	aggTrace := &model.Trace{
 		ProcessMap: []model.Trace_ProcessMapping{{
 			ProcessID: "0",
@@ -413,16 +598,58 @@ func (reader *spanReader) GetTrace(ctx context.Context, cacheId model.TraceID) (
 	if err := reader.Transformer.Transform(
 		ctx, aggTrace, entry.RootObject, displayMode,
 		extensions,
-		entry.StartTime, entry.EndTime,
+		startTime, endTime,
 	); err != nil {
 		return nil, fmt.Errorf("trace transformation failed: %w", err)
 	}
 
-	reader.Logger.WithField("numTransformedSpans", len(aggTrace.Spans)).Info("query trace tree")
+	logger := reader.Logger.WithField("numTransformedSpans", len(aggTrace.Spans))
+	if reader.options.maxTraceSpans > 0 {
+		if removed := truncateTrace(aggTrace, reader.options.maxTraceSpans); removed > 0 {
+			logger = logger.WithField("numTruncatedSpans", removed)
+		}
+	}
+	logger.Info("query trace tree")
+
+	if reader.resultCacheEnabled() {
+		reader.storeResult(resultKey, cacheId, aggTrace, windowEnd)
+	}
 
 	return aggTrace, nil
 }
 
+// followWindows merges the traces of the root object in the adjacent windows before and after the queried window.
+// Returns the time range extended to cover the merged windows.
+func (reader *spanReader) followWindows(
+	ctx context.Context,
+	merger *merge.Merger[struct{}],
+	lister merge.ListFunc[struct{}],
+	rootObject utilobject.Key,
+	startTime, endTime time.Time,
+	windows uint32,
+) (time.Time, time.Time, error) {
+	extension := reader.options.pseudoSpanWindow * time.Duration(windows)
+
+	// query the ranges before and after separately to avoid fetching the queried window again
+	ranges := [][2]time.Time{
+		{startTime.Add(-extension), startTime},
+		{endTime, endTime.Add(extension)},
+	}
+
+	for _, timeRange := range ranges {
+		traces, err := lister(ctx, rootObject, timeRange[0], timeRange[1], int(windows))
+		if err != nil {
+			return startTime, endTime, err
+		}
+
+		if _, err := merger.AddTraces(traces); err != nil {
+			return startTime, endTime, fmt.Errorf("grouping traces by object: %w", err)
+		}
+	}
+
+	return startTime.Add(-extension), endTime.Add(extension), nil
+}
+
 const (
 	CacheIdHighMask     uint64 = 0xFF00000000E1E3E7
 	CacheIdHighBitShift uint64 = 6 * 4
@@ -475,7 +702,12 @@ type (
 	WantPseudoSpansOnly struct{}
 )
 
-func mergeListWithBackend[M any](backend jaegerbackend.Backend, convertMetadata func(any) M, otr OriginalTraceRequest) merge.ListFunc[M] {
+func mergeListWithBackend[M any](
+	backend jaegerbackend.Backend,
+	convertMetadata func(any) M,
+	otr OriginalTraceRequest,
+	pseudoSpanWindow time.Duration,
+) merge.ListFunc[M] {
 	return func(
 		ctx context.Context,
 		key utilobject.Key,
@@ -502,8 +734,8 @@ func mergeListWithBackend[M any](backend jaegerbackend.Backend, convertMetadata
 		if len(tts) == 0 {
 			// Linked object has no events during this interval,
 			// but we still want to discover any possible links during this period.
-			pseudoStartTime := startTime.Truncate(time.Minute * 30)
-			pseudoEndTime := endTime.Truncate(time.Minute * 30)
+			pseudoStartTime := startTime.Truncate(pseudoSpanWindow)
+			pseudoEndTime := endTime.Truncate(pseudoSpanWindow)
 
 			pseudoSpans, err := backend.List(
 				context.WithValue(ctx, WantPseudoSpansOnly{}, WantPseudoSpansOnly{}),
@@ -0,0 +1,139 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tracecache"
+)
+
+// resultCacheKey identifies the transformed trace of a trace cache entry.
+// Different searches returning the same window share the same key.
+type resultCacheKey struct {
+	identifiers string
+	startTime   int64
+	endTime     int64
+	rootObject  string
+	displayMode tfconfig.Id
+	scope       string
+}
+
+type resultCacheMetric struct {
+	Hit    bool
+	Active bool
+}
+
+func (*resultCacheMetric) MetricName() string { return "frontend_trace_result_cache" }
+
+type cachedResult struct {
+	traceId model.TraceID
+	trace   *model.Trace
+}
+
+func (reader *spanReader) resultCacheEnabled() bool {
+	return reader.options.resultCacheSize > 0
+}
+
+func (reader *spanReader) newResultCacheKey(ctx context.Context, entry *tracecache.EntryValue, displayMode tfconfig.Id) resultCacheKey {
+	identifiers := make([]string, len(entry.Identifiers))
+	for i, identifier := range entry.Identifiers {
+		identifiers[i] = string(identifier)
+	}
+
+	key := resultCacheKey{
+		identifiers: strings.Join(identifiers, "\n"),
+		startTime:   entry.StartTime.UnixNano(),
+		endTime:     entry.EndTime.UnixNano(),
+		displayMode: displayMode,
+		scope:       reader.Tenant.CacheScope(ctx),
+	}
+	if entry.RootObject != nil {
+		key.rootObject = entry.RootObject.String()
+	}
+
+	return key
+}
+
+// isWindowActive returns whether spans may still be exported to a window ending at endTime,
+// in which case the transformed trace changes over time.
+func (reader *spanReader) isWindowActive(endTime time.Time) bool {
+	return reader.Clock.Now().Before(endTime.Add(reader.options.pseudoSpanWindow))
+}
+
+// getCachedResult returns a copy of the cached transformed trace with the trace ID of the request.
+func (reader *spanReader) getCachedResult(key resultCacheKey, traceId model.TraceID, endTime time.Time) (*model.Trace, bool) {
+	metric := &resultCacheMetric{Active: reader.isWindowActive(endTime)}
+	defer reader.ResultCacheMetric.DeferCount(reader.Clock.Now(), metric)
+
+	value, exists := reader.resultCache.Get(key)
+	if !exists {
+		return nil, false
+	}
+
+	metric.Hit = true
+	result := value.(cachedResult)
+	return copyTrace(result.trace, result.traceId, traceId), true
+}
+
+// storeResult caches a copy of the transformed trace.
+// Windows that are still active are only cached for --frontend-trace-result-cache-active-ttl,
+// so that new spans appear after the cache entry expires.
+func (reader *spanReader) storeResult(key resultCacheKey, traceId model.TraceID, trace *model.Trace, endTime time.Time) {
+	ttl := reader.options.resultCacheTtl
+	if reader.isWindowActive(endTime) {
+		ttl = reader.options.resultCacheActiveTtl
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	reader.resultCache.Add(key, cachedResult{traceId: traceId, trace: copyTrace(trace, traceId, traceId)}, ttl)
+}
+
+// copyTrace copies the spans of a trace so that callers may modify the span fields without affecting the cache,
+// replacing the trace ID oldId with newId.
+func copyTrace(trace *model.Trace, oldId, newId model.TraceID) *model.Trace {
+	spans := make([]*model.Span, len(trace.Spans))
+	for i, span := range trace.Spans {
+		spanCopy := *span
+		if spanCopy.TraceID == oldId {
+			spanCopy.TraceID = newId
+		}
+
+		if span.References != nil {
+			spanCopy.References = make([]model.SpanRef, len(span.References))
+			for j, ref := range span.References {
+				if ref.TraceID == oldId {
+					ref.TraceID = newId
+				}
+				spanCopy.References[j] = ref
+			}
+		}
+
+		spans[i] = &spanCopy
+	}
+
+	return &model.Trace{
+		Spans:      spans,
+		ProcessMap: trace.ProcessMap,
+		Warnings:   trace.Warnings,
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/tenant"
+	"github.com/kubewharf/kelemetry/pkg/frontend/tracecache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+var resultBase = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newResultCacheTestReader(clock *clocktesting.FakeClock) *spanReader {
+	metricsClient, _ := metrics.NewMock(clock)
+
+	return &spanReader{
+		options: options{
+			pseudoSpanWindow:     time.Minute * 30,
+			resultCacheSize:      4,
+			resultCacheTtl:       time.Minute * 10,
+			resultCacheActiveTtl: time.Second * 10,
+		},
+		Clock:             clock,
+		Tenant:            &tenant.Filter{Authorizers: &manager.List[tenant.Authorizer]{}},
+		ResultCacheMetric: metrics.New[*resultCacheMetric](metricsClient),
+		resultCache:       cache.NewLRUExpireCacheWithClock(4, clock),
+	}
+}
+
+func resultTestTrace(traceId model.TraceID) *model.Trace {
+	return &model.Trace{Spans: []*model.Span{
+		{TraceID: traceId, SpanID: 1},
+		{TraceID: traceId, SpanID: 2, References: []model.SpanRef{model.NewChildOfRef(traceId, 1)}},
+	}}
+}
+
+func TestResultCacheSharedBetweenSearches(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(resultBase.Add(time.Hour * 2))
+	reader := newResultCacheTestReader(clock)
+
+	entry := &tracecache.EntryValue{
+		Identifiers: []json.RawMessage{json.RawMessage(`"a"`)},
+		StartTime:   resultBase,
+		EndTime:     resultBase.Add(time.Hour),
+	}
+	key := reader.newResultCacheKey(context.Background(), entry, 1)
+	assert.NotEqual(key, reader.newResultCacheKey(context.Background(), entry, 2))
+
+	firstId, secondId := model.NewTraceID(1, 1), model.NewTraceID(1, 2)
+	reader.storeResult(key, firstId, resultTestTrace(firstId), entry.EndTime)
+
+	trace, hit := reader.getCachedResult(key, secondId, entry.EndTime)
+	assert.True(hit)
+	assert.Equal(resultTestTrace(secondId), trace)
+
+	// callers may modify the returned spans
+	trace.Spans[0].OperationName = "modified"
+	trace, _ = reader.getCachedResult(key, firstId, entry.EndTime)
+	assert.Equal(resultTestTrace(firstId), trace)
+
+	clock.Step(time.Minute * 11)
+	_, hit = reader.getCachedResult(key, firstId, entry.EndTime)
+	assert.False(hit)
+}
+
+func TestResultCacheActiveWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(resultBase.Add(time.Minute * 70))
+	reader := newResultCacheTestReader(clock)
+
+	entry := &tracecache.EntryValue{StartTime: resultBase, EndTime: resultBase.Add(time.Hour)}
+	key := reader.newResultCacheKey(context.Background(), entry, 1)
+
+	traceId := model.NewTraceID(1, 1)
+	reader.storeResult(key, traceId, resultTestTrace(traceId), entry.EndTime)
+
+	_, hit := reader.getCachedResult(key, traceId, entry.EndTime)
+	assert.True(hit)
+
+	// spans may still be exported to the window, so the result expires quickly
+	clock.Step(time.Second * 11)
+	_, hit = reader.getCachedResult(key, traceId, entry.EndTime)
+	assert.False(hit)
+
+	reader.options.resultCacheActiveTtl = 0
+	reader.storeResult(key, traceId, resultTestTrace(traceId), entry.EndTime)
+	_, hit = reader.getCachedResult(key, traceId, entry.EndTime)
+	assert.False(hit)
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+
+	jaegerbackend "github.com/kubewharf/kelemetry/pkg/frontend/backend"
+	"github.com/kubewharf/kelemetry/pkg/frontend/labelselector"
+)
+
+// listBySelector lists the traces of the objects matching the label selector in the "selector" tag.
+func (reader *spanReader) listBySelector(
+	ctx context.Context,
+	query *spanstore.TraceQueryParameters,
+	selector string,
+) ([]*jaegerbackend.TraceThumbnail, error) {
+	if len(reader.LabelSelectors.Impls) == 0 {
+		return nil, fmt.Errorf("the %q tag requires --frontend-label-selector-enable", labelselector.Tag)
+	}
+
+	resource, hasResource := query.Tags["resource"]
+	if !hasResource {
+		return nil, fmt.Errorf("the %q tag requires the \"resource\" tag", labelselector.Tag)
+	}
+
+	clusters := []string{}
+	if cluster, hasCluster := query.Tags["cluster"]; hasCluster {
+		clusters = append(clusters, cluster)
+	} else {
+		for _, cluster := range reader.ClusterList.List() {
+			if reader.Tenant.AllowsCluster(ctx, cluster) {
+				clusters = append(clusters, cluster)
+			}
+		}
+	}
+
+	tts := []*jaegerbackend.TraceThumbnail{}
+	for _, cluster := range clusters {
+		selectorQuery := labelselector.Query{
+			Cluster:   cluster,
+			Group:     query.Tags["group"],
+			Resource:  resource,
+			Namespace: query.Tags["namespace"],
+			Selector:  selector,
+		}
+
+		for _, resolver := range reader.LabelSelectors.Impls {
+			keys, err := resolver.Resolve(ctx, selectorQuery)
+			if err != nil {
+				return nil, fmt.Errorf("cannot resolve label selector: %w", err)
+			}
+
+			for _, key := range keys {
+				if query.NumTraces != 0 && len(tts) >= query.NumTraces {
+					return tts, nil
+				}
+
+				objectQuery := *query
+				objectQuery.Tags = make(map[string]string, len(query.Tags))
+				for tagKey, tagValue := range query.Tags {
+					if tagKey != labelselector.Tag {
+						objectQuery.Tags[tagKey] = tagValue
+					}
+				}
+				objectQuery.Tags["cluster"] = key.Cluster
+				objectQuery.Tags["group"] = key.Group
+				objectQuery.Tags["resource"] = key.Resource
+				objectQuery.Tags["namespace"] = key.Namespace
+				objectQuery.Tags["name"] = key.Name
+				if query.NumTraces != 0 {
+					objectQuery.NumTraces = query.NumTraces - len(tts)
+				}
+
+				objectTts, err := reader.Backend.List(ctx, &objectQuery)
+				if err != nil {
+					return nil, err
+				}
+				tts = append(tts, objectTts...)
+			}
+		}
+	}
+
+	return tts, nil
+}
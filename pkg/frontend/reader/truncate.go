@@ -0,0 +1,83 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+const (
+	// TagTruncated is set to true on the root spans of a trace with spans removed by --frontend-max-trace-spans.
+	TagTruncated = "truncated"
+	// TagTruncatedSpans is the number of spans removed from a truncated trace.
+	TagTruncatedSpans = "truncatedSpans"
+)
+
+// truncateTrace keeps the first maxSpans spans of the trace in breadth-first order,
+// so that the object hierarchy is kept and the deepest events are removed first.
+// Sibling spans are kept in the order of their start time.
+//
+// Returns the number of removed spans.
+func truncateTrace(trace *model.Trace, maxSpans int) int {
+	if len(trace.Spans) <= maxSpans {
+		return 0
+	}
+
+	spanIds := make(map[model.SpanID]struct{}, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spanIds[span.SpanID] = struct{}{}
+	}
+
+	roots := []*model.Span{}
+	children := map[model.SpanID][]*model.Span{}
+	for _, span := range trace.Spans {
+		if parentId := span.ParentSpanID(); parentId != 0 {
+			if _, hasParent := spanIds[parentId]; hasParent {
+				children[parentId] = append(children[parentId], span)
+				continue
+			}
+		}
+		roots = append(roots, span)
+	}
+
+	byStartTime := func(spans []*model.Span) {
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].StartTime.Before(spans[j].StartTime) })
+	}
+
+	byStartTime(roots)
+	kept := make([]*model.Span, 0, maxSpans)
+	queue := roots
+	for len(queue) > 0 && len(kept) < maxSpans {
+		span := queue[0]
+		queue = queue[1:]
+		kept = append(kept, span)
+
+		spanChildren := children[span.SpanID]
+		byStartTime(spanChildren)
+		queue = append(queue, spanChildren...)
+	}
+
+	removed := len(trace.Spans) - len(kept)
+	for _, root := range roots {
+		root.Tags = append(root.Tags, model.Bool(TagTruncated, true), model.Int64(TagTruncatedSpans, int64(removed)))
+		root.Warnings = append(root.Warnings, fmt.Sprintf("%d of %d spans are hidden because the trace is too large", removed, len(trace.Spans)))
+	}
+
+	trace.Spans = kept
+	return removed
+}
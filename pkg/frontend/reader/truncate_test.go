@@ -0,0 +1,60 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jaegerreader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func truncateTestSpan(id, parent model.SpanID, offset time.Duration) *model.Span {
+	span := &model.Span{SpanID: id, StartTime: resultBase.Add(offset)}
+	if parent != 0 {
+		span.References = []model.SpanRef{model.NewChildOfRef(model.TraceID{}, parent)}
+	}
+	return span
+}
+
+func TestTruncateTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	trace := &model.Trace{Spans: []*model.Span{
+		truncateTestSpan(5, 2, 0),
+		truncateTestSpan(1, 0, 0),
+		truncateTestSpan(2, 1, time.Second*2),
+		truncateTestSpan(3, 1, time.Second),
+		truncateTestSpan(4, 3, 0),
+	}}
+
+	assert.Equal(0, truncateTrace(trace, 5))
+	assert.Len(trace.Spans, 5)
+
+	assert.Equal(2, truncateTrace(trace, 3))
+
+	ids := []model.SpanID{}
+	for _, span := range trace.Spans {
+		ids = append(ids, span.SpanID)
+	}
+	assert.Equal([]model.SpanID{1, 3, 2}, ids)
+
+	truncated, _ := model.KeyValues(trace.Spans[0].Tags).FindByKey(TagTruncated)
+	assert.True(truncated.Bool())
+	removed, _ := model.KeyValues(trace.Spans[0].Tags).FindByKey(TagTruncatedSpans)
+	assert.Equal(int64(2), removed.Int64())
+	assert.Len(trace.Spans[0].Warnings, 1)
+}
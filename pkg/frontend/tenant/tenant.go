@@ -0,0 +1,322 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Restricts the traces visible to each tenant of the frontend to the clusters and namespaces assigned to it.
+//
+// The tenant of a request is taken from the user authenticated by `--http-auth-enable` if it has a tenant,
+// otherwise from a header set by a trusted authenticating proxy.
+// Jaeger query forwards the header to the storage plugin as gRPC metadata
+// if started with `--multi-tenancy.enabled --multi-tenancy.header=<header>`.
+//
+// Objects may additionally be hidden by Authorizer implementations, e.g. to follow the RBAC of the object's cluster.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("frontend-tenant", manager.Ptr(&Filter{}))
+}
+
+type options struct {
+	enable bool
+	header string
+	scopes []string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"frontend-tenant-enable",
+		false,
+		"only show traces of the clusters and namespaces assigned to the tenant of each request",
+	)
+	fs.StringVar(&options.header, "frontend-tenant-header", "x-tenant", "HTTP header or gRPC metadata containing the tenant of the request")
+	fs.StringArrayVar(
+		&options.scopes,
+		"frontend-tenant-scope",
+		[]string{},
+		"assign a scope to a tenant in the form 'tenant=cluster/namespace', where cluster and namespace may be '*'; "+
+			"cluster-scoped objects are only visible with namespace '*'. Repeat the flag to assign multiple scopes",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type scope struct {
+	cluster   string
+	namespace string
+}
+
+func (scope scope) allowsCluster(cluster string) bool {
+	return scope.cluster == "*" || scope.cluster == cluster
+}
+
+func (scope scope) allows(key utilobject.Key) bool {
+	return scope.allowsCluster(key.Cluster) && (scope.namespace == "*" || scope.namespace == key.Namespace && key.Namespace != "")
+}
+
+func parseScopes(values []string) (map[string][]scope, error) {
+	output := map[string][]scope{}
+	for _, value := range values {
+		tenant, scopeString, ok := strings.Cut(value, "=")
+		if !ok || tenant == "" {
+			return nil, fmt.Errorf("%q is not in the form 'tenant=cluster/namespace'", value)
+		}
+
+		cluster, namespace, ok := strings.Cut(scopeString, "/")
+		if !ok || cluster == "" || namespace == "" {
+			return nil, fmt.Errorf("%q is not in the form 'tenant=cluster/namespace'", value)
+		}
+
+		output[tenant] = append(output[tenant], scope{cluster: cluster, namespace: namespace})
+	}
+	return output, nil
+}
+
+// Authorizer decides whether the user of a request may see an object.
+type Authorizer interface {
+	// Authorize returns whether the user of the request may see the object.
+	// Errors should be treated as a denial.
+	Authorize(ctx context.Context, key utilobject.Key) bool
+}
+
+// Filter filters frontend results by the tenant of the request and the enabled Authorizers.
+// All methods allow everything if tenant isolation is disabled and no Authorizer is enabled.
+type Filter struct {
+	options     options
+	Logger      logrus.FieldLogger
+	Authorizers *manager.List[Authorizer]
+
+	scopes map[string][]scope
+}
+
+var _ manager.Component = &Filter{}
+
+func (filter *Filter) Options() manager.Options { return &filter.options }
+
+func (filter *Filter) Init() error {
+	if !filter.options.enable {
+		return nil
+	}
+
+	scopes, err := parseScopes(filter.options.scopes)
+	if err != nil {
+		return fmt.Errorf("invalid --frontend-tenant-scope: %w", err)
+	}
+	filter.scopes = scopes
+
+	return nil
+}
+
+func (filter *Filter) Start(ctx context.Context) error { return nil }
+func (filter *Filter) Close(ctx context.Context) error { return nil }
+
+type tenantKey struct{}
+
+// WithTenant returns a context for a request from the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant of the request, or false if the request has no tenant.
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// RequestContext returns the context of an HTTP request with the tenant from the tenant header.
+func (filter *Filter) RequestContext(req *http.Request) context.Context {
+	ctx := req.Context()
+	if tenant := req.Header.Get(filter.options.header); tenant != "" {
+		ctx = WithTenant(ctx, tenant)
+	}
+	return ctx
+}
+
+func (filter *Filter) metadataContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(filter.options.header); len(values) > 0 && values[0] != "" {
+			ctx = WithTenant(ctx, values[0])
+		}
+	}
+	return ctx
+}
+
+// ServerOptions returns the gRPC server options that propagate the tenant from the request metadata.
+func (filter *Filter) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(
+			ctx context.Context,
+			req any,
+			info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler,
+		) (any, error) {
+			if auth.IsExemptGrpcMethod(info.FullMethod) {
+				return handler(ctx, req)
+			}
+			return handler(filter.metadataContext(ctx), req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if auth.IsExemptGrpcMethod(info.FullMethod) {
+				return handler(srv, stream)
+			}
+			return handler(srv, &tenantStream{ServerStream: stream, ctx: filter.metadataContext(stream.Context())})
+		}),
+	}
+}
+
+type tenantStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *tenantStream) Context() context.Context { return stream.ctx }
+
+// requestTenant returns the tenant of the authenticated user, or the tenant from the request header otherwise.
+func requestTenant(ctx context.Context) (string, bool) {
+	if user := auth.UserFromContext(ctx); user != nil && user.Tenant != "" {
+		return user.Tenant, true
+	}
+
+	return FromContext(ctx)
+}
+
+func (filter *Filter) tenantScopes(ctx context.Context) []scope {
+	tenant, ok := requestTenant(ctx)
+	if !ok {
+		return nil
+	}
+	return filter.scopes[tenant]
+}
+
+// CacheScope returns a key that is equal for requests that are filtered the same way,
+// so that filtered results can be cached for requests with the same key.
+func (filter *Filter) CacheScope(ctx context.Context) string {
+	parts := []string{}
+
+	if filter.options.enable {
+		tenant, _ := requestTenant(ctx)
+		parts = append(parts, "tenant="+tenant)
+	}
+
+	if len(filter.Authorizers.Impls) > 0 {
+		if user := auth.UserFromContext(ctx); user != nil {
+			parts = append(parts, "user="+user.Name, "groups="+strings.Join(user.Groups, ","))
+		} else {
+			parts = append(parts, "anonymous")
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// AllowsCluster returns whether the tenant of the request may see any object in the cluster.
+func (filter *Filter) AllowsCluster(ctx context.Context, cluster string) bool {
+	if !filter.options.enable {
+		return true
+	}
+
+	for _, scope := range filter.tenantScopes(ctx) {
+		if scope.allowsCluster(cluster) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows returns whether the tenant and the user of the request may see the object.
+func (filter *Filter) Allows(ctx context.Context, key utilobject.Key) bool {
+	if filter.options.enable && !filter.tenantAllows(ctx, key) {
+		return false
+	}
+
+	for _, authorizer := range filter.Authorizers.Impls {
+		if !authorizer.Authorize(ctx, key) {
+			return false
+		}
+	}
+	return true
+}
+
+func (filter *Filter) tenantAllows(ctx context.Context, key utilobject.Key) bool {
+	for _, scope := range filter.tenantScopes(ctx) {
+		if scope.allows(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (filter *Filter) filtersObjects() bool {
+	return filter.options.enable || len(filter.Authorizers.Impls) > 0
+}
+
+// FilterTree removes the subtrees of objects that the request may not see.
+// Returns false if the request may not see the root object, in which case the whole trace should be hidden.
+func (filter *Filter) FilterTree(ctx context.Context, tree *tftree.SpanTree) bool {
+	if !filter.filtersObjects() {
+		return true
+	}
+
+	if key, isObject := objectKey(tree.Root); isObject && !filter.Allows(ctx, key) {
+		return false
+	}
+
+	tree.Visit(&treeFilter{ctx: ctx, filter: filter})
+	return true
+}
+
+type treeFilter struct {
+	ctx    context.Context
+	filter *Filter
+}
+
+func (visitor *treeFilter) Enter(tree *tftree.SpanTree, span *model.Span) tftree.TreeVisitor {
+	if key, isObject := objectKey(span); isObject && span.SpanID != tree.Root.SpanID && !visitor.filter.Allows(visitor.ctx, key) {
+		tree.Delete(span.SpanID)
+		return nil
+	}
+	return visitor
+}
+
+func (visitor *treeFilter) Exit(tree *tftree.SpanTree, span *model.Span) {}
+
+// objectKey returns the object of a pseudospan.
+func objectKey(span *model.Span) (utilobject.Key, bool) {
+	tags := model.KeyValues(span.Tags)
+	if _, isPseudo := tags.FindByKey(zconstants.PseudoType); !isPseudo {
+		return utilobject.Key{}, false
+	}
+	if _, hasCluster := tags.FindByKey("cluster"); !hasCluster {
+		return utilobject.Key{}, false
+	}
+	return zconstants.ObjectKeyFromSpan(span), true
+}
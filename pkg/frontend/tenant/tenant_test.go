@@ -0,0 +1,145 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/http/auth"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func objectSpan(id, parent model.SpanID, cluster, namespace string) *model.Span {
+	span := &model.Span{SpanID: id, Tags: []model.KeyValue{
+		model.String(zconstants.PseudoType, string(zconstants.PseudoTypeObject)),
+		model.String("cluster", cluster),
+		model.String("namespace", namespace),
+	}}
+	if parent != 0 {
+		span.References = []model.SpanRef{{SpanID: parent, RefType: model.ChildOf}}
+	}
+	return span
+}
+
+func eventSpan(id, parent model.SpanID) *model.Span {
+	return &model.Span{SpanID: id, References: []model.SpanRef{{SpanID: parent, RefType: model.ChildOf}}}
+}
+
+func newTree() *tftree.SpanTree {
+	return tftree.NewSpanTree([]*model.Span{
+		objectSpan(1, 0, "prod", "payments"),
+		eventSpan(2, 1),
+		objectSpan(3, 1, "prod", "payments"),
+		// cluster-scoped object
+		objectSpan(4, 3, "prod", ""),
+		eventSpan(5, 4),
+		objectSpan(6, 1, "prod", "billing"),
+	})
+}
+
+func TestFilterTree(t *testing.T) {
+	assert := assert.New(t)
+
+	filter := &Filter{
+		options: options{
+			enable: true,
+			header: "x-tenant",
+			scopes: []string{"payments=prod/payments", "admin=*/*"},
+		},
+		Authorizers: &manager.List[Authorizer]{},
+	}
+	assert.NoError(filter.Init())
+
+	tree := newTree()
+	assert.True(filter.FilterTree(WithTenant(context.Background(), "payments"), tree))
+	assert.Equal(map[model.SpanID]struct{}{2: {}, 3: {}}, tree.Children(1))
+	assert.Len(tree.GetSpans(), 3)
+
+	tree = newTree()
+	assert.True(filter.FilterTree(WithTenant(context.Background(), "admin"), tree))
+	assert.Len(tree.GetSpans(), 6)
+
+	assert.False(filter.FilterTree(WithTenant(context.Background(), "billing"), newTree()))
+	assert.False(filter.FilterTree(context.Background(), newTree()))
+
+	assert.True(filter.AllowsCluster(WithTenant(context.Background(), "payments"), "prod"))
+	assert.False(filter.AllowsCluster(WithTenant(context.Background(), "payments"), "staging"))
+}
+
+func TestFilterDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	filter := &Filter{Authorizers: &manager.List[Authorizer]{}}
+	assert.NoError(filter.Init())
+
+	tree := newTree()
+	assert.True(filter.FilterTree(context.Background(), tree))
+	assert.Len(tree.GetSpans(), 6)
+}
+
+type namespaceAuthorizer struct {
+	denied string
+}
+
+func (authorizer namespaceAuthorizer) Authorize(ctx context.Context, key utilobject.Key) bool {
+	return key.Namespace != authorizer.denied
+}
+
+func TestAuthorizer(t *testing.T) {
+	assert := assert.New(t)
+
+	filter := &Filter{Authorizers: &manager.List[Authorizer]{Impls: []Authorizer{namespaceAuthorizer{denied: "billing"}}}}
+	assert.NoError(filter.Init())
+
+	tree := newTree()
+	assert.True(filter.FilterTree(context.Background(), tree))
+	assert.Equal(map[model.SpanID]struct{}{2: {}, 3: {}}, tree.Children(1))
+	assert.Len(tree.GetSpans(), 5)
+
+	filter.Authorizers.Impls = []Authorizer{namespaceAuthorizer{denied: "payments"}}
+	assert.False(filter.FilterTree(context.Background(), newTree()))
+}
+
+func TestParseScopes(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, invalid := range []string{"payments", "=prod/payments", "payments=prod", "payments=/payments"} {
+		_, err := parseScopes([]string{invalid})
+		assert.Error(err, invalid)
+	}
+}
+
+func TestCacheScope(t *testing.T) {
+	assert := assert.New(t)
+
+	filter := &Filter{Authorizers: &manager.List[Authorizer]{}}
+	assert.Equal(filter.CacheScope(WithTenant(context.Background(), "payments")), filter.CacheScope(context.Background()))
+
+	filter.options.enable = true
+	assert.NotEqual(filter.CacheScope(WithTenant(context.Background(), "payments")), filter.CacheScope(context.Background()))
+
+	filter.Authorizers.Impls = []Authorizer{namespaceAuthorizer{denied: "billing"}}
+	alice := auth.WithUser(context.Background(), &auth.User{Name: "alice", Tenant: "payments"})
+	bob := auth.WithUser(context.Background(), &auth.User{Name: "bob", Tenant: "payments"})
+	assert.NotEqual(filter.CacheScope(alice), filter.CacheScope(bob))
+	assert.Equal(filter.CacheScope(alice), filter.CacheScope(WithTenant(alice, "billing")))
+}
@@ -32,14 +32,56 @@ func init() {
 	}))
 }
 
+// DisplayModeTag is a search tag that selects the display mode of the request instead of filtering spans.
+const DisplayModeTag = "displayMode"
+
 type Provider interface {
 	Names() []string
+	// PresetNames returns the names of user-defined presets, which are also accepted by GetByName.
+	PresetNames() []string
 	DefaultName() string
 	DefaultId() Id
 	GetByName(name string) *Config
 	GetById(id Id) *Config
 }
 
+// Resolve returns the config selected by a display mode name, a preset name,
+// or a config name followed by modifier display names joined with "+", e.g. "tracing+full tree+adjacent windows".
+// An empty selection selects the default config.
+func Resolve(provider Provider, selection string) (*Config, error) {
+	selection = strings.TrimSpace(strings.TrimPrefix(selection, "* "))
+	if selection == "" {
+		return provider.GetById(provider.DefaultId()), nil
+	}
+
+	if config := provider.GetByName(selection); config != nil {
+		return config, nil
+	}
+
+	parts := strings.Split(selection, "+")
+	modifiers := sets.New[string]()
+	for _, modifier := range parts[1:] {
+		modifiers.Insert(strings.TrimSpace(modifier))
+	}
+
+	if config := provider.GetByName(FormatName(strings.TrimSpace(parts[0]), modifiers)); config != nil {
+		return config, nil
+	}
+
+	return nil, fmt.Errorf("invalid display mode %q", selection)
+}
+
+// FormatName returns the name of the config with the base name and modifiers.
+func FormatName(baseName string, modifierNames sets.Set[string]) string {
+	modifiers := modifierNames.UnsortedList()
+	sort.Strings(modifiers)
+	if len(modifiers) > 0 {
+		return fmt.Sprintf("%s [%s]", baseName, strings.Join(modifiers, "+"))
+	}
+
+	return baseName
+}
+
 type Id uint32
 
 func (id *Id) UnmarshalText(text []byte) error {
@@ -66,16 +108,12 @@ type Config struct {
 	Extensions []extension.Provider
 	// The steps to transform the tree
 	Steps []Step
+	// Number of adjacent trace windows of the root object to merge before and after the queried window.
+	FollowWindows uint32
 }
 
 func (config *Config) RecomputeName() {
-	modifiers := config.ModifierNames.UnsortedList()
-	sort.Strings(modifiers)
-	if len(modifiers) > 0 {
-		config.Name = fmt.Sprintf("%s [%s]", config.BaseName, strings.Join(modifiers, "+"))
-	} else {
-		config.Name = config.BaseName
-	}
+	config.Name = FormatName(config.BaseName, config.ModifierNames)
 }
 
 func (config *Config) Clone() *Config {
@@ -93,6 +131,7 @@ func (config *Config) Clone() *Config {
 		LinkSelector:  config.LinkSelector, // modifier changes LinkSelector by wrapping the previous value
 		Extensions:    extensions,
 		Steps:         steps,
+		FollowWindows: config.FollowWindows,
 	}
 }
 
@@ -101,6 +140,7 @@ type mux struct {
 }
 
 func (mux *mux) Names() []string               { return mux.Impl().(Provider).Names() }
+func (mux *mux) PresetNames() []string         { return mux.Impl().(Provider).PresetNames() }
 func (mux *mux) DefaultName() string           { return mux.Impl().(Provider).DefaultName() }
 func (mux *mux) DefaultId() Id                 { return mux.Impl().(Provider).DefaultId() }
 func (mux *mux) GetByName(name string) *Config { return mux.Impl().(Provider).GetByName(name) }
@@ -57,6 +57,7 @@ type FileProvider struct {
 	names          []string
 	configs        map[tfconfig.Id]registeredConfig
 	nameToConfigId map[string]tfconfig.Id
+	presetNames    []string
 	defaultConfig  tfconfig.Id
 }
 
@@ -120,6 +121,8 @@ func (p *FileProvider) loadJsonBytes(jsonBytes []byte) error {
 			Steps json.RawMessage `json:"steps"`
 		} `json:"configs"`
 		DefaultConfig tfconfig.Id `json:"defaultConfig"`
+		// Presets map user-defined names to display mode selections, e.g. "tracing+full tree".
+		Presets map[string]string `json:"presets"`
 	}
 	if err := json.Unmarshal(jsonBytes, &file); err != nil {
 		return fmt.Errorf("parse tfconfig error: %w", err)
@@ -191,7 +194,9 @@ func (p *FileProvider) loadJsonBytes(jsonBytes []byte) error {
 			Steps:         steps,
 		}
 
-		p.register(registeredConfig{config: config, modifierClasses: sets.New[string]()})
+		if err := p.register(registeredConfig{config: config, modifierClasses: sets.New[string]()}); err != nil {
+			return err
+		}
 	}
 
 	for _, modifier := range modifiers {
@@ -216,19 +221,50 @@ func (p *FileProvider) loadJsonBytes(jsonBytes []byte) error {
 		}
 
 		for _, newEntry := range newEntries {
-			p.register(newEntry)
+			if err := p.register(newEntry); err != nil {
+				return err
+			}
 		}
 	}
 
+	presetNames := make([]string, 0, len(file.Presets))
+	for name := range file.Presets {
+		presetNames = append(presetNames, name)
+	}
+	sort.Strings(presetNames)
+
+	for _, name := range presetNames {
+		selection := file.Presets[name]
+		if _, exists := p.nameToConfigId[name]; exists {
+			return fmt.Errorf("tfconfig preset %q conflicts with a display mode of the same name", name)
+		}
+
+		config, err := tfconfig.Resolve(p, selection)
+		if err != nil {
+			return fmt.Errorf("parse tfconfig preset %q error: %w", name, err)
+		}
+
+		p.nameToConfigId[name] = config.Id
+	}
+	p.presetNames = presetNames
+
 	return nil
 }
 
-func (p *FileProvider) register(regConfig registeredConfig) {
+func (p *FileProvider) register(regConfig registeredConfig) error {
 	config := regConfig.config
 
+	if existing, exists := p.configs[config.Id]; exists {
+		return fmt.Errorf(
+			"tfconfig ID %08x of %q collides with %q, modifier IDs must not overlap with config IDs or each other",
+			uint32(config.Id), config.Name, existing.config.Name,
+		)
+	}
+
 	p.names = append(p.names, config.Name)
 	p.configs[config.Id] = regConfig
 	p.nameToConfigId[config.Name] = config.Id
+	return nil
 }
 
 func (p *FileProvider) Start(ctx context.Context) error { return nil }
@@ -238,6 +274,8 @@ func (p *FileProvider) Names() []string {
 	return p.names
 }
 
+func (p *FileProvider) PresetNames() []string { return p.presetNames }
+
 func (p *FileProvider) DefaultName() string { return p.configs[p.defaultConfig].config.Name }
 
 func (p *FileProvider) DefaultId() tfconfig.Id { return p.defaultConfig }
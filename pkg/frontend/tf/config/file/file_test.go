@@ -0,0 +1,212 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfconfigfile
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	tfmodifier "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/modifier"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+type classModifierFactory struct{}
+
+func (classModifierFactory) ListIndex() string { return "class" }
+
+func (classModifierFactory) Build(jsonBuf []byte) (tfconfig.Modifier, error) {
+	var args struct {
+		Class string `json:"class"`
+	}
+	if err := json.Unmarshal(jsonBuf, &args); err != nil {
+		return nil, err
+	}
+	return classModifier(args.Class), nil
+}
+
+type classModifier string
+
+func (modifier classModifier) ModifierClass() string { return string(modifier) }
+
+func (modifier classModifier) Modify(config *tfconfig.Config) {}
+
+func newTestProvider() *FileProvider {
+	return &FileProvider{
+		RegisteredSteps: &manager.List[tfconfig.RegisteredStep]{Indexed: map[string]tfconfig.RegisteredStep{}},
+		RegisteredModifiers: &manager.List[tfconfig.ModifierFactory]{Indexed: map[string]tfconfig.ModifierFactory{
+			"class": classModifierFactory{},
+		}},
+		configs:        make(map[tfconfig.Id]registeredConfig),
+		nameToConfigId: make(map[string]tfconfig.Id),
+	}
+}
+
+const testConfig = `{
+	"defaultConfig": "20000000",
+	"configs": [
+		{"id": "00000000", "name": "tree", "steps": []},
+		{"id": "20000000", "name": "tracing", "steps": []}
+	],
+	"modifiers": {
+		"01000000": {"displayName": "full tree", "modifierName": "class", "args": {"class": "owner-ref"}},
+		"08000000": {"displayName": "storage", "modifierName": "class", "args": {"class": "storage"}}
+	},
+	"presets": {
+		"ownership": "tracing+full tree",
+		"everything": "tree + storage + full tree"
+	}
+}`
+
+func TestPresets(t *testing.T) {
+	assert := assert.New(t)
+
+	provider := newTestProvider()
+	assert.NoError(provider.loadJsonBytes([]byte(testConfig)))
+
+	assert.Equal([]string{"everything", "ownership"}, provider.PresetNames())
+	assert.NotContains(provider.Names(), "ownership")
+
+	config := provider.GetByName("ownership")
+	assert.NotNil(config)
+	assert.Equal(tfconfig.Id(0x21000000), config.Id)
+	assert.Equal("tracing [full tree]", config.Name)
+
+	config = provider.GetByName("everything")
+	assert.NotNil(config)
+	assert.Equal(tfconfig.Id(0x09000000), config.Id)
+}
+
+func TestPresetErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(newTestProvider().loadJsonBytes([]byte(`{
+		"configs": [{"id": "00000000", "name": "tree", "steps": []}],
+		"presets": {"broken": "tree+unknown"}
+	}`)))
+
+	assert.Error(newTestProvider().loadJsonBytes([]byte(`{
+		"configs": [{"id": "00000000", "name": "tree", "steps": []}],
+		"presets": {"tree": "tree"}
+	}`)))
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	provider := newTestProvider()
+	assert.NoError(provider.loadJsonBytes([]byte(testConfig)))
+
+	for selection, expectedId := range map[string]tfconfig.Id{
+		"":                          0x20000000,
+		"tree":                      0x00000000,
+		"* tracing":                 0x20000000,
+		"tracing [full tree]":       0x21000000,
+		"tracing+full tree+storage": 0x29000000,
+		"tracing + storage":         0x28000000,
+		"ownership":                 0x21000000,
+	} {
+		config, err := tfconfig.Resolve(provider, selection)
+		if assert.NoError(err, selection) {
+			assert.Equal(expectedId, config.Id, selection)
+		}
+	}
+
+	_, err := tfconfig.Resolve(provider, "timeline")
+	assert.Error(err)
+	_, err = tfconfig.Resolve(provider, "tracing+unknown")
+	assert.Error(err)
+}
+
+func TestIdCollision(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(newTestProvider().loadJsonBytes([]byte(`{
+		"configs": [
+			{"id": "00000000", "name": "tree", "steps": []},
+			{"id": "10000000", "name": "timeline", "steps": []}
+		],
+		"modifiers": {
+			"10000000": {"displayName": "overlapping", "modifierName": "class", "args": {"class": "overlapping"}}
+		}
+	}`)))
+}
+
+type stubStep string
+
+func (step stubStep) Run(tree *tftree.SpanTree) {}
+func (step stubStep) ListIndex() string         { return string(step) }
+func (step stubStep) Kind() string              { return string(step) }
+
+func (step stubStep) UnmarshalNewJSON(buf []byte) (tfconfig.Step, error) { return step, nil }
+
+const defaultConfigFile = "../../../../../hack/tfconfig.yaml"
+
+// stubStepsOf registers a stub step for every step kind referenced in the config file.
+func stubStepsOf(t *testing.T, path string) map[string]tfconfig.RegisteredStep {
+	yamlBytes, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	jsonBytes, err := yaml.ToJSON(yamlBytes)
+	assert.NoError(t, err)
+
+	type hasSteps struct {
+		Steps []struct {
+			Kind string `json:"kind"`
+		} `json:"steps"`
+	}
+	var file struct {
+		Batches []hasSteps `json:"batches"`
+		Configs []hasSteps `json:"configs"`
+	}
+	assert.NoError(t, json.Unmarshal(jsonBytes, &file))
+
+	steps := map[string]tfconfig.RegisteredStep{}
+	for _, list := range append(file.Batches, file.Configs...) {
+		for _, step := range list.Steps {
+			steps[step.Kind] = stubStep(step.Kind)
+		}
+	}
+	return steps
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+	assert := assert.New(t)
+
+	provider := newTestProvider()
+	provider.options.file = defaultConfigFile
+	provider.RegisteredSteps.Indexed = stubStepsOf(t, defaultConfigFile)
+	provider.RegisteredModifiers.Indexed = map[string]tfconfig.ModifierFactory{
+		"link-selector": &tfmodifier.LinkSelectorModifierFactory{},
+		"window-follow": &tfmodifier.WindowFollowModifierFactory{},
+	}
+	assert.NoError(provider.Init())
+
+	assert.Equal("tracing", provider.DefaultName())
+	for id, name := range map[tfconfig.Id]string{
+		0x00000000: "tree",
+		0x10000000: "timeline",
+		0x20000000: "tracing",
+		0x30000000: "grouped",
+	} {
+		if assert.NotNil(provider.GetById(id)) {
+			assert.Equal(name, provider.GetById(id).Name)
+		}
+	}
+}
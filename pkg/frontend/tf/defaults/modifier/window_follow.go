@@ -0,0 +1,85 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfmodifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"tf-modifier/window-follow",
+		manager.Ptr(&WindowFollowModifierFactory{}),
+		&manager.List[tfconfig.ModifierFactory]{},
+	)
+}
+
+type WindowFollowModifierOptions struct {
+	enable bool
+}
+
+func (options *WindowFollowModifierOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "jaeger-tf-window-follow-modifier-enable", true, "enable window follow modifiers and list it in frontend")
+}
+
+func (options *WindowFollowModifierOptions) EnableFlag() *bool { return &options.enable }
+
+type WindowFollowModifierFactory struct {
+	options WindowFollowModifierOptions
+}
+
+var _ manager.Component = &WindowFollowModifierFactory{}
+
+func (m *WindowFollowModifierFactory) Options() manager.Options        { return &m.options }
+func (m *WindowFollowModifierFactory) Init() error                     { return nil }
+func (m *WindowFollowModifierFactory) Start(ctx context.Context) error { return nil }
+func (m *WindowFollowModifierFactory) Close(ctx context.Context) error { return nil }
+
+func (*WindowFollowModifierFactory) ListIndex() string { return "window-follow" }
+
+func (*WindowFollowModifierFactory) Build(jsonBuf []byte) (tfconfig.Modifier, error) {
+	modifier := &WindowFollowModifier{}
+
+	if err := json.Unmarshal(jsonBuf, &modifier); err != nil {
+		return nil, fmt.Errorf("parse window follow modifier config: %w", err)
+	}
+
+	if modifier.Windows == 0 {
+		return nil, fmt.Errorf("window follow modifier must follow at least one window")
+	}
+
+	return modifier, nil
+}
+
+// WindowFollowModifier merges the traces of the root object in adjacent windows,
+// so that the history of an object can be traversed across trace window boundaries.
+type WindowFollowModifier struct {
+	Windows uint32 `json:"windows"`
+}
+
+func (*WindowFollowModifier) ModifierClass() string {
+	return "kelemetry.kubewharf.io/window-follow"
+}
+
+func (modifier *WindowFollowModifier) Modify(config *tfconfig.Config) {
+	config.FollowWindows = modifier.Windows
+}
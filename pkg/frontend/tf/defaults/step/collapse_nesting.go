@@ -40,6 +40,7 @@ func init() {
 // Deletes child spans with a non-pseudo trace source and injects them as logs in the nesting span.
 //
 // Multiple logs of the same span are aggregated into one log, flattening them into a field.
+// Child spans that have their own children are not collapsed.
 //
 // Must be followed by PruneTagsVisitor in the last step.
 type CollapseNestingVisitor struct {
@@ -153,6 +154,11 @@ func (visitor CollapseNestingVisitor) processChild(tree *tftree.SpanTree, span *
 		return
 	}
 
+	if len(tree.Children(childId)) > 0 {
+		// spans nested under the event, e.g. by NestCascadeDeletionVisitor, would be lost
+		return
+	}
+
 	traceSourceKv, hasTraceSource := model.KeyValues(childSpan.Tags).FindByKey(zconstants.TraceSource)
 	if !hasTraceSource {
 		return
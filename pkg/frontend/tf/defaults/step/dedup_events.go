@@ -0,0 +1,176 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilmarshal "github.com/kubewharf/kelemetry/pkg/util/marshal"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"tf-step/dedup-events-visitor",
+		manager.Ptr(&tfconfig.VisitorStep[DedupEventsVisitor]{}),
+		&manager.List[tfconfig.RegisteredStep]{},
+	)
+}
+
+const defaultDedupMaxDelay = time.Second * 5
+
+const mergedEventsTag = "mergedEvents"
+
+type DedupStrategy string
+
+const (
+	// Deletes the event span.
+	DedupStrategyDrop DedupStrategy = "drop"
+	// Appends the logs of the event span to the audit span and deletes the event span.
+	DedupStrategyMerge DedupStrategy = "merge"
+	// Moves the event span under the audit span.
+	DedupStrategyNest DedupStrategy = "nest"
+)
+
+func (strategy *DedupStrategy) UnmarshalText(text []byte) error {
+	switch DedupStrategy(text) {
+	case DedupStrategyDrop, DedupStrategyMerge, DedupStrategyNest:
+		*strategy = DedupStrategy(text)
+		return nil
+	default:
+		return fmt.Errorf("unknown dedup strategy %q", string(text))
+	}
+}
+
+// Correlates Kubernetes event spans with audit spans of the same object that describe the same action.
+//
+// An event span matches a rule if its reason matches and an audit span with the matching verb, subresource and username
+// starts within maxDelay of the event span. The closest matching audit span is used.
+type DedupEventsVisitor struct {
+	Rules []DedupRule `json:"rules"`
+}
+
+type DedupRule struct {
+	Reason      utilmarshal.StringFilter `json:"reason"`
+	Verb        utilmarshal.StringFilter `json:"verb"`
+	Subresource utilmarshal.StringFilter `json:"subresource"`
+	Username    utilmarshal.StringFilter `json:"username"`
+	// Defaults to 5s.
+	MaxDelay utilmarshal.Optional[utilmarshal.Duration] `json:"maxDelay"`
+	// Defaults to merge.
+	Strategy DedupStrategy `json:"strategy"`
+}
+
+func (DedupEventsVisitor) Kind() string { return "DedupEventsVisitor" }
+
+func (visitor DedupEventsVisitor) Enter(tree *tftree.SpanTree, span *model.Span) tftree.TreeVisitor {
+	if !hasPseudoType(span, zconstants.PseudoTypeObject) {
+		return visitor
+	}
+
+	var events, audits []*model.Span
+	for childId := range tree.Children(span.SpanID) {
+		child := tree.Span(childId)
+		traceSource, _ := model.KeyValues(child.Tags).FindByKey(zconstants.TraceSource)
+		switch traceSource.VStr {
+		case zconstants.TraceSourceEvent:
+			events = append(events, child)
+		case zconstants.TraceSourceAudit:
+			audits = append(audits, child)
+		}
+	}
+
+	if len(audits) == 0 {
+		return visitor
+	}
+
+	for _, event := range events {
+		for _, rule := range visitor.Rules {
+			if !rule.Reason.Matches(event.OperationName) {
+				continue
+			}
+
+			if audit := rule.closestAudit(event, audits); audit != nil {
+				rule.apply(tree, event, audit)
+				break
+			}
+		}
+	}
+
+	return visitor
+}
+
+func (visitor DedupEventsVisitor) Exit(tree *tftree.SpanTree, span *model.Span) {}
+
+func (rule DedupRule) closestAudit(event *model.Span, audits []*model.Span) *model.Span {
+	maxDelay := rule.MaxDelay.GetOr(utilmarshal.Duration{Duration: defaultDedupMaxDelay}).Duration
+
+	var closest *model.Span
+	var closestDelay time.Duration
+
+	for _, audit := range audits {
+		tags := model.KeyValues(audit.Tags)
+		verb, _ := tags.FindByKey("tag")
+		subresource, _ := tags.FindByKey("subresource")
+		username, _ := tags.FindByKey("username")
+		if !rule.Verb.Matches(verb.VStr) || !rule.Subresource.Matches(subresource.VStr) || !rule.Username.Matches(username.VStr) {
+			continue
+		}
+
+		delay := event.StartTime.Sub(audit.StartTime)
+		if delay < 0 {
+			delay = -delay
+		}
+
+		if delay <= maxDelay && (closest == nil || delay < closestDelay) {
+			closest = audit
+			closestDelay = delay
+		}
+	}
+
+	return closest
+}
+
+func (rule DedupRule) apply(tree *tftree.SpanTree, event *model.Span, audit *model.Span) {
+	switch rule.Strategy {
+	case DedupStrategyDrop:
+		tree.Delete(event.SpanID)
+	case DedupStrategyNest:
+		tree.Move(event.SpanID, audit.SpanID)
+	default:
+		audit.Logs = append(audit.Logs, event.Logs...)
+
+		merged := event.OperationName
+		for i, tag := range audit.Tags {
+			if tag.Key == mergedEventsTag {
+				audit.Tags[i].VStr = strings.Join([]string{tag.VStr, merged}, ",")
+				merged = ""
+				break
+			}
+		}
+		if merged != "" {
+			audit.Tags = append(audit.Tags, model.String(mergedEventsTag, merged))
+		}
+
+		tree.Delete(event.SpanID)
+	}
+}
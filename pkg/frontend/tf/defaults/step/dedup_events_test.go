@@ -0,0 +1,101 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	tfstep "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/step"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func eventSpan(id, parent model.SpanID, start time.Time, reason string, message string) *model.Span {
+	span := makeSpan(id, parent, start, "", model.String(zconstants.TraceSource, zconstants.TraceSourceEvent))
+	span.OperationName = reason
+	span.Logs = []model.Log{{Timestamp: start, Fields: []model.KeyValue{model.String("event", message)}}}
+	return span
+}
+
+func auditSpan(id, parent model.SpanID, start time.Time, verb string, subresource string) *model.Span {
+	return makeSpan(
+		id, parent, start, "",
+		model.String(zconstants.TraceSource, zconstants.TraceSourceAudit),
+		model.String("tag", verb),
+		model.String("subresource", subresource),
+	)
+}
+
+func TestDedupEvents(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newTree := func() *tftree.SpanTree {
+		return tftree.NewSpanTree([]*model.Span{
+			objectSpan(1, 0, base),
+			auditSpan(2, 1, base, "create", ""),
+			auditSpan(3, 1, base.Add(time.Millisecond*10), "create", "binding"),
+			eventSpan(4, 1, base.Add(time.Millisecond*20), "Scheduled", "assigned default/web-1 to node-1"),
+			// too far from the binding
+			eventSpan(5, 1, base.Add(time.Minute), "Scheduled", "assigned default/web-1 to node-2"),
+			eventSpan(6, 1, base.Add(time.Millisecond*20), "Pulled", "image pulled"),
+		})
+	}
+
+	for _, tc := range []struct {
+		strategy       string
+		expectChildren map[model.SpanID]struct{}
+		expectNested   map[model.SpanID]struct{}
+		expectLogs     int
+	}{
+		{strategy: "merge", expectChildren: map[model.SpanID]struct{}{2: {}, 3: {}, 5: {}, 6: {}}, expectLogs: 1},
+		{strategy: "drop", expectChildren: map[model.SpanID]struct{}{2: {}, 3: {}, 5: {}, 6: {}}},
+		{strategy: "nest", expectChildren: map[model.SpanID]struct{}{2: {}, 3: {}, 5: {}, 6: {}}, expectNested: map[model.SpanID]struct{}{4: {}}},
+	} {
+		t.Run(tc.strategy, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var visitor tfstep.DedupEventsVisitor
+			assert.NoError(json.Unmarshal([]byte(`{"rules": [{
+				"reason": "Scheduled", "verb": "create", "subresource": "binding", "maxDelay": "1s", "strategy": "`+tc.strategy+`"
+			}]}`), &visitor))
+
+			tree := newTree()
+			tree.Visit(visitor)
+
+			assert.Equal(tc.expectChildren, tree.Children(1))
+			if tc.expectNested != nil {
+				assert.Equal(tc.expectNested, tree.Children(3))
+			} else {
+				assert.Empty(tree.Children(3))
+			}
+
+			binding := tree.Span(3)
+			assert.Len(binding.Logs, tc.expectLogs)
+			merged, hasMerged := model.KeyValues(binding.Tags).FindByKey("mergedEvents")
+			assert.Equal(tc.strategy == "merge", hasMerged)
+			if hasMerged {
+				assert.Equal("Scheduled", merged.VStr)
+			}
+		})
+	}
+
+	var visitor tfstep.DedupEventsVisitor
+	assert.Error(t, json.Unmarshal([]byte(`{"rules": [{"strategy": "unknown"}]}`), &visitor))
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilmarshal "github.com/kubewharf/kelemetry/pkg/util/marshal"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"tf-step/deep-link-visitor",
+		manager.Ptr(&tfconfig.VisitorStep[DeepLinkVisitor]{}),
+		&manager.List[tfconfig.RegisteredStep]{},
+	)
+}
+
+// Adds tags with links to other systems, such as the original audit log entry in a logging system,
+// rendered from URL templates of the span tags.
+//
+// Must run before PruneTagsVisitor, which removes the trace source tag.
+type DeepLinkVisitor struct {
+	Links []DeepLink `json:"links"`
+}
+
+type DeepLink struct {
+	// The tag to set to the rendered URL.
+	Tag string `json:"tag"`
+	// Only add links to spans of matching trace sources, e.g. "audit".
+	TraceSource utilmarshal.StringFilter `json:"traceSource"`
+	// Only add links to spans of objects in matching clusters.
+	// If multiple links of the same tag match a span, only the first one is added,
+	// so per-cluster templates can be followed by a default template.
+	Cluster utilmarshal.StringFilter `json:"cluster"`
+	// A text/template of the URL.
+	// The template is executed on the tags of the span, with `start` and `end` set to the span start and end time,
+	// and the `unixSeconds`, `unixMilli` and `rfc3339` functions to format them.
+	// The link is not added if the template refers to a tag that the span does not have.
+	UrlTemplate DeepLinkTemplate `json:"urlTemplate"`
+}
+
+type DeepLinkTemplate struct {
+	*template.Template
+}
+
+func (t *DeepLinkTemplate) UnmarshalJSON(buf []byte) error {
+	var str string
+	if err := json.Unmarshal(buf, &str); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("url").Option("missingkey=error").Funcs(deepLinkFuncs).Parse(str)
+	if err != nil {
+		return fmt.Errorf("invalid url template %q: %w", str, err)
+	}
+
+	t.Template = tmpl
+	return nil
+}
+
+var deepLinkFuncs = template.FuncMap{
+	"unixSeconds": func(t time.Time) int64 { return t.Unix() },
+	"unixMilli":   func(t time.Time) int64 { return t.UnixMilli() },
+	"rfc3339":     func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+}
+
+func (DeepLinkVisitor) Kind() string { return "DeepLinkVisitor" }
+
+func (visitor DeepLinkVisitor) Enter(tree *tftree.SpanTree, span *model.Span) tftree.TreeVisitor {
+	tags := model.KeyValues(span.Tags)
+
+	traceSource, hasTraceSource := tags.FindByKey(zconstants.TraceSource)
+	if !hasTraceSource || traceSource.VStr == zconstants.TraceSourceObject {
+		return visitor
+	}
+	cluster, _ := tags.FindByKey("cluster")
+
+	data := map[string]any{}
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Key, zconstants.Prefix) {
+			data[tag.Key] = tag.AsStringLossy()
+		}
+	}
+	data["start"] = span.StartTime
+	data["end"] = span.StartTime.Add(span.Duration)
+
+	added := map[string]struct{}{}
+	for _, link := range visitor.Links {
+		if _, exists := added[link.Tag]; exists {
+			continue
+		}
+		if !link.TraceSource.Matches(traceSource.VStr) || !link.Cluster.Matches(cluster.VStr) || link.UrlTemplate.Template == nil {
+			continue
+		}
+
+		url := &strings.Builder{}
+		if err := link.UrlTemplate.Execute(url, data); err != nil {
+			// the span does not have the tags required by the template
+			continue
+		}
+
+		span.Tags = append(span.Tags, model.String(link.Tag, url.String()))
+		added[link.Tag] = struct{}{}
+	}
+
+	return visitor
+}
+
+func (visitor DeepLinkVisitor) Exit(tree *tftree.SpanTree, span *model.Span) {}
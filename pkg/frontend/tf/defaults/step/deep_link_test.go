@@ -0,0 +1,90 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	tfstep "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/step"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func TestDeepLink(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var visitor tfstep.DeepLinkVisitor
+	assert.NoError(json.Unmarshal([]byte(`{"links": [
+		{
+			"tag": "auditLog",
+			"traceSource": "audit",
+			"cluster": {"regex": "^prod-"},
+			"urlTemplate": "https://splunk.example.com/search?q=auditID%3D{{.auditId | urlquery}}&earliest={{unixSeconds .start}}"
+		},
+		{
+			"tag": "auditLog",
+			"traceSource": "audit",
+			"urlTemplate": "https://es.example.com/audit/{{.cluster}}/{{.auditId}}"
+		},
+		{
+			"tag": "controllerLogs",
+			"traceSource": "audit",
+			"urlTemplate": "https://es.example.com/logs?user={{.username}}&from={{rfc3339 .start}}"
+		}
+	]}`), &visitor))
+
+	prodAudit := makeSpan(2, 1, base, "",
+		model.String(zconstants.TraceSource, zconstants.TraceSourceAudit),
+		model.String("cluster", "prod-1"),
+		model.String("auditId", "a b"),
+		model.String("username", "system:serviceaccount:kube-system:deployment-controller"),
+	)
+	testAudit := makeSpan(3, 1, base, "",
+		model.String(zconstants.TraceSource, zconstants.TraceSourceAudit),
+		model.String("cluster", "test"),
+		model.String("auditId", "c"),
+	)
+	event := makeSpan(4, 1, base, "",
+		model.String(zconstants.TraceSource, zconstants.TraceSourceEvent),
+		model.String("cluster", "prod-1"),
+	)
+
+	tree := tftree.NewSpanTree([]*model.Span{objectSpan(1, 0, base), prodAudit, testAudit, event})
+	tree.Visit(visitor)
+
+	link := func(span *model.Span, tag string) string {
+		kv, _ := model.KeyValues(span.Tags).FindByKey(tag)
+		return kv.VStr
+	}
+
+	assert.Equal("https://splunk.example.com/search?q=auditID%3Da+b&earliest=1672531200", link(prodAudit, "auditLog"))
+	assert.Equal(
+		"https://es.example.com/logs?user=system:serviceaccount:kube-system:deployment-controller&from=2023-01-01T00:00:00Z",
+		link(prodAudit, "controllerLogs"),
+	)
+
+	assert.Equal("https://es.example.com/audit/test/c", link(testAudit, "auditLog"))
+	// the span has no username tag
+	assert.Equal("", link(testAudit, "controllerLogs"))
+
+	assert.Len(event.Tags, 2)
+}
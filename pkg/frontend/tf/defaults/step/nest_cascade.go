@@ -0,0 +1,134 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep
+
+import (
+	"github.com/jaegertracing/jaeger/model"
+
+	tfconfig "github.com/kubewharf/kelemetry/pkg/frontend/tf/config"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilmarshal "github.com/kubewharf/kelemetry/pkg/util/marshal"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl(
+		"tf-step/nest-cascade-deletion-visitor",
+		manager.Ptr(&tfconfig.VisitorStep[NestCascadeDeletionVisitor]{}),
+		&manager.List[tfconfig.RegisteredStep]{},
+	)
+}
+
+const defaultGarbageCollector = "system:serviceaccount:kube-system:generic-garbage-collector"
+
+// Moves the object spans of children deleted by the garbage collector under the delete span of their parent.
+//
+// A child object is nested if it is linked under the parent object, directly or through a link class span,
+// and it has a delete span by the garbage collector that starts after the delete span of the parent.
+//
+// Must precede CollapseNestingVisitor, which retains event spans with children.
+type NestCascadeDeletionVisitor struct {
+	// Filters the link classes between parent and child objects.
+	LinkClass utilmarshal.StringFilter `json:"linkClass"`
+	// Filters the usernames of child deletions. Defaults to the kube-controller-manager garbage collector.
+	Deleter utilmarshal.Optional[utilmarshal.StringFilter] `json:"deleter"`
+}
+
+func (NestCascadeDeletionVisitor) Kind() string { return "NestCascadeDeletionVisitor" }
+
+func (visitor NestCascadeDeletionVisitor) Enter(tree *tftree.SpanTree, span *model.Span) tftree.TreeVisitor {
+	if !hasPseudoType(span, zconstants.PseudoTypeObject) {
+		return visitor
+	}
+
+	parentDeletion := findDeletion(tree, span.SpanID, func(string) bool { return true })
+	if parentDeletion == nil {
+		return visitor
+	}
+
+	for _, childId := range visitor.linkedChildren(tree, span.SpanID) {
+		childDeletion := findDeletion(tree, childId, visitor.matchesDeleter)
+		if childDeletion != nil && !childDeletion.StartTime.Before(parentDeletion.StartTime) {
+			tree.Move(childId, parentDeletion.SpanID)
+		}
+	}
+
+	return visitor
+}
+
+func (visitor NestCascadeDeletionVisitor) Exit(tree *tftree.SpanTree, span *model.Span) {}
+
+func (visitor NestCascadeDeletionVisitor) matchesDeleter(username string) bool {
+	if visitor.Deleter.IsSet {
+		return visitor.Deleter.Value.Matches(username)
+	}
+
+	return username == defaultGarbageCollector
+}
+
+// linkedChildren returns the object spans nested under the object span directly or through a matching link class span.
+func (visitor NestCascadeDeletionVisitor) linkedChildren(tree *tftree.SpanTree, spanId model.SpanID) []model.SpanID {
+	var objects []model.SpanID
+
+	for childId := range tree.Children(spanId) {
+		child := tree.Span(childId)
+
+		if hasPseudoType(child, zconstants.PseudoTypeObject) {
+			objects = append(objects, childId)
+		} else if hasPseudoType(child, zconstants.PseudoTypeLinkClass) && child.Process != nil && visitor.LinkClass.Matches(child.Process.ServiceName) {
+			for grandchildId := range tree.Children(childId) {
+				if hasPseudoType(tree.Span(grandchildId), zconstants.PseudoTypeObject) {
+					objects = append(objects, grandchildId)
+				}
+			}
+		}
+	}
+
+	return objects
+}
+
+// findDeletion returns the earliest audit delete span directly under the object span by a matching user.
+func findDeletion(tree *tftree.SpanTree, spanId model.SpanID, matchesUser func(string) bool) *model.Span {
+	var earliest *model.Span
+
+	for childId := range tree.Children(spanId) {
+		child := tree.Span(childId)
+		tags := model.KeyValues(child.Tags)
+
+		if traceSource, _ := tags.FindByKey(zconstants.TraceSource); traceSource.VStr != zconstants.TraceSourceAudit {
+			continue
+		}
+
+		if verb, _ := tags.FindByKey("tag"); verb.VStr != "delete" {
+			continue
+		}
+
+		if username, _ := tags.FindByKey("username"); !matchesUser(username.VStr) {
+			continue
+		}
+
+		if earliest == nil || child.StartTime.Before(earliest.StartTime) {
+			earliest = child
+		}
+	}
+
+	return earliest
+}
+
+func hasPseudoType(span *model.Span, pseudoType zconstants.PseudoTypeValue) bool {
+	value, isPseudo := model.KeyValues(span.Tags).FindByKey(zconstants.PseudoType)
+	return isPseudo && value.VStr == string(pseudoType)
+}
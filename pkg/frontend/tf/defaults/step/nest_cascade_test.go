@@ -0,0 +1,85 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tfstep_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	tfstep "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/step"
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func makeSpan(id model.SpanID, parent model.SpanID, start time.Time, service string, tags ...model.KeyValue) *model.Span {
+	span := &model.Span{SpanID: id, StartTime: start, Tags: tags, Process: &model.Process{ServiceName: service}}
+	if parent != 0 {
+		span.References = []model.SpanRef{{SpanID: parent, RefType: model.ChildOf}}
+	}
+	return span
+}
+
+func objectSpan(id, parent model.SpanID, start time.Time) *model.Span {
+	return makeSpan(id, parent, start, "", model.String(zconstants.PseudoType, string(zconstants.PseudoTypeObject)))
+}
+
+func deleteSpan(id, parent model.SpanID, start time.Time, username string) *model.Span {
+	return makeSpan(
+		id, parent, start, "",
+		model.String(zconstants.TraceSource, zconstants.TraceSourceAudit),
+		model.String("tag", "delete"),
+		model.String("username", username),
+	)
+}
+
+func TestNestCascadeDeletion(t *testing.T) {
+	assert := assert.New(t)
+
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	gc := "system:serviceaccount:kube-system:generic-garbage-collector"
+
+	tree := tftree.NewSpanTree([]*model.Span{
+		objectSpan(1, 0, base),
+		deleteSpan(2, 1, base.Add(time.Second), "admin"),
+		makeSpan(3, 1, base, "children", model.String(zconstants.PseudoType, string(zconstants.PseudoTypeLinkClass))),
+		// deleted by the garbage collector after the parent
+		objectSpan(4, 3, base),
+		deleteSpan(5, 4, base.Add(time.Second*2), gc),
+		// deleted by another user
+		objectSpan(6, 3, base),
+		deleteSpan(7, 6, base.Add(time.Second*2), "admin"),
+		// deleted by the garbage collector before the parent
+		objectSpan(8, 3, base),
+		deleteSpan(9, 8, base, gc),
+		// nested grandchild
+		deleteSpan(10, 4, base.Add(time.Second), "admin"),
+		objectSpan(11, 4, base),
+		deleteSpan(12, 11, base.Add(time.Second*3), gc),
+	})
+
+	var visitor tfstep.NestCascadeDeletionVisitor
+	assert.NoError(json.Unmarshal([]byte(`{"linkClass": "children"}`), &visitor))
+	tree.Visit(visitor)
+
+	assert.Equal(map[model.SpanID]struct{}{2: {}, 3: {}}, tree.Children(1))
+	assert.Equal(map[model.SpanID]struct{}{4: {}}, tree.Children(2))
+	assert.Equal(map[model.SpanID]struct{}{6: {}, 8: {}}, tree.Children(3))
+	assert.Equal(map[model.SpanID]struct{}{5: {}, 10: {}}, tree.Children(4))
+	assert.Equal(map[model.SpanID]struct{}{11: {}}, tree.Children(10))
+}
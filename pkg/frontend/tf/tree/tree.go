@@ -50,6 +50,7 @@ func NewSpanTree(spans []*model.Span) *SpanTree {
 
 	for _, span := range spans {
 		tree.spanMap[span.SpanID] = span
+		span.References = parentReferences(span.References)
 		if len(span.References) == 0 {
 			tree.Root = span
 		} else {
@@ -69,6 +70,20 @@ func NewSpanTree(spans []*model.Span) *SpanTree {
 	return tree
 }
 
+// parentReferences retains the first child-of reference, which identifies the parent span.
+//
+// Follows-from references are produced from span links (e.g. to previous windows or external traces),
+// which are not part of the span tree.
+func parentReferences(refs []model.SpanRef) []model.SpanRef {
+	for _, ref := range refs {
+		if ref.RefType == model.ChildOf {
+			return []model.SpanRef{ref}
+		}
+	}
+
+	return nil
+}
+
 func (tree *SpanTree) Clone() (*SpanTree, error) {
 	copiedSpans := make([]*model.Span, 0, len(tree.spanMap))
 	for _, span := range tree.spanMap {
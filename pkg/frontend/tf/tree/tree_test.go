@@ -0,0 +1,44 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tftree_test
+
+import (
+	"testing"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	tftree "github.com/kubewharf/kelemetry/pkg/frontend/tf/tree"
+)
+
+func TestNewSpanTreeIgnoresFollowsFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	traceId := model.NewTraceID(1, 1)
+	otherTraceId := model.NewTraceID(2, 2)
+
+	tree := tftree.NewSpanTree([]*model.Span{
+		{SpanID: 1, References: []model.SpanRef{model.NewFollowsFromRef(otherTraceId, 3)}},
+		{SpanID: 2, References: []model.SpanRef{
+			model.NewFollowsFromRef(otherTraceId, 4),
+			model.NewChildOfRef(traceId, 1),
+		}},
+	})
+
+	assert.Equal(model.SpanID(1), tree.Root.SpanID)
+	assert.Empty(tree.Root.References)
+	assert.Equal(map[model.SpanID]struct{}{2: {}}, tree.Children(1))
+	assert.Equal([]model.SpanRef{model.NewChildOfRef(traceId, 1)}, tree.Span(2).References)
+}
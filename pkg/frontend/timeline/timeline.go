@@ -0,0 +1,163 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Renders a trace as a timeline of events ordered by time,
+// so that incident timelines can be pasted into postmortems.
+//
+// Traces are rendered after transformation, so the display mode must display events as spans (e.g. "tree").
+package timeline
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+)
+
+// Tags identifying the object of a span, which are rendered as Entry.Object instead of Entry.Tags.
+var objectTags = map[string]struct{}{
+	"cluster":   {},
+	"group":     {},
+	"version":   {},
+	"resource":  {},
+	"namespace": {},
+	"name":      {},
+}
+
+type Timeline struct {
+	TraceId string  `json:"traceId"`
+	Entries []Entry `json:"entries"`
+}
+
+type Entry struct {
+	Time       time.Time `json:"time"`
+	DurationUs int64     `json:"durationUs"`
+	// Object is the resource, namespace and name of the object that the event belongs to.
+	Object string            `json:"object"`
+	Event  string            `json:"event"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// Logs are the log messages of the event, such as event messages and object diffs.
+	Logs []string `json:"logs,omitempty"`
+}
+
+// objectOf returns the object identity if the span is an object span.
+func objectOf(span *model.Span) (string, bool) {
+	tags := model.KeyValues(span.Tags)
+	resource, hasResource := tags.FindByKey("resource")
+	name, hasName := tags.FindByKey("name")
+	if !hasResource || !hasName {
+		return "", false
+	}
+
+	if namespace, _ := tags.FindByKey("namespace"); namespace.AsString() != "" {
+		return fmt.Sprintf("%s %s/%s", resource.AsString(), namespace.AsString(), name.AsString()), true
+	}
+	return fmt.Sprintf("%s %s", resource.AsString(), name.AsString()), true
+}
+
+// Build renders the event spans of a trace, i.e. the spans that are not object spans, ordered by start time.
+func Build(trace *model.Trace) *Timeline {
+	timeline := &Timeline{Entries: []Entry{}}
+	if len(trace.Spans) > 0 {
+		timeline.TraceId = trace.Spans[0].TraceID.String()
+	}
+
+	spanMap := make(map[model.SpanID]*model.Span, len(trace.Spans))
+	for _, span := range trace.Spans {
+		spanMap[span.SpanID] = span
+	}
+
+	objectOfAncestor := func(span *model.Span) string {
+		for depth := 0; span != nil && depth < len(spanMap); depth++ {
+			if object, isObject := objectOf(span); isObject {
+				return object
+			}
+			span = spanMap[span.ParentSpanID()]
+		}
+		return ""
+	}
+
+	for _, span := range trace.Spans {
+		if _, isObject := objectOf(span); isObject {
+			continue
+		}
+
+		entry := Entry{
+			Time:       span.StartTime,
+			DurationUs: span.Duration.Microseconds(),
+			Object:     objectOfAncestor(spanMap[span.ParentSpanID()]),
+			Event:      span.OperationName,
+			Tags:       map[string]string{},
+		}
+
+		for _, tag := range span.Tags {
+			if _, isObjectTag := objectTags[tag.Key]; !isObjectTag {
+				entry.Tags[tag.Key] = tag.AsString()
+			}
+		}
+
+		for _, log := range span.Logs {
+			for _, field := range log.Fields {
+				if field.Key == "event" {
+					entry.Logs = append(entry.Logs, field.AsString())
+				} else {
+					entry.Logs = append(entry.Logs, fmt.Sprintf("%s: %s", field.Key, field.AsString()))
+				}
+			}
+		}
+
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+
+	sort.SliceStable(timeline.Entries, func(i, j int) bool {
+		return timeline.Entries[i].Time.Before(timeline.Entries[j].Time)
+	})
+
+	return timeline
+}
+
+// WriteText writes the timeline as plain text with one line per event,
+// followed by the tags and the indented logs of the event.
+func (timeline *Timeline) WriteText(writer io.Writer) error {
+	builder := &strings.Builder{}
+
+	for _, entry := range timeline.Entries {
+		fmt.Fprintf(builder, "%s  %s  %s", entry.Time.UTC().Format(time.RFC3339Nano), entry.Object, entry.Event)
+		if entry.DurationUs > 0 {
+			fmt.Fprintf(builder, "  (%v)", time.Duration(entry.DurationUs)*time.Microsecond)
+		}
+		builder.WriteString("\n")
+
+		tagKeys := make([]string, 0, len(entry.Tags))
+		for key := range entry.Tags {
+			tagKeys = append(tagKeys, key)
+		}
+		sort.Strings(tagKeys)
+		for _, key := range tagKeys {
+			fmt.Fprintf(builder, "    %s=%s\n", key, entry.Tags[key])
+		}
+
+		for _, log := range entry.Logs {
+			for _, line := range strings.Split(log, "\n") {
+				fmt.Fprintf(builder, "    | %s\n", line)
+			}
+		}
+	}
+
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
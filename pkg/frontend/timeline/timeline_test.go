@@ -0,0 +1,78 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeline_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/model"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/frontend/timeline"
+)
+
+var base = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func span(id, parent model.SpanID, name string, offset time.Duration, tags ...model.KeyValue) *model.Span {
+	span := &model.Span{SpanID: id, OperationName: name, StartTime: base.Add(offset), Tags: tags}
+	if parent != 0 {
+		span.References = []model.SpanRef{model.NewChildOfRef(model.TraceID{}, parent)}
+	}
+	return span
+}
+
+func TestBuild(t *testing.T) {
+	assert := assert.New(t)
+
+	update := span(3, 1, "update", time.Second*2, model.String("userAgent", "kubectl"))
+	update.Logs = []model.Log{{Fields: []model.KeyValue{
+		model.String("event", "spec.replicas 1 -> 2"),
+		model.String("note", "scaled"),
+	}}}
+
+	trace := &model.Trace{Spans: []*model.Span{
+		span(1, 0, "deployments web", 0, model.String("resource", "deployments"), model.String("namespace", "default"),
+			model.String("name", "web")),
+		update,
+		span(2, 1, "create", time.Second),
+		span(4, 0, "nodes node-1", 0, model.String("resource", "nodes"), model.String("name", "node-1")),
+		span(5, 4, "NodeNotReady", time.Second*3),
+	}}
+
+	result := timeline.Build(trace)
+	assert.Equal([]timeline.Entry{
+		{Time: base.Add(time.Second), Object: "deployments default/web", Event: "create", Tags: map[string]string{}},
+		{
+			Time:   base.Add(time.Second * 2),
+			Object: "deployments default/web",
+			Event:  "update",
+			Tags:   map[string]string{"userAgent": "kubectl"},
+			Logs:   []string{"spec.replicas 1 -> 2", "note: scaled"},
+		},
+		{Time: base.Add(time.Second * 3), Object: "nodes node-1", Event: "NodeNotReady", Tags: map[string]string{}},
+	}, result.Entries)
+
+	text := &strings.Builder{}
+	assert.NoError(result.WriteText(text))
+	assert.Equal(`2023-01-01T00:00:01Z  deployments default/web  create
+2023-01-01T00:00:02Z  deployments default/web  update
+    userAgent=kubectl
+    | spec.replicas 1 -> 2
+    | note: scaled
+2023-01-01T00:00:03Z  nodes node-1  NodeNotReady
+`, text.String())
+}
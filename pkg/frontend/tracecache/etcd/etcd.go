@@ -26,6 +26,7 @@ import (
 
 	tracecache "github.com/kubewharf/kelemetry/pkg/frontend/tracecache"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -39,12 +40,21 @@ var _ tracecache.Cache = &etcdCache{}
 
 type options struct {
 	endpoints   []string
+	username    string
+	password    string
 	prefix      string
 	dialTimeout time.Duration
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.StringSliceVar(&options.endpoints, "jaeger-trace-cache-etcd-endpoints", []string{}, "etcd endpoints")
+	fs.StringVar(&options.username, "jaeger-trace-cache-etcd-username", "", "etcd username; accepts secret references such as 'file:/path'")
+	fs.StringVar(
+		&options.password,
+		"jaeger-trace-cache-etcd-password",
+		"",
+		"etcd password; accepts secret references such as 'file:/path', which are resolved on startup",
+	)
 	fs.StringVar(&options.prefix, "jaeger-trace-cache-etcd-prefix", "/trace/", "etcd prefix")
 	fs.DurationVar(
 		&options.dialTimeout,
@@ -61,6 +71,7 @@ type etcdCache struct {
 
 	options   options
 	Logger    logrus.FieldLogger
+	Secrets   *secret.Store
 	deferList *shutdown.DeferList
 
 	client *etcdv3.Client
@@ -75,8 +86,20 @@ func (cache *etcdCache) Init() error {
 		return fmt.Errorf("no etcd endpoints provided")
 	}
 
+	// the etcd client cannot change credentials without reconnecting
+	username, err := cache.Secrets.Resolve("jaeger-trace-cache-etcd-username", cache.options.username)
+	if err != nil {
+		return err
+	}
+	password, err := cache.Secrets.Resolve("jaeger-trace-cache-etcd-password", cache.options.password)
+	if err != nil {
+		return err
+	}
+
 	client, err := etcdv3.New(etcdv3.Config{
 		Endpoints:   cache.options.endpoints,
+		Username:    username,
+		Password:    password,
 		DialTimeout: cache.options.dialTimeout,
 	})
 	if err != nil {
@@ -0,0 +1,256 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Delegates object link resolution to external plugins over gRPC.
+//
+// See the protocol package for the plugin protocol.
+package grpclinker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/grpclinker/protocol"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+	"github.com/kubewharf/kelemetry/pkg/util/cache"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("grpc-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	plugins  map[string]string
+	timeout  time.Duration
+	cacheTtl time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringToStringVar(
+		&options.plugins,
+		"grpc-linker-plugin",
+		map[string]string{},
+		"linker plugins to call, in the form name=address. "+
+			"Connections are not encrypted unless --mtls-enable is set, so plugins should otherwise run as sidecars or in a trusted network",
+	)
+	fs.DurationVar(&options.timeout, "grpc-linker-plugin-timeout", time.Second*2, "timeout for each plugin call")
+	fs.DurationVar(
+		&options.cacheTtl,
+		"grpc-linker-plugin-cache-ttl",
+		time.Minute,
+		"duration for which plugin results of the same object are reused; 0 to disable caching",
+	)
+}
+
+func (options *options) EnableFlag() *bool {
+	hasPlugins := len(options.plugins) > 0
+	return &hasPlugins
+}
+
+type controller struct {
+	options     options
+	Logger      logrus.FieldLogger
+	Clock       clock.Clock
+	ObjectCache *objectcache.ObjectCache
+	Mtls        *mtls.Provider
+
+	CallMetric *metrics.Metric[*callMetric]
+
+	plugins []*plugin
+	cache   *cache.TtlOnce
+}
+
+type plugin struct {
+	name   string
+	conn   *grpc.ClientConn
+	client *protocol.LinkerClient
+}
+
+type callMetric struct {
+	Plugin string
+	Cached bool
+	Error  metrics.LabeledError
+}
+
+func (*callMetric) MetricName() string { return "grpc_linker_call" }
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+
+func (ctrl *controller) Init() error {
+	names := make([]string, 0, len(ctrl.options.plugins))
+	for name := range ctrl.options.plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		address := ctrl.options.plugins[name]
+		conn, err := grpc.NewClient(address, ctrl.Mtls.GrpcDialOption())
+		if err != nil {
+			return fmt.Errorf("cannot create client for linker plugin %q: %w", name, err)
+		}
+
+		ctrl.plugins = append(ctrl.plugins, &plugin{
+			name:   name,
+			conn:   conn,
+			client: protocol.NewLinkerClient(conn),
+		})
+	}
+
+	if ctrl.options.cacheTtl > 0 {
+		ctrl.cache = cache.NewTtlOnce(ctrl.options.cacheTtl, ctrl.Clock)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Start(ctx context.Context) error {
+	if ctrl.cache != nil {
+		go ctrl.cache.RunCleanupLoop(ctx, ctrl.Logger)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Close(ctx context.Context) error {
+	for _, plugin := range ctrl.plugins {
+		if err := plugin.conn.Close(); err != nil {
+			ctrl.Logger.WithError(err).WithField("plugin", plugin.name).Warn("cannot close plugin connection")
+		}
+	}
+
+	return nil
+}
+
+func (ctrl *controller) LinkerName() string { return "grpc-linker" }
+
+// Lookup calls all plugins concurrently.
+// Failing plugins are logged and skipped so that they do not prevent links from other plugins.
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	request := &protocol.LookupRequest{Object: protocol.ObjectFromRich(object)}
+
+	raw := object.Raw
+	if raw == nil {
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			// plugins may still resolve links from the object reference alone
+			logger.WithError(err).Debug("cannot fetch object value")
+		}
+	}
+	if raw != nil {
+		request.Raw = raw.Object
+	}
+
+	results := make([][]linker.LinkerResult, len(ctrl.plugins))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(ctrl.plugins))
+	for i, p := range ctrl.plugins {
+		go func(i int, p *plugin) {
+			defer wg.Done()
+
+			pluginLogger := logger.WithField("plugin", p.name)
+			links, err := ctrl.callPlugin(ctx, p, object, request)
+			if err != nil {
+				pluginLogger.WithError(err).Error("linker plugin call failed")
+				return
+			}
+
+			results[i] = links
+		}(i, p)
+	}
+	wg.Wait()
+
+	var links []linker.LinkerResult
+	for _, pluginLinks := range results {
+		links = append(links, pluginLinks...)
+	}
+
+	return links, nil
+}
+
+func (ctrl *controller) callPlugin(
+	ctx context.Context,
+	plugin *plugin,
+	object utilobject.Rich,
+	request *protocol.LookupRequest,
+) (_ []linker.LinkerResult, err error) {
+	startTime := ctrl.Clock.Now()
+	metric := &callMetric{Plugin: plugin.name}
+	defer func() {
+		metric.Error = err
+		ctrl.CallMetric.DeferCount(startTime, metric)
+	}()
+
+	cacheKey := fmt.Sprintf("%s/%s/%s", plugin.name, object.String(), object.Uid)
+	if ctrl.cache != nil {
+		if cached, ok := ctrl.cache.Get(cacheKey); ok {
+			metric.Cached = true
+			return cached.([]linker.LinkerResult), nil
+		}
+	}
+
+	ctx, cancelFunc := context.WithTimeout(ctx, ctrl.options.timeout)
+	defer cancelFunc()
+
+	response, err := plugin.client.Lookup(ctx, request)
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("calling plugin: %w", err), "Call")
+	}
+
+	links := make([]linker.LinkerResult, 0, len(response.Links))
+	for _, link := range response.Links {
+		role := zconstants.LinkRoleValue(link.Role)
+		if role != zconstants.LinkRoleParent && role != zconstants.LinkRoleChild {
+			return nil, metrics.LabelError(fmt.Errorf("plugin returned unknown link role %q", link.Role), "InvalidRole")
+		}
+
+		linkedObject := link.Object.ToRich()
+		if linkedObject.Cluster == "" {
+			linkedObject.Cluster = object.Cluster
+		}
+
+		links = append(links, linker.LinkerResult{
+			Object:  linkedObject,
+			Role:    role,
+			Class:   link.Class,
+			DedupId: fmt.Sprintf("plugin/%s/%s", plugin.name, link.DedupId),
+		})
+	}
+
+	if ctrl.cache != nil {
+		ctrl.cache.Add(cacheKey, links)
+	}
+
+	return links, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protocol defines the gRPC protocol between Kelemetry and linker plugins.
+//
+// Messages are encoded as JSON with the "json" content subtype,
+// so plugins do not need to generate code from protobuf definitions.
+// Go plugins should implement LinkerServer and register it with RegisterLinkerServer.
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"k8s.io/apimachinery/pkg/types"
+
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+const (
+	ServiceName = "kelemetry.linker.v1.LinkerPlugin"
+
+	lookupMethod = "/" + ServiceName + "/Lookup"
+)
+
+// Object identifies a Kubernetes object.
+type Object struct {
+	Cluster   string `json:"cluster"`
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Uid       string `json:"uid,omitempty"`
+}
+
+func ObjectFromRich(object utilobject.Rich) Object {
+	return Object{
+		Cluster:   object.Cluster,
+		Group:     object.Group,
+		Version:   object.Version,
+		Resource:  object.Resource,
+		Namespace: object.Namespace,
+		Name:      object.Name,
+		Uid:       string(object.Uid),
+	}
+}
+
+func (object Object) ToRich() utilobject.Rich {
+	return utilobject.Rich{
+		VersionedKey: utilobject.VersionedKey{
+			Key: utilobject.Key{
+				Cluster:   object.Cluster,
+				Group:     object.Group,
+				Resource:  object.Resource,
+				Namespace: object.Namespace,
+				Name:      object.Name,
+			},
+			Version: object.Version,
+		},
+		Uid: types.UID(object.Uid),
+	}
+}
+
+type LookupRequest struct {
+	Object Object `json:"object"`
+	// Raw is the latest known value of the object, if available.
+	Raw map[string]any `json:"raw,omitempty"`
+}
+
+type LookupResponse struct {
+	Links []Link `json:"links"`
+}
+
+type Link struct {
+	Object Object `json:"object"`
+	// Role is the role of the linked object relative to the requested object, "parent" or "child".
+	Role string `json:"role"`
+	// Class is an optional name to group links in the frontend.
+	Class string `json:"class,omitempty"`
+	// DedupId distinguishes multiple links from the same object.
+	DedupId string `json:"dedupId"`
+}
+
+type LinkerServer interface {
+	Lookup(ctx context.Context, request *LookupRequest) (*LookupResponse, error)
+}
+
+func RegisterLinkerServer(registrar grpc.ServiceRegistrar, server LinkerServer) {
+	registrar.RegisterService(&serviceDesc, server)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*LinkerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Lookup", Handler: lookupHandler},
+	},
+}
+
+func lookupHandler(
+	server any,
+	ctx context.Context,
+	decode func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (any, error) {
+	request := &LookupRequest{}
+	if err := decode(request); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return server.(LinkerServer).Lookup(ctx, request)
+	}
+
+	info := &grpc.UnaryServerInfo{Server: server, FullMethod: lookupMethod}
+	return interceptor(ctx, request, info, func(ctx context.Context, request any) (any, error) {
+		return server.(LinkerServer).Lookup(ctx, request.(*LookupRequest))
+	})
+}
+
+type LinkerClient struct {
+	conn grpc.ClientConnInterface
+}
+
+func NewLinkerClient(conn grpc.ClientConnInterface) *LinkerClient {
+	return &LinkerClient{conn: conn}
+}
+
+func (client *LinkerClient) Lookup(ctx context.Context, request *LookupRequest, opts ...grpc.CallOption) (*LookupResponse, error) {
+	response := &LookupResponse{}
+	opts = append(opts, grpc.CallContentSubtype(codecName))
+	if err := client.conn.Invoke(ctx, lookupMethod, request, response, opts...); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+const codecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
@@ -0,0 +1,79 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protocol_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/kubewharf/kelemetry/pkg/grpclinker/protocol"
+)
+
+type testServer struct{}
+
+func (testServer) Lookup(ctx context.Context, request *protocol.LookupRequest) (*protocol.LookupResponse, error) {
+	parent := request.Raw["spec"].(map[string]any)["workloadRef"].(string)
+	return &protocol.LookupResponse{
+		Links: []protocol.Link{{
+			Object: protocol.Object{
+				Cluster:   request.Object.Cluster,
+				Group:     "example.com",
+				Version:   "v1",
+				Resource:  "workloads",
+				Namespace: request.Object.Namespace,
+				Name:      parent,
+			},
+			Role:    "parent",
+			DedupId: "workload",
+		}},
+	}, nil
+}
+
+func TestLookupRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer()
+	protocol.RegisterLinkerServer(server, testServer{})
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(err)
+	defer conn.Close()
+
+	response, err := protocol.NewLinkerClient(conn).Lookup(context.Background(), &protocol.LookupRequest{
+		Object: protocol.Object{Cluster: "c1", Version: "v1", Resource: "pods", Namespace: "default", Name: "web-0"},
+		Raw:    map[string]any{"spec": map[string]any{"workloadRef": "web"}},
+	})
+	assert.NoError(err)
+	assert.Len(response.Links, 1)
+
+	parent := response.Links[0].Object.ToRich()
+	assert.Equal("c1", parent.Cluster)
+	assert.Equal("workloads", parent.Resource)
+	assert.Equal("default", parent.Namespace)
+	assert.Equal("web", parent.Name)
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Liveness and readiness endpoints aggregating the checks of all enabled components.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	kelemetryhttp "github.com/kubewharf/kelemetry/pkg/http"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("health", manager.Ptr(&health{}))
+}
+
+type options struct {
+	enable  bool
+	timeout time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "health-enable", false, "serve /healthz, /livez and /readyz on the HTTP server")
+	fs.DurationVar(&options.timeout, "health-check-timeout", time.Second*5, "timeout of the health check of each component")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+func (options *options) Validate() error {
+	if options.timeout <= 0 {
+		return fmt.Errorf("--health-check-timeout must be positive")
+	}
+	return nil
+}
+
+type health struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Manager *manager.Manager
+	Server  kelemetryhttp.Server
+
+	CheckMetric *metrics.Metric[*checkMetric]
+}
+
+type checkMetric struct {
+	Component string
+	Probe     probe
+	Error     metrics.LabeledError
+}
+
+func (*checkMetric) MetricName() string { return "health_check" }
+
+type probe string
+
+const (
+	probeLiveness  probe = "liveness"
+	probeReadiness probe = "readiness"
+)
+
+func (health *health) Options() manager.Options { return &health.options }
+
+func (health *health) Init() error {
+	routes := health.Server.Routes()
+	routes.GET("/healthz", health.handler(probeLiveness))
+	routes.GET("/livez", health.handler(probeLiveness))
+	routes.GET("/readyz", health.handler(probeReadiness))
+
+	return nil
+}
+
+func (health *health) Start(ctx context.Context) error { return nil }
+func (health *health) Close(ctx context.Context) error { return nil }
+
+type response struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+type checkResult struct {
+	Component string `json:"component"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+const (
+	statusOk     = "ok"
+	statusFailed = "failed"
+)
+
+func (health *health) handler(probe probe) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := health.Logger.WithField("probe", string(probe))
+		defer shutdown.RecoverPanic(logger)
+
+		resp := health.check(ctx, probe)
+
+		code := http.StatusOK
+		if resp.Status != statusOk {
+			code = http.StatusServiceUnavailable
+			logger.WithField("checks", resp.Checks).Debug("Health check failed")
+		}
+		ctx.JSON(code, resp)
+	}
+}
+
+// check runs the checks of all enabled components in parallel.
+func (health *health) check(ctx context.Context, probe probe) response {
+	resp := response{Status: statusOk, Checks: []checkResult{}}
+
+	if probe == probeReadiness && !health.Manager.Started() {
+		resp.Status = statusFailed
+		resp.Checks = append(resp.Checks, checkResult{Component: "manager", Status: statusFailed, Error: "not all components have started"})
+	}
+
+	type job struct {
+		name  string
+		check func(context.Context) error
+	}
+	jobs := []job{}
+	for _, summary := range health.Manager.Components() {
+		switch probe {
+		case probeLiveness:
+			if checker, ok := summary.Component.(manager.LivenessChecker); ok {
+				jobs = append(jobs, job{name: summary.Name, check: checker.CheckLiveness})
+			}
+		case probeReadiness:
+			if checker, ok := summary.Component.(manager.ReadinessChecker); ok {
+				jobs = append(jobs, job{name: summary.Name, check: checker.CheckReadiness})
+			}
+		}
+	}
+
+	results := make([]checkResult, len(jobs))
+	wg := sync.WaitGroup{}
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer shutdown.RecoverPanic(health.Logger)
+
+			results[i] = checkResult{Component: job.name, Status: statusFailed, Error: "check panicked"}
+
+			metric := &checkMetric{Component: job.name, Probe: probe}
+			defer health.CheckMetric.DeferCount(health.Clock.Now(), metric)
+
+			checkCtx, cancelFunc := context.WithTimeout(ctx, health.options.timeout)
+			defer cancelFunc()
+
+			if err := job.check(checkCtx); err != nil {
+				metric.Error = metrics.LabelError(err, "CheckFailed")
+				results[i].Error = err.Error()
+			} else {
+				results[i] = checkResult{Component: job.name, Status: statusOk}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Status != statusOk {
+			resp.Status = statusFailed
+		}
+	}
+	resp.Checks = append(resp.Checks, results...)
+
+	return resp
+}
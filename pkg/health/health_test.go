@@ -0,0 +1,90 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type testCache struct {
+	manager.BaseComponent
+	err error
+}
+
+func (*testCache) Options() manager.Options { return &manager.AlwaysEnableOptions{} }
+
+func (cache *testCache) CheckReadiness(ctx context.Context) error { return cache.err }
+
+type testConsumer struct {
+	manager.BaseComponent
+}
+
+func (*testConsumer) Options() manager.Options { return &manager.AlwaysEnableOptions{} }
+
+func (*testConsumer) CheckLiveness(ctx context.Context) error { return nil }
+
+func (*testConsumer) CheckReadiness(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	m := manager.New()
+	m.Provide("cache", manager.Ptr(&testCache{err: fmt.Errorf("etcd is unreachable")}))
+	m.Provide("consumer", manager.Ptr(&testConsumer{}))
+	assert.NoError(m.Build())
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	m.SetupFlags(fs)
+	assert.NoError(fs.Parse(nil))
+	m.TrimDisabled(logrus.New())
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, _ := metrics.NewMock(clock)
+	health := &health{
+		options:     options{enable: true, timeout: time.Millisecond},
+		Logger:      logrus.New(),
+		Clock:       clock,
+		Manager:     m,
+		CheckMetric: metrics.New[*checkMetric](metricsClient),
+	}
+
+	assert.Equal(response{
+		Status: statusOk,
+		Checks: []checkResult{{Component: "consumer", Status: statusOk}},
+	}, health.check(context.Background(), probeLiveness))
+
+	assert.Equal(response{
+		Status: statusFailed,
+		Checks: []checkResult{
+			{Component: "manager", Status: statusFailed, Error: "not all components have started"},
+			{Component: "cache", Status: statusFailed, Error: "etcd is unreachable"},
+			{Component: "consumer", Status: statusFailed, Error: context.DeadlineExceeded.Error()},
+		},
+	}, health.check(context.Background(), probeReadiness))
+}
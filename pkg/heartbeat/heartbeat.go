@@ -0,0 +1,262 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Emits periodic heartbeat spans for objects without activity,
+// so that searching a quiet object still returns a trace indicating that nothing has changed.
+package heartbeat
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/filter"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/k8s/multileader"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("heartbeat", manager.Ptr(&controller{}))
+}
+
+type options struct {
+	enable         bool
+	resources      []string
+	interval       time.Duration
+	rate           float64
+	pageSize       int64
+	electorOptions multileader.Config
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"heartbeat-enable",
+		false,
+		"periodically emit heartbeat spans for objects of the resources in --heartbeat-resources that have no activity",
+	)
+	fs.StringSliceVar(
+		&options.resources,
+		"heartbeat-resources",
+		[]string{},
+		"resources to emit heartbeats for, in the form 'resource[.group]', e.g. 'configmaps,ingresses.networking.k8s.io'",
+	)
+	fs.DurationVar(
+		&options.interval,
+		"heartbeat-interval",
+		time.Minute*30,
+		"interval between heartbeats of each object; should be the same as --aggregator-span-ttl so that each window has at most one heartbeat",
+	)
+	fs.Float64Var(&options.rate, "heartbeat-rate", 20, "maximum number of objects checked per second")
+	fs.Int64Var(&options.pageSize, "heartbeat-page-size", 500, "number of objects listed per request")
+	options.electorOptions.SetupOptions(fs, "heartbeat", "heartbeat controller", 1)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options        options
+	Logger         logrus.FieldLogger
+	Clock          clock.Clock
+	Aggregator     aggregator.Aggregator
+	Clients        k8s.Clients
+	DiscoveryCache discovery.DiscoveryCache
+	Filter         filter.Filter
+	Metrics        metrics.Client
+
+	HeartbeatMetric *metrics.Metric[*heartbeatMetric]
+
+	resources []schema.GroupResource
+	elector   *multileader.Elector
+	limiter   flowcontrol.RateLimiter
+}
+
+var _ manager.Component = &controller{}
+
+type heartbeatMetric struct {
+	Cluster  string
+	Resource string
+	Result   string
+	Error    metrics.LabeledError
+}
+
+func (*heartbeatMetric) MetricName() string { return "heartbeat" }
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+
+func (ctrl *controller) Init() (err error) {
+	if ctrl.options.interval <= 0 {
+		return fmt.Errorf("--heartbeat-interval must be positive")
+	}
+	if ctrl.options.rate <= 0 {
+		return fmt.Errorf("--heartbeat-rate must be positive")
+	}
+
+	for _, resource := range ctrl.options.resources {
+		ctrl.resources = append(ctrl.resources, schema.ParseGroupResource(resource))
+	}
+
+	ctrl.limiter = flowcontrol.NewTokenBucketRateLimiter(float32(ctrl.options.rate), 1)
+
+	ctrl.elector, err = multileader.NewElector(
+		"kelemetry-heartbeat",
+		ctrl.Logger.WithField("submod", "leader-elector"),
+		ctrl.Clock,
+		&ctrl.options.electorOptions,
+		ctrl.Clients.TargetCluster(),
+		ctrl.Metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create leader elector: %w", err)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Start(ctx context.Context) error {
+	go ctrl.elector.Run(ctx, ctrl.runLeader)
+	go ctrl.elector.RunLeaderMetricLoop(ctx)
+
+	return nil
+}
+
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) runLeader(ctx context.Context) {
+	defer shutdown.RecoverPanic(ctrl.Logger)
+
+	wait.UntilWithContext(ctx, ctrl.beat, ctrl.options.interval)
+}
+
+func (ctrl *controller) beat(ctx context.Context) {
+	clusterName := ctrl.Clients.TargetCluster().ClusterName()
+
+	cdc, err := ctrl.DiscoveryCache.ForCluster(clusterName)
+	if err != nil {
+		ctrl.Logger.WithError(err).Error("cannot init discovery cache for target cluster")
+		return
+	}
+
+	gvrs := resolveResources(cdc.GetAll(), ctrl.resources)
+
+	for _, gr := range ctrl.resources {
+		gvr, found := gvrs[gr]
+		if !found {
+			ctrl.Logger.WithField("resource", gr).Warn("heartbeat resource not found in discovery")
+			continue
+		}
+
+		if !ctrl.Filter.TestGvr(gvr) {
+			continue
+		}
+
+		if err := ctrl.beatResource(ctx, clusterName, gvr); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			ctrl.Logger.WithField("resource", gvr).WithError(err).Error("cannot list objects for heartbeat")
+		}
+	}
+}
+
+func (ctrl *controller) beatResource(ctx context.Context, clusterName string, gvr schema.GroupVersionResource) error {
+	client := ctrl.Clients.TargetCluster().DynamicClient().Resource(gvr)
+
+	continueToken := ""
+	for {
+		list, err := client.List(ctx, metav1.ListOptions{Limit: ctrl.options.pageSize, Continue: continueToken})
+		if err != nil {
+			return err
+		}
+
+		for _, item := range list.Items {
+			if err := ctrl.limiter.Wait(ctx); err != nil {
+				return err
+			}
+
+			object := utilobject.NewRich(clusterName, gvr, item.GetNamespace(), item.GetName(), item.GetUID())
+			ctrl.beatObject(ctx, object, item.GetResourceVersion())
+		}
+
+		continueToken = list.GetContinue()
+		if continueToken == "" {
+			return nil
+		}
+	}
+}
+
+func (ctrl *controller) beatObject(ctx context.Context, object utilobject.Rich, resourceVersion string) {
+	metric := &heartbeatMetric{Cluster: object.Cluster, Resource: object.Resource}
+	defer ctrl.HeartbeatMetric.DeferCount(ctrl.Clock.Now(), metric)
+
+	now := ctrl.Clock.Now()
+
+	_, isNew, err := ctrl.Aggregator.TouchObjectSpan(ctx, object, now)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "TouchObjectSpan")
+		ctrl.Logger.WithFields(object.AsFields("object")).WithError(err).Error("cannot create object span for heartbeat")
+		return
+	}
+
+	if !isNew {
+		// other events already exist in this window
+		metric.Result = "Active"
+		return
+	}
+
+	metric.Result = "Sent"
+
+	event := aggregatorevent.NewEvent("No changes", now, zconstants.TraceSourceHeartbeat).
+		SetTag("resourceVersion", resourceVersion).
+		SetTag("tag", "heartbeat").
+		Log(zconstants.LogTypeRealVerbose, fmt.Sprintf("object exists at resource version %s without activity in this window", resourceVersion))
+	if err := ctrl.Aggregator.Send(ctx, object, event); err != nil {
+		metric.Error = metrics.LabelError(err, "Send")
+		ctrl.Logger.WithFields(object.AsFields("object")).WithError(err).Error("cannot send heartbeat")
+	}
+}
+
+// resolveResources returns the preferred version of each group-resource among the discovered resources.
+func resolveResources(details discovery.GvrDetails, resources []schema.GroupResource) map[schema.GroupResource]schema.GroupVersionResource {
+	wanted := make(map[schema.GroupResource]struct{}, len(resources))
+	for _, gr := range resources {
+		wanted[gr] = struct{}{}
+	}
+
+	output := map[schema.GroupResource]schema.GroupVersionResource{}
+	for gvr := range details {
+		if _, isWanted := wanted[gvr.GroupResource()]; isWanted {
+			output[gvr.GroupResource()] = gvr
+		}
+	}
+
+	return output
+}
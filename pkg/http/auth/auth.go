@@ -0,0 +1,403 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Authenticates requests to the frontend and admin APIs with static tokens or OIDC ID tokens,
+// and records an access log of the authenticated user of each request.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jaegertracing/jaeger/plugin/storage/grpc/shared"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.Provide("http-auth", manager.Ptr(&Authenticator{}))
+}
+
+type options struct {
+	enable        bool
+	tokenFile     string
+	oidcIssuer    string
+	oidcClientId  string
+	usernameClaim string
+	groupsClaim   string
+	tenantClaim   string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"http-auth-enable",
+		false,
+		"require authentication for the frontend and admin APIs and log the user of each request",
+	)
+	fs.StringVar(
+		&options.tokenFile,
+		"http-auth-token-file",
+		"",
+		"CSV file of static bearer tokens, one 'token,user[,tenant]' per line",
+	)
+	fs.StringVar(&options.oidcIssuer, "http-auth-oidc-issuer-url", "", "URL of the OIDC provider to accept ID tokens from")
+	fs.StringVar(&options.oidcClientId, "http-auth-oidc-client-id", "", "audience that OIDC ID tokens must be issued for")
+	fs.StringVar(&options.usernameClaim, "http-auth-oidc-username-claim", "sub", "OIDC claim used as the username")
+	fs.StringVar(&options.groupsClaim, "http-auth-oidc-groups-claim", "groups", "OIDC claim containing the list of groups of the user")
+	fs.StringVar(
+		&options.tenantClaim,
+		"http-auth-oidc-tenant-claim",
+		"",
+		"OIDC claim used as the tenant for --frontend-tenant-enable, taking precedence over the tenant header",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if !options.enable {
+		return nil
+	}
+	if options.tokenFile == "" && options.oidcIssuer == "" {
+		return fmt.Errorf("--http-auth-token-file or --http-auth-oidc-issuer-url is required with --http-auth-enable")
+	}
+	if options.oidcIssuer != "" && options.oidcClientId == "" {
+		return fmt.Errorf("--http-auth-oidc-client-id is required with --http-auth-oidc-issuer-url")
+	}
+	return nil
+}
+
+// User is an authenticated user.
+type User struct {
+	Name   string
+	Groups []string
+	// Tenant is the tenant of the user for frontend tenant isolation, if known.
+	Tenant string
+}
+
+type staticToken struct {
+	token string
+	user  User
+}
+
+// Authenticator authenticates requests.
+// If authentication is disabled, all requests are allowed without a user.
+type Authenticator struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+
+	AuthMetric *metrics.Metric[*authMetric]
+
+	tokens []staticToken
+	oidc   *oidcVerifier
+}
+
+type authMetric struct {
+	Method string
+	Error  metrics.LabeledError
+}
+
+func (*authMetric) MetricName() string { return "http_auth" }
+
+var _ manager.Component = &Authenticator{}
+
+func (auth *Authenticator) Options() manager.Options { return &auth.options }
+
+func (auth *Authenticator) Init() error {
+	if !auth.options.enable {
+		return nil
+	}
+
+	if auth.options.tokenFile != "" {
+		tokens, err := readTokenFile(auth.options.tokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read --http-auth-token-file: %w", err)
+		}
+		auth.tokens = tokens
+	}
+
+	if auth.options.oidcIssuer != "" {
+		auth.oidc = newOidcVerifier(auth.options.oidcIssuer, auth.options.oidcClientId, auth.Clock)
+	}
+
+	return nil
+}
+
+func (auth *Authenticator) Start(ctx context.Context) error { return nil }
+func (auth *Authenticator) Close(ctx context.Context) error { return nil }
+
+func readTokenFile(path string) ([]staticToken, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var tokens []staticToken
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d is not in the form 'token,user[,tenant]'", line)
+		}
+
+		token := staticToken{token: record[0], user: User{Name: record[1]}}
+		if len(record) >= 3 {
+			token.user.Tenant = record[2]
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+// Enabled returns whether authentication is required.
+func (auth *Authenticator) Enabled() bool { return auth.options.enable }
+
+// Authenticate identifies the user of a bearer token.
+func (auth *Authenticator) Authenticate(ctx context.Context, token string) (_ *User, err error) {
+	metric := &authMetric{}
+	defer func() {
+		if err != nil && metric.Error == nil {
+			metric.Error = metrics.LabelError(err, "Invalid")
+		}
+		auth.AuthMetric.With(metric).Count(1)
+	}()
+
+	if token == "" {
+		metric.Error = metrics.MakeLabeledError("NoToken")
+		return nil, fmt.Errorf("no bearer token")
+	}
+
+	for _, static := range auth.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(static.token)) == 1 {
+			metric.Method = "static"
+			user := static.user
+			return &user, nil
+		}
+	}
+
+	if auth.oidc != nil {
+		metric.Method = "oidc"
+
+		claims, err := auth.oidc.verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		user := &User{}
+		user.Name, _ = claims[auth.options.usernameClaim].(string)
+		if user.Name == "" {
+			return nil, fmt.Errorf("token has no %q claim", auth.options.usernameClaim)
+		}
+		if groups, ok := claims[auth.options.groupsClaim].([]any); ok {
+			for _, group := range groups {
+				if group, ok := group.(string); ok {
+					user.Groups = append(user.Groups, group)
+				}
+			}
+		}
+		if auth.options.tenantClaim != "" {
+			user.Tenant, _ = claims[auth.options.tenantClaim].(string)
+		}
+		return user, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+type userKey struct{}
+
+// WithUser returns a context for a request from the user.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the authenticated user of the request, or nil if authentication is disabled.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
+}
+
+func bearerToken(header string) string {
+	token, _ := strings.CutPrefix(header, "Bearer ")
+	return token
+}
+
+// Wrap authenticates requests before passing them to the handler,
+// and logs the user and result of each request.
+func (auth *Authenticator) Wrap(handler gin.HandlerFunc) gin.HandlerFunc {
+	if !auth.options.enable {
+		return handler
+	}
+
+	return func(ctx *gin.Context) {
+		logger := auth.Logger.WithField("source", ctx.Request.RemoteAddr).
+			WithField("method", ctx.Request.Method).
+			WithField("path", ctx.Request.URL.Path).
+			WithField("query", ctx.Request.URL.RawQuery)
+
+		user, err := auth.Authenticate(ctx.Request.Context(), bearerToken(ctx.GetHeader("Authorization")))
+		if err != nil {
+			logger.WithError(err).Warn("Unauthenticated request")
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		ctx.Request = ctx.Request.WithContext(WithUser(ctx.Request.Context(), user))
+		handler(ctx)
+
+		logger.WithField("user", user.Name).WithField("status", ctx.Writer.Status()).Info("Access")
+	}
+}
+
+// exemptGrpcServices are served without authentication,
+// since they only expose server metadata and are called by probes that do not carry user tokens.
+var exemptGrpcServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// IsExemptGrpcMethod returns whether the gRPC method is a health check or reflection call,
+// which is not subject to authentication or tenant interceptors.
+func IsExemptGrpcMethod(fullMethod string) bool {
+	for _, prefix := range exemptGrpcServices {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServerOptions returns the gRPC server options that authenticate requests from Jaeger query,
+// which forwards the bearer token of the UI request with `--query.bearer-token-propagation`.
+func (auth *Authenticator) ServerOptions() []grpc.ServerOption {
+	if !auth.options.enable {
+		return nil
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(
+			ctx context.Context,
+			req any,
+			info *grpc.UnaryServerInfo,
+			handler grpc.UnaryHandler,
+		) (any, error) {
+			if IsExemptGrpcMethod(info.FullMethod) {
+				return handler(ctx, req)
+			}
+
+			ctx, err := auth.authenticateGrpc(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := handler(ctx, req)
+			auth.logGrpc(ctx, info.FullMethod, req, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if IsExemptGrpcMethod(info.FullMethod) {
+				return handler(srv, stream)
+			}
+
+			ctx, err := auth.authenticateGrpc(stream.Context())
+			if err != nil {
+				return err
+			}
+
+			wrapped := &userStream{ServerStream: stream, ctx: ctx}
+			err = handler(srv, wrapped)
+			auth.logGrpc(ctx, info.FullMethod, wrapped.request, err)
+			return err
+		}),
+	}
+}
+
+func (auth *Authenticator) authenticateGrpc(ctx context.Context) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(shared.BearerTokenKey); len(values) > 0 {
+			token = values[0]
+		} else if values := md.Get("authorization"); len(values) > 0 {
+			token = bearerToken(values[0])
+		}
+	}
+
+	user, err := auth.Authenticate(ctx, token)
+	if err != nil {
+		auth.Logger.WithError(err).Warn("Unauthenticated request")
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return WithUser(ctx, user), nil
+}
+
+func (auth *Authenticator) logGrpc(ctx context.Context, method string, request any, err error) {
+	logger := auth.Logger.WithField("user", UserFromContext(ctx).Name).WithField("method", method)
+	if request != nil {
+		logger = logger.WithField("request", fmt.Sprint(request))
+	}
+	if err != nil {
+		logger = logger.WithError(err)
+	}
+	logger.Info("Access")
+}
+
+type userStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	request any
+}
+
+func (stream *userStream) Context() context.Context { return stream.ctx }
+
+func (stream *userStream) RecvMsg(msg any) error {
+	err := stream.ServerStream.RecvMsg(msg)
+	if err == nil && stream.request == nil {
+		stream.request = msg
+	}
+	return err
+}
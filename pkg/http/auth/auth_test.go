@@ -0,0 +1,193 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func newTestAuthenticator(t *testing.T, options options) *Authenticator {
+	clock := clocktesting.NewFakeClock(time.Unix(1000000, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	options.enable = true
+	if options.usernameClaim == "" {
+		options.usernameClaim = "sub"
+	}
+	if options.groupsClaim == "" {
+		options.groupsClaim = "groups"
+	}
+
+	auth := &Authenticator{
+		options:    options,
+		Logger:     logger,
+		Clock:      clock,
+		AuthMetric: metrics.New[*authMetric](metricsClient),
+	}
+	assert.NoError(t, auth.Init())
+	return auth
+}
+
+func TestStaticToken(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	assert.NoError(os.WriteFile(path, []byte("# token,user,tenant\nabc,alice,team-a\ndef,bob\n"), 0o600))
+
+	auth := newTestAuthenticator(t, options{tokenFile: path})
+
+	user, err := auth.Authenticate(context.Background(), "abc")
+	assert.NoError(err)
+	assert.Equal(&User{Name: "alice", Tenant: "team-a"}, user)
+
+	user, err = auth.Authenticate(context.Background(), "def")
+	assert.NoError(err)
+	assert.Equal(&User{Name: "bob"}, user)
+
+	_, err = auth.Authenticate(context.Background(), "ghi")
+	assert.Error(err)
+
+	_, err = auth.Authenticate(context.Background(), "")
+	assert.Error(err)
+}
+
+func TestOidc(t *testing.T) {
+	assert := assert.New(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(err)
+
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer = server.URL
+
+	auth := newTestAuthenticator(t, options{oidcIssuer: issuer, oidcClientId: "kelemetry", tenantClaim: "team"})
+	now := auth.Clock.Now().Unix()
+
+	sign := func(kid string, claims map[string]any) string {
+		header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+		assert.NoError(err)
+		payload, err := json.Marshal(claims)
+		assert.NoError(err)
+
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		assert.NoError(err)
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	user, err := auth.Authenticate(context.Background(), sign("key-1", map[string]any{
+		"iss":    issuer,
+		"aud":    []string{"other", "kelemetry"},
+		"sub":    "alice",
+		"groups": []string{"sre"},
+		"team":   "team-a",
+		"exp":    now + 60,
+	}))
+	assert.NoError(err)
+	assert.Equal(&User{Name: "alice", Groups: []string{"sre"}, Tenant: "team-a"}, user)
+
+	for name, claims := range map[string]map[string]any{
+		"expired":        {"iss": issuer, "aud": "kelemetry", "sub": "alice", "exp": now - 3600},
+		"wrong audience": {"iss": issuer, "aud": "other", "sub": "alice", "exp": now + 60},
+		"wrong issuer":   {"iss": "https://example.com", "aud": "kelemetry", "sub": "alice", "exp": now + 60},
+		"no username":    {"iss": issuer, "aud": "kelemetry", "exp": now + 60},
+	} {
+		_, err := auth.Authenticate(context.Background(), sign("key-1", claims))
+		assert.Error(err, name)
+	}
+
+	_, err = auth.Authenticate(context.Background(), sign("key-2", map[string]any{
+		"iss": issuer, "aud": "kelemetry", "sub": "alice", "exp": now + 60,
+	}))
+	assert.Error(err, "unknown key")
+
+	token := sign("key-1", map[string]any{"iss": issuer, "aud": "kelemetry", "sub": "alice", "exp": now + 60})
+	_, err = auth.Authenticate(context.Background(), token[:len(token)-4]+"AAAA")
+	assert.Error(err, "tampered signature")
+}
+
+func TestGrpcHealthExempt(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	assert.NoError(os.WriteFile(path, []byte("abc,alice\n"), 0o600))
+	auth := newTestAuthenticator(t, options{tokenFile: path})
+
+	listener := bufconn.Listen(1 << 16)
+	server := grpc.NewServer(auth.ServerOptions()...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(err)
+	defer conn.Close()
+
+	// health checks do not carry a bearer token
+	response, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.NoError(err)
+	assert.Equal(healthpb.HealthCheckResponse_SERVING, response.Status)
+
+	assert.True(IsExemptGrpcMethod("/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"))
+	assert.False(IsExemptGrpcMethod("/jaeger.storage.v1.SpanReaderPlugin/GetTrace"))
+}
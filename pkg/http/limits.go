@@ -0,0 +1,150 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+// cidrRule applies to requests with the path prefix, or to all requests if the prefix is empty.
+type cidrRule struct {
+	pathPrefix string
+	prefix     netip.Prefix
+}
+
+// parseCidrRules parses rules in the form "[pathPrefix=]cidr".
+// Single IP addresses are accepted as /32 or /128 prefixes.
+func parseCidrRules(specs []string) ([]cidrRule, error) {
+	rules := make([]cidrRule, 0, len(specs))
+	for _, spec := range specs {
+		pathPrefix, cidr, hasPath := strings.Cut(spec, "=")
+		if !hasPath {
+			pathPrefix, cidr = "", spec
+		} else if !strings.HasPrefix(pathPrefix, "/") {
+			return nil, fmt.Errorf("path prefix in %q must start with '/'", spec)
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid CIDR in %q: %w", spec, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		rules = append(rules, cidrRule{pathPrefix: pathPrefix, prefix: prefix.Masked()})
+	}
+	return rules, nil
+}
+
+// limits enforces the client IP rules and body size limits of the HTTP server.
+type limits struct {
+	logger        logrus.FieldLogger
+	rejectMetric  *metrics.Metric[*rejectMetric]
+	allowed       []cidrRule
+	denied        []cidrRule
+	maxBodySize   int64
+	pathBodySizes map[string]int64
+}
+
+type rejectMetric struct {
+	Reason string
+}
+
+func (*rejectMetric) MetricName() string { return "http_rejected_request" }
+
+// allows checks the client IP against the rules applicable to the path.
+// If any allow rule applies, the client must match one of them.
+func (limits *limits) allows(path string, addr netip.Addr) bool {
+	for _, rule := range limits.denied {
+		if strings.HasPrefix(path, rule.pathPrefix) && rule.prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	hasAllowRule := false
+	for _, rule := range limits.allowed {
+		if strings.HasPrefix(path, rule.pathPrefix) {
+			if rule.prefix.Contains(addr) {
+				return true
+			}
+			hasAllowRule = true
+		}
+	}
+
+	return !hasAllowRule
+}
+
+// bodySizeFor returns the body size limit of the longest matching path prefix, or 0 if unlimited.
+func (limits *limits) bodySizeFor(path string) int64 {
+	limit := limits.maxBodySize
+	longest := -1
+	for prefix, size := range limits.pathBodySizes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			limit = size
+			longest = len(prefix)
+		}
+	}
+	return limit
+}
+
+func (limits *limits) middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		path := ctx.Request.URL.Path
+
+		if len(limits.allowed) > 0 || len(limits.denied) > 0 {
+			// only the TCP peer is checked, since X-Forwarded-For can be spoofed by clients
+			host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+			if err != nil {
+				host = ctx.Request.RemoteAddr
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !limits.allows(path, addr.Unmap()) {
+				limits.reject(ctx, http.StatusForbidden, "ClientIp")
+				return
+			}
+		}
+
+		if limit := limits.bodySizeFor(path); limit > 0 {
+			if ctx.Request.ContentLength > limit {
+				limits.reject(ctx, http.StatusRequestEntityTooLarge, "BodySize")
+				return
+			}
+
+			// requests without Content-Length fail when the handler reads past the limit
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+		}
+	}
+}
+
+func (limits *limits) reject(ctx *gin.Context, status int, reason string) {
+	limits.rejectMetric.With(&rejectMetric{Reason: reason}).Count(1)
+	limits.logger.
+		WithField("source", ctx.Request.RemoteAddr).
+		WithField("path", ctx.Request.URL.Path).
+		WithField("reason", reason).
+		Debug("Rejected request")
+	ctx.AbortWithStatus(status)
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	allowed, err := parseCidrRules([]string{"/admin=10.0.0.0/8", "/admin=192.168.1.1"})
+	assert.NoError(err)
+	denied, err := parseCidrRules([]string{"10.1.0.0/16"})
+	assert.NoError(err)
+	_, err = parseCidrRules([]string{"admin=10.0.0.0/8"})
+	assert.Error(err)
+
+	metricsClient, _ := metrics.NewMock(clocktesting.NewFakeClock(time.Unix(0, 0)))
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	limits := &limits{
+		logger:        logger,
+		rejectMetric:  metrics.New[*rejectMetric](metricsClient),
+		allowed:       allowed,
+		denied:        denied,
+		maxBodySize:   16,
+		pathBodySizes: map[string]int64{"/audit": 64},
+	}
+
+	router := gin.New()
+	router.Use(limits.middleware())
+	echo := func(ctx *gin.Context) {
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		ctx.String(http.StatusOK, string(body))
+	}
+	router.POST("/admin", echo)
+	router.POST("/audit", echo)
+	router.POST("/falco", echo)
+
+	send := func(path string, remoteAddr string, body string, chunked bool) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		if chunked {
+			req.ContentLength = -1
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	// allow rules only apply to their path prefix
+	assert.Equal(http.StatusOK, send("/admin", "10.2.0.1:1234", "", false))
+	assert.Equal(http.StatusOK, send("/admin", "192.168.1.1:1234", "", false))
+	assert.Equal(http.StatusForbidden, send("/admin", "192.168.1.2:1234", "", false))
+	assert.Equal(http.StatusOK, send("/falco", "192.168.1.2:1234", "", false))
+
+	// deny rules take precedence
+	assert.Equal(http.StatusForbidden, send("/admin", "10.1.0.1:1234", "", false))
+	assert.Equal(http.StatusForbidden, send("/falco", "10.1.0.1:1234", "", false))
+
+	// body size limits use the longest matching prefix
+	large := strings.Repeat("x", 32)
+	assert.Equal(http.StatusRequestEntityTooLarge, send("/falco", "10.2.0.1:1234", large, false))
+	assert.Equal(http.StatusBadRequest, send("/falco", "10.2.0.1:1234", large, true))
+	assert.Equal(http.StatusOK, send("/audit", "10.2.0.1:1234", large, false))
+}
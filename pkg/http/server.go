@@ -27,6 +27,8 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
 	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
@@ -48,6 +50,12 @@ type options struct {
 
 	readTimeout       time.Duration
 	readHeaderTimeout time.Duration
+	maxHeaderBytes    int
+
+	allowedCidrs     []string
+	deniedCidrs      []string
+	maxBodySize      int64
+	pathMaxBodySizes map[string]int64
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -59,16 +67,49 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.DurationVar(
 		&options.readHeaderTimeout,
 		"http-read-header-timeout",
-		0,
+		time.Second*10,
 		"HTTP server timeout for reading request headers",
 	)
+	fs.IntVar(&options.maxHeaderBytes, "http-max-header-bytes", http.DefaultMaxHeaderBytes, "maximum size of HTTP request headers")
+	fs.StringSliceVar(
+		&options.allowedCidrs,
+		"http-allowed-cidrs",
+		[]string{},
+		"client IPs allowed to access the HTTP server, in the form '[pathPrefix=]cidr', e.g. '/admin=10.0.0.0/8'. "+
+			"Rules without a path prefix apply to all paths. "+
+			"If any rule applies to a path, requests from other IPs are rejected. Empty to allow all IPs",
+	)
+	fs.StringSliceVar(
+		&options.deniedCidrs,
+		"http-denied-cidrs",
+		[]string{},
+		"client IPs denied from accessing the HTTP server in the same form as --http-allowed-cidrs, taking precedence over it",
+	)
+	fs.Int64Var(&options.maxBodySize, "http-max-body-size", 0, "maximum size in bytes of HTTP request bodies, 0 for unlimited")
+	fs.StringToInt64Var(
+		&options.pathMaxBodySizes,
+		"http-path-max-body-size",
+		map[string]int64{},
+		"overrides --http-max-body-size for paths with the prefix, e.g. '/audit=67108864,/admin=1048576'. "+
+			"The longest matching prefix is used",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
 
+func (options *options) Validate() error {
+	if (options.cert == "") != (options.key == "") {
+		return fmt.Errorf("--http-tls-cert and --http-tls-key must be specified together")
+	}
+	return nil
+}
+
 type server struct {
 	options options
 	Logger  logrus.FieldLogger
+	Mtls    *mtls.Provider
+
+	RejectMetric *metrics.Metric[*rejectMetric]
 
 	router *gin.Engine
 	server *http.Server
@@ -79,7 +120,30 @@ func (server *server) Options() manager.Options {
 }
 
 func (server *server) Init() error {
+	if server.Mtls.Enabled() && server.options.cert != "" {
+		return fmt.Errorf("--http-tls-cert cannot be used with --mtls-enable")
+	}
+
+	allowed, err := parseCidrRules(server.options.allowedCidrs)
+	if err != nil {
+		return fmt.Errorf("invalid --http-allowed-cidrs: %w", err)
+	}
+	denied, err := parseCidrRules(server.options.deniedCidrs)
+	if err != nil {
+		return fmt.Errorf("invalid --http-denied-cidrs: %w", err)
+	}
+	limits := &limits{
+		logger:        server.Logger,
+		rejectMetric:  server.RejectMetric,
+		allowed:       allowed,
+		denied:        denied,
+		maxBodySize:   server.options.maxBodySize,
+		pathBodySizes: server.options.pathMaxBodySizes,
+	}
+
 	server.router = gin.New()
+	// registered before other components add routes so that they apply to all of them
+	server.router.Use(limits.middleware(), server.Mtls.Middleware())
 
 	return nil
 }
@@ -89,6 +153,7 @@ func (server *server) Start(ctx context.Context) error {
 		Addr:              net.JoinHostPort(server.options.address, fmt.Sprint(server.options.port)),
 		ReadHeaderTimeout: server.options.readHeaderTimeout,
 		ReadTimeout:       server.options.readTimeout,
+		MaxHeaderBytes:    server.options.maxHeaderBytes,
 		Handler:           server.router,
 	}
 	server.server = hs
@@ -99,7 +164,10 @@ func (server *server) Start(ctx context.Context) error {
 	}
 
 	var serveFunc func() error
-	if server.options.cert != "" && server.options.key != "" {
+	if server.Mtls.Enabled() {
+		hs.TLSConfig = server.Mtls.HttpServerConfig()
+		serveFunc = func() error { return hs.ServeTLS(listener, "", "") }
+	} else if server.options.cert != "" && server.options.key != "" {
 		serveFunc = func() error { return hs.ServeTLS(listener, server.options.cert, server.options.key) }
 	} else {
 		serveFunc = func() error { return hs.Serve(listener) }
@@ -16,47 +16,88 @@
 package kelemetry_pkg
 
 import (
+	_ "github.com/kubewharf/kelemetry/pkg/admin"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator/celtagger"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator/eventtagger"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator/spm"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/linker/job/local"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/linker/job/worker"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator/celtagger"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator/promtagger"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/objectspandecorator/resourcetagger"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/spancache/etcd"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/spancache/local"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/spancache/redis"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/tracer/badger"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/tracer/clickhouse"
+	_ "github.com/kubewharf/kelemetry/pkg/aggregator/tracer/elasticsearch"
 	_ "github.com/kubewharf/kelemetry/pkg/aggregator/tracer/otel"
 	_ "github.com/kubewharf/kelemetry/pkg/annotationlinker"
+	_ "github.com/kubewharf/kelemetry/pkg/anomaly"
+	_ "github.com/kubewharf/kelemetry/pkg/anomaly/detector"
 	_ "github.com/kubewharf/kelemetry/pkg/audit"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/actor"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/admission"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/consumer"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/discoveryinvalidator"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/dump"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/eks"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/forward"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/gke"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/mq/local"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/producer"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/quota"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/webhook"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername"
 	_ "github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername/address"
+	_ "github.com/kubewharf/kelemetry/pkg/audit/webhook/clustername/target"
+	_ "github.com/kubewharf/kelemetry/pkg/autoscalerlinker"
+	_ "github.com/kubewharf/kelemetry/pkg/containerfailure"
 	_ "github.com/kubewharf/kelemetry/pkg/diff/api"
 	_ "github.com/kubewharf/kelemetry/pkg/diff/cache/etcd"
 	_ "github.com/kubewharf/kelemetry/pkg/diff/cache/local"
+	_ "github.com/kubewharf/kelemetry/pkg/diff/cache/plugin"
 	_ "github.com/kubewharf/kelemetry/pkg/diff/controller"
 	_ "github.com/kubewharf/kelemetry/pkg/diff/decorator"
+	_ "github.com/kubewharf/kelemetry/pkg/errorreport"
 	_ "github.com/kubewharf/kelemetry/pkg/event"
+	_ "github.com/kubewharf/kelemetry/pkg/falco"
+	_ "github.com/kubewharf/kelemetry/pkg/federationlinker"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend"
+	_ "github.com/kubewharf/kelemetry/pkg/frontend/backend/badger"
+	_ "github.com/kubewharf/kelemetry/pkg/frontend/backend/clickhouse"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/backend/jaeger-storage"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/clusterlist/options"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/extension/httptrace"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/extension/jaeger-storage"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/http/redirect"
+	_ "github.com/kubewharf/kelemetry/pkg/frontend/http/tempo"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/http/trace"
+	_ "github.com/kubewharf/kelemetry/pkg/frontend/rbac"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/tf/config/file"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/modifier"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/tf/defaults/step"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/tracecache/etcd"
 	_ "github.com/kubewharf/kelemetry/pkg/frontend/tracecache/local"
+	_ "github.com/kubewharf/kelemetry/pkg/grpclinker"
+	_ "github.com/kubewharf/kelemetry/pkg/health"
+	_ "github.com/kubewharf/kelemetry/pkg/heartbeat"
+	_ "github.com/kubewharf/kelemetry/pkg/ingresslinker"
 	_ "github.com/kubewharf/kelemetry/pkg/k8s/config/mapoption"
 	_ "github.com/kubewharf/kelemetry/pkg/kelemetrix/consumer"
 	_ "github.com/kubewharf/kelemetry/pkg/kelemetrix/defaults/quantities"
 	_ "github.com/kubewharf/kelemetry/pkg/kelemetrix/defaults/tags"
 	_ "github.com/kubewharf/kelemetry/pkg/metrics/noop"
 	_ "github.com/kubewharf/kelemetry/pkg/metrics/prometheus"
+	_ "github.com/kubewharf/kelemetry/pkg/nodelifecycle"
 	_ "github.com/kubewharf/kelemetry/pkg/ownerlinker"
+	_ "github.com/kubewharf/kelemetry/pkg/releaselinker"
+	_ "github.com/kubewharf/kelemetry/pkg/rollout"
+	_ "github.com/kubewharf/kelemetry/pkg/rulelinker"
+	_ "github.com/kubewharf/kelemetry/pkg/scheduling"
+	_ "github.com/kubewharf/kelemetry/pkg/secret/kube"
+	_ "github.com/kubewharf/kelemetry/pkg/secret/vault"
+	_ "github.com/kubewharf/kelemetry/pkg/servicelinker"
+	_ "github.com/kubewharf/kelemetry/pkg/storagelinker"
 )
@@ -0,0 +1,278 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links L7 routing objects to their backend services.
+//
+// Ingresses and Gateway API routes (HTTPRoute, GRPCRoute) are linked to their backend Services,
+// routes are linked under their parent Gateways, and Gateways are linked under their GatewayClasses.
+package ingresslinker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("ingress-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "ingress-linker-enable", false, "enable linker for ingresses and Gateway API routes")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options        options
+	Logger         logrus.FieldLogger
+	DiscoveryCache discovery.DiscoveryCache
+	ObjectCache    *objectcache.ObjectCache
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options        { return &ctrl.options }
+func (ctrl *controller) Init() error                     { return nil }
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+const gatewayGroup = "gateway.networking.k8s.io"
+
+var (
+	serviceGvr      = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	ingressGr       = networkingv1.SchemeGroupVersion.WithResource("ingresses").GroupResource()
+	ingressClassGvr = networkingv1.SchemeGroupVersion.WithResource("ingressclasses")
+	gatewayGr       = schema.GroupResource{Group: gatewayGroup, Resource: "gateways"}
+	routeGrs        = map[schema.GroupResource]bool{
+		{Group: gatewayGroup, Resource: "httproutes"}: true,
+		{Group: gatewayGroup, Resource: "grpcroutes"}: true,
+	}
+)
+
+func (ctrl *controller) LinkerName() string { return "ingress-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	gr := object.GroupVersionResource().GroupResource()
+	if gr != ingressGr && gr != gatewayGr && !routeGrs[gr] {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	switch {
+	case gr == ingressGr:
+		return ingressLinks(object, raw)
+	case gr == gatewayGr:
+		return gatewayLinks(object, raw)
+	default:
+		return ctrl.routeLinks(logger, object, raw)
+	}
+}
+
+func ingressLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	ingress := &networkingv1.Ingress{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, ingress); err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot decode ingress: %w", err), "Decode")
+	}
+
+	var results []linker.LinkerResult
+
+	if className := ingress.Spec.IngressClassName; className != nil && *className != "" {
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, ingressClassGvr, "", *className, ""),
+			Role:    zconstants.LinkRoleParent,
+			Class:   "ingressClass",
+			DedupId: "ingressClass",
+		})
+	}
+
+	backends := []*networkingv1.IngressBackend{ingress.Spec.DefaultBackend}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP != nil {
+			for i := range rule.HTTP.Paths {
+				backends = append(backends, &rule.HTTP.Paths[i].Backend)
+			}
+		}
+	}
+
+	services := newBackendSet(object)
+	for _, backend := range backends {
+		if backend != nil && backend.Service != nil {
+			services.add(object.Namespace, backend.Service.Name)
+		}
+	}
+
+	return append(results, services.results...), nil
+}
+
+func gatewayLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	className, _, _ := unstructured.NestedString(raw.Object, "spec", "gatewayClassName")
+	if className == "" {
+		return nil, nil
+	}
+
+	gatewayClassGvr := schema.GroupVersionResource{Group: gatewayGroup, Version: object.Version, Resource: "gatewayclasses"}
+	return []linker.LinkerResult{{
+		Object:  utilobject.NewRich(object.Cluster, gatewayClassGvr, "", className, ""),
+		Role:    zconstants.LinkRoleParent,
+		Class:   "gatewayClass",
+		DedupId: "gatewayClass",
+	}}, nil
+}
+
+func (ctrl *controller) routeLinks(logger logrus.FieldLogger, object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	cdc, err := ctrl.DiscoveryCache.ForCluster(object.Cluster)
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot get discovery cache: %w", err), "DiscoveryCache")
+	}
+
+	var results []linker.LinkerResult
+
+	parentRefs, _, _ := unstructured.NestedSlice(raw.Object, "spec", "parentRefs")
+	for _, parentRef := range parentRefs {
+		ref, ok := parseRef(parentRef, gatewayGroup, "Gateway", object.Namespace)
+		if !ok {
+			continue
+		}
+
+		gvr, found := lookupResource(cdc, ref.group, ref.kind)
+		if !found {
+			logger.WithField("kind", ref.kind).Debug("unknown parent kind")
+			continue
+		}
+
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, gvr, ref.namespace, ref.name, ""),
+			Role:    zconstants.LinkRoleParent,
+			Class:   "routes",
+			DedupId: fmt.Sprintf("parentRef/%s/%s/%s", ref.kind, ref.namespace, ref.name),
+		})
+	}
+
+	services := newBackendSet(object)
+
+	rules, _, _ := unstructured.NestedSlice(raw.Object, "spec", "rules")
+	for _, rule := range rules {
+		ruleMap, ok := rule.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		backendRefs, _, _ := unstructured.NestedSlice(ruleMap, "backendRefs")
+		for _, backendRef := range backendRefs {
+			ref, ok := parseRef(backendRef, "", "Service", object.Namespace)
+			if ok && ref.group == "" && ref.kind == "Service" {
+				services.add(ref.namespace, ref.name)
+			}
+		}
+	}
+
+	return append(results, services.results...), nil
+}
+
+type objectRef struct {
+	group, kind, namespace, name string
+}
+
+// parseRef parses a Gateway API ParentReference or BackendRef with the specified defaults.
+func parseRef(value any, defaultGroup string, defaultKind string, defaultNamespace string) (objectRef, bool) {
+	refMap, ok := value.(map[string]any)
+	if !ok {
+		return objectRef{}, false
+	}
+
+	ref := objectRef{group: defaultGroup, kind: defaultKind, namespace: defaultNamespace}
+	if group, ok := refMap["group"].(string); ok {
+		ref.group = group
+	}
+	if kind, ok := refMap["kind"].(string); ok && kind != "" {
+		ref.kind = kind
+	}
+	if namespace, ok := refMap["namespace"].(string); ok && namespace != "" {
+		ref.namespace = namespace
+	}
+	ref.name, _ = refMap["name"].(string)
+
+	return ref, ref.name != ""
+}
+
+func lookupResource(cdc discovery.ClusterDiscoveryCache, group string, kind string) (schema.GroupVersionResource, bool) {
+	for _, version := range []string{"v1", "v1beta1", "v1alpha2"} {
+		if gvr, found := cdc.LookupResource(schema.GroupVersionKind{Group: group, Version: version, Kind: kind}); found {
+			return gvr, true
+		}
+	}
+
+	return schema.GroupVersionResource{}, false
+}
+
+// backendSet collects deduplicated links to backend services.
+type backendSet struct {
+	object  utilobject.Rich
+	seen    map[string]bool
+	results []linker.LinkerResult
+}
+
+func newBackendSet(object utilobject.Rich) *backendSet {
+	return &backendSet{object: object, seen: map[string]bool{}}
+}
+
+func (set *backendSet) add(namespace string, name string) {
+	key := namespace + "/" + name
+	if set.seen[key] {
+		return
+	}
+	set.seen[key] = true
+
+	set.results = append(set.results, linker.LinkerResult{
+		Object:  utilobject.NewRich(set.object.Cluster, serviceGvr, namespace, name, ""),
+		Role:    zconstants.LinkRoleChild,
+		Class:   "backends",
+		DedupId: "backend/" + key,
+	})
+}
@@ -0,0 +1,346 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Tracks the health of the apiservers of each cluster with a circuit breaker,
+// so that apiserver-dependent enrichment is skipped instead of stalling the pipeline when a cluster degrades.
+//
+// The breaker of a cluster opens after a number of consecutive failed requests or probes.
+// While open, the cluster is probed periodically, and the breaker is half-closed
+// after the first successful probe following the cooldown,
+// i.e. requests are allowed again but a single failure reopens the breaker.
+package clusterhealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("kube-cluster-health", manager.Ptr(&Health{
+		clusters: map[string]*clusterState{},
+	}))
+}
+
+// DegradedTag is the span tag set on spans of clusters whose breaker is open.
+const DegradedTag = "degraded"
+
+// ErrCircuitOpen is returned by apiserver-dependent operations skipped due to an open breaker.
+var ErrCircuitOpen = errors.New("cluster apiserver is unhealthy, request skipped by circuit breaker")
+
+type options struct {
+	enable           bool
+	failureThreshold int
+	cooldown         time.Duration
+	probeInterval    time.Duration
+	probeTimeout     time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"kube-cluster-health-enable",
+		true,
+		"skip apiserver-dependent enrichment of clusters whose apiservers are failing",
+	)
+	fs.IntVar(
+		&options.failureThreshold,
+		"kube-cluster-health-failure-threshold",
+		5,
+		"number of consecutive failed apiserver requests or probes after which the circuit breaker of a cluster opens",
+	)
+	fs.DurationVar(
+		&options.cooldown,
+		"kube-cluster-health-cooldown",
+		time.Second*30,
+		"minimum duration for which the circuit breaker of a cluster stays open",
+	)
+	fs.DurationVar(
+		&options.probeInterval,
+		"kube-cluster-health-probe-interval",
+		time.Second*10,
+		"interval between /readyz probes to each cluster",
+	)
+	fs.DurationVar(&options.probeTimeout, "kube-cluster-health-probe-timeout", time.Second*5, "timeout of each /readyz probe")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Health struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+	Metrics metrics.Client
+
+	TransitionMetric *metrics.Metric[*transitionMetric]
+	ProbeMetric      *metrics.Metric[*probeMetric]
+
+	probe func(ctx context.Context, cluster string) error
+
+	clustersMu sync.RWMutex
+	clusters   map[string]*clusterState
+}
+
+type transitionMetric struct {
+	Cluster string
+	Open    bool
+}
+
+func (*transitionMetric) MetricName() string { return "kube_cluster_circuit_transition" }
+
+type probeMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*probeMetric) MetricName() string { return "kube_cluster_health_probe" }
+
+type openClustersMetric struct{}
+
+func (*openClustersMetric) MetricName() string { return "kube_cluster_circuit_open" }
+
+type clusterState struct {
+	mu                  sync.Mutex
+	consecutiveFailures int
+	open                bool
+	openedAt            time.Time
+}
+
+var (
+	_ manager.Component      = &Health{}
+	_ manager.StatusReporter = &Health{}
+)
+
+func (health *Health) Options() manager.Options { return &health.options }
+
+func (health *Health) Init() error {
+	if health.options.failureThreshold < 1 {
+		return fmt.Errorf("--kube-cluster-health-failure-threshold must be positive")
+	}
+
+	if health.probe == nil {
+		health.probe = health.probeReadyz
+	}
+
+	metrics.NewMonitor(health.Metrics, &openClustersMetric{}, func() float64 {
+		return float64(len(health.OpenClusters()))
+	})
+
+	return nil
+}
+
+func (health *Health) Start(ctx context.Context) error {
+	if !health.options.enable {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(health.Logger)
+
+		ticker := health.Clock.Tick(health.options.probeInterval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker:
+				health.probeAll(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (health *Health) Close(ctx context.Context) error { return nil }
+
+// Allow returns false if requests to the apiservers of the cluster should be skipped.
+func (health *Health) Allow(cluster string) bool {
+	if !health.options.enable {
+		return true
+	}
+
+	state := health.get(cluster)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return !state.open
+}
+
+// Degraded returns whether apiserver-dependent enrichment for the cluster is currently skipped.
+func (health *Health) Degraded(cluster string) bool {
+	return !health.Allow(cluster)
+}
+
+// Report records the result of a request to the apiservers of the cluster.
+// Errors that indicate a problem with the request rather than the apiserver, such as NotFound, count as successes.
+func (health *Health) Report(cluster string, err error) {
+	if !health.options.enable {
+		return
+	}
+
+	health.record(cluster, !isUnhealthyError(err), false)
+}
+
+// OpenClusters returns the clusters whose breakers are currently open.
+func (health *Health) OpenClusters() []string {
+	health.clustersMu.RLock()
+	defer health.clustersMu.RUnlock()
+
+	clusters := []string{}
+	for cluster, state := range health.clusters {
+		state.mu.Lock()
+		if state.open {
+			clusters = append(clusters, cluster)
+		}
+		state.mu.Unlock()
+	}
+
+	return clusters
+}
+
+func (health *Health) Status() map[string]any {
+	return map[string]any{"openClusters": health.OpenClusters()}
+}
+
+func (health *Health) record(cluster string, success bool, isProbe bool) {
+	state := health.get(cluster)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	logger := health.Logger.WithField("cluster", cluster)
+
+	if success {
+		if !state.open {
+			state.consecutiveFailures = 0
+			return
+		}
+
+		// only probes may close an open breaker, since no requests are sent when it is open
+		if isProbe && health.Clock.Since(state.openedAt) >= health.options.cooldown {
+			state.open = false
+			state.consecutiveFailures = health.options.failureThreshold - 1
+			health.TransitionMetric.With(&transitionMetric{Cluster: cluster, Open: false}).Count(1)
+			logger.Info("cluster apiserver recovered, circuit breaker half-closed")
+		}
+
+		return
+	}
+
+	state.consecutiveFailures++
+	if state.open {
+		return
+	}
+
+	if state.consecutiveFailures >= health.options.failureThreshold {
+		state.open = true
+		state.openedAt = health.Clock.Now()
+		health.TransitionMetric.With(&transitionMetric{Cluster: cluster, Open: true}).Count(1)
+		logger.WithField("failures", state.consecutiveFailures).Warn("cluster apiserver is unhealthy, circuit breaker opened")
+	}
+}
+
+func (health *Health) get(cluster string) *clusterState {
+	health.clustersMu.RLock()
+	state, exists := health.clusters[cluster]
+	health.clustersMu.RUnlock()
+
+	if exists {
+		return state
+	}
+
+	health.clustersMu.Lock()
+	defer health.clustersMu.Unlock()
+
+	if state, exists := health.clusters[cluster]; exists {
+		return state
+	}
+
+	state = &clusterState{}
+	health.clusters[cluster] = state
+	return state
+}
+
+// probeAll probes every cluster that has been requested so far.
+func (health *Health) probeAll(ctx context.Context) {
+	health.clustersMu.RLock()
+	clusters := make([]string, 0, len(health.clusters))
+	for cluster := range health.clusters {
+		clusters = append(clusters, cluster)
+	}
+	health.clustersMu.RUnlock()
+
+	for _, cluster := range clusters {
+		metric := &probeMetric{Cluster: cluster}
+
+		probeCtx, cancelFunc := context.WithTimeout(ctx, health.options.probeTimeout)
+		start := health.Clock.Now()
+		err := health.probe(probeCtx, cluster)
+		cancelFunc()
+
+		if err != nil {
+			metric.Error = metrics.LabelError(err, "Probe")
+			health.Logger.WithField("cluster", cluster).WithError(err).Debug("cluster health probe failed")
+		}
+		health.ProbeMetric.DeferCount(start, metric)
+
+		health.record(cluster, err == nil, true)
+	}
+}
+
+func (health *Health) probeReadyz(ctx context.Context, cluster string) error {
+	client, err := health.Clients.Cluster(cluster)
+	if err != nil {
+		return err
+	}
+
+	return client.KubernetesClient().Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+}
+
+func isUnhealthyError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return k8serrors.IsTimeout(err) ||
+		k8serrors.IsServerTimeout(err) ||
+		k8serrors.IsTooManyRequests(err) ||
+		k8serrors.IsInternalError(err) ||
+		k8serrors.IsServiceUnavailable(err) ||
+		k8serrors.IsUnexpectedServerError(err)
+}
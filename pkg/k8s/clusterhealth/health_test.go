@@ -0,0 +1,94 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clusterhealth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, _ := metrics.NewMock(clock)
+
+	probeErr := fmt.Errorf("%w", context.DeadlineExceeded)
+	health := &Health{
+		options: options{
+			enable:           true,
+			failureThreshold: 3,
+			cooldown:         time.Minute,
+			probeTimeout:     time.Second,
+		},
+		Logger:           logrus.New(),
+		Clock:            clock,
+		Metrics:          metricsClient,
+		TransitionMetric: metrics.New[*transitionMetric](metricsClient),
+		ProbeMetric:      metrics.New[*probeMetric](metricsClient),
+		probe:            func(ctx context.Context, cluster string) error { return probeErr },
+		clusters:         map[string]*clusterState{},
+	}
+	assert.NoError(health.Init())
+
+	// client errors do not affect health
+	notFound := k8serrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "foo")
+	for i := 0; i < 5; i++ {
+		health.Report("member", notFound)
+	}
+	assert.True(health.Allow("member"))
+
+	health.Report("member", context.DeadlineExceeded)
+	health.Report("member", k8serrors.NewServiceUnavailable("overloaded"))
+	assert.True(health.Allow("member"))
+
+	health.Report("member", k8serrors.NewTooManyRequests("throttled", 1))
+	assert.False(health.Allow("member"))
+	assert.True(health.Degraded("member"))
+	assert.Equal([]string{"member"}, health.OpenClusters())
+
+	// successful probes within the cooldown do not close the breaker
+	probeErr = nil
+	clock.Step(time.Second * 30)
+	health.probeAll(context.Background())
+	assert.False(health.Allow("member"))
+
+	clock.Step(time.Second * 30)
+	health.probeAll(context.Background())
+	assert.True(health.Allow("member"))
+
+	// half-closed: a single failure reopens the breaker
+	health.Report("member", context.DeadlineExceeded)
+	assert.False(health.Allow("member"))
+
+	clock.Step(time.Minute)
+	health.probeAll(context.Background())
+	assert.True(health.Allow("member"))
+
+	// a success after half-closing fully closes the breaker
+	health.Report("member", nil)
+	health.Report("member", context.DeadlineExceeded)
+	assert.True(health.Allow("member"))
+}
@@ -0,0 +1,284 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Resolves the name of a cluster from well-known sources and normalizes cluster names,
+// so that the same cluster is tagged with the same name by all components.
+//
+// The detected identifier (e.g. the kube-system namespace UID) can be mapped to a readable name
+// through the same alias map that normalizes cluster names from other sources,
+// such as audit webhook paths and audit log streams of managed clusters.
+package clusterid
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func init() {
+	manager.Global.Provide("kube-cluster-id", manager.Ptr(&Identifier{
+		gceEndpoint: "http://metadata.google.internal",
+		awsEndpoint: "http://169.254.169.254",
+	}))
+}
+
+const (
+	SourceKubeSystemUid = "kube-system-uid"
+	SourceClusterInfo   = "cluster-info"
+	SourceGceMetadata   = "gce-metadata"
+	SourceAwsMetadata   = "aws-metadata"
+)
+
+type options struct {
+	detect  []string
+	timeout time.Duration
+	awsTag  string
+	alias   map[string]string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringSliceVar(
+		&options.detect,
+		"kube-cluster-name-detect",
+		[]string{},
+		"sources from which the target cluster name is detected if --kube-target-cluster is empty, tried in order; "+
+			"kube-system-uid uses the UID of the kube-system namespace, "+
+			"cluster-info uses the cluster name (or the server host if unnamed) in the kube-public/cluster-info ConfigMap, "+
+			"gce-metadata uses the cluster-name instance attribute of GKE nodes, "+
+			"aws-metadata uses the --kube-cluster-name-aws-tag instance tag of EKS nodes; "+
+			"the metadata sources only work if Kelemetry runs in the target cluster",
+	)
+	fs.DurationVar(
+		&options.timeout,
+		"kube-cluster-name-detect-timeout",
+		time.Second*10,
+		"timeout for each source of cluster name detection",
+	)
+	fs.StringVar(
+		&options.awsTag,
+		"kube-cluster-name-aws-tag",
+		"eks:cluster-name",
+		"EC2 instance tag containing the cluster name, requires instance metadata tags to be enabled",
+	)
+	fs.StringToStringVar(
+		&options.alias,
+		"kube-cluster-name-alias",
+		map[string]string{},
+		"map cluster names or detected identifiers to canonical cluster names, "+
+			"applied to cluster names from all sources including audit webhook paths, audit messages and --kube-target-cluster, "+
+			"e.g. '2c9f8a3e-4b1d-4d5a-9e61-0f7b2a6c1d33=prod,prod-eks=prod'",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+// Identifier detects and normalizes cluster names.
+type Identifier struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+
+	DetectMetric *metrics.Metric[*detectMetric]
+
+	gceEndpoint string
+	awsEndpoint string
+	httpClient  http.Client
+}
+
+type detectMetric struct {
+	Source string
+	Error  metrics.LabeledError
+}
+
+func (*detectMetric) MetricName() string { return "kube_cluster_name_detect" }
+
+var _ manager.Component = &Identifier{}
+
+func (identifier *Identifier) Options() manager.Options { return &identifier.options }
+
+func (identifier *Identifier) Init() error {
+	for _, source := range identifier.options.detect {
+		switch source {
+		case SourceKubeSystemUid, SourceClusterInfo, SourceGceMetadata, SourceAwsMetadata:
+		default:
+			return fmt.Errorf("unknown --kube-cluster-name-detect source %q", source)
+		}
+	}
+
+	identifier.httpClient.Timeout = identifier.options.timeout
+
+	return nil
+}
+
+func (identifier *Identifier) Start(ctx context.Context) error { return nil }
+func (identifier *Identifier) Close(ctx context.Context) error { return nil }
+
+// Normalize returns the canonical name of a cluster.
+func (identifier *Identifier) Normalize(name string) string {
+	name = strings.TrimSpace(name)
+	if alias, exists := identifier.options.alias[name]; exists {
+		return alias
+	}
+
+	return name
+}
+
+// DetectEnabled returns whether any detection source is configured.
+func (identifier *Identifier) DetectEnabled() bool { return len(identifier.options.detect) > 0 }
+
+// Detect returns the normalized name of the cluster served by the config
+// from the first detection source that succeeds.
+func (identifier *Identifier) Detect(ctx context.Context, config *rest.Config) (string, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("cannot create client for cluster name detection: %w", err)
+	}
+
+	errs := make([]string, 0, len(identifier.options.detect))
+	for _, source := range identifier.options.detect {
+		name, err := identifier.detectFrom(ctx, client, source)
+		if err != nil {
+			identifier.Logger.WithField("source", source).WithError(err).Warn("cannot detect cluster name")
+			errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+
+		normalized := identifier.Normalize(name)
+		identifier.Logger.WithField("source", source).WithField("detected", name).WithField("cluster", normalized).Info("detected cluster name")
+		return normalized, nil
+	}
+
+	return "", fmt.Errorf("all cluster name detection sources failed: %s", strings.Join(errs, "; "))
+}
+
+func (identifier *Identifier) detectFrom(ctx context.Context, client kubernetes.Interface, source string) (string, error) {
+	metric := &detectMetric{Source: source}
+	defer identifier.DetectMetric.DeferCount(identifier.Clock.Now(), metric)
+
+	ctx, cancel := context.WithTimeout(ctx, identifier.options.timeout)
+	defer cancel()
+
+	name, err := identifier.detectSource(ctx, client, source)
+	if err == nil && name == "" {
+		err = metrics.MakeLabeledError("Empty")
+	}
+	if err != nil {
+		metric.Error = err
+		return "", err
+	}
+
+	return name, nil
+}
+
+func (identifier *Identifier) detectSource(ctx context.Context, client kubernetes.Interface, source string) (string, error) {
+	switch source {
+	case SourceKubeSystemUid:
+		ns, err := client.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+		if err != nil {
+			return "", metrics.LabelError(err, "GetNamespace")
+		}
+		return string(ns.UID), nil
+	case SourceClusterInfo:
+		return detectClusterInfo(ctx, client)
+	case SourceGceMetadata:
+		return identifier.getMetadata(ctx, http.MethodGet, identifier.gceEndpoint+"/computeMetadata/v1/instance/attributes/cluster-name",
+			map[string]string{"Metadata-Flavor": "Google"})
+	case SourceAwsMetadata:
+		token, err := identifier.getMetadata(ctx, http.MethodPut, identifier.awsEndpoint+"/latest/api/token",
+			map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "60"})
+		if err != nil {
+			return "", err
+		}
+		return identifier.getMetadata(ctx, http.MethodGet,
+			identifier.awsEndpoint+"/latest/meta-data/tags/instance/"+url.PathEscape(identifier.options.awsTag),
+			map[string]string{"X-aws-ec2-metadata-token": token})
+	default:
+		return "", metrics.LabelError(fmt.Errorf("unknown source %q", source), "UnknownSource")
+	}
+}
+
+func detectClusterInfo(ctx context.Context, client kubernetes.Interface) (string, error) {
+	configMap, err := client.CoreV1().ConfigMaps(metav1.NamespacePublic).Get(ctx, "cluster-info", metav1.GetOptions{})
+	if err != nil {
+		return "", metrics.LabelError(err, "GetConfigMap")
+	}
+
+	kubeconfig, err := clientcmd.Load([]byte(configMap.Data["kubeconfig"]))
+	if err != nil {
+		return "", metrics.LabelError(fmt.Errorf("cannot parse cluster-info kubeconfig: %w", err), "Parse")
+	}
+
+	if len(kubeconfig.Clusters) != 1 {
+		return "", metrics.LabelError(
+			fmt.Errorf("cluster-info kubeconfig contains %d clusters, expected 1", len(kubeconfig.Clusters)),
+			"ClusterCount",
+		)
+	}
+
+	for name, cluster := range kubeconfig.Clusters {
+		if name != "" {
+			return name, nil
+		}
+
+		server, err := url.Parse(cluster.Server)
+		if err != nil {
+			return "", metrics.LabelError(fmt.Errorf("invalid server %q in cluster-info: %w", cluster.Server, err), "ParseServer")
+		}
+		return server.Hostname(), nil
+	}
+
+	panic("unreachable")
+}
+
+func (identifier *Identifier) getMetadata(ctx context.Context, method string, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", metrics.LabelError(err, "NewRequest")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := identifier.httpClient.Do(req)
+	if err != nil {
+		return "", metrics.LabelError(err, "MetadataRequest")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", metrics.LabelError(err, "MetadataRead")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", metrics.LabelError(fmt.Errorf("metadata server returned status %d for %s", resp.StatusCode, url), "MetadataStatus")
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clusterid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+const testClusterInfo = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: ""
+  cluster:
+    server: https://10.0.0.1:6443
+`
+
+func newTestIdentifier(t *testing.T, sources ...string) *Identifier {
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, _ := metrics.NewMock(clock)
+	identifier := &Identifier{
+		options: options{
+			detect:  sources,
+			timeout: time.Second,
+			awsTag:  "eks:cluster-name",
+			alias:   map[string]string{"uid-1": "prod", "prod-eks": "prod"},
+		},
+		Logger:       logrus.New(),
+		Clock:        clock,
+		DetectMetric: metrics.New[*detectMetric](metricsClient),
+	}
+	assert.NoError(t, identifier.Init())
+	return identifier
+}
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	identifier := newTestIdentifier(t)
+	assert.Equal("prod", identifier.Normalize("prod-eks"))
+	assert.Equal("prod", identifier.Normalize(" uid-1\n"))
+	assert.Equal("staging", identifier.Normalize("staging"))
+}
+
+func TestDetectKubernetesSources(t *testing.T) {
+	assert := assert.New(t)
+
+	identifier := newTestIdentifier(t)
+	client := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "kube-system", UID: "uid-1"}},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-public", Name: "cluster-info"},
+			Data:       map[string]string{"kubeconfig": testClusterInfo},
+		},
+	)
+
+	name, err := identifier.detectFrom(context.Background(), client, SourceKubeSystemUid)
+	assert.NoError(err)
+	assert.Equal("uid-1", name)
+
+	name, err = identifier.detectFrom(context.Background(), client, SourceClusterInfo)
+	assert.NoError(err)
+	assert.Equal("10.0.0.1", name)
+
+	_, err = identifier.detectFrom(context.Background(), fake.NewSimpleClientset(), SourceClusterInfo)
+	assert.Error(err)
+}
+
+func TestDetectMetadataSources(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/computeMetadata/v1/instance/attributes/cluster-name" && req.Header.Get("Metadata-Flavor") == "Google":
+			_, _ = w.Write([]byte("gke-prod"))
+		case req.Method == http.MethodPut && req.URL.Path == "/latest/api/token":
+			_, _ = w.Write([]byte("token"))
+		case req.URL.Path == "/latest/meta-data/tags/instance/eks:cluster-name" && req.Header.Get("X-aws-ec2-metadata-token") == "token":
+			_, _ = w.Write([]byte("prod-eks\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	identifier := newTestIdentifier(t)
+	identifier.gceEndpoint = server.URL
+	identifier.awsEndpoint = server.URL
+
+	name, err := identifier.detectFrom(context.Background(), nil, SourceGceMetadata)
+	assert.NoError(err)
+	assert.Equal("gke-prod", name)
+
+	name, err = identifier.detectFrom(context.Background(), nil, SourceAwsMetadata)
+	assert.NoError(err)
+	assert.Equal("prod-eks", name)
+
+	identifier.options.awsTag = "missing"
+	_, err = identifier.detectFrom(context.Background(), nil, SourceAwsMetadata)
+	assert.Error(err)
+}
+
+func TestInitRejectsUnknownSource(t *testing.T) {
+	identifier := &Identifier{options: options{detect: []string{"dns"}}}
+	assert.Error(t, identifier.Init())
+}
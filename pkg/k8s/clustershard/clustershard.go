@@ -0,0 +1,415 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Assigns member clusters to replicas, so that each replica only processes a subset of the clusters.
+//
+// In static mode, the clusters of each replica are listed explicitly.
+// In hash mode, each replica maintains a membership Lease,
+// and each cluster is assigned to a live replica by rendezvous hashing,
+// so that only the clusters of a joining or leaving replica are moved when the replica set changes.
+// A replica keeps processing a cluster for a grace period after losing it,
+// so that events are duplicated rather than dropped during rebalancing.
+package clustershard
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("kube-cluster-shard", manager.Ptr(&Assigner{}))
+}
+
+const groupLabel = "kelemetry.kubewharf.io/cluster-shard"
+
+type Mode string
+
+const (
+	// Every replica processes all clusters.
+	ModeNone Mode = "none"
+	// Each replica processes the clusters in --kube-cluster-shard-static-clusters.
+	ModeStatic Mode = "static"
+	// Clusters are assigned to live replicas by rendezvous hashing.
+	ModeHash Mode = "hash"
+)
+
+type options struct {
+	mode           string
+	staticClusters []string
+	identity       string
+	namespace      string
+	leaseName      string
+	leaseDuration  time.Duration
+	retryPeriod    time.Duration
+	handoverGrace  time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&options.mode,
+		"kube-cluster-shard-mode",
+		string(ModeNone),
+		"how clusters are assigned to replicas; one of "+
+			"'none' (every replica processes all clusters), "+
+			"'static' (each replica processes --kube-cluster-shard-static-clusters) and "+
+			"'hash' (clusters are distributed among live replicas by consistent hashing)",
+	)
+	fs.StringSliceVar(
+		&options.staticClusters,
+		"kube-cluster-shard-static-clusters",
+		[]string{},
+		"clusters processed by this replica in static mode",
+	)
+	fs.StringVar(&options.identity, "kube-cluster-shard-identity", "", "identity of this replica in hash mode, defaults to the hostname")
+	fs.StringVar(&options.namespace, "kube-cluster-shard-lease-namespace", "default", "namespace of the membership leases in hash mode")
+	fs.StringVar(
+		&options.leaseName,
+		"kube-cluster-shard-lease-name",
+		"kelemetry-cluster-shard",
+		"name of the replica group in hash mode, used as the prefix of membership lease names; "+
+			"replicas with different names shard clusters independently",
+	)
+	fs.DurationVar(
+		&options.leaseDuration,
+		"kube-cluster-shard-lease-duration",
+		time.Second*15,
+		"duration after which a replica that did not renew its membership lease is considered dead",
+	)
+	fs.DurationVar(
+		&options.retryPeriod,
+		"kube-cluster-shard-lease-retry-period",
+		time.Second*2,
+		"interval between membership lease renewals",
+	)
+	fs.DurationVar(
+		&options.handoverGrace,
+		"kube-cluster-shard-handover-grace",
+		time.Second*30,
+		"duration for which a replica keeps processing a cluster after the cluster is assigned to another replica",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type Assigner struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Clients k8s.Clients
+	Metrics metrics.Client
+
+	RebalanceMetric *metrics.Metric[*rebalanceMetric]
+
+	mode   Mode
+	static map[string]struct{}
+	leases coordinationv1client.LeaseInterface
+
+	// clusters queried through Owns, whose handover is tracked on rebalancing
+	seen sync.Map
+
+	mu      sync.RWMutex
+	members []string
+	// clusters that were owned by this replica, mapped to the time until which they are still processed
+	released map[string]time.Time
+}
+
+type rebalanceMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*rebalanceMetric) MetricName() string { return "kube_cluster_shard_rebalance" }
+
+type membersMetric struct{}
+
+func (*membersMetric) MetricName() string { return "kube_cluster_shard_members" }
+
+var _ manager.Component = &Assigner{}
+
+func (assigner *Assigner) Options() manager.Options { return &assigner.options }
+
+func (assigner *Assigner) Init() error {
+	assigner.mode = Mode(assigner.options.mode)
+	assigner.released = map[string]time.Time{}
+
+	switch assigner.mode {
+	case ModeNone:
+	case ModeStatic:
+		if len(assigner.options.staticClusters) == 0 {
+			return fmt.Errorf("--kube-cluster-shard-static-clusters is required in static mode")
+		}
+
+		assigner.static = make(map[string]struct{}, len(assigner.options.staticClusters))
+		for _, cluster := range assigner.options.staticClusters {
+			assigner.static[cluster] = struct{}{}
+		}
+	case ModeHash:
+		if assigner.options.identity == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("cannot get hostname for --kube-cluster-shard-identity: %w", err)
+			}
+			assigner.options.identity = hostname
+		}
+
+		assigner.leases = assigner.Clients.TargetCluster().KubernetesClient().CoordinationV1().Leases(assigner.options.namespace)
+
+		metrics.NewMonitor(assigner.Metrics, &membersMetric{}, func() float64 {
+			assigner.mu.RLock()
+			defer assigner.mu.RUnlock()
+			return float64(len(assigner.members))
+		})
+	default:
+		return fmt.Errorf("unknown --kube-cluster-shard-mode %q", assigner.options.mode)
+	}
+
+	return nil
+}
+
+func (assigner *Assigner) Start(ctx context.Context) error {
+	if assigner.mode != ModeHash {
+		return nil
+	}
+
+	// join synchronously so that the first assignment is available before other components start processing
+	if err := assigner.sync(ctx); err != nil {
+		return fmt.Errorf("cannot join cluster shard group: %w", err)
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(assigner.Logger)
+
+		ticker := assigner.Clock.Tick(assigner.options.retryPeriod)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker:
+				metric := &rebalanceMetric{}
+				if err := assigner.sync(ctx); err != nil {
+					metric.Error = metrics.LabelError(err, "Sync")
+					assigner.Logger.WithError(err).Warn("cannot sync cluster shard membership")
+				}
+				assigner.RebalanceMetric.With(metric).Count(1)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (assigner *Assigner) Close(ctx context.Context) error {
+	if assigner.mode != ModeHash {
+		return nil
+	}
+
+	// leave the group immediately so that other replicas take over without waiting for the lease to expire
+	err := assigner.leases.Delete(ctx, assigner.leaseName(), metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("cannot delete cluster shard membership lease: %w", err)
+	}
+
+	return nil
+}
+
+// Owns returns whether this replica should process the cluster.
+func (assigner *Assigner) Owns(cluster string) bool {
+	switch assigner.mode {
+	case ModeStatic:
+		_, owned := assigner.static[cluster]
+		return owned
+	case ModeHash:
+		assigner.seen.LoadOrStore(cluster, struct{}{})
+
+		assigner.mu.RLock()
+		defer assigner.mu.RUnlock()
+
+		if owner(assigner.members, cluster) == assigner.options.identity {
+			return true
+		}
+
+		until, released := assigner.released[cluster]
+		return released && assigner.Clock.Now().Before(until)
+	default:
+		return true
+	}
+}
+
+func (assigner *Assigner) leaseName() string {
+	return fmt.Sprintf("%s-%s", assigner.options.leaseName, assigner.options.identity)
+}
+
+// sync renews the membership lease of this replica and recomputes the live members.
+func (assigner *Assigner) sync(ctx context.Context) error {
+	if err := assigner.renew(ctx); err != nil {
+		return err
+	}
+
+	list, err := assigner.leases.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{groupLabel: assigner.options.leaseName}).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list membership leases: %w", err)
+	}
+
+	now := assigner.Clock.Now()
+	members := []string{}
+	for _, lease := range list.Items {
+		if lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+			continue
+		}
+
+		duration := assigner.options.leaseDuration
+		if lease.Spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+
+		if lease.Spec.RenewTime.Add(duration).After(now) {
+			members = append(members, *lease.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	assigner.setMembers(members, now)
+	return nil
+}
+
+func (assigner *Assigner) setMembers(members []string, now time.Time) {
+	assigner.mu.Lock()
+	defer assigner.mu.Unlock()
+
+	for cluster, until := range assigner.released {
+		if !now.Before(until) {
+			delete(assigner.released, cluster)
+		}
+	}
+
+	if slices.Equal(assigner.members, members) {
+		return
+	}
+
+	assigner.Logger.WithField("members", members).Info("cluster shard membership changed")
+
+	// remember which known clusters are moved away from this replica
+	for _, cluster := range assigner.knownClusters() {
+		wasOwner := owner(assigner.members, cluster) == assigner.options.identity
+		isOwner := owner(members, cluster) == assigner.options.identity
+		if wasOwner && !isOwner {
+			assigner.released[cluster] = now.Add(assigner.options.handoverGrace)
+			assigner.Logger.WithField("cluster", cluster).WithField("newOwner", owner(members, cluster)).Info("cluster handed over")
+		} else if isOwner && !wasOwner {
+			delete(assigner.released, cluster)
+			assigner.Logger.WithField("cluster", cluster).Info("cluster taken over")
+		}
+	}
+
+	assigner.members = members
+}
+
+func (assigner *Assigner) knownClusters() []string {
+	clusters := []string{}
+	assigner.seen.Range(func(key, _ any) bool {
+		clusters = append(clusters, key.(string))
+		return true
+	})
+	return clusters
+}
+
+func (assigner *Assigner) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(assigner.Clock.Now())
+	spec := coordinationv1.LeaseSpec{
+		HolderIdentity:       ptr.To(assigner.options.identity),
+		LeaseDurationSeconds: ptr.To(int32(assigner.options.leaseDuration.Seconds())),
+		RenewTime:            &now,
+	}
+
+	lease, err := assigner.leases.Get(ctx, assigner.leaseName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		spec.AcquireTime = &now
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      assigner.leaseName(),
+				Namespace: assigner.options.namespace,
+				Labels:    map[string]string{groupLabel: assigner.options.leaseName},
+			},
+			Spec: spec,
+		}
+
+		if _, err := assigner.leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("cannot create membership lease: %w", err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot get membership lease: %w", err)
+	}
+
+	spec.AcquireTime = lease.Spec.AcquireTime
+	lease.Spec = spec
+	if _, err := assigner.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("cannot renew membership lease: %w", err)
+	}
+
+	return nil
+}
+
+// owner selects the member with the highest hash for the cluster.
+func owner(members []string, cluster string) string {
+	var best string
+	var bestHash uint64
+
+	for _, member := range members {
+		hasher := fnv.New64a()
+		_, _ = hasher.Write([]byte(member))
+		_, _ = hasher.Write([]byte{0})
+		_, _ = hasher.Write([]byte(cluster))
+		hash := mix(hasher.Sum64())
+
+		if best == "" || hash > bestHash {
+			best, bestHash = member, hash
+		}
+	}
+
+	return best
+}
+
+// mix is the 64-bit finalizer of MurmurHash3.
+// FNV alone distributes poorly when inputs only differ in their first bytes.
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
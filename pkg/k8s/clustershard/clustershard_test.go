@@ -0,0 +1,132 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clustershard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestHashAssignment(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	clock := clocktesting.NewFakeClock(time.Unix(1000, 0))
+	leases := fake.NewSimpleClientset().CoordinationV1().Leases("default")
+
+	newAssigner := func(identity string) *Assigner {
+		return &Assigner{
+			options: options{
+				identity:      identity,
+				namespace:     "default",
+				leaseName:     "test",
+				leaseDuration: time.Second * 15,
+				handoverGrace: time.Second * 30,
+			},
+			Logger:   logrus.New(),
+			Clock:    clock,
+			mode:     ModeHash,
+			leases:   leases,
+			released: map[string]time.Time{},
+		}
+	}
+
+	clusters := make([]string, 50)
+	for i := range clusters {
+		clusters[i] = fmt.Sprintf("cluster-%d", i)
+	}
+
+	countOwned := func(assigner *Assigner) int {
+		count := 0
+		for _, cluster := range clusters {
+			if assigner.Owns(cluster) {
+				count++
+			}
+		}
+		return count
+	}
+
+	a := newAssigner("a")
+	b := newAssigner("b")
+	assert.NoError(a.sync(ctx))
+	assert.NoError(b.sync(ctx))
+	assert.NoError(a.sync(ctx))
+
+	// every cluster is owned by exactly one replica
+	for _, cluster := range clusters {
+		assert.NotEqual(a.Owns(cluster), b.Owns(cluster), cluster)
+	}
+	assert.Equal(len(clusters), countOwned(a)+countOwned(b))
+
+	ownedByA := map[string]bool{}
+	for _, cluster := range clusters {
+		ownedByA[cluster] = a.Owns(cluster)
+	}
+
+	syncAll := func(assigners ...*Assigner) {
+		for round := 0; round < 2; round++ {
+			for _, assigner := range assigners {
+				assert.NoError(assigner.sync(ctx))
+			}
+		}
+	}
+
+	// a third replica only takes over clusters, never moves clusters between the existing replicas
+	c := newAssigner("c")
+	syncAll(a, b, c)
+	assert.Positive(countOwned(c))
+
+	for _, cluster := range clusters {
+		newOwner := owner(a.members, cluster)
+		if ownedByA[cluster] {
+			assert.Contains([]string{"a", "c"}, newOwner, cluster)
+			// clusters handed over to c are still processed by a during the grace period
+			assert.True(a.Owns(cluster), cluster)
+		} else {
+			assert.Contains([]string{"b", "c"}, newOwner, cluster)
+		}
+	}
+
+	// advance past the grace period while renewing leases regularly
+	for i := 0; i < 16; i++ {
+		clock.Step(time.Second * 2)
+		syncAll(a, b, c)
+	}
+	for _, cluster := range clusters {
+		assert.Equal(1, boolCount(a.Owns(cluster), b.Owns(cluster), c.Owns(cluster)), cluster)
+	}
+
+	// when c leaves, its clusters are reassigned to the remaining replicas
+	assert.NoError(c.Close(ctx))
+	syncAll(a, b)
+	assert.Equal(len(clusters), countOwned(a)+countOwned(b))
+}
+
+func boolCount(values ...bool) int {
+	count := 0
+	for _, value := range values {
+		if value {
+			count++
+		}
+	}
+	return count
+}
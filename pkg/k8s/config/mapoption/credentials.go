@@ -0,0 +1,355 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+// credentialReloader serves a rest.Config whose bearer token and client certificate
+// are reloaded from the kubeconfig and the files it references without recreating the clients.
+//
+// The returned config uses a custom transport, so all clients and informers created from it
+// pick up rotated credentials on their next request.
+// When the client certificate changes, idle connections are closed immediately,
+// and connections that were established with the old certificate are closed after the drain timeout
+// so that long-running watches reconnect with the new certificate.
+type credentialReloader struct {
+	logger       logrus.FieldLogger
+	clock        clock.Clock
+	metric       *metrics.Metric[*credentialReloadMetric]
+	cluster      string
+	load         func() (*rest.Config, error)
+	drainTimeout time.Duration
+
+	// fields that require recreating the transport and are therefore not reloaded
+	fixed     string
+	transport *http.Transport
+	conns     *connTracker
+	current   atomic.Pointer[credentials]
+}
+
+type credentialReloadMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*credentialReloadMetric) MetricName() string { return "kube_credential_reload" }
+
+type credentials struct {
+	token   string
+	certPem []byte
+	keyPem  []byte
+	cert    *tls.Certificate
+}
+
+func (creds *credentials) certEqual(other *credentials) bool {
+	return bytes.Equal(creds.certPem, other.certPem) && bytes.Equal(creds.keyPem, other.keyPem)
+}
+
+// newCredentialReloader loads the config and wraps it with a reloading transport.
+// Returns a nil reloader with the original config if the credentials are managed by client-go,
+// i.e. the config uses an exec plugin, an auth provider or a custom transport.
+func newCredentialReloader(
+	logger logrus.FieldLogger,
+	clock clock.Clock,
+	metric *metrics.Metric[*credentialReloadMetric],
+	cluster string,
+	drainTimeout time.Duration,
+	load func() (*rest.Config, error),
+) (*rest.Config, *credentialReloader, error) {
+	config, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if config.ExecProvider != nil || config.AuthProvider != nil || config.Transport != nil || config.WrapTransport != nil {
+		return config, nil, nil
+	}
+
+	creds, err := readCredentials(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fixed, err := fixedConfigKey(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloader := &credentialReloader{
+		logger:       logger.WithField("cluster", cluster),
+		clock:        clock,
+		metric:       metric,
+		cluster:      cluster,
+		load:         load,
+		drainTimeout: drainTimeout,
+		fixed:        fixed,
+		conns:        &connTracker{conns: map[*trackedConn]uint64{}},
+	}
+	reloader.current.Store(creds)
+
+	tlsConfig, err := rest.TLSConfigFor(withoutCredentials(config))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot construct TLS config: %w", err)
+	}
+	if creds.cert != nil {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	reloader.transport = utilnet.SetTransportDefaults(&http.Transport{
+		Proxy:               config.Proxy,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: 25,
+		DialContext:         reloader.conns.wrap(dialer.DialContext),
+	})
+
+	wrapped := withoutCredentials(config)
+	wrapped.BearerToken = ""
+	wrapped.BearerTokenFile = ""
+	wrapped.TLSClientConfig = rest.TLSClientConfig{}
+	wrapped.Transport = &bearerRoundTripper{reloader: reloader, delegate: reloader.transport}
+
+	return wrapped, reloader, nil
+}
+
+func (reloader *credentialReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := reloader.current.Load().cert; cert != nil {
+		return cert, nil
+	}
+
+	return &tls.Certificate{}, nil
+}
+
+// reload reads the credentials again and swaps them in if they have changed.
+func (reloader *credentialReloader) reload(ctx context.Context) {
+	metric := &credentialReloadMetric{Cluster: reloader.cluster}
+	defer reloader.metric.DeferCount(reloader.clock.Now(), metric)
+
+	config, err := reloader.load()
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Load")
+		reloader.logger.WithError(err).Warn("cannot reload kubeconfig, keep using previous credentials")
+		return
+	}
+
+	if fixed, err := fixedConfigKey(config); err != nil {
+		metric.Error = metrics.LabelError(err, "ReadCA")
+		reloader.logger.WithError(err).Warn("cannot reload kubeconfig, keep using previous credentials")
+		return
+	} else if fixed != reloader.fixed {
+		reloader.logger.Warn("server address or certificate authority changed in kubeconfig, restart required to take effect")
+	}
+
+	creds, err := readCredentials(config)
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "ReadCredentials")
+		reloader.logger.WithError(err).Warn("cannot reload credentials, keep using previous credentials")
+		return
+	}
+
+	previous := reloader.current.Load()
+	certChanged := !creds.certEqual(previous)
+	if creds.token == previous.token && !certChanged {
+		return
+	}
+
+	reloader.current.Store(creds)
+	reloader.logger.WithField("certChanged", certChanged).Info("reloaded credentials")
+
+	if certChanged {
+		generation := reloader.conns.nextGeneration()
+		reloader.transport.CloseIdleConnections()
+
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-reloader.clock.After(reloader.drainTimeout):
+				if closed := reloader.conns.closeBefore(generation); closed > 0 {
+					reloader.logger.WithField("connections", closed).Info("closed connections using previous client certificate")
+				}
+			}
+		}()
+	}
+}
+
+// readCredentials reads the bearer token and client certificate of a config,
+// including from the files it references.
+func readCredentials(config *rest.Config) (*credentials, error) {
+	creds := &credentials{token: config.BearerToken}
+
+	if config.BearerTokenFile != "" {
+		token, err := os.ReadFile(config.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read token file: %w", err)
+		}
+		creds.token = strings.TrimSpace(string(token))
+	}
+
+	creds.certPem = config.CertData
+	if len(creds.certPem) == 0 && config.CertFile != "" {
+		var err error
+		if creds.certPem, err = os.ReadFile(config.CertFile); err != nil {
+			return nil, fmt.Errorf("cannot read client certificate: %w", err)
+		}
+	}
+
+	creds.keyPem = config.KeyData
+	if len(creds.keyPem) == 0 && config.KeyFile != "" {
+		var err error
+		if creds.keyPem, err = os.ReadFile(config.KeyFile); err != nil {
+			return nil, fmt.Errorf("cannot read client key: %w", err)
+		}
+	}
+
+	if len(creds.certPem) > 0 || len(creds.keyPem) > 0 {
+		cert, err := tls.X509KeyPair(creds.certPem, creds.keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		creds.cert = &cert
+	}
+
+	return creds, nil
+}
+
+// fixedConfigKey identifies the parts of a config that are baked into the transport.
+func fixedConfigKey(config *rest.Config) (string, error) {
+	caData := config.CAData
+	if len(caData) == 0 && config.CAFile != "" {
+		var err error
+		if caData, err = os.ReadFile(config.CAFile); err != nil {
+			return "", fmt.Errorf("cannot read certificate authority: %w", err)
+		}
+	}
+
+	return fmt.Sprintf("%s|%s|%t|%x", config.Host, config.ServerName, config.Insecure, caData), nil
+}
+
+func withoutCredentials(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.CertData = nil
+	config.CertFile = ""
+	config.KeyData = nil
+	config.KeyFile = ""
+	return config
+}
+
+type bearerRoundTripper struct {
+	reloader *credentialReloader
+	delegate http.RoundTripper
+}
+
+func (rt *bearerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := rt.reloader.current.Load().token
+	if token == "" || req.Header.Get("Authorization") != "" {
+		return rt.delegate.RoundTrip(req)
+	}
+
+	req = utilnet.CloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return rt.delegate.RoundTrip(req)
+}
+
+func (rt *bearerRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.delegate }
+
+// connTracker records the credential generation under which each connection was dialed.
+type connTracker struct {
+	mu         sync.Mutex
+	generation uint64
+	conns      map[*trackedConn]uint64
+}
+
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	once    sync.Once
+}
+
+func (conn *trackedConn) Close() error {
+	conn.once.Do(func() {
+		conn.tracker.mu.Lock()
+		defer conn.tracker.mu.Unlock()
+		delete(conn.tracker.conns, conn)
+	})
+	return conn.Conn.Close()
+}
+
+type dialFunc = func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (tracker *connTracker) wrap(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		tracker.mu.Lock()
+		defer tracker.mu.Unlock()
+
+		tracked := &trackedConn{Conn: conn, tracker: tracker}
+		tracker.conns[tracked] = tracker.generation
+		return tracked, nil
+	}
+}
+
+// nextGeneration starts a new generation for subsequently dialed connections and returns it.
+func (tracker *connTracker) nextGeneration() uint64 {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.generation++
+	return tracker.generation
+}
+
+// closeBefore closes all connections dialed before the given generation.
+func (tracker *connTracker) closeBefore(generation uint64) int {
+	tracker.mu.Lock()
+	stale := []*trackedConn{}
+	for conn, connGeneration := range tracker.conns {
+		if connGeneration < generation {
+			stale = append(stale, conn)
+		}
+	}
+	tracker.mu.Unlock()
+
+	for _, conn := range stale {
+		_ = conn.Close()
+	}
+
+	return len(stale)
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestCredentialReloadToken(t *testing.T) {
+	assert := assert.New(t)
+
+	received := make(chan string, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	writeKubeconfig := func(token string) {
+		kubeconfig := strings.Replace(
+			fmt.Sprintf(testKubeconfig, token),
+			"https://member.example.com",
+			server.URL+"\n    insecure-skip-tls-verify: true",
+			1,
+		)
+		assert.NoError(os.WriteFile(path, []byte(kubeconfig), 0o600))
+	}
+	writeKubeconfig("foo")
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, _ := metrics.NewMock(clock)
+	config, reloader, err := newCredentialReloader(
+		logrus.New(),
+		clock,
+		metrics.New[*credentialReloadMetric](metricsClient),
+		"member",
+		time.Minute,
+		func() (*rest.Config, error) { return clientcmd.BuildConfigFromFlags("", path) },
+	)
+	assert.NoError(err)
+	assert.NotNil(reloader)
+
+	httpClient, err := rest.HTTPClientFor(config)
+	assert.NoError(err)
+
+	get := func() string {
+		resp, err := httpClient.Get(server.URL)
+		assert.NoError(err)
+		assert.NoError(resp.Body.Close())
+		return <-received
+	}
+
+	assert.Equal("Bearer foo", get())
+
+	writeKubeconfig("bar")
+	assert.Equal("Bearer foo", get())
+
+	reloader.reload(context.Background())
+	assert.Equal("Bearer bar", get())
+}
+
+func TestConnTrackerCloseBefore(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := &connTracker{conns: map[*trackedConn]uint64{}}
+	peers := []net.Conn{}
+	dial := tracker.wrap(func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, peer := net.Pipe()
+		peers = append(peers, peer)
+		return conn, nil
+	})
+
+	oldConn, err := dial(context.Background(), "tcp", "")
+	assert.NoError(err)
+
+	generation := tracker.nextGeneration()
+
+	newConn, err := dial(context.Background(), "tcp", "")
+	assert.NoError(err)
+
+	assert.Equal(1, tracker.closeBefore(generation))
+	assert.Len(tracker.conns, 1)
+
+	_, err = oldConn.Write([]byte{0})
+	assert.Error(err)
+
+	go func() { _, _ = peers[1].Read(make([]byte, 1)) }()
+	_, err = newConn.Write([]byte{0})
+	assert.NoError(err)
+
+	assert.Equal(0, tracker.closeBefore(generation))
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd/api"
+	toolsmetrics "k8s.io/client-go/tools/metrics"
+
+	// Registers the oidc auth provider, and the removed gcp and azure auth providers
+	// so that they fail with a message pointing to the replacement exec plugins.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type execPluginCallMetric struct {
+	ExitCode int
+	Status   string
+}
+
+func (*execPluginCallMetric) MetricName() string { return "kube_exec_plugin_call" }
+
+type execPluginCalls struct {
+	metric *metrics.Metric[*execPluginCallMetric]
+}
+
+var _ toolsmetrics.CallsMetric = execPluginCalls{}
+
+func (calls execPluginCalls) Increment(exitCode int, callStatus string) {
+	calls.metric.With(&execPluginCallMetric{ExitCode: exitCode, Status: callStatus}).Count(1)
+}
+
+// registerExecPluginMetrics reports exec credential plugin invocations by client-go.
+// client-go only accepts the first registration in the process.
+func registerExecPluginMetrics(metric *metrics.Metric[*execPluginCallMetric]) {
+	toolsmetrics.Register(toolsmetrics.RegisterOpts{ExecPluginCalls: execPluginCalls{metric: metric}})
+}
+
+// prepareExecProvider adapts exec credential plugins in the config to run in a non-interactive daemon.
+//
+// client-go invokes the plugin on the first request and again when the returned credential
+// expires or is rejected by the apiserver, so short-lived tokens from managed clusters are refreshed transparently.
+func prepareExecProvider(config *rest.Config, extraEnv map[string]string) error {
+	if config.ExecProvider == nil {
+		return nil
+	}
+
+	if _, err := exec.LookPath(config.ExecProvider.Command); err != nil {
+		return fmt.Errorf("exec credential plugin %q is not available: %w", config.ExecProvider.Command, err)
+	}
+
+	// Kelemetry never runs with a usable stdin, so plugins must not wait for user input.
+	config.ExecProvider.InteractiveMode = api.NeverExecInteractiveMode
+
+	keys := make([]string, 0, len(extraEnv))
+	for key := range extraEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := make([]api.ExecEnvVar, 0, len(config.ExecProvider.Env)+len(keys))
+	env = append(env, config.ExecProvider.Env...)
+	for _, key := range keys {
+		env = append(env, api.ExecEnvVar{Name: key, Value: extraEnv[key]})
+	}
+	config.ExecProvider.Env = env
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testExecKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: member
+  cluster:
+    server: https://member.example.com
+contexts:
+- name: member
+  context:
+    cluster: member
+    user: member
+current-context: member
+users:
+- name: member
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1beta1
+      command: %s
+      interactiveMode: IfAvailable
+      env:
+      - name: FOO
+        value: foo
+`
+
+func TestPrepareExecProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(fmt.Sprintf(testExecKubeconfig, "sh")))
+	assert.NoError(err)
+
+	assert.NoError(prepareExecProvider(config, map[string]string{"QUX": "qux", "BAR": "bar"}))
+	assert.Equal(api.NeverExecInteractiveMode, config.ExecProvider.InteractiveMode)
+	assert.Equal([]api.ExecEnvVar{
+		{Name: "FOO", Value: "foo"},
+		{Name: "BAR", Value: "bar"},
+		{Name: "QUX", Value: "qux"},
+	}, config.ExecProvider.Env)
+
+	config, err = clientcmd.RESTConfigFromKubeConfig([]byte(fmt.Sprintf(testExecKubeconfig, "kelemetry-nonexistent-plugin")))
+	assert.NoError(err)
+	assert.Error(prepareExecProvider(config, nil))
+}
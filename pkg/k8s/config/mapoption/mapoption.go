@@ -19,12 +19,17 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/clock"
 
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterid"
 	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
 	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
 )
 
 const K8sDefaultRequestTimeout = time.Minute
@@ -39,6 +44,15 @@ type options struct {
 	kubeconfig        map[string]string
 	requestTimeout    map[string]string
 	useOldRvClusters  []string
+
+	registryNamespace string
+	registryName      string
+	registryResync    time.Duration
+
+	credentialReloadInterval time.Duration
+	credentialDrainTimeout   time.Duration
+
+	execPluginEnv map[string]string
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -46,7 +60,8 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		&options.targetClusterName,
 		"kube-target-cluster",
 		"",
-		"name of the target cluster; must be a key in --kube-apiserver and/or --kubeconfig",
+		"name of the target cluster; must be a key in --kube-apiserver and/or --kubeconfig; "+
+			"if empty, the in-cluster config is used and the name is detected from --kube-cluster-name-detect",
 	)
 	fs.StringToStringVar(&options.master, "kube-apiservers", map[string]string{}, "map of kube apiserver addresses")
 	fs.StringToStringVar(&options.kubeconfig, "kube-config-paths", map[string]string{}, "map of kube config paths")
@@ -62,6 +77,46 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 		[]string{},
 		"list of clusters that do not have new resource version in audit",
 	)
+	fs.StringVar(
+		&options.registryNamespace,
+		"kube-cluster-registry-namespace",
+		"default",
+		"namespace of the cluster registry ConfigMap and the kubeconfig secrets it references",
+	)
+	fs.StringVar(
+		&options.registryName,
+		"kube-cluster-registry-name",
+		"",
+		"name of a ConfigMap in the target cluster that registers additional clusters at runtime; "+
+			"each key is a cluster name and each value is a JSON object with the fields "+
+			"kubeconfigSecret, kubeconfigSecretKey, kubeconfigPath, apiserver, requestTimeout and useOldResourceVersion",
+	)
+	fs.DurationVar(
+		&options.registryResync,
+		"kube-cluster-registry-resync",
+		time.Minute*5,
+		"interval at which kubeconfig secrets referenced by the cluster registry are reloaded",
+	)
+	fs.DurationVar(
+		&options.credentialReloadInterval,
+		"kube-credential-reload-interval",
+		time.Minute,
+		"interval at which bearer tokens and client certificates in --kube-config-paths and the files they reference are reloaded; "+
+			"0 to disable reloading",
+	)
+	fs.DurationVar(
+		&options.credentialDrainTimeout,
+		"kube-credential-drain-timeout",
+		time.Minute*5,
+		"duration after a client certificate rotation after which connections established with the previous certificate are closed",
+	)
+	fs.StringToStringVar(
+		&options.execPluginEnv,
+		"kube-exec-plugin-env",
+		map[string]string{},
+		"environment variables passed to exec credential plugins in kubeconfigs, "+
+			"in addition to those specified in the kubeconfig, e.g. 'AWS_PROFILE=kelemetry'",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -69,8 +124,18 @@ func (options *options) EnableFlag() *bool { return nil }
 type Provider struct {
 	manager.MuxImplBase
 	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
 
-	configs map[string]*k8sconfig.Cluster
+	ClusterId *clusterid.Identifier
+
+	CredentialReloadMetric *metrics.Metric[*credentialReloadMetric]
+	ExecPluginCallMetric   *metrics.Metric[*execPluginCallMetric]
+
+	targetName string
+	configs    map[string]*k8sconfig.Cluster
+	registry   *registry
+	reloaders  []*credentialReloader
 }
 
 var _ k8sconfig.Config = &Provider{}
@@ -80,6 +145,8 @@ func (*Provider) MuxImplName() (name string, isDefault bool) { return "mapoption
 func (provider *Provider) Options() manager.Options { return &provider.options }
 
 func (provider *Provider) Init() error {
+	registerExecPluginMetrics(provider.ExecPluginCallMetric)
+
 	names := map[string]struct{}{}
 	for name := range provider.options.master {
 		names[name] = struct{}{}
@@ -90,7 +157,33 @@ func (provider *Provider) Init() error {
 
 	provider.configs = make(map[string]*k8sconfig.Cluster, len(names))
 	for name := range names {
-		config, err := clientcmd.BuildConfigFromFlags(provider.options.master[name], provider.options.kubeconfig[name])
+		master, kubeconfig := provider.options.master[name], provider.options.kubeconfig[name]
+		load := func() (*rest.Config, error) {
+			config, err := clientcmd.BuildConfigFromFlags(master, kubeconfig)
+			if err != nil {
+				return nil, err
+			}
+			return config, prepareExecProvider(config, provider.options.execPluginEnv)
+		}
+
+		var config *rest.Config
+		var err error
+		if provider.options.credentialReloadInterval > 0 {
+			var reloader *credentialReloader
+			config, reloader, err = newCredentialReloader(
+				provider.Logger,
+				provider.Clock,
+				provider.CredentialReloadMetric,
+				name,
+				provider.options.credentialDrainTimeout,
+				load,
+			)
+			if reloader != nil {
+				provider.reloaders = append(provider.reloaders, reloader)
+			}
+		} else {
+			config, err = load()
+		}
 		if err != nil {
 			return fmt.Errorf("cannot construct connection config for %q: %w", name, err)
 		}
@@ -119,10 +212,12 @@ func (provider *Provider) Init() error {
 			UseOldResourceVersion: useOldRv,
 		}
 
-		provider.configs[name] = clusterConfig
+		provider.configs[provider.ClusterId.Normalize(name)] = clusterConfig
 	}
 
-	_, hasTarget := provider.configs[provider.options.targetClusterName]
+	provider.targetName = provider.ClusterId.Normalize(provider.options.targetClusterName)
+
+	_, hasTarget := provider.configs[provider.targetName]
 	if !hasTarget {
 		inCluster, err := rest.InClusterConfig()
 		if err != nil {
@@ -141,21 +236,90 @@ func (provider *Provider) Init() error {
 			}
 		}
 
-		provider.configs[provider.options.targetClusterName] = &k8sconfig.Cluster{
+		provider.configs[provider.targetName] = &k8sconfig.Cluster{
 			Config:                inCluster,
 			DefaultRequestTimeout: defaultRequestTimeout,
 		}
 	}
 
+	if provider.targetName == "" && provider.ClusterId.DetectEnabled() {
+		detected, err := provider.ClusterId.Detect(context.Background(), provider.configs[""].Config)
+		if err != nil {
+			return fmt.Errorf("--kube-target-cluster is empty and the target cluster name cannot be detected: %w", err)
+		}
+
+		// a config explicitly specified for the detected name takes precedence over the in-cluster config
+		if _, exists := provider.configs[detected]; !exists {
+			provider.configs[detected] = provider.configs[""]
+		}
+		delete(provider.configs, "")
+		provider.targetName = detected
+	}
+
+	if provider.options.registryName != "" {
+		var err error
+		provider.registry, err = newRegistry(
+			provider.Logger,
+			provider.configs[provider.targetName].Config,
+			provider.options.registryNamespace,
+			provider.options.registryName,
+			provider.options.registryResync,
+			provider.options.execPluginEnv,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (provider *Provider) Start(ctx context.Context) error {
+	if len(provider.reloaders) > 0 {
+		go func() {
+			defer shutdown.RecoverPanic(provider.Logger)
+			provider.reloadCredentials(ctx)
+		}()
+	}
+
+	if provider.registry != nil {
+		return provider.registry.start(ctx)
+	}
+
 	return nil
 }
 
-func (provider *Provider) Start(ctx context.Context) error { return nil }
+func (provider *Provider) reloadCredentials(ctx context.Context) {
+	ticker := provider.Clock.Tick(provider.options.credentialReloadInterval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker:
+			for _, reloader := range provider.reloaders {
+				reloader.reload(ctx)
+			}
+		}
+	}
+}
 
 func (provider *Provider) Close(ctx context.Context) error { return nil }
 
-func (provider *Provider) TargetName() string { return provider.options.targetClusterName }
+func (provider *Provider) TargetName() string { return provider.targetName }
 
+// Provide returns the statically configured cluster, or the cluster in the registry if not configured statically.
+// The returned pointer changes when the registration is updated.
 func (provider *Provider) Provide(clusterName string) *k8sconfig.Cluster {
-	return provider.configs[clusterName]
+	clusterName = provider.ClusterId.Normalize(clusterName)
+
+	if config, exists := provider.configs[clusterName]; exists {
+		return config
+	}
+
+	if provider.registry != nil {
+		return provider.registry.get(clusterName)
+	}
+
+	return nil
 }
@@ -0,0 +1,249 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
+)
+
+// Registration is the value of each entry in the registry ConfigMap, keyed by cluster name.
+type Registration struct {
+	// Name of a Secret in the namespace of the ConfigMap that contains the kubeconfig of the cluster.
+	KubeconfigSecret string `json:"kubeconfigSecret,omitempty"`
+	// Key of the kubeconfig in the Secret. Defaults to "kubeconfig".
+	KubeconfigSecretKey string `json:"kubeconfigSecretKey,omitempty"`
+	// Path of a kubeconfig file mounted in the container, used if KubeconfigSecret is empty.
+	KubeconfigPath string `json:"kubeconfigPath,omitempty"`
+	// Overrides the server address in the kubeconfig.
+	Apiserver string `json:"apiserver,omitempty"`
+
+	RequestTimeout        string `json:"requestTimeout,omitempty"`
+	UseOldResourceVersion bool   `json:"useOldResourceVersion,omitempty"`
+}
+
+// registry watches a ConfigMap that registers member clusters at runtime,
+// so that clusters can be added or removed without restarting the components.
+type registry struct {
+	logger    logrus.FieldLogger
+	namespace string
+	name      string
+	client    kubernetes.Interface
+	factory   informers.SharedInformerFactory
+	execEnv   map[string]string
+
+	clustersLock sync.RWMutex
+	clusters     map[string]*registeredCluster
+}
+
+type registeredCluster struct {
+	registration Registration
+	// the loaded kubeconfig, compared to detect credential rotation.
+	kubeconfig []byte
+	config     *k8sconfig.Cluster
+}
+
+func newRegistry(
+	logger logrus.FieldLogger,
+	targetConfig *rest.Config,
+	namespace, name string,
+	resync time.Duration,
+	execEnv map[string]string,
+) (*registry, error) {
+	client, err := kubernetes.NewForConfig(targetConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create client for cluster registry: %w", err)
+	}
+
+	reg := &registry{
+		logger:    logger.WithField("registry", fmt.Sprintf("%s/%s", namespace, name)),
+		namespace: namespace,
+		name:      name,
+		client:    client,
+		execEnv:   execEnv,
+		clusters:  map[string]*registeredCluster{},
+	}
+
+	reg.factory = informers.NewSharedInformerFactoryWithOptions(
+		client, resync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+
+	// resync also reloads the referenced secrets periodically to pick up rotated credentials
+	_, err = reg.factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { reg.reload(obj.(*corev1.ConfigMap)) },
+		UpdateFunc: func(_, obj any) { reg.reload(obj.(*corev1.ConfigMap)) },
+		DeleteFunc: func(any) { reg.reload(nil) },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch cluster registry: %w", err)
+	}
+
+	return reg, nil
+}
+
+func (reg *registry) start(ctx context.Context) error {
+	reg.factory.Start(ctx.Done())
+	for _, synced := range reg.factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("cluster registry cache did not sync")
+		}
+	}
+
+	return nil
+}
+
+func (reg *registry) get(name string) *k8sconfig.Cluster {
+	reg.clustersLock.RLock()
+	defer reg.clustersLock.RUnlock()
+
+	if cluster, exists := reg.clusters[name]; exists {
+		return cluster.config
+	}
+
+	return nil
+}
+
+func (reg *registry) reload(configMap *corev1.ConfigMap) {
+	entries := map[string]string{}
+	if configMap != nil {
+		entries = configMap.Data
+	}
+
+	reg.clustersLock.RLock()
+	previous := reg.clusters
+	reg.clustersLock.RUnlock()
+
+	clusters := make(map[string]*registeredCluster, len(entries))
+	for name, value := range entries {
+		logger := reg.logger.WithField("cluster", name)
+
+		cluster, err := reg.load(name, value, previous[name])
+		if err != nil {
+			logger.WithError(err).Error("cannot load cluster registration")
+			if old, exists := previous[name]; exists {
+				// keep serving the last valid configuration
+				clusters[name] = old
+			}
+			continue
+		}
+
+		if old, exists := previous[name]; !exists {
+			logger.Info("registered cluster")
+		} else if old != cluster {
+			logger.Info("updated cluster registration")
+		}
+		clusters[name] = cluster
+	}
+
+	for name := range previous {
+		if _, exists := clusters[name]; !exists {
+			reg.logger.WithField("cluster", name).Info("unregistered cluster")
+		}
+	}
+
+	reg.clustersLock.Lock()
+	reg.clusters = clusters
+	reg.clustersLock.Unlock()
+}
+
+// load returns the previous cluster if the registration and the kubeconfig are unchanged,
+// so that clients of unchanged clusters are not recreated.
+func (reg *registry) load(name string, value string, previous *registeredCluster) (*registeredCluster, error) {
+	var registration Registration
+	if err := json.Unmarshal([]byte(value), &registration); err != nil {
+		return nil, fmt.Errorf("invalid registration: %w", err)
+	}
+
+	var kubeconfig []byte
+
+	switch {
+	case registration.KubeconfigSecret != "":
+		secret, err := reg.client.CoreV1().Secrets(reg.namespace).Get(context.Background(), registration.KubeconfigSecret, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot get kubeconfig secret: %w", err)
+		}
+
+		key := registration.KubeconfigSecretKey
+		if key == "" {
+			key = "kubeconfig"
+		}
+
+		var exists bool
+		if kubeconfig, exists = secret.Data[key]; !exists {
+			return nil, fmt.Errorf("kubeconfig secret has no key %q", key)
+		}
+	case registration.KubeconfigPath != "":
+		var err error
+		if kubeconfig, err = os.ReadFile(registration.KubeconfigPath); err != nil {
+			return nil, fmt.Errorf("cannot read kubeconfig: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("one of kubeconfigSecret and kubeconfigPath must be set")
+	}
+
+	if previous != nil && previous.registration == registration && bytes.Equal(previous.kubeconfig, kubeconfig) {
+		return previous, nil
+	}
+
+	config, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	if registration.Apiserver != "" {
+		config.Host = registration.Apiserver
+	}
+	if err := prepareExecProvider(config, reg.execEnv); err != nil {
+		return nil, err
+	}
+	config = rest.AddUserAgent(config, "kelemetry")
+
+	requestTimeout := K8sDefaultRequestTimeout
+	if registration.RequestTimeout != "" {
+		if requestTimeout, err = time.ParseDuration(registration.RequestTimeout); err != nil {
+			return nil, fmt.Errorf("invalid requestTimeout: %w", err)
+		}
+	}
+
+	return &registeredCluster{
+		registration: registration,
+		kubeconfig:   kubeconfig,
+		config: &k8sconfig.Cluster{
+			Config:                config,
+			DefaultRequestTimeout: requestTimeout,
+			UseOldResourceVersion: registration.UseOldResourceVersion,
+		},
+	}, nil
+}
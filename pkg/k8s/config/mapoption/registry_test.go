@@ -0,0 +1,98 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mapoption
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: member
+  cluster:
+    server: https://member.example.com
+contexts:
+- name: member
+  context:
+    cluster: member
+    user: member
+current-context: member
+users:
+- name: member
+  user:
+    token: %s
+`
+
+func kubeconfigSecret(token string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "member-kubeconfig"},
+		Data:       map[string][]byte{"kubeconfig": []byte(fmt.Sprintf(testKubeconfig, token))},
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	assert := assert.New(t)
+
+	client := fake.NewSimpleClientset(kubeconfigSecret("foo"))
+	reg := &registry{
+		logger:    logrus.New(),
+		namespace: "default",
+		name:      "clusters",
+		client:    client,
+		clusters:  map[string]*registeredCluster{},
+	}
+
+	configMap := &corev1.ConfigMap{
+		Data: map[string]string{
+			"member":  `{"kubeconfigSecret": "member-kubeconfig", "requestTimeout": "30s"}`,
+			"invalid": `{"kubeconfigSecret": "nonexistent"}`,
+		},
+	}
+
+	reg.reload(configMap)
+	member := reg.get("member")
+	if assert.NotNil(member) {
+		assert.Equal("https://member.example.com", member.Config.Host)
+		assert.Equal("foo", member.Config.BearerToken)
+		assert.Equal("30s", member.DefaultRequestTimeout.String())
+	}
+	assert.Nil(reg.get("invalid"))
+
+	// unchanged registrations keep the same config so that clients are not recreated
+	reg.reload(configMap)
+	assert.Same(member, reg.get("member"))
+
+	// rotated credentials are picked up on the next reload
+	_, err := client.CoreV1().Secrets("default").Update(context.Background(), kubeconfigSecret("bar"), metav1.UpdateOptions{})
+	assert.NoError(err)
+	reg.reload(configMap)
+	if rotated := reg.get("member"); assert.NotNil(rotated) {
+		assert.NotSame(member, rotated)
+		assert.Equal("bar", rotated.Config.BearerToken)
+	}
+
+	reg.reload(nil)
+	assert.Nil(reg.get("member"))
+}
@@ -16,15 +16,20 @@ package discovery
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sdiscovery "k8s.io/client-go/discovery"
 	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/kelemetry/pkg/k8s"
@@ -39,12 +44,22 @@ func init() {
 	}))
 }
 
+const invalidateQueueSize = 64
+
 type discoveryOptions struct {
 	resyncInterval time.Duration
+	cacheDir       string
 }
 
 func (options *discoveryOptions) Setup(fs *pflag.FlagSet) {
 	fs.DurationVar(&options.resyncInterval, "discovery-resync-interval", time.Hour, "frequency of refreshing discovery API")
+	fs.StringVar(
+		&options.cacheDir,
+		"discovery-cache-dir",
+		"",
+		"directory to persist discovery results in, so that restarts within --discovery-resync-interval "+
+			"do not query the full discovery API; disabled if empty",
+	)
 }
 
 func (options *discoveryOptions) EnableFlag() *bool { return nil }
@@ -69,6 +84,9 @@ type ClusterDiscoveryCache interface {
 	// AddResyncHandler adds a channel that sends when at least one GVR has changed.
 	// Should only be called during Init stage.
 	AddResyncHandler() <-chan struct{}
+	// InvalidateGroup requests refreshing the resources of a single API group asynchronously,
+	// e.g. when a CustomResourceDefinition of the group has changed.
+	InvalidateGroup(group string)
 }
 
 type discoveryCache struct {
@@ -82,7 +100,8 @@ type discoveryCache struct {
 	ctx    context.Context //nolint:containedctx
 	hasCtx chan struct{}
 
-	ResyncMetric *metrics.Metric[*resyncMetric]
+	ResyncMetric      *metrics.Metric[*resyncMetric]
+	GroupResyncMetric *metrics.Metric[*groupResyncMetric]
 
 	clusters sync.Map
 }
@@ -91,16 +110,21 @@ type clusterDiscoveryCache struct {
 	initLock sync.Once
 	initErr  error
 
-	options      *discoveryOptions
-	logger       logrus.FieldLogger
-	clock        clock.Clock
-	resyncMetric metrics.TaggedMetric
-	client       k8s.Client
+	options           *discoveryOptions
+	logger            logrus.FieldLogger
+	clock             clock.Clock
+	cluster           string
+	resyncMetric      *metrics.Metric[*resyncMetric]
+	groupResyncMetric *metrics.Metric[*groupResyncMetric]
+	client            k8s.Client
 
 	resyncRequestCh chan struct{}
+	invalidateCh    chan string
 	onResyncCh      []chan<- struct{}
 
-	dataLock   sync.RWMutex
+	dataLock sync.RWMutex
+	// the preferred resource lists, keyed by group
+	lists      map[string][]*metav1.APIResourceList
 	gvrDetails GvrDetails
 	gvrToGvk   GvrToGvk
 	gvkToGvr   GvkToGvr
@@ -108,13 +132,33 @@ type clusterDiscoveryCache struct {
 
 type resyncMetric struct {
 	Cluster string
+	// Whether the apiserver supports aggregated discovery, which returns all resources in a single response.
+	Aggregated bool
+	// Whether the results were loaded from --discovery-cache-dir.
+	Persisted bool
+	Error     metrics.LabeledError
 }
 
 func (*resyncMetric) MetricName() string { return "discovery_resync" }
 
+type groupResyncMetric struct {
+	Cluster string
+	Error   metrics.LabeledError
+}
+
+func (*groupResyncMetric) MetricName() string { return "discovery_group_resync" }
+
 func (dc *discoveryCache) Options() manager.Options { return &dc.options }
 
-func (dc *discoveryCache) Init() error { return nil }
+func (dc *discoveryCache) Init() error {
+	if dc.options.cacheDir != "" {
+		if err := os.MkdirAll(dc.options.cacheDir, 0o700); err != nil {
+			return fmt.Errorf("cannot create --discovery-cache-dir: %w", err)
+		}
+	}
+
+	return nil
+}
 
 func (dc *discoveryCache) Start(ctx context.Context) error {
 	dc.ctx = ctx
@@ -132,10 +176,11 @@ func (dc *discoveryCache) ForCluster(cluster string) (ClusterDiscoveryCache, err
 		cdc.logger = dc.Logger.WithField("cluster", cluster)
 		cdc.clock = dc.Clock
 		cdc.options = &dc.options
-		cdc.resyncMetric = dc.ResyncMetric.With(&resyncMetric{
-			Cluster: cluster,
-		})
+		cdc.cluster = cluster
+		cdc.resyncMetric = dc.ResyncMetric
+		cdc.groupResyncMetric = dc.GroupResyncMetric
 		cdc.resyncRequestCh = make(chan struct{}, 1)
+		cdc.invalidateCh = make(chan string, invalidateQueueSize)
 		cdc.client, cdc.initErr = dc.Clients.Cluster(cluster)
 		if cdc.initErr != nil {
 			return
@@ -153,70 +198,193 @@ func (dc *discoveryCache) ForCluster(cluster string) (ClusterDiscoveryCache, err
 func (cdc *clusterDiscoveryCache) run(ctx context.Context) {
 	defer shutdown.RecoverPanic(cdc.logger)
 
+	nextResync := time.Duration(0)
+	if age, loaded := cdc.loadPersisted(); loaded {
+		nextResync = cdc.options.resyncInterval - age
+	}
+
 	for {
-		if err := cdc.doResync(); err != nil {
-			cdc.logger.Error(err)
+		if nextResync <= 0 {
+			if err := cdc.doResync(); err != nil {
+				cdc.logger.Error(err)
+			}
+			nextResync = cdc.options.resyncInterval
 		}
 
+		waitStart := cdc.clock.Now()
+
 		select {
 		case <-ctx.Done():
 			return
-		case <-cdc.clock.After(cdc.options.resyncInterval):
+		case <-cdc.clock.After(nextResync):
+			nextResync = 0
 		case <-cdc.resyncRequestCh:
+			nextResync = 0
+		case group := <-cdc.invalidateCh:
+			if err := cdc.doGroupResync(group); err != nil {
+				cdc.logger.WithField("group", group).Error(err)
+			}
+			nextResync -= cdc.clock.Since(waitStart)
 		}
 	}
 }
 
 func (cdc *clusterDiscoveryCache) doResync() error {
-	defer cdc.resyncMetric.DeferCount(cdc.clock.Now())
+	metric := &resyncMetric{Cluster: cdc.cluster}
+	defer cdc.resyncMetric.DeferCount(cdc.clock.Now(), metric)
 
 	// TODO also sync non-target clusters
-	lists, err := cdc.client.KubernetesClient().Discovery().ServerPreferredResources()
+	client := &aggregatedDetector{
+		DiscoveryInterface: cdc.client.KubernetesClientFor(k8s.PurposeDiscovery).Discovery(),
+	}
+	lists, err := k8sdiscovery.ServerPreferredResources(client)
+	metric.Aggregated = client.aggregated
 	if err != nil {
+		metric.Error = metrics.LabelError(err, "Query")
 		return fmt.Errorf("query discovery API failed: %w", err)
 	}
 
-	gvrDetails := GvrDetails{}
-	gvrToGvk := GvrToGvk{}
-	gvkToGvr := GvkToGvr{}
-
+	byGroup := map[string][]*metav1.APIResourceList{}
 	for _, list := range lists {
-		listGroupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
 		if err != nil {
+			metric.Error = metrics.LabelError(err, "InvalidGroupVersion")
 			return fmt.Errorf("discovery API result contains invalid groupVersion: %w", err)
 		}
+		byGroup[gv.Group] = append(byGroup[gv.Group], list)
+	}
 
-		for _, res := range list.APIResources {
-			group := res.Group
-			if group == "" {
-				group = listGroupVersion.Group
-			}
+	if err := cdc.apply(byGroup); err != nil {
+		metric.Error = metrics.LabelError(err, "Apply")
+		return err
+	}
 
-			version := res.Version
-			if version == "" {
-				version = listGroupVersion.Version
+	cdc.persist()
+	return nil
+}
+
+// doGroupResync refreshes the preferred resources of a single group.
+func (cdc *clusterDiscoveryCache) doGroupResync(group string) error {
+	metric := &groupResyncMetric{Cluster: cdc.cluster}
+	defer cdc.groupResyncMetric.DeferCount(cdc.clock.Now(), metric)
+
+	if group == "" {
+		// the core group is served from a different path and never changes with CRDs
+		select {
+		case cdc.resyncRequestCh <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+
+	client := cdc.client.KubernetesClientFor(k8s.PurposeDiscovery).Discovery()
+
+	apiGroup := &metav1.APIGroup{}
+	err := client.RESTClient().Get().AbsPath("/apis", group).Do(context.Background()).Into(apiGroup)
+
+	var lists []*metav1.APIResourceList
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			metric.Error = metrics.LabelError(err, "QueryGroup")
+			return fmt.Errorf("query discovery API for group failed: %w", err)
+		}
+		// the group no longer exists
+	} else {
+		// select the first version of each resource in the order of server preference,
+		// consistent with ServerPreferredResources
+		seen := map[string]struct{}{}
+		for _, version := range apiGroup.Versions {
+			list, err := client.ServerResourcesForGroupVersion(version.GroupVersion)
+			if err != nil {
+				if k8serrors.IsNotFound(err) {
+					continue
+				}
+				metric.Error = metrics.LabelError(err, "QueryGroupVersion")
+				return fmt.Errorf("query discovery API for group version failed: %w", err)
 			}
 
-			gvr := schema.GroupVersionResource{
-				Group:    group,
-				Version:  version,
-				Resource: res.Name,
+			filtered := &metav1.APIResourceList{GroupVersion: list.GroupVersion}
+			for _, res := range list.APIResources {
+				if _, exists := seen[res.Name]; !exists {
+					seen[res.Name] = struct{}{}
+					filtered.APIResources = append(filtered.APIResources, res)
+				}
+			}
+			if len(filtered.APIResources) > 0 {
+				lists = append(lists, filtered)
 			}
-			gvk := schema.GroupVersionKind{
-				Group:   group,
-				Version: version,
-				Kind:    res.Kind,
+		}
+	}
+
+	cdc.dataLock.RLock()
+	byGroup := make(map[string][]*metav1.APIResourceList, len(cdc.lists)+1)
+	for otherGroup, otherLists := range cdc.lists {
+		byGroup[otherGroup] = otherLists
+	}
+	cdc.dataLock.RUnlock()
+
+	if len(lists) > 0 {
+		byGroup[group] = lists
+	} else {
+		delete(byGroup, group)
+	}
+
+	if err := cdc.apply(byGroup); err != nil {
+		metric.Error = metrics.LabelError(err, "Apply")
+		return err
+	}
+
+	cdc.logger.WithField("group", group).WithField("groupVersions", len(lists)).Info("refreshed discovery for group")
+	cdc.persist()
+	return nil
+}
+
+// apply replaces the cached resources and notifies resync handlers if any GVR has changed.
+func (cdc *clusterDiscoveryCache) apply(byGroup map[string][]*metav1.APIResourceList) error {
+	gvrDetails := GvrDetails{}
+	gvrToGvk := GvrToGvk{}
+	gvkToGvr := GvkToGvr{}
+
+	for _, lists := range byGroup {
+		for _, list := range lists {
+			listGroupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+			if err != nil {
+				return fmt.Errorf("discovery API result contains invalid groupVersion: %w", err)
 			}
 
-			resCopy := res
-			gvrDetails[gvr] = &resCopy
-			gvrToGvk[gvr] = gvk
-			gvkToGvr[gvk] = gvr
+			for _, res := range list.APIResources {
+				group := res.Group
+				if group == "" {
+					group = listGroupVersion.Group
+				}
+
+				version := res.Version
+				if version == "" {
+					version = listGroupVersion.Version
+				}
+
+				gvr := schema.GroupVersionResource{
+					Group:    group,
+					Version:  version,
+					Resource: res.Name,
+				}
+				gvk := schema.GroupVersionKind{
+					Group:   group,
+					Version: version,
+					Kind:    res.Kind,
+				}
+
+				resCopy := res
+				gvrDetails[gvr] = &resCopy
+				gvrToGvk[gvr] = gvk
+				gvkToGvr[gvk] = gvr
+			}
 		}
 	}
 
 	cdc.dataLock.Lock()
 	oldGvrToGvk := cdc.gvrToGvk
+	cdc.lists = byGroup
 	cdc.gvrToGvk = gvrToGvk
 	cdc.gvkToGvr = gvkToGvr
 	cdc.gvrDetails = gvrDetails
@@ -235,6 +403,104 @@ func (cdc *clusterDiscoveryCache) doResync() error {
 	return nil
 }
 
+// aggregatedDetector records whether the apiserver returned resources in the aggregated discovery format.
+// client-go requests the aggregated format and falls back to querying each group version otherwise.
+type aggregatedDetector struct {
+	k8sdiscovery.DiscoveryInterface
+	aggregated bool
+}
+
+func (detector *aggregatedDetector) GroupsAndMaybeResources() (
+	*metav1.APIGroupList,
+	map[schema.GroupVersion]*metav1.APIResourceList,
+	map[schema.GroupVersion]error,
+	error,
+) {
+	ad, ok := detector.DiscoveryInterface.(k8sdiscovery.AggregatedDiscoveryInterface)
+	if !ok {
+		groups, err := detector.ServerGroups()
+		return groups, nil, nil, err
+	}
+
+	groups, resources, failed, err := ad.GroupsAndMaybeResources()
+	detector.aggregated = resources != nil
+	return groups, resources, failed, err
+}
+
+type persistedDiscovery struct {
+	Time  time.Time                            `json:"time"`
+	Lists map[string][]*metav1.APIResourceList `json:"lists"`
+}
+
+func (cdc *clusterDiscoveryCache) persistPath() string {
+	return filepath.Join(cdc.options.cacheDir, cdc.cluster+".json")
+}
+
+// loadPersisted loads the discovery results persisted within the resync interval.
+func (cdc *clusterDiscoveryCache) loadPersisted() (age time.Duration, loaded bool) {
+	if cdc.options.cacheDir == "" {
+		return 0, false
+	}
+
+	metric := &resyncMetric{Cluster: cdc.cluster, Persisted: true}
+	defer cdc.resyncMetric.DeferCount(cdc.clock.Now(), metric)
+
+	data, err := os.ReadFile(cdc.persistPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cdc.logger.WithError(err).Warn("cannot read persisted discovery")
+		}
+		metric.Error = metrics.LabelError(err, "Read")
+		return 0, false
+	}
+
+	var persisted persistedDiscovery
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		cdc.logger.WithError(err).Warn("cannot decode persisted discovery")
+		metric.Error = metrics.LabelError(err, "Decode")
+		return 0, false
+	}
+
+	age = cdc.clock.Since(persisted.Time)
+	if age >= cdc.options.resyncInterval {
+		metric.Error = metrics.MakeLabeledError("Expired")
+		return 0, false
+	}
+
+	if err := cdc.apply(persisted.Lists); err != nil {
+		cdc.logger.WithError(err).Warn("cannot apply persisted discovery")
+		metric.Error = metrics.LabelError(err, "Apply")
+		return 0, false
+	}
+
+	cdc.logger.WithField("age", age).Info("loaded persisted discovery")
+	return age, true
+}
+
+func (cdc *clusterDiscoveryCache) persist() {
+	if cdc.options.cacheDir == "" {
+		return
+	}
+
+	cdc.dataLock.RLock()
+	data, err := json.Marshal(persistedDiscovery{Time: cdc.clock.Now(), Lists: cdc.lists})
+	cdc.dataLock.RUnlock()
+	if err != nil {
+		cdc.logger.WithError(err).Warn("cannot encode discovery for persistence")
+		return
+	}
+
+	// write to a temporary file first so that a crash does not leave a truncated file
+	tmpPath := cdc.persistPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		cdc.logger.WithError(err).Warn("cannot persist discovery")
+		return
+	}
+	if err := os.Rename(tmpPath, cdc.persistPath()); err != nil {
+		cdc.logger.WithError(err).Warn("cannot persist discovery")
+	}
+}
+
 func haveSameKeys(m1, m2 GvrToGvk) bool {
 	if len(m1) != len(m2) {
 		return false
@@ -301,6 +567,18 @@ func (cdc *clusterDiscoveryCache) RequestAndWaitResync() {
 	cdc.clock.Sleep(time.Second * 5) // FIXME: notify resync completion from doResync
 }
 
+func (cdc *clusterDiscoveryCache) InvalidateGroup(group string) {
+	select {
+	case cdc.invalidateCh <- group:
+	default:
+		// too many pending invalidations, resync everything instead
+		select {
+		case cdc.resyncRequestCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
 func (cdc *clusterDiscoveryCache) AddResyncHandler() <-chan struct{} {
 	ch := make(chan struct{}, 1)
 	cdc.onResyncCh = append(cdc.onResyncCh, ch)
@@ -0,0 +1,74 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func newTestCache(t *testing.T, clock *clocktesting.FakeClock, dir string) *clusterDiscoveryCache {
+	metricsClient, _ := metrics.NewMock(clock)
+	return &clusterDiscoveryCache{
+		options:      &discoveryOptions{resyncInterval: time.Hour, cacheDir: dir},
+		logger:       logrus.New(),
+		clock:        clock,
+		cluster:      "member",
+		resyncMetric: metrics.New[*resyncMetric](metricsClient),
+	}
+}
+
+func TestPersistDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Unix(1700000000, 0))
+	dir := t.TempDir()
+
+	cdc := newTestCache(t, clock, dir)
+	onResync := cdc.AddResyncHandler()
+
+	assert.NoError(cdc.apply(map[string][]*metav1.APIResourceList{
+		"":            {{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods", Kind: "Pod"}}}},
+		"example.com": {{GroupVersion: "example.com/v1", APIResources: []metav1.APIResource{{Name: "widgets", Kind: "Widget"}}}},
+	}))
+	assert.Len(onResync, 1)
+	cdc.persist()
+
+	clock.Step(time.Minute * 10)
+
+	restored := newTestCache(t, clock, dir)
+	age, loaded := restored.loadPersisted()
+	assert.True(loaded)
+	assert.Equal(time.Minute*10, age)
+
+	gvk, exists := restored.gvrToGvk[schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}]
+	assert.True(exists)
+	assert.Equal("Widget", gvk.Kind)
+	assert.Len(restored.GetAll(), 2)
+
+	clock.Step(time.Hour)
+
+	expired := newTestCache(t, clock, dir)
+	_, loaded = expired.loadPersisted()
+	assert.False(loaded)
+}
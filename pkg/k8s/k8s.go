@@ -18,6 +18,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -33,6 +34,7 @@ import (
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
 
 	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
@@ -50,6 +52,12 @@ type options struct {
 	targetRestBurst int
 	otherRestQps    float32
 	otherRestBurst  int
+
+	clusterRestQps        map[string]string
+	clusterRestBurst      map[string]string
+	clusterFlowSchemaUser map[string]string
+
+	protobuf bool
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
@@ -64,6 +72,37 @@ func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.IntVar(&options.targetRestBurst, "kube-target-rest-burst", 10, "k8s rest client burst for the target cluster")
 	fs.Float32Var(&options.otherRestQps, "kube-other-rest-qps", 10.0, "k8s rest client qps for non-target clusters")
 	fs.IntVar(&options.otherRestBurst, "kube-other-rest-burst", 10, "k8s rest client burst for non-target clusters")
+	fs.StringToStringVar(
+		&options.clusterRestQps,
+		"kube-cluster-rest-qps",
+		map[string]string{},
+		"k8s rest client qps overriding --kube-target-rest-qps and --kube-other-rest-qps, "+
+			"keyed by 'cluster' or 'cluster/purpose', where purpose is one of default, discovery, informer and object-fetch; "+
+			"each purpose of each cluster is rate limited separately, e.g. 'big-cluster=50,big-cluster/informer=100'",
+	)
+	fs.StringToStringVar(
+		&options.clusterRestBurst,
+		"kube-cluster-rest-burst",
+		map[string]string{},
+		"k8s rest client burst overriding --kube-target-rest-burst and --kube-other-rest-burst, keyed in the same way as --kube-cluster-rest-qps",
+	)
+	fs.StringToStringVar(
+		&options.clusterFlowSchemaUser,
+		"kube-cluster-flow-schema-user",
+		map[string]string{},
+		"user to impersonate for requests, keyed in the same way as --kube-cluster-rest-qps, "+
+			"so that API priority and fairness flow schemas can match requests of each purpose by user; "+
+			"requires the impersonate permission and the impersonated user must be authorized for the requests",
+	)
+	fs.BoolVar(
+		&options.protobuf,
+		"kube-protobuf-enable",
+		true,
+		"request built-in resources in protobuf instead of JSON to reduce encoding and decoding costs; "+
+			"custom resources are always requested in JSON; "+
+			"fields unknown to the compiled client are dropped from objects of built-in resources, "+
+			"so disable this option if the apiservers are much newer than Kelemetry",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return nil }
@@ -75,8 +114,13 @@ type Clients interface {
 
 type Client interface {
 	ClusterName() string
+	// DynamicClient is equivalent to DynamicClientFor(PurposeDefault).
 	DynamicClient() dynamic.Interface
+	// KubernetesClient is equivalent to KubernetesClientFor(PurposeDefault).
 	KubernetesClient() kubernetes.Interface
+	DynamicClientFor(purpose Purpose) dynamic.Interface
+	KubernetesClientFor(purpose Purpose) kubernetes.Interface
+	// InformerFactory and NewInformerFactory create informers with the PurposeInformer client.
 	InformerFactory() informers.SharedInformerFactory
 	NewInformerFactory(options ...informers.SharedInformerOption) informers.SharedInformerFactory
 	EventRecorder(name string) record.EventRecorder
@@ -87,6 +131,8 @@ type clusterClients struct {
 	Logger  logrus.FieldLogger
 	Config  k8sconfig.Config
 
+	limits restLimits
+
 	clientsLock  sync.RWMutex
 	clients      map[string]*client
 	targetClient Client
@@ -95,12 +141,19 @@ type clusterClients struct {
 }
 
 type client struct {
-	name             string
+	name string
+	// the cluster config from which the client was created, compared to detect registration changes.
+	cluster          *k8sconfig.Cluster
+	purposes         map[Purpose]*purposeClient
+	informerFactory  informers.SharedInformerFactory
+	eventBroadcaster record.EventBroadcaster
+}
+
+// purposeClient has its own rate limiter.
+type purposeClient struct {
 	restConfig       *rest.Config
 	dynamicClient    dynamic.Interface
 	kubernetesClient *kubernetes.Clientset
-	informerFactory  informers.SharedInformerFactory
-	eventBroadcaster record.EventBroadcaster
 }
 
 func (clients *clusterClients) Options() manager.Options {
@@ -111,6 +164,15 @@ func (clients *clusterClients) Init() error {
 	klog.SetLogger(logWrapper(clients.Logger))
 
 	var err error
+	clients.limits, err = parseRestLimits(
+		clients.options.clusterRestQps,
+		clients.options.clusterRestBurst,
+		clients.options.clusterFlowSchemaUser,
+	)
+	if err != nil {
+		return err
+	}
+
 	clients.targetClient, err = clients.Cluster(clients.Config.TargetName())
 	if err != nil {
 		return err
@@ -137,16 +199,58 @@ func (clients *clusterClients) Close(ctx context.Context) error {
 	return nil
 }
 
-func (clients *clusterClients) tryCluster(name string) (Client, bool) {
+// CheckReadiness reports clusters with informers that have not synced.
+func (clients *clusterClients) CheckReadiness(ctx context.Context) error {
+	if atomic.LoadInt32(&clients.started) == 0 {
+		return fmt.Errorf("informers have not synced yet")
+	}
+
+	// do not wait for the informers to sync, only check their current state
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	clients.clientsLock.RLock()
+	defer clients.clientsLock.RUnlock()
+
+	unsynced := []string{}
+	for name, client := range clients.clients {
+		if client.informerFactory == nil {
+			continue
+		}
+
+		for ty, synced := range client.informerFactory.WaitForCacheSync(stopCh) {
+			if !synced {
+				unsynced = append(unsynced, fmt.Sprintf("%s/%v", name, ty))
+			}
+		}
+	}
+
+	if len(unsynced) > 0 {
+		sort.Strings(unsynced)
+		return fmt.Errorf("informers have not synced: %s", strings.Join(unsynced, ", "))
+	}
+
+	return nil
+}
+
+func (clients *clusterClients) tryCluster(name string, cluster *k8sconfig.Cluster) (Client, bool) {
 	clients.clientsLock.RLock()
 	defer clients.clientsLock.RUnlock()
 
 	client, exists := clients.clients[name]
-	return client, exists
+	if !exists || client.cluster != cluster {
+		return nil, false
+	}
+	return client, true
 }
 
+// Cluster returns the client for a cluster.
+// Clusters registered dynamically may be added, updated or removed at runtime,
+// in which case the cached client is recreated or removed.
 func (clients *clusterClients) Cluster(name string) (Client, error) {
-	if client, exists := clients.tryCluster(name); exists {
+	cluster := clients.Config.Provide(name)
+
+	if client, exists := clients.tryCluster(name, cluster); exists {
 		return client, nil
 	}
 
@@ -154,57 +258,88 @@ func (clients *clusterClients) Cluster(name string) (Client, error) {
 	defer clients.clientsLock.Unlock()
 
 	client, exists := clients.clients[name]
-	if exists {
+	if exists && client.cluster == cluster {
 		return client, nil
 	}
 
-	client, err := clients.newClient(name)
-	if err != nil {
-		return nil, err
+	if exists {
+		client.eventBroadcaster.Shutdown()
+		delete(clients.clients, name)
 	}
-	clients.clients[name] = client
-	return client, nil
-}
 
-func (clients *clusterClients) newClient(name string) (*client, error) {
-	cluster := clients.Config.Provide(name)
 	if cluster == nil {
 		return nil, fmt.Errorf("cluster %q is not available", name)
 	}
 
-	config := rest.CopyConfig(cluster.Config)
-	config.QPS = clients.options.otherRestQps
-	config.Burst = clients.options.otherRestBurst
-
-	if name == clients.Config.TargetName() {
-		config.QPS = clients.options.targetRestQps
-		config.Burst = clients.options.targetRestBurst
+	client, err := clients.newClient(name, cluster)
+	if err != nil {
+		return nil, err
 	}
+	clients.clients[name] = client
+	return client, nil
+}
 
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("dynamic client creation failed: %w", err)
+func (clients *clusterClients) newClient(name string, cluster *k8sconfig.Cluster) (*client, error) {
+	base := restLimit{qps: clients.options.otherRestQps, burst: clients.options.otherRestBurst}
+	if name == clients.Config.TargetName() {
+		base = restLimit{qps: clients.options.targetRestQps, burst: clients.options.targetRestBurst}
 	}
 
-	kubernetesClient, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("kubernetes client creation failed: %w", err)
+	purposeClients := make(map[Purpose]*purposeClient, len(purposes))
+	for _, purpose := range purposes {
+		config := rest.CopyConfig(cluster.Config)
+		clients.limits.get(name, purpose, base).apply(config)
+
+		dynamicConfig := rest.CopyConfig(config)
+		if clients.options.protobuf && dynamicConfig.QPS > 0 {
+			// share the rate limit between JSON and protobuf requests
+			dynamicConfig.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(dynamicConfig.QPS, dynamicConfig.Burst)
+		}
+
+		jsonDynamicClient, err := dynamic.NewForConfig(dynamicConfig)
+		if err != nil {
+			return nil, fmt.Errorf("dynamic client creation failed: %w", err)
+		}
+
+		var dynamicClient dynamic.Interface = jsonDynamicClient
+
+		kubernetesConfig := config
+		if clients.options.protobuf {
+			kubernetesConfig = withProtobuf(config)
+
+			dynamicClient, err = newProtobufDynamicClient(dynamicConfig, jsonDynamicClient)
+			if err != nil {
+				return nil, fmt.Errorf("protobuf dynamic client creation failed: %w", err)
+			}
+		}
+
+		kubernetesClient, err := kubernetes.NewForConfig(kubernetesConfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes client creation failed: %w", err)
+		}
+
+		purposeClients[purpose] = &purposeClient{
+			restConfig:       config,
+			dynamicClient:    dynamicClient,
+			kubernetesClient: kubernetesClient,
+		}
 	}
 
 	var informerFactory informers.SharedInformerFactory
 	if atomic.LoadInt32(&clients.started) == 0 {
 		// we do not support using informers on clusters created after start
-		informerFactory = informers.NewSharedInformerFactory(kubernetesClient, 0)
+		informerFactory = informers.NewSharedInformerFactory(purposeClients[PurposeInformer].kubernetesClient, 0)
 	}
 
 	broadcaster := record.NewBroadcaster()
-	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{Interface: kubernetesClient.CoreV1().Events("")})
+	broadcaster.StartRecordingToSink(&corev1client.EventSinkImpl{
+		Interface: purposeClients[PurposeDefault].kubernetesClient.CoreV1().Events(""),
+	})
 
 	return &client{
 		name:             name,
-		restConfig:       config,
-		dynamicClient:    dynamicClient,
-		kubernetesClient: kubernetesClient,
+		cluster:          cluster,
+		purposes:         purposeClients,
 		informerFactory:  informerFactory,
 		eventBroadcaster: broadcaster,
 	}, nil
@@ -219,11 +354,19 @@ func (client *client) ClusterName() string {
 }
 
 func (client *client) DynamicClient() dynamic.Interface {
-	return client.dynamicClient
+	return client.DynamicClientFor(PurposeDefault)
 }
 
 func (client *client) KubernetesClient() kubernetes.Interface {
-	return client.kubernetesClient
+	return client.KubernetesClientFor(PurposeDefault)
+}
+
+func (client *client) DynamicClientFor(purpose Purpose) dynamic.Interface {
+	return client.purposes[purpose].dynamicClient
+}
+
+func (client *client) KubernetesClientFor(purpose Purpose) kubernetes.Interface {
+	return client.purposes[purpose].kubernetesClient
 }
 
 func (client *client) InformerFactory() informers.SharedInformerFactory {
@@ -235,7 +378,7 @@ func (client *client) InformerFactory() informers.SharedInformerFactory {
 }
 
 func (client *client) NewInformerFactory(options ...informers.SharedInformerOption) informers.SharedInformerFactory {
-	return informers.NewSharedInformerFactoryWithOptions(client.kubernetesClient, 0, options...)
+	return informers.NewSharedInformerFactoryWithOptions(client.purposes[PurposeInformer].kubernetesClient, 0, options...)
 }
 
 func (client *client) EventRecorder(name string) record.EventRecorder {
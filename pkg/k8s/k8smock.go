@@ -98,6 +98,14 @@ func (client *MockClient) KubernetesClient() kubernetes.Interface {
 	return client.k8sClient
 }
 
+func (client *MockClient) DynamicClientFor(purpose Purpose) dynamic.Interface {
+	return client.DynamicClient()
+}
+
+func (client *MockClient) KubernetesClientFor(purpose Purpose) kubernetes.Interface {
+	return client.KubernetesClient()
+}
+
 func (client *MockClient) InformerFactory() informers.SharedInformerFactory {
 	panic("not yet implemented")
 }
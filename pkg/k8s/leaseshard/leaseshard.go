@@ -0,0 +1,387 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Distributes a fixed number of shards across replicas using one Lease object per shard.
+//
+// The holder identity of each lease contains the advertised address of the owner,
+// so that replicas can route shard-specific work to the owner of the shard.
+//
+// Each replica also maintains a membership lease to count the live replicas.
+// A replica owns at most ceil(shards / replicas) shards and releases the shards above this fair share,
+// so that shards are rebalanced when replicas join or leave.
+package leaseshard
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/utils/clock"
+	"k8s.io/utils/ptr"
+)
+
+type ShardId int32
+
+// memberLabel is the label of membership leases, valued with the lease name prefix of the shards.
+const memberLabel = "kelemetry.kubewharf.io/leaseshard-member"
+
+type Config struct {
+	// Namespace of the lease objects.
+	Namespace string
+	// Lease object name prefix, to be appended with the shard number.
+	Name string
+	// Host:port at which other replicas can reach this replica.
+	AdvertiseAddress string
+	// Duration after which a lease that was not renewed can be taken over by another replica.
+	LeaseDuration time.Duration
+	// Interval between lease renew/acquire attempts.
+	RetryPeriod time.Duration
+}
+
+type Shards struct {
+	config   Config
+	logger   logrus.FieldLogger
+	clock    clock.Clock
+	leases   coordinationv1client.LeaseInterface
+	uid      types.UID
+	identity string
+
+	numShards int32
+	// number of live replicas observed from membership leases, including this replica
+	replicas int
+
+	mu     sync.RWMutex
+	owned  map[ShardId]*coordinationv1.Lease
+	owners map[ShardId]string
+}
+
+func New(
+	config Config,
+	logger logrus.FieldLogger,
+	clock clock.Clock,
+	leases coordinationv1client.LeaseInterface,
+) *Shards {
+	uid := uuid.NewUUID()
+	return &Shards{
+		config:   config,
+		logger:   logger,
+		clock:    clock,
+		leases:   leases,
+		uid:      uid,
+		identity: fmt.Sprintf("%s_%s", config.AdvertiseAddress, uid),
+		replicas: 1,
+		owned:    map[ShardId]*coordinationv1.Lease{},
+		owners:   map[ShardId]string{},
+	}
+}
+
+// Run renews and acquires leases for shards [0, numShards) until ctx is canceled,
+// then releases all owned leases.
+func (shards *Shards) Run(ctx context.Context, numShards int32) {
+	shards.numShards = numShards
+
+	wait.UntilWithContext(ctx, shards.syncAll, shards.config.RetryPeriod)
+
+	shards.releaseAll()
+}
+
+func (shards *Shards) syncAll(ctx context.Context) {
+	if err := shards.syncMembers(ctx); err != nil {
+		shards.logger.WithError(err).Warn("cannot sync membership leases")
+	}
+
+	for shard := int32(0); shard < shards.numShards; shard++ {
+		if err := shards.sync(ctx, ShardId(shard)); err != nil {
+			shards.logger.WithField("shard", shard).WithError(err).Warn("cannot sync shard lease")
+		}
+	}
+
+	shards.releaseExcess(ctx)
+}
+
+// NumOwned returns the number of shards currently owned by this replica.
+func (shards *Shards) NumOwned() int {
+	shards.mu.RLock()
+	defer shards.mu.RUnlock()
+	return len(shards.owned)
+}
+
+// Route returns the address of the replica owning the shard.
+// Returns an empty string if the shard is owned by this replica or has no known owner.
+func (shards *Shards) Route(shard ShardId) string {
+	shards.mu.RLock()
+	defer shards.mu.RUnlock()
+
+	holder := shards.owners[shard]
+	if holder == "" || holder == shards.identity {
+		return ""
+	}
+
+	address, _, _ := strings.Cut(holder, "_")
+	return address
+}
+
+func (shards *Shards) leaseName(shard ShardId) string {
+	return fmt.Sprintf("%s-%d", shards.config.Name, shard)
+}
+
+func (shards *Shards) memberLeaseName() string {
+	return fmt.Sprintf("%s-member-%s", shards.config.Name, shards.uid)
+}
+
+// syncMembers renews the membership lease of this replica and counts the replicas with unexpired membership leases.
+// Expired membership leases of replicas that did not shut down gracefully are deleted.
+func (shards *Shards) syncMembers(ctx context.Context) error {
+	lease, err := shards.leases.Get(ctx, shards.memberLeaseName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      shards.memberLeaseName(),
+				Namespace: shards.config.Namespace,
+				Labels:    map[string]string{memberLabel: shards.config.Name},
+			},
+		}
+		shards.fillSpec(lease, true)
+
+		if _, err := shards.leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("cannot create membership lease: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("cannot get membership lease: %w", err)
+	} else {
+		shards.fillSpec(lease, false)
+		if _, err := shards.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("cannot renew membership lease: %w", err)
+		}
+	}
+
+	members, err := shards.leases.List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{memberLabel: shards.config.Name},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list membership leases: %w", err)
+	}
+
+	replicas := 0
+	for i := range members.Items {
+		member := &members.Items[i]
+		if !shards.expired(member) {
+			replicas++
+			continue
+		}
+
+		err := shards.leases.Delete(ctx, member.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{ResourceVersion: &member.ResourceVersion},
+		})
+		if err != nil && !k8serrors.IsNotFound(err) && !k8serrors.IsConflict(err) {
+			shards.logger.WithField("lease", member.Name).WithError(err).Warn("cannot delete expired membership lease")
+		}
+	}
+
+	shards.mu.Lock()
+	defer shards.mu.Unlock()
+	shards.replicas = max(replicas, 1)
+
+	return nil
+}
+
+// fairShare returns the maximum number of shards this replica should own.
+// Must be called with shards.mu held.
+func (shards *Shards) fairShare() int {
+	return int((shards.numShards + int32(shards.replicas) - 1) / int32(shards.replicas))
+}
+
+func (shards *Shards) sync(ctx context.Context, shard ShardId) error {
+	lease, err := shards.leases.Get(ctx, shards.leaseName(shard), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		if !shards.canAcquire(shard) {
+			return nil
+		}
+
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      shards.leaseName(shard),
+				Namespace: shards.config.Namespace,
+			},
+		}
+		shards.fillSpec(lease, true)
+
+		lease, err = shards.leases.Create(ctx, lease, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("cannot create lease: %w", err)
+		}
+
+		shards.setOwner(shard, lease)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot get lease: %w", err)
+	}
+
+	holder := ptr.Deref(lease.Spec.HolderIdentity, "")
+
+	if holder == shards.identity {
+		shards.fillSpec(lease, false)
+		lease, err = shards.leases.Update(ctx, lease, metav1.UpdateOptions{})
+		if err != nil {
+			shards.setOwner(shard, nil)
+			return fmt.Errorf("cannot renew lease: %w", err)
+		}
+
+		shards.setOwner(shard, lease)
+		return nil
+	}
+
+	if holder != "" && !shards.expired(lease) {
+		shards.setObserved(shard, holder)
+		return nil
+	}
+
+	if !shards.canAcquire(shard) {
+		shards.setObserved(shard, "")
+		return nil
+	}
+
+	shards.fillSpec(lease, true)
+	lease, err = shards.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		if k8serrors.IsConflict(err) {
+			return nil // another replica acquired it first
+		}
+		return fmt.Errorf("cannot acquire lease: %w", err)
+	}
+
+	shards.logger.WithField("shard", shard).Info("acquired shard lease")
+	shards.setOwner(shard, lease)
+	return nil
+}
+
+func (shards *Shards) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil {
+		return true
+	}
+
+	duration := time.Duration(ptr.Deref(lease.Spec.LeaseDurationSeconds, 0)) * time.Second
+	return lease.Spec.RenewTime.Add(duration).Before(shards.clock.Now())
+}
+
+func (shards *Shards) canAcquire(shard ShardId) bool {
+	shards.mu.RLock()
+	defer shards.mu.RUnlock()
+
+	if _, owned := shards.owned[shard]; owned {
+		return true
+	}
+
+	return len(shards.owned) < shards.fairShare()
+}
+
+func (shards *Shards) fillSpec(lease *coordinationv1.Lease, acquire bool) {
+	now := metav1.NewMicroTime(shards.clock.Now())
+
+	lease.Spec.HolderIdentity = ptr.To(shards.identity)
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(shards.config.LeaseDuration.Seconds()))
+	lease.Spec.RenewTime = &now
+	if acquire {
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions = ptr.To(ptr.Deref(lease.Spec.LeaseTransitions, 0) + 1)
+	}
+}
+
+func (shards *Shards) setOwner(shard ShardId, lease *coordinationv1.Lease) {
+	shards.mu.Lock()
+	defer shards.mu.Unlock()
+
+	if lease == nil {
+		delete(shards.owned, shard)
+		delete(shards.owners, shard)
+		return
+	}
+
+	shards.owned[shard] = lease
+	shards.owners[shard] = shards.identity
+}
+
+func (shards *Shards) setObserved(shard ShardId, holder string) {
+	shards.mu.Lock()
+	defer shards.mu.Unlock()
+
+	if _, wasOwned := shards.owned[shard]; wasOwned {
+		shards.logger.WithField("shard", shard).WithField("holder", holder).Warn("lost shard lease")
+		delete(shards.owned, shard)
+	}
+
+	shards.owners[shard] = holder
+}
+
+// releaseExcess steps down from the owned shards above the fair share,
+// so that replicas that joined later can acquire them.
+func (shards *Shards) releaseExcess(ctx context.Context) {
+	shards.mu.Lock()
+	excess := map[ShardId]*coordinationv1.Lease{}
+	// release the shards with the highest IDs so that the retained shards are stable across iterations
+	for shard := ShardId(shards.numShards - 1); shard >= 0 && len(shards.owned) > shards.fairShare(); shard-- {
+		if lease, owned := shards.owned[shard]; owned {
+			excess[shard] = lease
+			delete(shards.owned, shard)
+			shards.owners[shard] = ""
+		}
+	}
+	replicas := shards.replicas
+	shards.mu.Unlock()
+
+	for shard, lease := range excess {
+		shards.logger.WithField("shard", shard).WithField("replicas", replicas).Info("releasing shard lease above fair share")
+		shards.release(ctx, shard, lease)
+	}
+}
+
+// releaseAll voluntarily steps down from all owned shards so that other replicas can take over immediately.
+// The membership lease is also deleted so that other replicas increase their fair share.
+func (shards *Shards) releaseAll() {
+	shards.mu.Lock()
+	owned := shards.owned
+	shards.owned = map[ShardId]*coordinationv1.Lease{}
+	shards.mu.Unlock()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), shards.config.RetryPeriod)
+	defer cancelFunc()
+
+	if err := shards.leases.Delete(ctx, shards.memberLeaseName(), metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		shards.logger.WithError(err).Warn("cannot delete membership lease")
+	}
+
+	for shard, lease := range owned {
+		shards.release(ctx, shard, lease)
+	}
+}
+
+func (shards *Shards) release(ctx context.Context, shard ShardId, lease *coordinationv1.Lease) {
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.LeaseDurationSeconds = ptr.To(int32(1))
+	if _, err := shards.leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		shards.logger.WithField("shard", shard).WithError(err).Warn("cannot release shard lease")
+	}
+}
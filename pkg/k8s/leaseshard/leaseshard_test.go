@@ -0,0 +1,85 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leaseshard
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestShardsBalanceAndTakeover(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	clock := clocktesting.NewFakeClock(time.Unix(1000, 0))
+	leases := fake.NewSimpleClientset().CoordinationV1().Leases("default")
+
+	newShards := func(address string) *Shards {
+		shards := New(Config{
+			Namespace:        "default",
+			Name:             "test",
+			AdvertiseAddress: address,
+			LeaseDuration:    time.Second * 15,
+			RetryPeriod:      time.Second,
+		}, logrus.New(), clock, leases)
+		shards.numShards = 4
+		return shards
+	}
+
+	a := newShards("a:80")
+	a.syncAll(ctx)
+	assert.Equal(4, a.NumOwned())
+
+	// b joins, so a releases the shards above its fair share for b to acquire
+	b := newShards("b:80")
+	b.syncAll(ctx)
+	assert.Equal(0, b.NumOwned())
+	a.syncAll(ctx)
+	assert.Equal(2, a.NumOwned())
+	b.syncAll(ctx)
+	assert.Equal(2, b.NumOwned())
+	a.syncAll(ctx)
+	assert.Equal(2, a.NumOwned())
+
+	for shard := ShardId(0); shard < 4; shard++ {
+		if a.Route(shard) == "" {
+			assert.Equal("a:80", b.Route(shard))
+		} else {
+			assert.Equal("b:80", a.Route(shard))
+			assert.Equal("", b.Route(shard))
+		}
+	}
+
+	// b stops renewing, so a takes over its shards after they expire
+	clock.Step(time.Second * 16)
+	a.syncAll(ctx)
+
+	assert.Equal(4, a.NumOwned())
+	for shard := ShardId(0); shard < 4; shard++ {
+		assert.Equal("", a.Route(shard))
+	}
+
+	// the expired membership lease of b is deleted
+	members, err := leases.List(ctx, metav1.ListOptions{LabelSelector: memberLabel + "=test"})
+	assert.NoError(err)
+	assert.Len(members.Items, 1)
+}
@@ -30,6 +30,7 @@ import (
 
 	diffcache "github.com/kubewharf/kelemetry/pkg/diff/cache"
 	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterhealth"
 	"github.com/kubewharf/kelemetry/pkg/manager"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
@@ -60,6 +61,7 @@ type ObjectCache struct {
 	Clients   k8s.Clients
 	Metrics   metrics.Client
 	DiffCache diffcache.Cache
+	Health    *clusterhealth.Health
 
 	CacheRequestMetric *metrics.Metric[*CacheRequestMetric]
 
@@ -82,6 +84,11 @@ type CacheRequestMetric struct {
 
 func (*CacheRequestMetric) MetricName() string { return "object_cache_request" }
 
+var (
+	_ manager.StatusReporter = &ObjectCache{}
+	_ manager.CacheFlusher   = &ObjectCache{}
+)
+
 func (oc *ObjectCache) Options() manager.Options { return &oc.options }
 
 func (oc *ObjectCache) Init() error {
@@ -95,6 +102,18 @@ func (oc *ObjectCache) Start(ctx context.Context) error { return nil }
 
 func (oc *ObjectCache) Close(ctx context.Context) error { return nil }
 
+func (oc *ObjectCache) Status() map[string]any {
+	return map[string]any{
+		"entries":   oc.cache.EntryCount(),
+		"evictions": oc.cache.EvacuateCount(),
+	}
+}
+
+func (oc *ObjectCache) FlushCache(ctx context.Context) error {
+	oc.cache.Clear()
+	return nil
+}
+
 func (oc *ObjectCache) Get(ctx context.Context, object utilobject.VersionedKey) (*unstructured.Unstructured, error) {
 	metric := &CacheRequestMetric{Cluster: object.Cluster, Error: "Unknown"}
 	defer oc.CacheRequestMetric.DeferCount(oc.Clock.Now(), metric)
@@ -127,6 +146,11 @@ func (oc *ObjectCache) Get(ctx context.Context, object utilobject.VersionedKey)
 				}
 			}()
 
+			if !oc.Health.Allow(object.Cluster) {
+				metric.Error = "CircuitOpen"
+				return nil, clusterhealth.ErrCircuitOpen
+			}
+
 			value, err, metricCode := oc.penetrate(fetchCtx, object)
 			metric.Error = metricCode
 			if err != nil {
@@ -181,7 +205,7 @@ func (oc *ObjectCache) penetrate(
 		return nil, fmt.Errorf("cannot initialize clients for cluster %q: %w", object.Cluster, err), "UnknownCluster"
 	}
 
-	nsClient := clusterClient.DynamicClient().Resource(object.GroupVersionResource())
+	nsClient := clusterClient.DynamicClientFor(k8s.PurposeObjectFetch).Resource(object.GroupVersionResource())
 	var client dynamic.ResourceInterface = nsClient
 	if object.Namespace != "" {
 		client = nsClient.Namespace(object.Namespace)
@@ -190,6 +214,7 @@ func (oc *ObjectCache) penetrate(
 	raw, err := client.Get(ctx, object.Name, metav1.GetOptions{
 		ResourceVersion: "0",
 	})
+	oc.Health.Report(object.Cluster, err)
 	if err != nil && !k8serrors.IsNotFound(err) {
 		return nil, err, string(k8serrors.ReasonForError(err))
 	}
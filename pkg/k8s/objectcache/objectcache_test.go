@@ -27,6 +27,7 @@ import (
 	"k8s.io/utils/clock"
 
 	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/clusterhealth"
 	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
 	"github.com/kubewharf/kelemetry/pkg/metrics"
 	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
@@ -64,6 +65,7 @@ func TestGet(t *testing.T) {
 		},
 		Metrics:            metricsClient,
 		DiffCache:          nil, // TODO
+		Health:             &clusterhealth.Health{},
 		CacheRequestMetric: metrics.New[*objectcache.CacheRequestMetric](metricsClient),
 	}
 
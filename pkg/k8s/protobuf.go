@@ -0,0 +1,270 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// withProtobuf returns a copy of the config that requests protobuf,
+// which the apiserver only serves for built-in types.
+func withProtobuf(config *rest.Config) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.ContentType = runtime.ContentTypeProtobuf
+	config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	return config
+}
+
+// protobufDynamicClient serves get, list and watch requests for built-in resources over protobuf
+// and converts the typed objects to unstructured objects.
+// Requests for other resources and write requests are delegated to the JSON dynamic client.
+//
+// Fields unknown to the built-in scheme of this binary are dropped during decoding,
+// so protobuf should be disabled if the apiserver is much newer than the compiled client.
+type protobufDynamicClient struct {
+	json       dynamic.Interface
+	config     *rest.Config
+	httpClient *http.Client
+
+	clientsMu sync.Mutex
+	clients   map[schema.GroupVersion]rest.Interface
+}
+
+// newProtobufDynamicClient creates a protobuf dynamic client.
+// All group versions share the rate limiter of the config, or a new rate limiter if the config has none.
+func newProtobufDynamicClient(config *rest.Config, json dynamic.Interface) (*protobufDynamicClient, error) {
+	config = withProtobuf(config)
+	config.NegotiatedSerializer = scheme.Codecs.WithoutConversion()
+	if config.RateLimiter == nil && config.QPS > 0 {
+		config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(config.QPS, config.Burst)
+	}
+
+	httpClient, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &protobufDynamicClient{
+		json:       json,
+		config:     config,
+		httpClient: httpClient,
+		clients:    map[schema.GroupVersion]rest.Interface{},
+	}, nil
+}
+
+func (client *protobufDynamicClient) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	json := client.json.Resource(gvr)
+
+	if !scheme.Scheme.IsVersionRegistered(gvr.GroupVersion()) {
+		return json
+	}
+
+	restClient, err := client.restClientFor(gvr.GroupVersion())
+	if err != nil {
+		return json
+	}
+
+	return &protobufNamespaceableResource{
+		protobufResource: protobufResource{
+			ResourceInterface: json,
+			client:            restClient,
+			gv:                gvr.GroupVersion(),
+			resource:          gvr.Resource,
+		},
+		json: json,
+	}
+}
+
+func (client *protobufDynamicClient) restClientFor(gv schema.GroupVersion) (rest.Interface, error) {
+	client.clientsMu.Lock()
+	defer client.clientsMu.Unlock()
+
+	if restClient, exists := client.clients[gv]; exists {
+		return restClient, nil
+	}
+
+	config := rest.CopyConfig(client.config)
+	config.GroupVersion = &gv
+	if gv.Group == "" {
+		config.APIPath = "/api"
+	} else {
+		config.APIPath = "/apis"
+	}
+
+	restClient, err := rest.RESTClientForConfigAndClient(config, client.httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	client.clients[gv] = restClient
+	return restClient, nil
+}
+
+type protobufNamespaceableResource struct {
+	protobufResource
+	json dynamic.NamespaceableResourceInterface
+}
+
+func (resource *protobufNamespaceableResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &protobufResource{
+		ResourceInterface: resource.json.Namespace(namespace),
+		client:            resource.client,
+		gv:                resource.gv,
+		resource:          resource.resource,
+		namespace:         namespace,
+	}
+}
+
+type protobufResource struct {
+	dynamic.ResourceInterface
+
+	client    rest.Interface
+	gv        schema.GroupVersion
+	resource  string
+	namespace string
+}
+
+func (resource *protobufResource) request() *rest.Request {
+	return resource.client.Get().NamespaceIfScoped(resource.namespace, resource.namespace != "").Resource(resource.resource)
+}
+
+func (resource *protobufResource) Get(
+	ctx context.Context,
+	name string,
+	options metav1.GetOptions,
+	subresources ...string,
+) (*unstructured.Unstructured, error) {
+	if len(subresources) > 0 {
+		// subresources may be of types from other groups
+		return resource.ResourceInterface.Get(ctx, name, options, subresources...)
+	}
+
+	obj, err := resource.request().Name(name).VersionedParams(&options, scheme.ParameterCodec).Do(ctx).Get()
+	if runtime.IsNotRegisteredError(err) {
+		return resource.ResourceInterface.Get(ctx, name, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toUnstructured(obj, resource.gv)
+}
+
+func (resource *protobufResource) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	obj, err := resource.request().VersionedParams(&options, scheme.ParameterCodec).Do(ctx).Get()
+	if runtime.IsNotRegisteredError(err) {
+		return resource.ResourceInterface.List(ctx, options)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return toUnstructuredList(obj, resource.gv)
+}
+
+func (resource *protobufResource) Watch(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+	options.Watch = true
+	w, err := resource.request().VersionedParams(&options, scheme.ParameterCodec).Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Error {
+			// *metav1.Status is handled by apierrors.FromObject
+			return event, true
+		}
+
+		converted, err := toUnstructured(event.Object, resource.gv)
+		if err != nil {
+			return watch.Event{Type: watch.Error, Object: &apierrors.NewInternalError(err).ErrStatus}, true
+		}
+
+		event.Object = converted
+		return event, true
+	}), nil
+}
+
+func toUnstructured(obj runtime.Object, gv schema.GroupVersion) (*unstructured.Unstructured, error) {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := gvks[0]
+	for _, candidate := range gvks {
+		if candidate.GroupVersion() == gv {
+			gvk = candidate
+			break
+		}
+	}
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot convert %v to unstructured: %w", gvk, err)
+	}
+
+	converted := &unstructured.Unstructured{Object: content}
+	converted.SetGroupVersionKind(gvk)
+	return converted, nil
+}
+
+func toUnstructuredList(obj runtime.Object, gv schema.GroupVersion) (*unstructured.UnstructuredList, error) {
+	listMeta, err := meta.ListAccessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{
+		Object: map[string]any{},
+		Items:  make([]unstructured.Unstructured, 0, len(items)),
+	}
+	if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil {
+		list.SetGroupVersionKind(gv.WithKind(gvks[0].Kind))
+	}
+	list.SetResourceVersion(listMeta.GetResourceVersion())
+	list.SetContinue(listMeta.GetContinue())
+	list.SetRemainingItemCount(listMeta.GetRemainingItemCount())
+
+	for _, item := range items {
+		converted, err := toUnstructured(item, gv)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *converted)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+func TestProtobufDynamicClient(t *testing.T) {
+	assert := assert.New(t)
+
+	encoder := scheme.Codecs.EncoderForVersion(protobuf.NewSerializer(scheme.Scheme, scheme.Scheme), corev1.SchemeGroupVersion)
+	writeProtobuf := func(w http.ResponseWriter, obj runtime.Object) {
+		w.Header().Set("Content-Type", runtime.ContentTypeProtobuf)
+		assert.NoError(encoder.Encode(obj, w))
+	}
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", ResourceVersion: "3", Labels: map[string]string{"a": "b"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "main", Image: "busybox"}}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/namespaces/default/pods/foo":
+			assert.True(strings.HasPrefix(req.Header.Get("Accept"), runtime.ContentTypeProtobuf))
+			writeProtobuf(w, &pod)
+		case "/api/v1/pods":
+			writeProtobuf(w, &corev1.PodList{ListMeta: metav1.ListMeta{ResourceVersion: "5"}, Items: []corev1.Pod{pod}})
+		case "/apis/example.com/v1/namespaces/default/widgets/bar":
+			assert.NotContains(req.Header.Get("Accept"), runtime.ContentTypeProtobuf)
+			w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+			_, _ = w.Write([]byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"bar","namespace":"default"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := &rest.Config{Host: server.URL}
+	jsonClient, err := dynamic.NewForConfig(config)
+	assert.NoError(err)
+	client, err := newProtobufDynamicClient(config, jsonClient)
+	assert.NoError(err)
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+	obj, err := client.Resource(pods).Namespace("default").Get(context.Background(), "foo", metav1.GetOptions{})
+	assert.NoError(err)
+	assert.Equal("v1", obj.GetAPIVersion())
+	assert.Equal("Pod", obj.GetKind())
+	assert.Equal("3", obj.GetResourceVersion())
+	assert.Equal(map[string]string{"a": "b"}, obj.GetLabels())
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+	assert.Equal("busybox", containers[0].(map[string]any)["image"])
+
+	list, err := client.Resource(pods).List(context.Background(), metav1.ListOptions{})
+	assert.NoError(err)
+	assert.Equal("5", list.GetResourceVersion())
+	assert.Equal("PodList", list.GetKind())
+	assert.Len(list.Items, 1)
+	assert.Equal("Pod", list.Items[0].GetKind())
+	assert.Equal("foo", list.Items[0].GetName())
+
+	widget, err := client.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}).
+		Namespace("default").Get(context.Background(), "bar", metav1.GetOptions{})
+	assert.NoError(err)
+	assert.Equal("Widget", widget.GetKind())
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// Purpose distinguishes the clients used for different kinds of requests to the same cluster,
+// so that each kind of request can be rate limited separately.
+type Purpose string
+
+const (
+	// PurposeDefault is used for requests that do not fall into other purposes.
+	PurposeDefault Purpose = "default"
+	// PurposeDiscovery is used for discovery API requests.
+	PurposeDiscovery Purpose = "discovery"
+	// PurposeInformer is used for list and watch requests from informers.
+	PurposeInformer Purpose = "informer"
+	// PurposeObjectFetch is used for fetching individual objects on demand.
+	PurposeObjectFetch Purpose = "object-fetch"
+)
+
+var purposes = []Purpose{PurposeDefault, PurposeDiscovery, PurposeInformer, PurposeObjectFetch}
+
+func parsePurpose(value string) (Purpose, error) {
+	for _, purpose := range purposes {
+		if string(purpose) == value {
+			return purpose, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown purpose %q, must be one of %v", value, purposes)
+}
+
+// restLimit is the client settings for a cluster or a purpose of a cluster.
+// Zero values are inherited from the less specific settings.
+type restLimit struct {
+	qps   float32
+	burst int
+	// the user to impersonate so that apiserver flow schemas can match requests of this purpose.
+	flowSchemaUser string
+}
+
+func (limit restLimit) inherit(base restLimit) restLimit {
+	if limit.qps == 0 {
+		limit.qps = base.qps
+	}
+	if limit.burst == 0 {
+		limit.burst = base.burst
+	}
+	if limit.flowSchemaUser == "" {
+		limit.flowSchemaUser = base.flowSchemaUser
+	}
+	return limit
+}
+
+func (limit restLimit) apply(config *rest.Config) {
+	config.QPS = limit.qps
+	config.Burst = limit.burst
+	if limit.flowSchemaUser != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: limit.flowSchemaUser}
+	}
+}
+
+// restLimits is keyed by "cluster" or "cluster/purpose".
+type restLimits map[string]restLimit
+
+func parseRestLimits(qps map[string]string, burst map[string]string, flowSchemaUsers map[string]string) (restLimits, error) {
+	limits := restLimits{}
+
+	getKey := func(flag string, key string) (string, error) {
+		if cluster, purposeString, hasPurpose := strings.Cut(key, "/"); hasPurpose {
+			purpose, err := parsePurpose(purposeString)
+			if err != nil {
+				return "", fmt.Errorf("invalid key %q in --%s: %w", key, flag, err)
+			}
+			return cluster + "/" + string(purpose), nil
+		}
+		return key, nil
+	}
+
+	for key, value := range qps {
+		key, err := getKey("kube-cluster-rest-qps", key)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := strconv.ParseFloat(value, 32)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid --kube-cluster-rest-qps value %q for %q, must be a positive number", value, key)
+		}
+
+		limit := limits[key]
+		limit.qps = float32(parsed)
+		limits[key] = limit
+	}
+
+	for key, value := range burst {
+		key, err := getKey("kube-cluster-rest-burst", key)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid --kube-cluster-rest-burst value %q for %q, must be a positive integer", value, key)
+		}
+
+		limit := limits[key]
+		limit.burst = parsed
+		limits[key] = limit
+	}
+
+	for key, value := range flowSchemaUsers {
+		key, err := getKey("kube-cluster-flow-schema-user", key)
+		if err != nil {
+			return nil, err
+		}
+
+		limit := limits[key]
+		limit.flowSchemaUser = value
+		limits[key] = limit
+	}
+
+	return limits, nil
+}
+
+// get resolves the settings for a purpose of a cluster.
+// Settings for the purpose take precedence over settings for the cluster, which take precedence over the base.
+func (limits restLimits) get(cluster string, purpose Purpose, base restLimit) restLimit {
+	return limits[cluster+"/"+string(purpose)].inherit(limits[cluster].inherit(base))
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	limits, err := parseRestLimits(
+		map[string]string{"big": "50", "big/informer": "100"},
+		map[string]string{"big/informer": "200", "small": "5"},
+		map[string]string{"big/object-fetch": "kelemetry-fetch"},
+	)
+	assert.NoError(err)
+
+	base := restLimit{qps: 10, burst: 10}
+	assert.Equal(restLimit{qps: 100, burst: 200}, limits.get("big", PurposeInformer, base))
+	assert.Equal(restLimit{qps: 50, burst: 10}, limits.get("big", PurposeDiscovery, base))
+	assert.Equal(restLimit{qps: 50, burst: 10, flowSchemaUser: "kelemetry-fetch"}, limits.get("big", PurposeObjectFetch, base))
+	assert.Equal(restLimit{qps: 10, burst: 5}, limits.get("small", PurposeDefault, base))
+	assert.Equal(base, limits.get("other", PurposeInformer, base))
+
+	_, err = parseRestLimits(map[string]string{"big/watch": "1"}, nil, nil)
+	assert.Error(err)
+
+	_, err = parseRestLimits(nil, map[string]string{"big": "-1"}, nil)
+	assert.Error(err)
+}
@@ -16,7 +16,6 @@ package kelemetrixconsumer
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
 
@@ -26,6 +25,7 @@ import (
 
 	"github.com/kubewharf/kelemetry/pkg/audit"
 	"github.com/kubewharf/kelemetry/pkg/audit/mq"
+	"github.com/kubewharf/kelemetry/pkg/audit/signature"
 	"github.com/kubewharf/kelemetry/pkg/kelemetrix"
 	"github.com/kubewharf/kelemetry/pkg/kelemetrix/config"
 	"github.com/kubewharf/kelemetry/pkg/manager"
@@ -66,6 +66,7 @@ type Consumer struct {
 	Metrics  metrics.Client
 	Registry *kelemetrix.Registry
 	Config   config.Provider
+	Signer   *signature.Signer
 
 	consumers []mq.Consumer
 
@@ -90,7 +91,8 @@ func (consumer *Consumer) Init() error {
 			group,
 			partition,
 			func(ctx context.Context, fieldLogger logrus.FieldLogger, msgKey []byte, msgValue []byte) {
-				consumer.handleMessageRaw(fieldLogger, msgValue, partition)
+				<-consumer.startupReady
+				consumer.HandleRawMessage(fieldLogger, msgValue, partition)
 			},
 		)
 		if err != nil {
@@ -416,17 +418,23 @@ func (h metricHandler) handle(tagValues []string, quantities []float64, hasQuant
 	h.metricFn(quantity, outputTags)
 }
 
-func (consumer *Consumer) handleMessageRaw(
+// HandleRawMessage unwraps and decodes a message from the audit message queue.
+func (consumer *Consumer) HandleRawMessage(
 	fieldLogger logrus.FieldLogger,
 	msgValue []byte,
 	partition mq.PartitionId,
 ) {
-	<-consumer.startupReady
-
 	logger := fieldLogger.WithField("mod", "audit-consumer").WithField("partition", partition)
 
-	message := &audit.Message{}
-	if err := json.Unmarshal(msgValue, message); err != nil {
+	// messages are signed according to the same --audit-signature-* options as the audit consumer
+	msgValue, integrity, err := consumer.Signer.Open(msgValue)
+	if err != nil {
+		logger.WithError(err).Error("error verifying audit data")
+		return
+	}
+
+	message := &audit.Message{Integrity: integrity}
+	if err := audit.DecodeMessage(msgValue, message); err != nil {
 		logger.WithError(err).Error("error decoding audit data")
 		return
 	}
@@ -15,6 +15,10 @@
 package kelemetrixconsumer_test
 
 import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -27,6 +31,7 @@ import (
 	clocktesting "k8s.io/utils/clock/testing"
 
 	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/audit/signature/signaturetest"
 	k8sconfig "github.com/kubewharf/kelemetry/pkg/k8s/config"
 	"github.com/kubewharf/kelemetry/pkg/kelemetrix"
 	"github.com/kubewharf/kelemetry/pkg/kelemetrix/config"
@@ -171,6 +176,49 @@ func TestListTimeout(t *testing.T) {
 	assert.Equal(1.0, stats.Get("metric_name", map[string]string{"username": "controller", "groupResource": "pods"}).GetIntUnsafe())
 }
 
+func TestSignedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	metricsClient, stats := metrics.NewMock(clocktesting.NewFakeClock(time.Time{}))
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	assert.NoError(os.WriteFile(keyFile, []byte("secret"), 0o600))
+	signer, err := signaturetest.NewSigner(
+		logger, metricsClient,
+		"--audit-signature-signing-key-file="+keyFile,
+		"--audit-signature-policy=reject",
+	)
+	assert.NoError(err)
+
+	consumer := &kelemetrixconsumer.Consumer{
+		Metrics: metricsClient,
+		Registry: kelemetrix.NewMockRegistry(
+			[]kelemetrix.TagProvider{constantTagProvider{key: "k1", value: "v1"}},
+			[]kelemetrix.Quantifier{constantQuantifier{name: "q1", ty: kelemetrix.MetricTypeCount, quantity: 1}},
+		),
+		Config: &config.MockProvider{
+			Config: &config.Config{
+				Metrics: []config.Metric{{Name: "metric_name", Quantifier: "q1", Tags: []string{"k1"}}},
+			},
+		},
+		Signer: signer,
+	}
+	assert.NoError(consumer.PrepareTagsQuantifiers())
+
+	payload, err := json.Marshal(&audit.Message{Cluster: "cluster"})
+	assert.NoError(err)
+
+	// signed messages are unwrapped before decoding
+	consumer.HandleRawMessage(logger, signer.Sign(payload), 0)
+	assert.Equal(1.0, stats.Get("metric_name", map[string]string{"k1": "v1"}).GetIntUnsafe())
+
+	// unsigned messages are rejected by the policy
+	consumer.HandleRawMessage(logger, payload, 0)
+	assert.Equal(1.0, stats.Get("metric_name", map[string]string{"k1": "v1"}).GetIntUnsafe())
+}
+
 func doTest(
 	t *testing.T,
 	tags []string,
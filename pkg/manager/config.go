@@ -0,0 +1,242 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+type configFileOptions struct {
+	path string
+	dump bool
+}
+
+func (options *configFileOptions) setup(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&options.path,
+		"config",
+		"",
+		"path to a YAML or JSON file containing options in the form `option-name: value`; "+
+			"nested objects are joined with '-', e.g. `diff: {controller: {enable: true}}` sets --diff-controller-enable; "+
+			"options specified on the command line override the file",
+	)
+	fs.BoolVar(&options.dump, "dump-config", false, "print the effective options in the --config format and exit")
+}
+
+// LoadConfigFile sets the options that were not specified on the command line from the --config file.
+// Must be called after fs is parsed.
+func (manager *Manager) LoadConfigFile(fs *pflag.FlagSet) error {
+	manager.flagSet = fs
+	manager.cliFlags = map[string]struct{}{}
+	fs.Visit(func(flag *pflag.Flag) {
+		manager.cliFlags[flag.Name] = struct{}{}
+	})
+
+	if manager.configFile.path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(manager.configFile.path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	return applyConfig(fs, content)
+}
+
+// ShouldDumpConfig returns whether --dump-config was specified.
+func (manager *Manager) ShouldDumpConfig() bool { return manager.configFile.dump }
+
+// applyConfig sets the flags that were not changed on the command line from a YAML or JSON document.
+func applyConfig(fs *pflag.FlagSet, content []byte) error {
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("cannot parse config file: %w", err)
+	}
+
+	return applyConfigMap(fs, "", values, false)
+}
+
+// applyConfigMap sets the flags that were not changed from the values in a config file.
+// If ignoreUnknown is true, values for flags not registered in fs are skipped.
+func applyConfigMap(fs *pflag.FlagSet, prefix string, values map[string]any, ignoreUnknown bool) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := prefix + key
+		value := values[key]
+
+		flag := fs.Lookup(name)
+
+		if nested, isMap := value.(map[string]any); isMap && (flag == nil || flag.Value.Type() != "stringToString") {
+			if err := applyConfigMap(fs, name+"-", nested, ignoreUnknown); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if flag == nil {
+			if ignoreUnknown {
+				continue
+			}
+			return fmt.Errorf("unknown option %q in config file", name)
+		}
+
+		if flag.Changed || value == nil {
+			continue
+		}
+
+		if err := setFlagFromConfig(fs, flag, value); err != nil {
+			return fmt.Errorf("invalid value for option %q in config file: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setFlagFromConfig(fs *pflag.FlagSet, flag *pflag.Flag, value any) error {
+	switch value := value.(type) {
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			items[i] = formatConfigScalar(item)
+		}
+
+		if sliceValue, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+			if err := sliceValue.Replace(items); err != nil {
+				return err
+			}
+			flag.Changed = true
+			return nil
+		}
+
+		return fs.Set(flag.Name, strings.Join(items, ","))
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + "=" + formatConfigScalar(value[key])
+		}
+
+		buf := &bytes.Buffer{}
+		writer := csv.NewWriter(buf)
+		if err := writer.Write(pairs); err != nil {
+			return err
+		}
+		writer.Flush()
+
+		return fs.Set(flag.Name, strings.TrimSuffix(buf.String(), "\n"))
+	default:
+		return fs.Set(flag.Name, formatConfigScalar(value))
+	}
+}
+
+func formatConfigScalar(value any) string {
+	switch value := value.(type) {
+	case float64:
+		// JSON numbers are decoded as float64, but integer options do not accept exponents
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// DumpConfig writes the effective value of all flags in the --config format.
+func (manager *Manager) DumpConfig(fs *pflag.FlagSet, writer io.Writer) error {
+	values := map[string]any{}
+
+	var err error
+	fs.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "config" || flag.Name == "dump-config" || err != nil {
+			return
+		}
+
+		var value any
+		value, err = dumpFlag(flag)
+		if err != nil {
+			err = fmt.Errorf("cannot dump option %q: %w", flag.Name, err)
+			return
+		}
+		values[flag.Name] = value
+	})
+	if err != nil {
+		return err
+	}
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(content)
+	return err
+}
+
+func dumpFlag(flag *pflag.Flag) (any, error) {
+	if sliceValue, isSlice := flag.Value.(pflag.SliceValue); isSlice {
+		return sliceValue.GetSlice(), nil
+	}
+
+	str := flag.Value.String()
+
+	switch flag.Value.Type() {
+	case "bool":
+		return strconv.ParseBool(str)
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return strconv.ParseInt(str, 10, 64)
+	case "float32", "float64":
+		return strconv.ParseFloat(str, 64)
+	case "stringToString":
+		pairs := map[string]string{}
+		str = strings.TrimSuffix(strings.TrimPrefix(str, "["), "]")
+		if str == "" {
+			return pairs, nil
+		}
+
+		records, err := csv.NewReader(strings.NewReader(str)).Read()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			key, value, _ := strings.Cut(record, "=")
+			pairs[key] = value
+		}
+		return pairs, nil
+	default:
+		return str, nil
+	}
+}
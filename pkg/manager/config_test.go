@@ -0,0 +1,111 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+type testConfigFlags struct {
+	enable   bool
+	address  string
+	interval time.Duration
+	workers  int
+	names    []string
+	labels   map[string]string
+}
+
+func newTestConfigFlagSet() (*pflag.FlagSet, *testConfigFlags) {
+	flags := &testConfigFlags{}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.BoolVar(&flags.enable, "diff-controller-enable", false, "")
+	fs.StringVar(&flags.address, "diff-controller-address", "", "")
+	fs.DurationVar(&flags.interval, "diff-controller-interval", time.Second, "")
+	fs.IntVar(&flags.workers, "diff-controller-workers", 1, "")
+	fs.StringSliceVar(&flags.names, "names", []string{"default"}, "")
+	fs.StringToStringVar(&flags.labels, "labels", map[string]string{}, "")
+	return fs, flags
+}
+
+func TestApplyConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	fs, flags := newTestConfigFlagSet()
+	assert.NoError(fs.Parse([]string{"--diff-controller-address=cli"}))
+
+	assert.NoError(applyConfig(fs, []byte(`
+diff:
+  controller:
+    enable: true
+    address: file
+    interval: 5s
+diff-controller-workers: 1000000
+names: [a, b]
+labels: {x: "1", z: "2"}
+`)))
+
+	assert.True(flags.enable)
+	assert.Equal("cli", flags.address)
+	assert.Equal(5*time.Second, flags.interval)
+	assert.Equal(1000000, flags.workers)
+	assert.Equal([]string{"a", "b"}, flags.names)
+	assert.Equal(map[string]string{"x": "1", "z": "2"}, flags.labels)
+}
+
+func TestApplyConfigUnknownOption(t *testing.T) {
+	assert := assert.New(t)
+
+	fs, _ := newTestConfigFlagSet()
+	assert.NoError(fs.Parse(nil))
+
+	err := applyConfig(fs, []byte(`{"diff": {"controller": {"unknown": 1}}}`))
+	assert.ErrorContains(err, `"diff-controller-unknown"`)
+}
+
+func TestDumpConfigRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	fs, _ := newTestConfigFlagSet()
+	assert.NoError(fs.Parse([]string{
+		"--diff-controller-enable",
+		"--diff-controller-workers=4",
+		"--names=a,b",
+		"--labels=x=1",
+	}))
+
+	buf := &bytes.Buffer{}
+	assert.NoError((&Manager{}).DumpConfig(fs, buf))
+
+	var dumped map[string]any
+	assert.NoError(yaml.Unmarshal(buf.Bytes(), &dumped))
+	assert.Equal(true, dumped["diff-controller-enable"])
+	assert.Equal(float64(4), dumped["diff-controller-workers"])
+	assert.Equal([]any{"a", "b"}, dumped["names"])
+	assert.Equal(map[string]any{"x": "1"}, dumped["labels"])
+
+	reloadedFs, reloaded := newTestConfigFlagSet()
+	assert.NoError(reloadedFs.Parse(nil))
+	assert.NoError(applyConfig(reloadedFs, buf.Bytes()))
+	assert.True(reloaded.enable)
+	assert.Equal(4, reloaded.workers)
+	assert.Equal([]string{"a", "b"}, reloaded.names)
+	assert.Equal(map[string]string{"x": "1"}, reloaded.labels)
+}
@@ -20,6 +20,8 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -86,6 +88,7 @@ type componentInfo struct {
 	dependents   uint
 	dependencies map[reflect.Type]*componentInfo
 	isListImpl   bool
+	flags        []string
 }
 
 type utilFactory struct {
@@ -101,6 +104,12 @@ type componentFactory struct {
 
 type Manager struct {
 	shutdownTimeout time.Duration
+	configFile      configFileOptions
+	flagSet         *pflag.FlagSet
+	cliFlags        map[string]struct{}
+
+	reloadMutex      sync.Mutex
+	extraReloadables []reloadable
 
 	utils map[reflect.Type]utilFactory
 
@@ -114,6 +123,8 @@ type Manager struct {
 	components map[reflect.Type]*componentInfo
 
 	orderedComponents []*componentInfo
+
+	started atomic.Bool
 }
 
 func New() *Manager {
@@ -639,6 +650,9 @@ func (manager *Manager) Dot() string {
 
 	for ty, info := range manager.components {
 		for dep := range info.dependencies {
+			if _, exists := manager.components[dep]; !exists {
+				continue // trimmed mux impl
+			}
 			edges = append(edges, [2]int{nodeIds[ty], nodeIds[dep]})
 		}
 	}
@@ -660,9 +674,20 @@ func (manager *Manager) Dot() string {
 
 func (manager *Manager) SetupFlags(fs *pflag.FlagSet) {
 	fs.DurationVar(&manager.shutdownTimeout, "shutdown-timeout", time.Second*15, "timeout for graceful shutdown after receiving SIGTERM")
+	manager.configFile.setup(fs)
+
+	known := map[string]struct{}{}
+	fs.VisitAll(func(flag *pflag.Flag) { known[flag.Name] = struct{}{} })
 
 	for _, comp := range manager.components {
 		comp.component.Options().Setup(fs)
+
+		fs.VisitAll(func(flag *pflag.Flag) {
+			if _, exists := known[flag.Name]; !exists {
+				comp.flags = append(comp.flags, flag.Name)
+				known[flag.Name] = struct{}{}
+			}
+		})
 	}
 }
 
@@ -840,13 +865,24 @@ func (manager *Manager) Start(logger logrus.FieldLogger, ctx context.Context) er
 		}
 	}
 
+	manager.started.Store(true)
+
 	return nil
 }
 
+// Started returns true if all components have started and the manager is not closing yet.
+func (manager *Manager) Started() bool {
+	return manager.started.Load()
+}
+
 func (manager *Manager) Close(ctx context.Context, logger logrus.FieldLogger) error {
-	ctx, cancelFunc := context.WithTimeout(ctx, manager.shutdownTimeout)
+	// ctx is usually already canceled when shutdown is triggered,
+	// but components still need a live context to drain and flush until the shutdown timeout.
+	ctx, cancelFunc := context.WithTimeout(context.WithoutCancel(ctx), manager.shutdownTimeout)
 	defer cancelFunc()
 
+	manager.started.Store(false)
+
 	for offset := len(manager.orderedComponents) - 1; offset >= 0; offset-- {
 		comp := manager.orderedComponents[offset]
 		modLogger := logger.WithField("mod", comp.name)
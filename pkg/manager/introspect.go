@@ -0,0 +1,162 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"context"
+	"sort"
+)
+
+// ComponentSummary describes an enabled component.
+type ComponentSummary struct {
+	Name         string
+	Component    Component
+	Dependencies []string
+	// Options maps the flags registered by the component to their effective values.
+	Options map[string]string
+	// MuxImpls lists the available implementations if the component is a mux.
+	MuxImpls []string
+	// MuxChosen is the chosen implementation if the component is a mux.
+	MuxChosen string
+}
+
+// Components returns the summaries of all enabled components sorted by name.
+// Must be called after TrimDisabled.
+func (manager *Manager) Components() []ComponentSummary {
+	output := make([]ComponentSummary, 0, len(manager.orderedComponents))
+
+	for _, comp := range manager.orderedComponents {
+		summary := ComponentSummary{
+			Name:         comp.name,
+			Component:    comp.component,
+			Dependencies: make([]string, 0, len(comp.dependencies)),
+			Options:      make(map[string]string, len(comp.flags)),
+		}
+
+		for _, dep := range comp.dependencies {
+			summary.Dependencies = append(summary.Dependencies, dep.name)
+		}
+		sort.Strings(summary.Dependencies)
+
+		if manager.flagSet != nil {
+			for _, name := range comp.flags {
+				if flag := manager.flagSet.Lookup(name); flag != nil {
+					summary.Options[name] = flag.Value.String()
+				}
+			}
+		}
+
+		if mux, isMux := comp.component.(MuxInterface); isMux {
+			mux := mux.IsMux()
+			for name := range mux.choices {
+				summary.MuxImpls = append(summary.MuxImpls, name)
+			}
+			sort.Strings(summary.MuxImpls)
+			summary.MuxChosen = mux.which
+		}
+
+		output = append(output, summary)
+	}
+
+	sort.Slice(output, func(i, j int) bool { return output[i].Name < output[j].Name })
+	return output
+}
+
+// StatusReporter is implemented by components that expose their internal state for introspection,
+// such as health and queue depths.
+// The returned value must be JSON-serializable.
+type StatusReporter interface {
+	Status() map[string]any
+}
+
+// CacheFlusher is implemented by components with in-memory caches that can be dropped at runtime.
+type CacheFlusher interface {
+	FlushCache(ctx context.Context) error
+}
+
+// LivenessChecker is implemented by components that can detect failures only recoverable by restarting the process,
+// such as a background loop that exited unexpectedly.
+type LivenessChecker interface {
+	CheckLiveness(ctx context.Context) error
+}
+
+// ReadinessChecker is implemented by components that depend on external systems or initial synchronization,
+// such as database connections and informer caches.
+// A failed readiness check indicates that the process cannot serve its function at the moment.
+type ReadinessChecker interface {
+	CheckReadiness(ctx context.Context) error
+}
+
+// Graph is the dependency graph of components.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// MuxChosen is the chosen implementation if the component is a mux.
+	MuxChosen string `json:"muxChosen,omitempty"`
+	IsMux     bool   `json:"isMux,omitempty"`
+	IsList    bool   `json:"isList,omitempty"`
+}
+
+// GraphEdge indicates that the component From depends on the component To.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph returns the dependency graph of the current components.
+// Disabled components are excluded if called after TrimDisabled.
+func (manager *Manager) Graph() Graph {
+	graph := Graph{
+		Nodes: make([]GraphNode, 0, len(manager.components)),
+		Edges: []GraphEdge{},
+	}
+
+	for ty, info := range manager.components {
+		node := GraphNode{
+			Name: info.name,
+			Type: ty.String(),
+		}
+
+		if mux, isMux := info.component.(MuxInterface); isMux {
+			node.IsMux = true
+			node.MuxChosen = mux.IsMux().which
+		}
+		_, node.IsList = info.component.(ListInterface)
+
+		graph.Nodes = append(graph.Nodes, node)
+
+		for dep, depInfo := range info.dependencies {
+			if _, exists := manager.components[dep]; !exists {
+				continue // trimmed mux impl
+			}
+			graph.Edges = append(graph.Edges, GraphEdge{From: info.name, To: depInfo.name})
+		}
+	}
+
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Name < graph.Nodes[j].Name })
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].To < graph.Edges[j].To
+	})
+
+	return graph
+}
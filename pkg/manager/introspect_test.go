@@ -0,0 +1,69 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+type testRoot struct {
+	manager.BaseComponent
+	Dep *testDep
+}
+
+func (*testRoot) Options() manager.Options { return &manager.AlwaysEnableOptions{} }
+
+type testDep struct {
+	manager.BaseComponent
+}
+
+type testUnused struct {
+	manager.BaseComponent
+}
+
+func TestGraph(t *testing.T) {
+	assert := assert.New(t)
+
+	m := manager.New()
+	m.Provide("root", manager.Ptr(&testRoot{}))
+	m.Provide("dep", manager.Ptr(&testDep{}))
+	m.Provide("unused", manager.Ptr(&testUnused{}))
+	assert.NoError(m.Build())
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	m.SetupFlags(fs)
+	assert.NoError(fs.Parse(nil))
+	m.TrimDisabled(logrus.New())
+
+	graph := m.Graph()
+
+	names := []string{}
+	for _, node := range graph.Nodes {
+		names = append(names, node.Name)
+	}
+	assert.Equal([]string{"dep", "root"}, names)
+	assert.Equal([]manager.GraphEdge{{From: "root", To: "dep"}}, graph.Edges)
+
+	summaries := m.Components()
+	assert.Len(summaries, 2)
+	assert.Equal("root", summaries[1].Name)
+	assert.Equal([]string{"dep"}, summaries[1].Dependencies)
+}
@@ -16,6 +16,7 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sort"
 
@@ -153,6 +154,32 @@ func (mux *Mux) Impl() MuxImpl {
 	return mux.whichValue
 }
 
+func (mux *Mux) Validate() error {
+	errs := []error{}
+
+	if _, exists := mux.choices[mux.which]; !exists {
+		choices := make([]string, 0, len(mux.choices))
+		for name := range mux.choices {
+			choices = append(choices, name)
+		}
+		sort.Strings(choices)
+
+		message := fmt.Sprintf("invalid --%s: no implementation called %q, possible values are %q", mux.name, mux.which, choices)
+		if suggestion := suggest(mux.which, choices); suggestion != "" {
+			message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		errs = append(errs, errors.New(message))
+	}
+
+	if validating, ok := mux.additionalOptions.(interface{ Validate() error }); ok {
+		if err := validating.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 func (mux *Mux) Init() error {
 	var exists bool
 	mux.whichValue, exists = mux.choices[mux.which]
@@ -0,0 +1,150 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+)
+
+// Reloadable is implemented by components that can update some of their options without restarting.
+type Reloadable interface {
+	// ReloadOptions returns a new object to hold the reloadable options.
+	// The flags registered in its Setup must have the same names and types as those in Options().
+	ReloadOptions() ReloadOptions
+	// Reload applies an object previously returned from ReloadOptions after it is populated.
+	// Reload may be called concurrently with any methods other than Init and Close.
+	Reload(options ReloadOptions) error
+}
+
+// ReloadOptions holds the reloadable subset of the options of a Reloadable.
+type ReloadOptions interface {
+	Setup(fs *pflag.FlagSet)
+}
+
+type reloadable struct {
+	name string
+	impl Reloadable
+}
+
+// AddReloadable registers an object that is not a component for reloading.
+func (manager *Manager) AddReloadable(name string, impl Reloadable) {
+	manager.extraReloadables = append(manager.extraReloadables, reloadable{name: name, impl: impl})
+}
+
+func (manager *Manager) reloadables() []reloadable {
+	output := []reloadable{}
+	for _, comp := range manager.orderedComponents {
+		if impl, ok := comp.component.(Reloadable); ok {
+			output = append(output, reloadable{name: comp.name, impl: impl})
+		}
+	}
+	return append(output, manager.extraReloadables...)
+}
+
+// Reload reads the --config file again and applies the new values to all reloadable options.
+// Options specified on the command line are not changed.
+// Options removed from the file are reset to their default values.
+func (manager *Manager) Reload(logger logrus.FieldLogger) error {
+	manager.reloadMutex.Lock()
+	defer manager.reloadMutex.Unlock()
+
+	if manager.configFile.path == "" {
+		return fmt.Errorf("cannot reload options without --config")
+	}
+
+	content, err := os.ReadFile(manager.configFile.path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return fmt.Errorf("cannot parse config file: %w", err)
+	}
+
+	reloadables := manager.reloadables()
+	allOptions := make([]ReloadOptions, len(reloadables))
+
+	// parse all options before applying any of them so that an invalid file does not get partially applied
+	for i, r := range reloadables {
+		options := r.impl.ReloadOptions()
+		fs := pflag.NewFlagSet(r.name, pflag.ContinueOnError)
+		options.Setup(fs)
+
+		if err := applyConfigMap(fs, "", values, true); err != nil {
+			return err
+		}
+
+		if err := manager.copyCliFlags(fs); err != nil {
+			return err
+		}
+
+		allOptions[i] = options
+	}
+
+	errs := []error{}
+	for i, r := range reloadables {
+		if err := r.impl.Reload(allOptions[i]); err != nil {
+			errs = append(errs, fmt.Errorf("error reloading %q: %w", r.name, err))
+			continue
+		}
+
+		logger.WithField("mod", r.name).Info("Reloaded options")
+	}
+
+	return errors.Join(errs...)
+}
+
+// copyCliFlags overwrites the flags in fs with the values specified on the command line.
+func (manager *Manager) copyCliFlags(fs *pflag.FlagSet) error {
+	names := []string{}
+	fs.VisitAll(func(flag *pflag.Flag) {
+		if _, isCli := manager.cliFlags[flag.Name]; isCli {
+			names = append(names, flag.Name)
+		}
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := dumpFlag(manager.flagSet.Lookup(name))
+		if err != nil {
+			return fmt.Errorf("cannot copy option %q: %w", name, err)
+		}
+
+		// round trip through YAML to convert the value into the types decoded from a config file
+		content, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cannot copy option %q: %w", name, err)
+		}
+
+		var generic any
+		if err := yaml.Unmarshal(content, &generic); err != nil {
+			return fmt.Errorf("cannot copy option %q: %w", name, err)
+		}
+
+		if err := setFlagFromConfig(fs, fs.Lookup(name), generic); err != nil {
+			return fmt.Errorf("cannot copy option %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+type testReloadOptions struct {
+	address string
+	workers int
+	names   []string
+}
+
+func (options *testReloadOptions) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(&options.address, "diff-controller-address", "", "")
+	fs.IntVar(&options.workers, "diff-controller-workers", 1, "")
+	fs.StringSliceVar(&options.names, "names", []string{"default"}, "")
+}
+
+type testReloadable struct {
+	reloaded *testReloadOptions
+}
+
+func (r *testReloadable) ReloadOptions() ReloadOptions { return &testReloadOptions{} }
+
+func (r *testReloadable) Reload(options ReloadOptions) error {
+	r.reloaded = options.(*testReloadOptions)
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(os.WriteFile(path, []byte(`{"diff": {"controller": {"workers": 2}}, "names": ["old"]}`), 0o600))
+
+	manager := New()
+	fs, flags := newTestConfigFlagSet()
+	manager.configFile.setup(fs)
+	assert.NoError(fs.Parse([]string{"--config", path, "--names=cli"}))
+	assert.NoError(manager.LoadConfigFile(fs))
+	assert.Equal(2, flags.workers)
+	assert.Equal([]string{"cli"}, flags.names)
+
+	reloadable := &testReloadable{}
+	manager.AddReloadable("test", reloadable)
+
+	assert.NoError(os.WriteFile(path, []byte(`
+diff-controller-address: new
+names: [new]
+unrelated-option: 1
+`), 0o600))
+	assert.NoError(manager.Reload(logrus.New()))
+
+	assert.Equal("new", reloadable.reloaded.address)
+	assert.Equal(1, reloadable.reloaded.workers, "options removed from the file are reset to default")
+	assert.Equal([]string{"cli"}, reloadable.reloaded.names, "options from the command line are retained")
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(os.WriteFile(path, []byte(`{}`), 0o600))
+
+	manager := New()
+	fs, _ := newTestConfigFlagSet()
+	manager.configFile.setup(fs)
+	assert.NoError(fs.Parse([]string{"--config", path}))
+	assert.NoError(manager.LoadConfigFile(fs))
+
+	reloadable := &testReloadable{}
+	manager.AddReloadable("test", reloadable)
+
+	assert.NoError(os.WriteFile(path, []byte(`diff-controller-workers: many`), 0o600))
+	assert.Error(manager.Reload(logrus.New()))
+	assert.Nil(reloadable.reloaded)
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ValidatingOptions is implemented by Options that can detect invalid values before any component is initialized.
+type ValidatingOptions interface {
+	Options
+
+	// Validate returns an error describing the invalid options, including the flag names.
+	// Use errors.Join to report multiple errors.
+	Validate() error
+}
+
+// Validate validates the options of all enabled components and returns all errors found.
+// Must be called after TrimDisabled.
+func (manager *Manager) Validate() error {
+	comps := make([]*componentInfo, len(manager.orderedComponents))
+	copy(comps, manager.orderedComponents)
+	sort.Slice(comps, func(i, j int) bool { return comps[i].name < comps[j].name })
+
+	errs := []error{}
+	for _, comp := range comps {
+		options, ok := comp.component.Options().(ValidatingOptions)
+		if !ok {
+			continue
+		}
+
+		if err := options.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", comp.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// suggest returns the candidate most similar to value, or an empty string if none is similar enough.
+func suggest(value string, candidates []string) string {
+	best, bestDistance := "", len(value)/2+1
+	for _, candidate := range candidates {
+		if distance := editDistance(value, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMuxImpl struct {
+	BaseComponent
+	MuxImplBase
+	name string
+}
+
+func (impl *testMuxImpl) MuxImplName() (string, bool) { return impl.name, impl.name == "local" }
+
+type testValidatingOptions struct {
+	NoOptions
+	err error
+}
+
+func (options *testValidatingOptions) Validate() error { return options.err }
+
+type testValidatingComponent struct {
+	BaseComponent
+	options testValidatingOptions
+}
+
+func (comp *testValidatingComponent) Options() Options { return &comp.options }
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := NewMux("diff-cache", false).
+		WithImpl(&testMuxImpl{name: "local"}).
+		WithImpl(&testMuxImpl{name: "etcd"}).
+		WithImpl(&testMuxImpl{name: "redis"})
+	mux.Setup(pflag.NewFlagSet("test", pflag.ContinueOnError))
+	mux.which = "etdc"
+
+	manager := New()
+	manager.orderedComponents = []*componentInfo{
+		{name: "diff-cache", component: mux},
+		{name: "valid", component: &testValidatingComponent{}},
+		{name: "invalid", component: &testValidatingComponent{
+			options: testValidatingOptions{err: fmt.Errorf("--foo must be positive")},
+		}},
+		{name: "plain", component: &BaseComponent{}},
+	}
+
+	err := manager.Validate()
+	assert.EqualError(err, `diff-cache: invalid --diff-cache: no implementation called "etdc", `+
+		`possible values are ["etcd" "local" "redis"] (did you mean "etcd"?)
+invalid: --foo must be positive`)
+
+	mux.which = "unrelated"
+	assert.NotContains(mux.Validate().Error(), "did you mean")
+
+	mux.which = "redis"
+	assert.NoError(mux.Validate())
+}
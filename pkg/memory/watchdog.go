@@ -0,0 +1,357 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Watches the memory usage of the process against a memory budget and sheds load progressively
+// before the process is OOM-killed and loses all in-memory state.
+//
+// At the soft level, in-memory caches are flushed and message queue consumption is slowed down.
+// At the hard level, low-priority informers are additionally stopped and message queue consumption is paused.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	kmetrics "github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("memory-watchdog", manager.Ptr(&Watchdog{}))
+}
+
+// Level is the memory pressure level.
+type Level int32
+
+const (
+	// LevelNormal is below the soft threshold.
+	LevelNormal Level = iota
+	// LevelSoft is above the soft threshold. Caches are flushed and consumption is slowed down.
+	LevelSoft
+	// LevelHard is above the hard threshold. Low-priority work is stopped.
+	LevelHard
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelNormal:
+		return "Normal"
+	case LevelSoft:
+		return "Soft"
+	case LevelHard:
+		return "Hard"
+	default:
+		return fmt.Sprintf("Level(%d)", int32(level))
+	}
+}
+
+// recoveryMargin is the ratio below a threshold that usage must drop to before leaving its level,
+// to avoid flapping around the threshold.
+const recoveryMargin = 0.05
+
+type options struct {
+	enable        bool
+	limit         int64
+	interval      time.Duration
+	softThreshold float64
+	hardThreshold float64
+	throttleDelay time.Duration
+	maxPause      time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "memory-watchdog-enable", false, "shed load progressively when memory usage approaches the memory budget")
+	fs.Int64Var(
+		&options.limit,
+		"memory-watchdog-limit",
+		0,
+		"memory budget of the process in bytes; defaults to GOMEMLIMIT. "+
+			"If set and GOMEMLIMIT is not set, it is also used as the soft memory limit of the Go runtime",
+	)
+	fs.DurationVar(&options.interval, "memory-watchdog-interval", time.Second, "frequency of checking memory usage")
+	fs.Float64Var(
+		&options.softThreshold,
+		"memory-watchdog-soft-threshold",
+		0.8,
+		"ratio of the memory budget above which caches are flushed and message queue consumption is slowed down",
+	)
+	fs.Float64Var(
+		&options.hardThreshold,
+		"memory-watchdog-hard-threshold",
+		0.9,
+		"ratio of the memory budget above which low-priority informers are stopped and message queue consumption is paused",
+	)
+	fs.DurationVar(
+		&options.throttleDelay,
+		"memory-watchdog-throttle-delay",
+		time.Millisecond*10,
+		"delay before consuming each message from the message queue at the soft level",
+	)
+	fs.DurationVar(
+		&options.maxPause,
+		"memory-watchdog-max-pause",
+		time.Second*10,
+		"maximum duration to pause before consuming each message from the message queue at the hard level",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if !options.enable {
+		return nil
+	}
+	if options.limit < 0 {
+		return fmt.Errorf("--memory-watchdog-limit must not be negative")
+	}
+	if options.interval <= 0 {
+		return fmt.Errorf("--memory-watchdog-interval must be positive")
+	}
+	if !(0 < options.softThreshold && options.softThreshold <= options.hardThreshold && options.hardThreshold <= 1) {
+		return fmt.Errorf("--memory-watchdog-soft-threshold and --memory-watchdog-hard-threshold must satisfy 0 < soft <= hard <= 1")
+	}
+	return nil
+}
+
+// Watchdog tracks the memory pressure level.
+// If the watchdog is disabled, the level is always LevelNormal.
+type Watchdog struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+	Manager *manager.Manager
+	Metrics kmetrics.Client
+
+	LevelMetric *kmetrics.Metric[*levelMetric]
+
+	limit     int64
+	readUsage func() uint64
+
+	usage atomic.Uint64
+	level atomic.Int32
+
+	changeMu sync.Mutex
+	changeCh chan struct{}
+}
+
+type levelMetric struct {
+	Level string
+}
+
+func (*levelMetric) MetricName() string { return "memory_watchdog_transition" }
+
+type usageMetric struct{}
+
+func (*usageMetric) MetricName() string { return "memory_watchdog_usage_ratio" }
+
+var (
+	_ manager.Component      = &Watchdog{}
+	_ manager.StatusReporter = &Watchdog{}
+)
+
+func (watchdog *Watchdog) Options() manager.Options { return &watchdog.options }
+
+func (watchdog *Watchdog) Init() error {
+	watchdog.changeCh = make(chan struct{})
+
+	if !watchdog.options.enable {
+		return nil
+	}
+
+	// SetMemoryLimit with a negative value only reads the current limit.
+	runtimeLimit := debug.SetMemoryLimit(-1)
+
+	watchdog.limit = watchdog.options.limit
+	if watchdog.limit == 0 {
+		if runtimeLimit == math.MaxInt64 {
+			return fmt.Errorf("--memory-watchdog-limit must be set if GOMEMLIMIT is not set")
+		}
+		watchdog.limit = runtimeLimit
+	} else if runtimeLimit == math.MaxInt64 {
+		// let the GC work harder before shedding load
+		debug.SetMemoryLimit(watchdog.limit)
+	}
+
+	if watchdog.readUsage == nil {
+		watchdog.readUsage = readRuntimeUsage
+	}
+
+	kmetrics.NewMonitor(watchdog.Metrics, &usageMetric{}, func() float64 {
+		return float64(watchdog.usage.Load()) / float64(watchdog.limit)
+	})
+
+	return nil
+}
+
+func (watchdog *Watchdog) Start(ctx context.Context) error {
+	if !watchdog.options.enable {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(watchdog.Logger)
+
+		ticker := watchdog.Clock.Tick(watchdog.options.interval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker:
+				watchdog.observe(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (watchdog *Watchdog) Close(ctx context.Context) error { return nil }
+
+func (watchdog *Watchdog) Status() map[string]any {
+	return map[string]any{
+		"level": watchdog.Level().String(),
+		"usage": watchdog.usage.Load(),
+		"limit": watchdog.limit,
+	}
+}
+
+// readRuntimeUsage returns the memory mapped by the Go runtime and not yet returned to the OS,
+// which is the quantity limited by GOMEMLIMIT.
+func readRuntimeUsage() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+func (watchdog *Watchdog) observe(ctx context.Context) {
+	usage := watchdog.readUsage()
+	watchdog.usage.Store(usage)
+	ratio := float64(usage) / float64(watchdog.limit)
+
+	oldLevel := watchdog.Level()
+	newLevel := LevelNormal
+	if ratio >= watchdog.options.hardThreshold {
+		newLevel = LevelHard
+	} else if ratio >= watchdog.options.softThreshold {
+		newLevel = LevelSoft
+	}
+
+	if newLevel < oldLevel && ratio >= watchdog.threshold(oldLevel)-recoveryMargin {
+		newLevel = oldLevel
+	}
+
+	if newLevel == oldLevel {
+		return
+	}
+
+	logger := watchdog.Logger.WithField("usage", usage).WithField("limit", watchdog.limit).WithField("level", newLevel)
+	if newLevel > oldLevel {
+		logger.Warn("Memory pressure increased, shedding load")
+	} else {
+		logger.Info("Memory pressure decreased")
+	}
+	watchdog.LevelMetric.With(&levelMetric{Level: newLevel.String()}).Count(1)
+
+	watchdog.setLevel(newLevel)
+
+	if newLevel > oldLevel {
+		watchdog.flushCaches(ctx, logger)
+	}
+}
+
+func (watchdog *Watchdog) threshold(level Level) float64 {
+	if level == LevelHard {
+		return watchdog.options.hardThreshold
+	}
+	return watchdog.options.softThreshold
+}
+
+func (watchdog *Watchdog) setLevel(level Level) {
+	watchdog.changeMu.Lock()
+	defer watchdog.changeMu.Unlock()
+
+	watchdog.level.Store(int32(level))
+	close(watchdog.changeCh)
+	watchdog.changeCh = make(chan struct{})
+}
+
+// flushCaches drops the in-memory caches of all components and returns the freed memory to the OS.
+func (watchdog *Watchdog) flushCaches(ctx context.Context, logger logrus.FieldLogger) {
+	for _, summary := range watchdog.Manager.Components() {
+		if flusher, ok := summary.Component.(manager.CacheFlusher); ok {
+			if err := flusher.FlushCache(ctx); err != nil {
+				logger.WithError(err).WithField("target", summary.Name).Warn("cannot flush cache")
+			}
+		}
+	}
+
+	debug.FreeOSMemory()
+}
+
+// Level returns the current memory pressure level.
+func (watchdog *Watchdog) Level() Level { return Level(watchdog.level.Load()) }
+
+// Changed returns a channel that is closed when the memory pressure level changes.
+func (watchdog *Watchdog) Changed() <-chan struct{} {
+	watchdog.changeMu.Lock()
+	defer watchdog.changeMu.Unlock()
+
+	return watchdog.changeCh
+}
+
+// Throttle is called before consuming each message to apply backpressure.
+// It sleeps for --memory-watchdog-throttle-delay at the soft level,
+// and waits until the level drops below hard for up to --memory-watchdog-max-pause at the hard level.
+func (watchdog *Watchdog) Throttle(ctx context.Context) {
+	switch watchdog.Level() {
+	case LevelNormal:
+		return
+	case LevelSoft:
+		select {
+		case <-ctx.Done():
+		case <-watchdog.Clock.After(watchdog.options.throttleDelay):
+		}
+		return
+	}
+
+	deadline := watchdog.Clock.After(watchdog.options.maxPause)
+	for {
+		changed := watchdog.Changed()
+		if watchdog.Level() < LevelHard {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-changed:
+		}
+	}
+}
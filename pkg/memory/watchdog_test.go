@@ -0,0 +1,104 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	kmetrics "github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+func TestObserve(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := clocktesting.NewFakeClock(time.Time{})
+	metricsClient, _ := kmetrics.NewMock(clock)
+
+	var usage uint64
+	watchdog := &Watchdog{
+		options: options{
+			enable:        true,
+			softThreshold: 0.8,
+			hardThreshold: 0.9,
+			maxPause:      time.Second,
+		},
+		Logger:      logrus.New(),
+		Clock:       clock,
+		Manager:     manager.New(),
+		Metrics:     metricsClient,
+		LevelMetric: kmetrics.New[*levelMetric](metricsClient),
+		limit:       1000,
+		readUsage:   func() uint64 { return usage },
+		changeCh:    make(chan struct{}),
+	}
+
+	changed := watchdog.Changed()
+	usage = 850
+	watchdog.observe(context.Background())
+	assert.Equal(LevelSoft, watchdog.Level())
+	assert.True(isClosed(changed))
+
+	changed = watchdog.Changed()
+	usage = 950
+	watchdog.observe(context.Background())
+	assert.Equal(LevelHard, watchdog.Level())
+	assert.True(isClosed(changed))
+
+	// within the recovery margin of the hard threshold
+	usage = 870
+	watchdog.observe(context.Background())
+	assert.Equal(LevelHard, watchdog.Level())
+
+	throttled := make(chan struct{})
+	go func() {
+		watchdog.Throttle(context.Background())
+		close(throttled)
+	}()
+
+	usage = 500
+	watchdog.observe(context.Background())
+	assert.Equal(LevelNormal, watchdog.Level())
+
+	select {
+	case <-throttled:
+	case <-time.After(time.Second * 5):
+		assert.Fail("Throttle does not return after the level drops")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	watchdog := &Watchdog{}
+	assert.NoError(watchdog.Init())
+	assert.Equal(LevelNormal, watchdog.Level())
+	watchdog.Throttle(context.Background())
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
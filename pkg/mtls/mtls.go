@@ -0,0 +1,368 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Provides mutual TLS between Kelemetry components.
+//
+// The certificate, key and CA bundle are read from files and reloaded periodically,
+// so they can be rotated by cert-manager or by the SPIRE spiffe-helper without restarting.
+// Peers are authenticated by the CA bundle instead of their hostname,
+// and optionally by the SPIFFE ID in their certificate.
+package mtls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("mtls", manager.Ptr(&Provider{}))
+}
+
+type options struct {
+	enable         bool
+	certFile       string
+	keyFile        string
+	caFile         string
+	allowedIds     []string
+	exemptPaths    []string
+	reloadInterval time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"mtls-enable",
+		false,
+		"serve the HTTP and frontend gRPC servers and dial internal peers and plugins with mutual TLS",
+	)
+	fs.StringVar(&options.certFile, "mtls-cert-file", "", "PEM certificate presented to peers")
+	fs.StringVar(&options.keyFile, "mtls-key-file", "", "PEM private key of --mtls-cert-file")
+	fs.StringVar(&options.caFile, "mtls-ca-file", "", "PEM CA bundle that peer certificates must be signed by")
+	fs.StringSliceVar(
+		&options.allowedIds,
+		"mtls-allowed-spiffe-ids",
+		[]string{},
+		"SPIFFE IDs accepted from peers; an ID ending with '/' accepts all IDs under the path. Empty to accept any peer signed by the CA",
+	)
+	fs.StringSliceVar(
+		&options.exemptPaths,
+		"mtls-exempt-paths",
+		[]string{"/healthz", "/livez", "/readyz"},
+		"HTTP paths that do not require a client certificate, e.g. for kubelet probes",
+	)
+	fs.DurationVar(&options.reloadInterval, "mtls-reload-interval", time.Minute, "interval to reload rotated certificate files")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if !options.enable {
+		return nil
+	}
+	if options.certFile == "" || options.keyFile == "" || options.caFile == "" {
+		return fmt.Errorf("--mtls-cert-file, --mtls-key-file and --mtls-ca-file are required with --mtls-enable")
+	}
+	for _, id := range options.allowedIds {
+		if !strings.HasPrefix(id, "spiffe://") {
+			return fmt.Errorf("--mtls-allowed-spiffe-ids must start with spiffe://, got %q", id)
+		}
+	}
+	return nil
+}
+
+// Provider provides TLS configs backed by the current certificate files.
+// All methods return plaintext configs if mTLS is disabled.
+type Provider struct {
+	options options
+	Logger  logrus.FieldLogger
+	Clock   clock.Clock
+
+	ReloadMetric *metrics.Metric[*reloadMetric]
+
+	current atomic.Pointer[material]
+}
+
+type reloadMetric struct {
+	Error metrics.LabeledError
+}
+
+func (*reloadMetric) MetricName() string { return "mtls_reload" }
+
+type material struct {
+	certPem []byte
+	keyPem  []byte
+	caPem   []byte
+
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+var _ manager.Component = &Provider{}
+
+func (provider *Provider) Options() manager.Options { return &provider.options }
+
+func (provider *Provider) Init() error {
+	if !provider.options.enable {
+		return nil
+	}
+
+	material, err := provider.load()
+	if err != nil {
+		return err
+	}
+	provider.current.Store(material)
+
+	return nil
+}
+
+func (provider *Provider) Start(ctx context.Context) error {
+	if !provider.options.enable {
+		return nil
+	}
+
+	go func() {
+		defer shutdown.RecoverPanic(provider.Logger)
+
+		ticker := provider.Clock.Tick(provider.options.reloadInterval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker:
+				provider.reload()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (provider *Provider) Close(ctx context.Context) error { return nil }
+
+// Enabled returns whether mTLS is enabled.
+func (provider *Provider) Enabled() bool { return provider.options.enable }
+
+func (provider *Provider) load() (*material, error) {
+	certPem, err := os.ReadFile(provider.options.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read --mtls-cert-file: %w", err)
+	}
+	keyPem, err := os.ReadFile(provider.options.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read --mtls-key-file: %w", err)
+	}
+	caPem, err := os.ReadFile(provider.options.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read --mtls-ca-file: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate or key: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("--mtls-ca-file contains no certificates")
+	}
+
+	return &material{certPem: certPem, keyPem: keyPem, caPem: caPem, cert: &cert, pool: pool}, nil
+}
+
+// reload swaps in the certificate files if they have changed.
+// New handshakes use the new material; established connections are not interrupted.
+func (provider *Provider) reload() {
+	metric := &reloadMetric{}
+	defer provider.ReloadMetric.DeferCount(provider.Clock.Now(), metric)
+
+	material, err := provider.load()
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Load")
+		provider.Logger.WithError(err).Warn("cannot reload certificates, keep using previous certificates")
+		return
+	}
+
+	previous := provider.current.Load()
+	if bytes.Equal(material.certPem, previous.certPem) && bytes.Equal(material.keyPem, previous.keyPem) &&
+		bytes.Equal(material.caPem, previous.caPem) {
+		return
+	}
+
+	provider.current.Store(material)
+	provider.Logger.Info("reloaded certificates")
+}
+
+// verifyPeer verifies the peer certificate chain against the current CA bundle and the allowed SPIFFE IDs.
+// Hostnames are not verified because peers are addressed by pod IP.
+func (provider *Provider) verifyPeer(state tls.ConnectionState, usage x509.ExtKeyUsage) error {
+	if len(state.PeerCertificates) == 0 {
+		// only reachable on the HTTP server, where requests without client certificates are rejected by Middleware
+		return nil
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         provider.current.Load().pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return fmt.Errorf("cannot verify peer certificate: %w", err)
+	}
+
+	return provider.checkSpiffeId(leaf)
+}
+
+func (provider *Provider) checkSpiffeId(cert *x509.Certificate) error {
+	if len(provider.options.allowedIds) == 0 {
+		return nil
+	}
+
+	for _, uri := range cert.URIs {
+		id := uri.String()
+		for _, allowed := range provider.options.allowedIds {
+			if id == allowed || strings.HasSuffix(allowed, "/") && strings.HasPrefix(id, allowed) {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("peer certificate has no allowed SPIFFE ID")
+}
+
+func (provider *Provider) serverConfig(clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// verification is done in VerifyConnection against the current CA bundle
+		ClientAuth: clientAuth,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return provider.current.Load().cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return provider.verifyPeer(state, x509.ExtKeyUsageClientAuth)
+		},
+	}
+}
+
+// ClientConfig returns the TLS config for dialing peers, or nil if mTLS is disabled.
+func (provider *Provider) ClientConfig() *tls.Config {
+	if !provider.options.enable {
+		return nil
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the chain is verified in VerifyConnection against the current CA bundle without checking the hostname
+		InsecureSkipVerify: true, //nolint:gosec
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return provider.current.Load().cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			return provider.verifyPeer(state, x509.ExtKeyUsageServerAuth)
+		},
+	}
+}
+
+// HttpServerConfig returns the TLS config of the HTTP server, or nil if mTLS is disabled.
+// Client certificates are optional in the handshake so that exempt paths can be probed without one;
+// Middleware rejects other requests without a verified client certificate.
+func (provider *Provider) HttpServerConfig() *tls.Config {
+	if !provider.options.enable {
+		return nil
+	}
+	return provider.serverConfig(tls.RequestClientCert)
+}
+
+// Middleware rejects HTTP requests without a client certificate outside the exempt paths.
+func (provider *Provider) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !provider.options.enable {
+			return
+		}
+
+		for _, path := range provider.options.exemptPaths {
+			if ctx.Request.URL.Path == path {
+				return
+			}
+		}
+
+		if ctx.Request.TLS == nil || len(ctx.Request.TLS.PeerCertificates) == 0 {
+			provider.Logger.WithField("source", ctx.Request.RemoteAddr).WithField("path", ctx.Request.URL.Path).
+				Warn("Rejected request without client certificate")
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+}
+
+// Scheme returns the URL scheme for HTTP requests to peers.
+func (provider *Provider) Scheme() string {
+	if provider.options.enable {
+		return "https"
+	}
+	return "http"
+}
+
+// ConfigureHttpClient makes the client present the current certificate to peers.
+func (provider *Provider) ConfigureHttpClient(client *http.Client) {
+	if !provider.options.enable {
+		return
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = provider.ClientConfig()
+	client.Transport = transport
+}
+
+// GrpcServerOptions returns the gRPC server options that require client certificates.
+func (provider *Provider) GrpcServerOptions() []grpc.ServerOption {
+	if !provider.options.enable {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(provider.serverConfig(tls.RequireAnyClientCert)))}
+}
+
+// GrpcDialOption returns the transport credentials for dialing gRPC peers.
+func (provider *Provider) GrpcDialOption() grpc.DialOption {
+	if !provider.options.enable {
+		return grpc.WithTransportCredentials(insecure.NewCredentials())
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(provider.ClientConfig()))
+}
@@ -0,0 +1,212 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type testCa struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCa(t *testing.T, name string) *testCa {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCa{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca *testCa) issue(t *testing.T, spiffeId string, serial int64) (certPem []byte, keyPem []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	uri, err := url.Parse(spiffeId)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem
+}
+
+func newTestProvider(t *testing.T, dir string, ca *testCa, spiffeId string, allowedIds []string) *Provider {
+	certPem, keyPem := ca.issue(t, spiffeId, 2)
+	writeMaterial(t, dir, certPem, keyPem, ca.pem)
+
+	clock := clocktesting.NewFakeClock(time.Now())
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	provider := &Provider{
+		options: options{
+			enable:      true,
+			certFile:    filepath.Join(dir, "tls.crt"),
+			keyFile:     filepath.Join(dir, "tls.key"),
+			caFile:      filepath.Join(dir, "ca.crt"),
+			allowedIds:  allowedIds,
+			exemptPaths: []string{"/healthz"},
+		},
+		Logger:       logger,
+		Clock:        clock,
+		ReloadMetric: metrics.New[*reloadMetric](metricsClient),
+	}
+	assert.NoError(t, provider.Init())
+	return provider
+}
+
+func writeMaterial(t *testing.T, dir string, certPem, keyPem, caPem []byte) {
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), certPem, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), keyPem, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), caPem, 0o600))
+}
+
+func TestMutualTls(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCa(t, "kelemetry")
+	serverProvider := newTestProvider(
+		t, t.TempDir(), ca,
+		"spiffe://example.org/kelemetry/collector",
+		[]string{"spiffe://example.org/kelemetry/"},
+	)
+
+	router := gin.New()
+	router.Use(serverProvider.Middleware())
+	router.GET("/healthz", func(ctx *gin.Context) { ctx.String(200, "ok") })
+	router.GET("/admin", func(ctx *gin.Context) { ctx.String(200, "admin") })
+
+	// httptest.Server overrides GetCertificate with its own certificate, so serve manually
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	server := &http.Server{Handler: router, TLSConfig: serverProvider.HttpServerConfig(), ReadHeaderTimeout: time.Second}
+	go func() { _ = server.ServeTLS(listener, "", "") }()
+	defer server.Close()
+	serverUrl := "https://" + listener.Addr().String()
+
+	get := func(provider *Provider, path string) (int, error) {
+		client := &http.Client{}
+		if provider != nil {
+			provider.ConfigureHttpClient(client)
+		} else {
+			client.Transport = &http.Transport{TLSClientConfig: serverProvider.ClientConfig().Clone()}
+			client.Transport.(*http.Transport).TLSClientConfig.GetClientCertificate = nil
+		}
+		resp, err := client.Get(serverUrl + path)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	allowedClient := newTestProvider(t, t.TempDir(), ca, "spiffe://example.org/kelemetry/frontend", nil)
+	status, err := get(allowedClient, "/admin")
+	assert.NoError(err)
+	assert.Equal(200, status)
+
+	// requests without client certificates are only accepted on exempt paths
+	status, err = get(nil, "/healthz")
+	assert.NoError(err)
+	assert.Equal(200, status)
+	status, err = get(nil, "/admin")
+	assert.NoError(err)
+	assert.Equal(401, status)
+
+	// peers outside the allowed SPIFFE IDs are rejected in the handshake
+	otherClient := newTestProvider(t, t.TempDir(), ca, "spiffe://example.org/other", nil)
+	_, err = get(otherClient, "/admin")
+	assert.Error(err)
+
+	// peers signed by another CA are rejected in the handshake
+	untrustedClient := newTestProvider(t, t.TempDir(), newTestCa(t, "other"), "spiffe://example.org/kelemetry/frontend", nil)
+	_, err = get(untrustedClient, "/admin")
+	assert.Error(err)
+}
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	ca := newTestCa(t, "kelemetry")
+	provider := newTestProvider(t, dir, ca, "spiffe://example.org/kelemetry/collector", nil)
+	previous := provider.current.Load()
+
+	// unchanged files are not swapped
+	provider.reload()
+	assert.Same(previous, provider.current.Load())
+
+	// invalid files keep the previous material
+	assert.NoError(os.WriteFile(filepath.Join(dir, "tls.key"), []byte("invalid"), 0o600))
+	provider.reload()
+	assert.Same(previous, provider.current.Load())
+
+	certPem, keyPem := ca.issue(t, "spiffe://example.org/kelemetry/collector", 3)
+	writeMaterial(t, dir, certPem, keyPem, ca.pem)
+	provider.reload()
+	assert.NotSame(previous, provider.current.Load())
+	assert.Equal(certPem, provider.current.Load().certPem)
+}
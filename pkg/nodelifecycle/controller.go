@@ -0,0 +1,170 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Traces node lifecycle changes and cross-links pods under the nodes they run on.
+//
+// Cordon, taint and readiness changes of nodes in the target cluster are sent as events on the Node object span.
+// Together with the pod linker, the trace of a node shows the pods affected by these changes.
+package nodelifecycle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/filter"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/multileader"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("node-lifecycle", manager.Ptr(&controller{}))
+}
+
+var nodeGvr = corev1.SchemeGroupVersion.WithResource("nodes")
+
+type options struct {
+	enable         bool
+	electorOptions multileader.Config
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"node-lifecycle-enable",
+		false,
+		"trace cordon, taint and readiness changes of nodes as events on node object spans",
+	)
+	options.electorOptions.SetupOptions(fs, "node-lifecycle", "node lifecycle controller", 1)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options    options
+	Logger     logrus.FieldLogger
+	Clock      clock.Clock
+	Aggregator aggregator.Aggregator
+	Clients    k8s.Clients
+	Filter     filter.Filter
+	Metrics    metrics.Client
+
+	TransitionMetric *metrics.Metric[*transitionMetric]
+
+	elector *multileader.Elector
+}
+
+var _ manager.Component = &controller{}
+
+type transitionMetric struct {
+	Type  string
+	Error metrics.LabeledError
+}
+
+func (*transitionMetric) MetricName() string { return "node_lifecycle_transition" }
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+
+func (ctrl *controller) Init() (err error) {
+	ctrl.elector, err = multileader.NewElector(
+		"kelemetry-node-lifecycle",
+		ctrl.Logger.WithField("submod", "leader-elector"),
+		ctrl.Clock,
+		&ctrl.options.electorOptions,
+		ctrl.Clients.TargetCluster(),
+		ctrl.Metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create leader elector: %w", err)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Start(ctx context.Context) error {
+	go ctrl.elector.Run(ctx, ctrl.runLeader)
+	go ctrl.elector.RunLeaderMetricLoop(ctx)
+
+	return nil
+}
+
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) runLeader(ctx context.Context) {
+	defer shutdown.RecoverPanic(ctrl.Logger)
+
+	factory := ctrl.Clients.TargetCluster().NewInformerFactory()
+	informer := factory.Core().V1().Nodes().Informer()
+
+	// initial listing does not produce events since the previous state is unknown
+	_, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldNode, oldOk := oldObj.(*corev1.Node)
+			newNode, newOk := newObj.(*corev1.Node)
+			if oldOk && newOk {
+				ctrl.handleUpdate(ctx, oldNode, newNode)
+			}
+		},
+	})
+	if err != nil {
+		ctrl.Logger.WithError(err).Error("cannot add node event handler")
+		return
+	}
+
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+}
+
+func (ctrl *controller) handleUpdate(ctx context.Context, oldNode *corev1.Node, newNode *corev1.Node) {
+	clusterName := ctrl.Clients.TargetCluster().ClusterName()
+
+	if !ctrl.Filter.TestGvk(clusterName, corev1.SchemeGroupVersion.WithKind("Node")) {
+		return
+	}
+
+	object := utilobject.NewRich(clusterName, nodeGvr, "", newNode.Name, newNode.UID)
+
+	for _, transition := range Transitions(oldNode, newNode, ctrl.Clock.Now()) {
+		metric := &transitionMetric{Type: transition.Type}
+
+		event := aggregatorevent.NewEvent(transition.Title, transition.Time, zconstants.TraceSourceNode).
+			SetTag("resourceVersion", newNode.ResourceVersion)
+		for tagKey, tagValue := range transition.Tags {
+			event.SetTag(tagKey, tagValue)
+		}
+		if transition.Message != "" {
+			event.Log(zconstants.LogTypeEventMessage, transition.Message)
+		}
+
+		if err := ctrl.Aggregator.Send(ctx, object, event); err != nil {
+			metric.Error = metrics.LabelError(err, "Send")
+			ctrl.Logger.WithFields(object.AsFields("node")).WithError(err).Error("cannot send node lifecycle event")
+		}
+
+		ctrl.TransitionMetric.With(metric).Count(1)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodelifecycle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("node-pod-linker", manager.Ptr(&podLinker{}), &manager.List[linker.Linker]{})
+}
+
+var podGvr = corev1.SchemeGroupVersion.WithResource("pods")
+
+type linkerOptions struct {
+	enable bool
+}
+
+func (options *linkerOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "node-pod-linker-enable", false, "link pods under the nodes they are scheduled to")
+}
+
+func (options *linkerOptions) EnableFlag() *bool { return &options.enable }
+
+type podLinker struct {
+	options     linkerOptions
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+}
+
+var _ manager.Component = &podLinker{}
+
+func (ctrl *podLinker) Options() manager.Options        { return &ctrl.options }
+func (ctrl *podLinker) Init() error                     { return nil }
+func (ctrl *podLinker) Start(ctx context.Context) error { return nil }
+func (ctrl *podLinker) Close(ctx context.Context) error { return nil }
+
+func (ctrl *podLinker) LinkerName() string { return "node-pod-linker" }
+func (ctrl *podLinker) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	if object.GroupVersionResource().GroupResource() != podGvr.GroupResource() {
+		return nil, nil
+	}
+
+	raw := object.Raw
+	if raw == nil {
+		ctrl.Logger.WithFields(object.AsFields("object")).Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			return nil, nil
+		}
+	}
+
+	nodeName, _, err := unstructured.NestedString(raw.Object, "spec", "nodeName")
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("invalid spec.nodeName: %w", err), "Decode")
+	}
+	if nodeName == "" {
+		// pods are linked to their node in the first span window after they are scheduled
+		return nil, nil
+	}
+
+	return []linker.LinkerResult{{
+		Object:  utilobject.NewRich(object.Cluster, nodeGvr, "", nodeName, ""),
+		Role:    zconstants.LinkRoleParent,
+		Class:   "node",
+		DedupId: "node",
+	}}, nil
+}
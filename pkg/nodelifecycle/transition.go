@@ -0,0 +1,132 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodelifecycle
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Transition is a lifecycle change observed between two versions of a node.
+type Transition struct {
+	// Type is the kind of change, without object-specific details.
+	Type    string
+	Title   string
+	Time    time.Time
+	Tags    map[string]string
+	Message string
+}
+
+// Transitions compares two versions of a node and returns the cordon, taint and readiness changes in between.
+// now is used as the time of changes that do not record their own timestamp.
+func Transitions(oldNode *corev1.Node, newNode *corev1.Node, now time.Time) []Transition {
+	var transitions []Transition
+
+	if oldNode.Spec.Unschedulable != newNode.Spec.Unschedulable {
+		title := "Cordoned"
+		if !newNode.Spec.Unschedulable {
+			title = "Uncordoned"
+		}
+		transitions = append(transitions, Transition{Type: title, Title: title, Time: now, Tags: map[string]string{}})
+	}
+
+	oldTaints := taintSet(oldNode.Spec.Taints)
+	newTaints := taintSet(newNode.Spec.Taints)
+
+	for _, taint := range newNode.Spec.Taints {
+		if _, existed := oldTaints[taintKey(taint)]; existed {
+			continue
+		}
+
+		taintTime := now
+		if taint.TimeAdded != nil {
+			taintTime = taint.TimeAdded.Time
+		}
+		transitions = append(transitions, Transition{
+			Type:  "Tainted",
+			Title: fmt.Sprintf("Tainted %s", taint.ToString()),
+			Time:  taintTime,
+			Tags:  map[string]string{"taint": taint.ToString(), "effect": string(taint.Effect)},
+		})
+	}
+
+	for _, taint := range oldNode.Spec.Taints {
+		if _, exists := newTaints[taintKey(taint)]; exists {
+			continue
+		}
+
+		transitions = append(transitions, Transition{
+			Type:  "Untainted",
+			Title: fmt.Sprintf("Untainted %s", taint.ToString()),
+			Time:  now,
+			Tags:  map[string]string{"taint": taint.ToString(), "effect": string(taint.Effect)},
+		})
+	}
+
+	oldReady := readyCondition(oldNode)
+	newReady := readyCondition(newNode)
+	if newReady != nil && (oldReady == nil || oldReady.Status != newReady.Status) {
+		readyTime := now
+		if !newReady.LastTransitionTime.IsZero() {
+			readyTime = newReady.LastTransitionTime.Time
+		}
+
+		title := "NotReady"
+		switch newReady.Status {
+		case corev1.ConditionTrue:
+			title = "Ready"
+		case corev1.ConditionUnknown:
+			title = "ReadyUnknown"
+		}
+
+		transitions = append(transitions, Transition{
+			Type:    title,
+			Title:   title,
+			Time:    readyTime,
+			Tags:    map[string]string{"reason": newReady.Reason},
+			Message: newReady.Message,
+		})
+	}
+
+	return transitions
+}
+
+type taintIdentity struct {
+	key    string
+	effect corev1.TaintEffect
+}
+
+func taintKey(taint corev1.Taint) taintIdentity {
+	return taintIdentity{key: taint.Key, effect: taint.Effect}
+}
+
+func taintSet(taints []corev1.Taint) map[taintIdentity]struct{} {
+	set := make(map[taintIdentity]struct{}, len(taints))
+	for _, taint := range taints {
+		set[taintKey(taint)] = struct{}{}
+	}
+	return set
+}
+
+func readyCondition(node *corev1.Node) *corev1.NodeCondition {
+	for i := range node.Status.Conditions {
+		if node.Status.Conditions[i].Type == corev1.NodeReady {
+			return &node.Status.Conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nodelifecycle_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/nodelifecycle"
+)
+
+func TestTransitions(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	taintTime := metav1.NewTime(now.Add(-time.Second))
+	readyTime := metav1.NewTime(now.Add(-time.Second * 2))
+
+	oldNode := &corev1.Node{
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule}},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	newNode := &corev1.Node{
+		Spec: corev1.NodeSpec{
+			Unschedulable: true,
+			Taints: []corev1.Taint{
+				{Key: "dedicated", Value: "infra", Effect: corev1.TaintEffectNoSchedule},
+				{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute, TimeAdded: &taintTime},
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{{
+				Type:               corev1.NodeReady,
+				Status:             corev1.ConditionUnknown,
+				Reason:             "NodeStatusUnknown",
+				Message:            "Kubelet stopped posting node status.",
+				LastTransitionTime: readyTime,
+			}},
+		},
+	}
+
+	transitions := nodelifecycle.Transitions(oldNode, newNode, now)
+	assert.Equal(t, []nodelifecycle.Transition{
+		{Type: "Cordoned", Title: "Cordoned", Time: now, Tags: map[string]string{}},
+		{
+			Type:  "Tainted",
+			Title: "Tainted node.kubernetes.io/unreachable:NoExecute",
+			Time:  taintTime.Time,
+			Tags:  map[string]string{"taint": "node.kubernetes.io/unreachable:NoExecute", "effect": "NoExecute"},
+		},
+		{
+			Type:    "ReadyUnknown",
+			Title:   "ReadyUnknown",
+			Time:    readyTime.Time,
+			Tags:    map[string]string{"reason": "NodeStatusUnknown"},
+			Message: "Kubelet stopped posting node status.",
+		},
+	}, transitions)
+
+	transitions = nodelifecycle.Transitions(newNode, oldNode, now)
+	assert.Len(t, transitions, 3)
+	assert.Equal(t, "Uncordoned", transitions[0].Title)
+	assert.Equal(t, "Untainted node.kubernetes.io/unreachable:NoExecute", transitions[1].Title)
+	assert.Equal(t, "Ready", transitions[2].Title)
+	assert.Equal(t, now, transitions[2].Time)
+
+	assert.Empty(t, nodelifecycle.Transitions(oldNode, oldNode.DeepCopy(), now))
+}
@@ -17,6 +17,7 @@ package ownerlinker
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
@@ -40,11 +41,29 @@ func init() {
 }
 
 type options struct {
-	enable bool
+	enable          bool
+	annotationRules []string
+	notFoundGrace   time.Duration
 }
 
 func (options *options) Setup(fs *pflag.FlagSet) {
 	fs.BoolVar(&options.enable, "owner-linker-enable", false, "enable owner linker")
+	fs.StringSliceVar(
+		&options.annotationRules,
+		"owner-linker-annotation-rule",
+		[]string{},
+		"additional owners referenced by annotations in the form '<child>=<owner>@<annotation>', "+
+			"where <child> is [group/]Kind and <owner> is [group/]version/Kind, "+
+			"e.g. 'Secret=cert-manager.io/v1/Certificate@example.com/certificate'; "+
+			"the annotation value is 'namespace/name' for namespaced owners and 'name' for cluster-scoped owners",
+	)
+	fs.DurationVar(
+		&options.notFoundGrace,
+		"owner-linker-not-found-grace",
+		time.Second*5,
+		"retry the lookup of an object not found in the apiserver cache if its event is more recent than this duration, "+
+			"since the cache may not have observed a newly created object yet; older objects are considered deleted",
+	)
 }
 
 func (options *options) EnableFlag() *bool { return &options.enable }
@@ -58,6 +77,8 @@ type Controller struct {
 	ObjectCache    *objectcache.ObjectCache
 	DiffCache      diffcache.Cache
 	LinkerMetric   *metrics.Metric[*linkerMetric]
+
+	annotationRules []AnnotationRule
 }
 
 type linkerMetric struct {
@@ -69,8 +90,19 @@ func (*linkerMetric) MetricName() string { return "owner_linker_lookup" }
 
 var _ manager.Component = &Controller{}
 
-func (ctrl *Controller) Options() manager.Options        { return &ctrl.options }
-func (ctrl *Controller) Init() error                     { return nil }
+func (ctrl *Controller) Options() manager.Options { return &ctrl.options }
+func (ctrl *Controller) Init() error {
+	for _, spec := range ctrl.options.annotationRules {
+		rule, err := ParseAnnotationRule(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --owner-linker-annotation-rule: %w", err)
+		}
+		ctrl.annotationRules = append(ctrl.annotationRules, rule)
+	}
+
+	return nil
+}
+
 func (ctrl *Controller) Start(ctx context.Context) error { return nil }
 func (ctrl *Controller) Close(ctx context.Context) error { return nil }
 
@@ -108,14 +140,14 @@ func (ctrl *Controller) Lookup(ctx context.Context, object utilobject.Rich) ([]l
 		}
 
 		if raw == nil {
-			logger.Debug("object no longer exists")
-			return nil, nil
+			return nil, ctrl.objectNotFound(ctx)
 		}
 	} else {
 		metric.Fetch = "Raw"
 	}
 
 	var results []linker.LinkerResult
+	unknownOwners := 0
 
 	for _, owner := range raw.GetOwnerReferences() {
 		if owner.Controller != nil && *owner.Controller {
@@ -135,22 +167,17 @@ func (ctrl *Controller) Lookup(ctx context.Context, object utilobject.Rich) ([]l
 			gvr, exists := cdc.LookupResource(gvk)
 			if !exists {
 				logger.WithField("gvk", gvk).Warn("Object contains owner reference of unknown GVK")
+				unknownOwners++
 				continue
 			}
 
-			parentRef := utilobject.Rich{
-				VersionedKey: utilobject.VersionedKey{
-					Key: utilobject.Key{
-						Cluster:   object.Cluster,
-						Group:     gvr.Group,
-						Resource:  gvr.Resource,
-						Namespace: object.Namespace,
-						Name:      owner.Name,
-					},
-					Version: gvr.Version,
-				},
-				Uid: owner.UID,
+			// namespaced objects may be owned by cluster-scoped objects, but not the other way round
+			namespace := object.Namespace
+			if !isNamespaced(cdc, gvr) {
+				namespace = ""
 			}
+
+			parentRef := utilobject.NewRich(object.Cluster, gvr, namespace, owner.Name, owner.UID)
 			logger.WithField("owner", parentRef).Debug("Resolved owner")
 
 			results = append(results, linker.LinkerResult{
@@ -162,5 +189,88 @@ func (ctrl *Controller) Lookup(ctx context.Context, object utilobject.Rich) ([]l
 		}
 	}
 
+	results = append(results, ctrl.lookupAnnotationOwners(logger, object, raw)...)
+
+	if len(results) == 0 && unknownOwners > 0 {
+		// discovery may not have observed a newly installed CRD yet
+		return nil, fmt.Errorf("%d owners of unknown GVK: %w", unknownOwners, linker.ErrNotReady)
+	}
+
 	return results, nil
 }
+
+// objectNotFound returns ErrNotReady if an object not found by the snapshot and the apiserver cache may still appear,
+// or nil if the object no longer exists.
+func (ctrl *Controller) objectNotFound(ctx context.Context) error {
+	eventTime, hasEventTime := linker.EventTimeFrom(ctx)
+	if hasEventTime && ctrl.Clock.Since(eventTime) < ctrl.options.notFoundGrace {
+		// the apiserver watch cache may lag behind the event of a newly created object
+		return fmt.Errorf("object not found: %w", linker.ErrNotReady)
+	}
+
+	return nil
+}
+
+func (ctrl *Controller) lookupAnnotationOwners(
+	logger logrus.FieldLogger,
+	object utilobject.Rich,
+	raw *unstructured.Unstructured,
+) []linker.LinkerResult {
+	if len(ctrl.annotationRules) == 0 {
+		return nil
+	}
+
+	childKind := raw.GroupVersionKind().GroupKind()
+	annotations := raw.GetAnnotations()
+
+	var results []linker.LinkerResult
+
+	for _, rule := range ctrl.annotationRules {
+		if rule.ChildKind != childKind {
+			continue
+		}
+
+		value, ok := annotations[rule.Annotation]
+		if !ok {
+			continue
+		}
+
+		ruleLogger := logger.WithField("annotation", rule.Annotation)
+
+		cdc, err := ctrl.DiscoveryCache.ForCluster(object.Cluster)
+		if err != nil {
+			ruleLogger.WithError(err).Error("cannot access cluster from object reference")
+			continue
+		}
+
+		gvr, exists := cdc.LookupResource(rule.OwnerKind)
+		if !exists {
+			ruleLogger.WithField("gvk", rule.OwnerKind).Warn("Annotation rule refers to unknown owner GVK")
+			continue
+		}
+
+		namespace, name, err := parseOwnerValue(value, isNamespaced(cdc, gvr))
+		if err != nil {
+			ruleLogger.WithError(err).Warn("invalid owner annotation")
+			continue
+		}
+
+		parentRef := utilobject.NewRich(object.Cluster, gvr, namespace, name, "")
+		ruleLogger.WithField("owner", parentRef).Debug("Resolved owner from annotation")
+
+		results = append(results, linker.LinkerResult{
+			Object:  parentRef,
+			Role:    zconstants.LinkRoleParent,
+			Class:   "children",
+			DedupId: "ownerAnnotation/" + rule.Annotation,
+		})
+	}
+
+	return results
+}
+
+// isNamespaced returns false only if discovery confirms that the resource is cluster-scoped.
+func isNamespaced(cdc discovery.ClusterDiscoveryCache, gvr schema.GroupVersionResource) bool {
+	details, exists := cdc.GetAll()[gvr]
+	return !exists || details.Namespaced
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ownerlinker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+)
+
+func TestObjectNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Unix(1000, 0)
+	ctrl := &Controller{
+		Clock:   clocktesting.NewFakeClock(now),
+		options: options{notFoundGrace: time.Second * 5},
+	}
+
+	// the apiserver cache may not have observed an object of a recent event yet
+	err := ctrl.objectNotFound(linker.WithEventTime(context.Background(), now.Add(-time.Second)))
+	assert.ErrorIs(err, linker.ErrNotReady)
+
+	// an object of an older event has been deleted
+	assert.NoError(ctrl.objectNotFound(linker.WithEventTime(context.Background(), now.Add(-time.Minute))))
+	assert.NoError(ctrl.objectNotFound(context.Background()))
+}
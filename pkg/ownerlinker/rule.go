@@ -0,0 +1,91 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ownerlinker
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// AnnotationRule declares that objects of ChildKind reference their owner of OwnerKind through an annotation,
+// for ownership relations that cannot be expressed by ownerReferences, such as owners in another namespace.
+//
+// The annotation value is `namespace/name` for namespaced owners and `name` for cluster-scoped owners.
+type AnnotationRule struct {
+	ChildKind  schema.GroupKind
+	OwnerKind  schema.GroupVersionKind
+	Annotation string
+}
+
+// ParseAnnotationRule parses a rule in the form `<child>=<owner>@<annotation>`,
+// where `<child>` is `[group/]Kind` and `<owner>` is `[group/]version/Kind`.
+//
+// For example, `Secret=cert-manager.io/v1/Certificate@example.com/certificate` links a Secret
+// with the annotation `example.com/certificate: ns/name` to the Certificate `name` in namespace `ns`.
+func ParseAnnotationRule(spec string) (AnnotationRule, error) {
+	child, rest, ok := strings.Cut(spec, "=")
+	if !ok {
+		return AnnotationRule{}, fmt.Errorf("expected '=' in %q", spec)
+	}
+
+	owner, annotation, ok := strings.Cut(rest, "@")
+	if !ok || annotation == "" {
+		return AnnotationRule{}, fmt.Errorf("expected '@<annotation>' in %q", spec)
+	}
+
+	rule := AnnotationRule{Annotation: annotation}
+
+	switch segments := strings.Split(child, "/"); len(segments) {
+	case 1:
+		rule.ChildKind = schema.GroupKind{Kind: segments[0]}
+	case 2:
+		rule.ChildKind = schema.GroupKind{Group: segments[0], Kind: segments[1]}
+	default:
+		return AnnotationRule{}, fmt.Errorf("invalid child kind %q", child)
+	}
+
+	switch segments := strings.Split(owner, "/"); len(segments) {
+	case 2:
+		rule.OwnerKind = schema.GroupVersionKind{Version: segments[0], Kind: segments[1]}
+	case 3:
+		rule.OwnerKind = schema.GroupVersionKind{Group: segments[0], Version: segments[1], Kind: segments[2]}
+	default:
+		return AnnotationRule{}, fmt.Errorf("invalid owner kind %q", owner)
+	}
+
+	if rule.ChildKind.Kind == "" || rule.OwnerKind.Version == "" || rule.OwnerKind.Kind == "" {
+		return AnnotationRule{}, fmt.Errorf("empty segment in %q", spec)
+	}
+
+	return rule, nil
+}
+
+// parseOwnerValue parses the annotation value into the owner namespace and name.
+func parseOwnerValue(value string, namespaced bool) (namespace string, name string, err error) {
+	if !namespaced {
+		if value == "" || strings.Contains(value, "/") {
+			return "", "", fmt.Errorf("expected name of cluster-scoped owner, got %q", value)
+		}
+		return "", value, nil
+	}
+
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("expected namespace/name of namespaced owner, got %q", value)
+	}
+	return namespace, name, nil
+}
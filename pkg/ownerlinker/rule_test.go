@@ -0,0 +1,69 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ownerlinker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseAnnotationRule(t *testing.T) {
+	rule, err := ParseAnnotationRule("Secret=cert-manager.io/v1/Certificate@example.com/certificate")
+	assert.NoError(t, err)
+	assert.Equal(t, AnnotationRule{
+		ChildKind:  schema.GroupKind{Kind: "Secret"},
+		OwnerKind:  schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"},
+		Annotation: "example.com/certificate",
+	}, rule)
+
+	rule, err = ParseAnnotationRule("apps/Deployment=v1/Namespace@owner")
+	assert.NoError(t, err)
+	assert.Equal(t, AnnotationRule{
+		ChildKind:  schema.GroupKind{Group: "apps", Kind: "Deployment"},
+		OwnerKind:  schema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+		Annotation: "owner",
+	}, rule)
+
+	for _, spec := range []string{
+		"Secret",
+		"Secret=v1/ConfigMap",
+		"Secret=v1/ConfigMap@",
+		"Secret=ConfigMap@owner",
+		"a/b/Secret=v1/ConfigMap@owner",
+		"=v1/ConfigMap@owner",
+	} {
+		_, err := ParseAnnotationRule(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestParseOwnerValue(t *testing.T) {
+	namespace, name, err := parseOwnerValue("ns/name", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "ns", namespace)
+	assert.Equal(t, "name", name)
+
+	namespace, name, err = parseOwnerValue("name", false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", namespace)
+	assert.Equal(t, "name", name)
+
+	_, _, err = parseOwnerValue("name", true)
+	assert.Error(t, err)
+	_, _, err = parseOwnerValue("ns/name", false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,299 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loads implementations of extension points from external plugin binaries.
+//
+// A plugin binary calls Serve with the implementations it provides,
+// and is launched by the Host component from the --plugin-dir directory.
+// Each extension point registers a Kind that defines the RPC protocol between Kelemetry and the plugin.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/mtls"
+)
+
+func init() {
+	manager.Global.Provide("plugin-host", manager.Ptr(&Host{}))
+}
+
+// Handshake is shared between Kelemetry and plugins to reject executables that are not Kelemetry plugins.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "KELEMETRY_PLUGIN",
+	MagicCookieValue: "d2f4a6c1-kelemetry",
+}
+
+const infoKind = "info"
+
+// Kind creates the go-plugin Plugin for an extension point.
+// impls maps implementation names to implementations on the plugin side, and is nil on the Kelemetry side.
+type Kind func(impls map[string]any) goplugin.Plugin
+
+var (
+	kindsMu sync.Mutex
+	kinds   = map[string]Kind{}
+)
+
+// RegisterKind registers an extension point that can be implemented by plugins.
+// It should be called in init() by both Kelemetry and the plugin binaries.
+func RegisterKind(name string, kind Kind) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+
+	if name == infoKind {
+		panic(fmt.Sprintf("plugin kind %q is reserved", name))
+	}
+	if _, exists := kinds[name]; exists {
+		panic(fmt.Sprintf("plugin kind %q is registered twice", name))
+	}
+	kinds[name] = kind
+}
+
+func pluginSet(implsByKind map[string]map[string]any) goplugin.PluginSet {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+
+	set := goplugin.PluginSet{}
+	infos := []ImplInfo{}
+	for name, kind := range kinds {
+		set[name] = kind(implsByKind[name])
+		for implName := range implsByKind[name] {
+			infos = append(infos, ImplInfo{Kind: name, Name: implName})
+		}
+	}
+	set[infoKind] = &infoPlugin{infos: infos}
+	return set
+}
+
+// Impl is an implementation served by a plugin binary.
+type Impl struct {
+	// Kind is the name of the extension point implemented.
+	Kind string
+	// Name is the name used to select this implementation in the options.
+	Name string
+	// Impl implements the interface required by the Kind.
+	Impl any
+}
+
+// Serve is called from the main function of a plugin binary to serve the implementations.
+// It does not return until Kelemetry terminates the plugin.
+func Serve(impls ...Impl) {
+	implsByKind := map[string]map[string]any{}
+	for _, impl := range impls {
+		if implsByKind[impl.Kind] == nil {
+			implsByKind[impl.Kind] = map[string]any{}
+		}
+		implsByKind[impl.Kind][impl.Name] = impl.Impl
+	}
+
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         pluginSet(implsByKind),
+	})
+}
+
+type options struct {
+	dir string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(&options.dir, "plugin-dir", "", "directory containing plugin executables that provide additional implementations")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+// Host launches the plugin binaries and dispenses their implementations.
+// It is only enabled if a component depends on it, i.e. a plugin implementation is selected.
+type Host struct {
+	options options
+	Logger  logrus.FieldLogger
+	Mtls    *mtls.Provider
+
+	plugins []loadedPlugin
+	impls   map[ImplInfo]goplugin.ClientProtocol
+}
+
+type loadedPlugin struct {
+	path   string
+	client *goplugin.Client
+}
+
+var _ manager.Component = &Host{}
+
+func (host *Host) Options() manager.Options { return &host.options }
+
+func (host *Host) Init() error {
+	host.impls = map[ImplInfo]goplugin.ClientProtocol{}
+
+	if host.options.dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(host.options.dir)
+	if err != nil {
+		return fmt.Errorf("cannot read --plugin-dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("cannot stat plugin %q: %w", entry.Name(), err)
+		}
+		if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+
+		if err := host.load(filepath.Join(host.options.dir, entry.Name())); err != nil {
+			return fmt.Errorf("cannot load plugin %q: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func (host *Host) load(path string) error {
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         pluginSet(nil),
+		Cmd:             exec.Command(path),
+		// plugins run as subprocesses, so they authenticate with ephemeral certificates instead of --mtls-cert-file
+		AutoMTLS: host.Mtls.Enabled(),
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:  filepath.Base(path),
+			Level: hclog.Info,
+		}),
+	})
+	host.plugins = append(host.plugins, loadedPlugin{path: path, client: client})
+
+	protocol, err := client.Client()
+	if err != nil {
+		return err
+	}
+
+	raw, err := protocol.Dispense(infoKind)
+	if err != nil {
+		return err
+	}
+
+	infos, err := raw.(*infoClient).impls()
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		if _, exists := host.impls[info]; exists {
+			return fmt.Errorf("%s implementation %q is provided by multiple plugins", info.Kind, info.Name)
+		}
+		host.impls[info] = protocol
+		host.Logger.WithField("path", path).WithField("kind", info.Kind).WithField("name", info.Name).Info("Loaded plugin implementation")
+	}
+
+	return nil
+}
+
+func (host *Host) Start(ctx context.Context) error { return nil }
+
+func (host *Host) Close(ctx context.Context) error {
+	for _, plugin := range host.plugins {
+		plugin.client.Kill()
+	}
+	return nil
+}
+
+// CheckLiveness reports plugin processes that have exited.
+func (host *Host) CheckLiveness(ctx context.Context) error {
+	for _, plugin := range host.plugins {
+		if plugin.client.Exited() {
+			return fmt.Errorf("plugin %q has exited", plugin.path)
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the loaded implementations of a kind.
+func (host *Host) Names(kind string) []string {
+	names := []string{}
+	for info := range host.impls {
+		if info.Kind == kind {
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dispense returns the client created by the Kind for the plugin that provides the named implementation.
+// The client is shared by all implementations of the same kind in the same plugin.
+func (host *Host) Dispense(kind string, name string) (any, error) {
+	protocol, exists := host.impls[ImplInfo{Kind: kind, Name: name}]
+	if !exists {
+		return nil, fmt.Errorf("no plugin provides %s implementation %q, available implementations are %q", kind, name, host.Names(kind))
+	}
+
+	return protocol.Dispense(kind)
+}
+
+// ImplInfo identifies an implementation provided by a plugin.
+type ImplInfo struct {
+	Kind string
+	Name string
+}
+
+type infoPlugin struct {
+	infos []ImplInfo
+}
+
+func (p *infoPlugin) Server(*goplugin.MuxBroker) (any, error) {
+	return &infoServer{infos: p.infos}, nil
+}
+
+func (*infoPlugin) Client(_ *goplugin.MuxBroker, client *rpc.Client) (any, error) {
+	return &infoClient{client: client}, nil
+}
+
+type infoServer struct {
+	infos []ImplInfo
+}
+
+func (server *infoServer) Impls(_ struct{}, resp *[]ImplInfo) error {
+	*resp = server.infos
+	return nil
+}
+
+type infoClient struct {
+	client *rpc.Client
+}
+
+func (client *infoClient) impls() ([]ImplInfo, error) {
+	var infos []ImplInfo
+	if err := client.client.Call("Plugin.Impls", struct{}{}, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
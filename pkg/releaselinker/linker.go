@@ -0,0 +1,188 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Groups top-level objects deployed by the same Helm release or Argo CD application under a common parent.
+package releaselinker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("release-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+// HelmReleaseGvr is the synthetic resource identifying a Helm release.
+// Objects of this resource do not exist in the apiserver and only appear as trace roots.
+var HelmReleaseGvr = schema.GroupVersionResource{
+	Group:    "kelemetry.kubewharf.io",
+	Version:  "v1",
+	Resource: "helmreleases",
+}
+
+var argoApplicationGvr = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "applications",
+}
+
+const (
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	helmChartLabel                 = "helm.sh/chart"
+	instanceLabel                  = "app.kubernetes.io/instance"
+	argoTrackingIdAnnotation       = "argocd.argoproj.io/tracking-id"
+)
+
+type options struct {
+	enable            bool
+	argoNamespace     string
+	argoLabelTracking bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "release-linker-enable", false, "enable linker for Helm releases and Argo CD applications")
+	fs.StringVar(
+		&options.argoNamespace,
+		"release-linker-argocd-namespace",
+		"argocd",
+		"namespace of Argo CD applications not qualified with a namespace in their tracking ID",
+	)
+	fs.BoolVar(
+		&options.argoLabelTracking,
+		"release-linker-argocd-label-tracking",
+		false,
+		"treat the app.kubernetes.io/instance label of objects not managed by Helm as the Argo CD application name",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options     options
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options        { return &ctrl.options }
+func (ctrl *controller) Init() error                     { return nil }
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) LinkerName() string { return "release-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	if object.GroupVersionResource() == HelmReleaseGvr {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	// objects created by controllers are grouped through their owners
+	if metav1.GetControllerOf(raw) != nil {
+		return nil, nil
+	}
+
+	release, found := ctrl.resolve(object.Cluster, raw)
+	if !found {
+		return nil, nil
+	}
+
+	logger.WithFields(release.AsFields("release")).Debug("Resolved release")
+
+	return []linker.LinkerResult{{
+		Object:  release,
+		Role:    zconstants.LinkRoleParent,
+		Class:   "release",
+		DedupId: "release",
+	}}, nil
+}
+
+func (ctrl *controller) resolve(cluster string, raw *unstructured.Unstructured) (utilobject.Rich, bool) {
+	annotations := raw.GetAnnotations()
+	labels := raw.GetLabels()
+
+	if trackingId, ok := annotations[argoTrackingIdAnnotation]; ok {
+		if namespace, name, ok := ctrl.parseArgoAppName(strings.SplitN(trackingId, ":", 2)[0]); ok {
+			return utilobject.NewRich(cluster, argoApplicationGvr, namespace, name, ""), true
+		}
+	}
+
+	if name := annotations[helmReleaseNameAnnotation]; name != "" {
+		namespace := annotations[helmReleaseNamespaceAnnotation]
+		if namespace == "" {
+			namespace = raw.GetNamespace()
+		}
+		return utilobject.NewRich(cluster, HelmReleaseGvr, namespace, name, ""), true
+	}
+
+	instance := labels[instanceLabel]
+	if instance == "" {
+		return utilobject.Rich{}, false
+	}
+
+	if _, isHelm := labels[helmChartLabel]; isHelm {
+		return utilobject.NewRich(cluster, HelmReleaseGvr, raw.GetNamespace(), instance, ""), true
+	}
+
+	if ctrl.options.argoLabelTracking {
+		if namespace, name, ok := ctrl.parseArgoAppName(instance); ok {
+			return utilobject.NewRich(cluster, argoApplicationGvr, namespace, name, ""), true
+		}
+	}
+
+	return utilobject.Rich{}, false
+}
+
+// parseArgoAppName parses an application name in the form `name` or `namespace_name`.
+func (ctrl *controller) parseArgoAppName(appName string) (namespace string, name string, ok bool) {
+	namespace, name, qualified := strings.Cut(appName, "_")
+	if !qualified {
+		namespace, name = ctrl.options.argoNamespace, appName
+	}
+
+	return namespace, name, namespace != "" && name != ""
+}
@@ -0,0 +1,337 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Traces rollouts of Deployments and StatefulSets as spans from the spec change to all replicas ready.
+//
+// A rollout starts when the generation of the workload changes and ends when all replicas are updated and ready,
+// or fails when the progress deadline is exceeded, the timeout is reached or a newer spec change supersedes it.
+// The rollout span is sent to the workload trace and its duration is recorded in a histogram per workload.
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/filter"
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/k8s/multileader"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.Provide("rollout-slo", manager.Ptr(&controller{}))
+}
+
+var (
+	deploymentGvr  = appsv1.SchemeGroupVersion.WithResource("deployments")
+	statefulSetGvr = appsv1.SchemeGroupVersion.WithResource("statefulsets")
+)
+
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type options struct {
+	enable         bool
+	timeout        time.Duration
+	checkInterval  time.Duration
+	electorOptions multileader.Config
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"rollout-slo-enable",
+		false,
+		"trace the interval from deployment and statefulset spec changes to all replicas ready as rollout spans",
+	)
+	fs.DurationVar(&options.timeout, "rollout-slo-timeout", time.Minute*30, "duration after which an incomplete rollout is reported as failed")
+	fs.DurationVar(&options.checkInterval, "rollout-slo-check-interval", time.Minute, "interval for checking rollout timeouts")
+	options.electorOptions.SetupOptions(fs, "rollout-slo", "rollout SLO controller", 1)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options    options
+	Logger     logrus.FieldLogger
+	Clock      clock.Clock
+	Aggregator aggregator.Aggregator
+	Clients    k8s.Clients
+	Filter     filter.Filter
+	Metrics    metrics.Client
+
+	RolloutMetric *metrics.Metric[*rolloutMetric]
+
+	elector *multileader.Elector
+
+	pendingMu sync.Mutex
+	pending   map[utilobject.Key]*pendingRollout
+}
+
+var _ manager.Component = &controller{}
+
+type rolloutMetric struct {
+	Cluster   string
+	Resource  string
+	Namespace string
+	Name      string
+	Status    string
+	Error     metrics.LabeledError
+}
+
+func (*rolloutMetric) MetricName() string { return "rollout_duration" }
+
+type pendingRollout struct {
+	object     utilobject.Rich
+	generation int64
+	start      time.Time
+}
+
+type finishedRollout struct {
+	pendingRollout
+	end     time.Time
+	status  string
+	reason  string
+	message string
+}
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+
+func (ctrl *controller) Init() (err error) {
+	if ctrl.options.checkInterval <= 0 {
+		return fmt.Errorf("--rollout-slo-check-interval must be positive")
+	}
+
+	ctrl.elector, err = multileader.NewElector(
+		"kelemetry-rollout-slo",
+		ctrl.Logger.WithField("submod", "leader-elector"),
+		ctrl.Clock,
+		&ctrl.options.electorOptions,
+		ctrl.Clients.TargetCluster(),
+		ctrl.Metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create leader elector: %w", err)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Start(ctx context.Context) error {
+	go ctrl.elector.Run(ctx, ctrl.runLeader)
+	go ctrl.elector.RunLeaderMetricLoop(ctx)
+
+	return nil
+}
+
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) runLeader(ctx context.Context) {
+	defer shutdown.RecoverPanic(ctrl.Logger)
+
+	// rollouts started in a previous leader term cannot be timed accurately
+	ctrl.pendingMu.Lock()
+	ctrl.pending = map[utilobject.Key]*pendingRollout{}
+	ctrl.pendingMu.Unlock()
+
+	clusterName := ctrl.Clients.TargetCluster().ClusterName()
+	factory := ctrl.Clients.TargetCluster().NewInformerFactory()
+
+	// initial listing does not start rollouts since the time of the spec change is unknown
+	_, err := factory.Apps().V1().Deployments().Informer().AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldDeploy, oldOk := oldObj.(*appsv1.Deployment)
+			newDeploy, newOk := newObj.(*appsv1.Deployment)
+			if oldOk && newOk {
+				object := utilobject.NewRich(clusterName, deploymentGvr, newDeploy.Namespace, newDeploy.Name, newDeploy.UID)
+				ctrl.handleUpdate(ctx, object, oldDeploy.Generation, newDeploy.Generation, DeploymentProgress(newDeploy))
+			}
+		},
+		DeleteFunc: func(obj any) { ctrl.handleDelete(ctx, clusterName, deploymentGvr, obj) },
+	})
+	if err != nil {
+		ctrl.Logger.WithError(err).Error("cannot add deployment event handler")
+		return
+	}
+
+	_, err = factory.Apps().V1().StatefulSets().Informer().AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			oldSts, oldOk := oldObj.(*appsv1.StatefulSet)
+			newSts, newOk := newObj.(*appsv1.StatefulSet)
+			if oldOk && newOk {
+				object := utilobject.NewRich(clusterName, statefulSetGvr, newSts.Namespace, newSts.Name, newSts.UID)
+				ctrl.handleUpdate(ctx, object, oldSts.Generation, newSts.Generation, StatefulSetProgress(newSts))
+			}
+		},
+		DeleteFunc: func(obj any) { ctrl.handleDelete(ctx, clusterName, statefulSetGvr, obj) },
+	})
+	if err != nil {
+		ctrl.Logger.WithError(err).Error("cannot add statefulset event handler")
+		return
+	}
+
+	factory.Start(ctx.Done())
+	wait.UntilWithContext(ctx, ctrl.checkTimeouts, ctrl.options.checkInterval)
+	factory.Shutdown()
+}
+
+func (ctrl *controller) handleUpdate(ctx context.Context, object utilobject.Rich, oldGeneration, newGeneration int64, progress Progress) {
+	if !ctrl.Filter.TestGvr(object.GroupVersionResource()) {
+		return
+	}
+
+	now := ctrl.Clock.Now()
+	var finished []finishedRollout
+
+	ctrl.pendingMu.Lock()
+
+	rollout := ctrl.pending[object.Key]
+
+	if newGeneration > oldGeneration {
+		if rollout != nil {
+			finished = append(finished, finishedRollout{
+				pendingRollout: *rollout,
+				end:            now,
+				status:         StatusFailed,
+				reason:         "Superseded",
+				message:        fmt.Sprintf("superseded by generation %d before completion", newGeneration),
+			})
+		}
+
+		rollout = &pendingRollout{object: object, generation: newGeneration, start: now}
+		ctrl.pending[object.Key] = rollout
+	}
+
+	if rollout != nil && (progress.Done || progress.Failed != "") {
+		result := finishedRollout{pendingRollout: *rollout, end: now, status: StatusSucceeded, message: progress.Message}
+		if !progress.Done {
+			result.status = StatusFailed
+			result.reason = progress.Failed
+		}
+
+		finished = append(finished, result)
+		delete(ctrl.pending, object.Key)
+	}
+
+	ctrl.pendingMu.Unlock()
+
+	for _, result := range finished {
+		ctrl.send(ctx, result)
+	}
+}
+
+func (ctrl *controller) handleDelete(ctx context.Context, clusterName string, gvr schema.GroupVersionResource, obj any) {
+	key, err := toolscache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	namespace, name, err := toolscache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return
+	}
+
+	object := utilobject.NewRich(clusterName, gvr, namespace, name, "")
+
+	ctrl.pendingMu.Lock()
+	rollout, exists := ctrl.pending[object.Key]
+	delete(ctrl.pending, object.Key)
+	ctrl.pendingMu.Unlock()
+
+	if exists {
+		ctrl.send(ctx, finishedRollout{
+			pendingRollout: *rollout,
+			end:            ctrl.Clock.Now(),
+			status:         StatusFailed,
+			reason:         "Deleted",
+			message:        "workload deleted before completion",
+		})
+	}
+}
+
+func (ctrl *controller) checkTimeouts(ctx context.Context) {
+	now := ctrl.Clock.Now()
+	var finished []finishedRollout
+
+	ctrl.pendingMu.Lock()
+	for key, rollout := range ctrl.pending {
+		if now.Sub(rollout.start) >= ctrl.options.timeout {
+			finished = append(finished, finishedRollout{
+				pendingRollout: *rollout,
+				end:            now,
+				status:         StatusFailed,
+				reason:         "Timeout",
+				message:        fmt.Sprintf("not completed within %s", ctrl.options.timeout),
+			})
+			delete(ctrl.pending, key)
+		}
+	}
+	ctrl.pendingMu.Unlock()
+
+	for _, result := range finished {
+		ctrl.send(ctx, result)
+	}
+}
+
+func (ctrl *controller) send(ctx context.Context, result finishedRollout) {
+	metric := &rolloutMetric{
+		Cluster:   result.object.Cluster,
+		Resource:  result.object.Resource,
+		Namespace: result.object.Namespace,
+		Name:      result.object.Name,
+		Status:    result.status,
+	}
+
+	duration := result.end.Sub(result.start)
+
+	event := aggregatorevent.NewEvent(fmt.Sprintf("Rollout generation %d", result.generation), result.start, zconstants.TraceSourceAnalysis).
+		SetEndTime(result.end).
+		SetTag("generation", result.generation).
+		SetTag("status", result.status).
+		SetTag("duration", duration.String()).
+		SetTag("tag", "rollout")
+
+	if result.status == StatusFailed {
+		event.SetTag("error", true).
+			SetTag("reason", result.reason).
+			Log(zconstants.LogTypeRealError, result.message)
+	} else {
+		event.Log(zconstants.LogTypeRealVerbose, result.message)
+	}
+
+	if err := ctrl.Aggregator.Send(ctx, result.object, event); err != nil {
+		metric.Error = metrics.LabelError(err, "Send")
+		ctrl.Logger.WithFields(result.object.AsFields("workload")).WithError(err).Error("cannot send rollout event")
+	}
+
+	ctrl.RolloutMetric.With(metric).Histogram(duration.Seconds())
+}
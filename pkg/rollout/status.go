@@ -0,0 +1,98 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// Progress is the rollout state of a workload generation.
+type Progress struct {
+	// Done indicates that all replicas of the generation are updated and ready.
+	Done bool
+	// Failed is the reason that the rollout of the generation cannot complete, or empty if it may still complete.
+	Failed string
+	// Message explains the current progress.
+	Message string
+}
+
+// DeploymentProgress returns the rollout progress of the current generation of a deployment.
+func DeploymentProgress(deploy *appsv1.Deployment) Progress {
+	if deploy.Status.ObservedGeneration < deploy.Generation {
+		return Progress{Message: "waiting for the deployment controller to observe the spec change"}
+	}
+
+	for _, cond := range deploy.Status.Conditions {
+		if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+			return Progress{Failed: cond.Reason, Message: cond.Message}
+		}
+	}
+
+	replicas := replicasOf(deploy.Spec.Replicas)
+	status := deploy.Status
+
+	if status.UpdatedReplicas < replicas {
+		return Progress{Message: fmt.Sprintf("%d of %d replicas updated", status.UpdatedReplicas, replicas)}
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return Progress{Message: fmt.Sprintf("%d old replicas pending termination", status.Replicas-status.UpdatedReplicas)}
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return Progress{Message: fmt.Sprintf("%d of %d updated replicas available", status.AvailableReplicas, status.UpdatedReplicas)}
+	}
+
+	return Progress{Done: true, Message: fmt.Sprintf("%d replicas updated and available", replicas)}
+}
+
+// StatefulSetProgress returns the rollout progress of the current generation of a statefulset.
+func StatefulSetProgress(sts *appsv1.StatefulSet) Progress {
+	if sts.Status.ObservedGeneration < sts.Generation {
+		return Progress{Message: "waiting for the statefulset controller to observe the spec change"}
+	}
+
+	replicas := replicasOf(sts.Spec.Replicas)
+	status := sts.Status
+
+	expectUpdated := replicas
+	if strategy := sts.Spec.UpdateStrategy; strategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+		strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil {
+		expectUpdated = replicas - *strategy.RollingUpdate.Partition
+		if expectUpdated < 0 {
+			expectUpdated = 0
+		}
+	}
+
+	if status.UpdatedReplicas < expectUpdated {
+		return Progress{Message: fmt.Sprintf("%d of %d replicas updated", status.UpdatedReplicas, expectUpdated)}
+	}
+	if expectUpdated == replicas && status.UpdateRevision != "" && status.CurrentRevision != status.UpdateRevision {
+		return Progress{Message: fmt.Sprintf("waiting for revision %s to become current", status.UpdateRevision)}
+	}
+	if status.ReadyReplicas < replicas {
+		return Progress{Message: fmt.Sprintf("%d of %d replicas ready", status.ReadyReplicas, replicas)}
+	}
+
+	return Progress{Done: true, Message: fmt.Sprintf("%d replicas updated and ready", replicas)}
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+
+	return *replicas
+}
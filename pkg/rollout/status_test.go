@@ -0,0 +1,88 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/utils/pointer"
+
+	"github.com/kubewharf/kelemetry/pkg/rollout"
+)
+
+func TestDeploymentProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	deploy := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: pointer.Int32(3)}}
+	deploy.Generation = 2
+	deploy.Status.ObservedGeneration = 1
+	assert.False(rollout.DeploymentProgress(deploy).Done)
+
+	deploy.Status.ObservedGeneration = 2
+	deploy.Status.Replicas = 4
+	deploy.Status.UpdatedReplicas = 3
+	deploy.Status.AvailableReplicas = 3
+	assert.Equal("1 old replicas pending termination", rollout.DeploymentProgress(deploy).Message)
+
+	deploy.Status.Replicas = 3
+	deploy.Status.AvailableReplicas = 2
+	assert.False(rollout.DeploymentProgress(deploy).Done)
+
+	deploy.Status.AvailableReplicas = 3
+	assert.True(rollout.DeploymentProgress(deploy).Done)
+
+	deploy.Status.UpdatedReplicas = 1
+	deploy.Status.Conditions = []appsv1.DeploymentCondition{{
+		Type:    appsv1.DeploymentProgressing,
+		Reason:  "ProgressDeadlineExceeded",
+		Message: "ReplicaSet has timed out progressing.",
+	}}
+	progress := rollout.DeploymentProgress(deploy)
+	assert.False(progress.Done)
+	assert.Equal("ProgressDeadlineExceeded", progress.Failed)
+}
+
+func TestStatefulSetProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	sts := &appsv1.StatefulSet{Spec: appsv1.StatefulSetSpec{
+		Replicas: pointer.Int32(3),
+		UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+			Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		},
+	}}
+	sts.Generation = 2
+	sts.Status = appsv1.StatefulSetStatus{
+		ObservedGeneration: 2,
+		UpdatedReplicas:    3,
+		ReadyReplicas:      3,
+		CurrentRevision:    "rev1",
+		UpdateRevision:     "rev2",
+	}
+	assert.False(rollout.StatefulSetProgress(sts).Done)
+
+	sts.Status.CurrentRevision = "rev2"
+	assert.True(rollout.StatefulSetProgress(sts).Done)
+
+	sts.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: pointer.Int32(2)}
+	sts.Status.UpdatedReplicas = 1
+	sts.Status.CurrentRevision = "rev1"
+	assert.True(rollout.StatefulSetProgress(sts).Done)
+
+	sts.Status.ReadyReplicas = 2
+	assert.False(rollout.StatefulSetProgress(sts).Done)
+}
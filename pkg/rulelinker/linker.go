@@ -0,0 +1,201 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links objects to parents or children extracted by declarative rules.
+//
+// This covers CRDs that reference related objects by name in a field, label or annotation
+// without writing a linker for each type.
+package rulelinker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/discovery"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("rule-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	configFile string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(&options.configFile, "rule-linker-config", "", "path to the rule linker config file; the linker is disabled if empty")
+}
+
+func (options *options) EnableFlag() *bool {
+	hasConfig := options.configFile != ""
+	return &hasConfig
+}
+
+type controller struct {
+	options        options
+	Logger         logrus.FieldLogger
+	DiscoveryCache discovery.DiscoveryCache
+	ObjectCache    *objectcache.ObjectCache
+
+	rules []*compiledRule
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options { return &ctrl.options }
+
+func (ctrl *controller) Init() error {
+	yamlBytes, err := os.ReadFile(ctrl.options.configFile)
+	if err != nil {
+		return fmt.Errorf("cannot read rule linker config: %w", err)
+	}
+
+	jsonBytes, err := yaml.ToJSON(yamlBytes)
+	if err != nil {
+		return fmt.Errorf("parse rule linker config YAML error: %w", err)
+	}
+
+	config := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("parse rule linker config error: %w", err)
+	}
+
+	ctrl.rules, err = compileConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid rule linker config: %w", err)
+	}
+
+	return nil
+}
+
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+func (ctrl *controller) LinkerName() string { return "rule-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	cdc, err := ctrl.DiscoveryCache.ForCluster(object.Cluster)
+	if err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot get discovery cache: %w", err), "DiscoveryCache")
+	}
+
+	gvk, _ := cdc.LookupKind(object.GroupVersionResource())
+
+	var matched []*compiledRule
+	for _, rule := range ctrl.rules {
+		if rule.matches(object.GroupVersionResource(), gvk.Kind) {
+			matched = append(matched, rule)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, nil
+	}
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	var results []linker.LinkerResult
+	for _, rule := range matched {
+		for _, links := range rule.targets {
+			name, err := links.name(raw)
+			if err != nil {
+				return nil, metrics.LabelError(fmt.Errorf("rule %q: cannot extract name: %w", rule.name, err), "Extract")
+			}
+			if name == "" {
+				continue
+			}
+
+			namespace := ""
+			if links.namespace != nil {
+				namespace, err = links.namespace(raw)
+				if err != nil {
+					return nil, metrics.LabelError(fmt.Errorf("rule %q: cannot extract namespace: %w", rule.name, err), "Extract")
+				}
+			} else if !links.target.ClusterScoped {
+				namespace = object.Namespace
+			}
+
+			gvr, err := resolveTarget(cdc, links.target)
+			if err != nil {
+				return nil, metrics.LabelError(fmt.Errorf("rule %q: %w", rule.name, err), "ResolveTarget")
+			}
+
+			linked := utilobject.Rich{
+				VersionedKey: utilobject.VersionedKey{
+					Key: utilobject.Key{
+						Cluster:   object.Cluster,
+						Group:     gvr.Group,
+						Resource:  gvr.Resource,
+						Namespace: namespace,
+						Name:      name,
+					},
+					Version: gvr.Version,
+				},
+			}
+			logger.WithFields(linked.AsFields("linked")).WithField("rule", rule.name).Debug("Resolved link")
+
+			results = append(results, linker.LinkerResult{
+				Object:  linked,
+				Role:    links.role,
+				Class:   links.class,
+				DedupId: links.dedupId,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+func resolveTarget(cdc discovery.ClusterDiscoveryCache, target Target) (schema.GroupVersionResource, error) {
+	if target.Resource != "" {
+		return schema.GroupVersionResource{Group: target.Group, Version: target.Version, Resource: target.Resource}, nil
+	}
+
+	gvk := schema.GroupVersionKind{Group: target.Group, Version: target.Version, Kind: target.Kind}
+	gvr, ok := cdc.LookupResource(gvk)
+	if !ok {
+		return schema.GroupVersionResource{}, fmt.Errorf("unknown target kind %v", gvk)
+	}
+
+	return gvr, nil
+}
@@ -0,0 +1,244 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulelinker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/jsonpath"
+
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule extracts links from objects of one kind.
+type Rule struct {
+	// Name identifies the rule in dedup IDs and logs.
+	Name    string  `json:"name"`
+	Match   Match   `json:"match"`
+	Targets []Links `json:"links"`
+}
+
+// Match selects the objects a rule applies to.
+// Either Kind or Resource must be specified.
+type Match struct {
+	Group    string `json:"group"`
+	Version  string `json:"version,omitempty"`
+	Kind     string `json:"kind,omitempty"`
+	Resource string `json:"resource,omitempty"`
+}
+
+// Links describes a linked object whose name is extracted from the matched object.
+type Links struct {
+	// Target is the type of the linked object.
+	Target Target `json:"target"`
+	// Name extracts the name of the linked object. No link is created if it evaluates to an empty string.
+	Name Extractor `json:"name"`
+	// Namespace extracts the namespace of the linked object.
+	// If unset, the linked object is in the same namespace as the matched object, unless Target.ClusterScoped is true.
+	Namespace *Extractor `json:"namespace,omitempty"`
+	// Role is the role of the linked object, "parent" (default) or "child".
+	Role  zconstants.LinkRoleValue `json:"role,omitempty"`
+	Class string                   `json:"class,omitempty"`
+}
+
+// Target identifies the type of a linked object by either Kind or Resource.
+type Target struct {
+	Group         string `json:"group"`
+	Version       string `json:"version"`
+	Kind          string `json:"kind,omitempty"`
+	Resource      string `json:"resource,omitempty"`
+	ClusterScoped bool   `json:"clusterScoped,omitempty"`
+}
+
+// Extractor extracts a string from an object. Exactly one field must be set.
+type Extractor struct {
+	// JsonPath is a kubectl-style JSONPath template, e.g. `{.spec.clusterRef.name}`.
+	JsonPath string `json:"jsonPath,omitempty"`
+	// Cel is a CEL expression evaluating to a string, with the object accessible as `object`.
+	Cel string `json:"cel,omitempty"`
+	// Label is the key of a label.
+	Label string `json:"label,omitempty"`
+	// Annotation is the key of an annotation.
+	Annotation string `json:"annotation,omitempty"`
+}
+
+type compiledRule struct {
+	name    string
+	match   Match
+	targets []compiledLinks
+}
+
+type compiledLinks struct {
+	target    Target
+	name      extractFunc
+	namespace extractFunc
+	role      zconstants.LinkRoleValue
+	class     string
+	dedupId   string
+}
+
+type extractFunc func(raw *unstructured.Unstructured) (string, error)
+
+func compileConfig(config *Config) ([]*compiledRule, error) {
+	celEnv, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create CEL environment: %w", err)
+	}
+
+	rules := make([]*compiledRule, 0, len(config.Rules))
+	for ruleIndex, rule := range config.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprint(ruleIndex)
+		}
+
+		if (rule.Match.Kind == "") == (rule.Match.Resource == "") {
+			return nil, fmt.Errorf("rule %q: exactly one of match.kind and match.resource must be set", rule.Name)
+		}
+
+		compiled := &compiledRule{
+			name:  rule.Name,
+			match: rule.Match,
+		}
+
+		for targetIndex, links := range rule.Targets {
+			path := fmt.Sprintf("rule %q links[%d]", rule.Name, targetIndex)
+
+			if (links.Target.Kind == "") == (links.Target.Resource == "") {
+				return nil, fmt.Errorf("%s: exactly one of target.kind and target.resource must be set", path)
+			}
+
+			role := links.Role
+			if role == "" {
+				role = zconstants.LinkRoleParent
+			}
+			if role != zconstants.LinkRoleParent && role != zconstants.LinkRoleChild {
+				return nil, fmt.Errorf("%s: unknown role %q", path, role)
+			}
+
+			nameFunc, err := compileExtractor(celEnv, &links.Name)
+			if err != nil {
+				return nil, fmt.Errorf("%s: name: %w", path, err)
+			}
+
+			var namespaceFunc extractFunc
+			if links.Namespace != nil {
+				namespaceFunc, err = compileExtractor(celEnv, links.Namespace)
+				if err != nil {
+					return nil, fmt.Errorf("%s: namespace: %w", path, err)
+				}
+			}
+
+			compiled.targets = append(compiled.targets, compiledLinks{
+				target:    links.Target,
+				name:      nameFunc,
+				namespace: namespaceFunc,
+				role:      role,
+				class:     links.Class,
+				dedupId:   fmt.Sprintf("rule/%s/%d", rule.Name, targetIndex),
+			})
+		}
+
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+func compileExtractor(celEnv *cel.Env, extractor *Extractor) (extractFunc, error) {
+	count := 0
+	for _, field := range []string{extractor.JsonPath, extractor.Cel, extractor.Label, extractor.Annotation} {
+		if field != "" {
+			count++
+		}
+	}
+	if count != 1 {
+		return nil, fmt.Errorf("exactly one of jsonPath, cel, label and annotation must be set")
+	}
+
+	switch {
+	case extractor.JsonPath != "":
+		template := jsonpath.New("")
+		template.AllowMissingKeys(true)
+		if err := template.Parse(extractor.JsonPath); err != nil {
+			return nil, fmt.Errorf("invalid JSONPath: %w", err)
+		}
+
+		return func(raw *unstructured.Unstructured) (string, error) {
+			output := &strings.Builder{}
+			if err := template.Execute(output, raw.Object); err != nil {
+				return "", fmt.Errorf("evaluating JSONPath: %w", err)
+			}
+			return output.String(), nil
+		}, nil
+
+	case extractor.Cel != "":
+		ast, issues := celEnv.Compile(extractor.Cel)
+		if issues.Err() != nil {
+			return nil, fmt.Errorf("invalid CEL expression: %w", issues.Err())
+		}
+
+		program, err := celEnv.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CEL expression: %w", err)
+		}
+
+		return func(raw *unstructured.Unstructured) (string, error) {
+			output, _, err := program.Eval(map[string]any{"object": raw.Object})
+			if err != nil {
+				// missing fields are expected for optional references
+				return "", nil //nolint:nilerr
+			}
+
+			value, err := output.ConvertToNative(reflect.TypeOf(""))
+			if err != nil {
+				return "", fmt.Errorf("CEL expression did not evaluate to a string: %w", err)
+			}
+			return value.(string), nil
+		}, nil
+
+	case extractor.Label != "":
+		key := extractor.Label
+		return func(raw *unstructured.Unstructured) (string, error) { return raw.GetLabels()[key], nil }, nil
+
+	default:
+		key := extractor.Annotation
+		return func(raw *unstructured.Unstructured) (string, error) { return raw.GetAnnotations()[key], nil }, nil
+	}
+}
+
+func (rule *compiledRule) matches(gvr schema.GroupVersionResource, kind string) bool {
+	if rule.match.Group != gvr.Group {
+		return false
+	}
+
+	if rule.match.Version != "" && rule.match.Version != gvr.Version {
+		return false
+	}
+
+	if rule.match.Kind != "" {
+		return rule.match.Kind == kind
+	}
+
+	return rule.match.Resource == gvr.Resource
+}
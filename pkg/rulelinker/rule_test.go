@@ -0,0 +1,84 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rulelinker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExtractors(t *testing.T) {
+	raw := &unstructured.Unstructured{Object: map[string]any{
+		"metadata": map[string]any{
+			"name":        "w1",
+			"labels":      map[string]any{"app.example.com/owner": "team-a"},
+			"annotations": map[string]any{"example.com/group": "g1"},
+		},
+		"spec": map[string]any{
+			"clusterRef": map[string]any{"name": "c1"},
+		},
+	}}
+
+	rules, err := compileConfig(&Config{Rules: []Rule{{
+		Name:  "workload",
+		Match: Match{Group: "example.com", Kind: "Workload"},
+		Targets: []Links{
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{JsonPath: "{.spec.clusterRef.name}"}},
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{Cel: "object.spec.clusterRef.name + '-x'"}},
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{Label: "app.example.com/owner"}},
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{Annotation: "example.com/group"}},
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{JsonPath: "{.spec.missing}"}},
+			{Target: Target{Version: "v1", Resource: "configmaps"}, Name: Extractor{Cel: "object.spec.missing.name"}},
+		},
+	}}})
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+
+	expected := []string{"c1", "c1-x", "team-a", "g1", "", ""}
+	for i, links := range rules[0].targets {
+		value, err := links.name(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[i], value, "links[%d]", i)
+	}
+}
+
+func TestCompileConfigErrors(t *testing.T) {
+	for name, rule := range map[string]Rule{
+		"no match kind": {Match: Match{Group: "example.com"}},
+		"no extractor": {
+			Match:   Match{Kind: "Workload"},
+			Targets: []Links{{Target: Target{Resource: "configmaps"}}},
+		},
+		"multiple extractors": {
+			Match:   Match{Kind: "Workload"},
+			Targets: []Links{{Target: Target{Resource: "configmaps"}, Name: Extractor{Label: "a", Annotation: "b"}}},
+		},
+		"bad role": {
+			Match:   Match{Kind: "Workload"},
+			Targets: []Links{{Target: Target{Resource: "configmaps"}, Name: Extractor{Label: "a"}, Role: "sibling"}},
+		},
+		"bad cel": {
+			Match:   Match{Kind: "Workload"},
+			Targets: []Links{{Target: Target{Resource: "configmaps"}, Name: Extractor{Cel: "object.("}}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := compileConfig(&Config{Rules: []Rule{rule}})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduling
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/audit"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("pod-scheduling-audit-decorator", manager.Ptr(&auditDecorator{}), &manager.List[audit.Decorator]{})
+}
+
+type auditOptions struct {
+	enable bool
+}
+
+func (options *auditOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"pod-scheduling-audit-decorator-enable",
+		false,
+		"tag pod binding audit spans with the scheduled node and the scheduling latency",
+	)
+}
+
+func (options *auditOptions) EnableFlag() *bool { return &options.enable }
+
+type auditDecorator struct {
+	options    auditOptions
+	Scheduling *Scheduling
+}
+
+var _ manager.Component = &auditDecorator{}
+
+func (d *auditDecorator) Options() manager.Options        { return &d.options }
+func (d *auditDecorator) Init() error                     { return nil }
+func (d *auditDecorator) Start(ctx context.Context) error { return nil }
+func (d *auditDecorator) Close(ctx context.Context) error { return nil }
+
+func (d *auditDecorator) Decorate(ctx context.Context, message *audit.Message, event *aggregatorevent.Event) {
+	if message.ObjectRef == nil || message.ObjectRef.Subresource != "binding" || message.Verb != audit.VerbCreate {
+		return
+	}
+
+	object := utilobject.RichFromAudit(message.ObjectRef, message.Cluster)
+	if !isPod(object) {
+		return
+	}
+
+	if message.ResponseStatus != nil && message.ResponseStatus.Code >= 300 {
+		return
+	}
+
+	node := ""
+	if message.RequestObject != nil {
+		var binding corev1.Binding
+		if err := json.Unmarshal(message.RequestObject.Raw, &binding); err == nil {
+			node = binding.Target.Name
+		}
+	}
+
+	d.Scheduling.decorateScheduled(ctx, object, event, node, message.StageTimestamp.Time, "Binding")
+}
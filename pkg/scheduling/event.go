@@ -0,0 +1,89 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduling
+
+import (
+	"context"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/aggregator/eventdecorator"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("pod-scheduling-event-decorator", manager.Ptr(&eventDecorator{}), &manager.List[eventdecorator.Decorator]{})
+}
+
+const (
+	reasonScheduled        = "Scheduled"
+	reasonFailedScheduling = "FailedScheduling"
+)
+
+type eventOptions struct {
+	enable bool
+}
+
+func (options *eventOptions) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"pod-scheduling-event-decorator-enable",
+		false,
+		"tag pod scheduler event spans with the scheduled node, the scheduling latency and unschedulable reasons",
+	)
+}
+
+func (options *eventOptions) EnableFlag() *bool { return &options.enable }
+
+type eventDecorator struct {
+	options    eventOptions
+	Scheduling *Scheduling
+}
+
+var _ manager.Component = &eventDecorator{}
+
+func (d *eventDecorator) Options() manager.Options        { return &d.options }
+func (d *eventDecorator) Init() error                     { return nil }
+func (d *eventDecorator) Start(ctx context.Context) error { return nil }
+func (d *eventDecorator) Close(ctx context.Context) error { return nil }
+
+func (d *eventDecorator) Decorate(ctx context.Context, object utilobject.Rich, event *aggregatorevent.Event) {
+	if event == nil || event.TraceSource != zconstants.TraceSourceEvent || !isPod(object) {
+		return
+	}
+
+	if event.Title != reasonScheduled && event.Title != reasonFailedScheduling {
+		return
+	}
+
+	message := ""
+	for _, log := range event.Logs {
+		if log.Type == zconstants.LogTypeEventMessage {
+			message = log.Message
+			break
+		}
+	}
+
+	switch event.Title {
+	case reasonScheduled:
+		node, _ := ParseScheduledNode(message)
+		d.Scheduling.decorateScheduled(ctx, object, event, node, event.Time, "Event")
+	case reasonFailedScheduling:
+		d.Scheduling.decorateFailure(object, event, message)
+	}
+}
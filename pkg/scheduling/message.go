@@ -0,0 +1,95 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduling
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Failure is the parsed message of a FailedScheduling event.
+type Failure struct {
+	Available int
+	Total     int
+	Reasons   []Reason
+}
+
+// Reason is the number of nodes filtered out for a specific reason.
+type Reason struct {
+	Nodes  int
+	Reason string
+}
+
+var (
+	failureRegex   = regexp.MustCompile(`^(\d+)/(\d+) nodes are available(?::\s*(.*))?$`)
+	reasonRegex    = regexp.MustCompile(`^(\d+) (.+)$`)
+	braceRegex     = regexp.MustCompile(`\{[^}]*\}`)
+	scheduledRegex = regexp.MustCompile(`^Successfully assigned \S+/\S+ to (\S+)$`)
+)
+
+// ParseFailure parses a scheduler failure message in the form
+// "0/3 nodes are available: 1 Insufficient cpu, 2 node(s) didn't match Pod's node affinity/selector. preemption: ...".
+func ParseFailure(message string) (Failure, bool) {
+	// discard the preemption diagnosis, which repeats the node count in a different context
+	message, _, _ = strings.Cut(message, " preemption:")
+	message = strings.TrimSpace(message)
+	message = strings.TrimSuffix(message, ".")
+
+	matches := failureRegex.FindStringSubmatch(message)
+	if matches == nil {
+		return Failure{}, false
+	}
+
+	failure := Failure{}
+	failure.Available, _ = strconv.Atoi(matches[1])
+	failure.Total, _ = strconv.Atoi(matches[2])
+
+	if matches[3] == "" {
+		return failure, true
+	}
+
+	for _, item := range strings.Split(matches[3], ", ") {
+		item = strings.TrimSpace(item)
+		reasonMatches := reasonRegex.FindStringSubmatch(item)
+		if reasonMatches == nil {
+			continue
+		}
+
+		nodes, err := strconv.Atoi(reasonMatches[1])
+		if err != nil {
+			continue
+		}
+
+		failure.Reasons = append(failure.Reasons, Reason{Nodes: nodes, Reason: reasonMatches[2]})
+	}
+
+	return failure, true
+}
+
+// Category returns the reason with object-specific details such as taint keys removed.
+func (reason Reason) Category() string {
+	return strings.TrimSpace(braceRegex.ReplaceAllString(reason.Reason, "{}"))
+}
+
+// ParseScheduledNode returns the node name from the message of a Scheduled event.
+func ParseScheduledNode(message string) (string, bool) {
+	matches := scheduledRegex.FindStringSubmatch(strings.TrimSpace(message))
+	if matches == nil {
+		return "", false
+	}
+
+	return matches[1], true
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduling_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/scheduling"
+)
+
+func TestParseFailure(t *testing.T) {
+	failure, ok := scheduling.ParseFailure(
+		"0/5 nodes are available: 1 node(s) had untolerated taint {node-role.kubernetes.io/control-plane: }, " +
+			"4 Insufficient cpu. preemption: 0/5 nodes are available: 1 Preemption is not helpful for scheduling, " +
+			"4 No preemption victims found for incoming pod..",
+	)
+	assert.True(t, ok)
+	assert.Equal(t, 0, failure.Available)
+	assert.Equal(t, 5, failure.Total)
+	assert.Equal(t, []scheduling.Reason{
+		{Nodes: 1, Reason: "node(s) had untolerated taint {node-role.kubernetes.io/control-plane: }"},
+		{Nodes: 4, Reason: "Insufficient cpu"},
+	}, failure.Reasons)
+	assert.Equal(t, "node(s) had untolerated taint {}", failure.Reasons[0].Category())
+
+	failure, ok = scheduling.ParseFailure("0/0 nodes are available.")
+	assert.True(t, ok)
+	assert.Empty(t, failure.Reasons)
+
+	_, ok = scheduling.ParseFailure(`persistentvolumeclaim "data" not found`)
+	assert.False(t, ok)
+}
+
+func TestParseScheduledNode(t *testing.T) {
+	node, ok := scheduling.ParseScheduledNode("Successfully assigned default/nginx-7d9f to node-1")
+	assert.True(t, ok)
+	assert.Equal(t, "node-1", node)
+
+	_, ok = scheduling.ParseScheduledNode("Binding rejected")
+	assert.False(t, ok)
+}
@@ -0,0 +1,137 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Annotates the event spans of a Pod with scheduling decisions.
+//
+// Binding audit events and Scheduled events from the scheduler are tagged with the selected node
+// and the scheduling latency since Pod creation.
+// FailedScheduling events are tagged with the unschedulable reasons reported by the scheduler.
+// Object spans are emitted before the Pod is scheduled, so the information is attached to the event spans under them.
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/aggregatorevent"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func init() {
+	manager.Global.Provide("pod-scheduling", manager.Ptr(&Scheduling{}))
+}
+
+type Scheduling struct {
+	Logger      logrus.FieldLogger
+	Clock       clock.Clock
+	ObjectCache *objectcache.ObjectCache
+
+	LatencyMetric *metrics.Metric[*latencyMetric]
+	FailureMetric *metrics.Metric[*failureMetric]
+}
+
+type latencyMetric struct {
+	Cluster string
+	Source  string
+}
+
+func (*latencyMetric) MetricName() string { return "pod_scheduling_latency" }
+
+type failureMetric struct {
+	Cluster string
+	Reason  string
+}
+
+func (*failureMetric) MetricName() string { return "pod_scheduling_failure" }
+
+var _ manager.Component = &Scheduling{}
+
+func (s *Scheduling) Options() manager.Options        { return &manager.NoOptions{} }
+func (s *Scheduling) Init() error                     { return nil }
+func (s *Scheduling) Start(ctx context.Context) error { return nil }
+func (s *Scheduling) Close(ctx context.Context) error { return nil }
+
+func isPod(object utilobject.Rich) bool {
+	return object.Group == "" && object.Resource == "pods"
+}
+
+// decorateScheduled tags an event indicating that the pod has been bound to a node.
+func (s *Scheduling) decorateScheduled(
+	ctx context.Context,
+	object utilobject.Rich,
+	event *aggregatorevent.Event,
+	node string,
+	bindTime time.Time,
+	source string,
+) {
+	if node != "" {
+		event.SetTag("scheduledNode", node)
+	}
+
+	creationTime, ok := s.podCreationTime(ctx, object)
+	if !ok || bindTime.Before(creationTime) {
+		return
+	}
+
+	latency := bindTime.Sub(creationTime)
+	event.SetTag("schedulingLatency", latency.String())
+	s.LatencyMetric.With(&latencyMetric{Cluster: object.Cluster, Source: source}).Summary(float64(latency.Nanoseconds()))
+}
+
+// decorateFailure tags a FailedScheduling event with the parsed unschedulable reasons.
+func (s *Scheduling) decorateFailure(object utilobject.Rich, event *aggregatorevent.Event, message string) {
+	failure, ok := ParseFailure(message)
+	if !ok {
+		return
+	}
+
+	event.SetTag("availableNodes", fmt.Sprintf("%d/%d", failure.Available, failure.Total))
+
+	reasons := make([]string, 0, len(failure.Reasons))
+	for _, reason := range failure.Reasons {
+		reasons = append(reasons, fmt.Sprintf("%d %s", reason.Nodes, reason.Reason))
+		s.FailureMetric.With(&failureMetric{Cluster: object.Cluster, Reason: reason.Category()}).Count(1)
+	}
+	if len(reasons) > 0 {
+		event.SetTag("unschedulableReasons", strings.Join(reasons, "\n"))
+	}
+}
+
+func (s *Scheduling) podCreationTime(ctx context.Context, object utilobject.Rich) (time.Time, bool) {
+	if object.Raw != nil && object.Raw.GetKind() == "Pod" {
+		return object.Raw.GetCreationTimestamp().Time, true
+	}
+
+	key := object.VersionedKey
+	key.Version = "v1"
+
+	raw, err := s.ObjectCache.Get(ctx, key)
+	if err != nil {
+		s.Logger.WithFields(object.AsFields("object")).WithError(err).Debug("cannot fetch pod for scheduling latency")
+		return time.Time{}, false
+	}
+	if raw == nil {
+		return time.Time{}, false
+	}
+
+	return raw.GetCreationTimestamp().Time, true
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Resolves "k8s:namespace/name/key" references from Secrets in the target cluster.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/kelemetry/pkg/k8s"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("secret-k8s", manager.Ptr(&resolver{}), &manager.List[secret.Resolver]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&options.enable,
+		"secret-k8s-enable",
+		false,
+		"resolve 'k8s:namespace/name/key' credential references from Secrets in the target cluster; "+
+			"requires the get permission on the referenced Secrets",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type resolver struct {
+	options options
+	Clients k8s.Clients
+}
+
+var _ secret.Resolver = &resolver{}
+
+func (resolver *resolver) Options() manager.Options        { return &resolver.options }
+func (resolver *resolver) Init() error                     { return nil }
+func (resolver *resolver) Start(ctx context.Context) error { return nil }
+func (resolver *resolver) Close(ctx context.Context) error { return nil }
+
+func (resolver *resolver) Scheme() string { return "k8s" }
+
+func (resolver *resolver) Resolve(ctx context.Context, reference string) (string, error) {
+	parts := strings.Split(reference, "/")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("expected 'k8s:namespace/name/key', got %q", reference)
+	}
+	namespace, name, key := parts[0], parts[1], parts[2]
+
+	object, err := resolver.Clients.TargetCluster().KubernetesClient().CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("cannot get secret %s/%s: %w", namespace, name, err)
+	}
+
+	value, exists := object.Data[key]
+	if !exists {
+		return "", fmt.Errorf("secret %s/%s has no key %q", namespace, name, key)
+	}
+
+	return string(value), nil
+}
@@ -0,0 +1,250 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Resolves credentials passed in options from secret stores and refreshes them periodically.
+//
+// Credential options accept references in the form "scheme:reference" instead of literal values,
+// so that secrets do not appear in process listings:
+//
+//   - "file:/path" reads a file, e.g. a mounted Kubernetes Secret or a file rendered by the Vault agent
+//   - "env:NAME" reads an environment variable
+//   - other schemes are resolved by a Resolver, e.g. "k8s:" and "vault:"
+//
+// Values without a known scheme are used literally for compatibility.
+package secret
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	"github.com/kubewharf/kelemetry/pkg/util/shutdown"
+)
+
+func init() {
+	manager.Global.Provide("secret", manager.Ptr(&Store{}))
+}
+
+// resolverSchemes are schemes of the built-in resolvers,
+// which are rejected instead of used literally if the resolver is not enabled.
+var resolverSchemes = sets.New("k8s", "vault")
+
+// Resolver resolves references of a scheme from an external secret store.
+type Resolver interface {
+	// Scheme returns the scheme of references resolved by this resolver, without the colon.
+	Scheme() string
+	// Resolve returns the current value of the reference, excluding the scheme.
+	Resolve(ctx context.Context, reference string) (string, error)
+}
+
+type options struct {
+	refreshInterval time.Duration
+	timeout         time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.DurationVar(
+		&options.refreshInterval,
+		"secret-refresh-interval",
+		time.Minute,
+		"interval to refresh credentials referenced from files and secret stores",
+	)
+	fs.DurationVar(&options.timeout, "secret-timeout", time.Second*10, "timeout of each request to secret stores")
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+// Store resolves credential references.
+type Store struct {
+	options   options
+	Logger    logrus.FieldLogger
+	Clock     clock.Clock
+	Resolvers *manager.List[Resolver]
+
+	RefreshMetric *metrics.Metric[*refreshMetric]
+
+	resolvers map[string]Resolver
+
+	valuesMu sync.Mutex
+	values   []*Value
+}
+
+type refreshMetric struct {
+	Scheme string
+	Error  metrics.LabeledError
+}
+
+func (*refreshMetric) MetricName() string { return "secret_refresh" }
+
+// Value is a credential that may change over time.
+type Value struct {
+	// name of the option, used for logging
+	name      string
+	scheme    string
+	reference string
+	current   atomic.Pointer[string]
+}
+
+// Get returns the current value.
+func (value *Value) Get() string {
+	if value == nil {
+		return ""
+	}
+	return *value.current.Load()
+}
+
+var _ manager.Component = &Store{}
+
+func (store *Store) Options() manager.Options { return &store.options }
+
+func (store *Store) Init() error {
+	store.resolvers = map[string]Resolver{}
+	for _, resolver := range store.Resolvers.Impls {
+		store.resolvers[resolver.Scheme()] = resolver
+	}
+
+	return nil
+}
+
+func (store *Store) Start(ctx context.Context) error {
+	go func() {
+		defer shutdown.RecoverPanic(store.Logger)
+
+		ticker := store.Clock.Tick(store.options.refreshInterval)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker:
+				store.refreshAll(ctx)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (store *Store) Close(ctx context.Context) error { return nil }
+
+// Watch resolves the reference passed to the option and keeps it up to date.
+// An empty reference resolves to an empty value.
+func (store *Store) Watch(name string, reference string) (*Value, error) {
+	value, dynamic, err := store.resolve(name, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	if dynamic {
+		store.valuesMu.Lock()
+		defer store.valuesMu.Unlock()
+		store.values = append(store.values, value)
+	}
+
+	return value, nil
+}
+
+// Resolve resolves the reference passed to the option once,
+// for clients that cannot change credentials without reconnecting.
+func (store *Store) Resolve(name string, reference string) (string, error) {
+	value, _, err := store.resolve(name, reference)
+	if err != nil {
+		return "", err
+	}
+	return value.Get(), nil
+}
+
+func (store *Store) resolve(name string, reference string) (_ *Value, dynamic bool, _ error) {
+	value := &Value{name: name}
+
+	scheme, rest, hasScheme := strings.Cut(reference, ":")
+	_, isResolver := store.resolvers[scheme]
+	switch {
+	case hasScheme && scheme == "env":
+		envValue, ok := os.LookupEnv(rest)
+		if !ok {
+			return nil, false, fmt.Errorf("environment variable %q of --%s is not set", rest, name)
+		}
+		value.current.Store(&envValue)
+		return value, false, nil
+	case hasScheme && (scheme == "file" || isResolver):
+		value.scheme, value.reference = scheme, rest
+	case hasScheme && resolverSchemes.Has(scheme):
+		return nil, false, fmt.Errorf("--%s references a %q secret, but the %s resolver is not enabled", name, scheme, scheme)
+	default:
+		value.current.Store(&reference)
+		return value, false, nil
+	}
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), store.options.timeout)
+	defer cancelFunc()
+
+	if err := store.refresh(ctx, value); err != nil {
+		return nil, false, fmt.Errorf("cannot resolve --%s: %w", name, err)
+	}
+
+	return value, true, nil
+}
+
+func (store *Store) refreshAll(ctx context.Context) {
+	store.valuesMu.Lock()
+	values := store.values
+	store.valuesMu.Unlock()
+
+	for _, value := range values {
+		func() {
+			ctx, cancelFunc := context.WithTimeout(ctx, store.options.timeout)
+			defer cancelFunc()
+
+			if err := store.refresh(ctx, value); err != nil {
+				store.Logger.WithField("option", value.name).WithError(err).Warn("cannot refresh secret, keep using previous value")
+			}
+		}()
+	}
+}
+
+func (store *Store) refresh(ctx context.Context, value *Value) (err error) {
+	metric := &refreshMetric{Scheme: value.scheme}
+	defer store.RefreshMetric.DeferCount(store.Clock.Now(), metric)
+
+	var newValue string
+	if value.scheme == "file" {
+		var data []byte
+		data, err = os.ReadFile(value.reference)
+		newValue = strings.TrimRight(string(data), "\r\n")
+	} else {
+		newValue, err = store.resolvers[value.scheme].Resolve(ctx, value.reference)
+	}
+	if err != nil {
+		metric.Error = metrics.LabelError(err, "Resolve")
+		return err
+	}
+
+	if previous := value.current.Load(); previous != nil && *previous != newValue {
+		store.Logger.WithField("option", value.name).Info("secret changed")
+	}
+	value.current.Store(&newValue)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secret
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+)
+
+type mapResolver map[string]string
+
+func (resolver mapResolver) Scheme() string { return "map" }
+
+func (resolver mapResolver) Resolve(ctx context.Context, reference string) (string, error) {
+	value, exists := resolver[reference]
+	if !exists {
+		return "", fmt.Errorf("%q not found", reference)
+	}
+	return value, nil
+}
+
+func newTestStore(t *testing.T, resolvers ...Resolver) *Store {
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	metricsClient, _ := metrics.NewMock(clock)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	store := &Store{
+		options:       options{refreshInterval: time.Minute, timeout: time.Second},
+		Logger:        logger,
+		Clock:         clock,
+		Resolvers:     &manager.List[Resolver]{Impls: resolvers},
+		RefreshMetric: metrics.New[*refreshMetric](metricsClient),
+	}
+	assert.NoError(t, store.Init())
+	return store
+}
+
+func TestWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	resolver := mapResolver{"redis": "v1"}
+	store := newTestStore(t, resolver)
+
+	path := filepath.Join(t.TempDir(), "password")
+	assert.NoError(os.WriteFile(path, []byte("v1\n"), 0o600))
+	t.Setenv("TEST_SECRET", "v1")
+
+	fileValue, err := store.Watch("file", "file:"+path)
+	assert.NoError(err)
+	envValue, err := store.Watch("env", "env:TEST_SECRET")
+	assert.NoError(err)
+	mapValue, err := store.Watch("map", "map:redis")
+	assert.NoError(err)
+	literalValue, err := store.Watch("literal", "p@ss:word")
+	assert.NoError(err)
+
+	assert.Equal("v1", fileValue.Get())
+	assert.Equal("v1", envValue.Get())
+	assert.Equal("v1", mapValue.Get())
+	assert.Equal("p@ss:word", literalValue.Get())
+
+	// only file and resolver values are refreshed
+	assert.NoError(os.WriteFile(path, []byte("v2\n"), 0o600))
+	t.Setenv("TEST_SECRET", "v2")
+	resolver["redis"] = "v2"
+	store.refreshAll(context.Background())
+
+	assert.Equal("v2", fileValue.Get())
+	assert.Equal("v1", envValue.Get())
+	assert.Equal("v2", mapValue.Get())
+
+	// failed refreshes keep the previous value
+	delete(resolver, "redis")
+	store.refreshAll(context.Background())
+	assert.Equal("v2", mapValue.Get())
+}
+
+func TestResolveErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newTestStore(t)
+
+	_, err := store.Resolve("missing-file", "file:/nonexistent")
+	assert.Error(err)
+
+	_, err = store.Resolve("missing-env", "env:KELEMETRY_TEST_UNSET")
+	assert.Error(err)
+
+	// references to disabled resolvers must not be used as literal passwords
+	_, err = store.Resolve("vault", "vault:secret/data/kelemetry#password")
+	assert.Error(err)
+
+	value, err := store.Resolve("empty", "")
+	assert.NoError(err)
+	assert.Empty(value)
+}
@@ -0,0 +1,234 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Resolves "vault:path#field" references from HashiCorp Vault over its HTTP API.
+//
+// The path is the API path after /v1/, e.g. "secret/data/kelemetry/redis" for the KV v2 engine.
+// Since each read of a dynamic secret issues new credentials, dynamic secrets should be
+// rendered to files by the Vault agent and referenced with "file:" instead.
+// Vault is authenticated with a token file or with the Kubernetes auth method.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/utils/clock"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/secret"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("secret-vault", manager.Ptr(&resolver{}), &manager.List[secret.Resolver]{})
+}
+
+type options struct {
+	enable         bool
+	address        string
+	namespace      string
+	tokenFile      string
+	kubernetesRole string
+	kubernetesPath string
+	jwtFile        string
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "secret-vault-enable", false, "resolve 'vault:path#field' credential references from HashiCorp Vault")
+	fs.StringVar(&options.address, "secret-vault-address", "https://127.0.0.1:8200", "Vault server address")
+	fs.StringVar(&options.namespace, "secret-vault-namespace", "", "Vault enterprise namespace")
+	fs.StringVar(
+		&options.tokenFile,
+		"secret-vault-token-file",
+		"",
+		"file containing the Vault token, re-read before each request; leave empty to use the Kubernetes auth method",
+	)
+	fs.StringVar(&options.kubernetesRole, "secret-vault-kubernetes-role", "", "role to log in with the Vault Kubernetes auth method")
+	fs.StringVar(&options.kubernetesPath, "secret-vault-kubernetes-path", "kubernetes", "mount path of the Vault Kubernetes auth method")
+	fs.StringVar(
+		&options.jwtFile,
+		"secret-vault-jwt-file",
+		"/var/run/secrets/kubernetes.io/serviceaccount/token",
+		"service account token used to log in with the Vault Kubernetes auth method",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+func (options *options) Validate() error {
+	if options.enable && options.tokenFile == "" && options.kubernetesRole == "" {
+		return fmt.Errorf("--secret-vault-token-file or --secret-vault-kubernetes-role is required with --secret-vault-enable")
+	}
+	return nil
+}
+
+type resolver struct {
+	options options
+	Clock   clock.Clock
+
+	httpClient http.Client
+
+	tokenMu     sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+var _ secret.Resolver = &resolver{}
+
+func (resolver *resolver) Options() manager.Options        { return &resolver.options }
+func (resolver *resolver) Init() error                     { return nil }
+func (resolver *resolver) Start(ctx context.Context) error { return nil }
+func (resolver *resolver) Close(ctx context.Context) error { return nil }
+
+func (resolver *resolver) Scheme() string { return "vault" }
+
+type response struct {
+	Data json.RawMessage `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func (resolver *resolver) Resolve(ctx context.Context, reference string) (string, error) {
+	path, field, ok := strings.Cut(reference, "#")
+	if !ok {
+		return "", fmt.Errorf("expected 'vault:path#field', got %q", reference)
+	}
+
+	token, err := resolver.getToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := resolver.do(ctx, http.MethodGet, path, token, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		return "", fmt.Errorf("unexpected data in vault response: %w", err)
+	}
+	if _, isKv2 := data["metadata"]; isKv2 {
+		// KV v2 wraps the secret in data.data alongside data.metadata
+		kvData := data["data"]
+		data = nil
+		if err := json.Unmarshal(kvData, &data); err != nil {
+			return "", fmt.Errorf("unexpected KV v2 data in vault response: %w", err)
+		}
+	}
+
+	raw, exists := data[field]
+	if !exists {
+		return "", fmt.Errorf("vault secret %q has no field %q", path, field)
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %q of vault secret %q is not a string", field, path)
+	}
+
+	return value, nil
+}
+
+// getToken returns the token in the token file, or logs in with the Kubernetes auth method if the cached token is expiring.
+func (resolver *resolver) getToken(ctx context.Context) (string, error) {
+	if resolver.options.tokenFile != "" {
+		token, err := os.ReadFile(resolver.options.tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("cannot read --secret-vault-token-file: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+
+	resolver.tokenMu.Lock()
+	defer resolver.tokenMu.Unlock()
+
+	if resolver.token != "" && resolver.Clock.Now().Before(resolver.tokenExpiry) {
+		return resolver.token, nil
+	}
+
+	jwt, err := os.ReadFile(resolver.options.jwtFile)
+	if err != nil {
+		return "", fmt.Errorf("cannot read --secret-vault-jwt-file: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"role": resolver.options.kubernetesRole, "jwt": strings.TrimSpace(string(jwt))})
+	if err != nil {
+		return "", fmt.Errorf("cannot encode login request: %w", err)
+	}
+
+	resp, err := resolver.do(ctx, http.MethodPost, fmt.Sprintf("auth/%s/login", resolver.options.kubernetesPath), "", body)
+	if err != nil {
+		return "", fmt.Errorf("cannot log in to vault: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login response has no token")
+	}
+
+	resolver.token = resp.Auth.ClientToken
+	// log in again at half of the lease to leave time for retries
+	resolver.tokenExpiry = resolver.Clock.Now().Add(time.Duration(resp.Auth.LeaseDuration) * time.Second / 2)
+
+	return resolver.token, nil
+}
+
+func (resolver *resolver) do(ctx context.Context, method string, path string, token string, body []byte) (*response, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, method,
+		strings.TrimSuffix(resolver.options.address, "/")+"/v1/"+strings.TrimPrefix(path, "/"),
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create vault request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if resolver.options.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", resolver.options.namespace)
+	}
+
+	httpResp, err := resolver.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request error: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read vault response: %w", err)
+	}
+
+	resp := &response{}
+	if err := json.Unmarshal(respBody, resp); err != nil {
+		return nil, fmt.Errorf("cannot decode vault response (status %d): %w", httpResp.StatusCode, err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d: %s", httpResp.StatusCode, strings.Join(resp.Errors, "; "))
+	}
+
+	return resp, nil
+}
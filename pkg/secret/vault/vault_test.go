@@ -0,0 +1,96 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			var body map[string]string
+			assert.NoError(json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal("kelemetry", body["role"])
+			assert.Equal("sa-token", body["jwt"])
+
+			logins++
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"vault-token","lease_duration":3600}}`))
+		case "/v1/secret/data/kelemetry/redis":
+			if r.Header.Get("X-Vault-Token") != "vault-token" {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"hunter2"},"metadata":{"version":3}}}`))
+		case "/v1/kv1/kelemetry/redis":
+			_, _ = w.Write([]byte(`{"data":{"password":"hunter1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(os.WriteFile(jwtFile, []byte("sa-token\n"), 0o600))
+
+	clock := clocktesting.NewFakeClock(time.Unix(0, 0))
+	resolver := &resolver{
+		options: options{
+			address:        server.URL,
+			kubernetesRole: "kelemetry",
+			kubernetesPath: "kubernetes",
+			jwtFile:        jwtFile,
+		},
+		Clock: clock,
+	}
+
+	ctx := context.Background()
+
+	value, err := resolver.Resolve(ctx, "secret/data/kelemetry/redis#password")
+	assert.NoError(err)
+	assert.Equal("hunter2", value)
+
+	value, err = resolver.Resolve(ctx, "kv1/kelemetry/redis#password")
+	assert.NoError(err)
+	assert.Equal("hunter1", value)
+
+	_, err = resolver.Resolve(ctx, "secret/data/kelemetry/redis#username")
+	assert.Error(err)
+	_, err = resolver.Resolve(ctx, "secret/data/kelemetry/etcd#password")
+	assert.Error(err)
+
+	// the token is reused until half of its lease has passed
+	assert.Equal(1, logins)
+	clock.Step(time.Minute * 31)
+	_, err = resolver.Resolve(ctx, "secret/data/kelemetry/redis#password")
+	assert.NoError(err)
+	assert.Equal(2, logins)
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Traces Kelemetry's own audit pipeline for diagnosing latency.
+//
+// The pipeline spans are exported to a separate OTLP endpoint with their own sampling rate,
+// independently of the tracer that exports the Kubernetes object traces.
+// The span context is propagated across the message queue through the W3C traceparent in audit.Message.
+package selftrace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	otelsdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.Provide("self-trace", manager.Ptr(&Tracer{}))
+}
+
+type options struct {
+	enable      bool
+	endpoint    string
+	insecure    bool
+	serviceName string
+	sampleRatio float64
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "self-trace-enable", false, "trace the audit pipeline of Kelemetry itself for diagnosing latency")
+	fs.StringVar(&options.endpoint, "self-trace-endpoint", "127.0.0.1:4317", "OTLP gRPC endpoint to export self traces to")
+	fs.BoolVar(&options.insecure, "self-trace-insecure", false, "allow insecure connections to --self-trace-endpoint")
+	fs.StringVar(&options.serviceName, "self-trace-service-name", "kelemetry", "service name of self traces")
+	fs.Float64Var(
+		&options.sampleRatio,
+		"self-trace-sample-ratio",
+		0.001,
+		"ratio of received audit event batches traced; downstream spans follow the decision of the batch",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+func (options *options) Validate() error {
+	if options.sampleRatio < 0 || options.sampleRatio > 1 {
+		return fmt.Errorf("--self-trace-sample-ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Tracer creates spans of the Kelemetry pipeline.
+// All methods are no-ops if self tracing is disabled.
+type Tracer struct {
+	options options
+	Logger  logrus.FieldLogger
+
+	provider   *otelsdktrace.TracerProvider
+	tracer     oteltrace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var _ manager.Component = &Tracer{}
+
+func (tracer *Tracer) Options() manager.Options { return &tracer.options }
+
+func (tracer *Tracer) Init() error {
+	tracer.propagator = propagation.TraceContext{}
+
+	if !tracer.options.enable {
+		tracer.tracer = noop.NewTracerProvider().Tracer("")
+		return nil
+	}
+
+	clientOptions := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(tracer.options.endpoint)}
+	if tracer.options.insecure {
+		clientOptions = append(clientOptions, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), clientOptions...)
+	if err != nil {
+		return fmt.Errorf("cannot create self trace exporter: %w", err)
+	}
+
+	res, err := resource.New(
+		context.Background(),
+		resource.WithAttributes(attribute.String(string(semconv.ServiceNameKey), tracer.options.serviceName)),
+	)
+	if err != nil {
+		return fmt.Errorf("cannot create self trace resource: %w", err)
+	}
+
+	tracer.provider = otelsdktrace.NewTracerProvider(
+		otelsdktrace.WithBatcher(exporter),
+		otelsdktrace.WithResource(res),
+		otelsdktrace.WithSampler(otelsdktrace.ParentBased(otelsdktrace.TraceIDRatioBased(tracer.options.sampleRatio))),
+	)
+	tracer.tracer = tracer.provider.Tracer("github.com/kubewharf/kelemetry")
+
+	return nil
+}
+
+func (tracer *Tracer) Start(ctx context.Context) error { return nil }
+
+func (tracer *Tracer) Close(ctx context.Context) error {
+	if tracer.provider != nil {
+		if err := tracer.provider.Shutdown(ctx); err != nil {
+			return fmt.Errorf("cannot flush self traces: %w", err)
+		}
+	}
+	return nil
+}
+
+// StartSpan starts a span as a child of the span in ctx, or a new trace subject to sampling if ctx has no span.
+// The returned span must be ended by the caller.
+func (tracer *Tracer) StartSpan(
+	ctx context.Context,
+	name string,
+	attributes ...attribute.KeyValue,
+) (context.Context, oteltrace.Span) {
+	return tracer.tracer.Start(ctx, name, oteltrace.WithAttributes(attributes...))
+}
+
+// StartChildSpan is similar to StartSpan, but returns a non-recording span if ctx has no span,
+// so that stages after the start of the pipeline do not start partial traces.
+func (tracer *Tracer) StartChildSpan(
+	ctx context.Context,
+	name string,
+	attributes ...attribute.KeyValue,
+) (context.Context, oteltrace.Span) {
+	if !oteltrace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, oteltrace.SpanFromContext(ctx)
+	}
+
+	return tracer.StartSpan(ctx, name, attributes...)
+}
+
+// Inject returns the W3C traceparent of the span in ctx,
+// or an empty string if ctx has no sampled span.
+func (tracer *Tracer) Inject(ctx context.Context) string {
+	if !oteltrace.SpanContextFromContext(ctx).IsSampled() {
+		return ""
+	}
+
+	carrier := propagation.MapCarrier{}
+	tracer.propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// Extract returns a context with the remote span identified by a W3C traceparent returned from Inject.
+func (tracer *Tracer) Extract(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+
+	return tracer.propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceParent})
+}
+
+// EndSpan records err on the span if non-nil and ends it.
+func EndSpan(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selftrace
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	otelsdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	tracer := &Tracer{}
+	assert.NoError(tracer.Init())
+
+	ctx, span := tracer.StartSpan(context.Background(), "audit.webhook")
+	assert.False(span.IsRecording())
+	assert.Empty(tracer.Inject(ctx))
+	span.End()
+}
+
+func TestPropagation(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := otelsdktrace.NewTracerProvider(otelsdktrace.WithSpanProcessor(recorder))
+	tracer := &Tracer{
+		tracer:     provider.Tracer("test"),
+		propagator: propagation.TraceContext{},
+	}
+
+	_, orphan := tracer.StartChildSpan(context.Background(), "audit.produce")
+	assert.False(orphan.IsRecording(), "child spans must not start new traces")
+
+	rootCtx, root := tracer.StartSpan(context.Background(), "audit.webhook")
+	traceParent := tracer.Inject(rootCtx)
+	assert.NotEmpty(traceParent)
+	root.End()
+
+	_, child := tracer.StartChildSpan(tracer.Extract(context.Background(), traceParent), "audit.produce")
+	EndSpan(child, fmt.Errorf("queue full"))
+
+	spans := recorder.Ended()
+	assert.Len(spans, 2)
+	assert.Equal(spans[0].SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	assert.Equal(spans[0].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.Equal(codes.Error, spans[1].Status().Code)
+}
@@ -0,0 +1,210 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links EndpointSlices and Endpoints under their Services and cross-links their member pods.
+//
+// Member pods are resolved when the object span of the EndpointSlice or Endpoints is created,
+// so pods that join later in the same span window are not linked.
+package servicelinker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("service-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	enable     bool
+	linkPods   bool
+	maxMembers int
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "service-linker-enable", false, "enable linker for services, endpoint slices and endpoints")
+	fs.BoolVar(&options.linkPods, "service-linker-link-pods", true, "link member pods of endpoint slices and endpoints")
+	fs.IntVar(
+		&options.maxMembers,
+		"service-linker-max-pods",
+		100,
+		"maximum number of member pods linked from each endpoint slice or endpoints object",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options     options
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options        { return &ctrl.options }
+func (ctrl *controller) Init() error                     { return nil }
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+var (
+	serviceGvr       = corev1.SchemeGroupVersion.WithResource("services")
+	endpointsGvr     = corev1.SchemeGroupVersion.WithResource("endpoints")
+	endpointSliceGvr = discoveryv1.SchemeGroupVersion.WithResource("endpointslices")
+	podGvr           = corev1.SchemeGroupVersion.WithResource("pods")
+)
+
+func (ctrl *controller) LinkerName() string { return "service-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	gr := object.GroupVersionResource().GroupResource()
+	if gr != endpointsGvr.GroupResource() && gr != endpointSliceGvr.GroupResource() {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	if gr == endpointSliceGvr.GroupResource() {
+		return ctrl.endpointSliceLinks(object, raw)
+	}
+
+	return ctrl.endpointsLinks(object, raw)
+}
+
+func (ctrl *controller) endpointSliceLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	slice := &discoveryv1.EndpointSlice{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, slice); err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot decode endpoint slice: %w", err), "Decode")
+	}
+
+	var results []linker.LinkerResult
+
+	if serviceName := slice.Labels[discoveryv1.LabelServiceName]; serviceName != "" {
+		results = append(results, linker.LinkerResult{
+			Object: utilobject.NewRich(object.Cluster, serviceGvr, object.Namespace, serviceName, ""),
+			Role:   zconstants.LinkRoleParent,
+			Class:  "children",
+			// Same dedup ID as the owner linker, which links the same service through the owner reference,
+			// so that enabling both linkers does not create duplicate links.
+			DedupId: "ownerReference",
+		})
+	}
+
+	if ctrl.options.linkPods {
+		targets := make([]*corev1.ObjectReference, 0, len(slice.Endpoints))
+		for _, endpoint := range slice.Endpoints {
+			targets = append(targets, endpoint.TargetRef)
+		}
+		results = append(results, ctrl.podLinks(object, targets)...)
+	}
+
+	return results, nil
+}
+
+func (ctrl *controller) endpointsLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	endpoints := &corev1.Endpoints{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, endpoints); err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot decode endpoints: %w", err), "Decode")
+	}
+
+	// Endpoints always have the same name as their service.
+	results := []linker.LinkerResult{{
+		Object:  utilobject.NewRich(object.Cluster, serviceGvr, object.Namespace, object.Name, ""),
+		Role:    zconstants.LinkRoleParent,
+		Class:   "children",
+		DedupId: "service",
+	}}
+
+	if ctrl.options.linkPods {
+		var targets []*corev1.ObjectReference
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				targets = append(targets, address.TargetRef)
+			}
+			for _, address := range subset.NotReadyAddresses {
+				targets = append(targets, address.TargetRef)
+			}
+		}
+		results = append(results, ctrl.podLinks(object, targets)...)
+	}
+
+	return results, nil
+}
+
+func (ctrl *controller) podLinks(object utilobject.Rich, targets []*corev1.ObjectReference) []linker.LinkerResult {
+	var results []linker.LinkerResult
+	seen := map[types.NamespacedName]bool{}
+
+	for _, target := range targets {
+		if target == nil || target.Kind != "Pod" {
+			continue
+		}
+
+		namespace := target.Namespace
+		if namespace == "" {
+			namespace = object.Namespace
+		}
+
+		name := types.NamespacedName{Namespace: namespace, Name: target.Name}
+		if seen[name] {
+			// a pod appears in multiple subsets if it exposes multiple ports
+			continue
+		}
+		seen[name] = true
+
+		if len(results) >= ctrl.options.maxMembers {
+			break
+		}
+
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, podGvr, namespace, target.Name, target.UID),
+			Role:    zconstants.LinkRoleChild,
+			Class:   "endpoints",
+			DedupId: "endpoint/" + name.String(),
+		})
+	}
+
+	return results
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Links storage objects along the provisioning chain.
+//
+// PersistentVolumeClaims are linked as children of the pods mounting them,
+// and PersistentVolumes are linked under their bound claims and their StorageClasses,
+// so that provisioning latency appears in the trace of the workload.
+package storagelinker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/linker"
+	"github.com/kubewharf/kelemetry/pkg/k8s/objectcache"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+	"github.com/kubewharf/kelemetry/pkg/metrics"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+	"github.com/kubewharf/kelemetry/pkg/util/zconstants"
+)
+
+func init() {
+	manager.Global.ProvideListImpl("storage-linker", manager.Ptr(&controller{}), &manager.List[linker.Linker]{})
+}
+
+type options struct {
+	enable bool
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.BoolVar(&options.enable, "storage-linker-enable", false, "enable linker for pods, PVCs, PVs and StorageClasses")
+}
+
+func (options *options) EnableFlag() *bool { return &options.enable }
+
+type controller struct {
+	options     options
+	Logger      logrus.FieldLogger
+	ObjectCache *objectcache.ObjectCache
+}
+
+var _ manager.Component = &controller{}
+
+func (ctrl *controller) Options() manager.Options        { return &ctrl.options }
+func (ctrl *controller) Init() error                     { return nil }
+func (ctrl *controller) Start(ctx context.Context) error { return nil }
+func (ctrl *controller) Close(ctx context.Context) error { return nil }
+
+var (
+	podGvr          = corev1.SchemeGroupVersion.WithResource("pods")
+	pvcGvr          = corev1.SchemeGroupVersion.WithResource("persistentvolumeclaims")
+	pvGvr           = corev1.SchemeGroupVersion.WithResource("persistentvolumes")
+	storageClassGvr = storagev1.SchemeGroupVersion.WithResource("storageclasses")
+)
+
+func (ctrl *controller) LinkerName() string { return "storage-linker" }
+func (ctrl *controller) Lookup(ctx context.Context, object utilobject.Rich) ([]linker.LinkerResult, error) {
+	gr := object.GroupVersionResource().GroupResource()
+	if gr != podGvr.GroupResource() && gr != pvGvr.GroupResource() {
+		return nil, nil
+	}
+
+	logger := ctrl.Logger.WithFields(object.AsFields("object"))
+
+	raw := object.Raw
+	if raw == nil {
+		logger.Debug("Fetching dynamic object")
+
+		var err error
+		raw, err = ctrl.ObjectCache.Get(ctx, object.VersionedKey)
+		if err != nil {
+			return nil, metrics.LabelError(fmt.Errorf("cannot fetch object value: %w", err), "FetchCache")
+		}
+
+		if raw == nil {
+			logger.Debug("object no longer exists")
+			return nil, nil
+		}
+	}
+
+	if gr == podGvr.GroupResource() {
+		return podLinks(object, raw)
+	}
+
+	return pvLinks(object, raw)
+}
+
+func podLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	pod := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, pod); err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot decode pod: %w", err), "Decode")
+	}
+
+	var results []linker.LinkerResult
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, pvcGvr, object.Namespace, claimName, ""),
+			Role:    zconstants.LinkRoleChild,
+			Class:   "volumes",
+			DedupId: "volume/" + claimName,
+		})
+	}
+
+	return results, nil
+}
+
+func pvLinks(object utilobject.Rich, raw *unstructured.Unstructured) ([]linker.LinkerResult, error) {
+	pv := &corev1.PersistentVolume{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw.Object, pv); err != nil {
+		return nil, metrics.LabelError(fmt.Errorf("cannot decode persistent volume: %w", err), "Decode")
+	}
+
+	var results []linker.LinkerResult
+
+	if claim := pv.Spec.ClaimRef; claim != nil && claim.Name != "" {
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, pvcGvr, claim.Namespace, claim.Name, claim.UID),
+			Role:    zconstants.LinkRoleParent,
+			Class:   "volume",
+			DedupId: "claimRef",
+		})
+	}
+
+	if pv.Spec.StorageClassName != "" {
+		// use a separate class so that StorageClass traces are not expanded by default
+		results = append(results, linker.LinkerResult{
+			Object:  utilobject.NewRich(object.Cluster, storageClassGvr, "", pv.Spec.StorageClassName, ""),
+			Role:    zconstants.LinkRoleParent,
+			Class:   "storageClass",
+			DedupId: "storageClass",
+		})
+	}
+
+	return results, nil
+}
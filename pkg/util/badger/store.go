@@ -0,0 +1,151 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Embedded Badger storage shared by the badger tracer and the badger frontend backend,
+// so that a single process can both write and query spans without an external trace store.
+package utilbadger
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/jaegertracing/jaeger/pkg/metrics"
+	"github.com/jaegertracing/jaeger/plugin/storage/badger"
+	"github.com/jaegertracing/jaeger/storage/spanstore"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/kubewharf/kelemetry/pkg/aggregator/retention"
+	"github.com/kubewharf/kelemetry/pkg/manager"
+)
+
+func init() {
+	manager.Global.Provide("badger-store", manager.Ptr[Store](&store{}))
+}
+
+type Store interface {
+	// SpanWriter returns a writer that expires spans with the given object key tags
+	// after their retention in the span retention policy.
+	SpanWriter(tags map[string]string) spanstore.Writer
+	SpanReader() spanstore.Reader
+}
+
+type options struct {
+	directory           string
+	ephemeral           bool
+	ttl                 time.Duration
+	syncWrites          bool
+	maintenanceInterval time.Duration
+}
+
+func (options *options) Setup(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&options.directory,
+		"badger-directory",
+		"/var/lib/kelemetry/badger",
+		"directory to store badger keys and values in, under the `keys` and `values` subdirectories",
+	)
+	fs.BoolVar(&options.ephemeral, "badger-ephemeral", false, "store spans in a temporary directory that is deleted on shutdown")
+	fs.DurationVar(
+		&options.ttl,
+		"badger-span-ttl",
+		time.Hour*72,
+		"duration after which spans not matching --span-retention-cluster or --span-retention-resource are deleted",
+	)
+	fs.BoolVar(&options.syncWrites, "badger-sync-writes", false, "sync each write to disk before acknowledging it")
+	fs.DurationVar(
+		&options.maintenanceInterval,
+		"badger-maintenance-interval",
+		time.Minute*5,
+		"interval between value log garbage collections",
+	)
+}
+
+func (options *options) EnableFlag() *bool { return nil }
+
+type store struct {
+	options   options
+	Retention *retention.Policy
+
+	factory *badger.Factory
+	writers map[time.Duration]spanstore.Writer
+	reader  spanstore.Reader
+}
+
+var _ manager.Component = &store{}
+
+func (store *store) Options() manager.Options { return &store.options }
+
+func (store *store) Init() error {
+	if store.options.ttl <= 0 {
+		return fmt.Errorf("--badger-span-ttl must be positive")
+	}
+	if store.options.maintenanceInterval <= 0 {
+		return fmt.Errorf("--badger-maintenance-interval must be positive")
+	}
+
+	retentions := store.Retention.Distinct(store.options.ttl)
+	if retentions[0] <= 0 {
+		return fmt.Errorf("badger cannot retain spans forever, span retention rules must be positive")
+	}
+
+	factory, err := badger.NewFactoryWithConfig(badger.NamespaceConfig{
+		SpanStoreTTL:          store.options.ttl,
+		KeyDirectory:          filepath.Join(store.options.directory, "keys"),
+		ValueDirectory:        filepath.Join(store.options.directory, "values"),
+		Ephemeral:             store.options.ephemeral,
+		SyncWrites:            store.options.syncWrites,
+		MaintenanceInterval:   store.options.maintenanceInterval,
+		MetricsUpdateInterval: time.Second * 10,
+	}, metrics.NullFactory, zap.NewExample())
+	if err != nil {
+		return fmt.Errorf("cannot open badger store: %w", err)
+	}
+	store.factory = factory
+
+	// The TTL of a badger writer is taken from the factory options when the writer is created,
+	// so create one writer for each distinct retention.
+	store.writers = make(map[time.Duration]spanstore.Writer, len(retentions))
+	for _, ttl := range retentions {
+		factory.Options.Primary.SpanStoreTTL = ttl
+		if store.writers[ttl], err = factory.CreateSpanWriter(); err != nil {
+			return fmt.Errorf("cannot create badger span writer: %w", err)
+		}
+	}
+	factory.Options.Primary.SpanStoreTTL = store.options.ttl
+
+	if store.reader, err = factory.CreateSpanReader(); err != nil {
+		return fmt.Errorf("cannot create badger span reader: %w", err)
+	}
+
+	return nil
+}
+
+func (store *store) Start(ctx context.Context) error { return nil }
+
+func (store *store) Close(ctx context.Context) error {
+	if err := store.factory.Close(); err != nil {
+		return fmt.Errorf("cannot close badger store: %w", err)
+	}
+
+	return nil
+}
+
+func (store *store) SpanWriter(tags map[string]string) spanstore.Writer {
+	return store.writers[store.Retention.ForSpan(tags, store.options.ttl)]
+}
+
+func (store *store) SpanReader() spanstore.Reader { return store.reader }
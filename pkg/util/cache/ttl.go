@@ -82,6 +82,15 @@ func (cache *TtlOnce) Size() int {
 	return len(cache.data)
 }
 
+// Clear removes all entries.
+func (cache *TtlOnce) Clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.data = map[string]any{}
+	cache.cleanupQueue = channel.NewDeque[cleanupEntry](16)
+}
+
 func (cache *TtlOnce) RunCleanupLoop(ctx context.Context, logger logrus.FieldLogger) {
 	defer shutdown.RecoverPanic(logger)
 
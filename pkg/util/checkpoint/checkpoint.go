@@ -0,0 +1,75 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Persists in-memory state to local files so that it can be recovered after a crash.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Write atomically replaces the file at path with the JSON encoding of value.
+//
+// The data is written to a temporary file and synced before renaming,
+// so that a crash leaves either the previous or the new checkpoint but never a truncated file.
+func Write(path string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cannot encode checkpoint: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("cannot create checkpoint file: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("cannot write checkpoint file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("cannot sync checkpoint file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("cannot close checkpoint file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot replace checkpoint file: %w", err)
+	}
+
+	return nil
+}
+
+// Read decodes the checkpoint at path into value.
+// Returns false without error if no checkpoint has been written.
+func Read(path string, value any) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot read checkpoint file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("cannot decode checkpoint: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Shared client and schema of the ClickHouse span storage.
+//
+// Requests are sent over the ClickHouse HTTP interface
+// with rows encoded in the JSONEachRow format.
+package utilclickhouse
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kubewharf/kelemetry/pkg/secret"
+)
+
+type Config struct {
+	Address  string
+	Database string
+	Table    string
+	Username string
+	Password string
+	Timeout  time.Duration
+
+	prefix string
+}
+
+func (config *Config) SetupOptions(fs *pflag.FlagSet, prefix string, component string) {
+	config.prefix = prefix
+	fs.StringVar(&config.Address, prefix+"-address", "http://127.0.0.1:8123", fmt.Sprintf("ClickHouse HTTP endpoint for %s", component))
+	fs.StringVar(&config.Database, prefix+"-database", "kelemetry", fmt.Sprintf("ClickHouse database for %s", component))
+	fs.StringVar(&config.Table, prefix+"-table", "spans", fmt.Sprintf("ClickHouse span table for %s", component))
+	fs.StringVar(&config.Username, prefix+"-username", "default", fmt.Sprintf("ClickHouse username for %s", component))
+	fs.StringVar(
+		&config.Password,
+		prefix+"-password",
+		"",
+		fmt.Sprintf("ClickHouse password for %s; accepts secret references such as 'file:/path'", component),
+	)
+	fs.DurationVar(&config.Timeout, prefix+"-timeout", time.Second*30, fmt.Sprintf("timeout of ClickHouse requests for %s", component))
+}
+
+// QualifiedTable returns the backquoted database.table name.
+func (config *Config) QualifiedTable() string {
+	return fmt.Sprintf("`%s`.`%s`", config.Database, config.Table)
+}
+
+type Client struct {
+	config     Config
+	password   *secret.Value
+	httpClient http.Client
+}
+
+// NewClient creates a client that resolves the password from the secret store.
+func NewClient(config Config, secrets *secret.Store) (*Client, error) {
+	password, err := secrets.Watch(config.prefix+"-password", config.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		config:     config,
+		password:   password,
+		httpClient: http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Exec runs a statement with an optional request body, e.g. the rows of an INSERT statement.
+func (client *Client) Exec(ctx context.Context, query string, body io.Reader) error {
+	resp, err := client.do(ctx, query, nil, body)
+	if err != nil {
+		return err
+	}
+
+	return resp.Close()
+}
+
+// Select runs a query with the given {name:Type} parameters
+// and decodes each JSONEachRow output row with the decode function.
+func (client *Client) Select(ctx context.Context, query string, params map[string]string, decode func(line []byte) error) error {
+	resp, err := client.do(ctx, query+" FORMAT JSONEachRow", params, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	scanner := bufio.NewScanner(resp)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if err := decode(scanner.Bytes()); err != nil {
+			return fmt.Errorf("cannot decode row: %w", err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (client *Client) do(ctx context.Context, query string, params map[string]string, body io.Reader) (io.ReadCloser, error) {
+	values := url.Values{}
+	values.Set("database", client.config.Database)
+	values.Set("output_format_json_quote_64bit_integers", "0")
+	for name, value := range params {
+		values.Set("param_"+name, value)
+	}
+
+	if body == nil {
+		body = strings.NewReader(query)
+	} else {
+		values.Set("query", query)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.config.Address+"/?"+values.Encode(), body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	req.Header.Set("X-ClickHouse-User", client.config.Username)
+	if password := client.password.Get(); password != "" {
+		req.Header.Set("X-ClickHouse-Key", password)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("clickhouse request error: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("clickhouse returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return resp.Body, nil
+}
+
+// EncodeRows encodes rows in the JSONEachRow format.
+func EncodeRows[T any](rows []T) (string, error) {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return "", err
+		}
+	}
+
+	return sb.String(), nil
+}
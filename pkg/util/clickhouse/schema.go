@@ -0,0 +1,134 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utilclickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the input format of DateTime64(6) columns.
+const TimeFormat = "2006-01-02 15:04:05.000000"
+
+// KeyTagColumns maps the object key tags to their dedicated columns,
+// which form the sorting key of the table so that queries by object key are efficient.
+var KeyTagColumns = map[string]string{
+	"cluster":   "cluster",
+	"group":     "api_group",
+	"resource":  "resource",
+	"namespace": "namespace",
+	"name":      "name",
+}
+
+// ttlClause expires each row after its own retention_seconds, where 0 retains the row forever.
+const ttlClause = "TTL toDateTime(start_time) + toIntervalSecond(retention_seconds) DELETE WHERE retention_seconds > 0"
+
+// CreateTable returns the DDL of the span table.
+//
+// Spans are partitioned by day and sorted by object key.
+// Tag keys and values and trace IDs have bloom filter indices for tag queries and trace lookups.
+// defaultRetention is the retention of rows inserted without retention_seconds.
+func CreateTable(qualifiedTable string, defaultRetention time.Duration) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	trace_id String,
+	span_id String,
+	parent_span_id String,
+	references String,
+	service LowCardinality(String),
+	operation String,
+	start_time DateTime64(6, 'UTC'),
+	duration_us UInt64,
+	cluster LowCardinality(String),
+	api_group LowCardinality(String),
+	resource LowCardinality(String),
+	namespace String,
+	name String,
+	tags Map(String, String),
+	logs String,
+	retention_seconds UInt32 DEFAULT %d,
+	INDEX idx_trace_id trace_id TYPE bloom_filter GRANULARITY 1,
+	INDEX idx_tag_keys mapKeys(tags) TYPE bloom_filter GRANULARITY 4,
+	INDEX idx_tag_values mapValues(tags) TYPE bloom_filter GRANULARITY 4
+) ENGINE = MergeTree
+PARTITION BY toDate(start_time)
+ORDER BY (cluster, resource, namespace, name, start_time)
+%s`, qualifiedTable, int64(defaultRetention.Seconds()), ttlClause)
+}
+
+// MigrateRetention returns the statements that add per-row retention to a span table
+// created before the retention_seconds column was introduced.
+// Existing rows are assigned defaultRetention.
+func MigrateRetention(qualifiedTable string, defaultRetention time.Duration) []string {
+	return []string{
+		fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN IF NOT EXISTS retention_seconds UInt32 DEFAULT %d",
+			qualifiedTable, int64(defaultRetention.Seconds()),
+		),
+		fmt.Sprintf("ALTER TABLE %s MODIFY TTL %s", qualifiedTable, strings.TrimPrefix(ttlClause, "TTL ")),
+	}
+}
+
+// SpanRow is a row of the span table.
+type SpanRow struct {
+	TraceId      string `json:"trace_id"`
+	SpanId       string `json:"span_id"`
+	ParentSpanId string `json:"parent_span_id"`
+	// JSON-encoded []Reference of follows-from references and links.
+	References string `json:"references"`
+	Service    string `json:"service"`
+	Operation  string `json:"operation"`
+	// Formatted in TimeFormat when inserting.
+	// Selected as toUnixTimestamp64Micro(start_time) into StartTimeUs when reading.
+	StartTime   string            `json:"start_time,omitempty"`
+	StartTimeUs int64             `json:"start_time_us,omitempty"`
+	DurationUs  uint64            `json:"duration_us"`
+	Cluster     string            `json:"cluster"`
+	Group       string            `json:"api_group"`
+	Resource    string            `json:"resource"`
+	Namespace   string            `json:"namespace"`
+	Name        string            `json:"name"`
+	Tags        map[string]string `json:"tags"`
+	// JSON-encoded []Log.
+	Logs string `json:"logs"`
+	// Number of seconds after StartTime at which the row is deleted, or 0 to retain forever.
+	// Only set when inserting.
+	RetentionSeconds uint32 `json:"retention_seconds"`
+}
+
+// SelectColumns is the column list for reading SpanRow.
+const SelectColumns = "trace_id, span_id, parent_span_id, references, service, operation, " +
+	"toUnixTimestamp64Micro(start_time) AS start_time_us, duration_us, " +
+	"cluster, api_group, resource, namespace, name, tags, logs"
+
+type Reference struct {
+	TraceId string `json:"traceId"`
+	SpanId  string `json:"spanId"`
+}
+
+type Log struct {
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields"`
+}
+
+func EncodeJson(value any) string {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("cannot encode %T: %v", value, err))
+	}
+
+	return string(bytes)
+}
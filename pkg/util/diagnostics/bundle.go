@@ -0,0 +1,137 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Captures runtime profiles of the process into a single archive for offline analysis.
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+)
+
+// Info describes the process in a bundle.
+type Info struct {
+	CaptureTime  time.Time        `json:"captureTime"`
+	CpuDuration  string           `json:"cpuDuration"`
+	GoVersion    string           `json:"goVersion"`
+	Version      string           `json:"version"`
+	GoMaxProcs   int              `json:"goMaxProcs"`
+	NumGoroutine int              `json:"numGoroutine"`
+	MemoryLimit  int64            `json:"memoryLimit"`
+	MemStats     runtime.MemStats `json:"memStats"`
+}
+
+// Capture collects a CPU profile for cpuDuration (skipped if zero) and then writes a zip archive to w containing
+// `cpu.pprof`, `heap.pprof`, `allocs.pprof`, `goroutine.txt` (full stack dump) and `info.json`.
+//
+// Nothing is written to w if the CPU profile cannot be collected,
+// e.g. because another CPU profile is in progress or ctx is canceled.
+func Capture(ctx context.Context, w io.Writer, cpuDuration time.Duration) error {
+	captureTime := time.Now()
+
+	var cpuProfile bytes.Buffer
+	if cpuDuration > 0 {
+		if err := pprof.StartCPUProfile(&cpuProfile); err != nil {
+			return fmt.Errorf("cannot start CPU profile: %w", err)
+		}
+
+		timer := time.NewTimer(cpuDuration)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			pprof.StopCPUProfile()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		pprof.StopCPUProfile()
+	}
+
+	archive := zip.NewWriter(w)
+
+	if cpuDuration > 0 {
+		if err := writeEntry(archive, "cpu.pprof", func(w io.Writer) error {
+			_, err := cpuProfile.WriteTo(w)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, profile := range []struct {
+		file  string
+		name  string
+		debug int
+	}{
+		{file: "heap.pprof", name: "heap"},
+		{file: "allocs.pprof", name: "allocs"},
+		{file: "goroutine.txt", name: "goroutine", debug: 2},
+	} {
+		if err := writeEntry(archive, profile.file, func(w io.Writer) error {
+			return pprof.Lookup(profile.name).WriteTo(w, profile.debug)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := writeEntry(archive, "info.json", func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(collectInfo(captureTime, cpuDuration))
+	}); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeEntry(archive *zip.Writer, name string, write func(w io.Writer) error) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot create %s in bundle: %w", name, err)
+	}
+
+	if err := write(entry); err != nil {
+		return fmt.Errorf("cannot write %s to bundle: %w", name, err)
+	}
+
+	return nil
+}
+
+func collectInfo(captureTime time.Time, cpuDuration time.Duration) *Info {
+	info := &Info{
+		CaptureTime:  captureTime,
+		CpuDuration:  cpuDuration.String(),
+		GoVersion:    runtime.Version(),
+		GoMaxProcs:   runtime.GOMAXPROCS(0),
+		NumGoroutine: runtime.NumGoroutine(),
+		MemoryLimit:  debug.SetMemoryLimit(-1),
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info.Version = buildInfo.Main.Version
+	}
+
+	runtime.ReadMemStats(&info.MemStats)
+
+	return info
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/util/diagnostics"
+)
+
+func TestCapture(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(diagnostics.Capture(context.Background(), &buf, time.Millisecond*100))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(err)
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		assert.NoError(err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(err)
+		files[file.Name] = content
+	}
+
+	assert.Contains(files, "cpu.pprof")
+	assert.Contains(files, "heap.pprof")
+	assert.Contains(files, "allocs.pprof")
+	assert.Contains(string(files["goroutine.txt"]), "TestCapture")
+
+	var info diagnostics.Info
+	assert.NoError(json.Unmarshal(files["info.json"], &info))
+	assert.Equal("100ms", info.CpuDuration)
+	assert.Positive(info.NumGoroutine)
+}
+
+func TestCaptureCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	assert.ErrorIs(diagnostics.Capture(ctx, &buf, time.Minute), context.Canceled)
+	assert.Zero(buf.Len())
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package informerutil
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+// ListKind classifies the requests with which a reflector (re)populates its store.
+type ListKind string
+
+const (
+	// ListKindFull is a list without a known resource version, which transfers and replaces every object.
+	ListKindFull ListKind = "Full"
+	// ListKindResume is a list from the last synced resource version, served from the watch cache of the apiserver.
+	ListKindResume ListKind = "Resume"
+	// ListKindStream is a watch request that streams the initial state from the watch cache.
+	ListKindStream ListKind = "Stream"
+)
+
+type ReflectorOptions struct {
+	// WatchList streams the initial state of the store through a watch request with sendInitialEvents,
+	// which uses less apiserver memory than a list for large resources.
+	// The reflector falls back to list requests if the apiserver does not support streaming.
+	WatchList bool
+	// OnList is called for each request that (re)populates the store.
+	OnList func(kind ListKind)
+}
+
+// NewReflector creates a reflector that traces how its store is populated.
+//
+// Watch bookmarks are always requested so that the last synced resource version stays recent
+// and watches interrupted by apiserver restarts can be resumed without relisting.
+func NewReflector(lw *toolscache.ListWatch, expectedType any, store toolscache.Store, options ReflectorOptions) *toolscache.Reflector {
+	onList := options.OnList
+	if onList == nil {
+		onList = func(ListKind) {}
+	}
+
+	wrapped := &toolscache.ListWatch{
+		ListFunc: func(listOptions metav1.ListOptions) (runtime.Object, error) {
+			if listOptions.ResourceVersion == "" || listOptions.ResourceVersion == "0" {
+				onList(ListKindFull)
+			} else {
+				onList(ListKindResume)
+			}
+
+			return lw.ListFunc(listOptions)
+		},
+		WatchFunc: func(watchOptions metav1.ListOptions) (watch.Interface, error) {
+			if ptr.Deref(watchOptions.SendInitialEvents, false) {
+				onList(ListKindStream)
+			}
+
+			watchOptions.AllowWatchBookmarks = true
+			return lw.WatchFunc(watchOptions)
+		},
+		DisableChunking: lw.DisableChunking,
+	}
+
+	reflector := toolscache.NewReflector(wrapped, expectedType, store, 0)
+	if options.WatchList {
+		reflector.UseWatchList = ptr.To(true)
+	}
+	return reflector
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package informerutil_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	informerutil "github.com/kubewharf/kelemetry/pkg/util/informer"
+)
+
+func testReflector(t *testing.T, watchList bool) []informerutil.ListKind {
+	var mu sync.Mutex
+	kinds := []informerutil.ListKind{}
+	watched := make(chan metav1.ListOptions, 1)
+
+	lw := &toolscache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &corev1.ConfigMapList{ListMeta: metav1.ListMeta{ResourceVersion: "10"}}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			if ptr.Deref(options.SendInitialEvents, false) {
+				return nil, errors.New("watch list is not supported")
+			}
+
+			select {
+			case watched <- options:
+			default:
+			}
+			return watch.NewFake(), nil
+		},
+	}
+
+	reflector := informerutil.NewReflector(
+		lw,
+		&corev1.ConfigMap{},
+		toolscache.NewStore(toolscache.MetaNamespaceKeyFunc),
+		informerutil.ReflectorOptions{
+			WatchList: watchList,
+			OnList: func(kind informerutil.ListKind) {
+				mu.Lock()
+				defer mu.Unlock()
+				kinds = append(kinds, kind)
+			},
+		},
+	)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go reflector.Run(stopCh)
+
+	select {
+	case options := <-watched:
+		assert.True(t, options.AllowWatchBookmarks)
+		assert.Equal(t, "10", options.ResourceVersion)
+	case <-time.After(time.Second * 10):
+		t.Fatal("reflector did not start watching")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return kinds
+}
+
+func TestReflectorList(t *testing.T) {
+	assert.Equal(t, []informerutil.ListKind{informerutil.ListKindFull}, testReflector(t, false))
+}
+
+func TestReflectorWatchListFallback(t *testing.T) {
+	assert.Equal(t, []informerutil.ListKind{informerutil.ListKindStream, informerutil.ListKindFull}, testReflector(t, true))
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Correlation fields emitted on every structured log entry.
+//
+// Log entries conventionally carry the object they are about through utilobject.Key.AsFields(prefix),
+// the component through the "mod" and "submod" fields and the trace through a "traceId" field.
+// Formatter derives a consistent set of top-level fields from them,
+// so that log pipelines can pivot from a log entry to the affected object and trace.
+package logfields
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+const (
+	// Component is the module of the entry, joined with the submodule if any, e.g. "diff-controller/watch-leader-elector".
+	Component = "component"
+	// Cluster is the cluster of the object the entry is about.
+	Cluster = "cluster"
+	// Object is the utilobject.Key string of the object the entry is about.
+	Object = "object"
+	// TraceId is the hex trace ID of the span the entry is about.
+	TraceId = "traceId"
+)
+
+// objectPrefix is the preferred AsFields prefix if an entry refers to multiple objects.
+const objectPrefix = "object"
+
+// Formatter adds the correlation fields to entries before passing them to the inner formatter.
+type Formatter struct {
+	Inner logrus.Formatter
+}
+
+func (formatter *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+4)
+	for key, value := range entry.Data {
+		data[key] = value
+	}
+	Correlate(data)
+
+	clone := *entry
+	clone.Data = data
+	return formatter.Inner.Format(&clone)
+}
+
+// Correlate adds the correlation fields derived from other fields.
+// Fields already set explicitly are not overwritten.
+func Correlate(data logrus.Fields) {
+	if _, exists := data[Component]; !exists {
+		if mod, ok := data[loglevel.ModField].(string); ok && mod != "" {
+			if submod, ok := data[loglevel.SubmodField].(string); ok && submod != "" {
+				mod += "/" + submod
+			}
+			data[Component] = mod
+		}
+	}
+
+	if key, ok := objectKey(data); ok {
+		if _, exists := data[Object]; !exists {
+			data[Object] = key.String()
+		}
+		if _, exists := data[Cluster]; !exists {
+			data[Cluster] = key.Cluster
+		}
+	}
+}
+
+// objectKey finds the object fields generated by utilobject.Key.AsFields,
+// preferring the "object" prefix, otherwise the lexicographically first complete prefix.
+func objectKey(data logrus.Fields) (utilobject.Key, bool) {
+	if key, ok := keyWithPrefix(data, objectPrefix); ok {
+		return key, true
+	}
+
+	prefixes := []string{}
+	for field := range data {
+		if prefix, ok := strings.CutSuffix(field, "Resource"); ok && prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		if key, ok := keyWithPrefix(data, prefix); ok {
+			return key, true
+		}
+	}
+
+	return utilobject.Key{}, false
+}
+
+func keyWithPrefix(data logrus.Fields, prefix string) (key utilobject.Key, ok bool) {
+	for suffix, field := range map[string]*string{
+		"Cluster":   &key.Cluster,
+		"Group":     &key.Group,
+		"Resource":  &key.Resource,
+		"Namespace": &key.Namespace,
+		"Name":      &key.Name,
+	} {
+		*field, ok = data[prefix+suffix].(string)
+		if !ok {
+			return key, false
+		}
+	}
+
+	return key, true
+}
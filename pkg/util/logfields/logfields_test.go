@@ -0,0 +1,67 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logfields_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/util/logfields"
+	utilobject "github.com/kubewharf/kelemetry/pkg/util/object"
+)
+
+func TestFormatter(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logfields.Formatter{Inner: &logrus.JSONFormatter{}})
+
+	object := utilobject.Key{Cluster: "tracetest", Group: "apps", Resource: "deployments", Namespace: "default", Name: "demo"}
+	owner := utilobject.Key{Cluster: "tracetest", Resource: "nodes", Name: "node-1"}
+
+	entry := logger.WithField("mod", "diff-controller").WithField("submod", "watch-leader-elector").
+		WithFields(owner.AsFields("owner")).
+		WithFields(object.AsFields("object"))
+	entry.WithField(logfields.TraceId, "0123456789abcdef").Error("cannot fetch")
+
+	var output map[string]any
+	assert.NoError(json.Unmarshal(buf.Bytes(), &output))
+	assert.Equal("diff-controller/watch-leader-elector", output[logfields.Component])
+	assert.Equal("tracetest", output[logfields.Cluster])
+	assert.Equal("tracetest/apps/deployments/default/demo", output[logfields.Object])
+	assert.Equal("0123456789abcdef", output[logfields.TraceId])
+	assert.NotContains(entry.Data, logfields.Object, "formatter must not mutate the entry")
+}
+
+func TestCorrelate(t *testing.T) {
+	assert := assert.New(t)
+
+	owner := utilobject.Key{Cluster: "other", Resource: "nodes", Name: "node-1"}
+	data := owner.AsFields("node")
+	data["cluster"] = "explicit"
+	logfields.Correlate(data)
+	assert.Equal("explicit", data[logfields.Cluster])
+	assert.Equal("other//nodes//node-1", data[logfields.Object])
+
+	data = logrus.Fields{"mod": "aggregator"}
+	logfields.Correlate(data)
+	assert.Equal(logrus.Fields{"mod": "aggregator", logfields.Component: "aggregator"}, data)
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Per-module log levels on a single logrus logger.
+//
+// Modules are identified by the "mod" field of log entries, optionally refined by the "submod" field,
+// and form a hierarchy separated by "/": the level of "diff-cache" also applies to
+// "diff-cache/local" and "diff-cache/local/trimLoop" unless they have their own level.
+package loglevel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ModField is the logrus field that identifies the module of a log entry.
+	ModField = "mod"
+	// SubmodField is the logrus field that identifies a child of the module of a log entry.
+	SubmodField = "submod"
+)
+
+// Levels controls the log level of each module of a logger.
+//
+// The logger level is set to the most verbose level among the default and all overrides,
+// and entries above the level of their module are dropped by the formatter installed in Install.
+//
+// Overrides come from two layers: configured overrides are replaced by Configure,
+// while runtime overrides set through SetOverride survive reconfiguration and take precedence.
+type Levels struct {
+	logger *logrus.Logger
+
+	mutex        sync.RWMutex
+	defaultLevel logrus.Level
+	configured   map[string]logrus.Level
+	runtime      map[string]logrus.Level
+}
+
+func New(logger *logrus.Logger) *Levels {
+	return &Levels{
+		logger:       logger,
+		defaultLevel: logger.GetLevel(),
+		configured:   map[string]logrus.Level{},
+		runtime:      map[string]logrus.Level{},
+	}
+}
+
+// Parse parses a comma-separated list of levels such as "info,diff-cache=debug,audit-consumer=warn".
+// An item without "=" sets the default level, which is fallback if no such item is given.
+func Parse(spec string, fallback logrus.Level) (defaultLevel logrus.Level, overrides map[string]logrus.Level, err error) {
+	defaultLevel = fallback
+	overrides = map[string]logrus.Level{}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		mod, levelString, hasMod := strings.Cut(item, "=")
+		if !hasMod {
+			levelString = mod
+		}
+
+		level, err := logrus.ParseLevel(levelString)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid log level %q: %w", item, err)
+		}
+
+		if hasMod {
+			mod = strings.Trim(strings.TrimSpace(mod), "/")
+			if mod == "" {
+				return 0, nil, fmt.Errorf("invalid log level %q: module name is empty", item)
+			}
+			overrides[mod] = level
+		} else {
+			defaultLevel = level
+		}
+	}
+
+	return defaultLevel, overrides, nil
+}
+
+// Install wraps the current formatter of the logger to filter entries by module.
+// Must be called again after the formatter is replaced.
+func (levels *Levels) Install() {
+	levels.logger.SetFormatter(&filterFormatter{levels: levels, inner: levels.logger.Formatter})
+}
+
+// AddHook adds a hook to the logger, which receives entries of all modules regardless of their levels.
+func (levels *Levels) AddHook(hook logrus.Hook) {
+	levels.logger.AddHook(hook)
+}
+
+// Configure replaces the default level and the configured overrides.
+// Runtime overrides are retained.
+func (levels *Levels) Configure(defaultLevel logrus.Level, overrides map[string]logrus.Level) {
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+
+	levels.defaultLevel = defaultLevel
+	levels.configured = make(map[string]logrus.Level, len(overrides))
+	for mod, level := range overrides {
+		levels.configured[mod] = level
+	}
+	levels.apply()
+}
+
+// SetOverride sets the runtime level of a module and its descendants.
+func (levels *Levels) SetOverride(mod string, level logrus.Level) {
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+
+	levels.runtime[mod] = level
+	levels.apply()
+}
+
+// ClearOverride removes the runtime level of a module,
+// reverting it to the configured level.
+func (levels *Levels) ClearOverride(mod string) {
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+
+	delete(levels.runtime, mod)
+	levels.apply()
+}
+
+// Default returns the level of modules without overrides.
+func (levels *Levels) Default() logrus.Level {
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+
+	return levels.defaultLevel
+}
+
+// Overrides returns the modules with overridden levels, including both configured and runtime overrides.
+func (levels *Levels) Overrides() map[string]string {
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+
+	output := make(map[string]string, len(levels.configured)+len(levels.runtime))
+	for mod, level := range levels.configured {
+		output[mod] = level.String()
+	}
+	for mod, level := range levels.runtime {
+		output[mod] = level.String()
+	}
+	return output
+}
+
+// Get returns the effective level of a module.
+func (levels *Levels) Get(mod string) logrus.Level {
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+
+	return levels.get(mod)
+}
+
+// get returns the level of the closest ancestor of mod (inclusive) with an override.
+func (levels *Levels) get(mod string) logrus.Level {
+	for mod != "" {
+		if level, exists := levels.runtime[mod]; exists {
+			return level
+		}
+		if level, exists := levels.configured[mod]; exists {
+			return level
+		}
+
+		slash := strings.LastIndexByte(mod, '/')
+		if slash == -1 {
+			break
+		}
+		mod = mod[:slash]
+	}
+
+	return levels.defaultLevel
+}
+
+func (levels *Levels) apply() {
+	verbose := levels.defaultLevel
+	for _, overrides := range []map[string]logrus.Level{levels.configured, levels.runtime} {
+		for _, level := range overrides {
+			if level > verbose {
+				verbose = level
+			}
+		}
+	}
+
+	levels.logger.SetLevel(verbose)
+}
+
+type filterFormatter struct {
+	levels *Levels
+	inner  logrus.Formatter
+}
+
+func (formatter *filterFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	mod, _ := entry.Data[ModField].(string)
+	if submod, ok := entry.Data[SubmodField].(string); ok && submod != "" {
+		mod += "/" + submod
+	}
+
+	formatter.levels.mutex.RLock()
+	level := formatter.levels.get(mod)
+	formatter.levels.mutex.RUnlock()
+
+	if entry.Level > level {
+		return nil, nil
+	}
+
+	return formatter.inner.Format(entry)
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loglevel_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/kelemetry/pkg/util/loglevel"
+)
+
+func TestOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	levels := loglevel.New(logger)
+	levels.Install()
+	levels.Configure(logrus.InfoLevel, nil)
+	levels.SetOverride("noisy", logrus.DebugLevel)
+
+	logger.WithField(loglevel.ModField, "noisy").Debug("noisy debug")
+	logger.WithField(loglevel.ModField, "quiet").Debug("quiet debug")
+	logger.WithField(loglevel.ModField, "quiet").Info("quiet info")
+
+	assert.Contains(buf.String(), "noisy debug")
+	assert.NotContains(buf.String(), "quiet debug")
+	assert.Contains(buf.String(), "quiet info")
+	assert.Equal(map[string]string{"noisy": "debug"}, levels.Overrides())
+
+	levels.ClearOverride("noisy")
+	assert.Equal(logrus.InfoLevel, logger.GetLevel())
+	assert.Equal(logrus.InfoLevel, levels.Get("noisy"))
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	defaultLevel, overrides, err := loglevel.Parse("info, diff-cache=debug,audit-consumer=warn", logrus.DebugLevel)
+	assert.NoError(err)
+	assert.Equal(logrus.InfoLevel, defaultLevel)
+	assert.Equal(map[string]logrus.Level{"diff-cache": logrus.DebugLevel, "audit-consumer": logrus.WarnLevel}, overrides)
+
+	defaultLevel, overrides, err = loglevel.Parse("diff-cache=info", logrus.DebugLevel)
+	assert.NoError(err)
+	assert.Equal(logrus.DebugLevel, defaultLevel)
+	assert.Equal(map[string]logrus.Level{"diff-cache": logrus.InfoLevel}, overrides)
+
+	_, _, err = loglevel.Parse("info,diff-cache=verbose", logrus.DebugLevel)
+	assert.ErrorContains(err, `invalid log level "diff-cache=verbose"`)
+
+	_, _, err = loglevel.Parse("=debug", logrus.DebugLevel)
+	assert.ErrorContains(err, "module name is empty")
+}
+
+func TestHierarchy(t *testing.T) {
+	assert := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	levels := loglevel.New(logger)
+	levels.Install()
+	levels.Configure(logrus.WarnLevel, map[string]logrus.Level{
+		"diff-cache":                logrus.DebugLevel,
+		"diff-cache/local/trimLoop": logrus.ErrorLevel,
+	})
+
+	assert.Equal(logrus.DebugLevel, levels.Get("diff-cache/etcd"))
+	assert.Equal(logrus.WarnLevel, levels.Get("diff-cache-wrapper"))
+
+	logger.WithField(loglevel.ModField, "diff-cache/local").Debug("local debug")
+	logger.WithField(loglevel.ModField, "diff-cache/local").WithField(loglevel.SubmodField, "trimLoop").Warn("trim warn")
+	assert.Contains(buf.String(), "local debug")
+	assert.NotContains(buf.String(), "trim warn")
+
+	levels.SetOverride("diff-cache", logrus.InfoLevel)
+	levels.Configure(logrus.WarnLevel, map[string]logrus.Level{"diff-cache": logrus.TraceLevel})
+	assert.Equal(logrus.InfoLevel, levels.Get("diff-cache/etcd"), "runtime overrides should survive reconfiguration")
+	assert.Equal(logrus.TraceLevel, logger.GetLevel())
+
+	levels.ClearOverride("diff-cache")
+	assert.Equal(logrus.TraceLevel, levels.Get("diff-cache/etcd"))
+	assert.Equal(map[string]string{"diff-cache": "trace"}, levels.Overrides())
+}
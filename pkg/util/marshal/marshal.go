@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 
@@ -52,6 +53,26 @@ func (v *Optional[T]) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
+// Duration is a time.Duration unmarshalled from a duration string such as "1m30s".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(buf []byte) error {
+	var str string
+	if err := json.Unmarshal(buf, &str); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = duration
+	return nil
+}
+
 type ObjectFilter struct {
 	Cluster   Optional[StringFilter] `json:"cluster"`
 	Group     Optional[StringFilter] `json:"group"`
@@ -53,6 +53,23 @@ func (ref Rich) AsFields(prefix string) logrus.Fields {
 	return fields
 }
 
+// NewRich creates a reference to an object of the specified type.
+func NewRich(cluster string, gvr schema.GroupVersionResource, namespace string, name string, uid types.UID) Rich {
+	return Rich{
+		VersionedKey: VersionedKey{
+			Key: Key{
+				Cluster:   cluster,
+				Group:     gvr.Group,
+				Resource:  gvr.Resource,
+				Namespace: namespace,
+				Name:      name,
+			},
+			Version: gvr.Version,
+		},
+		Uid: uid,
+	}
+}
+
 func RichFromUnstructured(
 	uns *unstructured.Unstructured,
 	cluster string,
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -96,10 +97,15 @@ func (list *DeferList) RunWithChannel(ctx context.Context, logger logrus.FieldLo
 	}
 }
 
+// PanicField is the logrus field containing the stack trace of a recovered panic.
+const PanicField = "panic"
+
+// RecoverPanic logs a panic of the current goroutine before crashing the process.
+// The entry contains the stack trace in PanicField so that log hooks can report it.
 func RecoverPanic(logger logrus.FieldLogger) {
 	utilruntime.HandleCrash(func(err any) {
 		if logger != nil {
-			logger.WithField("error", err).Error()
+			logger.WithField("error", err).WithField(PanicField, string(debug.Stack())).Error("Panic recovered")
 		}
 	})
 }
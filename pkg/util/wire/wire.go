@@ -0,0 +1,154 @@
+// Copyright 2023 The Kelemetry Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Versioned binary framing of internal payloads sent over message queues and stored in caches.
+//
+// Payloads are either plain JSON (the legacy format) or a protobuf message prefixed with a header
+// containing a magic byte and the schema version.
+// Since a JSON document never starts with the magic byte, decoders accept both formats,
+// so that producers can switch to protobuf after all consumers are upgraded.
+package utilwire
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type Encoding string
+
+const (
+	EncodingJson     Encoding = "json"
+	EncodingProtobuf Encoding = "protobuf"
+)
+
+func (encoding *Encoding) String() string { return string(*encoding) }
+
+func (encoding *Encoding) Set(input string) error {
+	switch Encoding(input) {
+	case EncodingJson, EncodingProtobuf:
+		*encoding = Encoding(input)
+		return nil
+	default:
+		return fmt.Errorf("unsupported encoding %q", input)
+	}
+}
+
+func (encoding *Encoding) Type() string { return "encoding" }
+
+const magic byte = 0
+
+const headerLength = 2
+
+// Frame prefixes a protobuf body with the header of the given schema version.
+func Frame(version byte, body []byte) []byte {
+	return append([]byte{magic, version}, body...)
+}
+
+// Unframe returns the schema version and the protobuf body of a framed payload.
+// isFramed is false if the payload is legacy JSON.
+func Unframe(payload []byte) (isFramed bool, version byte, body []byte, err error) {
+	if len(payload) == 0 || payload[0] != magic {
+		return false, 0, nil, nil
+	}
+
+	if len(payload) < headerLength {
+		return true, 0, nil, fmt.Errorf("truncated payload header")
+	}
+
+	return true, payload[1], payload[headerLength:], nil
+}
+
+// Field is a decoded protobuf field.
+// Only the wire types used by the internal schemas are supported.
+type Field struct {
+	Number protowire.Number
+	Varint uint64
+	Bytes  []byte
+}
+
+// Fields decodes the top-level fields of a protobuf message.
+// Unknown fields of newer schema versions are returned as well and should be ignored by the caller.
+func Fields(body []byte) ([]Field, error) {
+	fields := []Field{}
+
+	for len(body) > 0 {
+		number, wireType, n := protowire.ConsumeTag(body)
+		if n < 0 {
+			return nil, fmt.Errorf("invalid field tag: %w", protowire.ParseError(n))
+		}
+		body = body[n:]
+
+		field := Field{Number: number}
+
+		switch wireType {
+		case protowire.VarintType:
+			field.Varint, n = protowire.ConsumeVarint(body)
+		case protowire.BytesType:
+			field.Bytes, n = protowire.ConsumeBytes(body)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, body)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("invalid value of field %d: %w", number, protowire.ParseError(n))
+		}
+		body = body[n:]
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// AppendString appends a string field, omitting empty strings as in proto3.
+func AppendString(buf []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return buf
+	}
+	buf = protowire.AppendTag(buf, number, protowire.BytesType)
+	return protowire.AppendString(buf, value)
+}
+
+// AppendBytes appends a bytes field, omitting empty values as in proto3.
+func AppendBytes(buf []byte, number protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	buf = protowire.AppendTag(buf, number, protowire.BytesType)
+	return protowire.AppendBytes(buf, value)
+}
+
+// AppendBool appends a bool field, omitting false as in proto3.
+func AppendBool(buf []byte, number protowire.Number, value bool) []byte {
+	if !value {
+		return buf
+	}
+	buf = protowire.AppendTag(buf, number, protowire.VarintType)
+	return protowire.AppendVarint(buf, 1)
+}
+
+// AppendTime appends a timestamp as an int64 field of nanoseconds since the Unix epoch, omitting zero times.
+func AppendTime(buf []byte, number protowire.Number, value time.Time) []byte {
+	if value.IsZero() {
+		return buf
+	}
+	buf = protowire.AppendTag(buf, number, protowire.VarintType)
+	return protowire.AppendVarint(buf, uint64(value.UnixNano()))
+}
+
+// Time decodes a timestamp appended by AppendTime.
+func (field Field) Time() time.Time {
+	return time.Unix(0, int64(field.Varint))
+}
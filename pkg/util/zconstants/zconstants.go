@@ -55,6 +55,14 @@ const (
 
 	TraceSourceAudit = "audit"
 	TraceSourceEvent = "event"
+	TraceSourceFalco = "falco"
+	TraceSourceNode  = "node"
+
+	// Events synthesized by analyzing other events.
+	TraceSourceAnalysis = "analysis"
+
+	// Periodic indications that an object exists without activity.
+	TraceSourceHeartbeat = "heartbeat"
 )
 
 func KnownPseudoTraceSources() []string {
@@ -65,6 +73,10 @@ func KnownNonPseudoTraceSources() []string {
 	return []string{
 		TraceSourceAudit,
 		TraceSourceEvent,
+		TraceSourceFalco,
+		TraceSourceNode,
+		TraceSourceAnalysis,
+		TraceSourceHeartbeat,
 	}
 }
 
@@ -75,12 +87,15 @@ const LogTypeAttr = Prefix + "logType"
 type LogType string
 
 const (
-	LogTypeRealError      LogType = "realError"
-	LogTypeRealVerbose    LogType = "realVerbose"
-	LogTypeKelemetryError LogType = "kelemetryError"
-	LogTypeObjectSnapshot LogType = "audit/objectSnapshot"
-	LogTypeObjectDiff     LogType = "audit/objectDiff"
-	LogTypeEventMessage   LogType = "event/message"
+	LogTypeRealError        LogType = "realError"
+	LogTypeRealVerbose      LogType = "realVerbose"
+	LogTypeKelemetryError   LogType = "kelemetryError"
+	LogTypeObjectSnapshot   LogType = "audit/objectSnapshot"
+	LogTypeObjectDiff       LogType = "audit/objectDiff"
+	LogTypeEventMessage     LogType = "event/message"
+	LogTypeFalcoOutput      LogType = "falco/output"
+	LogTypeAdmissionWebhook LogType = "audit/admissionWebhook"
+	LogTypeContainerLogs    LogType = "container/logs"
 )
 
 // DummyDuration is the span duration used when the span is instantaneous.